@@ -3,26 +3,39 @@ package api
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/donnyhardyanto/dxlib"
 	"net"
 	"net/http"
-	"strings"
+	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 
 	dxlibConfiguration "github.com/donnyhardyanto/dxlib/configuration"
 	"github.com/donnyhardyanto/dxlib/core"
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
 	"github.com/donnyhardyanto/dxlib/log"
 	"github.com/donnyhardyanto/dxlib/utils"
+	"github.com/donnyhardyanto/dxlib/utils/cache"
 	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
 	utilsJSON "github.com/donnyhardyanto/dxlib/utils/json"
+	"github.com/donnyhardyanto/dxlib/utils/retry"
 )
 
 const (
-	DXAPIDefaultWriteTimeoutSec = 300
-	DXAPIDefaultReadTimeoutSec  = 300
+	DXAPIDefaultWriteTimeoutSec    = 300
+	DXAPIDefaultReadTimeoutSec     = 300
+	DXAPIDefaultShutdownTimeoutSec = 30
 )
 
 type DXAPIAuditLogEntry struct {
@@ -45,17 +58,70 @@ type DXAuditLogHandler func(oldAuditLogId int64, parameters *DXAPIAuditLogEntry)
 type DXAPI struct {
 	NameId                   string
 	Address                  string
+	Addresses                []string
+	UnixSocketFileMode       os.FileMode
 	WriteTimeoutSec          int
 	ReadTimeoutSec           int
-	EndPoints                []DXAPIEndPoint
+	ShutdownTimeoutSec       int
+	EndPoints                []*DXAPIEndPoint
 	RuntimeIsActive          bool
 	HTTPServer               *http.Server
+	HTTPServers              []*http.Server
 	Log                      log.DXLog
 	Context                  context.Context
 	Cancel                   context.CancelFunc
 	OnAuditLogStart          DXAuditLogHandler
 	OnAuditLogUserIdentified DXAuditLogHandler
 	OnAuditLogEnd            DXAuditLogHandler
+	NotFoundHandler          DXAPIEndPointExecuteFunc
+	MethodNotAllowedHandler  DXAPIEndPointExecuteFunc
+	PathNormalizationPolicy  DXAPIPathNormalizationPolicy
+	MaxConcurrentRequests    int
+	MaxQueuedRequests        int
+	QueueTimeoutMs           int
+	OnConcurrencyUtilization DXAPIConcurrencyUtilizationHandler
+	// Deprecated endpoints whose SunsetDate is passed answer 410 Gone instead of executing
+	IsSunsetEndPointGone bool
+	// IsVersionEndPointEnabled registers GET /version answering core.GetBuildInfo, unless the application defines that uri
+	IsVersionEndPointEnabled bool
+	// IsAdminEndPointsEnabled registers at the start the endpoints of RegisterAdminEndPoints under AdminUriPrefix, behind
+	// AdminMiddlewares which must authenticate the caller
+	IsAdminEndPointsEnabled bool
+	AdminUriPrefix          string
+	AdminMiddlewares        []DXAPIEndPointExecuteFunc
+	AdminPrivileges         []string
+	// IsAdminRuntimeMutationAllowed lets the admin endpoints change the log levels and the debug logs, they are read-only otherwise
+	IsAdminRuntimeMutationAllowed bool
+	// IsMockMode answers the requests carrying the X-Mock-Response header with the response example it names, see
+	// DXAPIEndPoint.ResponseExample
+	IsMockMode                  bool
+	OnDeprecatedEndPointRequest DXAPIDeprecatedEndPointRequestHandler
+	DebugDumpRedactedHeaders    []string
+	DebugDumpRedactedParameters []string
+	DebugDumpMaxBodyBytes       int
+	DebugDumpIsIncludeLocalData bool
+	RequestBodyMaxMemoryBytes   int
+	ConnectionHubBacklog        int
+	DefaultLanguage             string
+	RetryBudgetMaxRetries       int
+	RetryBudgetMs               int
+	// DatabasePrimaryStickyMs pins to the primary, for that long, the requests of a user after a request of theirs wrote, see
+	// DXAPIEndPointRequest.PinDatabaseToPrimary
+	DatabasePrimaryStickyMs           int
+	databasePrimaryStickySubjectStore *cache.DXMemoryCacheStore[string, struct{}]
+	databasePrimaryStickyOnce         sync.Once
+	middlewares                       []DXAPIMiddleware
+	accessLogWriter                   *log.DXAsyncWriter
+	activeRequestCount                int64
+	runningServerCount                int64
+	concurrencyLimiter                *semaphore.Weighted
+	concurrencyInFlightCount          int64
+	concurrencyQueuedCount            int64
+	shutdownOnce                      sync.Once
+	shutdownErr                       error
+	connectionHub                     *DXAPIConnectionHub
+	connectionHubOnce                 sync.Once
+	errorMessages                     dxAPIErrorMessages
 }
 
 var SpecFormat = "MarkDown"
@@ -70,7 +136,8 @@ func (a *DXAPI) APIHandlerPrintSpec(aepr *DXAPIEndPointRequest) (err error) {
 }
 
 func (a *DXAPI) PrintSpec() (s string, err error) {
-	s = "# API: " + a.NameId + "\n\n\n"
+	s = "# API: " + a.NameId + "\n\n"
+	s += "Path Normalization: " + a.PathNormalizationPolicy.String() + "\n\n\n"
 	for _, v := range a.EndPoints {
 		spec, err := v.PrintSpec()
 		if err != nil {
@@ -82,21 +149,33 @@ func (a *DXAPI) PrintSpec() (s string, err error) {
 }
 
 type DXAPIManager struct {
-	Context           context.Context
-	Cancel            context.CancelFunc
-	APIs              map[string]*DXAPI
-	ErrorGroup        *errgroup.Group
-	ErrorGroupContext context.Context
+	Context                 context.Context
+	Cancel                  context.CancelFunc
+	APIs                    map[string]*DXAPI
+	ErrorGroup              *errgroup.Group
+	ErrorGroupContext       context.Context
+	ErrorGroupContextCancel context.CancelFunc
 }
 
 func (am *DXAPIManager) NewAPI(nameId string) (*DXAPI, error) {
 	ctx, cancel := context.WithCancel(am.Context)
 	a := DXAPI{
-		NameId:    nameId,
-		EndPoints: []DXAPIEndPoint{},
-		Context:   ctx,
-		Cancel:    cancel,
-		Log:       log.NewLog(&log.Log, ctx, nameId),
+		NameId:             nameId,
+		EndPoints:          []*DXAPIEndPoint{},
+		ShutdownTimeoutSec: DXAPIDefaultShutdownTimeoutSec,
+		QueueTimeoutMs:     DXAPIDefaultQueueTimeoutMs,
+
+		DebugDumpRedactedHeaders:    DXAPIDefaultDebugDumpRedactedHeaders,
+		DebugDumpRedactedParameters: DXAPIDefaultDebugDumpRedactedParameters,
+		DebugDumpMaxBodyBytes:       DXAPIDefaultDebugDumpMaxBodyBytes,
+		RequestBodyMaxMemoryBytes:   DXAPIDefaultRequestBodyMaxMemoryBytes,
+		DefaultLanguage:             DXAPIDefaultLanguage,
+		Context:                     ctx,
+		Cancel:                      cancel,
+		Log:                         log.NewLog(&log.Log, ctx, nameId),
+
+		NotFoundHandler:         DefaultNotFoundHandler,
+		MethodNotAllowedHandler: DefaultMethodNotAllowedHandler,
 	}
 	am.APIs[nameId] = &a
 	return &a, nil
@@ -126,7 +205,7 @@ func (am *DXAPIManager) LoadFromConfiguration(configurationNameId string) (err e
 }
 func (am *DXAPIManager) StartAll(errorGroup *errgroup.Group, errorGroupContext context.Context) error {
 	am.ErrorGroup = errorGroup
-	am.ErrorGroupContext = errorGroupContext
+	am.ErrorGroupContext, am.ErrorGroupContextCancel = context.WithCancel(errorGroupContext)
 
 	am.ErrorGroup.Go(func() (err error) {
 		<-am.ErrorGroupContext.Done()
@@ -150,9 +229,31 @@ func (am *DXAPIManager) StartAll(errorGroup *errgroup.Group, errorGroupContext c
 	return nil
 }
 
+func (am *DXAPIManager) ActiveRequests() (count int) {
+	for _, v := range am.APIs {
+		count += v.ActiveRequests()
+	}
+	return count
+}
+
+// StopAll cancels the manager shutdown watcher, drains every API (each bounded by its ShutdownTimeoutSec) and then waits for the
+// error group to finish.
 func (am *DXAPIManager) StopAll() (err error) {
-	am.ErrorGroupContext.Done()
+	if am.ErrorGroup == nil {
+		return nil
+	}
+	am.ErrorGroupContextCancel()
+	var drainErrs []error
+	for _, v := range am.APIs {
+		vErr := v.StartShutdown()
+		if vErr != nil {
+			drainErrs = append(drainErrs, fmt.Errorf("API %s failed to drain: %w", v.NameId, vErr))
+		}
+	}
 	err = am.ErrorGroup.Wait()
+	if len(drainErrs) > 0 {
+		return errors.Join(append(drainErrs, err)...)
+	}
 	return err
 }
 
@@ -169,20 +270,108 @@ func (a *DXAPI) ApplyConfigurations(configurationNameId string) (err error) {
 		return err
 	}
 
-	a.Address, ok = c1[`address`].(string)
+	ok = a.setAddressesFromConfiguration(c1[`address`])
 	if !ok {
 		err := log.Log.FatalAndCreateErrorf("CONFIGURATION_NOT_FOUND:%s.%s/address", configurationNameId, a.NameId)
 		return err
 	}
-	a.WriteTimeoutSec = utilsJSON.GetNumberWithDefault(c1, `writetimeout-sec`, DXAPIDefaultWriteTimeoutSec)
-	a.ReadTimeoutSec = utilsJSON.GetNumberWithDefault(c1, `readtimeout-sec`, DXAPIDefaultReadTimeoutSec)
+	err = a.setUnixSocketFileModeFromConfiguration(c1[`unix-socket-file-mode`])
+	if err != nil {
+		return log.Log.FatalAndCreateErrorf("CONFIGURATION_INVALID:%s.%s/unix-socket-file-mode:%v", configurationNameId, a.NameId, err.Error())
+	}
+	// A number present with the wrong type is reported instead of silently running with the default
+	var errNumber error
+	getInt := func(k string, defaultValue int) int {
+		v, err := utilsJSON.GetNumberOrDefault(c1, k, defaultValue)
+		if err != nil && errNumber == nil {
+			errNumber = err
+		}
+		return v
+	}
+	a.WriteTimeoutSec = getInt(`writetimeout-sec`, DXAPIDefaultWriteTimeoutSec)
+	a.ReadTimeoutSec = getInt(`readtimeout-sec`, DXAPIDefaultReadTimeoutSec)
+	a.ShutdownTimeoutSec = getInt(`shutdowntimeout-sec`, DXAPIDefaultShutdownTimeoutSec)
+	a.MaxConcurrentRequests = getInt(`max_concurrent_requests`, 0)
+	a.MaxQueuedRequests = getInt(`max_queued_requests`, 0)
+	a.QueueTimeoutMs = getInt(`queue_timeout_ms`, DXAPIDefaultQueueTimeoutMs)
+	a.RequestBodyMaxMemoryBytes = getInt(`request-body-max-memory-bytes`, DXAPIDefaultRequestBodyMaxMemoryBytes)
+	a.ConnectionHubBacklog = getInt(`connection-hub-backlog`, DXAPIConnectionHubDefaultBacklog)
+	a.RetryBudgetMaxRetries = getInt(`retry_budget_max_retries`, DXAPIDefaultRetryBudgetMaxRetries)
+	a.RetryBudgetMs = getInt(`retry_budget_ms`, DXAPIDefaultRetryBudgetMs)
+	a.DatabasePrimaryStickyMs = getInt(`database_primary_sticky_ms`, 0)
+	if errNumber != nil {
+		return log.Log.FatalAndCreateErrorf("CONFIGURATION_INVALID:%s.%s:%v", configurationNameId, a.NameId, errNumber.Error())
+	}
+	accessLogFile, ok := c1[`access-log-file`].(string)
+	if ok && accessLogFile != "" {
+		maxSizeMB := int64(getInt(`access-log-max-size-mb`, log.DXRotatingFileWriterDefaultMaxSizeBytes/(1024*1024)))
+		maxBackups := getInt(`access-log-max-backups`, log.DXRotatingFileWriterDefaultMaxBackups)
+		rotateIntervalHours := getInt(`access-log-rotate-interval-hours`, 0)
+		maxAgeDays := getInt(`access-log-max-age-days`, 0)
+		if errNumber != nil {
+			return log.Log.FatalAndCreateErrorf("CONFIGURATION_INVALID:%s.%s:%v", configurationNameId, a.NameId, errNumber.Error())
+		}
+		isCompress, _ := c1[`access-log-compress`].(bool)
+		accessLogWriter, err := log.NewRotatingFileWriterWithOptions(log.DXRotatingFileWriterOptions{
+			Path:           accessLogFile,
+			MaxSizeBytes:   maxSizeMB * 1024 * 1024,
+			MaxBackups:     maxBackups,
+			RotateInterval: time.Duration(rotateIntervalHours) * time.Hour,
+			MaxAge:         time.Duration(maxAgeDays) * 24 * time.Hour,
+			IsCompress:     isCompress,
+		})
+		if err != nil {
+			return log.Log.FatalAndCreateErrorf("CONFIGURATION_INVALID:%s.%s/access-log-file:%v", configurationNameId, a.NameId, err.Error())
+		}
+		a.SetAccessLogWriter(accessLogWriter)
+	}
+	defaultLanguage, ok := c1[`default_language`].(string)
+	if ok && defaultLanguage != "" {
+		a.DefaultLanguage = defaultLanguage
+	}
+	isSunsetEndPointGone, ok := c1[`sunset-endpoint-gone`].(bool)
+	if ok {
+		a.IsSunsetEndPointGone = isSunsetEndPointGone
+	}
+	isVersionEndPointEnabled, ok := c1[`version-endpoint`].(bool)
+	if ok {
+		a.IsVersionEndPointEnabled = isVersionEndPointEnabled
+	}
+	isAdminEndPointsEnabled, ok := c1[`enable_admin_endpoints`].(bool)
+	if ok {
+		a.IsAdminEndPointsEnabled = isAdminEndPointsEnabled
+	}
+	adminUriPrefix, ok := c1[`admin_uri_prefix`].(string)
+	if ok && adminUriPrefix != "" {
+		a.AdminUriPrefix = adminUriPrefix
+	}
+	isAdminRuntimeMutationAllowed, ok := c1[`allow_runtime_mutations`].(bool)
+	if ok {
+		a.IsAdminRuntimeMutationAllowed = isAdminRuntimeMutationAllowed
+	}
+	isMockMode, ok := c1[`mock_mode`].(bool)
+	if ok {
+		a.IsMockMode = isMockMode
+	}
+	pathNormalization, ok := c1[`path-normalization`].(string)
+	if ok {
+		a.PathNormalizationPolicy = StringToDXAPIPathNormalizationPolicy(pathNormalization)
+	}
+	endPoints, ok := c1[`endpoints`].([]any)
+	if ok {
+		err = a.declareEndPointsFromConfiguration(endPoints)
+		if err != nil {
+			return log.Log.FatalAndCreateErrorf("CONFIGURATION_INVALID:%s.%s/%v", configurationNameId, a.NameId, err.Error())
+		}
+	}
 	return err
 }
 
+// FindEndPointByURI returns the registered endpoint itself, so changes made through it are seen by the running server
 func (a *DXAPI) FindEndPointByURI(uri string) *DXAPIEndPoint {
 	for _, endPoint := range a.EndPoints {
 		if endPoint.Uri == uri {
-			return &endPoint
+			return endPoint
 		}
 	}
 	return nil
@@ -196,9 +385,13 @@ func GetIPAddress(r *http.Request) string {
 	if ip == "" {
 		ip = r.RemoteAddr
 	}
+	if ip == "" || ip == "@" {
+		// Unix socket peers have no address
+		return dxAPIUnixSocketPeerAddressLabel
+	}
 	// Remove port if present
-	if strings.Contains(ip, ":") {
-		ip, _, _ = net.SplitHostPort(ip)
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
 	}
 	return ip
 }
@@ -209,10 +402,16 @@ func (a *DXAPI) NewEndPoint(title, description, uri, method string, endPointType
 	privileges []string) *DXAPIEndPoint {
 
 	t := a.FindEndPointByURI(uri)
+	if t != nil && t.isDeclared {
+		log.Log.Fatalf("Duplicate endpoint uri %s, declared in the configuration of api %s", uri, a.NameId)
+		return t
+	}
 	if t != nil {
 		log.Log.Fatalf("Duplicate endpoint uri %s", uri)
+		// Only reached when Fatal does not exit, the first registration is kept
+		return t
 	}
-	ae := DXAPIEndPoint{
+	ae := &DXAPIEndPoint{
 		Owner:                 a,
 		Title:                 title,
 		Description:           description,
@@ -228,24 +427,136 @@ func (a *DXAPI) NewEndPoint(title, description, uri, method string, endPointType
 		Privileges:            privileges,
 	}
 	a.EndPoints = append(a.EndPoints, ae)
-	return &ae
+	return ae
+}
+
+func (a *DXAPI) ActiveRequests() int {
+	return int(atomic.LoadInt64(&a.activeRequestCount))
 }
 
 func (a *DXAPI) routeHandler(w http.ResponseWriter, r *http.Request, p *DXAPIEndPoint) {
-	requestContext, span := otel.Tracer(a.Log.Prefix).Start(a.Context, "routeHandler|"+p.Uri)
+	atomic.AddInt64(&a.activeRequestCount, 1)
+	defer atomic.AddInt64(&a.activeRequestCount, -1)
+
+	for _, header := range p.RemovedSecurityHeaders {
+		w.Header().Del(header)
+	}
+
+	// Continue the upstream trace (W3C traceparent/baggage) when present, the request context is the fallback parent
+	parentContext := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	parentContext, parentContextCancel := context.WithCancel(parentContext)
+	defer parentContextCancel()
+	// Cancelling the API context (forced shutdown) must still cancel the running handlers
+	stopAfterAPIContextDone := context.AfterFunc(a.Context, parentContextCancel)
+	defer stopAfterAPIContextDone()
+
+	requestContext, span := otel.Tracer(a.Log.Prefix).Start(parentContext, "routeHandler|"+p.Uri,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+			attribute.String("http.route", p.Uri),
+			attribute.String("service.version", core.GetBuildInfo().Version),
+			attribute.String("network.local.address", ListenerAddressFromContext(r.Context())),
+		))
 	defer span.End()
+	requestContext = retry.WithBudget(requestContext, a.newRetryBudget(p))
 
 	var aepr *DXAPIEndPointRequest
 	var err error
 
 	defer func() {
+		rec := recover()
+		if rec != nil {
+			if aepr != nil {
+				err = aepr.Log.CapturePanic(rec, "PANIC_IN_ROUTE_HANDLER")
+			} else {
+				err = log.CapturePanic(rec, "PANIC_IN_ROUTE_HANDLER")
+			}
+			span.RecordError(err)
+			panicHandler := panicHandlerFromContext(r.Context())
+			if panicHandler != nil {
+				panicHandler(rec, debug.Stack())
+			}
+			if aepr != nil {
+				if !aepr.ResponseHeaderSent {
+					aepr.WriteResponseAsError(http.StatusInternalServerError, err)
+				}
+			}
+		}
+		if aepr != nil {
+			span.SetAttributes(attribute.Int("http.response.status_code", aepr.ResponseStatusCode))
+		}
 		if err != nil {
-			//		_ = aepr.WriteResponseAndNewErrorf(http.StatusInternalServerError, "ERROR_AT_AEPR:%s (%s)", aepr.Id, err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		if aepr != nil {
+			aepr.finishRequestTx(err, rec)
+			a.rememberDatabasePrimarySticky(aepr)
+			aepr.releaseRequestBody()
+			aepr.releaseLocalData()
 		}
 	}()
 
-	auditLogId := int64(0)
 	auditLogStartTime := time.Now()
+	defer func() {
+		if aepr == nil {
+			return
+		}
+		traceId := span.SpanContext().TraceID().String()
+		listenerAddress := ListenerAddressFromContext(r.Context())
+		isLogRequestBody := (err != nil) && (dxlib.IsDebug) && (p.RequestContentType == utilsHttp.ContentTypeApplicationJSON)
+		if log.IsFormatJSON() {
+			fields := log.DXLogFields{
+				"status":      aepr.ResponseStatusCode,
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"trace_id":    traceId,
+				"listener":    listenerAddress,
+				"request_id":  aepr.Id,
+				"duration_ms": float64(time.Since(auditLogStartTime).Microseconds()) / 1000,
+			}
+			if isLogRequestBody && aepr.RequestBodyAsBytes != nil {
+				fields["request_body"] = string(aepr.RequestBodyAsBytes)
+			}
+			aepr.Log.LogTextWithFields(log.DXLogLevelInfo, ``, fmt.Sprintf("%d %s", aepr.ResponseStatusCode, r.URL.Path), fields)
+		} else if isLogRequestBody {
+			if aepr.RequestBodyAsBytes != nil {
+				aepr.Log.Infof("%d %s trace_id=%s listener=%s Request: %s", aepr.ResponseStatusCode, r.URL.Path, traceId, listenerAddress, string(aepr.RequestBodyAsBytes))
+			}
+		} else {
+			aepr.Log.Infof("%d %s trace_id=%s listener=%s", aepr.ResponseStatusCode, r.URL.Path, traceId, listenerAddress)
+		}
+		a.writeAccessLog(&DXAPIAccessLogRecord{
+			Time:          auditLogStartTime,
+			API:           a.NameId,
+			Listener:      listenerAddress,
+			RequestId:     aepr.Id,
+			TraceId:       traceId,
+			RemoteAddress: GetIPAddress(r),
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			Route:         p.Uri,
+			StatusCode:    aepr.ResponseStatusCode,
+			DurationMs:    float64(time.Since(auditLogStartTime).Microseconds()) / 1000,
+		})
+	}()
+
+	// The slot is taken before anything of the request is built, a request waiting in the queue or rejected costs nothing more
+	if !p.IsBypassConcurrencyLimiter {
+		isAcquired, errAcquire := a.acquireConcurrencySlot(requestContext)
+		if errAcquire != nil {
+			aepr = p.NewEndPointRequest(requestContext, w, r)
+			aepr.GetResponseHeader().Set("Retry-After", a.retryAfterSec())
+			err = aepr.WriteResponseAndNewErrorf(http.StatusServiceUnavailable, "TOO_MANY_CONCURRENT_REQUESTS:%v", errAcquire.Error())
+			return
+		}
+		if isAcquired {
+			defer a.releaseConcurrencySlot()
+		}
+	}
+
+	auditLogId := int64(0)
 
 	if a.OnAuditLogStart != nil {
 		auditLogId, err = a.OnAuditLogStart(auditLogId, &DXAPIAuditLogEntry{
@@ -259,24 +570,31 @@ func (a *DXAPI) routeHandler(w http.ResponseWriter, r *http.Request, p *DXAPIEnd
 
 	defer func() {
 		if a.OnAuditLogEnd != nil {
-			_, err = a.OnAuditLogEnd(auditLogId, &DXAPIAuditLogEntry{
+			_, auditLogErr := a.OnAuditLogEnd(auditLogId, &DXAPIAuditLogEntry{
 				StartTime:  auditLogStartTime,
 				EndTime:    time.Now(),
 				StatusCode: aepr.ResponseStatusCode,
 			})
+			if auditLogErr != nil {
+				aepr.Log.Errorf("AUDIT_LOG_END_ERROR:%v", auditLogErr.Error())
+			}
 		}
 	}()
 
 	aepr = p.NewEndPointRequest(requestContext, w, r)
-	defer func() {
-		if (err != nil) && (dxlib.IsDebug) && (p.RequestContentType == utilsHttp.ContentTypeApplicationJSON) {
-			if aepr.RequestBodyAsBytes != nil {
-				aepr.Log.Infof("%d %s Request: %s", aepr.ResponseStatusCode, r.URL.Path, string(aepr.RequestBodyAsBytes))
-			}
-		} else {
-			aepr.Log.Infof("%d %s", aepr.ResponseStatusCode, r.URL.Path)
+
+	if a.applyDeprecation(w, p) {
+		err = aepr.WriteResponseAndNewErrorf(http.StatusGone, "ENDPOINT_SUNSET:%s:%s", p.Uri, p.SunsetDate.UTC().Format(time.RFC3339))
+		return
+	}
+
+	if p.isFallback {
+		err = p.OnExecute(aepr)
+		if !aepr.ResponseHeaderSent {
+			err = aepr.WriteResponseAsFallbackError(http.StatusNotFound, "NOT_FOUND:%s", r.URL.Path)
 		}
-	}()
+		return
+	}
 
 	err = aepr.PreProcessRequest()
 	if err != nil {
@@ -290,6 +608,10 @@ func (a *DXAPI) routeHandler(w http.ResponseWriter, r *http.Request, p *DXAPIEnd
 		return
 	}
 
+	if aepr.isDebugDump() {
+		aepr.debugDumpRequest()
+	}
+
 	for _, middleware := range p.Middlewares {
 		err = middleware(aepr)
 		if err != nil {
@@ -302,9 +624,14 @@ func (a *DXAPI) routeHandler(w http.ResponseWriter, r *http.Request, p *DXAPIEnd
 			aepr.Log.Errorf("ONMIDDLEWARE_ERROR:%v\nRaw Request :\n%v\n", err, string(requestDump))
 			return
 		}
-
+		// A middleware that answered the request, like a cache hit, ends it
+		if aepr.ResponseHeaderSent {
+			return
+		}
 	}
 
+	a.pinDatabaseToPrimaryIfSticky(aepr)
+
 	if aepr.CurrentUser.Id != "" {
 		if a.OnAuditLogUserIdentified != nil {
 			_, err = a.OnAuditLogUserIdentified(auditLogId, &DXAPIAuditLogEntry{
@@ -322,8 +649,21 @@ func (a *DXAPI) routeHandler(w http.ResponseWriter, r *http.Request, p *DXAPIEnd
 
 	}
 
+	if a.IsMockMode {
+		var isServed bool
+		isServed, err = aepr.serveMockResponse()
+		if isServed {
+			return
+		}
+	}
+
 	if p.OnExecute != nil {
 		err = p.OnExecute(aepr)
+		if errors.Is(err, ErrClientGone) {
+			// Nobody is left to read a response, this is not a server error
+			aepr.Log.Debugf("CLIENT_GONE:%s", r.URL.Path)
+			return
+		}
 		if err != nil {
 			requestDump, err2 := aepr.RequestDump()
 			if err2 != nil {
@@ -333,6 +673,23 @@ func (a *DXAPI) routeHandler(w http.ResponseWriter, r *http.Request, p *DXAPIEnd
 			aepr.Log.Errorf("ONEXECUTE_ERROR:%v\nRaw Request :\n%v\n", err, string(requestDump))
 
 			if !aepr.ResponseHeaderSent {
+				var parameterError *DXAPIParameterError
+				if errors.As(err, &parameterError) {
+					aepr.WriteResponseAsParameterError(parameterError)
+					return
+				}
+				var poolExhaustedError *db.PoolExhaustedError
+				if errors.As(err, &poolExhaustedError) {
+					// Overloaded, the client may retry instead of waiting on a connection
+					aepr.GetResponseHeader().Set("Retry-After", poolExhaustedError.RetryAfterSec())
+					err = aepr.WriteResponseAndNewErrorf(http.StatusServiceUnavailable, "DATABASE_POOL_EXHAUSTED:%v", err.Error())
+					return
+				}
+				statusCode, reason, isMapped := databaseErrorStatus(err)
+				if isMapped {
+					err = aepr.WriteResponseAndNewErrorf(statusCode, "%s", reason)
+					return
+				}
 				err = aepr.WriteResponseAndNewErrorf(http.StatusBadRequest, "ONEXECUTE_ERROR:%v", err.Error())
 				return
 			}
@@ -350,13 +707,20 @@ func (a *DXAPI) StartAndWait(errorGroup *errgroup.Group) error {
 		return errors.New("SERVER_ALREADY_ACTIVE")
 	}
 
+	a.initConcurrencyLimiter()
+	a.registerVersionEndPoint()
+	err := a.registerAdminEndPoints()
+	if err != nil {
+		return err
+	}
 	mux := http.NewServeMux()
-	a.HTTPServer = &http.Server{
-		Addr:         a.Address,
-		Handler:      mux,
-		WriteTimeout: time.Duration(a.WriteTimeoutSec) * time.Second,
-		ReadTimeout:  time.Duration(a.ReadTimeoutSec) * time.Second,
+	handler := a.applyMiddlewares(a.pathNormalizationMiddleware(mux))
+	// One server per listen address, all sharing the same mux
+	a.HTTPServers = nil
+	for _, address := range a.GetListenAddresses() {
+		a.HTTPServers = append(a.HTTPServers, a.newHTTPServer(address, handler))
 	}
+	a.HTTPServer = a.HTTPServers[0]
 
 	// CORS middleware
 	corsMiddleware := func(next http.Handler) http.Handler {
@@ -376,35 +740,140 @@ func (a *DXAPI) StartAndWait(errorGroup *errgroup.Group) error {
 	}
 
 	// Set up routes
+	isRootRouteDefined := false
 	for _, endpoint := range a.EndPoints {
 		p := endpoint
+		if p.Uri == "/" {
+			isRootRouteDefined = true
+		}
 		mux.Handle(p.Uri, corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			a.routeHandler(w, r, &p)
+			a.routeHandler(w, r, p)
 		})))
 	}
 
-	errorGroup.Go(func() error {
-		a.RuntimeIsActive = true
-		log.Log.Infof("Listening at %s... start", a.Address)
-		err := a.HTTPServer.ListenAndServe()
-		if (err != nil) && (!errors.Is(err, http.ErrServerClosed)) {
-			log.Log.Errorf("HTTP server error: %v", err.Error())
+	// Catch-all route, so unknown paths get the standard error envelope instead of the net/http plain text 404
+	if !isRootRouteDefined {
+		notFoundHandler := a.NotFoundHandler
+		if notFoundHandler == nil {
+			notFoundHandler = DefaultNotFoundHandler
 		}
-		a.RuntimeIsActive = false
-		log.Log.Infof("Listening at %s... stopped", a.Address)
-		return err
-	})
+		notFoundEndPoint := a.newFallbackEndPoint(DXAPIFallbackEndPointTitleNotFound, notFoundHandler)
+		mux.Handle("/", corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			a.routeHandler(w, r, notFoundEndPoint)
+		})))
+	}
+
+	// Marked active before the goroutine runs, so a StopAll right after StartAll still shuts this server down
+	// Unix sockets are opened here, so a busy or invalid socket path is reported by StartAndWait itself
+	listeners := make([]net.Listener, len(a.HTTPServers))
+	for i, server := range a.HTTPServers {
+		if !isUnixSocketAddress(server.Addr) {
+			continue
+		}
+		listener, err := a.listenUnixSocket(server.Addr)
+		if err != nil {
+			for _, l := range listeners {
+				if l != nil {
+					_ = l.Close()
+				}
+			}
+			return err
+		}
+		listeners[i] = listener
+	}
+
+	a.RuntimeIsActive = true
+	atomic.StoreInt64(&a.runningServerCount, int64(len(a.HTTPServers)))
+	for i, httpServer := range a.HTTPServers {
+		server := httpServer
+		listener := listeners[i]
+		errorGroup.Go(func() error {
+			log.Log.Infof("Listening at %s... start", server.Addr)
+			var err error
+			if listener != nil {
+				err = server.Serve(listener)
+				removeUnixSocketFile(server.Addr)
+			} else {
+				err = server.ListenAndServe()
+			}
+			if errors.Is(err, http.ErrServerClosed) {
+				// A requested shutdown is not an error, returning it would make the error group report a failure
+				err = nil
+			}
+			if err != nil {
+				log.Log.Errorf("HTTP server %s error: %v", server.Addr, err.Error())
+			}
+			if atomic.AddInt64(&a.runningServerCount, -1) == 0 {
+				a.RuntimeIsActive = false
+			}
+			log.Log.Infof("Listening at %s... stopped", server.Addr)
+			return err
+		})
+	}
 
 	return nil
 }
 
+// StartShutdown stops accepting new connections and waits up to ShutdownTimeoutSec for the in-flight requests to finish.
+// After the deadline, the remaining handler contexts are cancelled and the server is closed. It is safe to call more than once.
 func (a *DXAPI) StartShutdown() (err error) {
-	if a.RuntimeIsActive {
-		log.Log.Infof("Shutdown api %s start...", a.NameId)
-		err = a.HTTPServer.Shutdown(core.RootContext)
-		return err
+	if !a.RuntimeIsActive {
+		return nil
+	}
+	a.shutdownOnce.Do(func() {
+		a.shutdownErr = a.drainAndShutdown()
+		// After the drain, so the records of the last requests are written too
+		errClose := a.closeAccessLogWriter()
+		if errClose != nil {
+			a.shutdownErr = errors.Join(a.shutdownErr, errClose)
+		}
+	})
+	return a.shutdownErr
+}
+
+func (a *DXAPI) drainAndShutdown() (err error) {
+	log.Log.Infof("Shutdown api %s start...", a.NameId)
+	for _, server := range a.HTTPServers {
+		server.SetKeepAlivesEnabled(false)
+	}
+	// The event streams never end by themselves, the drain would wait for them until the timeout
+	a.ConnectionHub().Close()
+
+	timeout := time.Duration(a.ShutdownTimeoutSec) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	shutdownResult := make(chan error, 1)
+	go func() {
+		var shutdownGroup errgroup.Group
+		for _, httpServer := range a.HTTPServers {
+			server := httpServer
+			shutdownGroup.Go(func() error {
+				return server.Shutdown(ctx)
+			})
+		}
+		shutdownResult <- shutdownGroup.Wait()
+	}()
+
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case err = <-shutdownResult:
+			if err != nil {
+				remaining := a.ActiveRequests()
+				a.Cancel()
+				for _, server := range a.HTTPServers {
+					_ = server.Close()
+				}
+				return log.Log.ErrorAndCreateErrorf("API_DRAIN_TIMEOUT:%s:%d_REQUEST(S)_STILL_ACTIVE_AFTER_%v (%v)", a.NameId, remaining, timeout, err.Error())
+			}
+			log.Log.Infof("Shutdown api %s... done", a.NameId)
+			return nil
+		case <-ticker.C:
+			log.Log.Infof("Shutdown api %s... waiting %d active request(s)", a.NameId, a.ActiveRequests())
+		}
 	}
-	return nil
 }
 
 var Manager DXAPIManager
@@ -416,4 +885,7 @@ func init() {
 		Cancel:  cancel,
 		APIs:    map[string]*DXAPI{},
 	}
+	core.RegisterShutdownHook("api", core.ShutdownPriorityAPI, func(ctx context.Context) error {
+		return Manager.StopAll()
+	})
 }
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/log"
+)
+
+const DXAPIDefaultAccessLogBufferSize = log.DXAsyncWriterDefaultBufferSize
+
+// DXAPIAccessLogRecord is written as one JSON line per request to the writer set with SetAccessLogWriter
+type DXAPIAccessLogRecord struct {
+	Time          time.Time `json:"time"`
+	API           string    `json:"api"`
+	Listener      string    `json:"listener,omitempty"`
+	RequestId     string    `json:"request_id,omitempty"`
+	TraceId       string    `json:"trace_id,omitempty"`
+	RemoteAddress string    `json:"remote_address,omitempty"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	Route         string    `json:"route,omitempty"`
+	StatusCode    int       `json:"status_code"`
+	DurationMs    float64   `json:"duration_ms"`
+}
+
+// SetAccessLogWriter sends the access log records to w, through a bounded buffer so a slow w never blocks the requests.
+// The writer is flushed, and closed when it is an io.Closer, by StartShutdown.
+func (a *DXAPI) SetAccessLogWriter(w io.Writer) {
+	if a.accessLogWriter != nil {
+		_ = a.accessLogWriter.Close()
+	}
+	if w == nil {
+		a.accessLogWriter = nil
+		return
+	}
+	a.accessLogWriter = log.NewAsyncWriter(w, DXAPIDefaultAccessLogBufferSize)
+}
+
+// AccessLogDroppedRecords returns how many access log records were dropped because the buffer was full
+func (a *DXAPI) AccessLogDroppedRecords() int64 {
+	if a.accessLogWriter == nil {
+		return 0
+	}
+	return a.accessLogWriter.DroppedCount()
+}
+
+func (a *DXAPI) writeAccessLog(record *DXAPIAccessLogRecord) {
+	if a.accessLogWriter == nil {
+		return
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	_, _ = a.accessLogWriter.Write(append(b, '\n'))
+}
+
+func (a *DXAPI) closeAccessLogWriter() (err error) {
+	if a.accessLogWriter == nil {
+		return nil
+	}
+	dropped := a.accessLogWriter.DroppedCount()
+	if dropped > 0 {
+		log.Log.Warnf("API %s dropped %d access log record(s)", a.NameId, dropped)
+	}
+	err = a.accessLogWriter.Close()
+	if err != nil {
+		return fmt.Errorf("ACCESS_LOG_WRITER_CLOSE_FAILED:%w", err)
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+
+	"github.com/donnyhardyanto/dxlib/core"
+	"github.com/donnyhardyanto/dxlib/database"
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+	"github.com/donnyhardyanto/dxlib/utils/cache"
+	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
+)
+
+const DXAPIDefaultAdminUriPrefix = "/admin"
+
+// ErrAdminEndPointsWithoutMiddleware is returned by RegisterAdminEndPoints without a middleware, the admin endpoints are
+// never served unauthenticated
+var ErrAdminEndPointsWithoutMiddleware = errors.New("ADMIN_ENDPOINTS_WITHOUT_AUTH_MIDDLEWARE")
+
+func adminEndPointResponsePossibilities(successDescription string) map[string]*DXAPIEndPointResponsePossibility {
+	return map[string]*DXAPIEndPointResponsePossibility{
+		"success":              {StatusCode: http.StatusOK, Description: successDescription},
+		"forbidden":            {StatusCode: http.StatusForbidden, Description: "The runtime mutations are not allowed, see IsAdminRuntimeMutationAllowed"},
+		"unprocessable_entity": {StatusCode: http.StatusUnprocessableEntity, Description: "Invalid parameter"},
+	}
+}
+
+// RegisterAdminEndPoints registers on host the endpoints introspecting a: GET <uriPrefix>/endpoints, the endpoints with their
+// methods and middlewares, GET <uriPrefix>/databases, the pools of the databases and the statement caches, GET
+// <uriPrefix>/health, the health checks, POST <uriPrefix>/log-level, POST <uriPrefix>/debug-sql and POST
+// <uriPrefix>/debug-dump switching the logs while running. host is a itself or an API on its own address, middlewares must
+// authenticate the caller. The POST ones answer 403 unless a.IsAdminRuntimeMutationAllowed, every call is logged with the
+// caller.
+func (a *DXAPI) RegisterAdminEndPoints(host *DXAPI, uriPrefix string, middlewares []DXAPIEndPointExecuteFunc, privileges []string) ([]*DXAPIEndPoint, error) {
+	if len(middlewares) == 0 {
+		return nil, ErrAdminEndPointsWithoutMiddleware
+	}
+	isEnabledParameter := DXAPIEndPointParameter{NameId: "is_enabled", Type: "bool", Description: "Enable or disable", IsMustExist: true}
+	endPoints := []*DXAPIEndPoint{
+		host.NewEndPoint("List the endpoints", "The endpoints of the API with their methods, middlewares and privileges",
+			uriPrefix+"/endpoints", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil,
+			a.adminHandler("endpoints", false, a.handleAdminEndPoints), nil,
+			adminEndPointResponsePossibilities("The endpoints"), middlewares, privileges),
+		host.NewEndPoint("List the databases", "The connection pools of the databases and their counters, the hits and misses of the statement caches",
+			uriPrefix+"/databases", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil,
+			a.adminHandler("databases", false, a.handleAdminDatabases), nil,
+			adminEndPointResponsePossibilities("The databases"), middlewares, privileges),
+		host.NewEndPoint("Health", "The status of every health check, run for the request",
+			uriPrefix+"/health", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil,
+			a.adminHandler("health", false, a.handleAdminHealth), nil,
+			adminEndPointResponsePossibilities("The health checks"), middlewares, privileges),
+		host.NewEndPoint("Set the log level", "Sets the global level, or the level of a prefix like the NameId of an API or a database",
+			uriPrefix+"/log-level", http.MethodPost, EndPointTypeHTTPJSON, utilsHttp.ContentTypeApplicationJSON, []DXAPIEndPointParameter{
+				{NameId: "level", Type: "string", Description: "trace, debug, info, warn, error, or empty to clear the level of the prefix", IsMustExist: true},
+				{NameId: "prefix", Type: "string", Description: "Prefix of the logs, the global level when absent"},
+			}, a.adminHandler("log-level", true, a.handleAdminLogLevel), nil,
+			adminEndPointResponsePossibilities("The level is set"), middlewares, privileges),
+		host.NewEndPoint("Switch the SQL debug log", "Switches DebugSQL of a database",
+			uriPrefix+"/debug-sql", http.MethodPost, EndPointTypeHTTPJSON, utilsHttp.ContentTypeApplicationJSON, []DXAPIEndPointParameter{
+				{NameId: "database", Type: "string", Description: "NameId of the database", IsMustExist: true},
+				isEnabledParameter,
+			}, a.adminHandler("debug-sql", true, a.handleAdminDebugSQL), nil,
+			adminEndPointResponsePossibilities("Switched"), middlewares, privileges),
+		host.NewEndPoint("Switch the dump of an endpoint", "Switches the request/response dump of an endpoint",
+			uriPrefix+"/debug-dump", http.MethodPost, EndPointTypeHTTPJSON, utilsHttp.ContentTypeApplicationJSON, []DXAPIEndPointParameter{
+				{NameId: "uri", Type: "string", Description: "Uri of the endpoint", IsMustExist: true},
+				isEnabledParameter,
+			}, a.adminHandler("debug-dump", true, a.handleAdminDebugDump), nil,
+			adminEndPointResponsePossibilities("Switched"), middlewares, privileges),
+	}
+	// The health checks keep answering when the API is saturated
+	endPoints[2].IsBypassConcurrencyLimiter = true
+	return endPoints, nil
+}
+
+func (a *DXAPI) registerAdminEndPoints() error {
+	if !a.IsAdminEndPointsEnabled {
+		return nil
+	}
+	uriPrefix := a.AdminUriPrefix
+	if uriPrefix == "" {
+		uriPrefix = DXAPIDefaultAdminUriPrefix
+	}
+	if a.FindEndPointByURI(uriPrefix+"/endpoints") != nil {
+		return nil
+	}
+	_, err := a.RegisterAdminEndPoints(a, uriPrefix, a.AdminMiddlewares, a.AdminPrivileges)
+	if err != nil {
+		return log.Log.ErrorAndCreateErrorf("API %s: %v", a.NameId, err.Error())
+	}
+	return nil
+}
+
+// adminHandler logs the call of action with the caller, a mutation is refused unless IsAdminRuntimeMutationAllowed
+func (a *DXAPI) adminHandler(action string, isMutation bool, handler DXAPIEndPointExecuteFunc) DXAPIEndPointExecuteFunc {
+	return func(aepr *DXAPIEndPointRequest) (err error) {
+		auditLog := a.Log.WithFields(log.DXLogFields{
+			"admin_action": action,
+			"user_id":      aepr.CurrentUser.Id,
+			"user_loginid": aepr.CurrentUser.LoginId,
+			"ip_address":   GetIPAddress(aepr.Request),
+		})
+		if isMutation && !a.IsAdminRuntimeMutationAllowed {
+			auditLog.Warnf("ADMIN_RUNTIME_MUTATION_REFUSED:%s", action)
+			return aepr.WriteResponseAndNewErrorf(http.StatusForbidden, "ADMIN_RUNTIME_MUTATIONS_NOT_ALLOWED")
+		}
+		err = handler(aepr)
+		if err != nil {
+			auditLog.Warnf("ADMIN_ACTION_FAILED:%s:%v", action, err.Error())
+			return err
+		}
+		auditLog.Infof("ADMIN_ACTION:%s", action)
+		return nil
+	}
+}
+
+func functionNameOf(f any) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return "?"
+	}
+	return fn.Name()
+}
+
+func (a *DXAPI) handleAdminEndPoints(aepr *DXAPIEndPointRequest) (err error) {
+	rows := []utils.JSON{}
+	for _, aep := range a.EndPoints {
+		middlewares := []string{}
+		for _, m := range aep.Middlewares {
+			middlewares = append(middlewares, functionNameOf(m))
+		}
+		rows = append(rows, utils.JSON{
+			"uri":           aep.Uri,
+			"method":        aep.Method,
+			"title":         aep.Title,
+			"middlewares":   middlewares,
+			"privileges":    aep.Privileges,
+			"is_deprecated": aep.Deprecated,
+			"is_debug_dump": aep.IsDebugDump(),
+		})
+	}
+	aepr.ResponseSetNoCache()
+	aepr.WriteResponseAsJSON(http.StatusOK, nil, utils.JSON{
+		"active_requests": a.ActiveRequests(),
+		"endpoints":       rows,
+	})
+	return nil
+}
+
+func (a *DXAPI) handleAdminDatabases(aepr *DXAPIEndPointRequest) (err error) {
+	var nameIds []string
+	for nameId := range database.Manager.Databases {
+		nameIds = append(nameIds, nameId)
+	}
+	sort.Strings(nameIds)
+	rows := []utils.JSON{}
+	for _, nameId := range nameIds {
+		d := database.Manager.Databases[nameId]
+		row := utils.JSON{
+			"name_id":              d.NameId,
+			"database_type":        d.DatabaseType.String(),
+			"is_connected":         d.Connected,
+			"pool_exhausted_count": d.PoolExhaustedCount(),
+			"too_many_rows_count":  d.TooManyRowsCount(),
+			"is_debug_sql":         d.DebugSQL.IsEnabled(),
+		}
+		if d.Connection != nil {
+			stats := d.Connection.Stats()
+			row["pool"] = utils.JSON{
+				"max_open_connections": stats.MaxOpenConnections,
+				"open_connections":     stats.OpenConnections,
+				"in_use":               stats.InUse,
+				"idle":                 stats.Idle,
+				"wait_count":           stats.WaitCount,
+				"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+				"max_idle_closed":      stats.MaxIdleClosed,
+				"max_idle_time_closed": stats.MaxIdleTimeClosed,
+				"max_lifetime_closed":  stats.MaxLifetimeClosed,
+			}
+		}
+		rows = append(rows, row)
+	}
+	// The statement caches are shared by the databases of the process
+	statementCacheStats := db.GetStatementCacheStats()
+	aepr.ResponseSetNoCache()
+	aepr.WriteResponseAsJSON(http.StatusOK, nil, utils.JSON{"databases": rows, "statement_cache": utils.JSON{
+		"is_enabled": db.IsStatementCacheEnabled,
+		"generated":  cacheStatsAsJSON(statementCacheStats.Generated),
+		"parsed":     cacheStatsAsJSON(statementCacheStats.Parsed),
+	}})
+	return nil
+}
+
+func cacheStatsAsJSON(stats cache.DXCacheStats) utils.JSON {
+	return utils.JSON{"hits": stats.Hits, "misses": stats.Misses, "evictions": stats.Evictions, "entries": stats.Entries}
+}
+
+func (a *DXAPI) handleAdminHealth(aepr *DXAPIEndPointRequest) (err error) {
+	snapshot := core.Health.Snapshot(aepr.GetContext())
+	statusCode := http.StatusOK
+	if !snapshot.IsReady {
+		statusCode = http.StatusServiceUnavailable
+	}
+	aepr.ResponseSetNoCache()
+	aepr.WriteResponseAsJSON(statusCode, nil, utils.JSON{"health": snapshot})
+	return nil
+}
+
+func (a *DXAPI) handleAdminLogLevel(aepr *DXAPIEndPointRequest) (err error) {
+	_, levelString, err := aepr.GetParameterValueAsString("level")
+	if err != nil {
+		return err
+	}
+	_, prefix, err := aepr.GetParameterValueAsString("prefix")
+	if err != nil {
+		return err
+	}
+	if levelString == "" {
+		if prefix == "" {
+			return aepr.WriteResponseAndNewErrorf(http.StatusUnprocessableEntity, "LOG_LEVEL_EMPTY")
+		}
+		log.ClearPrefixLevel(prefix)
+		aepr.WriteResponseAsJSON(http.StatusOK, nil, utils.JSON{"prefix": prefix, "level": log.DXLogLevelAsString[log.GetEffectiveLevel(prefix)]})
+		return nil
+	}
+	level, err := log.ParseLevel(levelString)
+	if err != nil {
+		return aepr.WriteResponseAndNewErrorf(http.StatusUnprocessableEntity, "%s", err.Error())
+	}
+	if prefix == "" {
+		log.SetLevel(level)
+	} else {
+		log.SetPrefixLevel(prefix, level)
+	}
+	aepr.WriteResponseAsJSON(http.StatusOK, nil, utils.JSON{"prefix": prefix, "level": log.DXLogLevelAsString[level]})
+	return nil
+}
+
+func (a *DXAPI) handleAdminDebugSQL(aepr *DXAPIEndPointRequest) (err error) {
+	_, nameId, err := aepr.GetParameterValueAsString("database")
+	if err != nil {
+		return err
+	}
+	_, isEnabled, err := aepr.GetParameterValueAsBool("is_enabled")
+	if err != nil {
+		return err
+	}
+	d, ok := database.Manager.Databases[nameId]
+	if !ok {
+		return aepr.WriteResponseAndNewErrorf(http.StatusUnprocessableEntity, "DATABASE_NOT_FOUND:%s", nameId)
+	}
+	d.DebugSQL.SetEnabled(isEnabled)
+	aepr.WriteResponseAsJSON(http.StatusOK, nil, utils.JSON{"database": nameId, "is_enabled": isEnabled})
+	return nil
+}
+
+func (a *DXAPI) handleAdminDebugDump(aepr *DXAPIEndPointRequest) (err error) {
+	_, uri, err := aepr.GetParameterValueAsString("uri")
+	if err != nil {
+		return err
+	}
+	_, isEnabled, err := aepr.GetParameterValueAsBool("is_enabled")
+	if err != nil {
+		return err
+	}
+	aep := a.FindEndPointByURI(uri)
+	if aep == nil {
+		return aepr.WriteResponseAndNewErrorf(http.StatusUnprocessableEntity, "ENDPOINT_NOT_FOUND:%s", uri)
+	}
+	aep.SetDebugDump(isEnabled)
+	aepr.WriteResponseAsJSON(http.StatusOK, nil, utils.JSON{"uri": uri, "is_enabled": isEnabled})
+	return nil
+}
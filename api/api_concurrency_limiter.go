@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+const DXAPIDefaultQueueTimeoutMs = 1000
+
+var ErrConcurrencyQueueFull = errors.New("CONCURRENCY_QUEUE_FULL")
+
+type DXAPIConcurrencyUtilization struct {
+	MaxConcurrentRequests int
+	InFlight              int
+	Queued                int
+}
+
+type DXAPIConcurrencyUtilizationHandler func(a *DXAPI, utilization DXAPIConcurrencyUtilization)
+
+func (a *DXAPI) initConcurrencyLimiter() {
+	a.concurrencyLimiter = nil
+	if a.MaxConcurrentRequests > 0 {
+		a.concurrencyLimiter = semaphore.NewWeighted(int64(a.MaxConcurrentRequests))
+	}
+}
+
+func (a *DXAPI) ConcurrencyUtilization() DXAPIConcurrencyUtilization {
+	return DXAPIConcurrencyUtilization{
+		MaxConcurrentRequests: a.MaxConcurrentRequests,
+		InFlight:              int(atomic.LoadInt64(&a.concurrencyInFlightCount)),
+		Queued:                int(atomic.LoadInt64(&a.concurrencyQueuedCount)),
+	}
+}
+
+func (a *DXAPI) reportConcurrencyUtilization() {
+	if a.OnConcurrencyUtilization != nil {
+		a.OnConcurrencyUtilization(a, a.ConcurrencyUtilization())
+	}
+}
+
+func (a *DXAPI) effectiveMaxQueuedRequests() int64 {
+	if a.MaxQueuedRequests > 0 {
+		return int64(a.MaxQueuedRequests)
+	}
+	return int64(a.MaxConcurrentRequests)
+}
+
+// retryAfterSec is the value of the Retry-After header sent on a rejected request, the queue timeout rounded up to a second
+func (a *DXAPI) retryAfterSec() string {
+	sec := (a.QueueTimeoutMs + 999) / 1000
+	if sec < 1 {
+		sec = 1
+	}
+	return strconv.Itoa(sec)
+}
+
+// acquireConcurrencySlot waits in the bounded queue for up to QueueTimeoutMs. When it returns isAcquired, the caller must call
+// releaseConcurrencySlot.
+func (a *DXAPI) acquireConcurrencySlot(ctx context.Context) (isAcquired bool, err error) {
+	if a.concurrencyLimiter == nil {
+		return false, nil
+	}
+	if !a.concurrencyLimiter.TryAcquire(1) {
+		if atomic.AddInt64(&a.concurrencyQueuedCount, 1) > a.effectiveMaxQueuedRequests() {
+			atomic.AddInt64(&a.concurrencyQueuedCount, -1)
+			return false, ErrConcurrencyQueueFull
+		}
+		a.reportConcurrencyUtilization()
+		queueContext, cancel := context.WithTimeout(ctx, time.Duration(a.QueueTimeoutMs)*time.Millisecond)
+		err = a.concurrencyLimiter.Acquire(queueContext, 1)
+		cancel()
+		atomic.AddInt64(&a.concurrencyQueuedCount, -1)
+		if err != nil {
+			a.reportConcurrencyUtilization()
+			return false, err
+		}
+	}
+	atomic.AddInt64(&a.concurrencyInFlightCount, 1)
+	a.reportConcurrencyUtilization()
+	return true, nil
+}
+
+func (a *DXAPI) releaseConcurrencySlot() {
+	atomic.AddInt64(&a.concurrencyInFlightCount, -1)
+	a.concurrencyLimiter.Release(1)
+	a.reportConcurrencyUtilization()
+}
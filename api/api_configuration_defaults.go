@@ -0,0 +1,32 @@
+package api
+
+import (
+	"github.com/donnyhardyanto/dxlib/configuration"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+func init() {
+	configuration.RegisterDefaults("api", utils.JSON{
+		configuration.DXConfigurationDefaultsEveryEntryKey: utils.JSON{
+			"writetimeout-sec":              DXAPIDefaultWriteTimeoutSec,
+			"readtimeout-sec":               DXAPIDefaultReadTimeoutSec,
+			"shutdowntimeout-sec":           DXAPIDefaultShutdownTimeoutSec,
+			"max_concurrent_requests":       0,
+			"max_queued_requests":           0,
+			"queue_timeout_ms":              DXAPIDefaultQueueTimeoutMs,
+			"path-normalization":            PathNormalizationStrict.String(),
+			"sunset-endpoint-gone":          false,
+			"version-endpoint":              false,
+			"request-body-max-memory-bytes": DXAPIDefaultRequestBodyMaxMemoryBytes,
+			"connection-hub-backlog":        DXAPIConnectionHubDefaultBacklog,
+			"default_language":              DXAPIDefaultLanguage,
+			"mock_mode":                     false,
+			"retry_budget_max_retries":      DXAPIDefaultRetryBudgetMaxRetries,
+			"retry_budget_ms":               DXAPIDefaultRetryBudgetMs,
+			"database_primary_sticky_ms":    0,
+			"enable_admin_endpoints":        false,
+			"admin_uri_prefix":              DXAPIDefaultAdminUriPrefix,
+			"allow_runtime_mutations":       false,
+		},
+	})
+}
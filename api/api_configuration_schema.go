@@ -0,0 +1,87 @@
+package api
+
+import (
+	"github.com/donnyhardyanto/dxlib/configuration"
+)
+
+func numberSchema() *configuration.DXConfigurationSchema {
+	return &configuration.DXConfigurationSchema{Types: []string{configuration.DXConfigurationSchemaTypeNumber}}
+}
+
+// APIConfigurationSchema is the shape of the "api" configuration, one entry per API
+var APIConfigurationSchema = &configuration.DXConfigurationSchema{
+	Types: []string{configuration.DXConfigurationSchemaTypeObject},
+	EntrySchema: &configuration.DXConfigurationSchema{
+		Types: []string{configuration.DXConfigurationSchemaTypeObject},
+		Properties: map[string]*configuration.DXConfigurationSchema{
+			"address": {
+				Types:    []string{configuration.DXConfigurationSchemaTypeString, configuration.DXConfigurationSchemaTypeArray},
+				Required: true,
+				Items:    &configuration.DXConfigurationSchema{Types: []string{configuration.DXConfigurationSchemaTypeString}},
+			},
+			"writetimeout-sec":        numberSchema(),
+			"readtimeout-sec":         numberSchema(),
+			"shutdowntimeout-sec":     numberSchema(),
+			"max_concurrent_requests": numberSchema(),
+			"max_queued_requests":     numberSchema(),
+			"queue_timeout_ms":        numberSchema(),
+			"path-normalization": {
+				Types: []string{configuration.DXConfigurationSchemaTypeString},
+				Enum:  []any{"strict", "redirect", "rewrite"},
+			},
+			"unix-socket-file-mode": {
+				Types: []string{configuration.DXConfigurationSchemaTypeString, configuration.DXConfigurationSchemaTypeNumber},
+			},
+			"access-log-file":                  {Types: []string{configuration.DXConfigurationSchemaTypeString}},
+			"access-log-max-size-mb":           numberSchema(),
+			"access-log-max-backups":           numberSchema(),
+			"access-log-rotate-interval-hours": numberSchema(),
+			"access-log-max-age-days":          numberSchema(),
+			"access-log-compress":              {Types: []string{configuration.DXConfigurationSchemaTypeBool}},
+			"sunset-endpoint-gone":             {Types: []string{configuration.DXConfigurationSchemaTypeBool}},
+			"version-endpoint":                 {Types: []string{configuration.DXConfigurationSchemaTypeBool}},
+			"request-body-max-memory-bytes":    numberSchema(),
+			"connection-hub-backlog":           numberSchema(),
+			"default_language":                 {Types: []string{configuration.DXConfigurationSchemaTypeString}},
+			"mock_mode":                        {Types: []string{configuration.DXConfigurationSchemaTypeBool}},
+			"retry_budget_max_retries":         numberSchema(),
+			"retry_budget_ms":                  numberSchema(),
+			"database_primary_sticky_ms":       numberSchema(),
+			"enable_admin_endpoints":           {Types: []string{configuration.DXConfigurationSchemaTypeBool}},
+			"admin_uri_prefix":                 {Types: []string{configuration.DXConfigurationSchemaTypeString}},
+			"allow_runtime_mutations":          {Types: []string{configuration.DXConfigurationSchemaTypeBool}},
+			"endpoints": {
+				Types: []string{configuration.DXConfigurationSchemaTypeArray},
+				Items: &configuration.DXConfigurationSchema{
+					Types: []string{configuration.DXConfigurationSchemaTypeObject},
+					Properties: map[string]*configuration.DXConfigurationSchema{
+						"uri":    {Types: []string{configuration.DXConfigurationSchemaTypeString}, Required: true},
+						"method": {Types: []string{configuration.DXConfigurationSchemaTypeString}},
+						"kind": {
+							Types:    []string{configuration.DXConfigurationSchemaTypeString},
+							Required: true,
+							Enum: []any{DXAPIDeclaredEndPointKindRedirect, DXAPIDeclaredEndPointKindProxy, DXAPIDeclaredEndPointKindStatic,
+								DXAPIDeclaredEndPointKindFixedResponse},
+						},
+						"title":           {Types: []string{configuration.DXConfigurationSchemaTypeString}},
+						"description":     {Types: []string{configuration.DXConfigurationSchemaTypeString}},
+						"privileges":      {Types: []string{configuration.DXConfigurationSchemaTypeArray}},
+						"target":          {Types: []string{configuration.DXConfigurationSchemaTypeString}},
+						"target_base_url": {Types: []string{configuration.DXConfigurationSchemaTypeString}},
+						"root_dir":        {Types: []string{configuration.DXConfigurationSchemaTypeString}},
+						"status":          numberSchema(),
+						"content_type":    {Types: []string{configuration.DXConfigurationSchemaTypeString}},
+						"body": {
+							Types: []string{configuration.DXConfigurationSchemaTypeString, configuration.DXConfigurationSchemaTypeObject,
+								configuration.DXConfigurationSchemaTypeArray},
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+func init() {
+	configuration.RegisterSchema("api", APIConfigurationSchema)
+}
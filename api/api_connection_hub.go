@@ -0,0 +1,288 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/messaging/pubsub"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+const (
+	// DXAPIConnectionHubDefaultBacklog is the count of events a connection may have waiting to be sent before it is dropped
+	DXAPIConnectionHubDefaultBacklog = 64
+	// DXAPIConnectionHubShutdownEvent is the last event sent to the connections of a hub closed by the shutdown of its API
+	DXAPIConnectionHubShutdownEvent = "shutdown"
+)
+
+// DXAPIConnectionHubHeartbeatInterval is how often an event stream with nothing to send writes a comment, it keeps the
+// proxies from closing it and finds out the clients gone
+var DXAPIConnectionHubHeartbeatInterval = 15 * time.Second
+
+// ErrConnectionDropped is returned by SubscribeGroup when the connection fell more than the Backlog of its hub behind
+var ErrConnectionDropped = errors.New("CONNECTION_DROPPED_SLOW_CONSUMER")
+
+type DXAPIHubEvent struct {
+	Event   string
+	Payload utils.JSON
+}
+
+// DXAPIConnectionHub pushes the events broadcast to a group to every connection joined to it. Broadcast never blocks, a connection
+// whose Backlog is full is dropped instead of slowing the others.
+type DXAPIConnectionHub struct {
+	Owner *DXAPI
+	// Backlog is the count of events a connection may have waiting to be sent, DXAPIConnectionHubDefaultBacklog when zero
+	Backlog      int
+	mutex        sync.RWMutex
+	groups       map[string]map[*DXAPIHubConnection]struct{}
+	isClosed     bool
+	droppedCount atomic.Int64
+	// bridges are the subscriptions of BridgeTopic, closed with the hub
+	bridges []*pubsub.DXPubSubSubscription
+}
+
+// DXAPIHubConnection is one client joined to groups of a hub, the transport sends its Events until Done
+type DXAPIHubConnection struct {
+	hub       *DXAPIConnectionHub
+	groupIds  []string
+	events    chan DXAPIHubEvent
+	done      chan struct{}
+	closeOnce sync.Once
+	// err is why the connection is done, set before done is closed
+	err error
+}
+
+// ConnectionHub returns the hub of a, created on its first use
+func (a *DXAPI) ConnectionHub() *DXAPIConnectionHub {
+	a.connectionHubOnce.Do(func() {
+		a.connectionHub = &DXAPIConnectionHub{
+			Owner:   a,
+			Backlog: a.ConnectionHubBacklog,
+			groups:  map[string]map[*DXAPIHubConnection]struct{}{},
+		}
+	})
+	return a.connectionHub
+}
+
+// Join adds a connection to groupIds, it must be left once its transport ends. Joining a closed hub returns a connection
+// already done.
+func (h *DXAPIConnectionHub) Join(groupIds ...string) *DXAPIHubConnection {
+	backlog := h.Backlog
+	if backlog <= 0 {
+		backlog = DXAPIConnectionHubDefaultBacklog
+	}
+	c := &DXAPIHubConnection{
+		hub:      h,
+		groupIds: groupIds,
+		events:   make(chan DXAPIHubEvent, backlog),
+		done:     make(chan struct{}),
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.isClosed {
+		c.close(http.ErrServerClosed)
+		return c
+	}
+	for _, groupId := range groupIds {
+		group, ok := h.groups[groupId]
+		if !ok {
+			group = map[*DXAPIHubConnection]struct{}{}
+			h.groups[groupId] = group
+		}
+		group[c] = struct{}{}
+	}
+	return c
+}
+
+// Broadcast queues the event to every connection of groupId and returns the count of connections it was queued to. It may be
+// called from any goroutine, like a database notification listener. An event named with a line break, which would end its
+// line of the event stream and inject the fields after it, is queued to none.
+func (h *DXAPIConnectionHub) Broadcast(groupId string, event string, payload utils.JSON) (count int) {
+	if strings.ContainsAny(event, "\r\n") {
+		h.Owner.Log.Warnf("CONNECTION_HUB_INVALID_EVENT_NAME:%s:%s:%q", h.Owner.NameId, groupId, event)
+		return 0
+	}
+	e := DXAPIHubEvent{Event: event, Payload: payload}
+	var slowConnections []*DXAPIHubConnection
+	h.mutex.RLock()
+	for c := range h.groups[groupId] {
+		select {
+		case c.events <- e:
+			count++
+		default:
+			slowConnections = append(slowConnections, c)
+		}
+	}
+	h.mutex.RUnlock()
+	for _, c := range slowConnections {
+		h.droppedCount.Add(1)
+		h.Owner.Log.Warnf("CONNECTION_HUB_SLOW_CONSUMER_DROPPED:%s:%s", h.Owner.NameId, groupId)
+		c.leave(ErrConnectionDropped)
+	}
+	return count
+}
+
+// GroupConnectionCounts is the count of connections of each group, for the metrics
+func (h *DXAPIConnectionHub) GroupConnectionCounts() map[string]int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	r := make(map[string]int, len(h.groups))
+	for groupId, group := range h.groups {
+		r[groupId] = len(group)
+	}
+	return r
+}
+
+// DroppedCount is the count of connections dropped for being slow, for the metrics
+func (h *DXAPIConnectionHub) DroppedCount() int64 {
+	return h.droppedCount.Load()
+}
+
+// Close ends every connection after its queued events and DXAPIConnectionHubShutdownEvent, the later joins are done at once
+func (h *DXAPIConnectionHub) Close() {
+	h.mutex.Lock()
+	h.isClosed = true
+	groups := h.groups
+	h.groups = map[string]map[*DXAPIHubConnection]struct{}{}
+	bridges := h.bridges
+	h.bridges = nil
+	h.mutex.Unlock()
+	for _, s := range bridges {
+		s.Close()
+	}
+	for _, group := range groups {
+		for c := range group {
+			c.close(http.ErrServerClosed)
+		}
+	}
+}
+
+// Events are the events to send, in the order they were broadcast
+func (c *DXAPIHubConnection) Events() <-chan DXAPIHubEvent {
+	return c.events
+}
+
+// Done is closed once the connection is dropped or its hub closed, Err then tells why
+func (c *DXAPIHubConnection) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *DXAPIHubConnection) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Leave removes the connection from its groups
+func (c *DXAPIHubConnection) Leave() {
+	c.leave(nil)
+}
+
+func (c *DXAPIHubConnection) leave(err error) {
+	h := c.hub
+	h.mutex.Lock()
+	for _, groupId := range c.groupIds {
+		group := h.groups[groupId]
+		delete(group, c)
+		if len(group) == 0 {
+			delete(h.groups, groupId)
+		}
+	}
+	h.mutex.Unlock()
+	c.close(err)
+}
+
+func (c *DXAPIHubConnection) close(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		close(c.done)
+	})
+}
+
+// SubscribeGroup answers the request with an event stream (text/event-stream) of the events broadcast to groupId on the hub
+// of the API, until the client goes, the connection is dropped or the API shuts down.
+func (aepr *DXAPIEndPointRequest) SubscribeGroup(groupId string) (err error) {
+	return aepr.SubscribeGroups([]string{groupId})
+}
+
+// SubscribeGroups is SubscribeGroup of several groups on one stream
+func (aepr *DXAPIEndPointRequest) SubscribeGroups(groupIds []string) (err error) {
+	if aepr.ResponseHeaderSent {
+		return aepr.Log.WarnAndCreateErrorf("SHOULD_NOT_HAPPEN:RESPONSE_HEADER_ALREADY_SENT")
+	}
+	c := aepr.EndPoint.Owner.ConnectionHub().Join(groupIds...)
+	defer c.Leave()
+
+	responseWriter := *aepr.GetResponseWriter()
+	responseController := http.NewResponseController(responseWriter)
+	// An event stream outlives the WriteTimeout of the server, each write has its own deadline instead
+	_ = responseController.SetWriteDeadline(time.Time{})
+	header := responseWriter.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	responseWriter.WriteHeader(http.StatusOK)
+	aepr.ResponseStatusCode = http.StatusOK
+	aepr.ResponseHeaderSent = true
+	defer func() {
+		aepr.ResponseBodySent = true
+	}()
+
+	write := func(b []byte) error {
+		_ = responseController.SetWriteDeadline(time.Now().Add(DXAPIConnectionHubHeartbeatInterval))
+		_, err := responseWriter.Write(b)
+		if err != nil {
+			return err
+		}
+		return responseController.Flush()
+	}
+	writeEvent := func(e DXAPIHubEvent) error {
+		data, err := json.Marshal(e.Payload)
+		if err != nil {
+			return err
+		}
+		return write([]byte("event: " + e.Event + "\ndata: " + string(data) + "\n\n"))
+	}
+	// The headers are sent at once, the client knows it is subscribed before the first event
+	err = write([]byte(": subscribed\n\n"))
+	if err != nil {
+		return nil
+	}
+
+	heartbeat := time.NewTicker(DXAPIConnectionHubHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e := <-c.Events():
+			err = writeEvent(e)
+		case <-heartbeat.C:
+			err = write([]byte(": heartbeat\n\n"))
+		case <-c.Done():
+			if !errors.Is(c.Err(), http.ErrServerClosed) {
+				return c.Err()
+			}
+			for len(c.Events()) > 0 {
+				err = writeEvent(<-c.Events())
+				if err != nil {
+					return nil
+				}
+			}
+			_ = writeEvent(DXAPIHubEvent{Event: DXAPIConnectionHubShutdownEvent, Payload: utils.JSON{}})
+			return nil
+		case <-aepr.GetContext().Done():
+			return nil
+		}
+		if err != nil {
+			// The client is gone, nothing is left to answer
+			return nil
+		}
+	}
+}
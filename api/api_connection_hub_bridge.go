@@ -0,0 +1,37 @@
+package api
+
+import (
+	"github.com/donnyhardyanto/dxlib/messaging/pubsub"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// DXAPIHubBridgeTransform turns the payload of a message into the one broadcast, a nil result broadcasts nothing
+type DXAPIHubBridgeTransform func(payload utils.JSON) utils.JSON
+
+// BridgeTopic broadcasts to groupId each message published to topic on pubsub.Manager, as the event topic with its payload
+// turned by transform when not nil, until the hub is closed or the returned subscription closed. A database listener
+// publishing to the topic, like DXDatabase.Listen with pubsub.Manager.PublisherOf, reaches the event streams of the group.
+func (h *DXAPIConnectionHub) BridgeTopic(topic string, groupId string, transform DXAPIHubBridgeTransform) *pubsub.DXPubSubSubscription {
+	s := pubsub.Manager.Subscribe(topic)
+	h.mutex.Lock()
+	if h.isClosed {
+		h.mutex.Unlock()
+		s.Close()
+		return s
+	}
+	h.bridges = append(h.bridges, s)
+	h.mutex.Unlock()
+	go func() {
+		for m := range s.Messages() {
+			payload := m.Payload
+			if transform != nil {
+				payload = transform(payload)
+				if payload == nil {
+					continue
+				}
+			}
+			h.Broadcast(groupId, topic, payload)
+		}
+	}()
+	return s
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database"
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/messaging/pubsub"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// nextSSEEvent returns the next event of events, failing after 5 seconds
+func nextSSEEvent(t *testing.T, events <-chan testSSEEvent) testSSEEvent {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		if !ok {
+			t.Fatal("the event stream ended")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+	return testSSEEvent{}
+}
+
+// A NOTIFY of the database reaches, through its listener, pubsub.Manager and BridgeTopic, the event stream of a client of the
+// group, with the payload turned by the transform. The bridge outlives a reconnect of the listener.
+func TestDatabaseNotificationReachesTheEventStream(t *testing.T) {
+	previousReconnectInterval := database.DXDatabaseListenerMinReconnectInterval
+	database.DXDatabaseListenerMinReconnectInterval = 10 * time.Millisecond
+	t.Cleanup(func() {
+		database.DXDatabaseListenerMinReconnectInterval = previousReconnectInterval
+	})
+	server, err := dbtest.OpenNotificationServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = server.Close()
+	}()
+	// The pool of Notify runs pg_notify on the server of the listener
+	fake := dbtest.Open("postgres", func(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+		if strings.Contains(s.Query, "pg_notify") {
+			channel, _ := s.Arg("1")
+			payload, _ := s.Arg("2")
+			server.Notify(channel.(string), payload.(string))
+		}
+		return dbtest.DXFakeResult{RowsAffected: 1}
+	})
+	defer func() {
+		_ = fake.Close()
+	}()
+	d := &database.DXDatabase{NameId: "events", DatabaseType: database_type.PostgreSQL, Connection: fake.DB, Connected: true,
+		ConnectionString: server.ConnectionString()}
+
+	const topic = "test_bridge_orders"
+	listener, err := d.Listen("orders_changed", pubsub.Manager.PublisherOf(topic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	waitUntil(t, 5*time.Second, func() bool { return server.ListenerCount("orders_changed") == 1 })
+
+	a, ae := newTestHubAPI(t, 16)
+	h := a.ConnectionHub()
+	h.BridgeTopic(topic, "orders", func(payload utils.JSON) utils.JSON {
+		if payload["skip"] == true {
+			return nil
+		}
+		payload["bridged"] = true
+		return payload
+	})
+	httpServer := httptest.NewServer(ae)
+	defer httpServer.Close()
+	events := subscribeSSE(t, httpServer.Client(), httpServer, "orders")
+	// The streams end with the hub, before the server waits for its requests
+	defer h.Close()
+	waitUntil(t, 5*time.Second, func() bool { return h.GroupConnectionCounts()["orders"] == 1 })
+
+	err = d.Notify("orders_changed", utils.JSON{"id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := nextSSEEvent(t, events); e.event != topic || e.data != `{"bridged":true,"id":1}` {
+		t.Fatalf("the event is %+v", e)
+	}
+
+	// A payload dropped by the transform is not broadcast, a text that is not JSON is wrapped
+	err = d.Notify("orders_changed", utils.JSON{"id": 2, "skip": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Notify("orders_changed", "plain text")
+	if e := nextSSEEvent(t, events); e.data != `{"bridged":true,"payload":"plain text"}` {
+		t.Fatalf("the event is %+v", e)
+	}
+
+	// The listener reconnects and listens again, its notifications keep reaching the stream
+	connectionCount := server.ConnectionCount()
+	server.DropConnections()
+	waitUntil(t, 5*time.Second, func() bool {
+		return server.ConnectionCount() > connectionCount && server.ListenerCount("orders_changed") == 1
+	})
+	err = d.Notify("orders_changed", utils.JSON{"id": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := nextSSEEvent(t, events); e.event != topic || e.data != `{"bridged":true,"id":3}` {
+		t.Fatalf("the event after the reconnect is %+v", e)
+	}
+
+	// The bridge ends with the hub
+	h.Close()
+	waitUntil(t, 5*time.Second, func() bool { return pubsub.Manager.Publish(topic, utils.JSON{}) == 0 })
+}
@@ -0,0 +1,303 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
+)
+
+// newTestHubAPI returns an API with a hub of backlog and the endpoint /events subscribing to the group of its query
+func newTestHubAPI(t *testing.T, backlog int) (*DXAPI, *DXAPIEndPoint) {
+	t.Helper()
+	am := newTestAPIManager()
+	t.Cleanup(am.Cancel)
+	a, _ := am.NewAPI("test")
+	a.ConnectionHubBacklog = backlog
+	ae := a.NewEndPoint("events", "", "/events", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil,
+		func(aepr *DXAPIEndPointRequest) error {
+			return aepr.SubscribeGroup(aepr.Request.URL.Query().Get("group"))
+		}, nil, nil, nil, nil)
+	return a, ae
+}
+
+type testSSEEvent struct {
+	event string
+	data  string
+}
+
+// readSSE sends the events of the stream of body to events until it ends
+func readSSE(body *bufio.Scanner, events chan<- testSSEEvent) {
+	defer close(events)
+	var e testSSEEvent
+	for body.Scan() {
+		line := body.Text()
+		switch {
+		case line == "":
+			if e.event != "" || e.data != "" {
+				events <- e
+			}
+			e = testSSEEvent{}
+		case strings.HasPrefix(line, "event: "):
+			e.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		case strings.HasPrefix(line, ":"):
+		default:
+			events <- testSSEEvent{event: "UNEXPECTED_LINE", data: line}
+		}
+	}
+}
+
+// subscribeSSE opens the event stream of group on server and returns its events
+func subscribeSSE(t *testing.T, client *http.Client, server *httptest.Server, group string) <-chan testSSEEvent {
+	t.Helper()
+	response, err := client.Get(server.URL + "/events?group=" + group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = response.Body.Close()
+	})
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, content type %s", response.StatusCode, response.Header.Get("Content-Type"))
+	}
+	events := make(chan testSSEEvent, 4096)
+	scanner := bufio.NewScanner(response.Body)
+	go readSSE(scanner, events)
+	return events
+}
+
+// An event name with a line break is broadcast to no one, it would inject the fields after it in the stream
+func TestBroadcastRejectsEventNamesWithLineBreaks(t *testing.T) {
+	a, ae := newTestHubAPI(t, 0)
+	server := httptest.NewServer(ae)
+	defer server.Close()
+	events := subscribeSSE(t, server.Client(), server, "g")
+	h := a.ConnectionHub()
+	// The streams end with the hub, before the server waits for its requests
+	defer h.Close()
+	waitUntil(t, 5*time.Second, func() bool { return h.GroupConnectionCounts()["g"] == 1 })
+
+	for _, event := range []string{"a\ndata: {\"injected\":true}", "a\rdata: {\"injected\":true}", "a\r\nevent: other"} {
+		if count := h.Broadcast("g", event, utils.JSON{}); count != 0 {
+			t.Errorf("%q was queued to %d connections", event, count)
+		}
+	}
+	if count := h.Broadcast("g", "ok", utils.JSON{"n": 1}); count != 1 {
+		t.Fatalf("ok was queued to %d connections", count)
+	}
+	select {
+	case e := <-events:
+		if e.event != "ok" || e.data != `{"n":1}` {
+			t.Fatalf("the first event is %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+}
+
+// A connection whose backlog is full is dropped without slowing the others, which keep receiving every event
+func TestBroadcastDropsTheSlowConsumer(t *testing.T) {
+	a, _ := newTestHubAPI(t, 2)
+	h := a.ConnectionHub()
+	slow := h.Join("g")
+	fast := h.Join("g")
+	defer fast.Leave()
+	for i := 1; i <= 4; i++ {
+		count := h.Broadcast("g", "tick", utils.JSON{"n": i})
+		want := 2
+		if i > 2 {
+			want = 1
+		}
+		if count != want {
+			t.Fatalf("tick %d was queued to %d connections, want %d", i, count, want)
+		}
+		if e := <-fast.Events(); e.Payload["n"] != i {
+			t.Fatalf("the fast connection received %v", e)
+		}
+	}
+	select {
+	case <-slow.Done():
+	default:
+		t.Fatal("the slow connection is not dropped")
+	}
+	if !errors.Is(slow.Err(), ErrConnectionDropped) {
+		t.Fatalf("err %v", slow.Err())
+	}
+	if h.DroppedCount() != 1 || h.GroupConnectionCounts()["g"] != 1 {
+		t.Fatalf("dropped %d, connections %v", h.DroppedCount(), h.GroupConnectionCounts())
+	}
+	// The events queued before the drop are kept, the ones after are not
+	if len(slow.Events()) != 2 {
+		t.Fatalf("the slow connection has %d events queued", len(slow.Events()))
+	}
+}
+
+// blockingFlushWriter is a ResponseWriter whose writes after the first wait for release, like a client that stopped reading
+type blockingFlushWriter struct {
+	header  http.Header
+	mutex   sync.Mutex
+	writes  int
+	release chan struct{}
+}
+
+func (w *blockingFlushWriter) Header() http.Header { return w.header }
+func (w *blockingFlushWriter) WriteHeader(int)     {}
+func (w *blockingFlushWriter) Flush()              {}
+
+func (w *blockingFlushWriter) Write(b []byte) (int, error) {
+	w.mutex.Lock()
+	w.writes++
+	n := w.writes
+	w.mutex.Unlock()
+	if n > 1 {
+		<-w.release
+	}
+	return len(b), nil
+}
+
+// The event stream of a client that stopped reading ends with ErrConnectionDropped once its backlog is full
+func TestSubscribeGroupEndsTheStreamOfTheSlowConsumer(t *testing.T) {
+	am := newTestAPIManager()
+	defer am.Cancel()
+	a, _ := am.NewAPI("test")
+	a.ConnectionHubBacklog = 2
+	result := make(chan error, 1)
+	ae := a.NewEndPoint("events", "", "/events", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil,
+		func(aepr *DXAPIEndPointRequest) error {
+			err := aepr.SubscribeGroup("g")
+			result <- err
+			return err
+		}, nil, nil, nil, nil)
+	w := &blockingFlushWriter{header: http.Header{}, release: make(chan struct{})}
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		ae.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+	}()
+	h := a.ConnectionHub()
+	waitUntil(t, 5*time.Second, func() bool { return h.GroupConnectionCounts()["g"] == 1 })
+
+	// The first event is taken by the blocked write, the next two fill the backlog and the fourth drops the connection
+	h.Broadcast("g", "tick", utils.JSON{"n": 1})
+	waitUntil(t, 5*time.Second, func() bool {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		return w.writes == 2
+	})
+	for i := 2; i <= 4; i++ {
+		h.Broadcast("g", "tick", utils.JSON{"n": i})
+	}
+	if h.DroppedCount() != 1 || len(h.GroupConnectionCounts()) != 0 {
+		t.Fatalf("dropped %d, connections %v", h.DroppedCount(), h.GroupConnectionCounts())
+	}
+	close(w.release)
+	select {
+	case err := <-result:
+		if !errors.Is(err, ErrConnectionDropped) {
+			t.Fatalf("err %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream of the dropped connection did not end")
+	}
+	<-served
+}
+
+// Many clients of two groups receive, over their event streams, every event of several concurrent broadcasters in the order of
+// each, while other connections join and leave, then the shutdown event, and nothing is left running after them
+func TestConnectionHubSoak(t *testing.T) {
+	const (
+		clientCount       = 40
+		broadcasterCount  = 4
+		eventsPerProducer = 250
+	)
+	baseline := runtime.NumGoroutine()
+	a, ae := newTestHubAPI(t, broadcasterCount*eventsPerProducer)
+	server := httptest.NewServer(ae)
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	groups := []string{"even", "odd"}
+	clientEvents := make([]<-chan testSSEEvent, clientCount)
+	for i := range clientEvents {
+		clientEvents[i] = subscribeSSE(t, client, server, groups[i%2])
+	}
+	h := a.ConnectionHub()
+	waitUntil(t, 5*time.Second, func() bool {
+		counts := h.GroupConnectionCounts()
+		return counts["even"] == clientCount/2 && counts["odd"] == clientCount/2
+	})
+
+	var wg sync.WaitGroup
+	stopChurn := make(chan struct{})
+	churnDone := make(chan struct{})
+	go func() {
+		defer close(churnDone)
+		for {
+			select {
+			case <-stopChurn:
+				return
+			default:
+				h.Join(groups...).Leave()
+			}
+		}
+	}()
+	for b := 0; b < broadcasterCount; b++ {
+		wg.Add(1)
+		go func(b int) {
+			defer wg.Done()
+			for n := 0; n < eventsPerProducer; n++ {
+				for _, group := range groups {
+					h.Broadcast(group, group, utils.JSON{"broadcaster": b, "n": n})
+				}
+			}
+		}(b)
+	}
+	wg.Wait()
+	close(stopChurn)
+	<-churnDone
+	h.Close()
+
+	for i, events := range clientEvents {
+		next := make([]int, broadcasterCount)
+		isShutdown := false
+		for e := range events {
+			if e.event == DXAPIConnectionHubShutdownEvent {
+				isShutdown = true
+				continue
+			}
+			if e.event != groups[i%2] {
+				t.Fatalf("client %d of %s received %+v", i, groups[i%2], e)
+			}
+			var payload struct {
+				Broadcaster int `json:"broadcaster"`
+				N           int `json:"n"`
+			}
+			err := json.Unmarshal([]byte(e.data), &payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if payload.N != next[payload.Broadcaster] {
+				t.Fatalf("client %d received %d of broadcaster %d, want %d", i, payload.N, payload.Broadcaster, next[payload.Broadcaster])
+			}
+			next[payload.Broadcaster]++
+		}
+		if !isShutdown || fmt.Sprint(next) != fmt.Sprint([]int{eventsPerProducer, eventsPerProducer, eventsPerProducer, eventsPerProducer}) {
+			t.Fatalf("client %d: shutdown %v, received %v", i, isShutdown, next)
+		}
+	}
+	if h.DroppedCount() != 0 || len(h.GroupConnectionCounts()) != 0 {
+		t.Fatalf("dropped %d, connections %v", h.DroppedCount(), h.GroupConnectionCounts())
+	}
+	server.Close()
+	waitUntil(t, 5*time.Second, func() bool { return runtime.NumGoroutine() <= baseline+2 })
+}
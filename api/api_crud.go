@@ -0,0 +1,352 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/donnyhardyanto/dxlib/database"
+	"github.com/donnyhardyanto/dxlib/utils"
+	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
+)
+
+// DXAPICRUDHook is called in the transaction of the write. A Before hook may change values, the payload about to be written,
+// and vetoes the write by returning an error or writing a response itself. An After hook gets the written row.
+type DXAPICRUDHook func(aepr *DXAPIEndPointRequest, dtx *database.DXDatabaseTx, values utils.JSON) (err error)
+
+type CRUDSpec struct {
+	// Title names the resource in the titles and descriptions of the endpoints
+	Title string
+	// IdField is the generated key of the table, "id" when empty
+	IdField string
+	// Fields are the fields written by create and update and validated like the parameters of any endpoint
+	Fields []DXAPIEndPointParameter
+	// ShowFields are the fields returned by list and read, every field when nil. When set, list and read take the fields
+	// parameter asking for a part of them only.
+	ShowFields []string
+	// FilterFields may be given to list as equality filters, SortFields as its sort_by parameter
+	FilterFields []string
+	SortFields   []string
+	// IsSoftDelete makes delete set is_deleted and hides the deleted rows from list and read
+	IsSoftDelete bool
+	Isolation    sql.IsolationLevel
+	Middlewares  []DXAPIEndPointExecuteFunc
+	Privileges   []string
+	BeforeCreate DXAPICRUDHook
+	AfterCreate  DXAPICRUDHook
+	BeforeUpdate DXAPICRUDHook
+	AfterUpdate  DXAPICRUDHook
+	BeforeDelete DXAPICRUDHook
+	AfterDelete  DXAPICRUDHook
+}
+
+type dxAPICRUD struct {
+	d         *database.DXDatabase
+	tableName string
+	spec      CRUDSpec
+}
+
+func crudResponsePossibilities(successDescription string) map[string]*DXAPIEndPointResponsePossibility {
+	return map[string]*DXAPIEndPointResponsePossibility{
+		"success":              {StatusCode: http.StatusOK, Description: successDescription},
+		"invalid_request":      {StatusCode: http.StatusBadRequest, Description: "Invalid request or vetoed by a hook"},
+		"not_found":            {StatusCode: http.StatusNotFound, Description: "No row with this id"},
+		"unprocessable_entity": {StatusCode: http.StatusUnprocessableEntity, Description: "Invalid parameter"},
+	}
+}
+
+// NewCRUDEndPoints registers on a the endpoints of tableName of d: GET <uriPrefix>/list with paging, filters and sorting,
+// GET <uriPrefix>/read, POST <uriPrefix>/create, PUT <uriPrefix>/update taking the changed fields in "new", and DELETE
+// <uriPrefix>/delete. The writes run in a transaction of the request, the hooks of spec see it.
+func NewCRUDEndPoints(a *DXAPI, uriPrefix string, d *database.DXDatabase, tableName string, spec CRUDSpec) []*DXAPIEndPoint {
+	if spec.IdField == "" {
+		spec.IdField = "id"
+	}
+	if spec.Title == "" {
+		spec.Title = tableName
+	}
+	c := &dxAPICRUD{d: d, tableName: tableName, spec: spec}
+	idParameter := DXAPIEndPointParameter{NameId: spec.IdField, Type: "int64", Description: "Id of the " + spec.Title, IsMustExist: true}
+
+	listParameters := []DXAPIEndPointParameter{
+		{NameId: "row_per_page", Type: "int64", Description: "Rows per page, 0 for every row"},
+		{NameId: "page_index", Type: "int64", Description: "Page, from 0"},
+		{NameId: "sort_by", Type: "string", Description: "One of the sort fields"},
+		{NameId: "sort_direction", Type: "string", Description: "asc or desc"},
+	}
+	for _, name := range spec.FilterFields {
+		filter := DXAPIEndPointParameter{NameId: name, Type: "string", Description: "Equality filter"}
+		for _, f := range spec.Fields {
+			if f.NameId == name {
+				filter = f
+				filter.IsMustExist = false
+			}
+		}
+		listParameters = append(listParameters, filter)
+	}
+	updateFields := make([]DXAPIEndPointParameter, len(spec.Fields))
+	for i, f := range spec.Fields {
+		updateFields[i] = f
+		updateFields[i].IsMustExist = false
+	}
+
+	readParameters := []DXAPIEndPointParameter{idParameter}
+	if spec.ShowFields != nil {
+		listParameters = append(listParameters, FieldsParameter(spec.ShowFields))
+		readParameters = append(readParameters, FieldsParameter(spec.ShowFields))
+	}
+
+	listEndPoint := a.NewEndPoint("List "+spec.Title, "Paged list of "+spec.Title, uriPrefix+"/list", http.MethodGet, EndPointTypeHTTPJSON,
+		utilsHttp.ContentTypeNone, listParameters, c.list, nil, crudResponsePossibilities("The rows of the page"), spec.Middlewares, spec.Privileges)
+	listEndPoint.AllowedFields = spec.ShowFields
+	readEndPoint := a.NewEndPoint("Read "+spec.Title, "One "+spec.Title+" by id", uriPrefix+"/read", http.MethodGet, EndPointTypeHTTPJSON,
+		utilsHttp.ContentTypeNone, readParameters, c.read, nil, crudResponsePossibilities("The row"), spec.Middlewares, spec.Privileges)
+	readEndPoint.AllowedFields = spec.ShowFields
+	return []*DXAPIEndPoint{
+		listEndPoint,
+		readEndPoint,
+		a.NewEndPoint("Create "+spec.Title, "Create a "+spec.Title, uriPrefix+"/create", http.MethodPost, EndPointTypeHTTPJSON,
+			utilsHttp.ContentTypeApplicationJSON, spec.Fields, c.create, nil, crudResponsePossibilities("The id of the new row"), spec.Middlewares, spec.Privileges),
+		a.NewEndPoint("Update "+spec.Title, "Change the fields of a "+spec.Title, uriPrefix+"/update", http.MethodPut, EndPointTypeHTTPJSON,
+			utilsHttp.ContentTypeApplicationJSON, []DXAPIEndPointParameter{
+				idParameter,
+				{NameId: "new", Type: "json", Description: "The changed fields", IsMustExist: true, Children: updateFields},
+			}, c.update, nil, crudResponsePossibilities("The id of the row"), spec.Middlewares, spec.Privileges),
+		a.NewEndPoint("Delete "+spec.Title, "Delete a "+spec.Title, uriPrefix+"/delete", http.MethodDelete, EndPointTypeHTTPJSON,
+			utilsHttp.ContentTypeNone, []DXAPIEndPointParameter{idParameter}, c.delete, nil, crudResponsePossibilities("Deleted"), spec.Middlewares, spec.Privileges),
+	}
+}
+
+func (c *dxAPICRUD) whereNotDeleted(where utils.JSON) utils.JSON {
+	if c.spec.IsSoftDelete {
+		where["is_deleted"] = false
+	}
+	return where
+}
+
+// fields is the fields parameter of list and read and the columns to select for it, the ShowFields when absent
+func (c *dxAPICRUD) fields(aepr *DXAPIEndPointRequest) (fields []string, showFieldNames []string, err error) {
+	if c.spec.ShowFields == nil {
+		return nil, nil, nil
+	}
+	fields, err = aepr.GetFields()
+	if err != nil {
+		return nil, nil, err
+	}
+	if fields == nil {
+		return nil, c.spec.ShowFields, nil
+	}
+	return fields, FieldsShowFieldNames(fields), nil
+}
+
+func (c *dxAPICRUD) list(aepr *DXAPIEndPointRequest) (err error) {
+	_, rowPerPage, err := aepr.GetParameterValueAsInt64("row_per_page")
+	if err != nil {
+		return err
+	}
+	_, pageIndex, err := aepr.GetParameterValueAsInt64("page_index")
+	if err != nil {
+		return err
+	}
+	where := c.whereNotDeleted(utils.JSON{})
+	for _, name := range c.spec.FilterFields {
+		isExist, v, err := aepr.GetParameterValueAsAny(name)
+		if err != nil {
+			return err
+		}
+		if isExist && v != nil {
+			where[name] = v
+		}
+	}
+	var orderBy map[string]string
+	_, sortBy, err := aepr.GetParameterValueAsString("sort_by")
+	if err != nil {
+		return err
+	}
+	if sortBy != "" {
+		isAllowed := false
+		for _, name := range c.spec.SortFields {
+			isAllowed = isAllowed || name == sortBy
+		}
+		if !isAllowed {
+			return aepr.WriteResponseAndNewErrorf(http.StatusUnprocessableEntity, "SORT_FIELD_NOT_ALLOWED:%s", sortBy)
+		}
+		_, sortDirection, err := aepr.GetParameterValueAsString("sort_direction")
+		if err != nil {
+			return err
+		}
+		if sortDirection == "" {
+			sortDirection = "asc"
+		}
+		orderBy = map[string]string{sortBy: sortDirection}
+	}
+	fields, showFieldNames, err := c.fields(aepr)
+	if err != nil {
+		return err
+	}
+	rowsInfo, rows, totalRows, totalPage, err := aepr.TenantDatabase(c.d).SelectPaged(c.tableName, showFieldNames, where, orderBy, rowPerPage, pageIndex,
+		database.WithTruncateOnMaxRows())
+	if err != nil {
+		return err
+	}
+	aepr.WriteResponseAsJSON(http.StatusOK, nil, utils.JSON{
+		"list": utils.JSON{
+			"rows":         FilterFields(rows, fields),
+			"total_rows":   totalRows,
+			"total_page":   totalPage,
+			"rows_info":    rowsInfo,
+			"is_truncated": rowsInfo != nil && rowsInfo.Truncated,
+		},
+	})
+	return nil
+}
+
+func (c *dxAPICRUD) read(aepr *DXAPIEndPointRequest) (err error) {
+	_, id, err := aepr.GetParameterValueAsInt64(c.spec.IdField)
+	if err != nil {
+		return err
+	}
+	fields, showFieldNames, err := c.fields(aepr)
+	if err != nil {
+		return err
+	}
+	rowsInfo, row, err := aepr.TenantDatabase(c.d).SelectOne(c.tableName, showFieldNames, c.whereNotDeleted(utils.JSON{c.spec.IdField: id}), nil, nil)
+	if err != nil {
+		return err
+	}
+	if row == nil {
+		return aepr.WriteResponseAndNewErrorf(http.StatusNotFound, "NOT_FOUND:%s:%d", c.tableName, id)
+	}
+	aepr.WriteResponseAsJSON(http.StatusOK, nil, utils.JSON{"data": FilterFields(row, fields), "rows_info": rowsInfo})
+	return nil
+}
+
+// lockRow returns the row of id in dtx, locked for the write, or answers 404
+func (c *dxAPICRUD) lockRow(aepr *DXAPIEndPointRequest, dtx *database.DXDatabaseTx, id int64) (row utils.JSON, err error) {
+	_, row, err = dtx.SelectOne(c.tableName, nil, c.whereNotDeleted(utils.JSON{c.spec.IdField: id}), nil, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	if row == nil {
+		return nil, aepr.WriteResponseAndNewErrorf(http.StatusNotFound, "NOT_FOUND:%s:%d", c.tableName, id)
+	}
+	return row, nil
+}
+
+func runCRUDHook(hook DXAPICRUDHook, aepr *DXAPIEndPointRequest, dtx *database.DXDatabaseTx, values utils.JSON) (err error) {
+	if hook == nil {
+		return nil
+	}
+	err = hook(aepr, dtx, values)
+	if err == nil && aepr.ResponseHeaderSent {
+		return aepr.Log.WarnAndCreateErrorf("CRUD_HOOK_ANSWERED_THE_REQUEST")
+	}
+	return err
+}
+
+func (c *dxAPICRUD) create(aepr *DXAPIEndPointRequest) (err error) {
+	values := utils.JSON{}
+	for _, f := range c.spec.Fields {
+		isExist, v, err := aepr.GetParameterValueAsAny(f.NameId)
+		if err != nil {
+			return err
+		}
+		if isExist {
+			values[f.NameId] = v
+		}
+	}
+	var id int64
+	err = aepr.WithTx(c.d, c.spec.Isolation, func(dtx *database.DXDatabaseTx) (err error) {
+		err = runCRUDHook(c.spec.BeforeCreate, aepr, dtx, values)
+		if err != nil {
+			return err
+		}
+		id, err = dtx.Insert(c.tableName, values, database.WithAuditMeta(aepr.AuditMeta()))
+		if err != nil {
+			return err
+		}
+		values[c.spec.IdField] = id
+		return runCRUDHook(c.spec.AfterCreate, aepr, dtx, values)
+	})
+	if err != nil {
+		return err
+	}
+	aepr.WriteResponseAsJSON(http.StatusOK, nil, utils.JSON{c.spec.IdField: id})
+	return nil
+}
+
+func (c *dxAPICRUD) update(aepr *DXAPIEndPointRequest) (err error) {
+	_, id, err := aepr.GetParameterValueAsInt64(c.spec.IdField)
+	if err != nil {
+		return err
+	}
+	_, newValues, err := aepr.GetParameterValueAsJSON("new")
+	if err != nil {
+		return err
+	}
+	// Only the declared fields are written, whatever else the client sent
+	values := utils.JSON{}
+	for _, f := range c.spec.Fields {
+		v, ok := newValues[f.NameId]
+		if ok {
+			values[f.NameId] = v
+		}
+	}
+	err = aepr.WithTx(c.d, c.spec.Isolation, func(dtx *database.DXDatabaseTx) (err error) {
+		row, err := c.lockRow(aepr, dtx, id)
+		if err != nil {
+			return err
+		}
+		err = runCRUDHook(c.spec.BeforeUpdate, aepr, dtx, values)
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			return aepr.WriteResponseAndNewErrorf(http.StatusUnprocessableEntity, "NO_FIELD_TO_UPDATE")
+		}
+		_, err = dtx.Update(c.tableName, values, utils.JSON{c.spec.IdField: id}, database.WithAuditMeta(aepr.AuditMeta()))
+		if err != nil {
+			return err
+		}
+		for k, v := range values {
+			row[k] = v
+		}
+		return runCRUDHook(c.spec.AfterUpdate, aepr, dtx, row)
+	})
+	if err != nil {
+		return err
+	}
+	aepr.WriteResponseAsJSON(http.StatusOK, nil, utils.JSON{c.spec.IdField: id})
+	return nil
+}
+
+func (c *dxAPICRUD) delete(aepr *DXAPIEndPointRequest) (err error) {
+	_, id, err := aepr.GetParameterValueAsInt64(c.spec.IdField)
+	if err != nil {
+		return err
+	}
+	err = aepr.WithTx(c.d, c.spec.Isolation, func(dtx *database.DXDatabaseTx) (err error) {
+		row, err := c.lockRow(aepr, dtx, id)
+		if err != nil {
+			return err
+		}
+		err = runCRUDHook(c.spec.BeforeDelete, aepr, dtx, row)
+		if err != nil {
+			return err
+		}
+		where := utils.JSON{c.spec.IdField: id}
+		if c.spec.IsSoftDelete {
+			_, err = dtx.SoftDelete(c.tableName, where, database.WithAuditMeta(aepr.AuditMeta()))
+		} else {
+			_, err = dtx.Delete(c.tableName, where, database.WithAuditMeta(aepr.AuditMeta()))
+		}
+		if err != nil {
+			return err
+		}
+		return runCRUDHook(c.spec.AfterDelete, aepr, dtx, row)
+	})
+	if err != nil {
+		return err
+	}
+	aepr.WriteResponseAsJSON(http.StatusOK, nil, nil)
+	return nil
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+)
+
+// databaseErrorStatus maps the errors of the database classified by db.ClassifyError to the status of their response, the
+// reason sent names the constraint and not the values of the row
+func databaseErrorStatus(err error) (statusCode int, reason string, isMapped bool) {
+	var driverError *db.DriverError
+	if !errors.As(err, &driverError) {
+		return 0, "", false
+	}
+	switch {
+	case errors.Is(err, db.ErrDuplicateKey):
+		return http.StatusConflict, "DUPLICATE_KEY:" + driverError.Constraint, true
+	case errors.Is(err, db.ErrForeignKeyViolation):
+		return http.StatusUnprocessableEntity, "FOREIGN_KEY_VIOLATION:" + driverError.Constraint, true
+	case errors.Is(err, db.ErrNoRows):
+		return http.StatusNotFound, "NOT_FOUND", true
+	default:
+		return 0, "", false
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/utils/cache"
+)
+
+// DXAPIDatabasePrimaryStickyMaxSubjects bounds the subjects remembered for DatabasePrimaryStickyMs, the least recent is
+// forgotten first
+const DXAPIDatabasePrimaryStickyMaxSubjects = 10000
+
+// PinDatabaseToPrimary sends the reads of the rest of the request to the primary of each database instead of its read
+// replicas, a write of the request does it already
+func (aepr *DXAPIEndPointRequest) PinDatabaseToPrimary() {
+	aepr.isDatabasePinnedToPrimary = true
+	aepr.databaseRouting.PinToPrimary()
+}
+
+func (aepr *DXAPIEndPointRequest) IsDatabasePinnedToPrimary() bool {
+	return aepr.databaseRouting.IsPinnedToPrimary()
+}
+
+// databasePrimaryStickySubjects are the subjects whose requests are pinned to the primary, for DatabasePrimaryStickyMs after
+// a request of theirs wrote
+func (a *DXAPI) databasePrimaryStickySubjects() *cache.DXMemoryCacheStore[string, struct{}] {
+	a.databasePrimaryStickyOnce.Do(func() {
+		a.databasePrimaryStickySubjectStore = cache.NewMemoryCacheStore[string, struct{}](DXAPIDatabasePrimaryStickyMaxSubjects)
+	})
+	return a.databasePrimaryStickySubjectStore
+}
+
+// pinDatabaseToPrimaryIfSticky pins the request of a subject, the authenticated user, whose request wrote less than
+// DatabasePrimaryStickyMs ago, so it reads its own writes while the replicas lag
+func (a *DXAPI) pinDatabaseToPrimaryIfSticky(aepr *DXAPIEndPointRequest) {
+	if a.DatabasePrimaryStickyMs <= 0 || aepr.CurrentUser.Id == "" {
+		return
+	}
+	_, isFound, _ := a.databasePrimaryStickySubjects().Get(aepr.CurrentUser.Id)
+	if isFound {
+		aepr.databaseRouting.PinToPrimary()
+	}
+}
+
+// rememberDatabasePrimarySticky keeps the subject of a request that wrote or was pinned by PinDatabaseToPrimary, a request
+// only pinned by the stickiness does not extend it
+func (a *DXAPI) rememberDatabasePrimarySticky(aepr *DXAPIEndPointRequest) {
+	if a.DatabasePrimaryStickyMs <= 0 || aepr.CurrentUser.Id == "" {
+		return
+	}
+	if aepr.databaseRouting.IsWritten() || aepr.isDatabasePinnedToPrimary {
+		a.databasePrimaryStickySubjects().Set(aepr.CurrentUser.Id, struct{}{}, time.Duration(a.DatabasePrimaryStickyMs)*time.Millisecond)
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database"
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/utils"
+	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
+)
+
+// laggingOrders is a primary counting the orders inserted and a replica which has received none of them
+type laggingOrders struct {
+	mutex sync.Mutex
+	count int64
+}
+
+func (f *laggingOrders) primary(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch {
+	case strings.HasPrefix(s.Query, "INSERT"):
+		f.count++
+		return dbtest.DXFakeResult{Columns: []string{"id"}, Rows: [][]any{{f.count}}, RowsAffected: 1}
+	case s.IsQuery:
+		r := dbtest.DXFakeResult{Columns: []string{"id"}}
+		for id := int64(1); id <= f.count; id++ {
+			r.Rows = append(r.Rows, []any{id})
+		}
+		return r
+	}
+	return dbtest.DXFakeResult{}
+}
+
+func (f *laggingOrders) replica(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+	return dbtest.DXFakeResult{Columns: []string{"id"}}
+}
+
+// newTestRoutingAPI returns an API over a primary and its lagging replica. Its endpoints answer the count of orders they read,
+// /write and /write-tx after inserting one, /pin after PinDatabaseToPrimary. The user is the X-Test-User header.
+func newTestRoutingAPI(t *testing.T) (*DXAPI, map[string]*DXAPIEndPoint) {
+	t.Helper()
+	f := &laggingOrders{}
+	open := func(handler dbtest.DXFakeHandler) *database.DXDatabase {
+		fake := dbtest.Open("postgres", handler)
+		t.Cleanup(func() {
+			_ = fake.Close()
+		})
+		return &database.DXDatabase{NameId: "orders", DatabaseType: database_type.PostgreSQL, Connection: fake.DB, Connected: true}
+	}
+	d := open(f.primary)
+	d.ReadReplicas = []*database.DXDatabase{open(f.replica)}
+
+	am := newTestAPIManager()
+	t.Cleanup(am.Cancel)
+	a, _ := am.NewAPI("test")
+	user := func(aepr *DXAPIEndPointRequest) error {
+		aepr.CurrentUser.Id = aepr.Request.Header.Get("X-Test-User")
+		return nil
+	}
+	respondCount := func(aepr *DXAPIEndPointRequest) error {
+		_, rows, err := d.SelectContext(aepr.Context, "orders", nil, nil, nil, nil)
+		if err != nil {
+			return err
+		}
+		aepr.WriteResponseAsString(http.StatusOK, nil, strconv.Itoa(len(rows)))
+		return nil
+	}
+	endPoints := map[string]*DXAPIEndPoint{}
+	for uri, onExecute := range map[string]DXAPIEndPointExecuteFunc{
+		"/read": respondCount,
+		"/write": func(aepr *DXAPIEndPointRequest) error {
+			_, err := d.InsertContext(aepr.Context, "orders", "id", utils.JSON{"code": "A"})
+			if err != nil {
+				return err
+			}
+			return respondCount(aepr)
+		},
+		"/write-tx": func(aepr *DXAPIEndPointRequest) error {
+			err := aepr.WithTx(d, sql.LevelReadCommitted, func(dtx *database.DXDatabaseTx) error {
+				_, err := dtx.Insert("orders", utils.JSON{"code": "A"})
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			return respondCount(aepr)
+		},
+		"/pin": func(aepr *DXAPIEndPointRequest) error {
+			aepr.PinDatabaseToPrimary()
+			return respondCount(aepr)
+		},
+	} {
+		endPoints[uri] = a.NewEndPoint(uri, "", uri, http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil, onExecute,
+			nil, nil, []DXAPIEndPointExecuteFunc{user}, nil)
+	}
+	return a, endPoints
+}
+
+// serveCount returns the count of orders answered by the endpoint uri to a request of user
+func serveCount(t *testing.T, endPoints map[string]*DXAPIEndPoint, uri string, user string) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, uri, nil)
+	if user != "" {
+		r.Header.Set("X-Test-User", user)
+	}
+	endPoints[uri].ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: status %d: %s", uri, w.Code, w.Body.String())
+	}
+	return w.Body.String()
+}
+
+// The reads of a request after its write, or after PinDatabaseToPrimary, see the primary, the others read the lagging replica
+func TestRequestReadsItsWrites(t *testing.T) {
+	_, endPoints := newTestRoutingAPI(t)
+	if got := serveCount(t, endPoints, "/write", "u1"); got != "1" {
+		t.Fatalf("the read after the write returned %s orders", got)
+	}
+	if got := serveCount(t, endPoints, "/write-tx", "u1"); got != "2" {
+		t.Fatalf("the read after the write of the transaction returned %s orders", got)
+	}
+	// Without a sticky duration the next request of the user reads the replica
+	if got := serveCount(t, endPoints, "/read", "u1"); got != "0" {
+		t.Fatalf("the read returned %s orders", got)
+	}
+	if got := serveCount(t, endPoints, "/pin", "u1"); got != "2" {
+		t.Fatalf("the pinned read returned %s orders", got)
+	}
+}
+
+// The requests of a user read the primary for DatabasePrimaryStickyMs after a request of theirs wrote, the ones of the others
+// and the anonymous ones do not
+func TestDatabasePrimaryStickyDuration(t *testing.T) {
+	a, endPoints := newTestRoutingAPI(t)
+	a.DatabasePrimaryStickyMs = 200
+	if got := serveCount(t, endPoints, "/write", "u1"); got != "1" {
+		t.Fatalf("the read after the write returned %s orders", got)
+	}
+	for _, tc := range []struct {
+		user string
+		want string
+	}{
+		{"u1", "1"},
+		{"u1", "1"},
+		{"u2", "0"},
+		{"", "0"},
+	} {
+		if got := serveCount(t, endPoints, "/read", tc.user); got != tc.want {
+			t.Fatalf("the read of %q returned %s orders, want %s", tc.user, got, tc.want)
+		}
+	}
+	// The reads pinned by the stickiness do not extend it
+	time.Sleep(120 * time.Millisecond)
+	if got := serveCount(t, endPoints, "/read", "u1"); got != "1" {
+		t.Fatalf("the read within the sticky duration returned %s orders", got)
+	}
+	time.Sleep(120 * time.Millisecond)
+	if got := serveCount(t, endPoints, "/read", "u1"); got != "0" {
+		t.Fatalf("the read after the sticky duration returned %s orders", got)
+	}
+	if a.databasePrimaryStickySubjects().Len() != 0 {
+		t.Fatalf("%d subjects are remembered", a.databasePrimaryStickySubjects().Len())
+	}
+}
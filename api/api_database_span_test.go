@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/donnyhardyanto/dxlib/database"
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/utils"
+	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
+)
+
+func spanAttributes(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	r := map[attribute.Key]attribute.Value{}
+	for _, kv := range s.Attributes() {
+		r[kv.Key] = kv.Value
+	}
+	return r
+}
+
+// The spans of the database helpers run by a handler are the children of the span of its request, with the attributes of the
+// semantic conventions, the statement without the values and the error of a failed query
+func TestDatabaseSpansUnderOneAPIRequest(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	previousIncludeStatement, previousAcquireSpan := db.IncludeStatementInSpan, db.IsConnectionAcquireSpanEnabled
+	db.IncludeStatementInSpan, db.IsConnectionAcquireSpanEnabled = true, true
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		_ = provider.Shutdown(context.Background())
+		db.IncludeStatementInSpan, db.IsConnectionAcquireSpanEnabled = previousIncludeStatement, previousAcquireSpan
+	})
+
+	fake := dbtest.Open("postgres", func(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+		if strings.Contains(s.Query, `"missing"`) {
+			return dbtest.DXFakeResult{Err: errors.New(`relation "missing" does not exist`)}
+		}
+		if s.IsQuery {
+			return dbtest.DXFakeResult{Columns: []string{"id"}, Rows: [][]any{{int64(7)}}}
+		}
+		return dbtest.DXFakeResult{RowsAffected: 1}
+	})
+	defer func() {
+		_ = fake.Close()
+	}()
+	db.SetTraceDatabaseName(fake.DB, "main")
+	defer db.SetTraceDatabaseName(fake.DB, "")
+	d := &database.DXDatabase{NameId: "spans", DatabaseType: database_type.PostgreSQL, Connection: fake.DB, Connected: true}
+
+	am := newTestAPIManager()
+	a, _ := am.NewAPI("test")
+	ae := a.NewEndPoint("orders", "", "/orders", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil,
+		func(aepr *DXAPIEndPointRequest) error {
+			_, _, err := d.SelectContext(aepr.Context, "orders", nil, utils.JSON{"code": "secret-code"}, nil, nil)
+			if err != nil {
+				return err
+			}
+			err = d.Tx(&aepr.Log, sql.LevelReadCommitted, func(dtx *database.DXDatabaseTx) error {
+				_, err := dtx.Insert("orders", utils.JSON{"code": "secret-code"})
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			_, _, err = d.SelectContext(aepr.Context, "missing", nil, nil, nil, nil)
+			if err == nil {
+				t.Error("the select of missing did not fail")
+			}
+			aepr.WriteResponseAsString(http.StatusOK, nil, "ok")
+			return nil
+		}, nil, nil, nil, nil)
+	w := httptest.NewRecorder()
+	ae.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	request, ok := spans["routeHandler|/orders"]
+	if !ok {
+		t.Fatalf("no request span in %v", spans)
+	}
+	for _, name := range []string{"db.select orders", "db.connection.acquire", "db.insert orders", "db.select missing"} {
+		s, ok := spans[name]
+		if !ok {
+			t.Fatalf("no span %s in %v", name, spans)
+		}
+		if s.Parent().SpanID() != request.SpanContext().SpanID() || s.SpanContext().TraceID() != request.SpanContext().TraceID() {
+			t.Errorf("%s is not a child of the request span", name)
+		}
+	}
+
+	selectAttributes := spanAttributes(spans["db.select orders"])
+	for key, want := range map[attribute.Key]string{
+		"db.system":    "postgresql",
+		"db.name":      "main",
+		"db.sql.table": "orders",
+		"db.operation": "select",
+	} {
+		if got := selectAttributes[key].AsString(); got != want {
+			t.Errorf("%s is %q, want %q", key, got, want)
+		}
+	}
+	if got := selectAttributes["db.rows_returned"].AsInt64(); got != 1 {
+		t.Errorf("db.rows_returned is %d", got)
+	}
+	for _, name := range []string{"db.select orders", "db.insert orders"} {
+		statement := spanAttributes(spans[name])["db.statement"].AsString()
+		if !strings.Contains(statement, `"orders"`) || strings.Contains(statement, "secret-code") {
+			t.Errorf("%s: db.statement %q", name, statement)
+		}
+	}
+	if got := spanAttributes(spans["db.insert orders"])["db.operation"].AsString(); got != "insert" {
+		t.Errorf("the insert db.operation is %q", got)
+	}
+
+	failed := spans["db.select missing"]
+	if failed.Status().Code != codes.Error || len(failed.Events()) == 0 || failed.Events()[0].Name != "exception" {
+		t.Errorf("the failed select has the status %v and the events %v", failed.Status(), failed.Events())
+	}
+	if spans["db.select orders"].Status().Code == codes.Error {
+		t.Error("the select of orders is recorded as failed")
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/donnyhardyanto/dxlib/database"
 	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
 	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
 	"net/http"
 	"sort"
+	"sync/atomic"
+	"time"
 )
 
 type DXAPIEndPointType int
@@ -57,6 +61,8 @@ type DXAPIEndPointResponsePossibility struct {
 	Description  string
 	Headers      map[string]string
 	DataTemplate []*DXAPIEndPointParameter
+	// Examples are named response bodies of the possibility, in the spec and answered in mock mode
+	Examples map[string]utils.JSON
 }
 
 type DXAPIEndPointExecuteFunc func(aepr *DXAPIEndPointRequest) (err error)
@@ -75,20 +81,66 @@ type DXAPIEndPoint struct {
 	ResponsePossibilities map[string]*DXAPIEndPointResponsePossibility
 	Middlewares           []DXAPIEndPointExecuteFunc
 	Privileges            []string
+	// Health and readiness endpoints must keep answering when the API is saturated
+	IsBypassConcurrencyLimiter bool
+	// Headers set by the API middlewares (for example NewSecurityHeadersMiddleware) that this endpoint must not send
+	RemovedSecurityHeaders []string
+	// Successful responses get an ETag (the body hash unless the handler set one) and conditional GET/HEAD are answered with 304
+	Cacheable bool
+	// Cache-Control of the successful responses, error responses are always no-store
+	CachePolicy *DXAPICachePolicy
+	// Deprecated endpoints answer with Deprecation (and Sunset when SunsetDate is set) headers and are marked in the spec
+	Deprecated             bool
+	DeprecationMessage     string
+	SunsetDate             time.Time
+	deprecatedRequestCount int64
+	// Logs the request headers, parameters and response body at Debug level, see SetDebugDump
+	debugDump  atomic.Bool
+	isFallback bool
+	// isDeclared marks the endpoints of the "endpoints" of the configuration
+	isDeclared bool
+	// RequestExamples and ResponseExamples are named examples written in the spec, see WithRequestExample and
+	// WithResponseExample
+	RequestExamples  map[string]utils.JSON
+	ResponseExamples map[string]utils.JSON
+	// AllowedFields are the fields a request may ask for in its fields parameter, see WithFields
+	AllowedFields []string
+	// Counts the requests whose retry budget was spent, see RetryBudgetExhaustedCount
+	retryBudgetExhaustedCount atomic.Int64
 }
 
 func (aep *DXAPIEndPoint) PrintSpec() (s string, err error) {
 	switch SpecFormat {
 	case "MarkDown":
 		s = fmt.Sprintf("## %s\n", aep.Title)
+		if aep.Deprecated {
+			s += fmt.Sprintf("####  %s\n", aep.deprecationSpecText())
+		}
 		s += fmt.Sprintf("####  Description: %s\n", aep.Description)
 		s += fmt.Sprintf("####  URI: %s\n", aep.Uri)
 		s += fmt.Sprintf("####  Method: %s\n", aep.Method)
 		s += fmt.Sprintf("####  Request Content Type: %s\n", aep.RequestContentType)
+		if aep.CachePolicy != nil {
+			s += fmt.Sprintf("####  Cache Policy: %s\n", aep.CachePolicy.String())
+		}
 		s += "####  Parameters:\n"
 		for _, p := range aep.Parameters {
 			s += p.PrintSpec(4)
 		}
+		if len(aep.RequestExamples) > 0 {
+			examples, err := examplesSpecText(4, aep.RequestExamples)
+			if err != nil {
+				return "", err
+			}
+			s += "####  Request Examples:\n" + examples
+		}
+		if len(aep.ResponseExamples) > 0 {
+			examples, err := examplesSpecText(4, aep.ResponseExamples)
+			if err != nil {
+				return "", err
+			}
+			s += "####  Response Examples:\n" + examples
+		}
 		s += "####  Response Possibilities:\n"
 		keys := make([]string, 0, len(aep.ResponsePossibilities))
 
@@ -117,6 +169,13 @@ func (aep *DXAPIEndPoint) PrintSpec() (s string, err error) {
 			for _, p := range v.DataTemplate {
 				s += p.PrintSpec(8)
 			}
+			if len(v.Examples) > 0 {
+				examples, err := examplesSpecText(8, v.Examples)
+				if err != nil {
+					return "", err
+				}
+				s += "      Examples:\n" + examples
+			}
 		}
 	case "PostmanCollection":
 		collection := map[string]any{
@@ -147,6 +206,11 @@ func (aep *DXAPIEndPoint) PrintSpec() (s string, err error) {
 			},
 		}
 
+		if aep.Deprecated {
+			request := collection["item"].([]map[string]any)[0]["request"].(map[string]any)
+			request["description"] = aep.deprecationSpecText() + "\n\n" + aep.Description
+		}
+
 		for _, param := range aep.Parameters {
 			rawBody := collection["item"].([]map[string]any)[0]["request"].(map[string]any)["body"].(map[string]any)["raw"].(string)
 			rawBody += fmt.Sprintf("%s: %s\n", param.NameId, param.Type)
@@ -162,6 +226,50 @@ func (aep *DXAPIEndPoint) PrintSpec() (s string, err error) {
 			})
 		}
 
+		// Each request example is an item of its own, with the body to send, the response examples are saved responses
+		for _, name := range sortedKeys(aep.RequestExamples) {
+			body, err := json.MarshalIndent(aep.RequestExamples[name], "", "  ")
+			if err != nil {
+				return "", err
+			}
+			collection["item"] = append(collection["item"].([]map[string]any), map[string]any{
+				"name": aep.Title + " (" + name + ")",
+				"request": map[string]any{
+					"method": aep.Method,
+					"url":    collection["item"].([]map[string]any)[0]["request"].(map[string]any)["url"],
+					"body": map[string]any{
+						"mode": "raw",
+						"raw":  string(body),
+					},
+				},
+			})
+		}
+		addResponseExamples := func(statusCode int, examples map[string]utils.JSON) error {
+			for _, name := range sortedKeys(examples) {
+				body, err := json.MarshalIndent(examples[name], "", "  ")
+				if err != nil {
+					return err
+				}
+				collection["item"].([]map[string]any)[0]["response"] = append(collection["item"].([]map[string]any)[0]["response"].([]map[string]any), map[string]any{
+					"name":   name,
+					"status": http.StatusText(statusCode),
+					"code":   statusCode,
+					"body":   string(body),
+				})
+			}
+			return nil
+		}
+		err = addResponseExamples(http.StatusOK, aep.ResponseExamples)
+		if err != nil {
+			return "", err
+		}
+		for _, k := range sortedKeys(aep.ResponsePossibilities) {
+			err = addResponseExamples(aep.ResponsePossibilities[k].StatusCode, aep.ResponsePossibilities[k].Examples)
+			if err != nil {
+				return "", err
+			}
+		}
+
 		collectionJSON, err := json.MarshalIndent(collection, "", "  ")
 		if err != nil {
 			return "", err
@@ -189,8 +297,11 @@ func (aep *DXAPIEndPoint) NewParameter(parent *DXAPIEndPointParameter, nameId, a
 }
 
 func (aep *DXAPIEndPoint) NewEndPointRequest(context context.Context, w http.ResponseWriter, r *http.Request) *DXAPIEndPointRequest {
+	databaseRouting := &database.DXDatabaseRouting{}
+	context = database.ContextWithRouting(context, databaseRouting)
 	er := &DXAPIEndPointRequest{
 		Context:         context,
+		databaseRouting: databaseRouting,
 		_responseWriter: &w,
 		Request:         r,
 		EndPoint:        aep,
@@ -199,6 +310,7 @@ func (aep *DXAPIEndPoint) NewEndPointRequest(context context.Context, w http.Res
 		SuppressLogDump: false,
 	}
 	er.Id = fmt.Sprintf("%p", er)
-	er.Log = log.NewLog(&aep.Owner.Log, context, aep.Title+" | "+er.Id)
+	requestLog := log.NewLog(&aep.Owner.Log, context, aep.Title+" | "+er.Id)
+	er.Log = requestLog.WithFields(log.DXLogFields{"request_id": er.Id, "route": aep.Uri, "method": r.Method})
 	return er
 }
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type DXAPICachePolicy struct {
+	MaxAgeSec      int
+	SMaxAgeSec     int
+	Public         bool
+	Private        bool
+	NoStore        bool
+	MustRevalidate bool
+}
+
+const DXAPICacheControlNoStore = "no-store"
+
+// String returns the Cache-Control value of the policy, "no-store" when nothing is declared
+func (cp *DXAPICachePolicy) String() string {
+	if cp == nil || cp.NoStore {
+		return DXAPICacheControlNoStore
+	}
+	var directives []string
+	if cp.Public {
+		directives = append(directives, "public")
+	}
+	if cp.Private {
+		directives = append(directives, "private")
+	}
+	directives = append(directives, "max-age="+strconv.Itoa(cp.MaxAgeSec))
+	if cp.SMaxAgeSec > 0 {
+		directives = append(directives, "s-maxage="+strconv.Itoa(cp.SMaxAgeSec))
+	}
+	if cp.MustRevalidate {
+		directives = append(directives, "must-revalidate")
+	}
+	return strings.Join(directives, ", ")
+}
+
+// ResponseSetNoCache overrides the endpoint CachePolicy for this response, for handlers returning sensitive data
+func (aepr *DXAPIEndPointRequest) ResponseSetNoCache() {
+	aepr.isResponseNoCache = true
+}
+
+// applyCachePolicy writes Cache-Control, error responses are never cacheable whatever the endpoint declares
+func (aepr *DXAPIEndPointRequest) applyCachePolicy(header http.Header, statusCode int) {
+	isSuccess := (200 <= statusCode && statusCode < 300) || statusCode == http.StatusNotModified
+	switch {
+	case !isSuccess || aepr.isResponseNoCache:
+		header.Set("Cache-Control", DXAPICacheControlNoStore)
+	case aepr.EndPoint != nil && aepr.EndPoint.CachePolicy != nil:
+		header.Set("Cache-Control", aepr.EndPoint.CachePolicy.String())
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+const (
+	DXAPIDebugDumpRedactedValue       = "***"
+	DXAPIDefaultDebugDumpMaxBodyBytes = 16 * 1024
+)
+
+var DXAPIDefaultDebugDumpRedactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}
+var DXAPIDefaultDebugDumpRedactedParameters = []string{"password", "token", "secret"}
+
+// SetDebugDump switches the request/response dump of this endpoint, it can be called while the API is running
+func (aep *DXAPIEndPoint) SetDebugDump(isEnabled bool) {
+	aep.debugDump.Store(isEnabled)
+}
+
+func (aep *DXAPIEndPoint) IsDebugDump() bool {
+	return aep.debugDump.Load()
+}
+
+func isNameInList(name string, list []string) bool {
+	for _, v := range list {
+		if strings.EqualFold(name, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *DXAPI) truncateDebugDump(b []byte) string {
+	maxBytes := a.DebugDumpMaxBodyBytes
+	if maxBytes <= 0 || len(b) <= maxBytes {
+		return string(b)
+	}
+	return fmt.Sprintf("%s... (TRUNCATED, %d of %d bytes shown)", string(b[:maxBytes]), maxBytes, len(b))
+}
+
+func (a *DXAPI) redactDebugDumpHeaders(header http.Header) http.Header {
+	r := header.Clone()
+	for k := range r {
+		if isNameInList(k, a.DebugDumpRedactedHeaders) {
+			r[k] = []string{DXAPIDebugDumpRedactedValue}
+		}
+	}
+	return r
+}
+
+func (a *DXAPI) redactDebugDumpParameters(v any) any {
+	switch t := v.(type) {
+	case utils.JSON:
+		r := utils.JSON{}
+		for k, child := range t {
+			if isNameInList(k, a.DebugDumpRedactedParameters) {
+				r[k] = DXAPIDebugDumpRedactedValue
+				continue
+			}
+			r[k] = a.redactDebugDumpParameters(child)
+		}
+		return r
+	case []any:
+		r := make([]any, len(t))
+		for i, child := range t {
+			r[i] = a.redactDebugDumpParameters(child)
+		}
+		return r
+	default:
+		return v
+	}
+}
+
+func (aepr *DXAPIEndPointRequest) debugDumpRequest() {
+	a := aepr.EndPoint.Owner
+	parameters, err := json.Marshal(a.redactDebugDumpParameters(aepr.GetParameterValues()))
+	if err != nil {
+		parameters = []byte(err.Error())
+	}
+	aepr.Log.Debugf("DEBUG_DUMP_REQUEST:%s %s\nHeaders: %v\nParameters: %s", aepr.Request.Method, aepr.Request.URL.Path,
+		a.redactDebugDumpHeaders(aepr.Request.Header), a.truncateDebugDump(parameters))
+}
+
+// debugDumpResponse includes LocalData when DebugDumpIsIncludeLocalData, dumped with the response since the middlewares filling
+// it run after the request is dumped, redacted like the parameters
+func (aepr *DXAPIEndPointRequest) debugDumpResponse(statusCode int, bodyAsBytes []byte) {
+	a := aepr.EndPoint.Owner
+	localData := ""
+	if a.DebugDumpIsIncludeLocalData {
+		b, err := json.Marshal(a.redactDebugDumpParameters(aepr.LocalData))
+		if err != nil {
+			b = []byte(err.Error())
+		}
+		localData = "\nLocal data: " + a.truncateDebugDump(b)
+	}
+	aepr.Log.Debugf("DEBUG_DUMP_RESPONSE:%d %s\nHeaders: %v\nBody: %s%s", statusCode, aepr.Request.URL.Path,
+		a.redactDebugDumpHeaders((*aepr.GetResponseWriter()).Header()), a.truncateDebugDump(bodyAsBytes), localData)
+}
+
+func (aepr *DXAPIEndPointRequest) isDebugDump() bool {
+	return aepr.EndPoint != nil && aepr.EndPoint.Owner != nil && aepr.EndPoint.IsDebugDump()
+}
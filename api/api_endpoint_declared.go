@@ -0,0 +1,235 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
+	utilsJSON "github.com/donnyhardyanto/dxlib/utils/json"
+)
+
+// The kinds of the endpoints declared in the "endpoints" of the configuration of an API
+const (
+	DXAPIDeclaredEndPointKindRedirect      = "redirect"
+	DXAPIDeclaredEndPointKindProxy         = "proxy"
+	DXAPIDeclaredEndPointKindStatic        = "static"
+	DXAPIDeclaredEndPointKindFixedResponse = "fixed_response"
+)
+
+// declaredResponseWriter keeps the status code written by the net/http handlers a declared endpoint delegates to
+type declaredResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (w *declaredResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *declaredResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *declaredResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// serveHTTP answers the request with handler, an http.Handler of net/http, and marks the response as sent
+func (aepr *DXAPIEndPointRequest) serveHTTP(handler http.Handler) {
+	w := &declaredResponseWriter{ResponseWriter: *aepr.GetResponseWriter()}
+	handler.ServeHTTP(w, aepr.Request)
+	aepr.ResponseStatusCode = w.statusCode
+	aepr.ResponseHeaderSent = true
+	aepr.ResponseBodySent = true
+}
+
+// noDirectoryListingFileSystem serves the files of a static endpoint, a directory without an index.html is not found
+type noDirectoryListingFileSystem struct {
+	http.FileSystem
+}
+
+func (s noDirectoryListingFileSystem) Open(name string) (http.File, error) {
+	f, err := s.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil || !stat.IsDir() {
+		return f, err
+	}
+	index, err := s.FileSystem.Open(path.Join(name, "index.html"))
+	if err != nil {
+		_ = f.Close()
+		return nil, fs.ErrNotExist
+	}
+	_ = index.Close()
+	return f, nil
+}
+
+// declareEndPointsFromConfiguration registers the endpoints of entries, the "endpoints" of the configuration of a. They are
+// endpoints like the ones of the code, with the same middlewares, access log and spec. A uri also defined by the code is
+// fatal, whichever is registered first.
+func (a *DXAPI) declareEndPointsFromConfiguration(entries []any) (err error) {
+	for i, v := range entries {
+		entry, ok := v.(utils.JSON)
+		if !ok {
+			return fmt.Errorf("endpoints/%d:NOT_AN_OBJECT", i)
+		}
+		err = a.declareEndPoint(entry)
+		if err != nil {
+			return fmt.Errorf("endpoints/%d:%w", i, err)
+		}
+	}
+	return nil
+}
+
+func (a *DXAPI) declareEndPoint(entry utils.JSON) (err error) {
+	uri, _ := entry["uri"].(string)
+	kind, _ := entry["kind"].(string)
+	method, _ := entry["method"].(string)
+	title, _ := entry["title"].(string)
+	description, _ := entry["description"].(string)
+	if uri == "" {
+		return errors.New("MANDATORY_URI_NOT_EXIST")
+	}
+	if method == "" {
+		method = http.MethodGet
+	}
+	method = strings.ToUpper(method)
+	if a.FindEndPointByURI(uri) != nil {
+		return fmt.Errorf("URI_ALREADY_DEFINED:%s", uri)
+	}
+	contentType := utilsHttp.ContentTypeNone
+	endPointType := EndPointTypeHTTPJSON
+	var onExecute DXAPIEndPointExecuteFunc
+
+	switch kind {
+	case DXAPIDeclaredEndPointKindRedirect:
+		target, _ := entry["target"].(string)
+		if target == "" {
+			return fmt.Errorf("MANDATORY_TARGET_NOT_EXIST:%s", uri)
+		}
+		statusCode, err := utilsJSON.GetNumberOrDefault(entry, "status", http.StatusFound)
+		if err != nil {
+			return err
+		}
+		if description == "" {
+			description = "Redirects to " + target
+		}
+		onExecute = func(aepr *DXAPIEndPointRequest) (err error) {
+			return aepr.ResponseRedirect(statusCode, target)
+		}
+	case DXAPIDeclaredEndPointKindProxy:
+		targetBaseUrl, _ := entry["target_base_url"].(string)
+		target, err := url.Parse(targetBaseUrl)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			return fmt.Errorf("INVALID_TARGET_BASE_URL:%s:%s", uri, targetBaseUrl)
+		}
+		if description == "" {
+			description = "Proxies to " + target.Redacted()
+		}
+		// The body is passed through as it is, not read by PreProcessRequest
+		contentType = utilsHttp.ContentTypeApplicationOctetStream
+		endPointType = EndPointTypeHTTPUploadStream
+		prefix := strings.TrimSuffix(uri, "/")
+		onExecute = func(aepr *DXAPIEndPointRequest) (err error) {
+			var errProxy error
+			proxy := &httputil.ReverseProxy{
+				Rewrite: func(r *httputil.ProxyRequest) {
+					r.SetURL(target)
+					r.Out.URL.Path = strings.TrimSuffix(target.Path, "/") + strings.TrimPrefix(r.In.URL.Path, prefix)
+					r.Out.URL.RawPath = ""
+					r.SetXForwarded()
+				},
+				ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+					errProxy = err
+					w.WriteHeader(http.StatusBadGateway)
+				},
+			}
+			aepr.serveHTTP(proxy)
+			if errProxy != nil {
+				return aepr.Log.WarnAndCreateErrorf("PROXY_ERROR:%s:%v", target.Redacted(), errProxy.Error())
+			}
+			return nil
+		}
+	case DXAPIDeclaredEndPointKindStatic:
+		rootDir, _ := entry["root_dir"].(string)
+		if rootDir == "" {
+			return fmt.Errorf("MANDATORY_ROOT_DIR_NOT_EXIST:%s", uri)
+		}
+		if description == "" {
+			description = "Files of " + rootDir
+		}
+		handler := http.StripPrefix(strings.TrimSuffix(uri, "/"), http.FileServer(noDirectoryListingFileSystem{http.Dir(rootDir)}))
+		onExecute = func(aepr *DXAPIEndPointRequest) (err error) {
+			aepr.serveHTTP(handler)
+			return nil
+		}
+	case DXAPIDeclaredEndPointKindFixedResponse:
+		statusCode, err := utilsJSON.GetNumberOrDefault(entry, "status", http.StatusOK)
+		if err != nil {
+			return err
+		}
+		responseContentType, _ := entry["content_type"].(string)
+		var body []byte
+		switch b := entry["body"].(type) {
+		case nil:
+		case string:
+			body = []byte(b)
+			if responseContentType == "" {
+				responseContentType = "text/plain; charset=utf-8"
+			}
+		default:
+			body, err = json.Marshal(b)
+			if err != nil {
+				return fmt.Errorf("INVALID_BODY:%s:%w", uri, err)
+			}
+			if responseContentType == "" {
+				responseContentType = "application/json"
+			}
+		}
+		if description == "" {
+			description = fmt.Sprintf("Answers %d", statusCode)
+		}
+		onExecute = func(aepr *DXAPIEndPointRequest) (err error) {
+			header := map[string]string{}
+			if responseContentType != "" {
+				header["Content-Type"] = responseContentType
+			}
+			aepr.WriteResponseAsBytes(statusCode, header, body)
+			return nil
+		}
+	default:
+		return fmt.Errorf("UNKNOWN_KIND:%s:%s", uri, kind)
+	}
+
+	if title == "" {
+		title = kind + " " + uri
+	}
+	var privileges []string
+	if p, ok := entry["privileges"].([]any); ok {
+		for _, v := range p {
+			s, isString := v.(string)
+			if isString {
+				privileges = append(privileges, s)
+			}
+		}
+	}
+	ae := a.NewEndPoint(title, description, uri, method, endPointType, contentType, nil, onExecute, nil, nil, nil, privileges)
+	ae.isDeclared = true
+	return nil
+}
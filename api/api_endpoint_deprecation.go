@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// DXAPIDeprecatedEndPointRequestHandler is called for each request reaching a deprecated endpoint, count is the total for that endpoint
+type DXAPIDeprecatedEndPointRequestHandler func(a *DXAPI, endPoint *DXAPIEndPoint, count int64)
+
+func (aep *DXAPIEndPoint) DeprecatedRequestCount() int64 {
+	return atomic.LoadInt64(&aep.deprecatedRequestCount)
+}
+
+func (aep *DXAPIEndPoint) IsSunsetPassed() bool {
+	return !aep.SunsetDate.IsZero() && !time.Now().Before(aep.SunsetDate)
+}
+
+func (aep *DXAPIEndPoint) deprecationSpecText() string {
+	s := "DEPRECATED"
+	if aep.DeprecationMessage != "" {
+		s += ": " + aep.DeprecationMessage
+	}
+	if !aep.SunsetDate.IsZero() {
+		s += " (sunset " + aep.SunsetDate.UTC().Format(time.RFC3339) + ")"
+	}
+	return s
+}
+
+// applyDeprecation writes the Deprecation and Sunset headers and counts the request. It returns true when the API answers
+// deprecated endpoints with 410 after their sunset date and that date has passed.
+func (a *DXAPI) applyDeprecation(w http.ResponseWriter, p *DXAPIEndPoint) (isGone bool) {
+	if !p.Deprecated {
+		return false
+	}
+	w.Header().Set("Deprecation", "true")
+	if !p.SunsetDate.IsZero() {
+		w.Header().Set("Sunset", p.SunsetDate.UTC().Format(http.TimeFormat))
+	}
+	count := atomic.AddInt64(&p.deprecatedRequestCount, 1)
+	if a.OnDeprecatedEndPointRequest != nil {
+		a.OnDeprecatedEndPointRequest(a, p, count)
+	}
+	return a.IsSunsetEndPointGone && p.IsSunsetPassed()
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// DXAPIMockResponseHeader names the example a request is answered with when the API IsMockMode, see ResponseExample
+const DXAPIMockResponseHeader = "X-Mock-Response"
+
+// WithRequestExample adds example, the parameters of a request as its JSON body would carry them, to the RequestExamples of
+// aep. The example is validated like a request against the Parameters of aep, an invalid one is fatal so a broken example
+// fails the start of the application instead of drifting.
+func (aep *DXAPIEndPoint) WithRequestExample(name string, example utils.JSON) *DXAPIEndPoint {
+	err := aep.validateRequestExample(example)
+	if err != nil {
+		log.Log.Fatalf("Invalid request example %s of endpoint %s (%s)", name, aep.Uri, err.Error())
+		// Only reached when Fatal does not exit, the example is left out
+		return aep
+	}
+	if aep.RequestExamples == nil {
+		aep.RequestExamples = map[string]utils.JSON{}
+	}
+	aep.RequestExamples[name] = example
+	return aep
+}
+
+// WithResponseExample adds example, a response body answered with 200, to the ResponseExamples of aep. The examples of the
+// other status codes go in the Examples of the ResponsePossibilities.
+func (aep *DXAPIEndPoint) WithResponseExample(name string, example utils.JSON) *DXAPIEndPoint {
+	if aep.ResponseExamples == nil {
+		aep.ResponseExamples = map[string]utils.JSON{}
+	}
+	aep.ResponseExamples[name] = example
+	return aep
+}
+
+// ResponseExample is the response example named name and its status code, from the ResponseExamples of aep or else from
+// the Examples of its ResponsePossibilities
+func (aep *DXAPIEndPoint) ResponseExample(name string) (statusCode int, example utils.JSON, isFound bool) {
+	example, isFound = aep.ResponseExamples[name]
+	if isFound {
+		return http.StatusOK, example, true
+	}
+	for _, k := range sortedKeys(aep.ResponsePossibilities) {
+		v := aep.ResponsePossibilities[k]
+		example, isFound = v.Examples[name]
+		if isFound {
+			return v.StatusCode, example, true
+		}
+	}
+	return 0, nil, false
+}
+
+// validateRequestExample runs example through the validation of a JSON request body, after a round trip through JSON so its
+// values have the types of a decoded body. A field that is not a parameter is refused too.
+func (aep *DXAPIEndPoint) validateRequestExample(example utils.JSON) (err error) {
+	b, err := json.Marshal(example)
+	if err != nil {
+		return err
+	}
+	body := utils.JSON{}
+	err = json.Unmarshal(b, &body)
+	if err != nil {
+		return err
+	}
+	aepr := &DXAPIEndPointRequest{
+		EndPoint:        aep,
+		ParameterValues: map[string]*DXAPIEndPointRequestParameterValue{},
+		LocalData:       map[string]any{},
+	}
+	if aep.Owner != nil {
+		aepr.Log = aep.Owner.Log
+	}
+	for k := range body {
+		isParameter := false
+		for _, v := range aep.Parameters {
+			if v.NameId == k {
+				isParameter = true
+				break
+			}
+		}
+		if !isParameter {
+			return fmt.Errorf("UNKNOWN_PARAMETER:%s", k)
+		}
+	}
+	for _, v := range aep.Parameters {
+		rpv := aepr.NewAPIEndPointRequestParameter(v)
+		rawValue, isPresent := body[v.NameId]
+		rpv.IsPresent = isPresent
+		err = rpv.SetRawValue(rawValue, v.NameId)
+		if err != nil {
+			return err
+		}
+		if rpv.Metadata.IsMustExist && rpv.RawValue == nil && !rpv.Metadata.IsNullable {
+			return fmt.Errorf("MANDATORY_PARAMETER_IS_NOT_EXIST:%s", v.NameId)
+		}
+		if rpv.RawValue != nil {
+			err = rpv.Validate()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// serveMockResponse answers the request with the response example named by its X-Mock-Response header, OnExecute is not run
+func (aepr *DXAPIEndPointRequest) serveMockResponse() (isServed bool, err error) {
+	name := aepr.Request.Header.Get(DXAPIMockResponseHeader)
+	if name == "" {
+		return false, nil
+	}
+	statusCode, example, isFound := aepr.EndPoint.ResponseExample(name)
+	if !isFound {
+		return true, aepr.WriteResponseAndNewErrorf(http.StatusNotFound, "MOCK_RESPONSE_NOT_FOUND:%s", name)
+	}
+	aepr.WriteResponseAsJSON(statusCode, map[string]string{DXAPIMockResponseHeader: name}, example)
+	return true, nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// examplesSpecText writes examples for the MarkDown spec, each named and indented by leftIndent
+func examplesSpecText(leftIndent int, examples map[string]utils.JSON) (s string, err error) {
+	indent := strings.Repeat(" ", leftIndent)
+	for _, name := range sortedKeys(examples) {
+		b, err := json.MarshalIndent(examples[name], indent+"  ", "  ")
+		if err != nil {
+			return "", err
+		}
+		s += fmt.Sprintf("%s%s:\n%s  %s\n", indent, name, indent, string(b))
+	}
+	return s, nil
+}
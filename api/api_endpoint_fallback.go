@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+const DXAPIFallbackEndPointTitleNotFound = "NOT_FOUND"
+
+// DefaultNotFoundHandler is installed by NewAPI as DXAPI.NotFoundHandler. It answers unknown paths with the standard error envelope.
+func DefaultNotFoundHandler(aepr *DXAPIEndPointRequest) (err error) {
+	return aepr.WriteResponseAsFallbackError(http.StatusNotFound, "NOT_FOUND:%s", aepr.Request.URL.Path)
+}
+
+// DefaultMethodNotAllowedHandler is installed by NewAPI as DXAPI.MethodNotAllowedHandler. It answers a known path called with the wrong method.
+func DefaultMethodNotAllowedHandler(aepr *DXAPIEndPointRequest) (err error) {
+	aepr.GetResponseHeader().Set("Allow", aepr.EndPoint.Method)
+	return aepr.WriteResponseAsFallbackError(http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED:%s!=%s", aepr.Request.Method, aepr.EndPoint.Method)
+}
+
+// WriteResponseAsFallbackError writes the standard error envelope and adds the request id, both in the body and in the X-Request-Id header.
+func (aepr *DXAPIEndPointRequest) WriteResponseAsFallbackError(statusCode int, msg string, data ...any) (err error) {
+	err = aepr.Log.WarnAndCreateErrorf(msg, data...)
+	aepr.WriteResponseAsJSON(statusCode, map[string]string{
+		"X-Request-Id": aepr.Id,
+	}, utils.JSON{
+		"status":         http.StatusText(statusCode),
+		"reason":         err.Error(),
+		"reason_message": err.Error(),
+		"request_id":     aepr.Id,
+	})
+	return err
+}
+
+func (a *DXAPI) newFallbackEndPoint(title string, onExecute DXAPIEndPointExecuteFunc) *DXAPIEndPoint {
+	return &DXAPIEndPoint{
+		Owner:        a,
+		Title:        title,
+		Uri:          "/",
+		EndPointType: EndPointTypeHTTPJSON,
+		OnExecute:    onExecute,
+		isFallback:   true,
+	}
+}
+
+func (a *DXAPI) executeMethodNotAllowed(aepr *DXAPIEndPointRequest) (err error) {
+	handler := a.MethodNotAllowedHandler
+	if handler == nil {
+		handler = DefaultMethodNotAllowedHandler
+	}
+	err = handler(aepr)
+	if err == nil {
+		// The request must not reach the endpoint even when a custom handler reports success
+		err = errors.New("METHOD_NOT_ALLOWED")
+	}
+	return err
+}
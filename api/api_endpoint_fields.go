@@ -0,0 +1,153 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// DXAPIFieldsParameterNameId is the query parameter of an endpoint WithFields listing the fields of the response, like
+// ?fields=id,name,customer.name
+const DXAPIFieldsParameterNameId = "fields"
+
+// FieldsParameter is the fields parameter of an endpoint allowing allowedFields, a field of a nested object written as its
+// dotted path
+func FieldsParameter(allowedFields []string) DXAPIEndPointParameter {
+	return DXAPIEndPointParameter{
+		NameId:      DXAPIFieldsParameterNameId,
+		Type:        "string",
+		Description: "Comma-separated fields of the response, every field when absent. Allowed: " + strings.Join(allowedFields, ", "),
+	}
+}
+
+// WithFields has aep take the fields parameter, its requests may then ask for a part of allowedFields only, see GetFields. An
+// allowed object allows each of its nested fields too.
+func (aep *DXAPIEndPoint) WithFields(allowedFields ...string) *DXAPIEndPoint {
+	aep.AllowedFields = allowedFields
+	for i, p := range aep.Parameters {
+		if p.NameId == DXAPIFieldsParameterNameId {
+			aep.Parameters[i] = FieldsParameter(allowedFields)
+			return aep
+		}
+	}
+	aep.Parameters = append(aep.Parameters, FieldsParameter(allowedFields))
+	return aep
+}
+
+func (aep *DXAPIEndPoint) isFieldAllowed(field string) bool {
+	for _, allowed := range aep.AllowedFields {
+		if field == allowed || strings.HasPrefix(field, allowed+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// GetFields is the fields asked for by the fields parameter, nil when absent. Fields not allowed by the endpoint are answered
+// with 422 listing them all.
+func (aepr *DXAPIEndPointRequest) GetFields() (fields []string, err error) {
+	isExist, s, err := aepr.GetParameterValueAsString(DXAPIFieldsParameterNameId)
+	if err != nil {
+		return nil, err
+	}
+	if !isExist || strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var notAllowedFields []string
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !aepr.EndPoint.isFieldAllowed(field) {
+			notAllowedFields = append(notAllowedFields, field)
+			continue
+		}
+		fields = append(fields, field)
+	}
+	if len(notAllowedFields) > 0 {
+		return nil, aepr.WriteResponseAndNewErrorf(http.StatusUnprocessableEntity, "FIELDS_NOT_ALLOWED:%s", strings.Join(notAllowedFields, ","))
+	}
+	return fields, nil
+}
+
+// FieldsShowFieldNames is the top-level fields of fields, the columns to select for them
+func FieldsShowFieldNames(fields []string) (showFieldNames []string) {
+	for _, field := range fields {
+		name, _, _ := strings.Cut(field, ".")
+		isListed := false
+		for _, v := range showFieldNames {
+			isListed = isListed || v == name
+		}
+		if !isListed {
+			showFieldNames = append(showFieldNames, name)
+		}
+	}
+	return showFieldNames
+}
+
+// FilterFields keeps of v, an object or an array of objects, the fields only, a nested one by its dotted path. A nil fields
+// keeps everything.
+func FilterFields(v any, fields []string) any {
+	if fields == nil {
+		return v
+	}
+	tree := map[string]any{}
+	for _, field := range fields {
+		node := tree
+		parts := strings.Split(field, ".")
+		for i, part := range parts {
+			child, isExist := node[part]
+			if i == len(parts)-1 {
+				// The whole field is kept, whatever nested field of it is listed too
+				node[part] = true
+				break
+			}
+			if isExist && child == true {
+				break
+			}
+			childNode, ok := child.(map[string]any)
+			if !ok {
+				childNode = map[string]any{}
+				node[part] = childNode
+			}
+			node = childNode
+		}
+	}
+	return filterFieldsByTree(v, tree)
+}
+
+func filterFieldsByTree(v any, tree map[string]any) any {
+	switch t := v.(type) {
+	case utils.JSON:
+		r := utils.JSON{}
+		for k, sub := range tree {
+			value, isExist := t[k]
+			if !isExist {
+				continue
+			}
+			subTree, ok := sub.(map[string]any)
+			if ok {
+				r[k] = filterFieldsByTree(value, subTree)
+			} else {
+				r[k] = value
+			}
+		}
+		return r
+	case []utils.JSON:
+		r := make([]utils.JSON, len(t))
+		for i, row := range t {
+			r[i] = filterFieldsByTree(row, tree).(utils.JSON)
+		}
+		return r
+	case []any:
+		r := make([]any, len(t))
+		for i, item := range t {
+			r[i] = filterFieldsByTree(item, tree)
+		}
+		return r
+	default:
+		return v
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/donnyhardyanto/dxlib/database"
 	"github.com/donnyhardyanto/dxlib/log"
 	"github.com/donnyhardyanto/dxlib/utils"
 	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
 	"io"
 	"net/http"
+	"os"
 	"strings"
 )
 
@@ -38,6 +40,19 @@ type DXAPIEndPointRequest struct {
 	ResponseHeaderSent bool
 	ResponseBodySent   bool
 	SuppressLogDump    bool
+	isResponseNoCache  bool
+	// onResponseWritten is called by WriteResponseAsBytes once the body is written, body must not be kept
+	onResponseWritten func(statusCode int, header http.Header, body []byte)
+	tx                *database.DXDatabaseTx
+	// isTxOfRequest marks tx as opened by NewTxMiddleware, ended by routeHandler instead of WithTx
+	isTxOfRequest bool
+	// requestBodySpool holds the body larger than RequestBodyMaxMemoryBytes, removed once the response is written
+	requestBodySpool *os.File
+	// tenantId is the tenant resolved by NewTenantMiddleware
+	tenantId string
+	// databaseRouting, in Context, routes the reads of the request between the primary and the read replicas
+	databaseRouting           *database.DXDatabaseRouting
+	isDatabasePinnedToPrimary bool
 }
 
 func (aepr *DXAPIEndPointRequest) GetParameterValues() (r utils.JSON) {
@@ -105,6 +120,10 @@ func (aepr *DXAPIEndPointRequest) GetResponseWriter() *http.ResponseWriter {
 	return aepr._responseWriter
 }
 
+func (aepr *DXAPIEndPointRequest) GetResponseHeader() http.Header {
+	return (*aepr._responseWriter).Header()
+}
+
 func (aepr *DXAPIEndPointRequest) WriteResponseAndNewErrorf(statusCode int, msg string, data ...any) (err error) {
 	err = aepr.Log.WarnAndCreateErrorf(msg, data...)
 	aepr.WriteResponseAsError(statusCode, err)
@@ -124,14 +143,21 @@ func (aepr *DXAPIEndPointRequest) WriteResponseAsError(statusCode int, errToSend
 	}
 	var s utils.JSON
 
+	code, message, messageLang := aepr.localizedErrorMessage(errToSend)
 	//	if dxlib.IsDebug {
 	s = utils.JSON{
 		"status":         http.StatusText(statusCode),
+		"code":           code,
 		"reason":         errToSend.Error(),
-		"reason_message": errToSend.Error(),
+		"reason_message": message,
 	}
 	//	}
 
+	if messageLang != "" {
+		responseHeader := aepr.GetResponseHeader()
+		responseHeader.Set("Content-Language", messageLang)
+		responseHeader.Add("Vary", "Accept-Language")
+	}
 	aepr.WriteResponseAsJSON(statusCode, nil, s)
 }
 
@@ -140,24 +166,25 @@ func (aepr *DXAPIEndPointRequest) WriteResponseAsJSON(statusCode int, header map
 		_ = aepr.Log.WarnAndCreateErrorf("SHOULD_NOT_HAPPEN:RESPONSE_HEADER_ALREADY_SENT")
 		return
 	}
-	var jsonBytes []byte
-	var err error
 	if bodyAsJSON == nil {
 		bodyAsJSON = utils.JSON{}
 	}
 	if bodyAsJSON["status"] == nil {
 		bodyAsJSON["status"] = http.StatusText(statusCode)
 	}
-	jsonBytes, err = json.Marshal(bodyAsJSON)
+	b, err := marshalToResponseBuffer(bodyAsJSON)
 	if err != nil {
 		_ = aepr.Log.WarnAndCreateErrorf("SHOULD_NOT_HAPPEN:ERROR_AT_MARSHAL_JSON=%s", err.Error())
 		return
 	}
+	// WriteResponseAsBytes is done with the bytes when it returns
+	defer releaseResponseBuffer(b)
 	if header == nil {
-		header = map[string]string{}
+		(*aepr.GetResponseWriter()).Header().Set("Content-Type", "application/json")
+	} else {
+		header["Content-Type"] = "application/json"
 	}
-	header["Content-Type"] = "application/json"
-	aepr.WriteResponseAsBytes(statusCode, header, jsonBytes)
+	aepr.WriteResponseAsBytes(statusCode, header, b.Bytes())
 	return
 }
 
@@ -170,6 +197,19 @@ func (aepr *DXAPIEndPointRequest) WriteResponseAsBytes(statusCode int, header ma
 	for k, v := range header {
 		responseWriter.Header().Set(k, v)
 	}
+	aepr.applyCachePolicy(responseWriter.Header(), statusCode)
+	if statusCode == http.StatusOK && aepr.EndPoint != nil && aepr.EndPoint.Cacheable {
+		if responseWriter.Header().Get("ETag") == "" && responseWriter.Header().Get("Last-Modified") == "" {
+			responseWriter.Header().Set("ETag", computeStrongETag(bodyAsBytes))
+		}
+		if aepr.isNotModified() {
+			aepr.writeResponseNotModified()
+			return
+		}
+	}
+	if aepr.isDebugDump() {
+		aepr.debugDumpResponse(statusCode, bodyAsBytes)
+	}
 	responseWriter.WriteHeader(statusCode)
 	aepr.ResponseStatusCode = statusCode
 
@@ -184,6 +224,9 @@ func (aepr *DXAPIEndPointRequest) WriteResponseAsBytes(statusCode int, header ma
 		return
 	}
 	aepr.ResponseBodySent = true
+	if aepr.onResponseWritten != nil {
+		aepr.onResponseWritten(statusCode, responseWriter.Header(), bodyAsBytes)
+	}
 	if statusCode != http.StatusOK {
 		if bodyAsBytes != nil {
 			aepr._responseErrorAsString = ""
@@ -206,7 +249,7 @@ func (aepr *DXAPIEndPointRequest) PreProcessRequest() (err error) {
 			aepr.WriteResponseAsBytes(http.StatusOK, nil, []byte(``))
 			return nil
 		}
-		return aepr.WriteResponseAndNewErrorf(http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED:%s!=%s", aepr.Request.Method, aepr.EndPoint.Method)
+		return aepr.EndPoint.Owner.executeMethodNotAllowed(aepr)
 	}
 	xVar := aepr.Request.Header.Get("X-Var")
 	var xVarJSON map[string]interface{}
@@ -219,7 +262,9 @@ func (aepr *DXAPIEndPointRequest) PreProcessRequest() (err error) {
 			rpv := aepr.NewAPIEndPointRequestParameter(v)
 			aepr.ParameterValues[v.NameId] = rpv
 			variablePath := v.NameId
-			err := rpv.SetRawValue(xVarJSON[v.NameId], variablePath)
+			rawValue, isPresent := xVarJSON[v.NameId]
+			rpv.IsPresent = isPresent
+			err := rpv.SetRawValue(rawValue, variablePath)
 			if err != nil {
 				return aepr.WriteResponseAndNewErrorf(http.StatusUnprocessableEntity, err.Error())
 			}
@@ -228,12 +273,19 @@ func (aepr *DXAPIEndPointRequest) PreProcessRequest() (err error) {
 	switch aepr.EndPoint.Method {
 	case "GET", "DELETE":
 		for _, v := range aepr.EndPoint.Parameters {
-			rpv := aepr.NewAPIEndPointRequestParameter(v)
-			aepr.ParameterValues[v.NameId] = rpv
 			variablePath := v.NameId
-			err := rpv.SetRawValue(aepr.Request.FormValue(v.NameId), variablePath)
-			if err != nil {
-				return aepr.WriteResponseAndNewErrorf(http.StatusUnprocessableEntity, err.Error())
+			formValue := aepr.Request.FormValue(v.NameId)
+			_, isInForm := aepr.Request.Form[v.NameId]
+			// A typed value of the X-Var header is kept unless the query string has the parameter too
+			rpv, isInXVar := aepr.ParameterValues[v.NameId]
+			if !isInXVar || !rpv.IsPresent || isInForm {
+				rpv = aepr.NewAPIEndPointRequestParameter(v)
+				aepr.ParameterValues[v.NameId] = rpv
+				err := rpv.SetRawValue(formValue, variablePath)
+				rpv.IsPresent = isInForm
+				if err != nil {
+					return aepr.WriteResponseAndNewErrorf(http.StatusUnprocessableEntity, err.Error())
+				}
 			}
 			if rpv.Metadata.IsMustExist {
 				if rpv.RawValue == nil {
@@ -286,7 +338,7 @@ func (aepr *DXAPIEndPointRequest) preProcessRequestAsApplicationOctetStream() (e
 	case EndPointTypeHTTPUploadStream:
 		return nil
 	default:
-		aepr.RequestBodyAsBytes, err = io.ReadAll(aepr.Request.Body)
+		err = aepr.retainRequestBody(-1)
 		if err != nil {
 			return aepr.WriteResponseAndNewErrorf(http.StatusUnprocessableEntity, "ERROR_READING_REQUEST_BODY: %v", err.Error())
 		}
@@ -302,12 +354,17 @@ func (aepr *DXAPIEndPointRequest) preProcessRequestAsApplicationJSON() (err erro
 		}
 	}
 	bodyAsJSON := utils.JSON{}
-	aepr.RequestBodyAsBytes, err = io.ReadAll(aepr.Request.Body)
+	err = aepr.retainRequestBody(int64(aepr.EndPoint.Owner.RequestBodyMaxMemoryBytes))
 	if err != nil {
 		return aepr.WriteResponseAndNewErrorf(http.StatusUnprocessableEntity, `REQUEST_BODY_CANT_BE_READ:%v=%v`, err.Error(), aepr.RequestBodyAsBytes)
 	}
 
-	if len(aepr.RequestBodyAsBytes) > 0 {
+	if aepr.requestBodySpool != nil {
+		err = json.NewDecoder(aepr.requestBodySpool).Decode(&bodyAsJSON)
+		if err != nil {
+			return aepr.WriteResponseAndNewErrorf(http.StatusUnprocessableEntity, `REQUEST_BODY_CANT_BE_PARSED_AS_JSON:%v`, err.Error())
+		}
+	} else if len(aepr.RequestBodyAsBytes) > 0 {
 		err = json.Unmarshal(aepr.RequestBodyAsBytes, &bodyAsJSON)
 		if err != nil {
 			return aepr.WriteResponseAndNewErrorf(http.StatusUnprocessableEntity, `REQUEST_BODY_CANT_BE_PARSED_AS_JSON:%v`, err.Error()+"="+string(aepr.RequestBodyAsBytes))
@@ -318,7 +375,9 @@ func (aepr *DXAPIEndPointRequest) preProcessRequestAsApplicationJSON() (err erro
 		rpv := aepr.NewAPIEndPointRequestParameter(v)
 		aepr.ParameterValues[v.NameId] = rpv
 		variablePath := v.NameId
-		err := rpv.SetRawValue(bodyAsJSON[v.NameId], variablePath)
+		rawValue, isPresent := bodyAsJSON[v.NameId]
+		rpv.IsPresent = isPresent
+		err := rpv.SetRawValue(rawValue, variablePath)
 		if err != nil {
 			return aepr.WriteResponseAndNewErrorf(http.StatusUnprocessableEntity, err.Error())
 		}
@@ -339,3 +398,15 @@ func (aepr *DXAPIEndPointRequest) preProcessRequestAsApplicationJSON() (err erro
 	}
 	return nil
 }
+
+// AuditMeta is the context of the request for the audit records of the writes it makes, pass it with database.WithAuditMeta
+func (aepr *DXAPIEndPointRequest) AuditMeta() utils.JSON {
+	return utils.JSON{
+		"request_id":   aepr.Id,
+		"user_id":      aepr.CurrentUser.Id,
+		"user_loginid": aepr.CurrentUser.LoginId,
+		"ip_address":   GetIPAddress(aepr.Request),
+		"method":       aepr.Request.Method,
+		"route":        aepr.EndPoint.Uri,
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// ErrClientGone is returned by WaitForEvent when the client closed the connection, routeHandler logs it at Debug level only
+var ErrClientGone = errors.New("CLIENT_GONE")
+
+// GetContext returns the request context. It is cancelled when the client disconnects, when the handler returns and on a
+// forced API shutdown, so database calls made with it stop by themselves.
+func (aepr *DXAPIEndPointRequest) GetContext() context.Context {
+	if aepr.Context != nil {
+		return aepr.Context
+	}
+	return aepr.Request.Context()
+}
+
+func (aepr *DXAPIEndPointRequest) IsClientGone() bool {
+	return aepr.Request.Context().Err() != nil
+}
+
+// WaitForEvent is the long-poll primitive: it returns the first event of ch, isTimeout true when nothing arrived within timeout
+// (answer it with 204), or ErrClientGone as soon as the client disconnects.
+func (aepr *DXAPIEndPointRequest) WaitForEvent(ch <-chan utils.JSON, timeout time.Duration) (event utils.JSON, isTimeout bool, err error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case event = <-ch:
+		return event, false, nil
+	case <-timer.C:
+		return nil, true, nil
+	case <-aepr.Request.Context().Done():
+		return nil, false, ErrClientGone
+	case <-aepr.GetContext().Done():
+		return nil, false, aepr.GetContext().Err()
+	}
+}
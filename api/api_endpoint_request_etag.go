@@ -0,0 +1,86 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func computeStrongETag(bodyAsBytes []byte) string {
+	sum := sha256.Sum256(bodyAsBytes)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// SetResponseETag sets an explicit ETag, so a Cacheable endpoint does not hash the body. A value without quotes is quoted.
+func (aepr *DXAPIEndPointRequest) SetResponseETag(etag string) {
+	if !strings.HasSuffix(etag, `"`) {
+		etag = `"` + etag + `"`
+	}
+	aepr.GetResponseHeader().Set("ETag", etag)
+}
+
+func (aepr *DXAPIEndPointRequest) SetResponseLastModified(t time.Time) {
+	aepr.GetResponseHeader().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+}
+
+func isETagInIfNoneMatch(ifNoneMatch string, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	// If-None-Match uses the weak comparison, W/"x" matches "x"
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotModified evaluates If-None-Match against the ETag header, or when the client sent none, If-Modified-Since against Last-Modified
+func (aepr *DXAPIEndPointRequest) isNotModified() bool {
+	r := aepr.Request
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	header := aepr.GetResponseHeader()
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch != "" {
+		etag := header.Get("ETag")
+		return etag != "" && isETagInIfNoneMatch(ifNoneMatch, etag)
+	}
+	ifModifiedSince, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(ifModifiedSince)
+}
+
+func (aepr *DXAPIEndPointRequest) writeResponseNotModified() {
+	responseWriter := *aepr.GetResponseWriter()
+	header := responseWriter.Header()
+	// A 304 never carries a body, so the headers describing one must not be sent either
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	responseWriter.WriteHeader(http.StatusNotModified)
+	aepr.ResponseStatusCode = http.StatusNotModified
+	aepr.ResponseHeaderSent = true
+	aepr.ResponseBodySent = true
+}
+
+// WriteResponseIfNotModified answers 304 and returns true when the validators set with SetResponseETag or SetResponseLastModified
+// match the conditional request headers. It lets a handler skip building a payload the client already has.
+func (aepr *DXAPIEndPointRequest) WriteResponseIfNotModified() bool {
+	if aepr.ResponseHeaderSent || !aepr.isNotModified() {
+		return false
+	}
+	aepr.applyCachePolicy(aepr.GetResponseHeader(), http.StatusNotModified)
+	aepr.writeResponseNotModified()
+	return true
+}
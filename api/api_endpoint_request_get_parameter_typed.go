@@ -0,0 +1,195 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+	json2 "github.com/donnyhardyanto/dxlib/utils/json"
+)
+
+const (
+	DXAPIParameterErrorCodeRequired     = "REQUIRED"
+	DXAPIParameterErrorCodeInvalidType  = "INVALID_TYPE"
+	DXAPIParameterErrorCodeInvalidValue = "INVALID_VALUE"
+	DXAPIParameterErrorCodeOutOfRange   = "OUT_OF_RANGE"
+
+	DXAPIDefaultDecimalMaxScale = 2
+)
+
+// DXAPIParameterError is returned by the typed parameter getters. A handler returning it (as is or wrapped) gets a 422 response
+// naming the field.
+type DXAPIParameterError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+func (e *DXAPIParameterError) Error() string {
+	return fmt.Sprintf("REQUEST_FIELD_%s:%s:%s", e.Code, e.Field, e.Message)
+}
+
+func newParameterError(field string, code string, format string, v ...any) *DXAPIParameterError {
+	return &DXAPIParameterError{Field: field, Code: code, Message: fmt.Sprintf(format, v...)}
+}
+
+var uuidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+var decimalRegex = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.([0-9]+))?$`)
+
+// getParameterRawValue returns the parsed value of the parameter without writing any response, ok is false when it is absent or null
+func (aepr *DXAPIEndPointRequest) getParameterRawValue(name string) (v any, ok bool) {
+	entry, isExist := aepr.ParameterValues[name]
+	if !isExist || entry == nil || entry.Value == nil {
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+func (aepr *DXAPIEndPointRequest) GetParameterAsTimeOptional(name string, layouts ...string) (val time.Time, ok bool, err error) {
+	v, ok := aepr.getParameterRawValue(name)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	switch t := v.(type) {
+	case time.Time:
+		return t, true, nil
+	case string:
+		if len(layouts) == 0 {
+			val, err = json2.ParseTime(t)
+			if err != nil {
+				return time.Time{}, true, newParameterError(name, DXAPIParameterErrorCodeInvalidValue, "%q is not an RFC3339 time", t)
+			}
+			return val, true, nil
+		}
+		for _, layout := range layouts {
+			val, err = time.Parse(layout, t)
+			if err == nil {
+				return val, true, nil
+			}
+		}
+		return time.Time{}, true, newParameterError(name, DXAPIParameterErrorCodeInvalidValue, "%q does not match %s", t, strings.Join(layouts, " or "))
+	default:
+		return time.Time{}, true, newParameterError(name, DXAPIParameterErrorCodeInvalidType, "expected a time string, got %T", v)
+	}
+}
+
+func (aepr *DXAPIEndPointRequest) GetParameterAsTime(name string, layouts ...string) (val time.Time, err error) {
+	val, ok, err := aepr.GetParameterAsTimeOptional(name, layouts...)
+	if err == nil && !ok {
+		err = newParameterError(name, DXAPIParameterErrorCodeRequired, "is required")
+	}
+	return val, err
+}
+
+func (aepr *DXAPIEndPointRequest) GetParameterAsUUIDOptional(name string) (val string, ok bool, err error) {
+	v, ok := aepr.getParameterRawValue(name)
+	if !ok {
+		return "", false, nil
+	}
+	s, isString := v.(string)
+	if !isString {
+		return "", true, newParameterError(name, DXAPIParameterErrorCodeInvalidType, "expected a UUID string, got %T", v)
+	}
+	if !uuidRegex.MatchString(s) {
+		return "", true, newParameterError(name, DXAPIParameterErrorCodeInvalidValue, "%q is not a UUID", s)
+	}
+	return strings.ToLower(s), true, nil
+}
+
+func (aepr *DXAPIEndPointRequest) GetParameterAsUUID(name string) (val string, err error) {
+	val, ok, err := aepr.GetParameterAsUUIDOptional(name)
+	if err == nil && !ok {
+		err = newParameterError(name, DXAPIParameterErrorCodeRequired, "is required")
+	}
+	return val, err
+}
+
+// GetParameterAsDecimalStringOptional returns a currency amount as its exact decimal text, so it never goes through a float.
+// maxScale is the maximum count of fraction digits, DXAPIDefaultDecimalMaxScale when not given.
+func (aepr *DXAPIEndPointRequest) GetParameterAsDecimalStringOptional(name string, maxScale ...int) (val string, ok bool, err error) {
+	v, ok := aepr.getParameterRawValue(name)
+	if !ok {
+		return "", false, nil
+	}
+	var s string
+	switch t := v.(type) {
+	case string:
+		s = strings.TrimSpace(t)
+	case float64:
+		s = strconv.FormatFloat(t, 'f', -1, 64)
+	case int64:
+		s = strconv.FormatInt(t, 10)
+	default:
+		return "", true, newParameterError(name, DXAPIParameterErrorCodeInvalidType, "expected a decimal, got %T", v)
+	}
+	m := decimalRegex.FindStringSubmatch(s)
+	if m == nil {
+		return "", true, newParameterError(name, DXAPIParameterErrorCodeInvalidValue, "%q is not a decimal", s)
+	}
+	scale := DXAPIDefaultDecimalMaxScale
+	if len(maxScale) > 0 {
+		scale = maxScale[0]
+	}
+	if len(m[3]) > scale {
+		return "", true, newParameterError(name, DXAPIParameterErrorCodeInvalidValue, "%q has more than %d decimal digit(s)", s, scale)
+	}
+	return s, true, nil
+}
+
+func (aepr *DXAPIEndPointRequest) GetParameterAsDecimalString(name string, maxScale ...int) (val string, err error) {
+	val, ok, err := aepr.GetParameterAsDecimalStringOptional(name, maxScale...)
+	if err == nil && !ok {
+		err = newParameterError(name, DXAPIParameterErrorCodeRequired, "is required")
+	}
+	return val, err
+}
+
+func (aepr *DXAPIEndPointRequest) GetParameterAsInt64InRangeOptional(name string, min, max int64) (val int64, ok bool, err error) {
+	v, ok := aepr.getParameterRawValue(name)
+	if !ok {
+		return 0, false, nil
+	}
+	switch t := v.(type) {
+	case int64:
+		val = t
+	case float64:
+		if t != math.Trunc(t) || t < math.MinInt64 || t >= math.MaxInt64 {
+			return 0, true, newParameterError(name, DXAPIParameterErrorCodeInvalidValue, "%v is not an integer", t)
+		}
+		val = int64(t)
+	case string:
+		val, err = strconv.ParseInt(strings.TrimSpace(t), 10, 64)
+		if err != nil {
+			return 0, true, newParameterError(name, DXAPIParameterErrorCodeInvalidValue, "%q is not an integer", t)
+		}
+	default:
+		return 0, true, newParameterError(name, DXAPIParameterErrorCodeInvalidType, "expected an integer, got %T", v)
+	}
+	if val < min || val > max {
+		return 0, true, newParameterError(name, DXAPIParameterErrorCodeOutOfRange, "%d is not in [%d, %d]", val, min, max)
+	}
+	return val, true, nil
+}
+
+func (aepr *DXAPIEndPointRequest) GetParameterAsInt64InRange(name string, min, max int64) (val int64, err error) {
+	val, ok, err := aepr.GetParameterAsInt64InRangeOptional(name, min, max)
+	if err == nil && !ok {
+		err = newParameterError(name, DXAPIParameterErrorCodeRequired, "is required")
+	}
+	return val, err
+}
+
+func (aepr *DXAPIEndPointRequest) WriteResponseAsParameterError(parameterError *DXAPIParameterError) {
+	aepr.WriteResponseAsJSON(http.StatusUnprocessableEntity, nil, utils.JSON{
+		"status":         http.StatusText(http.StatusUnprocessableEntity),
+		"reason":         parameterError.Error(),
+		"reason_message": parameterError.Error(),
+		"field":          parameterError.Field,
+		"code":           parameterError.Code,
+	})
+}
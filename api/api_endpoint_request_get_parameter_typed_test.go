@@ -0,0 +1,40 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// A float64 is an int64 only when it is an integer within its range, 2^63 is not even though it compares equal to MaxInt64
+func TestGetParameterAsInt64InRangeOptionalOfAFloat(t *testing.T) {
+	for _, tc := range []struct {
+		value    float64
+		want     int64
+		wantCode string
+	}{
+		{value: 42, want: 42},
+		{value: -42, want: -42},
+		{value: math.MinInt64, want: math.MinInt64},
+		{value: 1.5, wantCode: DXAPIParameterErrorCodeInvalidValue},
+		{value: math.Exp2(63), wantCode: DXAPIParameterErrorCodeInvalidValue},
+		{value: 1e19, wantCode: DXAPIParameterErrorCodeInvalidValue},
+		{value: -1e19, wantCode: DXAPIParameterErrorCodeInvalidValue},
+	} {
+		aepr := &DXAPIEndPointRequest{ParameterValues: map[string]*DXAPIEndPointRequestParameterValue{"n": {Value: tc.value}}}
+		val, ok, err := aepr.GetParameterAsInt64InRangeOptional("n", math.MinInt64, math.MaxInt64)
+		if !ok {
+			t.Fatalf("%v is reported absent", tc.value)
+		}
+		var parameterError *DXAPIParameterError
+		if tc.wantCode != "" {
+			if !errors.As(err, &parameterError) || parameterError.Code != tc.wantCode {
+				t.Fatalf("%v gives %d, %v", tc.value, val, err)
+			}
+			continue
+		}
+		if err != nil || val != tc.want {
+			t.Fatalf("%v gives %d, %v", tc.value, val, err)
+		}
+	}
+}
@@ -15,6 +15,18 @@ func (aepr *DXAPIEndPointRequest) GetParameterValueEntry(k string) (val *DXAPIEn
 	return val, nil
 }
 
+// IsParameterPresent tells whether the request carried the parameter, even with a null value
+func (aepr *DXAPIEndPointRequest) IsParameterPresent(k string) bool {
+	entry, ok := aepr.ParameterValues[k]
+	return ok && entry != nil && entry.IsPresent
+}
+
+// IsParameterNull tells whether the request carried the parameter with an explicit null
+func (aepr *DXAPIEndPointRequest) IsParameterNull(k string) bool {
+	entry, ok := aepr.ParameterValues[k]
+	return ok && entry != nil && entry.IsPresent && entry.RawValue == nil
+}
+
 func (aepr *DXAPIEndPointRequest) AssignParameterNullableInt64(target *utils.JSON, key string) (isExist bool, v *int64, err error) {
 	isExist, v, err = aepr.GetParameterValueAsNullableInt64(key)
 	if err != nil {
@@ -26,6 +38,9 @@ func (aepr *DXAPIEndPointRequest) AssignParameterNullableInt64(target *utils.JSO
 		} else {
 			(*target)[key] = nil
 		}
+	} else if aepr.IsParameterNull(key) {
+		// An explicit null clears the field, an absent parameter leaves it untouched
+		(*target)[key] = nil
 	}
 	return isExist, v, nil
 }
@@ -41,6 +56,9 @@ func (aepr *DXAPIEndPointRequest) AssignParameterNullableString(target *utils.JS
 		} else {
 			(*target)[key] = nil
 		}
+	} else if aepr.IsParameterNull(key) {
+		// An explicit null clears the field, an absent parameter leaves it untouched
+		(*target)[key] = nil
 	}
 	return isExist, v, nil
 }
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// Set keeps value under key in LocalData for the rest of the request. It is the channel for a middleware to hand what it found,
+// like the claims of a token, the tenant or the feature flags, to the ones after it and to OnExecute. A value is dropped once
+// the response is written, it must not be kept elsewhere under the request.
+func (aepr *DXAPIEndPointRequest) Set(key string, value any) {
+	if aepr.LocalData == nil {
+		aepr.LocalData = map[string]any{}
+	}
+	aepr.LocalData[key] = value
+}
+
+// Get returns the value Set under key
+func (aepr *DXAPIEndPointRequest) Get(key string) (value any, isFound bool) {
+	value, isFound = aepr.LocalData[key]
+	return value, isFound
+}
+
+// GetString is Get of a string, isFound is false when key holds another type
+func (aepr *DXAPIEndPointRequest) GetString(key string) (value string, isFound bool) {
+	v, _ := aepr.Get(key)
+	value, isFound = v.(string)
+	return value, isFound
+}
+
+// GetInt64 is Get of an integer, any of the sized int types is converted
+func (aepr *DXAPIEndPointRequest) GetInt64(key string) (value int64, isFound bool) {
+	v, _ := aepr.Get(key)
+	switch t := v.(type) {
+	case int64:
+		return t, true
+	case int:
+		return int64(t), true
+	case int32:
+		return int64(t), true
+	case int16:
+		return int64(t), true
+	case int8:
+		return int64(t), true
+	default:
+		return 0, false
+	}
+}
+
+func (aepr *DXAPIEndPointRequest) GetJSON(key string) (value utils.JSON, isFound bool) {
+	v, _ := aepr.Get(key)
+	value, isFound = v.(utils.JSON)
+	return value, isFound
+}
+
+// releaseLocalData lets the values Set during the request be collected even while the request itself is still referenced
+func (aepr *DXAPIEndPointRequest) releaseLocalData() {
+	clear(aepr.LocalData)
+	aepr.LocalData = nil
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/utils"
+	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
+)
+
+// An edit endpoint of PATCH semantics, note is only updated when the request carries it, and cleared by an explicit null
+func TestNullAndMissingParametersFromRequestToUpdateStatement(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		body        string
+		wantStatus  int
+		wantPresent bool
+		wantNull    bool
+		// wantSet is the SET part of the update, empty when no update must run
+		wantSet  string
+		wantNote any
+	}{
+		{name: "absent", body: `{"id":1,"title":"t"}`, wantStatus: http.StatusOK, wantSet: `"title"=$1`},
+		{name: "explicit null", body: `{"id":1,"title":"t","note":null}`, wantStatus: http.StatusOK, wantPresent: true, wantNull: true,
+			wantSet: `"note"=$`, wantNote: nil},
+		{name: "value", body: `{"id":1,"title":"t","note":"n"}`, wantStatus: http.StatusOK, wantPresent: true, wantSet: `"note"=$`,
+			wantNote: "n"},
+		{name: "null of a mandatory parameter", body: `{"id":1,"title":null,"note":"n"}`, wantStatus: http.StatusUnprocessableEntity},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			database := dbtest.Open("postgres", nil)
+			defer func() {
+				_ = database.Close()
+			}()
+			var isPresent, isNull bool
+			am := newTestAPIManager()
+			a, _ := am.NewAPI("test")
+			ae := a.NewEndPoint("edit", "", "/edit", http.MethodPost, EndPointTypeHTTPJSON, utilsHttp.ContentTypeApplicationJSON,
+				[]DXAPIEndPointParameter{
+					{NameId: "id", Type: "int64", IsMustExist: true},
+					{NameId: "title", Type: "string", IsMustExist: true},
+					{NameId: "note", Type: "nullable-string", IsNullable: true},
+				},
+				func(aepr *DXAPIEndPointRequest) error {
+					isPresent, isNull = aepr.IsParameterPresent("note"), aepr.IsParameterNull("note")
+					_, id, err := aepr.GetParameterValueAsInt64("id")
+					if err != nil {
+						return err
+					}
+					_, title, err := aepr.GetParameterValueAsString("title")
+					if err != nil {
+						return err
+					}
+					set := utils.JSON{"title": title}
+					_, _, err = aepr.AssignParameterNullableString(&set, "note")
+					if err != nil {
+						return err
+					}
+					_, err = db.Update(database.DB, "item", set, utils.JSON{"id": id})
+					if err != nil {
+						return err
+					}
+					aepr.WriteResponseAsJSON(http.StatusOK, nil, nil)
+					return nil
+				}, nil, nil, nil, nil)
+
+			recorder := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/edit", strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", "application/json")
+			ae.ServeHTTP(recorder, r)
+			if recorder.Code != tc.wantStatus {
+				t.Fatalf("status %d: %s", recorder.Code, recorder.Body.String())
+			}
+			statements := database.Statements()
+			if tc.wantSet == "" {
+				if len(statements) != 0 {
+					t.Fatalf("statements %v", database.Queries())
+				}
+				return
+			}
+			if isPresent != tc.wantPresent || isNull != tc.wantNull {
+				t.Fatalf("IsParameterPresent %v, IsParameterNull %v", isPresent, isNull)
+			}
+			if len(statements) != 1 {
+				t.Fatalf("statements %v", database.Queries())
+			}
+			s := statements[0]
+			if !strings.HasPrefix(s.Query, `update "item" set `) || !strings.Contains(s.Query, tc.wantSet) {
+				t.Fatalf("statement %s", s.Query)
+			}
+			// The SET of note is bound by its position in the statement, the where binds the id last
+			hasNote := strings.Contains(s.Query, `"note"=`)
+			if hasNote != tc.wantPresent {
+				t.Fatalf("statement %s", s.Query)
+			}
+			if !hasNote {
+				if len(s.Args) != 2 {
+					t.Fatalf("args %v", s.Args)
+				}
+				return
+			}
+			if len(s.Args) != 3 {
+				t.Fatalf("args %v", s.Args)
+			}
+			notePosition := strings.Index(s.Query, `"note"=$`) + len(`"note"=$`)
+			note, _ := s.Arg(s.Query[notePosition : notePosition+1])
+			if note != tc.wantNote {
+				t.Fatalf("note bound to %v in %s %v", note, s.Query, s.Args)
+			}
+		})
+	}
+}
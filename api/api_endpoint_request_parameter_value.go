@@ -3,6 +3,7 @@ package api
 import (
 	"errors"
 	"github.com/donnyhardyanto/dxlib/utils"
+	json2 "github.com/donnyhardyanto/dxlib/utils/json"
 	security "github.com/donnyhardyanto/dxlib/utils/security"
 	"strings"
 	"time"
@@ -17,6 +18,8 @@ type DXAPIEndPointRequestParameterValue struct {
 	RawValue any
 	Metadata DXAPIEndPointParameter
 	Children map[string]*DXAPIEndPointRequestParameterValue
+	// IsPresent is set when the request carried the parameter, RawValue is then nil for an explicit null
+	IsPresent bool
 	//	ErrValidate error
 }
 
@@ -53,6 +56,7 @@ func (aeprpv *DXAPIEndPointRequestParameterValue) SetRawValue(rv any, variablePa
 						return aeprpv.Owner.Log.WarnAndCreateErrorf("MISSING_MANDATORY_FIELD:%s", aVariablePath)
 					}
 				} else {
+					childValue.IsPresent = true
 					err = childValue.SetRawValue(jv, aVariablePath)
 					if err != nil {
 						return err
@@ -122,6 +126,10 @@ func (aeprpv *DXAPIEndPointRequestParameterValue) Validate() (err error) {
 			if rawValueType != "string" {
 				return aeprpv.Owner.Log.WarnAndCreateErrorf(ErrorMessageIncompatibleTypeReceived, nameIdPath, aeprpv.Metadata.Type, rawValueType, aeprpv.RawValue)
 			}
+		case "duration":
+			if rawValueType != "string" && rawValueType != "float64" {
+				return aeprpv.Owner.Log.WarnAndCreateErrorf(ErrorMessageIncompatibleTypeReceived, nameIdPath, aeprpv.Metadata.Type, rawValueType, aeprpv.RawValue)
+			}
 		case "array":
 			if rawValueType != "[]interface {}" {
 				return aeprpv.Owner.Log.WarnAndCreateErrorf(ErrorMessageIncompatibleTypeReceived, nameIdPath, aeprpv.Metadata.Type, rawValueType, aeprpv.RawValue)
@@ -280,7 +288,7 @@ func (aeprpv *DXAPIEndPointRequestParameterValue) Validate() (err error) {
 		if strings.Contains(s, " ") {
 			s = strings.Replace(s, " ", "T", 1)
 		}
-		t, err := time.Parse(time.RFC3339Nano, s)
+		t, err := json2.ParseTime(s)
 		if err != nil {
 			return aeprpv.Owner.Log.WarnAndCreateErrorf("INVALID_RFC3339NANO_FORMAT:%s", s)
 		}
@@ -295,7 +303,7 @@ func (aeprpv *DXAPIEndPointRequestParameterValue) Validate() (err error) {
 		if !ok {
 			return aeprpv.Owner.Log.WarnAndCreateErrorf(ErrorMessageIncompatibleTypeReceived, nameIdPath, aeprpv.Metadata.Type, utils.TypeAsString(aeprpv.RawValue), aeprpv.RawValue)
 		}
-		t, err := time.Parse(time.DateOnly, s)
+		t, err := json2.ParseDate(s)
 		if err != nil {
 			return aeprpv.Owner.Log.WarnAndCreateErrorf("INVALID_DATE_FROMAT:%s=%s", nameIdPath, s)
 		}
@@ -316,6 +324,13 @@ func (aeprpv *DXAPIEndPointRequestParameterValue) Validate() (err error) {
 		}
 		aeprpv.Value = t
 		return nil
+	case "duration":
+		d, err := json2.ParseDuration(aeprpv.RawValue)
+		if err != nil {
+			return aeprpv.Owner.Log.WarnAndCreateErrorf("INVALID_DURATION_FORMAT:%s=%v", nameIdPath, aeprpv.RawValue)
+		}
+		aeprpv.Value = d
+		return nil
 	default:
 		aeprpv.Value = aeprpv.RawValue
 		return nil
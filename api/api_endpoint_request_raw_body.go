@@ -0,0 +1,92 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+)
+
+// DXAPIDefaultRequestBodyMaxMemoryBytes is how much of a request body is kept in memory, a larger one is spooled to a temp file
+const DXAPIDefaultRequestBodyMaxMemoryBytes = 1024 * 1024
+
+// requestBodyReader is r.Body, decoded when the request has Content-Encoding gzip
+func (aepr *DXAPIEndPointRequest) requestBodyReader() (r io.Reader, err error) {
+	switch strings.ToLower(strings.TrimSpace(aepr.Request.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return aepr.Request.Body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(aepr.Request.Body)
+	default:
+		return nil, aepr.Log.WarnAndCreateErrorf("REQUEST_CONTENT_ENCODING_NOT_SUPPORTED:%s", aepr.Request.Header.Get("Content-Encoding"))
+	}
+}
+
+// retainRequestBody reads the decoded body once, into RequestBodyAsBytes when it fits maxMemoryBytes, else into a temp file
+// removed by releaseRequestBody. maxMemoryBytes below zero keeps every body in memory.
+func (aepr *DXAPIEndPointRequest) retainRequestBody(maxMemoryBytes int64) (err error) {
+	r, err := aepr.requestBodyReader()
+	if err != nil {
+		return err
+	}
+	if maxMemoryBytes < 0 {
+		aepr.RequestBodyAsBytes, err = io.ReadAll(r)
+		return err
+	}
+	b, err := io.ReadAll(io.LimitReader(r, maxMemoryBytes+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(b)) <= maxMemoryBytes {
+		aepr.RequestBodyAsBytes = b
+		return nil
+	}
+	f, err := os.CreateTemp("", "dxlib-request-body-*")
+	if err != nil {
+		return err
+	}
+	aepr.requestBodySpool = f
+	_, err = f.Write(b)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err != nil {
+		return err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return err
+}
+
+// RawRequestBody returns the body as received, gzip decoded, nil when it was larger than RequestBodyMaxMemoryBytes of the API
+// and spooled to a temp file, see RawRequestBodyReader
+func (aepr *DXAPIEndPointRequest) RawRequestBody() []byte {
+	return aepr.RequestBodyAsBytes
+}
+
+// RawRequestBodyReader returns the body as received, gzip decoded, from its start, whether kept in memory or spooled. The
+// reader is valid until the response is written.
+func (aepr *DXAPIEndPointRequest) RawRequestBodyReader() (r io.ReadSeeker, err error) {
+	if aepr.requestBodySpool == nil {
+		return bytes.NewReader(aepr.RequestBodyAsBytes), nil
+	}
+	_, err = aepr.requestBodySpool.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	return aepr.requestBodySpool, nil
+}
+
+func (aepr *DXAPIEndPointRequest) releaseRequestBody() {
+	if aepr.requestBodySpool == nil {
+		return
+	}
+	name := aepr.requestBodySpool.Name()
+	_ = aepr.requestBodySpool.Close()
+	err := os.Remove(name)
+	if err != nil {
+		aepr.Log.Warnf("REQUEST_BODY_SPOOL_CANT_BE_REMOVED:%s:%v", name, err.Error())
+	}
+	aepr.requestBodySpool = nil
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+)
+
+// ResponseRedirect answers with a 3xx and Location, relative locations are resolved against the request path like http.Redirect
+// does. The response is marked as sent, so routeHandler does not write anything after it.
+func (aepr *DXAPIEndPointRequest) ResponseRedirect(statusCode int, location string) (err error) {
+	if statusCode < 300 || statusCode > 399 || statusCode == http.StatusNotModified {
+		return aepr.Log.ErrorAndCreateErrorf("SHOULD_NOT_HAPPEN:INVALID_REDIRECT_STATUS_CODE:%d", statusCode)
+	}
+	if location == "" {
+		return aepr.Log.ErrorAndCreateErrorf("SHOULD_NOT_HAPPEN:EMPTY_REDIRECT_LOCATION")
+	}
+	if aepr.ResponseHeaderSent {
+		return aepr.Log.WarnAndCreateErrorf("SHOULD_NOT_HAPPEN:RESPONSE_HEADER_ALREADY_SENT")
+	}
+	responseWriter := *aepr.GetResponseWriter()
+	aepr.applyCachePolicy(responseWriter.Header(), statusCode)
+	http.Redirect(responseWriter, aepr.Request, location, statusCode)
+	aepr.ResponseStatusCode = statusCode
+	aepr.ResponseHeaderSent = true
+	aepr.ResponseBodySent = true
+	return nil
+}
+
+func (aepr *DXAPIEndPointRequest) ResponseRedirectTemporary(location string) (err error) {
+	return aepr.ResponseRedirect(http.StatusFound, location)
+}
+
+func (aepr *DXAPIEndPointRequest) ResponseRedirectPermanent(location string) (err error) {
+	return aepr.ResponseRedirect(http.StatusMovedPermanently, location)
+}
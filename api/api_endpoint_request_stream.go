@@ -0,0 +1,58 @@
+package api
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+)
+
+// DXAPIResponseStreamBufferSize is the size of the chunks ResponseStream sends, the memory of a stream is bounded by it
+const DXAPIResponseStreamBufferSize = 32 * 1024
+
+type responseStreamWriter struct {
+	aepr *DXAPIEndPointRequest
+	w    http.ResponseWriter
+}
+
+func (s *responseStreamWriter) Write(p []byte) (n int, err error) {
+	if s.aepr.IsClientGone() {
+		return 0, ErrClientGone
+	}
+	n, err = s.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	flusher, ok := s.w.(http.Flusher)
+	if ok {
+		flusher.Flush()
+	}
+	return n, nil
+}
+
+// ResponseStream sends the header and statusCode then the body written by fn, in chunks of DXAPIResponseStreamBufferSize
+// as they fill, so a large body, like an export of db.ExportCSV from a DXDatabase.SelectCursor, is never held in memory. The
+// body has no Content-Length. An error of fn once the body started can only cut it short, the client sees a truncated body.
+func (aepr *DXAPIEndPointRequest) ResponseStream(statusCode int, header map[string]string, fn func(w io.Writer) error) (err error) {
+	if aepr.ResponseHeaderSent {
+		return aepr.Log.WarnAndCreateErrorf("SHOULD_NOT_HAPPEN:RESPONSE_HEADER_ALREADY_SENT")
+	}
+	responseWriter := *aepr.GetResponseWriter()
+	for k, v := range header {
+		responseWriter.Header().Set(k, v)
+	}
+	aepr.applyCachePolicy(responseWriter.Header(), statusCode)
+	responseWriter.WriteHeader(statusCode)
+	aepr.ResponseStatusCode = statusCode
+	aepr.ResponseHeaderSent = true
+
+	bw := bufio.NewWriterSize(&responseStreamWriter{aepr: aepr, w: responseWriter}, DXAPIResponseStreamBufferSize)
+	err = fn(bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	aepr.ResponseBodySent = true
+	if err != nil {
+		return aepr.Log.WarnAndCreateErrorf("RESPONSE_STREAM_CUT_SHORT:%v", err.Error())
+	}
+	return nil
+}
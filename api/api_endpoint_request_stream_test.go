@@ -0,0 +1,138 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database"
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
+)
+
+// countingResponseWriter counts the body instead of keeping it, a kept body would hide the memory of the stream
+type countingResponseWriter struct {
+	header  http.Header
+	status  int
+	size    int64
+	lines   int64
+	flushes int
+	last    []byte
+}
+
+func (w *countingResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *countingResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	w.size += int64(len(p))
+	w.lines += int64(bytes.Count(p, []byte("\n")))
+	w.last = append(w.last[:0], p[max(0, len(p)-512):]...)
+	return len(p), nil
+}
+
+func (w *countingResponseWriter) Flush() {
+	w.flushes++
+}
+
+func heapInUse() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// An export of 100k rows from SelectCursor through ResponseStream holds a bounded memory, far below the size of the body
+func TestExportOf100kRowsStreamsInBoundedMemory(t *testing.T) {
+	const rowCount = 100_000
+	const maxHeapGrowth = 8 << 20
+	payload := strings.Repeat("x", 200)
+	var maxHeap uint64
+	var baseline uint64
+	fake := dbtest.Open("postgres", func(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+		i := int64(0)
+		createdAt := time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC)
+		return dbtest.DXFakeResult{
+			Columns: []string{"id", "payload", "created_at"},
+			NextRow: func() (row []any, ok bool) {
+				if i == rowCount {
+					return nil, false
+				}
+				i++
+				if i%10_000 == 0 {
+					maxHeap = max(maxHeap, heapInUse())
+				}
+				return []any{i, payload, createdAt}, true
+			},
+		}
+	})
+	defer func() {
+		_ = fake.Close()
+	}()
+	d := &database.DXDatabase{NameId: "export", DatabaseType: database_type.PostgreSQL, Connection: fake.DB, Connected: true}
+
+	for _, format := range []string{"csv", "ndjson"} {
+		t.Run(format, func(t *testing.T) {
+			am := newTestAPIManager()
+			a, _ := am.NewAPI("test")
+			var exported int64
+			ae := a.NewEndPoint("export", "", "/export", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeApplicationJSON, nil,
+				func(aepr *DXAPIEndPointRequest) error {
+					rowsInfo, cursor, err := d.SelectCursor("item", []string{"id", "payload", "created_at"}, nil, map[string]string{"id": "asc"})
+					if err != nil {
+						return err
+					}
+					defer func() {
+						_ = cursor.Close()
+					}()
+					return aepr.ResponseStream(http.StatusOK, map[string]string{"Content-Type": "text/" + format}, func(w io.Writer) (err error) {
+						if format == "csv" {
+							exported, err = db.ExportCSV(w, rowsInfo, cursor.Next, db.CSVOptions{})
+						} else {
+							exported, err = db.ExportNDJSON(w, rowsInfo, cursor.Next, db.NDJSONOptions{})
+						}
+						return err
+					})
+				}, nil, nil, nil, nil)
+
+			w := &countingResponseWriter{header: http.Header{}}
+			maxHeap, baseline = 0, heapInUse()
+			ae.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export", nil))
+			if w.status != http.StatusOK || exported != rowCount {
+				t.Fatalf("status %d, %d rows exported", w.status, exported)
+			}
+			wantLines := int64(rowCount)
+			if format == "csv" {
+				wantLines++
+			}
+			if w.lines != wantLines {
+				t.Fatalf("%d lines, want %d", w.lines, wantLines)
+			}
+			if !bytes.Contains(w.last, []byte("100000")) {
+				t.Fatalf("the body ends with %q", w.last)
+			}
+			if w.size < 2*maxHeapGrowth {
+				t.Fatalf("a body of %d bytes proves nothing", w.size)
+			}
+			if w.flushes < int(w.size/DXAPIResponseStreamBufferSize) {
+				t.Fatalf("%d flushes for %d bytes", w.flushes, w.size)
+			}
+			t.Logf("%d bytes streamed, heap %d then at most %d", w.size, baseline, maxHeap)
+			if maxHeap > baseline && maxHeap-baseline > maxHeapGrowth {
+				t.Fatalf("the heap grew by %d bytes for a body of %d bytes", maxHeap-baseline, w.size)
+			}
+		})
+	}
+}
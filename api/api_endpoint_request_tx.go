@@ -0,0 +1,109 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/donnyhardyanto/dxlib/database"
+)
+
+// Tx returns the transaction of the request opened by NewTxMiddleware or WithTx, nil outside of one
+func (aepr *DXAPIEndPointRequest) Tx() *database.DXDatabaseTx {
+	return aepr.tx
+}
+
+func (aepr *DXAPIEndPointRequest) beginTx(d *database.DXDatabase, isolation sql.IsolationLevel) (err error) {
+	dtx, err := d.TransactionBegin(isolation)
+	if err != nil {
+		return err
+	}
+	dtx.Log = &aepr.Log
+	dtx.TenantId = aepr.tenantId
+	aepr.tx = dtx
+	return nil
+}
+
+// endTx commits the transaction of the request, or rolls it back when reason is not empty, and logs the outcome
+func (aepr *DXAPIEndPointRequest) endTx(reason string) (err error) {
+	dtx := aepr.tx
+	aepr.tx = nil
+	aepr.isTxOfRequest = false
+	if reason != "" {
+		err = dtx.Rollback()
+		if err != nil {
+			return err
+		}
+		aepr.Log.Warnf("REQUEST_TX_ROLLED_BACK:%s", reason)
+		return nil
+	}
+	err = dtx.Commit()
+	if err != nil {
+		return err
+	}
+	aepr.Log.Infof("REQUEST_TX_COMMITTED")
+	return nil
+}
+
+// WithTx calls fn in a transaction of d, committed when fn returns nil and rolled back when it fails or panics. Inside a
+// transaction of the request fn gets that one, which is then committed or rolled back with the request.
+func (aepr *DXAPIEndPointRequest) WithTx(d *database.DXDatabase, isolation sql.IsolationLevel, fn func(dtx *database.DXDatabaseTx) error) (err error) {
+	if aepr.tx != nil {
+		if aepr.tx.Database != d {
+			return aepr.Log.ErrorAndCreateErrorf("REQUEST_TX_ALREADY_OPEN_ON_OTHER_DATABASE:%s", aepr.tx.Database.NameId)
+		}
+		return fn(aepr.tx)
+	}
+	err = aepr.beginTx(d, isolation)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		rec := recover()
+		if rec != nil {
+			_ = aepr.endTx(fmt.Sprintf("PANIC:%v", rec))
+			panic(rec)
+		}
+		if err != nil {
+			_ = aepr.endTx(err.Error())
+			return
+		}
+		err = aepr.endTx("")
+	}()
+	return fn(aepr.tx)
+}
+
+// NewTxMiddleware returns an endpoint middleware opening a transaction of d for the request, handlers get it with aepr.Tx.
+// It is committed after the handler succeeded and rolled back on an error, a panic or a response status outside 2xx.
+func NewTxMiddleware(d *database.DXDatabase, isolation sql.IsolationLevel) DXAPIEndPointExecuteFunc {
+	return func(aepr *DXAPIEndPointRequest) (err error) {
+		if aepr.tx != nil {
+			return nil
+		}
+		err = aepr.beginTx(d, isolation)
+		if err != nil {
+			return err
+		}
+		aepr.isTxOfRequest = true
+		return nil
+	}
+}
+
+// finishRequestTx ends the transaction of NewTxMiddleware once the request is handled, routeHandler calls it last
+func (aepr *DXAPIEndPointRequest) finishRequestTx(err error, rec any) {
+	if aepr.tx == nil || !aepr.isTxOfRequest {
+		return
+	}
+	reason := ""
+	switch {
+	case rec != nil:
+		reason = fmt.Sprintf("PANIC:%v", rec)
+	case err != nil:
+		reason = err.Error()
+	case aepr.ResponseStatusCode < 200 || aepr.ResponseStatusCode >= 300:
+		reason = fmt.Sprintf("RESPONSE_STATUS:%d", aepr.ResponseStatusCode)
+	}
+	errEnd := aepr.endTx(reason)
+	if errEnd != nil {
+		aepr.Log.Errorf("REQUEST_TX_END_ERROR:%v", errEnd.Error())
+	}
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"context"
+	"net/http"
+)
+
+// DXAPIPanicHandler receives a panic recovered by routeHandler with the stack of the panicking goroutine
+type DXAPIPanicHandler func(recovered any, stack []byte)
+
+type dxAPIPanicHandlerContextKey struct{}
+
+// ContextWithPanicHandler makes routeHandler report the panics of the requests carrying ctx, the api/apitest package uses it to
+// turn them into test failures.
+func ContextWithPanicHandler(ctx context.Context, handler DXAPIPanicHandler) context.Context {
+	return context.WithValue(ctx, dxAPIPanicHandlerContextKey{}, handler)
+}
+
+func panicHandlerFromContext(ctx context.Context) DXAPIPanicHandler {
+	handler, _ := ctx.Value(dxAPIPanicHandlerContextKey{}).(DXAPIPanicHandler)
+	return handler
+}
+
+// ServeHTTP runs the request through the same path as the running server (tracing, limiter, preprocess, middlewares, OnExecute
+// and error mapping), without the API wide DXAPI.Use middlewares. The endpoint must belong to an API created by NewAPI.
+func (aep *DXAPIEndPoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	aep.Owner.routeHandler(w, r, aep)
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DXAPIDefaultLanguage is the DefaultLanguage of a new DXAPI
+const DXAPIDefaultLanguage = "en"
+
+// errorCodeRegexp matches the code an error message starts with, as in "NOT_FOUND:orders:12"
+var errorCodeRegexp = regexp.MustCompile(`^[A-Z][A-Z0-9_]*`)
+
+// dxAPIErrorMessages are the catalogs of the error messages of a DXAPI by language, and the codes found in none of them
+type dxAPIErrorMessages struct {
+	mutex             sync.RWMutex
+	catalogs          map[string]map[string]string
+	unregisteredCodes map[string]int64
+}
+
+// ErrorCode is the machine-readable code of err, the upper case word its message starts with, empty when it has none
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	s := err.Error()
+	code := errorCodeRegexp.FindString(s)
+	if len(code) < len(s) && s[len(code)] != ':' {
+		return ""
+	}
+	return code
+}
+
+// RegisterErrorMessages adds catalog, the messages of lang by error code, to the ones the error responses are written with. A
+// language registered before keeps its messages of the codes catalog does not have.
+func (a *DXAPI) RegisterErrorMessages(lang string, catalog map[string]string) {
+	lang = strings.ToLower(lang)
+	m := &a.errorMessages
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.catalogs == nil {
+		m.catalogs = map[string]map[string]string{}
+	}
+	c, ok := m.catalogs[lang]
+	if !ok {
+		c = map[string]string{}
+		m.catalogs[lang] = c
+	}
+	for code, message := range catalog {
+		c[code] = message
+	}
+}
+
+// ErrorMessage is the message of code in lang, or else in DefaultLanguage. A code in neither is counted in
+// UnregisteredErrorCodes, once any catalog is registered.
+func (a *DXAPI) ErrorMessage(lang string, code string) (message string, messageLang string, isFound bool) {
+	m := &a.errorMessages
+	m.mutex.RLock()
+	isCatalogRegistered := len(m.catalogs) > 0
+	for _, l := range []string{lang, strings.ToLower(a.DefaultLanguage)} {
+		message, isFound = m.catalogs[l][code]
+		if isFound {
+			m.mutex.RUnlock()
+			return message, l, true
+		}
+	}
+	m.mutex.RUnlock()
+	if code == "" || !isCatalogRegistered {
+		return "", "", false
+	}
+	m.mutex.Lock()
+	if m.unregisteredCodes == nil {
+		m.unregisteredCodes = map[string]int64{}
+	}
+	m.unregisteredCodes[code]++
+	m.mutex.Unlock()
+	return "", "", false
+}
+
+// UnregisteredErrorCodes is the count of the responses of each error code found in no catalog, for the translators
+func (a *DXAPI) UnregisteredErrorCodes() map[string]int64 {
+	m := &a.errorMessages
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	r := make(map[string]int64, len(m.unregisteredCodes))
+	for code, count := range m.unregisteredCodes {
+		r[code] = count
+	}
+	return r
+}
+
+// Language is the language of the Accept-Language of the request the API has a catalog of, the DefaultLanguage of the API
+// when there is none. A region, as in "id-ID", falls back to its language.
+func (aepr *DXAPIEndPointRequest) Language() string {
+	a := aepr.EndPoint.Owner
+	type acceptedLanguage struct {
+		tag string
+		q   float64
+	}
+	var accepted []acceptedLanguage
+	for _, part := range strings.Split(aepr.Request.Header.Get("Accept-Language"), ",") {
+		tag, parameters, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		v, isQ := strings.CutPrefix(strings.TrimSpace(parameters), "q=")
+		if isQ {
+			var err error
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if tag == "" || q <= 0 {
+			continue
+		}
+		accepted = append(accepted, acceptedLanguage{tag: strings.ToLower(tag), q: q})
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].q > accepted[j].q
+	})
+
+	m := &a.errorMessages
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, l := range accepted {
+		if _, ok := m.catalogs[l.tag]; ok {
+			return l.tag
+		}
+		primary, _, _ := strings.Cut(l.tag, "-")
+		if _, ok := m.catalogs[primary]; ok {
+			return primary
+		}
+	}
+	return strings.ToLower(a.DefaultLanguage)
+}
+
+// localizedErrorMessage is the message of the code of err in the Language of the request, the message of err when there is
+// none
+func (aepr *DXAPIEndPointRequest) localizedErrorMessage(err error) (code string, message string, messageLang string) {
+	code = ErrorCode(err)
+	if aepr.EndPoint == nil || aepr.EndPoint.Owner == nil || aepr.Request == nil {
+		return code, err.Error(), ""
+	}
+	message, messageLang, isFound := aepr.EndPoint.Owner.ErrorMessage(aepr.Language(), code)
+	if !isFound {
+		return code, err.Error(), ""
+	}
+	return code, message, messageLang
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/donnyhardyanto/dxlib/log"
+	security "github.com/donnyhardyanto/dxlib/utils/security"
+)
+
+// NewHMACVerifyMiddleware rejects with 401 the requests whose headerName header, written by security.FormatSignatureHeader, is
+// missing, stale or does not match the raw body. secretLookup returns the secret of the key id named in the header. The body
+// is read before the endpoint parses it and put back, so the endpoint still sees it whole.
+func NewHMACVerifyMiddleware(headerName string, secretLookup func(keyId string) (string, error)) DXAPIMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reject := func(reason string) {
+				log.Log.Warnf("HMAC_VERIFY_REJECTED:%s remote_addr=%s method=%s path=%s", reason, r.RemoteAddr, r.Method, r.URL.Path)
+				writeMiddlewareError(w, http.StatusUnauthorized, "UNAUTHORIZED")
+			}
+			keyId, ts, signature, err := security.ParseSignatureHeader(r.Header.Get(headerName))
+			if err != nil {
+				reject(err.Error())
+				return
+			}
+			secret, err := secretLookup(keyId)
+			if err != nil {
+				reject("UNKNOWN_KEY_ID:" + keyId)
+				return
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				reject("REQUEST_BODY_CANT_BE_READ:" + err.Error())
+				return
+			}
+			_ = r.Body.Close()
+			err = security.VerifySignature([]byte(secret), body, ts, signature)
+			if err != nil {
+				reject(err.Error() + ":key_id=" + keyId)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
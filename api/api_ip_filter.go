@@ -0,0 +1,132 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/donnyhardyanto/dxlib/log"
+)
+
+type dxIPFilter struct {
+	allow          []netip.Prefix
+	deny           []netip.Prefix
+	trustedProxies []netip.Prefix
+}
+
+// NewIPFilterMiddleware rejects with 403 the requests whose client IP is in deny, or is not in allow when allow is not empty.
+// Entries are CIDRs or single addresses, an invalid one is returned as an error. When the direct peer is in trustedProxies,
+// the client IP is the rightmost X-Forwarded-For entry that is not a trusted proxy, otherwise it is the peer address.
+func NewIPFilterMiddleware(allow []string, deny []string, trustedProxies []string) (middleware DXAPIMiddleware, err error) {
+	f := &dxIPFilter{}
+	f.allow, err = parseIPPrefixes("allow", allow)
+	if err != nil {
+		return nil, err
+	}
+	f.deny, err = parseIPPrefixes("deny", deny)
+	if err != nil {
+		return nil, err
+	}
+	f.trustedProxies, err = parseIPPrefixes("trusted proxy", trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return f.middleware, nil
+}
+
+func parseIPPrefixes(kind string, values []string) (prefixes []netip.Prefix, err error) {
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		var prefix netip.Prefix
+		if strings.Contains(v, "/") {
+			prefix, err = netip.ParsePrefix(v)
+		} else {
+			var addr netip.Addr
+			addr, err = netip.ParseAddr(v)
+			if err == nil {
+				prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("IP_FILTER_INVALID_%s:%s:%w", strings.ToUpper(strings.ReplaceAll(kind, " ", "_")), v, err)
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			// ::ffff:10.0.0.0/104 is written as 10.0.0.0/8, because the addresses are unmapped before matching
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func parseIPAddr(v string) (addr netip.Addr, ok bool) {
+	v = strings.TrimSpace(v)
+	if host, _, err := net.SplitHostPort(v); err == nil {
+		v = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(v, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.WithZone("").Unmap(), true
+}
+
+func isIPInPrefixes(addr netip.Addr, prefixes []netip.Prefix) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address the filter decides on. X-Forwarded-For is only believed when the peer is a trusted proxy,
+// and it is read from the right, since the leftmost entries are written by the client itself.
+func (f *dxIPFilter) clientIP(r *http.Request) (addr netip.Addr, ok bool) {
+	addr, ok = parseIPAddr(r.RemoteAddr)
+	if !ok || !isIPInPrefixes(addr, f.trustedProxies) {
+		return addr, ok
+	}
+	forwardedFor := strings.Join(r.Header.Values("X-Forwarded-For"), ",")
+	if strings.TrimSpace(forwardedFor) == "" {
+		return addr, ok
+	}
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, isValid := parseIPAddr(hops[i])
+		if !isValid {
+			// A malformed entry can not be trusted, decide on the last hop that added it
+			return addr, ok
+		}
+		addr = hop
+		if !isIPInPrefixes(hop, f.trustedProxies) {
+			return addr, ok
+		}
+	}
+	return addr, ok
+}
+
+func (f *dxIPFilter) isAllowed(addr netip.Addr) bool {
+	if isIPInPrefixes(addr, f.deny) {
+		return false
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	return isIPInPrefixes(addr, f.allow)
+}
+
+func (f *dxIPFilter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, ok := f.clientIP(r)
+		if !ok || !f.isAllowed(addr) {
+			log.Log.Warnf("IP_FILTER_REJECTED:ip=%s remote_addr=%s x_forwarded_for=%q method=%s path=%s", addr.String(),
+				r.RemoteAddr, r.Header.Get("X-Forwarded-For"), r.Method, r.URL.Path)
+			writeMiddlewareError(w, http.StatusForbidden, "FORBIDDEN")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/log"
+)
+
+type dxAPIListenerAddressContextKey struct{}
+
+// ListenerAddressFromContext returns the configured address of the listener that accepted the request
+func ListenerAddressFromContext(ctx context.Context) string {
+	address, _ := ctx.Value(dxAPIListenerAddressContextKey{}).(string)
+	return address
+}
+
+// GetListenAddresses returns Addresses, or Address alone when no list was configured
+func (a *DXAPI) GetListenAddresses() []string {
+	if len(a.Addresses) > 0 {
+		return a.Addresses
+	}
+	return []string{a.Address}
+}
+
+// setAddressesFromConfiguration accepts the address configuration value as a string or as an array of strings
+func (a *DXAPI) setAddressesFromConfiguration(v any) (ok bool) {
+	switch t := v.(type) {
+	case string:
+		a.Address = t
+		a.Addresses = []string{t}
+		return true
+	case []string:
+		a.Addresses = t
+	case []any:
+		a.Addresses = nil
+		for _, item := range t {
+			s, isString := item.(string)
+			if !isString {
+				return false
+			}
+			a.Addresses = append(a.Addresses, s)
+		}
+	default:
+		return false
+	}
+	if len(a.Addresses) == 0 {
+		return false
+	}
+	a.Address = a.Addresses[0]
+	return true
+}
+
+func (a *DXAPI) newHTTPServer(address string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         address,
+		Handler:      handler,
+		WriteTimeout: time.Duration(a.WriteTimeoutSec) * time.Second,
+		ReadTimeout:  time.Duration(a.ReadTimeoutSec) * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithValue(context.Background(), dxAPIListenerAddressContextKey{}, address)
+		},
+	}
+}
+
+const (
+	DXAPIUnixSocketAddressPrefix     = "unix:"
+	DXAPIDefaultUnixSocketFileMode   = os.FileMode(0660)
+	dxAPIUnixSocketPeerAddressLabel  = "unix"
+	dxAPIUnixSocketProbeTimeoutMilli = 200
+)
+
+func isUnixSocketAddress(address string) bool {
+	return strings.HasPrefix(address, DXAPIUnixSocketAddressPrefix)
+}
+
+// setUnixSocketFileModeFromConfiguration accepts the mode as an octal string ("0660") or as a number (432)
+func (a *DXAPI) setUnixSocketFileModeFromConfiguration(v any) (err error) {
+	switch t := v.(type) {
+	case nil:
+	case string:
+		mode, err := strconv.ParseUint(t, 8, 32)
+		if err != nil {
+			return fmt.Errorf("INVALID_UNIX_SOCKET_FILE_MODE:%s:%w", t, err)
+		}
+		a.UnixSocketFileMode = os.FileMode(mode)
+	case float64:
+		a.UnixSocketFileMode = os.FileMode(t)
+	default:
+		return fmt.Errorf("INVALID_UNIX_SOCKET_FILE_MODE:%v", v)
+	}
+	return nil
+}
+
+// listenUnixSocket removes a stale socket file left by a previous run, but refuses to touch a socket still being served or a
+// file that is not a socket.
+func (a *DXAPI) listenUnixSocket(address string) (listener net.Listener, err error) {
+	path := strings.TrimPrefix(address, DXAPIUnixSocketAddressPrefix)
+	if path == "" {
+		return nil, fmt.Errorf("UNIX_SOCKET_PATH_IS_EMPTY:%s", address)
+	}
+	fileInfo, err := os.Lstat(path)
+	if err == nil {
+		if fileInfo.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("UNIX_SOCKET_PATH_IS_NOT_A_SOCKET:%s", path)
+		}
+		conn, errDial := net.DialTimeout("unix", path, dxAPIUnixSocketProbeTimeoutMilli*time.Millisecond)
+		if errDial == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("UNIX_SOCKET_ALREADY_IN_USE:%s", path)
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return nil, fmt.Errorf("UNIX_SOCKET_STALE_FILE_REMOVE_FAILED:%s:%w", path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err = net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	fileMode := a.UnixSocketFileMode
+	if fileMode == 0 {
+		fileMode = DXAPIDefaultUnixSocketFileMode
+	}
+	err = os.Chmod(path, fileMode)
+	if err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("UNIX_SOCKET_CHMOD_FAILED:%s:%w", path, err)
+	}
+	return listener, nil
+}
+
+func removeUnixSocketFile(address string) {
+	path := strings.TrimPrefix(address, DXAPIUnixSocketAddressPrefix)
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Log.Warnf("UNIX_SOCKET_REMOVE_FAILED:%s:%v", path, err.Error())
+	}
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// DXAPIMiddleware wraps the whole HTTP handler of an API, so it also sees requests that never reach an endpoint (404, 405, redirects)
+type DXAPIMiddleware func(next http.Handler) http.Handler
+
+// Use registers middlewares that wrap every request of the API. They run in the order given, the first one is the outermost.
+// It must be called before StartAndWait.
+func (a *DXAPI) Use(middlewares ...DXAPIMiddleware) {
+	a.middlewares = append(a.middlewares, middlewares...)
+}
+
+func (a *DXAPI) applyMiddlewares(h http.Handler) http.Handler {
+	for i := len(a.middlewares) - 1; i >= 0; i-- {
+		h = a.middlewares[i](h)
+	}
+	return h
+}
+
+// writeMiddlewareError writes the standard error envelope for a request rejected before it has a DXAPIEndPointRequest
+func writeMiddlewareError(w http.ResponseWriter, statusCode int, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(utils.JSON{
+		"status":         http.StatusText(statusCode),
+		"reason":         reason,
+		"reason_message": reason,
+	})
+}
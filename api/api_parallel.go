@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// ErrParallelTaskCancelled is the error of a task of Parallel cancelled by the failure of another with WithFailFast
+var ErrParallelTaskCancelled = errors.New("PARALLEL_TASK_CANCELLED")
+
+type dxAPIParallelOptions struct {
+	isFailFast bool
+}
+
+type DXAPIParallelOption func(o *dxAPIParallelOptions)
+
+// WithFailFast cancels the context of the tasks still running at the first error, the ones that end because of it fail with
+// ErrParallelTaskCancelled
+func WithFailFast() DXAPIParallelOption {
+	return func(o *dxAPIParallelOptions) {
+		o.isFailFast = true
+	}
+}
+
+// Parallel runs tasks concurrently in the context of the request, bounded by timeout when it is more than zero, and returns the
+// result of each task that succeeded and the error of each that did not, by name. A task panicking fails with the panic, the
+// others keep running. Each task has its own span "parallel|<name>", a child of the span of the request. The handler decides
+// from errs whether to fail the request or answer with what it has.
+func Parallel(aepr *DXAPIEndPointRequest, timeout time.Duration, tasks map[string]func(ctx context.Context) (utils.JSON, error),
+	opts ...DXAPIParallelOption) (results map[string]utils.JSON, errs map[string]error) {
+	o := dxAPIParallelOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	ctx, cancel := context.WithCancelCause(aepr.GetContext())
+	defer cancel(nil)
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		defer cancelTimeout()
+	}
+
+	results = map[string]utils.JSON{}
+	errs = map[string]error{}
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	tracer := otel.Tracer(aepr.Log.Prefix)
+	for name, task := range tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			taskContext, span := tracer.Start(ctx, "parallel|"+name, trace.WithAttributes(attribute.String("parallel.task", name)))
+			r, err := runParallelTask(aepr, name, taskContext, task)
+			if errors.Is(err, context.Canceled) && errors.Is(context.Cause(ctx), ErrParallelTaskCancelled) {
+				err = fmt.Errorf("%w:%s:%v", ErrParallelTaskCancelled, name, err.Error())
+			}
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs[name] = err
+				if o.isFailFast {
+					cancel(ErrParallelTaskCancelled)
+				}
+				return
+			}
+			results[name] = r
+		}()
+	}
+	wg.Wait()
+	return results, errs
+}
+
+func runParallelTask(aepr *DXAPIEndPointRequest, name string, ctx context.Context, task func(ctx context.Context) (utils.JSON, error)) (r utils.JSON, err error) {
+	defer func() {
+		rec := recover()
+		if rec != nil {
+			r = nil
+			err = aepr.Log.CapturePanic(rec, "PANIC_IN_PARALLEL_TASK:"+name)
+		}
+	}()
+	return task(ctx)
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type DXAPIPathNormalizationPolicy int
+
+const (
+	// PathNormalizationStrict matches the path exactly as received (the original behaviour)
+	PathNormalizationStrict DXAPIPathNormalizationPolicy = iota
+	// PathNormalizationRedirect answers a non canonical path with 301 (GET/HEAD) or 308 (other methods, so the method and body are preserved)
+	PathNormalizationRedirect
+	// PathNormalizationRewrite serves a non canonical path as if the canonical one was requested
+	PathNormalizationRewrite
+)
+
+func (p DXAPIPathNormalizationPolicy) String() string {
+	switch p {
+	case PathNormalizationRedirect:
+		return "redirect"
+	case PathNormalizationRewrite:
+		return "rewrite"
+	default:
+		return "strict"
+	}
+}
+
+func StringToDXAPIPathNormalizationPolicy(v string) DXAPIPathNormalizationPolicy {
+	switch strings.ToLower(v) {
+	case "redirect":
+		return PathNormalizationRedirect
+	case "rewrite":
+		return PathNormalizationRewrite
+	default:
+		return PathNormalizationStrict
+	}
+}
+
+// NormalizeEscapedPath collapses repeated slashes and resolves dot segments. It works on the escaped form of the path, so an
+// encoded slash (%2F) inside a segment is kept as is and never become a path separator.
+func NormalizeEscapedPath(escapedPath string) string {
+	if escapedPath == "" {
+		return "/"
+	}
+	hasTrailingSlash := strings.HasSuffix(escapedPath, "/")
+	var segments []string
+	for _, segment := range strings.Split(escapedPath, "/") {
+		switch segment {
+		case "", ".":
+		case "..":
+			if len(segments) > 0 {
+				segments = segments[:len(segments)-1]
+			}
+		default:
+			segments = append(segments, segment)
+		}
+	}
+	s := "/" + strings.Join(segments, "/")
+	if hasTrailingSlash && (s != "/") {
+		s = s + "/"
+	}
+	return s
+}
+
+func (a *DXAPI) isEndPointUriExist(uri string) bool {
+	return a.FindEndPointByURI(uri) != nil
+}
+
+// canonicalEscapedPath returns the registered form of the path, toggling the trailing slash when only the other form is registered
+func (a *DXAPI) canonicalEscapedPath(escapedPath string) string {
+	s := NormalizeEscapedPath(escapedPath)
+	if (s == "/") || a.isEndPointUriExist(s) {
+		return s
+	}
+	alternative := s + "/"
+	if strings.HasSuffix(s, "/") {
+		alternative = strings.TrimSuffix(s, "/")
+	}
+	if a.isEndPointUriExist(alternative) {
+		return alternative
+	}
+	return s
+}
+
+func (a *DXAPI) pathNormalizationMiddleware(next http.Handler) http.Handler {
+	if a.PathNormalizationPolicy == PathNormalizationStrict {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		escapedPath := r.URL.EscapedPath()
+		canonical := a.canonicalEscapedPath(escapedPath)
+		if canonical == escapedPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch a.PathNormalizationPolicy {
+		case PathNormalizationRedirect:
+			target := canonical
+			if r.URL.RawQuery != "" {
+				target = target + "?" + r.URL.RawQuery
+			}
+			statusCode := http.StatusPermanentRedirect
+			if (r.Method == http.MethodGet) || (r.Method == http.MethodHead) {
+				statusCode = http.StatusMovedPermanently
+			}
+			http.Redirect(w, r, target, statusCode)
+			return
+		case PathNormalizationRewrite:
+			path, err := url.PathUnescape(canonical)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = path
+			r2.URL.RawPath = ""
+			if path != canonical {
+				r2.URL.RawPath = canonical
+			}
+			next.ServeHTTP(w, r2)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
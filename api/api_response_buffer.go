@@ -0,0 +1,40 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// dxAPIResponseBufferMaxPooledCap keeps the buffers grown by a very large response out of the pool, so they are collected
+// instead of pinning their memory
+const dxAPIResponseBufferMaxPooledCap = 64 * 1024
+
+var responseBufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// marshalToResponseBuffer encodes v like json.Marshal into a buffer of the pool. The caller writes the buffer synchronously
+// and gives it back with releaseResponseBuffer, deferred so a panic of the write path releases it too. Nothing may keep a
+// reference to the bytes after the release.
+func marshalToResponseBuffer(v any) (b *bytes.Buffer, err error) {
+	b = responseBufferPool.Get().(*bytes.Buffer)
+	b.Reset()
+	err = json.NewEncoder(b).Encode(v)
+	if err != nil {
+		releaseResponseBuffer(b)
+		return nil, err
+	}
+	// Encode ends the document with a newline, json.Marshal does not
+	b.Truncate(b.Len() - 1)
+	return b, nil
+}
+
+func releaseResponseBuffer(b *bytes.Buffer) {
+	if b == nil || b.Cap() > dxAPIResponseBufferMaxPooledCap {
+		return
+	}
+	responseBufferPool.Put(b)
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DXAPIResponseCacheHeader = "X-Cache"
+
+type DXAPIResponseCacheEntry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	ExpiresAt  time.Time
+}
+
+// DXAPIResponseCacheStore keeps the entries of a DXAPIResponseCache, DXAPIMemoryResponseCacheStore is the in-memory one. A
+// store shared by several processes, like Redis, implements the same methods.
+type DXAPIResponseCacheStore interface {
+	Get(key string) (entry *DXAPIResponseCacheEntry, isFound bool)
+	Set(key string, entry *DXAPIResponseCacheEntry)
+	Delete(key string)
+	DeletePrefix(prefix string)
+}
+
+type memoryResponseCacheItem struct {
+	key   string
+	entry *DXAPIResponseCacheEntry
+}
+
+// DXAPIMemoryResponseCacheStore is an LRU of at most MaxEntries entries, the least recently used one is evicted first
+type DXAPIMemoryResponseCacheStore struct {
+	MaxEntries int
+	mutex      sync.Mutex
+	items      map[string]*list.Element
+	order      *list.List
+}
+
+func NewMemoryResponseCacheStore(maxEntries int) *DXAPIMemoryResponseCacheStore {
+	return &DXAPIMemoryResponseCacheStore{
+		MaxEntries: maxEntries,
+		items:      map[string]*list.Element{},
+		order:      list.New(),
+	}
+}
+
+func (s *DXAPIMemoryResponseCacheStore) Get(key string) (entry *DXAPIResponseCacheEntry, isFound bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := e.Value.(*memoryResponseCacheItem)
+	if time.Now().After(item.entry.ExpiresAt) {
+		s.order.Remove(e)
+		delete(s.items, key)
+		return nil, false
+	}
+	s.order.MoveToFront(e)
+	return item.entry, true
+}
+
+func (s *DXAPIMemoryResponseCacheStore) Set(key string, entry *DXAPIResponseCacheEntry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.items[key]
+	if ok {
+		e.Value.(*memoryResponseCacheItem).entry = entry
+		s.order.MoveToFront(e)
+		return
+	}
+	s.items[key] = s.order.PushFront(&memoryResponseCacheItem{key: key, entry: entry})
+	for s.MaxEntries > 0 && s.order.Len() > s.MaxEntries {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(*memoryResponseCacheItem).key)
+	}
+}
+
+func (s *DXAPIMemoryResponseCacheStore) Delete(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.items[key]
+	if ok {
+		s.order.Remove(e)
+		delete(s.items, key)
+	}
+}
+
+func (s *DXAPIMemoryResponseCacheStore) DeletePrefix(prefix string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key, e := range s.items {
+		if strings.HasPrefix(key, prefix) {
+			s.order.Remove(e)
+			delete(s.items, key)
+		}
+	}
+}
+
+type DXAPIResponseCacheKeyFunc func(aepr *DXAPIEndPointRequest) string
+
+type DXAPIResponseCache struct {
+	Store   DXAPIResponseCacheStore
+	TTL     time.Duration
+	KeyFunc DXAPIResponseCacheKeyFunc
+}
+
+// DefaultResponseCacheKey is the path and query of the request, followed by the current user, or a hash of the Authorization
+// header when no user is identified yet, so an authenticated response is only served back to its own user
+func DefaultResponseCacheKey(aepr *DXAPIEndPointRequest) string {
+	key := aepr.Request.URL.Path
+	if aepr.Request.URL.RawQuery != "" {
+		key += "?" + aepr.Request.URL.RawQuery
+	}
+	if aepr.CurrentUser.Id != "" {
+		return key + "|user:" + aepr.CurrentUser.Id
+	}
+	authorization := aepr.Request.Header.Get("Authorization")
+	if authorization != "" {
+		sum := sha256.Sum256([]byte(authorization))
+		return key + "|auth:" + hex.EncodeToString(sum[:16])
+	}
+	return key
+}
+
+// NewResponseCacheMiddleware returns an endpoint middleware caching the successful GET responses for ttl in an LRU of
+// maxEntries, and the cache itself for InvalidateKey and InvalidatePrefix. keyFunc nil is DefaultResponseCacheKey, a keyFunc
+// given decides alone which requests share an entry. The middleware must come after the ones identifying the user.
+func NewResponseCacheMiddleware(ttl time.Duration, keyFunc DXAPIResponseCacheKeyFunc, maxEntries int) (DXAPIEndPointExecuteFunc, *DXAPIResponseCache) {
+	c := &DXAPIResponseCache{
+		Store:   NewMemoryResponseCacheStore(maxEntries),
+		TTL:     ttl,
+		KeyFunc: keyFunc,
+	}
+	return c.Middleware, c
+}
+
+func (c *DXAPIResponseCache) key(aepr *DXAPIEndPointRequest) string {
+	if c.KeyFunc != nil {
+		return c.KeyFunc(aepr)
+	}
+	return DefaultResponseCacheKey(aepr)
+}
+
+// InvalidateKey evicts the entry of key, as returned by the key function
+func (c *DXAPIResponseCache) InvalidateKey(key string) {
+	c.Store.Delete(key)
+}
+
+// InvalidatePrefix evicts every entry whose key starts with prefix, with DefaultResponseCacheKey a path evicts the entries of
+// every query and user of that path
+func (c *DXAPIResponseCache) InvalidatePrefix(prefix string) {
+	c.Store.DeletePrefix(prefix)
+}
+
+// Middleware answers a GET from the cache before OnExecute runs, and otherwise stores the response OnExecute writes. A
+// request with Cache-Control: no-cache skips the lookup, its fresh response replaces the entry.
+func (c *DXAPIResponseCache) Middleware(aepr *DXAPIEndPointRequest) (err error) {
+	if aepr.Request.Method != http.MethodGet {
+		return nil
+	}
+	key := c.key(aepr)
+	if !strings.Contains(strings.ToLower(aepr.Request.Header.Get("Cache-Control")), "no-cache") {
+		entry, isFound := c.Store.Get(key)
+		if isFound {
+			header := map[string]string{}
+			for k, v := range entry.Header {
+				if len(v) > 0 {
+					header[k] = v[0]
+				}
+			}
+			header[DXAPIResponseCacheHeader] = "HIT"
+			aepr.WriteResponseAsBytes(entry.StatusCode, header, entry.Body)
+			return nil
+		}
+	}
+	aepr.GetResponseHeader().Set(DXAPIResponseCacheHeader, "MISS")
+	aepr.onResponseWritten = func(statusCode int, header http.Header, body []byte) {
+		if statusCode < 200 || statusCode >= 300 {
+			return
+		}
+		if strings.Contains(strings.ToLower(header.Get("Cache-Control")), "no-store") || header.Get("Set-Cookie") != "" {
+			return
+		}
+		h := header.Clone()
+		h.Del(DXAPIResponseCacheHeader)
+		// body may be a pooled buffer, released once the response is written
+		c.Store.Set(key, &DXAPIResponseCacheEntry{
+			StatusCode: statusCode,
+			Header:     h,
+			Body:       append([]byte(nil), body...),
+			ExpiresAt:  time.Now().Add(c.TTL),
+		})
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/utils/retry"
+)
+
+const (
+	DXAPIDefaultRetryBudgetMaxRetries = 2
+	DXAPIDefaultRetryBudgetMs         = 3000
+)
+
+// RetryBudgetExhaustedCount is the count of the requests of aep whose retry budget was spent, for the metrics
+func (aep *DXAPIEndPoint) RetryBudgetExhaustedCount() int64 {
+	return aep.retryBudgetExhaustedCount.Load()
+}
+
+// newRetryBudget is the retry.Budget shared by the retries made in the context of a request of p
+func (a *DXAPI) newRetryBudget(p *DXAPIEndPoint) *retry.Budget {
+	b := retry.NewBudget(a.RetryBudgetMaxRetries, time.Duration(a.RetryBudgetMs)*time.Millisecond)
+	b.OnExhausted = func(b *retry.Budget) {
+		p.retryBudgetExhaustedCount.Add(1)
+		a.Log.Warnf("RETRY_BUDGET_EXHAUSTED:%s:%d retries", p.Uri, b.RetryCount())
+	}
+	return b
+}
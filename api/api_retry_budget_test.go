@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database"
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/utils"
+	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
+	"github.com/donnyhardyanto/dxlib/utils/http/client"
+	"github.com/donnyhardyanto/dxlib/utils/retry"
+)
+
+// The retries of the flaky dependencies of a request, an outbound call retried by the HTTP client and a select retried by
+// SelectOneContext, together take no more than the budget of the request. Once it is spent the next failure returns at once,
+// with the budget exhaustion attached, and the exhaustion is counted once for the endpoint.
+func TestRetriesOfARequestShareItsBudget(t *testing.T) {
+	previousRetryDelay := client.HTTPClientRetryDelay
+	client.HTTPClientRetryDelay = time.Millisecond
+	t.Cleanup(func() {
+		client.HTTPClientRetryDelay = previousRetryDelay
+	})
+	var calls atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+	var selects atomic.Int64
+	fake := dbtest.Open("postgres", func(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+		if strings.Contains(s.Query, `"orders"`) {
+			selects.Add(1)
+			return dbtest.DXFakeResult{Err: errors.New("SERVER_CLOSED_THE_CONNECTION")}
+		}
+		return dbtest.DXFakeResult{}
+	})
+	defer func() {
+		_ = fake.Close()
+	}()
+	d := &database.DXDatabase{NameId: "orders", DatabaseType: database_type.PostgreSQL, Connection: fake.DB, Connected: true}
+
+	am := newTestAPIManager()
+	defer am.Cancel()
+	a, _ := am.NewAPI("test")
+	a.RetryBudgetMaxRetries = 3
+	a.RetryBudgetMs = 60000
+	var errs []error
+	ae := a.NewEndPoint("flaky", "", "/flaky", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil,
+		func(aepr *DXAPIEndPointRequest) error {
+			_, response, err := client.HTTPClientContext(aepr.Context, http.MethodGet, upstream.URL, nil, "")
+			if response != nil {
+				_ = response.Body.Close()
+			}
+			errs = append(errs, err)
+			_, _, err = d.SelectOneContext(aepr.Context, "orders", nil, utils.JSON{"id": int64(1)}, nil, nil)
+			errs = append(errs, err)
+			_, _, err = client.HTTPClientContext(aepr.Context, http.MethodGet, upstream.URL, nil, "")
+			errs = append(errs, err)
+			aepr.WriteResponseAsString(http.StatusOK, nil, "ok")
+			return nil
+		}, nil, nil, nil, nil)
+	ae.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/flaky", nil))
+
+	// The HTTP client takes its 2 retries, the select the last one, the second call gets none
+	if calls.Load() != 4 || selects.Load() != 2 {
+		t.Fatalf("%d upstream calls, %d selects", calls.Load(), selects.Load())
+	}
+	if errs[0] != nil {
+		t.Fatalf("the first call failed with %v instead of answering 503", errs[0])
+	}
+	for _, err := range errs[1:] {
+		if !errors.Is(err, retry.ErrBudgetExhausted) {
+			t.Fatalf("err %v", err)
+		}
+	}
+	if !strings.Contains(errs[1].Error(), "SERVER_CLOSED_THE_CONNECTION") || !strings.Contains(errs[2].Error(), "HTTP_STATUS_503") {
+		t.Fatalf("the causes are lost in %v and %v", errs[1], errs[2])
+	}
+	if ae.RetryBudgetExhaustedCount() != 1 {
+		t.Fatalf("%d exhaustions counted", ae.RetryBudgetExhaustedCount())
+	}
+
+	// The next request has a budget of its own
+	errs = nil
+	ae.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/flaky", nil))
+	if calls.Load() != 8 || selects.Load() != 4 || ae.RetryBudgetExhaustedCount() != 2 {
+		t.Fatalf("%d upstream calls, %d selects, %d exhaustions", calls.Load(), selects.Load(), ae.RetryBudgetExhaustedCount())
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DXAPISecurityHeadersOptions holds the header values written by NewSecurityHeadersMiddleware. An empty value means the header
+// is not written at all, start from DefaultSecurityHeadersOptions and blank out or change what does not fit.
+type DXAPISecurityHeadersOptions struct {
+	// StrictTransportSecurity is only written on TLS connections, browsers ignore it over plain HTTP anyway
+	StrictTransportSecurity string
+	ContentTypeOptions      string
+	FrameOptions            string
+	// FrameAncestors is written as the frame-ancestors directive of Content-Security-Policy, the modern replacement of X-Frame-Options
+	FrameAncestors        string
+	ReferrerPolicy        string
+	ContentSecurityPolicy string
+}
+
+func DefaultSecurityHeadersOptions() DXAPISecurityHeadersOptions {
+	return DXAPISecurityHeadersOptions{
+		StrictTransportSecurity: "max-age=31536000; includeSubDomains",
+		ContentTypeOptions:      "nosniff",
+		FrameOptions:            "DENY",
+		FrameAncestors:          "'none'",
+		ReferrerPolicy:          "strict-origin-when-cross-origin",
+	}
+}
+
+// NewSecurityHeadersMiddleware writes the security headers on every response of the API, including errors and 404.
+// Register it with DXAPI.Use. An endpoint can drop some of them with DXAPIEndPoint.RemovedSecurityHeaders.
+func NewSecurityHeadersMiddleware(opts DXAPISecurityHeadersOptions) DXAPIMiddleware {
+	contentSecurityPolicy := opts.ContentSecurityPolicy
+	if opts.FrameAncestors != "" && !strings.Contains(contentSecurityPolicy, "frame-ancestors") {
+		if contentSecurityPolicy != "" {
+			contentSecurityPolicy = strings.TrimRight(strings.TrimSpace(contentSecurityPolicy), ";") + "; "
+		}
+		contentSecurityPolicy += "frame-ancestors " + opts.FrameAncestors
+	}
+
+	headers := map[string]string{
+		"X-Content-Type-Options":  opts.ContentTypeOptions,
+		"X-Frame-Options":         opts.FrameOptions,
+		"Referrer-Policy":         opts.ReferrerPolicy,
+		"Content-Security-Policy": contentSecurityPolicy,
+	}
+	for k, v := range headers {
+		if v == "" {
+			delete(headers, k)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			for k, v := range headers {
+				h.Set(k, v)
+			}
+			if r.TLS != nil && opts.StrictTransportSecurity != "" {
+				h.Set("Strict-Transport-Security", opts.StrictTransportSecurity)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
+)
+
+func TestSecurityHeadersOnSuccessErrorAndNotFound(t *testing.T) {
+	am := newTestAPIManager()
+	a, _ := am.NewAPI("test")
+	a.Address = freeAddress(t)
+	a.Use(NewSecurityHeadersMiddleware(DefaultSecurityHeadersOptions()))
+	a.NewEndPoint("ok", "", "/ok", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil,
+		func(aepr *DXAPIEndPointRequest) error {
+			aepr.WriteResponseAsString(http.StatusOK, nil, "ok")
+			return nil
+		}, nil, nil, nil, nil)
+	a.NewEndPoint("fail", "", "/fail", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil,
+		func(aepr *DXAPIEndPointRequest) error {
+			return errors.New("TEST_FAILURE")
+		}, nil, nil, nil, nil)
+	framed := a.NewEndPoint("framed", "", "/framed", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil,
+		func(aepr *DXAPIEndPointRequest) error {
+			aepr.WriteResponseAsString(http.StatusOK, nil, "ok")
+			return nil
+		}, nil, nil, nil, nil)
+	framed.RemovedSecurityHeaders = []string{"X-Frame-Options"}
+	startTestAPI(t, am, a)
+	defer func() { _ = am.StopAll() }()
+
+	for _, tc := range []struct {
+		path       string
+		isSuccess  bool
+		isFramable bool
+	}{
+		{path: "/ok", isSuccess: true},
+		{path: "/fail"},
+		{path: "/unknown"},
+		{path: "/framed", isSuccess: true, isFramable: true},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			r, err := http.Get("http://" + a.Address + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = io.Copy(io.Discard, r.Body)
+			_ = r.Body.Close()
+			if (r.StatusCode == http.StatusOK) != tc.isSuccess {
+				t.Fatalf("status %d", r.StatusCode)
+			}
+			if got := r.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options %q", got)
+			}
+			if got := r.Header.Get("Referrer-Policy"); got != "strict-origin-when-cross-origin" {
+				t.Errorf("Referrer-Policy %q", got)
+			}
+			if got := r.Header.Get("Content-Security-Policy"); got != "frame-ancestors 'none'" {
+				t.Errorf("Content-Security-Policy %q", got)
+			}
+			if got := r.Header.Get("X-Frame-Options"); (got == "") != tc.isFramable {
+				t.Errorf("X-Frame-Options %q", got)
+			}
+			if got := r.Header.Get("Strict-Transport-Security"); got != "" {
+				t.Errorf("Strict-Transport-Security %q written over plain HTTP", got)
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersOptions(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tc := range []struct {
+		name    string
+		opts    DXAPISecurityHeadersOptions
+		isTLS   bool
+		headers map[string]string
+	}{
+		{
+			name:  "defaults over TLS",
+			opts:  DefaultSecurityHeadersOptions(),
+			isTLS: true,
+			headers: map[string]string{
+				"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+				"X-Frame-Options":           "DENY",
+			},
+		},
+		{
+			name: "content security policy joined with frame ancestors",
+			opts: DXAPISecurityHeadersOptions{ContentSecurityPolicy: "default-src 'self';", FrameAncestors: "'self'"},
+			headers: map[string]string{
+				"Content-Security-Policy": "default-src 'self'; frame-ancestors 'self'",
+				"X-Frame-Options":         "",
+			},
+		},
+		{
+			name: "frame ancestors already in the policy",
+			opts: DXAPISecurityHeadersOptions{ContentSecurityPolicy: "frame-ancestors https://a.example", FrameAncestors: "'none'"},
+			headers: map[string]string{
+				"Content-Security-Policy": "frame-ancestors https://a.example",
+			},
+		},
+		{
+			name: "blanked options are not written",
+			opts: DXAPISecurityHeadersOptions{StrictTransportSecurity: "max-age=1"},
+			headers: map[string]string{
+				"X-Content-Type-Options":    "",
+				"Referrer-Policy":           "",
+				"Content-Security-Policy":   "",
+				"Strict-Transport-Security": "",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.isTLS {
+				r.TLS = &tls.ConnectionState{}
+			}
+			w := httptest.NewRecorder()
+			NewSecurityHeadersMiddleware(tc.opts)(next).ServeHTTP(w, r)
+			for k, v := range tc.headers {
+				if got := w.Header().Get(k); got != v {
+					t.Errorf("%s: got %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/donnyhardyanto/dxlib/database"
+)
+
+type DXAPITenantExtractFunc func(aepr *DXAPIEndPointRequest) (tenantId string, err error)
+
+// NewTenantMiddleware returns an endpoint middleware resolving the tenant of the request with extract, or answering 403 when
+// it cannot. The transaction of the request, aepr.Tx and aepr.WithTx, is then scoped to the tenant, and so is
+// aepr.TenantDatabase. It must come after the middlewares extract relies on, like the one verifying the token.
+func NewTenantMiddleware(extract DXAPITenantExtractFunc) DXAPIEndPointExecuteFunc {
+	return func(aepr *DXAPIEndPointRequest) (err error) {
+		tenantId, err := extract(aepr)
+		if err != nil {
+			return aepr.WriteResponseAndNewErrorf(http.StatusForbidden, "TENANT_NOT_RESOLVED:%v", err.Error())
+		}
+		if tenantId == "" {
+			return aepr.WriteResponseAndNewErrorf(http.StatusForbidden, "TENANT_NOT_RESOLVED")
+		}
+		aepr.tenantId = tenantId
+		if aepr.tx != nil {
+			aepr.tx.TenantId = tenantId
+		}
+		return nil
+	}
+}
+
+// TenantIdFromHeader reads the tenant from the request header headerName
+func TenantIdFromHeader(headerName string) DXAPITenantExtractFunc {
+	return func(aepr *DXAPIEndPointRequest) (tenantId string, err error) {
+		return aepr.Request.Header.Get(headerName), nil
+	}
+}
+
+// TenantIdFromLocalData reads the tenant Set under key by a previous middleware, like a claim of the token
+func TenantIdFromLocalData(key string) DXAPITenantExtractFunc {
+	return func(aepr *DXAPIEndPointRequest) (tenantId string, err error) {
+		tenantId, _ = aepr.GetString(key)
+		return tenantId, nil
+	}
+}
+
+// TenantIdFromSubdomain reads the tenant from the first label of the host, "acme" of acme.example.com, the host needs at least
+// three labels
+func TenantIdFromSubdomain() DXAPITenantExtractFunc {
+	return func(aepr *DXAPIEndPointRequest) (tenantId string, err error) {
+		host := aepr.Request.Host
+		h, _, errSplit := net.SplitHostPort(host)
+		if errSplit == nil {
+			host = h
+		}
+		labels := strings.Split(host, ".")
+		if len(labels) < 3 || net.ParseIP(host) != nil {
+			return "", errors.New("HOST_HAS_NO_SUBDOMAIN")
+		}
+		return strings.ToLower(labels[0]), nil
+	}
+}
+
+// TenantId returns the tenant resolved by NewTenantMiddleware, empty without it
+func (aepr *DXAPIEndPointRequest) TenantId() string {
+	return aepr.tenantId
+}
+
+// TenantDatabase returns d scoped to the tenant of the request, its queries are cancelled with the request
+func (aepr *DXAPIEndPointRequest) TenantDatabase(d *database.DXDatabase) *database.DXDatabaseTenantScope {
+	s := d.Tenant(aepr.tenantId)
+	s.Context = aepr.Context
+	return s
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database"
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+)
+
+var crudTenantPlaceholderRegexp = regexp.MustCompile(`"(tenant_id|id)"\s*=\s*\$(\d+)`)
+
+// crudTenantTable is the table item with a row of the tenant A, of id 1, and one of B, of id 2. A statement reaches the rows
+// matching the tenant and the id it binds, all of them when it binds none.
+type crudTenantTable struct {
+	mutex      sync.Mutex
+	statements []dbtest.DXFakeStatement
+}
+
+func (f *crudTenantTable) handle(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !strings.Contains(s.Query, `"item"`) {
+		return dbtest.DXFakeResult{RowsAffected: 1}
+	}
+	f.statements = append(f.statements, s)
+	if strings.HasPrefix(strings.ToLower(s.Query), "insert") {
+		return dbtest.DXFakeResult{Columns: []string{"id"}, Rows: [][]any{{int64(3)}}}
+	}
+	rows := [][]any{{int64(1), "A", "a1"}, {int64(2), "B", "b1"}}
+	var matching [][]any
+	for _, row := range rows {
+		isMatching := true
+		for _, m := range crudTenantPlaceholderRegexp.FindAllStringSubmatch(s.Query, -1) {
+			v, _ := s.Arg(m[2])
+			if m[1] == "id" {
+				isMatching = isMatching && v == row[0]
+			} else {
+				isMatching = isMatching && v == row[1]
+			}
+		}
+		if isMatching {
+			matching = append(matching, row)
+		}
+	}
+	if strings.Contains(strings.ToLower(s.Query), "count(") {
+		return dbtest.DXFakeResult{Columns: []string{"s___total_rows"}, Rows: [][]any{{int64(len(matching))}}}
+	}
+	if !s.IsQuery {
+		return dbtest.DXFakeResult{RowsAffected: int64(len(matching))}
+	}
+	return dbtest.DXFakeResult{Columns: []string{"id", "tenant_id", "name"}, Rows: matching}
+}
+
+// checkTenant fails unless every statement on item bound the tenant A and never B
+func (f *crudTenantTable) checkTenant(t *testing.T) {
+	t.Helper()
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, s := range f.statements {
+		hasA := false
+		for _, a := range s.Args {
+			hasA = hasA || a.Value == "A"
+			if a.Value == "B" {
+				t.Fatalf("%s binds the tenant B", s.Query)
+			}
+		}
+		if !hasA {
+			t.Fatalf("%s does not bind the tenant A", s.Query)
+		}
+	}
+	f.statements = nil
+}
+
+// The CRUD endpoints of a tenant never read, update nor delete the rows of another one
+func TestCRUDEndPointsTenantIsolation(t *testing.T) {
+	table := &crudTenantTable{}
+	fake := dbtest.Open("postgres", table.handle)
+	defer func() {
+		_ = fake.Close()
+	}()
+	d := &database.DXDatabase{NameId: "crud", DatabaseType: database_type.PostgreSQL, Connection: fake.DB, Connected: true,
+		TenantFieldName: "tenant_id"}
+	am := newTestAPIManager()
+	a, _ := am.NewAPI("test")
+	endPoints := map[string]*DXAPIEndPoint{}
+	for _, ae := range NewCRUDEndPoints(a, "/item", d, "item", CRUDSpec{
+		Fields:      []DXAPIEndPointParameter{{NameId: "name", Type: "string", IsMustExist: true}},
+		Middlewares: []DXAPIEndPointExecuteFunc{NewTenantMiddleware(TenantIdFromHeader("X-Tenant-Id"))},
+	}) {
+		endPoints[ae.Uri] = ae
+	}
+	// The typed parameters of a GET or a DELETE come in the X-Var header, the query string only carries strings
+	serve := func(method string, uri string, body string, tenantId string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, uri, strings.NewReader(body))
+		if method == http.MethodGet || method == http.MethodDelete {
+			r.Header.Set("X-Var", body)
+		} else {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		if tenantId != "" {
+			r.Header.Set("X-Tenant-Id", tenantId)
+		}
+		w := httptest.NewRecorder()
+		endPoints[uri].ServeHTTP(w, r)
+		return w
+	}
+
+	for _, tc := range []struct {
+		method, uri, body string
+		wantStatus        int
+	}{
+		{http.MethodGet, "/item/read", `{"id":2}`, http.StatusNotFound},
+		{http.MethodPut, "/item/update", `{"id":2,"new":{"name":"x"}}`, http.StatusNotFound},
+		{http.MethodDelete, "/item/delete", `{"id":2}`, http.StatusNotFound},
+		{http.MethodGet, "/item/read", `{"id":1}`, http.StatusOK},
+		{http.MethodPut, "/item/update", `{"id":1,"new":{"name":"x"}}`, http.StatusOK},
+		{http.MethodPost, "/item/create", `{"name":"n"}`, http.StatusOK},
+	} {
+		w := serve(tc.method, tc.uri, tc.body, "A")
+		if w.Code != tc.wantStatus {
+			t.Fatalf("%s %s: status %d, want %d: %s", tc.method, tc.uri, w.Code, tc.wantStatus, w.Body.String())
+		}
+		table.checkTenant(t)
+	}
+
+	w := serve(http.MethodGet, "/item/list", `{"row_per_page":0,"page_index":0}`, "A")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: status %d: %s", w.Code, w.Body.String())
+	}
+	var list struct {
+		List struct {
+			Rows []map[string]any `json:"rows"`
+		} `json:"list"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.List.Rows) != 1 || list.List.Rows[0]["tenant_id"] != "A" {
+		t.Fatalf("list %s", w.Body.String())
+	}
+	table.checkTenant(t)
+
+	// Without a tenant the request is refused before any statement
+	w = serve(http.MethodGet, "/item/read", `{"id":1}`, "")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if len(table.statements) != 0 {
+		t.Fatalf("statements %v", table.statements)
+	}
+}
+
+// A CRUD list or read runs its select with the context of the request, the select ends as soon as the request is cancelled
+func TestCRUDEndPointsQueryCancelledWithTheRequest(t *testing.T) {
+	started := make(chan struct{}, 1)
+	fake := dbtest.Open("postgres", func(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+		if !strings.Contains(s.Query, `"item"`) {
+			return dbtest.DXFakeResult{RowsAffected: 1}
+		}
+		started <- struct{}{}
+		select {
+		case <-ctx.Done():
+			return dbtest.DXFakeResult{Err: ctx.Err()}
+		case <-time.After(5 * time.Second):
+			return dbtest.DXFakeResult{Err: errors.New("SELECT_NOT_CANCELLED")}
+		}
+	})
+	defer func() {
+		_ = fake.Close()
+	}()
+	d := &database.DXDatabase{NameId: "crud", DatabaseType: database_type.PostgreSQL, Connection: fake.DB, Connected: true,
+		TenantFieldName: "tenant_id"}
+	am := newTestAPIManager()
+	a, _ := am.NewAPI("test")
+	endPoints := map[string]*DXAPIEndPoint{}
+	for _, ae := range NewCRUDEndPoints(a, "/item", d, "item", CRUDSpec{
+		Fields:      []DXAPIEndPointParameter{{NameId: "name", Type: "string", IsMustExist: true}},
+		Middlewares: []DXAPIEndPointExecuteFunc{NewTenantMiddleware(TenantIdFromHeader("X-Tenant-Id"))},
+	}) {
+		endPoints[ae.Uri] = ae
+	}
+	for uri, body := range map[string]string{"/item/list": `{"row_per_page":10,"page_index":0}`, "/item/read": `{"id":1}`} {
+		ctx, cancel := context.WithCancel(context.Background())
+		r := httptest.NewRequest(http.MethodGet, uri, nil).WithContext(ctx)
+		r.Header.Set("X-Var", body)
+		r.Header.Set("X-Tenant-Id", "A")
+		w := httptest.NewRecorder()
+		done := make(chan struct{})
+		begin := time.Now()
+		go func() {
+			defer close(done)
+			endPoints[uri].ServeHTTP(w, r)
+		}()
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: the select did not start", uri)
+		}
+		cancel()
+		<-done
+		if elapsed := time.Since(begin); elapsed > 2*time.Second {
+			t.Fatalf("%s: the select ended %v after the cancel", uri, elapsed)
+		}
+		if w.Code == http.StatusOK {
+			t.Fatalf("%s: a cancelled request answered %d: %s", uri, w.Code, w.Body.String())
+		}
+	}
+}
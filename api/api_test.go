@@ -0,0 +1,393 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
+)
+
+// newTestAPIManager returns a manager of its own, the tests do not share Manager
+func newTestAPIManager() *DXAPIManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &DXAPIManager{Context: ctx, Cancel: cancel, APIs: map[string]*DXAPI{}}
+}
+
+// freeAddress returns a loopback address whose port was free a moment ago
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	_ = l.Close()
+	return address
+}
+
+func waitUntil(t *testing.T, timeout time.Duration, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met after %v", timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func startTestAPI(t *testing.T, am *DXAPIManager, a *DXAPI) {
+	t.Helper()
+	errorGroup, errorGroupContext := errgroup.WithContext(am.Context)
+	err := am.StartAll(errorGroup, errorGroupContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, 5*time.Second, func() bool {
+		c, err := net.Dial("tcp", a.Address)
+		if err != nil {
+			return false
+		}
+		_ = c.Close()
+		return true
+	})
+}
+
+func TestStopAllReturnsWithinTheShutdownTimeoutWithARequestInFlight(t *testing.T) {
+	am := newTestAPIManager()
+	a, _ := am.NewAPI("test")
+	a.Address = freeAddress(t)
+	a.ShutdownTimeoutSec = 1
+	handlerDone := make(chan struct{})
+	a.NewEndPoint("slow", "", "/slow", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil,
+		func(aepr *DXAPIEndPointRequest) error {
+			defer close(handlerDone)
+			// Only the forced shutdown after the timeout ends this request
+			<-aepr.Context.Done()
+			return nil
+		}, nil, nil, nil, nil)
+	startTestAPI(t, am, a)
+
+	go func() {
+		r, err := http.Get("http://" + a.Address + "/slow")
+		if err == nil {
+			_, _ = io.Copy(io.Discard, r.Body)
+			_ = r.Body.Close()
+		}
+	}()
+	waitUntil(t, 5*time.Second, func() bool { return a.ActiveRequests() == 1 })
+
+	start := time.Now()
+	err := am.StopAll()
+	elapsed := time.Since(start)
+	if err == nil {
+		t.Fatal("StopAll should report the request still in flight at the timeout")
+	}
+	if elapsed > time.Duration(a.ShutdownTimeoutSec)*time.Second+2*time.Second {
+		t.Fatalf("StopAll returned after %v, the shutdown timeout is %ds", elapsed, a.ShutdownTimeoutSec)
+	}
+	select {
+	case <-handlerDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler context was not cancelled by the forced shutdown")
+	}
+	c, err := net.DialTimeout("tcp", a.Address, time.Second)
+	if err == nil {
+		_ = c.Close()
+		t.Fatal("the listener is still accepting connections after StopAll")
+	}
+	if a.RuntimeIsActive {
+		t.Fatal("the API is still active after StopAll")
+	}
+}
+
+func TestStopAllWithoutRequestsReturnsAtOnce(t *testing.T) {
+	am := newTestAPIManager()
+	a, _ := am.NewAPI("test")
+	a.Address = freeAddress(t)
+	a.ShutdownTimeoutSec = 30
+	startTestAPI(t, am, a)
+
+	start := time.Now()
+	err := am.StopAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("StopAll of an idle API took %v", elapsed)
+	}
+}
+
+func TestEndPointChangedAfterRegistrationIsSeenAtRequestTime(t *testing.T) {
+	am := newTestAPIManager()
+	a, _ := am.NewAPI("test")
+	a.Address = freeAddress(t)
+	ae := a.NewEndPoint("hello", "", "/hello", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil,
+		func(aepr *DXAPIEndPointRequest) error {
+			aepr.WriteResponseAsString(http.StatusOK, nil, "original")
+			return nil
+		}, nil, nil, nil, nil)
+	if found := a.FindEndPointByURI("/hello"); found != ae {
+		t.Fatal("FindEndPointByURI does not return the endpoint NewEndPoint returned")
+	}
+	startTestAPI(t, am, a)
+	defer func() { _ = am.StopAll() }()
+
+	// Both changed once the server runs, through the pointers NewEndPoint and FindEndPointByURI returned
+	ae.OnExecute = func(aepr *DXAPIEndPointRequest) error {
+		aepr.WriteResponseAsString(http.StatusOK, nil, "changed")
+		return nil
+	}
+	a.FindEndPointByURI("/hello").Middlewares = append(a.FindEndPointByURI("/hello").Middlewares, func(aepr *DXAPIEndPointRequest) error {
+		(*aepr.GetResponseWriter()).Header().Set("X-Test-Middleware", "ran")
+		return nil
+	})
+
+	r, err := http.Get("http://" + a.Address + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	body, _ := io.ReadAll(r.Body)
+	if string(body) != "changed" {
+		t.Fatalf("the request ran the handler of the registration, body %q", body)
+	}
+	if r.Header.Get("X-Test-Middleware") != "ran" {
+		t.Fatal("the middleware added after the registration did not run")
+	}
+}
+
+func TestNewEndPointKeepsTheFirstOfDuplicates(t *testing.T) {
+	behavior := log.GetFatalBehavior()
+	log.SetFatalBehavior(log.DXLogFatalBehaviorErrorOnly)
+	defer log.SetFatalBehavior(behavior)
+	am := newTestAPIManager()
+	a, _ := am.NewAPI("test")
+	first := a.NewEndPoint("first", "", "/dup", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil, nil, nil, nil, nil, nil)
+	second := a.NewEndPoint("second", "", "/dup", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil, nil, nil, nil, nil, nil)
+	if second != first || a.FindEndPointByURI("/dup") != first {
+		t.Fatal("the duplicate replaced the first registration")
+	}
+	if len(a.EndPoints) != 1 {
+		t.Fatalf("got %d endpoints", len(a.EndPoints))
+	}
+}
+
+func TestFatalConfigurationErrorsReturnWhenFatalDoesNotExit(t *testing.T) {
+	for _, behavior := range []log.DXLogFatalBehavior{log.DXLogFatalBehaviorErrorOnly, log.DXLogFatalBehaviorPanicOnly} {
+		previous := log.GetFatalBehavior()
+		log.SetFatalBehavior(behavior)
+		am := newTestAPIManager()
+		a, _ := am.NewAPI("test")
+		var errLoad, errApply error
+		recovered := func() (r any) {
+			defer func() { r = recover() }()
+			errLoad = am.LoadFromConfiguration("missing-configuration")
+			return nil
+		}()
+		if behavior == log.DXLogFatalBehaviorPanicOnly {
+			if recovered == nil {
+				t.Errorf("behavior %d: LoadFromConfiguration did not panic", behavior)
+			}
+		} else {
+			errApply = a.ApplyConfigurations("missing-configuration")
+			if errLoad == nil || errApply == nil {
+				t.Errorf("behavior %d: the missing configuration was not reported, %v, %v", behavior, errLoad, errApply)
+			}
+		}
+		log.SetFatalBehavior(previous)
+	}
+}
+
+// testSpan is a recording span, the no-op spans of the default provider never are and so carry no ids to the logs
+type testSpan struct {
+	trace.Span
+	spanContext trace.SpanContext
+}
+
+func (s testSpan) IsRecording() bool              { return true }
+func (s testSpan) SpanContext() trace.SpanContext { return s.spanContext }
+
+type testTracerProvider struct {
+	trace.TracerProvider
+	spanCount atomic.Int64
+}
+
+func (p *testTracerProvider) Tracer(name string, options ...trace.TracerOption) trace.Tracer {
+	return testTracer{Tracer: p.TracerProvider.Tracer(name, options...), provider: p}
+}
+
+type testTracer struct {
+	trace.Tracer
+	provider *testTracerProvider
+}
+
+// Start gives the child spans the trace id of their parent, a new one to the roots
+func (t testTracer) Start(ctx context.Context, spanName string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	n := t.provider.spanCount.Add(1)
+	traceId := trace.SpanContextFromContext(ctx).TraceID()
+	if !traceId.IsValid() {
+		binary.BigEndian.PutUint64(traceId[8:], uint64(n))
+	}
+	var spanId trace.SpanID
+	binary.BigEndian.PutUint64(spanId[:], uint64(n))
+	span := testSpan{
+		Span:        trace.SpanFromContext(context.Background()),
+		spanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceId, SpanID: spanId, TraceFlags: trace.FlagsSampled}),
+	}
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func TestRequestLogsCarryTheTraceIdOfTheRequestSpan(t *testing.T) {
+	otel.SetTracerProvider(&testTracerProvider{TracerProvider: noop.NewTracerProvider()})
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	var output bytes.Buffer
+	previousOutput := logrus.StandardLogger().Out
+	log.SetOutput(&output)
+	defer log.SetOutput(previousOutput)
+
+	am := newTestAPIManager()
+	a, _ := am.NewAPI("test")
+	spanTraceIds := make(chan string, 2)
+	ae := a.NewEndPoint("traced", "", "/traced", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil,
+		func(aepr *DXAPIEndPointRequest) error {
+			spanTraceIds <- trace.SpanContextFromContext(aepr.Context).TraceID().String()
+			aepr.Log.Info("in handler")
+			// A child span, like the one of a database helper, keeps the trace of the request
+			ctx, span := otel.Tracer("db").Start(aepr.Context, "db.select")
+			defer span.End()
+			childLog := log.NewLog(&aepr.Log, ctx, "db")
+			childLog.Info("in helper")
+			aepr.WriteResponseAsString(http.StatusOK, nil, "ok")
+			return nil
+		}, nil, nil, nil, nil)
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		ae.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/traced", nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status %d", recorder.Code)
+		}
+	}
+	close(spanTraceIds)
+
+	recordTraceIds := map[string][]string{}
+	for _, line := range strings.Split(output.String(), "\n") {
+		var record map[string]any
+		if json.Unmarshal([]byte(line), &record) != nil {
+			continue
+		}
+		message, _ := record[log.DXLogFieldMessage].(string)
+		if message == "in handler" || message == "in helper" {
+			traceId, _ := record[log.DXLogFieldTraceId].(string)
+			recordTraceIds[traceId] = append(recordTraceIds[traceId], message)
+		}
+	}
+	var previous string
+	for traceId := range spanTraceIds {
+		if traceId == previous {
+			t.Fatal("the two requests share a trace id")
+		}
+		previous = traceId
+		if got := recordTraceIds[traceId]; len(got) != 2 {
+			t.Errorf("trace %s: records %v, all %v", traceId, got, recordTraceIds)
+		}
+	}
+}
+
+// A request rejected by the concurrency limiter answers 503 before its audit log starts, the version endpoint keeps answering
+func TestConcurrencyLimiterRejectsBeforeTheAuditLog(t *testing.T) {
+	am := newTestAPIManager()
+	defer am.Cancel()
+	a, _ := am.NewAPI("test")
+	a.MaxConcurrentRequests = 1
+	a.QueueTimeoutMs = 10
+	a.initConcurrencyLimiter()
+	a.IsVersionEndPointEnabled = true
+	a.registerVersionEndPoint()
+	var auditLogStarts atomic.Int64
+	a.OnAuditLogStart = func(id int64, entry *DXAPIAuditLogEntry) (int64, error) {
+		auditLogStarts.Add(1)
+		return id, nil
+	}
+	release := make(chan struct{})
+	ae := a.NewEndPoint("slow", "", "/slow", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil,
+		func(aepr *DXAPIEndPointRequest) error {
+			<-release
+			aepr.WriteResponseAsString(http.StatusOK, nil, "ok")
+			return nil
+		}, nil, nil, nil, nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ae.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}()
+	waitUntil(t, 5*time.Second, func() bool { return a.ConcurrencyUtilization().InFlight == 1 })
+
+	w := httptest.NewRecorder()
+	ae.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("the saturated endpoint answered %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if auditLogStarts.Load() != 1 {
+		t.Fatalf("%d audit logs started", auditLogStarts.Load())
+	}
+	w = httptest.NewRecorder()
+	a.FindEndPointByURI(DXAPIVersionEndPointUri).ServeHTTP(w, httptest.NewRequest(http.MethodGet, DXAPIVersionEndPointUri, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("the version endpoint answered %d", w.Code)
+	}
+	close(release)
+	<-done
+}
+
+// benchmarkRouteHandler serves requests of /bench, answered with body, through the whole routeHandler
+func benchmarkRouteHandler(b *testing.B, body utils.JSON) {
+	previousOutput := logrus.StandardLogger().Out
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(previousOutput)
+	am := newTestAPIManager()
+	defer am.Cancel()
+	a, _ := am.NewAPI("test")
+	ae := a.NewEndPoint("bench", "", "/bench", http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil,
+		func(aepr *DXAPIEndPointRequest) error {
+			aepr.WriteResponseAsJSON(http.StatusOK, nil, body)
+			return nil
+		}, nil, nil, nil, nil)
+	r := httptest.NewRequest(http.MethodGet, "/bench", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ae.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
+
+func BenchmarkRouteHandlerSmallJSON(b *testing.B) {
+	benchmarkRouteHandler(b, utils.JSON{"id": 1, "name": "order", "is_paid": true})
+}
+
+func BenchmarkRouteHandlerLargeList(b *testing.B) {
+	list := make([]utils.JSON, 1000)
+	for i := range list {
+		list[i] = utils.JSON{"id": i, "name": "order " + strconv.Itoa(i), "amount": float64(i) * 1.5, "is_paid": i%2 == 0}
+	}
+	benchmarkRouteHandler(b, utils.JSON{"list": list, "total_rows": len(list)})
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/donnyhardyanto/dxlib/core"
+	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
+)
+
+const DXAPIVersionEndPointUri = "/version"
+
+// APIHandlerVersion answers core.GetBuildInfo as JSON
+func APIHandlerVersion(aepr *DXAPIEndPointRequest) (err error) {
+	body, err := json.Marshal(core.GetBuildInfo())
+	if err != nil {
+		return err
+	}
+	aepr.ResponseSetNoCache()
+	aepr.WriteResponseAsBytes(http.StatusOK, map[string]string{"Content-Type": "application/json"}, body)
+	return nil
+}
+
+func (a *DXAPI) registerVersionEndPoint() {
+	if !a.IsVersionEndPointEnabled || a.FindEndPointByURI(DXAPIVersionEndPointUri) != nil {
+		return
+	}
+	p := a.NewEndPoint("Version", "The build of the service, the Go version and the start time of the process", DXAPIVersionEndPointUri,
+		http.MethodGet, EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, nil, APIHandlerVersion, nil, nil, nil, nil)
+	p.IsBypassConcurrencyLimiter = true
+}
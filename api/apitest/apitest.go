@@ -0,0 +1,96 @@
+// Package apitest runs DXAPIEndPoint handlers in unit tests, without a listener, through the same code path as the server.
+package apitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/api"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+type DXAPITestResult struct {
+	StatusCode int
+	Header     http.Header
+	RawBody    []byte
+	// Body is the response parsed as JSON, nil when the response is not a JSON object
+	Body utils.JSON
+}
+
+// NewTestRequest builds the HTTP request the way a client would send it: the body goes to the query string for GET and DELETE,
+// and is JSON encoded otherwise.
+func NewTestRequest(endpoint *api.DXAPIEndPoint, method string, body utils.JSON, headers map[string]string) (r *http.Request, err error) {
+	target := endpoint.Uri
+	var bodyAsBytes []byte
+	switch method {
+	case http.MethodGet, http.MethodDelete:
+		if len(body) > 0 {
+			query := url.Values{}
+			for k, v := range body {
+				query.Set(k, fmt.Sprintf("%v", v))
+			}
+			target += "?" + query.Encode()
+		}
+	default:
+		if body != nil {
+			bodyAsBytes, err = json.Marshal(body)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	r = httptest.NewRequest(method, target, bytes.NewReader(bodyAsBytes))
+	if bodyAsBytes != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	return r, nil
+}
+
+// NewTestEndPointRequest returns a request already through PreProcessRequest, for tests calling OnExecute or parameter getters
+// directly. err is the PreProcessRequest error, whose response is then in the recorder.
+func NewTestEndPointRequest(endpoint *api.DXAPIEndPoint, method string, body utils.JSON, headers map[string]string) (aepr *api.DXAPIEndPointRequest, recorder *httptest.ResponseRecorder, err error) {
+	r, err := NewTestRequest(endpoint, method, body, headers)
+	if err != nil {
+		return nil, nil, err
+	}
+	recorder = httptest.NewRecorder()
+	aepr = endpoint.NewEndPointRequest(r.Context(), recorder, r)
+	err = aepr.PreProcessRequest()
+	return aepr, recorder, err
+}
+
+// ExecuteEndPoint runs the endpoint like routeHandler does and returns the recorded response. A panic in the handler fails the
+// test with its stack instead of only becoming a 500.
+func ExecuteEndPoint(t testing.TB, endpoint *api.DXAPIEndPoint, method string, body utils.JSON, headers map[string]string) (result DXAPITestResult) {
+	t.Helper()
+	r, err := NewTestRequest(endpoint, method, body, headers)
+	if err != nil {
+		t.Fatalf("apitest: cannot build the request: %v", err)
+	}
+	r = r.WithContext(api.ContextWithPanicHandler(r.Context(), func(recovered any, stack []byte) {
+		t.Errorf("apitest: panic in %s %s: %v\n%s", method, endpoint.Uri, recovered, stack)
+	}))
+	recorder := httptest.NewRecorder()
+	endpoint.ServeHTTP(recorder, r)
+
+	result = DXAPITestResult{
+		StatusCode: recorder.Code,
+		Header:     recorder.Header(),
+		RawBody:    recorder.Body.Bytes(),
+	}
+	if len(result.RawBody) > 0 {
+		var parsed utils.JSON
+		if json.Unmarshal(result.RawBody, &parsed) == nil {
+			result.Body = parsed
+		}
+	}
+	return result
+}
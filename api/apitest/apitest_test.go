@@ -0,0 +1,129 @@
+package apitest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/api"
+	"github.com/donnyhardyanto/dxlib/utils"
+	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
+)
+
+func newTestAPI(t *testing.T) *api.DXAPI {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	am := &api.DXAPIManager{Context: ctx, Cancel: cancel, APIs: map[string]*api.DXAPI{}}
+	a, err := am.NewAPI("apitest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func newGreetEndPoint(a *api.DXAPI, onExecute api.DXAPIEndPointExecuteFunc) *api.DXAPIEndPoint {
+	return a.NewEndPoint("greet", "", "/greet", http.MethodPost, api.EndPointTypeHTTPJSON, utilsHttp.ContentTypeApplicationJSON,
+		[]api.DXAPIEndPointParameter{
+			{NameId: "name", Type: "string", Description: "Who to greet", IsMustExist: true},
+		}, onExecute, nil, nil, nil, nil)
+}
+
+func greet(aepr *api.DXAPIEndPointRequest) error {
+	_, name, err := aepr.GetParameterValueAsString("name")
+	if err != nil {
+		return err
+	}
+	aepr.WriteResponseAsJSON(http.StatusOK, nil, utils.JSON{"greeting": "hello " + name})
+	return nil
+}
+
+func TestExecuteEndPoint(t *testing.T) {
+	endpoint := newGreetEndPoint(newTestAPI(t), greet)
+	result := ExecuteEndPoint(t, endpoint, http.MethodPost, utils.JSON{"name": "world"}, nil)
+	if result.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", result.StatusCode, result.RawBody)
+	}
+	if result.Body["greeting"] != "hello world" {
+		t.Fatalf("body %v", result.Body)
+	}
+}
+
+func TestExecuteEndPointValidatesLikeTheServer(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body utils.JSON
+	}{
+		{name: "missing parameter", body: utils.JSON{}},
+		{name: "wrong parameter type", body: utils.JSON{"name": 42}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			isExecuted := false
+			endpoint := newGreetEndPoint(newTestAPI(t), func(aepr *api.DXAPIEndPointRequest) error {
+				isExecuted = true
+				return greet(aepr)
+			})
+			result := ExecuteEndPoint(t, endpoint, http.MethodPost, tc.body, nil)
+			if result.StatusCode != http.StatusUnprocessableEntity && result.StatusCode != http.StatusBadRequest {
+				t.Fatalf("status %d: %s", result.StatusCode, result.RawBody)
+			}
+			if isExecuted {
+				t.Fatal("OnExecute ran with an invalid request")
+			}
+		})
+	}
+}
+
+func TestNewTestEndPointRequest(t *testing.T) {
+	endpoint := newGreetEndPoint(newTestAPI(t), greet)
+	aepr, _, err := NewTestEndPointRequest(endpoint, http.MethodPost, utils.JSON{"name": "world"}, map[string]string{"X-Test": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, name, err := aepr.GetParameterValueAsString("name")
+	if err != nil || name != "world" {
+		t.Fatalf("name %q, err %v", name, err)
+	}
+	if aepr.Request.Header.Get("X-Test") != "1" {
+		t.Fatal("the header of the request is missing")
+	}
+
+	_, recorder, err := NewTestEndPointRequest(endpoint, http.MethodPost, utils.JSON{}, nil)
+	if err == nil {
+		t.Fatal("PreProcessRequest accepted a request without its mandatory parameter")
+	}
+	if recorder.Code < 400 {
+		t.Fatalf("the rejection was answered with %d", recorder.Code)
+	}
+}
+
+// recordingTB records the failures of the test it wraps instead of failing it
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestExecuteEndPointFailsTheTestOnPanic(t *testing.T) {
+	endpoint := newGreetEndPoint(newTestAPI(t), func(aepr *api.DXAPIEndPointRequest) error {
+		panic("boom")
+	})
+	tb := &recordingTB{TB: t}
+	result := ExecuteEndPoint(tb, endpoint, http.MethodPost, utils.JSON{"name": "world"}, nil)
+	if len(tb.errors) != 1 {
+		t.Fatalf("the panic gave %d test failures", len(tb.errors))
+	}
+	if !strings.Contains(tb.errors[0], "boom") || !strings.Contains(tb.errors[0], "goroutine") {
+		t.Fatalf("the failure has no panic value or stack: %s", tb.errors[0])
+	}
+	if result.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("status %d", result.StatusCode)
+	}
+}
@@ -1,7 +1,11 @@
 package oam
 
 import (
+	"encoding/json"
 	"github.com/donnyhardyanto/dxlib/api"
+	"github.com/donnyhardyanto/dxlib/configuration"
+	"github.com/donnyhardyanto/dxlib/core"
+	"github.com/donnyhardyanto/dxlib/log"
 	"io"
 	"net/http"
 )
@@ -40,3 +44,76 @@ func Ping(aepr *api.DXAPIEndPointRequest) (err error) {
 	aepr.WriteResponseAsJSON(http.StatusOK, nil, data)
 	return err
 }
+
+// ConfigurationDump answers the effective configuration of every module with the secrets masked. It is not registered by
+// default, an application opts in by registering it, preferably with privileges, on an admin API.
+func ConfigurationDump(aepr *api.DXAPIEndPointRequest) (err error) {
+	dump, err := configuration.Manager.DumpAll(nil)
+	if err != nil {
+		return err
+	}
+	aepr.ResponseSetNoCache()
+	aepr.WriteResponseAsBytes(http.StatusOK, map[string]string{"Content-Type": "application/json"}, dump)
+	return nil
+}
+
+// LogLevel answers the log levels and changes one when the parameter level is given: the level of the parameter prefix, or
+// the global level without prefix. The level "default" makes the prefix follow the global level again. Like
+// ConfigurationDump it is meant for an admin API, with the optional string parameters prefix and level declared.
+func LogLevel(aepr *api.DXAPIEndPointRequest) (err error) {
+	_, prefix, err := aepr.GetParameterValueAsString("prefix")
+	if err != nil {
+		return err
+	}
+	isLevelExist, levelAsString, err := aepr.GetParameterValueAsString("level")
+	if err != nil {
+		return err
+	}
+	if isLevelExist && levelAsString != "" {
+		if prefix != "" && levelAsString == "default" {
+			log.ClearPrefixLevel(prefix)
+		} else {
+			level, err := log.ParseLevel(levelAsString)
+			if err != nil {
+				return aepr.WriteResponseAndNewErrorf(http.StatusBadRequest, "%s", err.Error())
+			}
+			if prefix != "" {
+				log.SetPrefixLevel(prefix, level)
+			} else {
+				log.SetLevel(level)
+			}
+		}
+		aepr.Log.Infof("LOG_LEVEL_CHANGED:prefix=%s level=%s", prefix, levelAsString)
+	}
+	aepr.ResponseSetNoCache()
+	aepr.WriteResponseAsJSON(http.StatusOK, nil, log.GetLevels())
+	return nil
+}
+
+func writeHealthSnapshot(aepr *api.DXAPIEndPointRequest, isHealthy bool, snapshot core.DXHealthSnapshot) (err error) {
+	body, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	statusCode := http.StatusOK
+	if !isHealthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+	aepr.ResponseSetNoCache()
+	aepr.WriteResponseAsBytes(statusCode, map[string]string{"Content-Type": "application/json"}, body)
+	return nil
+}
+
+// Readiness answers the readiness checks of core.Health, /readyz, with 503 while one of them fails. A handler can't opt out of
+// MaxConcurrentRequests, the endpoint registering it must set IsBypassConcurrencyLimiter.
+func Readiness(aepr *api.DXAPIEndPointRequest) (err error) {
+	snapshot := core.Health.Snapshot(aepr.Request.Context(), core.DXHealthCheckKindReadiness)
+	return writeHealthSnapshot(aepr, snapshot.IsReady, snapshot)
+}
+
+// Liveness answers the liveness checks of core.Health, /livez, with 503 while one of them fails. Like Readiness, the endpoint
+// registering it must set IsBypassConcurrencyLimiter.
+func Liveness(aepr *api.DXAPIEndPointRequest) (err error) {
+	snapshot := core.Health.Snapshot(aepr.Request.Context(), core.DXHealthCheckKindLiveness)
+	return writeHealthSnapshot(aepr, snapshot.IsLive, snapshot)
+}
@@ -144,6 +144,8 @@ func (a *DXApp) loadConfiguration() (err error) {
 }
 func (a *DXApp) start() (err error) {
 	log.Log.Info(fmt.Sprintf("%v %v %v", a.Title, a.Version, a.Description))
+	buildInfo := core.GetBuildInfo()
+	log.Log.Infof("Build version=%s commit=%s build_time=%s go=%s", buildInfo.Version, buildInfo.Commit, buildInfo.BuildTime, buildInfo.GoVersion)
 	err = a.loadConfiguration()
 	if err != nil {
 		return err
@@ -263,6 +265,8 @@ func (a *DXApp) Stop() (err error) {
 }
 
 func (a *DXApp) execute() (err error) {
+	// Deferred first so it runs last, after Stop, and the log file still gets the shutdown records
+	defer core.RunShutdownHooks()
 	defer core.RootContextCancel()
 	a.RuntimeErrorGroup, a.RuntimeErrorGroupContext = errgroup.WithContext(core.RootContext)
 	err = a.start()
@@ -327,3 +331,48 @@ func init() {
 		LocalData: map[string]any{},
 	}
 }
+
+// RunMigrations runs the migration command of os.Args, see database.RunMigrationCommand, on the migrations of dir for the
+// database databaseNameId of the storage configuration, outside of Run: only the vault, OnDefine, OnDefineConfiguration and
+// the configurations are set up, the database alone is connected
+func (a *DXApp) RunMigrations(databaseNameId string, dir string) (err error) {
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "create" {
+		return database.RunMigrationCommand(nil, dir, args, os.Stdout)
+	}
+	if a.InitVault != nil {
+		err = a.InitVault.Start()
+		if err != nil {
+			return err
+		}
+	}
+	if a.OnDefine != nil {
+		err = a.OnDefine()
+		if err != nil {
+			return err
+		}
+	}
+	if a.OnDefineConfiguration != nil {
+		err = a.OnDefineConfiguration()
+		if err != nil {
+			return err
+		}
+	}
+	err = a.loadConfiguration()
+	if err != nil {
+		return err
+	}
+	d, ok := database.Manager.Databases[databaseNameId]
+	if !ok {
+		return log.Log.ErrorAndCreateErrorf("MIGRATION_DATABASE_NOT_FOUND:%s", databaseNameId)
+	}
+	defer func() {
+		_ = d.Disconnect()
+	}()
+	err = database.RunMigrationCommand(d, dir, args, os.Stdout)
+	if err != nil {
+		log.Log.Error(err.Error())
+		return err
+	}
+	return nil
+}
@@ -2,14 +2,20 @@ package configuration
 
 import (
 	"encoding/json"
+	"errors"
 	"gopkg.in/yaml.v3"
 	"os"
+	"time"
 
+	"github.com/donnyhardyanto/dxlib/core"
 	"github.com/donnyhardyanto/dxlib/log"
 	"github.com/donnyhardyanto/dxlib/utils"
 	json2 "github.com/donnyhardyanto/dxlib/utils/json"
 )
 
+// DXConfigurationLogNameId is the optional configuration holding the log settings, see applyLogConfiguration
+const DXConfigurationLogNameId = "log"
+
 type DXConfiguration struct {
 	Owner            *DXConfigurationManager
 	NameId           string
@@ -19,12 +25,42 @@ type DXConfiguration struct {
 	MustLoadFile     bool
 	Data             *utils.JSON
 	SensitiveDataKey []string
+	// SourceType is DXConfigurationSourceTypeFile (the default) or DXConfigurationSourceTypeHTTP, which reads from HTTPSource
+	SourceType string
+	HTTPSource *DXConfigurationHTTPSource
+	// OnChange is called after Refresh loaded a new version of the configuration
+	OnChange func(c *DXConfiguration)
+	layers   map[string][]DXConfigurationLayerValue
+	watchers []DXConfigurationWatchFunc
+}
+
+type DXConfigurationWatchFunc func(c *DXConfiguration)
+
+// Watch registers fn to be called after OnChange every time a new version of the configuration is loaded, it lets modules
+// react to changes without taking OnChange away from the application
+func (c *DXConfiguration) Watch(fn DXConfigurationWatchFunc) {
+	c.watchers = append(c.watchers, fn)
+}
+
+func (c *DXConfiguration) notifyChange() {
+	if c.OnChange != nil {
+		c.OnChange(c)
+	}
+	for _, fn := range c.watchers {
+		fn(c)
+	}
 }
 
 type DXConfigurationPrefixKeywordResolver = func(text string) (err error)
 
 type DXConfigurationManager struct {
 	Configurations map[string]*DXConfiguration
+	// Environment selects the override files (storage.<Environment>.json), it defaults to the DXLIB_ENVIRONMENT variable
+	Environment string
+	// Profile selects the "profiles" sub-tree merged over the base values of every file, it defaults to the DXLIB_PROFILE variable
+	Profile  string
+	Schemas  map[string]*DXConfigurationSchema
+	Defaults map[string]utils.JSON
 }
 
 func (cm *DXConfigurationManager) GetConfigurationData(nameId string) (data *utils.JSON, err error) {
@@ -76,13 +112,13 @@ func (c *DXConfiguration) FilterSensitiveData() (r utils.JSON) {
 	r = json2.Copy(*c.Data)
 
 	for _, v := range c.SensitiveDataKey {
-		utils.SetValueInNestedMap(r, v, "********")
+		utils.SetValueInNestedMap(r, v, DXConfigurationRedactedValue)
 	}
 	return r
 }
 
 func (c *DXConfiguration) ShowToLog() {
-	filteredData := c.FilterSensitiveData()
+	filteredData := c.Redacted()
 	dataAsString, err := json.MarshalIndent(filteredData, "", "  ")
 	if err != nil {
 		log.Log.Panic("DXConfiguration/ShowToLog/1", err)
@@ -101,7 +137,7 @@ func (c *DXConfiguration) AsString() string {
 }
 
 func (c *DXConfiguration) AsNonSensitiveString() string {
-	filteredData := c.FilterSensitiveData()
+	filteredData := c.Redacted()
 	dataAsString, err := json.MarshalIndent(filteredData, "", "  ")
 	if err != nil {
 		log.Log.Panic("DXConfiguration/AsString/1", err)
@@ -127,6 +163,7 @@ func (c *DXConfiguration) LoadFromFile() (err error) {
 			log.Log.Fatalf("Can not parsing file %s, please check the file content (%v)", c.Filename, err.Error())
 			return err
 		}
+		v = c.applyProfile(DXConfigurationLayerFile, c.Filename, v)
 		*c.Data = json2.DeepMerge(v, *c.Data)
 	case "yaml":
 		v, err := c.ByteArrayYAMLToJSON(content)
@@ -134,13 +171,14 @@ func (c *DXConfiguration) LoadFromFile() (err error) {
 			log.Log.Fatalf("Can not parsing file %s, please check the file content (%v)", c.Filename, err.Error())
 			return err
 		}
+		v = c.applyProfile(DXConfigurationLayerFile, c.Filename, v)
 		*c.Data = json2.DeepMerge(v, *c.Data)
 	default:
 		err = log.Log.PanicAndCreateErrorf("DXConfiguration/Load/1", "unknown file format: %s", c.FileFormat)
 		return err
 	}
 	log.Log.Infof("Reading file %s... done", c.Filename)
-	return nil
+	return c.loadOverrideFile()
 }
 
 func (c *DXConfiguration) WriteToFile() (err error) {
@@ -168,23 +206,167 @@ func (cm *DXConfigurationManager) AsNonSensitiveString() (s string) {
 	}
 	return s
 }
+
+// applyLogConfiguration applies the "log" configuration when the application declared one:
+// {"format": "text"|"json", "level": "info", "prefix_levels": {"<prefix>": "trace"}, "file": "app.log", "file_max_size_mb": 100,
+// "file_max_age_days": 30, "file_max_backups": 7, "file_compress": true, "split_streams": true,
+// "syslog": {"network": "udp", "address": "host:514", "facility": 16, "tag": "app"}}. The syslog receives every record when
+// it is set, split_streams otherwise sends Warn and more severe to the standard error and the rest to the standard output.
+func (cm *DXConfigurationManager) applyLogConfiguration() {
+	c, ok := cm.Configurations[DXConfigurationLogNameId]
+	if !ok {
+		return
+	}
+	if _, err := c.GetJSON(`syslog`); err == nil {
+		network, _ := c.GetString(`syslog.network`)
+		address, _ := c.GetString(`syslog.address`)
+		tag, _ := c.GetString(`syslog.tag`)
+		facility, err := c.GetInt(`syslog.facility`)
+		if err != nil {
+			facility = log.DXSyslogFacilityUser
+		}
+		syslogWriter, err := log.NewSyslogWriter(network, address, facility, tag)
+		if err != nil {
+			log.Log.Errorf("Can not open the syslog of configuration %s (%v)", c.NameId, err.Error())
+		} else {
+			log.SetRoutes([]log.DXLogRoute{{MostSevereLevel: log.DXLogLevelPanic, LeastSevereLevel: log.DXLogLevelTrace, Writer: syslogWriter}})
+		}
+	} else if isSplitStreams, err := c.GetBool(`split_streams`); err == nil && isSplitStreams {
+		log.SetSplitStreams()
+	}
+	filename, err := c.GetString(`file`)
+	if err == nil && filename != "" {
+		opts := log.DXRotatingFileWriterOptions{Path: filename, MaxBackups: -1}
+		if v, err := c.GetInt(`file_max_size_mb`); err == nil {
+			opts.MaxSizeBytes = int64(v) * 1024 * 1024
+		}
+		if v, err := c.GetInt(`file_max_age_days`); err == nil {
+			opts.MaxAge = time.Duration(v) * 24 * time.Hour
+		}
+		if v, err := c.GetInt(`file_max_backups`); err == nil {
+			opts.MaxBackups = v
+		}
+		opts.IsCompress, _ = c.GetBool(`file_compress`)
+		err = log.SetFileOutput(opts)
+		if err != nil {
+			log.Log.Errorf("Can not open log file %s of configuration %s (%v)", filename, c.NameId, err.Error())
+		}
+	}
+	format, err := c.GetString(`format`)
+	if err == nil {
+		err = log.SetFormat(format)
+		if err != nil {
+			log.Log.Warnf("Invalid log format in configuration %s (%v)", c.NameId, err.Error())
+		}
+	}
+	levelAsString, err := c.GetString(`level`)
+	if err == nil {
+		level, err := log.ParseLevel(levelAsString)
+		if err != nil {
+			log.Log.Warnf("Invalid log level in configuration %s (%v)", c.NameId, err.Error())
+		} else {
+			log.SetLevel(level)
+		}
+	}
+	prefixLevels, err := c.GetJSON(`prefix_levels`)
+	if err == nil {
+		for prefix, v := range prefixLevels {
+			levelAsString, ok := v.(string)
+			if !ok {
+				log.Log.Warnf("Invalid log level of prefix %s in configuration %s", prefix, c.NameId)
+				continue
+			}
+			level, err := log.ParseLevel(levelAsString)
+			if err != nil {
+				log.Log.Warnf("Invalid log level of prefix %s in configuration %s (%v)", prefix, c.NameId, err.Error())
+				continue
+			}
+			log.SetPrefixLevel(prefix, level)
+		}
+	}
+}
+
 func (cm *DXConfigurationManager) Load() (err error) {
 	if len(cm.Configurations) > 0 {
 		log.Log.Info("Reading configuration file(s)...")
+		if cm.Environment == "" {
+			cm.Environment = os.Getenv(DXConfigurationEnvironmentVariable)
+		}
+		if cm.Profile == "" {
+			cm.Profile = os.Getenv(DXConfigurationProfileEnvironmentVariable)
+		}
+		if cm.Profile != "" {
+			log.Log.Infof("Configuration profile: %s", cm.Profile)
+		} else {
+			log.Log.Info("Configuration profile: (none)")
+		}
+		environ := os.Environ()
+		// Merge order: defaults given in code, file, environment specific override file, DXCONF_ environment variables
 		for _, v := range cm.Configurations {
+			v.layers = nil
+			if *v.Data == nil {
+				*v.Data = utils.JSON{}
+			}
+			v.recordLayer(DXConfigurationLayerDefault, "", json2.Copy(*v.Data))
 			if v.MustLoadFile {
-				_ = v.LoadFromFile()
+				if v.SourceType == DXConfigurationSourceTypeHTTP {
+					err = v.LoadFromHTTP(core.RootContext)
+					if err != nil && v.MustExist {
+						return err
+					}
+				} else {
+					_ = v.LoadFromFile()
+				}
+			}
+			v.applyEnvironmentOverrides(environ)
+			defaults, ok := cm.Defaults[v.NameId]
+			if ok {
+				v.applyModuleDefaults(defaults)
+			}
+			err = v.decryptValues(GetConfigurationKey)
+			if err != nil {
+				return err
 			}
 		}
+		// Every configuration is checked before reporting, so one run shows all the mistakes
+		var validationErrs []error
+		for nameId := range cm.Configurations {
+			errValidate := cm.Validate(nameId)
+			if errValidate != nil {
+				log.Log.Errorf("%s", errValidate.Error())
+				validationErrs = append(validationErrs, errValidate)
+			}
+		}
+		if len(validationErrs) > 0 {
+			return errors.Join(validationErrs...)
+		}
+		cm.applyLogConfiguration()
 		log.Log.Infof("Manager=\n%v", Manager.AsNonSensitiveString())
 	}
 	return nil
 }
 
+// Refresh downloads again every configuration read from an HTTP source, the watchers of the changed ones are called. The
+// configurations read from files are kept as they are.
+func (cm *DXConfigurationManager) Refresh() (err error) {
+	var errs []error
+	for _, v := range cm.Configurations {
+		if v.SourceType != DXConfigurationSourceTypeHTTP {
+			continue
+		}
+		_, errRefresh := v.Refresh(core.RootContext)
+		if errRefresh != nil {
+			errs = append(errs, errRefresh)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 var Manager DXConfigurationManager
 
 func init() {
 	Manager = DXConfigurationManager{
 		Configurations: map[string]*DXConfiguration{},
 	}
+	core.RegisterReloadHook("configuration", Manager.Refresh)
 }
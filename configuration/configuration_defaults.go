@@ -0,0 +1,106 @@
+package configuration
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/donnyhardyanto/dxlib/core"
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+	json2 "github.com/donnyhardyanto/dxlib/utils/json"
+)
+
+const (
+	// DXConfigurationDefaultsEveryEntryKey in a defaults object applies its value to every entry of the configuration, for the
+	// configurations made of named items like "storage" (one entry per database) or "api" (one entry per API)
+	DXConfigurationDefaultsEveryEntryKey = "*"
+	DXConfigurationLayerModuleDefault    = "module-default"
+	// The underscore keeps the key apart from the configuration names
+	dxConfigurationDumpProfileKey   = "_active_profile"
+	dxConfigurationDumpLogLevelsKey = "_log_levels"
+	dxConfigurationDumpBuildInfoKey = "_build_info"
+)
+
+// RegisterDefaults declares the defaults of a module for the configuration configName, they are merged under the values
+// provided by the application at load time.
+func RegisterDefaults(configName string, defaults utils.JSON) {
+	Manager.RegisterDefaults(configName, defaults)
+}
+
+func (cm *DXConfigurationManager) RegisterDefaults(configName string, defaults utils.JSON) {
+	if cm.Defaults == nil {
+		cm.Defaults = map[string]utils.JSON{}
+	}
+	existing, ok := cm.Defaults[configName]
+	if ok {
+		defaults = json2.DeepMerge(json2.Copy(defaults), existing)
+	}
+	cm.Defaults[configName] = defaults
+}
+
+// expandDefaults resolves the every entry key against the entries present in data
+func expandDefaults(defaults utils.JSON, data utils.JSON) utils.JSON {
+	r := utils.JSON{}
+	for k, v := range defaults {
+		if k != DXConfigurationDefaultsEveryEntryKey {
+			vm, ok := v.(utils.JSON)
+			if ok {
+				v = json2.Copy(vm)
+			}
+			r[k] = v
+			continue
+		}
+		entryDefaults, ok := v.(utils.JSON)
+		if !ok {
+			continue
+		}
+		for entryKey, entry := range data {
+			if _, isJSON := entry.(utils.JSON); isJSON {
+				r[entryKey] = json2.Copy(entryDefaults)
+			}
+		}
+	}
+	return r
+}
+
+func (c *DXConfiguration) applyModuleDefaults(defaults utils.JSON) {
+	expanded := expandDefaults(defaults, *c.Data)
+	flat := map[string]any{}
+	flattenKeyPaths("", expanded, flat)
+	for keyPath, v := range flat {
+		// Module defaults are the lowest layer, so they go first in Explain
+		c.layers[keyPath] = append([]DXConfigurationLayerValue{{Layer: DXConfigurationLayerModuleDefault, Value: v}}, c.layers[keyPath]...)
+	}
+	*c.Data = json2.DeepMerge(*c.Data, expanded)
+}
+
+// EffectiveConfiguration returns a copy of the merged configuration: module defaults, code defaults, files and environment
+func (cm *DXConfigurationManager) EffectiveConfiguration(configName string) (r utils.JSON, err error) {
+	c, ok := cm.Configurations[configName]
+	if !ok {
+		return nil, log.Log.WarnAndCreateErrorf("CONFIGURATION_NOT_FOUND:%s", configName)
+	}
+	return json2.Copy(*c.Data), nil
+}
+
+// DumpAll returns every effective configuration as one JSON document for support bundles. The SensitiveDataKey paths and every
+// key whose name contains one of redactKeys (DXConfigurationDefaultRedactKeys when nil) are masked.
+func (cm *DXConfigurationManager) DumpAll(redactKeys []string) (r []byte, err error) {
+	if redactKeys == nil {
+		redactKeys = DXConfigurationDefaultRedactKeys
+	}
+	names := make([]string, 0, len(cm.Configurations))
+	for k := range cm.Configurations {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	dump := utils.JSON{
+		dxConfigurationDumpProfileKey:   cm.Profile,
+		dxConfigurationDumpLogLevelsKey: log.GetLevels(),
+		dxConfigurationDumpBuildInfoKey: core.GetBuildInfo(),
+	}
+	for _, name := range names {
+		dump[name] = Redact(cm.Configurations[name].FilterSensitiveData(), redactKeys)
+	}
+	return json.MarshalIndent(dump, "", "  ")
+}
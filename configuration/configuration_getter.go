@@ -0,0 +1,178 @@
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+	json2 "github.com/donnyhardyanto/dxlib/utils/json"
+)
+
+var ErrConfigurationPathNotFound = errors.New("CONFIGURATION_PATH_NOT_FOUND")
+
+func (c *DXConfiguration) pathError(path string, format string, v ...any) error {
+	return fmt.Errorf("CONFIGURATION_PATH_INVALID:%s/%s:%s", c.NameId, path, fmt.Sprintf(format, v...))
+}
+
+// Get returns the value at path, a dot separated key path ("main.connection_options") with the array indices and escapes of
+// json2.GetByPath. A missing key is reported with an error wrapping ErrConfigurationPathNotFound.
+func (c *DXConfiguration) Get(path string) (v any, err error) {
+	if c.Data == nil {
+		return nil, fmt.Errorf("%w:%s/%s", ErrConfigurationPathNotFound, c.NameId, path)
+	}
+	v, ok := json2.GetByPath(*c.Data, path)
+	if !ok {
+		return nil, fmt.Errorf("%w:%s/%s", ErrConfigurationPathNotFound, c.NameId, path)
+	}
+	return v, nil
+}
+
+func (c *DXConfiguration) IsExist(path string) bool {
+	_, err := c.Get(path)
+	return err == nil
+}
+
+func (c *DXConfiguration) GetString(path string) (v string, err error) {
+	a, err := c.Get(path)
+	if err != nil {
+		return "", err
+	}
+	v, ok := a.(string)
+	if !ok {
+		return "", c.pathError(path, "expected string, got %s", schemaTypeOf(a))
+	}
+	return v, nil
+}
+
+func (c *DXConfiguration) GetInt(path string) (v int, err error) {
+	a, err := c.Get(path)
+	if err != nil {
+		return 0, err
+	}
+	switch t := a.(type) {
+	case int:
+		return t, nil
+	case int64:
+		return int(t), nil
+	case float64:
+		if t != math.Trunc(t) {
+			return 0, c.pathError(path, "expected integer, got %v", t)
+		}
+		return int(t), nil
+	default:
+		return 0, c.pathError(path, "expected integer, got %s", schemaTypeOf(a))
+	}
+}
+
+func (c *DXConfiguration) GetBool(path string) (v bool, err error) {
+	a, err := c.Get(path)
+	if err != nil {
+		return false, err
+	}
+	v, ok := a.(bool)
+	if !ok {
+		return false, c.pathError(path, "expected bool, got %s", schemaTypeOf(a))
+	}
+	return v, nil
+}
+
+// GetDuration accepts a time.ParseDuration string ("30s", "5m") or a number of seconds
+func (c *DXConfiguration) GetDuration(path string) (v time.Duration, err error) {
+	a, err := c.Get(path)
+	if err != nil {
+		return 0, err
+	}
+	v, err = json2.ParseDuration(a)
+	if err != nil {
+		return 0, c.pathError(path, "%s", err.Error())
+	}
+	return v, nil
+}
+
+func (c *DXConfiguration) GetStringSlice(path string) (v []string, err error) {
+	a, err := c.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	switch t := a.(type) {
+	case []string:
+		return t, nil
+	case []any:
+		v = make([]string, 0, len(t))
+		for i, item := range t {
+			s, ok := item.(string)
+			if !ok {
+				return nil, c.pathError(path, "item %d: expected string, got %s", i, schemaTypeOf(item))
+			}
+			v = append(v, s)
+		}
+		return v, nil
+	default:
+		return nil, c.pathError(path, "expected array of string, got %s", schemaTypeOf(a))
+	}
+}
+
+func (c *DXConfiguration) GetJSON(path string) (v utils.JSON, err error) {
+	a, err := c.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := a.(utils.JSON)
+	if !ok {
+		return nil, c.pathError(path, "expected object, got %s", schemaTypeOf(a))
+	}
+	return v, nil
+}
+
+// The MustGet variants end the application through FatalAndCreateErrorf when the value is missing or has the wrong type
+
+func (c *DXConfiguration) MustGetString(path string) string {
+	v, err := c.GetString(path)
+	if err != nil {
+		_ = log.Log.FatalAndCreateErrorf("%s", err.Error())
+	}
+	return v
+}
+
+func (c *DXConfiguration) MustGetInt(path string) int {
+	v, err := c.GetInt(path)
+	if err != nil {
+		_ = log.Log.FatalAndCreateErrorf("%s", err.Error())
+	}
+	return v
+}
+
+func (c *DXConfiguration) MustGetBool(path string) bool {
+	v, err := c.GetBool(path)
+	if err != nil {
+		_ = log.Log.FatalAndCreateErrorf("%s", err.Error())
+	}
+	return v
+}
+
+func (c *DXConfiguration) MustGetDuration(path string) time.Duration {
+	v, err := c.GetDuration(path)
+	if err != nil {
+		_ = log.Log.FatalAndCreateErrorf("%s", err.Error())
+	}
+	return v
+}
+
+func (c *DXConfiguration) MustGetStringSlice(path string) []string {
+	v, err := c.GetStringSlice(path)
+	if err != nil {
+		_ = log.Log.FatalAndCreateErrorf("%s", err.Error())
+	}
+	return v
+}
+
+func (c *DXConfiguration) MustGetJSON(path string) utils.JSON {
+	v, err := c.GetJSON(path)
+	if err != nil {
+		_ = log.Log.FatalAndCreateErrorf("%s", err.Error())
+	}
+	return v
+}
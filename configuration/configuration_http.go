@@ -0,0 +1,190 @@
+package configuration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+	json2 "github.com/donnyhardyanto/dxlib/utils/json"
+)
+
+const (
+	DXConfigurationSourceTypeFile = "file"
+	DXConfigurationSourceTypeHTTP = "http"
+
+	DXConfigurationDefaultHTTPTimeout = 10 * time.Second
+	dxConfigurationETagFileSuffix     = ".etag"
+)
+
+// DXConfigurationHTTPSource fetches a configuration from a URL. CacheFilename keeps the last good body, so a boot without the
+// config service still works, and its ETag so an unchanged configuration is not downloaded again.
+type DXConfigurationHTTPSource struct {
+	URL string
+	// BearerTokenEnvironmentVariable names the environment variable holding the token sent as Authorization: Bearer
+	BearerTokenEnvironmentVariable string
+	CacheFilename                  string
+	Timeout                        time.Duration
+	etag                           string
+}
+
+// NewHTTPConfiguration registers a configuration loaded from url. mustLoad makes a failed download fatal instead of falling
+// back to the cached copy.
+func (cm *DXConfigurationManager) NewHTTPConfiguration(nameId string, url string, fileFormat string, cacheFilename string, mustLoad bool, data utils.JSON, sensitiveDataKey []string) *DXConfiguration {
+	c := cm.NewConfiguration(nameId, cacheFilename, fileFormat, mustLoad, true, data, sensitiveDataKey)
+	c.SourceType = DXConfigurationSourceTypeHTTP
+	c.HTTPSource = &DXConfigurationHTTPSource{URL: url, CacheFilename: cacheFilename, Timeout: DXConfigurationDefaultHTTPTimeout}
+	return c
+}
+
+// fetch returns the body, or isNotModified when the server answered 304 to the ETag of the cached copy
+func (s *DXConfigurationHTTPSource) fetch(ctx context.Context) (body []byte, isNotModified bool, err error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DXConfigurationDefaultHTTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if s.BearerTokenEnvironmentVariable != "" {
+		token := os.Getenv(s.BearerTokenEnvironmentVariable)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	if s.etag == "" && s.CacheFilename != "" {
+		etag, errRead := os.ReadFile(s.CacheFilename + dxConfigurationETagFileSuffix)
+		if errRead == nil {
+			s.etag = strings.TrimSpace(string(etag))
+		}
+	}
+	if s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, true, nil
+	case http.StatusOK:
+	default:
+		return nil, false, fmt.Errorf("CONFIGURATION_HTTP_STATUS:%d", resp.StatusCode)
+	}
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	s.etag = resp.Header.Get("ETag")
+	if s.CacheFilename != "" {
+		errWrite := os.WriteFile(s.CacheFilename, body, 0600)
+		if errWrite == nil && s.etag != "" {
+			errWrite = os.WriteFile(s.CacheFilename+dxConfigurationETagFileSuffix, []byte(s.etag), 0600)
+		}
+		if errWrite != nil {
+			log.Log.Warnf("Can not write configuration cache file %s (%v)", s.CacheFilename, errWrite.Error())
+		}
+	}
+	return body, false, nil
+}
+
+func (c *DXConfiguration) readHTTPCache() (content []byte, err error) {
+	if c.HTTPSource.CacheFilename == "" {
+		return nil, errors.New("CONFIGURATION_HTTP_NO_CACHE_FILE")
+	}
+	return os.ReadFile(c.HTTPSource.CacheFilename)
+}
+
+// LoadFromHTTP downloads the configuration, and falls back to the cached copy with a warning when the download fails, unless
+// MustExist is set.
+func (c *DXConfiguration) LoadFromHTTP(ctx context.Context) (err error) {
+	s := c.HTTPSource
+	log.Log.Infof(`Fetching configuration %s from %s... start`, c.NameId, s.URL)
+	content, isNotModified, err := s.fetch(ctx)
+	if err != nil {
+		if c.MustExist {
+			log.Log.Fatalf("Can not fetch configuration %s from %s (%v)", c.NameId, s.URL, err.Error())
+			return err
+		}
+		log.Log.Warnf("Can not fetch configuration %s from %s, using the cached file %s (%v)", c.NameId, s.URL, s.CacheFilename, err.Error())
+	}
+	if err != nil || isNotModified {
+		content, err = c.readHTTPCache()
+		if err != nil {
+			log.Log.Warnf("Can not read configuration cache file %s (%v)", s.CacheFilename, err.Error())
+			return err
+		}
+	}
+	v, err := c.parseFileContent(s.URL, content)
+	if err != nil {
+		log.Log.Errorf("Can not parsing configuration %s from %s (%v)", c.NameId, s.URL, err.Error())
+		return err
+	}
+	v = c.applyProfile(DXConfigurationLayerHTTP, s.URL, v)
+	*c.Data = json2.DeepMerge(v, *c.Data)
+	log.Log.Infof(`Fetching configuration %s from %s... done`, c.NameId, s.URL)
+	return nil
+}
+
+// Refresh downloads the configuration again and calls OnChange and the watchers when the server sent different values
+func (c *DXConfiguration) Refresh(ctx context.Context) (isChanged bool, err error) {
+	if c.HTTPSource == nil {
+		return false, nil
+	}
+	content, isNotModified, err := c.HTTPSource.fetch(ctx)
+	if err != nil || isNotModified {
+		return false, err
+	}
+	v, err := c.parseFileContent(c.HTTPSource.URL, content)
+	if err != nil {
+		return false, err
+	}
+	v = c.applyProfile(DXConfigurationLayerHTTP, c.HTTPSource.URL, v)
+	hashBefore, errHash := json2.Hash(*c.Data)
+	*c.Data = json2.DeepMerge(v, *c.Data)
+	// The environment still wins over the downloaded values, and new encrypted values must not stay encrypted
+	c.applyEnvironmentOverrides(os.Environ())
+	err = c.decryptValues(GetConfigurationKey)
+	if err != nil {
+		return false, err
+	}
+	// A new version of the document with the same values, reordered or reformatted, is not a change
+	hashAfter, errHashAfter := json2.Hash(*c.Data)
+	if errHash == nil && errHashAfter == nil && hashBefore == hashAfter {
+		return false, nil
+	}
+	c.notifyChange()
+	return true, nil
+}
+
+// StartRefresh calls Refresh every interval until ctx is done
+func (c *DXConfiguration) StartRefresh(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_, err := c.Refresh(ctx)
+				if err != nil {
+					log.Log.Warnf("Can not refresh configuration %s from %s (%v)", c.NameId, c.HTTPSource.URL, err.Error())
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,190 @@
+package configuration
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+	json2 "github.com/donnyhardyanto/dxlib/utils/json"
+)
+
+const (
+	// DXConfigurationEnvironmentVariable selects the override file, storage.json is overridden by storage.<environment>.json
+	DXConfigurationEnvironmentVariable = "DXLIB_ENVIRONMENT"
+	// DXConfigurationEnvironmentOverridePrefix starts the variables overriding single keys, DXCONF_STORAGE__MAIN__ADDRESS sets
+	// main.address of the storage configuration. The key path separator is a double underscore and the match is case-insensitive.
+	DXConfigurationEnvironmentOverridePrefix = "DXCONF_"
+	dxConfigurationEnvironmentKeySeparator   = "__"
+
+	DXConfigurationLayerDefault     = "default"
+	DXConfigurationLayerFile        = "file"
+	DXConfigurationLayerOverride    = "override-file"
+	DXConfigurationLayerEnvironment = "environment"
+	DXConfigurationLayerHTTP        = "http"
+)
+
+type DXConfigurationLayerValue struct {
+	Layer  string
+	Source string
+	Value  any
+}
+
+// DXConfigurationExplanation lists every layer that set a key, in merge order, the last one is the effective value
+type DXConfigurationExplanation struct {
+	ConfigurationNameId string
+	KeyPath             string
+	Layers              []DXConfigurationLayerValue
+	EffectiveValue      any
+	IsExist             bool
+}
+
+// OverrideFilename returns the per environment file merged over Filename, empty when no environment is selected
+func (c *DXConfiguration) OverrideFilename() string {
+	environment := c.Owner.Environment
+	if environment == "" || c.Filename == "" {
+		return ""
+	}
+	ext := filepath.Ext(c.Filename)
+	return strings.TrimSuffix(c.Filename, ext) + "." + environment + ext
+}
+
+func flattenKeyPaths(prefix string, v any, r map[string]any) {
+	m, ok := v.(utils.JSON)
+	if !ok || len(m) == 0 {
+		if prefix != "" {
+			r[prefix] = v
+		}
+		return
+	}
+	for k, child := range m {
+		keyPath := k
+		if prefix != "" {
+			keyPath = prefix + "." + k
+		}
+		flattenKeyPaths(keyPath, child, r)
+	}
+}
+
+func (c *DXConfiguration) recordLayer(layer string, source string, data utils.JSON) {
+	if c.layers == nil {
+		c.layers = map[string][]DXConfigurationLayerValue{}
+	}
+	flat := map[string]any{}
+	flattenKeyPaths("", data, flat)
+	for keyPath, v := range flat {
+		c.layers[keyPath] = append(c.layers[keyPath], DXConfigurationLayerValue{Layer: layer, Source: source, Value: v})
+	}
+}
+
+func (c *DXConfiguration) parseFileContent(filename string, content []byte) (v utils.JSON, err error) {
+	switch c.FileFormat {
+	case "json":
+		return c.ByteArrayJSONToJSON(content)
+	case "yaml":
+		return c.ByteArrayYAMLToJSON(content)
+	default:
+		return nil, log.Log.PanicAndCreateErrorf("DXConfiguration/parseFileContent/1", "unknown file format: %s (%s)", c.FileFormat, filename)
+	}
+}
+
+// loadOverrideFile merges the environment specific file over the data, a missing override file is not an error
+func (c *DXConfiguration) loadOverrideFile() (err error) {
+	filename := c.OverrideFilename()
+	if filename == "" {
+		return nil
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		log.Log.Warnf("Can not reading override file %s (%v)", filename, err.Error())
+		return err
+	}
+	v, err := c.parseFileContent(filename, content)
+	if err != nil {
+		log.Log.Fatalf("Can not parsing file %s, please check the file content (%v)", filename, err.Error())
+		return err
+	}
+	v = c.applyProfile(DXConfigurationLayerOverride, filename, v)
+	*c.Data = json2.DeepMerge(v, *c.Data)
+	log.Log.Infof("Reading override file %s... done", filename)
+	return nil
+}
+
+// findKeyCaseInsensitive returns the existing key matching k, or k in lower case when there is none
+func findKeyCaseInsensitive(m utils.JSON, k string) string {
+	for existingKey := range m {
+		if strings.EqualFold(existingKey, k) {
+			return existingKey
+		}
+	}
+	return strings.ToLower(k)
+}
+
+// parseEnvironmentValue reads numbers, booleans, arrays and objects as JSON so they keep the type a file would give them
+func parseEnvironmentValue(s string) any {
+	var v any
+	if json.Unmarshal([]byte(s), &v) == nil {
+		return v
+	}
+	return s
+}
+
+func (c *DXConfiguration) applyEnvironmentOverrides(environ []string) {
+	prefix := DXConfigurationEnvironmentOverridePrefix + strings.ToUpper(c.NameId) + dxConfigurationEnvironmentKeySeparator
+	if c.layers == nil {
+		c.layers = map[string][]DXConfigurationLayerValue{}
+	}
+	sort.Strings(environ)
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(strings.ToUpper(name), prefix) {
+			continue
+		}
+		keys := strings.Split(name[len(prefix):], dxConfigurationEnvironmentKeySeparator)
+		m := *c.Data
+		var keyPath []string
+		for i, k := range keys {
+			if k == "" {
+				break
+			}
+			k = findKeyCaseInsensitive(m, k)
+			keyPath = append(keyPath, k)
+			if i == len(keys)-1 {
+				v := parseEnvironmentValue(value)
+				m[k] = v
+				c.layers[strings.Join(keyPath, ".")] = append(c.layers[strings.Join(keyPath, ".")], DXConfigurationLayerValue{
+					Layer: DXConfigurationLayerEnvironment, Source: name, Value: v,
+				})
+				break
+			}
+			next, isJSON := m[k].(utils.JSON)
+			if !isJSON {
+				next = utils.JSON{}
+				m[k] = next
+			}
+			m = next
+		}
+	}
+}
+
+// Explain tells where the value of keyPath (dot separated) in a configuration comes from: the defaults given in code, the file,
+// the environment specific override file and the DXCONF_ environment variables, in that merge order.
+func (cm *DXConfigurationManager) Explain(configurationNameId string, keyPath string) (r DXConfigurationExplanation, err error) {
+	c, ok := cm.Configurations[configurationNameId]
+	if !ok {
+		return r, log.Log.WarnAndCreateErrorf("CONFIGURATION_NOT_FOUND:%s", configurationNameId)
+	}
+	r = DXConfigurationExplanation{
+		ConfigurationNameId: configurationNameId,
+		KeyPath:             keyPath,
+		Layers:              c.layers[keyPath],
+	}
+	r.EffectiveValue, r.IsExist = json2.GetByPath(*c.Data, keyPath)
+	return r, nil
+}
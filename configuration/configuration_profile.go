@@ -0,0 +1,35 @@
+package configuration
+
+import (
+	"github.com/donnyhardyanto/dxlib/utils"
+	json2 "github.com/donnyhardyanto/dxlib/utils/json"
+)
+
+const (
+	// DXConfigurationProfileEnvironmentVariable selects the active profile when Manager.Profile is not set by the application
+	DXConfigurationProfileEnvironmentVariable = "DXLIB_PROFILE"
+	// DXConfigurationProfilesKey is the section of a configuration file holding one sub-tree per profile
+	DXConfigurationProfilesKey  = "profiles"
+	DXConfigurationLayerProfile = "profile"
+)
+
+// applyProfile records the content of a file as the layer, without its profiles section, then merges the sub-tree of the
+// active profile over it. The other profiles are dropped.
+func (c *DXConfiguration) applyProfile(layer string, source string, v utils.JSON) utils.JSON {
+	profiles, _ := v[DXConfigurationProfilesKey].(utils.JSON)
+	delete(v, DXConfigurationProfilesKey)
+	c.recordLayer(layer, source, v)
+	if profiles == nil {
+		return v
+	}
+	profile := c.Owner.Profile
+	if profile == "" {
+		return v
+	}
+	profileData, ok := profiles[profile].(utils.JSON)
+	if !ok {
+		return v
+	}
+	c.recordLayer(DXConfigurationLayerProfile, source+"#"+DXConfigurationProfilesKey+"."+profile, profileData)
+	return json2.DeepMerge(profileData, v)
+}
@@ -0,0 +1,132 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+	json2 "github.com/donnyhardyanto/dxlib/utils/json"
+)
+
+const profileTestFileContent = `{
+  "storage": {
+    "main": {"address": "localhost:5432", "user_name": "app", "pool": {"max_open": 10, "max_idle": 2}}
+  },
+  "api": {
+    "external": {"address": ":8080", "write_timeout_sec": 300}
+  },
+  "profiles": {
+    "staging": {
+      "storage": {"main": {"address": "staging-db:5432", "pool": {"max_open": 20}}},
+      "api": {"external": {"address": ":9090"}}
+    },
+    "prod": {
+      "storage": {"main": {"address": "prod-db:5432", "is_read_only": true}},
+      "api": {"internal": {"address": ":7070"}}
+    }
+  }
+}`
+
+func newProfileTestConfiguration(t *testing.T, profile string) *DXConfiguration {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "app.json")
+	err := os.WriteFile(filename, []byte(profileTestFileContent), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := &DXConfigurationManager{Configurations: map[string]*DXConfiguration{}, Profile: profile}
+	return cm.NewConfiguration("app", filename, "json", true, true, utils.JSON{}, nil)
+}
+
+func TestProfileMergedOverBaseValues(t *testing.T) {
+	for _, tc := range []struct {
+		profile string
+		values  map[string]any
+		missing []string
+	}{
+		{
+			profile: "",
+			values: map[string]any{
+				"storage.main.address":       "localhost:5432",
+				"storage.main.pool.max_open": float64(10),
+				"api.external.address":       ":8080",
+			},
+			missing: []string{"profiles", "storage.main.is_read_only", "api.internal"},
+		},
+		{
+			profile: "staging",
+			values: map[string]any{
+				"storage.main.address":           "staging-db:5432",
+				"storage.main.user_name":         "app",
+				"storage.main.pool.max_open":     float64(20),
+				"storage.main.pool.max_idle":     float64(2),
+				"api.external.address":           ":9090",
+				"api.external.write_timeout_sec": float64(300),
+			},
+			missing: []string{"profiles", "storage.main.is_read_only", "api.internal"},
+		},
+		{
+			profile: "prod",
+			values: map[string]any{
+				"storage.main.address":       "prod-db:5432",
+				"storage.main.is_read_only":  true,
+				"storage.main.pool.max_open": float64(10),
+				"api.external.address":       ":8080",
+				"api.internal.address":       ":7070",
+			},
+			missing: []string{"profiles"},
+		},
+		{
+			profile: "unknown",
+			values: map[string]any{
+				"storage.main.address": "localhost:5432",
+			},
+			missing: []string{"profiles", "api.internal"},
+		},
+	} {
+		t.Run("profile "+tc.profile, func(t *testing.T) {
+			c := newProfileTestConfiguration(t, tc.profile)
+			err := c.LoadFromFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for keyPath, want := range tc.values {
+				got, ok := json2.GetByPath(*c.Data, keyPath)
+				if !ok || !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: got %v (%v), want %v", keyPath, got, ok, want)
+				}
+			}
+			for _, keyPath := range tc.missing {
+				if got, ok := json2.GetByPath(*c.Data, keyPath); ok {
+					t.Errorf("%s should not be set, got %v", keyPath, got)
+				}
+			}
+		})
+	}
+}
+
+func TestProfileRecordedAsALayer(t *testing.T) {
+	c := newProfileTestConfiguration(t, "staging")
+	err := c.LoadFromFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Owner.Configurations[c.NameId] = c
+	r, err := c.Owner.Explain("app", "storage.main.address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Layers) != 2 || r.Layers[0].Layer != DXConfigurationLayerFile || r.Layers[1].Layer != DXConfigurationLayerProfile {
+		t.Fatalf("layers %+v", r.Layers)
+	}
+	if r.Layers[1].Source != c.Filename+"#profiles.staging" || r.EffectiveValue != "staging-db:5432" {
+		t.Fatalf("explanation %+v", r)
+	}
+	// The key of another profile only is never recorded
+	r, _ = c.Owner.Explain("app", "storage.main.is_read_only")
+	if r.IsExist || len(r.Layers) != 0 {
+		t.Fatalf("the prod profile leaked: %+v", r)
+	}
+}
@@ -0,0 +1,55 @@
+package configuration
+
+import (
+	"strings"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+const DXConfigurationRedactedValue = "********"
+
+var DXConfigurationDefaultRedactKeys = []string{"password", "secret", "token"}
+
+// Redact returns a deep copy of v where the value of every key whose name contains one of sensitiveKeys (case-insensitive) is
+// masked. v itself is left untouched, so the result can be logged or dumped safely.
+func Redact(v utils.JSON, sensitiveKeys []string) utils.JSON {
+	r, _ := redactValue(v, sensitiveKeys).(utils.JSON)
+	return r
+}
+
+func isSensitiveKey(k string, sensitiveKeys []string) bool {
+	lk := strings.ToLower(k)
+	for _, sensitiveKey := range sensitiveKeys {
+		if strings.Contains(lk, strings.ToLower(sensitiveKey)) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactValue(v any, sensitiveKeys []string) any {
+	switch t := v.(type) {
+	case utils.JSON:
+		r := make(utils.JSON, len(t))
+		for k, child := range t {
+			if isSensitiveKey(k, sensitiveKeys) {
+				r[k] = DXConfigurationRedactedValue
+				continue
+			}
+			r[k] = redactValue(child, sensitiveKeys)
+		}
+		return r
+	case []any:
+		r := make([]any, len(t))
+		for i, child := range t {
+			r[i] = redactValue(child, sensitiveKeys)
+		}
+		return r
+	}
+	return v
+}
+
+// Redacted returns the data with the SensitiveDataKey paths and the DXConfigurationDefaultRedactKeys key names masked
+func (c *DXConfiguration) Redacted() utils.JSON {
+	return Redact(c.FilterSensitiveData(), DXConfigurationDefaultRedactKeys)
+}
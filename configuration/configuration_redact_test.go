@@ -0,0 +1,89 @@
+package configuration
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// sentinelPassword is unique enough to be found in any output it leaks to
+const sentinelPassword = "S3ntinel-Pa55word-7f9c1e"
+
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buffer bytes.Buffer
+	previous := logrus.StandardLogger().Out
+	log.SetOutput(&buffer)
+	t.Cleanup(func() { log.SetOutput(previous) })
+	return &buffer
+}
+
+func newRedactTestConfiguration() *DXConfiguration {
+	cm := &DXConfigurationManager{Configurations: map[string]*DXConfiguration{}}
+	return cm.NewConfiguration("storage", "", "json", false, false, utils.JSON{
+		"main": utils.JSON{
+			"address":       "localhost:5432",
+			"user_name":     "app",
+			"user_password": sentinelPassword,
+			"replicas": []any{
+				utils.JSON{"address": "replica:5432", "Password": sentinelPassword},
+			},
+		},
+		"webhook": utils.JSON{"api_token": sentinelPassword, "client_secret": sentinelPassword},
+		"vault":   utils.JSON{"credential": sentinelPassword},
+	}, []string{"vault.credential"})
+}
+
+func TestRedact(t *testing.T) {
+	v := utils.JSON{
+		"password": sentinelPassword,
+		"nested":   utils.JSON{"DB_PASSWORD": sentinelPassword, "name": "kept"},
+		"list":     []any{utils.JSON{"token": sentinelPassword}, "plain"},
+	}
+	r := Redact(v, DXConfigurationDefaultRedactKeys)
+	want := utils.JSON{
+		"password": DXConfigurationRedactedValue,
+		"nested":   utils.JSON{"DB_PASSWORD": DXConfigurationRedactedValue, "name": "kept"},
+		"list":     []any{utils.JSON{"token": DXConfigurationRedactedValue}, "plain"},
+	}
+	gotAsBytes, _ := json.Marshal(r)
+	wantAsBytes, _ := json.Marshal(want)
+	if !bytes.Equal(gotAsBytes, wantAsBytes) {
+		t.Fatalf("got %s, want %s", gotAsBytes, wantAsBytes)
+	}
+	if v["password"] != sentinelPassword || v["nested"].(utils.JSON)["DB_PASSWORD"] != sentinelPassword {
+		t.Fatal("Redact changed its argument")
+	}
+}
+
+func TestSentinelPasswordNeverInConfigurationDumps(t *testing.T) {
+	c := newRedactTestConfiguration()
+	output := captureLog(t)
+	c.ShowToLog()
+	_ = c.Owner.ShowToLog()
+	dumps := map[string]string{
+		"log":                  output.String(),
+		"AsNonSensitiveString": c.AsNonSensitiveString(),
+		"manager":              c.Owner.AsNonSensitiveString(),
+	}
+	redactedAsBytes, _ := json.Marshal(c.Redacted())
+	dumps["Redacted"] = string(redactedAsBytes)
+	for name, dump := range dumps {
+		if strings.Contains(dump, sentinelPassword) {
+			t.Errorf("%s leaks the password: %s", name, dump)
+		}
+		if !strings.Contains(dump, "localhost:5432") {
+			t.Errorf("%s lost the values that are not secret: %s", name, dump)
+		}
+	}
+	// The data itself keeps the secrets, only its copies are redacted
+	if !strings.Contains(c.AsString(), sentinelPassword) {
+		t.Fatal("the configuration data was redacted in place")
+	}
+}
@@ -0,0 +1,161 @@
+package configuration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+const (
+	DXConfigurationSchemaTypeString = "string"
+	DXConfigurationSchemaTypeNumber = "number"
+	DXConfigurationSchemaTypeBool   = "bool"
+	DXConfigurationSchemaTypeObject = "object"
+	DXConfigurationSchemaTypeArray  = "array"
+)
+
+// DXConfigurationSchema describes a configuration value. Types lists the accepted types, any type when empty. Properties
+// describes the known keys of an object, EntrySchema describes every entry of an object used as a map of named items
+// (the databases of "storage", the APIs of "api").
+type DXConfigurationSchema struct {
+	Types       []string
+	Required    bool
+	Enum        []any
+	Properties  map[string]*DXConfigurationSchema
+	EntrySchema *DXConfigurationSchema
+	Items       *DXConfigurationSchema
+}
+
+type DXConfigurationSchemaViolation struct {
+	KeyPath string
+	Message string
+}
+
+// DXConfigurationValidationError reports every violation of a configuration at once
+type DXConfigurationValidationError struct {
+	ConfigurationNameId string
+	Violations          []DXConfigurationSchemaViolation
+}
+
+func (e *DXConfigurationValidationError) Error() string {
+	var lines []string
+	for _, v := range e.Violations {
+		lines = append(lines, v.KeyPath+": "+v.Message)
+	}
+	return fmt.Sprintf("CONFIGURATION_INVALID:%s:\n  %s", e.ConfigurationNameId, strings.Join(lines, "\n  "))
+}
+
+// RegisterSchema registers the schema the configuration nameId is validated against by Manager.Load
+func RegisterSchema(nameId string, schema *DXConfigurationSchema) {
+	Manager.RegisterSchema(nameId, schema)
+}
+
+func (cm *DXConfigurationManager) RegisterSchema(nameId string, schema *DXConfigurationSchema) {
+	if cm.Schemas == nil {
+		cm.Schemas = map[string]*DXConfigurationSchema{}
+	}
+	cm.Schemas[nameId] = schema
+}
+
+func schemaTypeOf(v any) string {
+	switch v.(type) {
+	case string:
+		return DXConfigurationSchemaTypeString
+	case bool:
+		return DXConfigurationSchemaTypeBool
+	case float64, float32, int, int64, int32, uint, uint64, uint32:
+		return DXConfigurationSchemaTypeNumber
+	case utils.JSON:
+		return DXConfigurationSchemaTypeObject
+	case []any, []string:
+		return DXConfigurationSchemaTypeArray
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func (s *DXConfigurationSchema) validate(keyPath string, v any, violations *[]DXConfigurationSchemaViolation) {
+	add := func(keyPath string, format string, a ...any) {
+		*violations = append(*violations, DXConfigurationSchemaViolation{KeyPath: keyPath, Message: fmt.Sprintf(format, a...)})
+	}
+	actualType := schemaTypeOf(v)
+	if len(s.Types) > 0 && !utils.IfStringInSlice(actualType, s.Types) {
+		add(keyPath, "expected %s, got %s", strings.Join(s.Types, " or "), actualType)
+		return
+	}
+	if len(s.Enum) > 0 {
+		isAllowed := false
+		for _, e := range s.Enum {
+			if e == v {
+				isAllowed = true
+				break
+			}
+		}
+		if !isAllowed {
+			add(keyPath, "%v is not one of %v", v, s.Enum)
+		}
+	}
+	switch t := v.(type) {
+	case utils.JSON:
+		keys := make([]string, 0, len(s.Properties))
+		for k := range s.Properties {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child, isExist := t[k]
+			if !isExist {
+				if s.Properties[k].Required {
+					add(joinKeyPath(keyPath, k), "required key is missing")
+				}
+				continue
+			}
+			s.Properties[k].validate(joinKeyPath(keyPath, k), child, violations)
+		}
+		for k, child := range t {
+			if _, isKnown := s.Properties[k]; isKnown {
+				continue
+			}
+			if s.EntrySchema != nil {
+				s.EntrySchema.validate(joinKeyPath(keyPath, k), child, violations)
+			} else if s.Properties != nil {
+				// Modules may read keys the schema does not list yet, so an unknown key is only a hint
+				log.Log.Warnf("CONFIGURATION_UNKNOWN_KEY:%s", joinKeyPath(keyPath, k))
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range t {
+				s.Items.validate(fmt.Sprintf("%s[%d]", keyPath, i), item, violations)
+			}
+		}
+	}
+}
+
+func joinKeyPath(prefix string, k string) string {
+	if prefix == "" {
+		return k
+	}
+	return prefix + "." + k
+}
+
+// Validate checks the configuration nameId against its registered schema, nil when there is no schema or no configuration
+func (cm *DXConfigurationManager) Validate(nameId string) (err error) {
+	schema, ok := cm.Schemas[nameId]
+	if !ok {
+		return nil
+	}
+	c, ok := cm.Configurations[nameId]
+	if !ok || c.Data == nil {
+		return nil
+	}
+	var violations []DXConfigurationSchemaViolation
+	schema.validate("", *c.Data, &violations)
+	if len(violations) == 0 {
+		return nil
+	}
+	return &DXConfigurationValidationError{ConfigurationNameId: nameId, Violations: violations}
+}
@@ -0,0 +1,174 @@
+package configuration
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+const (
+	// DXConfigurationKeyEnvironmentVariable holds the 32 bytes AES-256 key, base64 or hex encoded
+	DXConfigurationKeyEnvironmentVariable = "DXLIB_CONFIG_KEY"
+	// DXConfigurationKeyFileEnvironmentVariable is the path of a file holding the key, used when DXLIB_CONFIG_KEY is not set
+	DXConfigurationKeyFileEnvironmentVariable = "DXLIB_CONFIG_KEY_FILE"
+	DXConfigurationEncryptedValueKey          = "encrypted"
+	DXConfigurationLayerDecrypted             = "decrypted"
+)
+
+var ErrConfigurationKeyNotFound = errors.New("CONFIGURATION_KEY_NOT_FOUND:" + DXConfigurationKeyEnvironmentVariable + "/" + DXConfigurationKeyFileEnvironmentVariable)
+
+func decodeConfigurationKey(s string) (key []byte, err error) {
+	s = strings.TrimSpace(s)
+	key, err = base64.StdEncoding.DecodeString(s)
+	if err == nil && len(key) == 32 {
+		return key, nil
+	}
+	key, err = hex.DecodeString(s)
+	if err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, errors.New("CONFIGURATION_KEY_MUST_BE_32_BYTES_BASE64_OR_HEX")
+}
+
+// GetConfigurationKey reads the decryption key from DXLIB_CONFIG_KEY, or from the file named by DXLIB_CONFIG_KEY_FILE
+func GetConfigurationKey() (key []byte, err error) {
+	s := os.Getenv(DXConfigurationKeyEnvironmentVariable)
+	if s == "" {
+		filename := os.Getenv(DXConfigurationKeyFileEnvironmentVariable)
+		if filename == "" {
+			return nil, ErrConfigurationKeyNotFound
+		}
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("CONFIGURATION_KEY_FILE_CANT_BE_READ:%s:%w", filename, err)
+		}
+		s = string(content)
+	}
+	return decodeConfigurationKey(s)
+}
+
+// EncryptValue returns the {"encrypted": "<base64>"} object to write in a configuration file in place of plaintext.
+// The ciphertext is the AES-256-GCM nonce followed by the sealed plaintext.
+func EncryptValue(key []byte, plaintext string) (r utils.JSON, err error) {
+	gcm, err := newConfigurationGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return utils.JSON{DXConfigurationEncryptedValueKey: base64.StdEncoding.EncodeToString(sealed)}, nil
+}
+
+// EncryptValueWithConfigurationKey encrypts with the key of GetConfigurationKey, for small go:generate programs producing the
+// configuration files of an environment.
+func EncryptValueWithConfigurationKey(plaintext string) (r utils.JSON, err error) {
+	key, err := GetConfigurationKey()
+	if err != nil {
+		return nil, err
+	}
+	return EncryptValue(key, plaintext)
+}
+
+func DecryptValue(key []byte, ciphertextAsBase64 string) (plaintext string, err error) {
+	gcm, err := newConfigurationGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(ciphertextAsBase64)
+	if err != nil {
+		return "", errors.New("CIPHERTEXT_IS_NOT_BASE64")
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("CIPHERTEXT_TOO_SHORT")
+	}
+	b, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		// The GCM error says nothing useful and the key must not be hinted at
+		return "", errors.New("CIPHERTEXT_AUTHENTICATION_FAILED")
+	}
+	return string(b), nil
+}
+
+func newConfigurationGCM(key []byte) (gcm cipher.AEAD, err error) {
+	if len(key) != 32 {
+		return nil, errors.New("CONFIGURATION_KEY_MUST_BE_32_BYTES")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func isEncryptedValue(v any) (ciphertext string, ok bool) {
+	m, isJSON := v.(utils.JSON)
+	if !isJSON || len(m) != 1 {
+		return "", false
+	}
+	ciphertext, ok = m[DXConfigurationEncryptedValueKey].(string)
+	return ciphertext, ok
+}
+
+// decryptValues replaces every {"encrypted": ...} object by its plaintext and adds its key path to SensitiveDataKey, so the
+// decrypted value never shows in ShowToLog or AsNonSensitiveString. The key is only read when an encrypted value exists.
+func (c *DXConfiguration) decryptValues(getKey func() ([]byte, error)) (err error) {
+	var key []byte
+	var walk func(prefix string, m utils.JSON) error
+	walk = func(prefix string, m utils.JSON) error {
+		for k, v := range m {
+			keyPath := k
+			if prefix != "" {
+				keyPath = prefix + "." + k
+			}
+			ciphertext, ok := isEncryptedValue(v)
+			if !ok {
+				child, isJSON := v.(utils.JSON)
+				if isJSON {
+					err := walk(keyPath, child)
+					if err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if key == nil {
+				key, err = getKey()
+				if err != nil {
+					return fmt.Errorf("CONFIGURATION_DECRYPT_FAILED:%s.%s:%w", c.NameId, keyPath, err)
+				}
+			}
+			plaintext, err := DecryptValue(key, ciphertext)
+			if err != nil {
+				return fmt.Errorf("CONFIGURATION_DECRYPT_FAILED:%s.%s:%w", c.NameId, keyPath, err)
+			}
+			m[k] = plaintext
+			if !utils.IfStringInSlice(keyPath, c.SensitiveDataKey) {
+				c.SensitiveDataKey = append(c.SensitiveDataKey, keyPath)
+			}
+			if c.layers != nil {
+				// The layers recorded the ciphertext under keyPath.encrypted, Explain must not give it out
+				delete(c.layers, keyPath+"."+DXConfigurationEncryptedValueKey)
+				c.layers[keyPath] = append(c.layers[keyPath], DXConfigurationLayerValue{Layer: DXConfigurationLayerDecrypted, Value: "********"})
+			}
+		}
+		return nil
+	}
+	err = walk("", *c.Data)
+	if err != nil {
+		log.Log.Errorf("%s", err.Error())
+	}
+	return err
+}
@@ -5,6 +5,7 @@ import (
 	dxlibOs "github.com/donnyhardyanto/dxlib/utils/os"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 )
 
@@ -17,3 +18,24 @@ func init() {
 	_ = dxlibOs.LoadEnvFile(`./.env`)
 	RootContext, RootContextCancel = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 }
+
+var shutdownHooks []func()
+var shutdownHooksMutex sync.Mutex
+
+// AddShutdownHook registers fn to be called by RunShutdownHooks, the hooks run in the reverse order of their registration
+func AddShutdownHook(fn func()) {
+	shutdownHooksMutex.Lock()
+	defer shutdownHooksMutex.Unlock()
+	shutdownHooks = append(shutdownHooks, fn)
+}
+
+// RunShutdownHooks calls every registered hook once, the application calls it as the very last step of its shutdown
+func RunShutdownHooks() {
+	shutdownHooksMutex.Lock()
+	hooks := shutdownHooks
+	shutdownHooks = nil
+	shutdownHooksMutex.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+}
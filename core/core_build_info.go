@@ -0,0 +1,39 @@
+package core
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+type DXBuildInfo struct {
+	Version   string    `json:"version"`
+	Commit    string    `json:"commit"`
+	BuildTime string    `json:"build_time"`
+	GoVersion string    `json:"go_version"`
+	StartTime time.Time `json:"start_time"`
+}
+
+var buildInfo = DXBuildInfo{
+	GoVersion: runtime.Version(),
+	StartTime: time.Now(),
+}
+var buildInfoMutex sync.RWMutex
+
+// SetBuildInfo records the build of the application, main passes the variables it gets from the linker:
+//
+//	go build -ldflags "-X main.version=1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%FT%TZ)"
+func SetBuildInfo(version, commit, buildTime string) {
+	buildInfoMutex.Lock()
+	defer buildInfoMutex.Unlock()
+	buildInfo.Version = version
+	buildInfo.Commit = commit
+	buildInfo.BuildTime = buildTime
+}
+
+// GetBuildInfo returns the values of SetBuildInfo with the Go version and the start time of the process
+func GetBuildInfo() DXBuildInfo {
+	buildInfoMutex.RLock()
+	defer buildInfoMutex.RUnlock()
+	return buildInfo
+}
@@ -0,0 +1,227 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type DXHealthCheckKind int
+
+const (
+	DXHealthCheckKindLiveness DXHealthCheckKind = iota
+	DXHealthCheckKindReadiness
+	// DXHealthCheckKindInfo checks are listed in the snapshot but never make the service not live or not ready
+	DXHealthCheckKindInfo
+)
+
+func (k DXHealthCheckKind) String() string {
+	switch k {
+	case DXHealthCheckKindLiveness:
+		return "liveness"
+	case DXHealthCheckKindInfo:
+		return "info"
+	default:
+		return "readiness"
+	}
+}
+
+type DXHealthCheckFunc func(ctx context.Context) error
+
+type DXHealthCheckStatus struct {
+	Name                string    `json:"name"`
+	Kind                string    `json:"kind"`
+	IsHealthy           bool      `json:"is_healthy"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastCheckTime       time.Time `json:"last_check_time"`
+	LastSuccessTime     time.Time `json:"last_success_time"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+}
+
+type DXHealthSnapshot struct {
+	IsLive  bool                  `json:"is_live"`
+	IsReady bool                  `json:"is_ready"`
+	Checks  []DXHealthCheckStatus `json:"checks"`
+}
+
+// DXHealthTransitionFunc is called when a check turns unhealthy or healthy again, the first result of a check counts as a
+// change only when it is a failure
+type DXHealthTransitionFunc func(status DXHealthCheckStatus)
+
+type healthCheck struct {
+	kind       DXHealthCheckKind
+	check      DXHealthCheckFunc
+	isReported bool
+	status     DXHealthCheckStatus
+}
+
+type DXHealthRegistry struct {
+	// CheckTimeout bounds each check of Snapshot, a check still running at the end is reported as failed
+	CheckTimeout  time.Duration
+	mutex         sync.Mutex
+	checks        map[string]*healthCheck
+	order         []string
+	onTransitions []DXHealthTransitionFunc
+}
+
+var Health = &DXHealthRegistry{
+	CheckTimeout: 2 * time.Second,
+	checks:       map[string]*healthCheck{},
+}
+
+func (h *DXHealthRegistry) entry(name string, kind DXHealthCheckKind) *healthCheck {
+	c, ok := h.checks[name]
+	if !ok {
+		c = &healthCheck{kind: kind, status: DXHealthCheckStatus{Name: name, Kind: kind.String()}}
+		h.checks[name] = c
+		h.order = append(h.order, name)
+	}
+	return c
+}
+
+// RegisterCheck registers check, called by every Snapshot that asks for its kind. check nil declares the kind of a component
+// reporting with SetStatus.
+func (h *DXHealthRegistry) RegisterCheck(name string, kind DXHealthCheckKind, check DXHealthCheckFunc) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	c := h.entry(name, kind)
+	c.kind = kind
+	c.status.Kind = kind.String()
+	c.check = check
+}
+
+// OnTransition registers fn to be called when the health of a check changes, for example to send an alert
+func (h *DXHealthRegistry) OnTransition(fn DXHealthTransitionFunc) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.onTransitions = append(h.onTransitions, fn)
+}
+
+// SetStatus records the result of a component that checks itself, err nil is healthy. A name not registered yet becomes a
+// readiness check without a check function.
+func (h *DXHealthRegistry) SetStatus(name string, err error) {
+	h.mutex.Lock()
+	c := h.entry(name, DXHealthCheckKindReadiness)
+	status, isChanged := c.record(err, time.Now())
+	fns := h.onTransitions
+	h.mutex.Unlock()
+	if isChanged {
+		for _, fn := range fns {
+			fn(status)
+		}
+	}
+}
+
+func (c *healthCheck) record(err error, t time.Time) (status DXHealthCheckStatus, isChanged bool) {
+	wasHealthy := c.status.IsHealthy
+	c.status.LastCheckTime = t
+	if err != nil {
+		c.status.IsHealthy = false
+		c.status.LastError = err.Error()
+		c.status.ConsecutiveFailures++
+	} else {
+		c.status.IsHealthy = true
+		c.status.LastError = ""
+		c.status.LastSuccessTime = t
+		c.status.ConsecutiveFailures = 0
+	}
+	isChanged = c.isReported && wasHealthy != c.status.IsHealthy || !c.isReported && err != nil
+	c.isReported = true
+	return c.status, isChanged
+}
+
+func runHealthCheck(ctx context.Context, check DXHealthCheckFunc, timeout time.Duration) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			r := recover()
+			if r != nil {
+				result <- fmt.Errorf("HEALTH_CHECK_PANIC:%v", r)
+			}
+		}()
+		result <- check(ctx)
+	}()
+	select {
+	case err = <-result:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("HEALTH_CHECK_TIMEOUT:%v", timeout)
+	}
+}
+
+// Snapshot runs the registered checks of kinds, all kinds when none is given, in parallel and returns the status of every
+// check of those kinds. A component of SetStatus that never reported is not listed.
+func (h *DXHealthRegistry) Snapshot(ctx context.Context, kinds ...DXHealthCheckKind) (r DXHealthSnapshot) {
+	isKindAsked := func(kind DXHealthCheckKind) bool {
+		if len(kinds) == 0 {
+			return true
+		}
+		for _, k := range kinds {
+			if k == kind {
+				return true
+			}
+		}
+		return false
+	}
+
+	h.mutex.Lock()
+	timeout := h.CheckTimeout
+	var names []string
+	var checks []DXHealthCheckFunc
+	for _, name := range h.order {
+		c := h.checks[name]
+		if c.check != nil && isKindAsked(c.kind) {
+			names = append(names, name)
+			checks = append(checks, c.check)
+		}
+	}
+	h.mutex.Unlock()
+
+	results := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check DXHealthCheckFunc) {
+			defer wg.Done()
+			results[i] = runHealthCheck(ctx, check, timeout)
+		}(i, check)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	var changes []DXHealthCheckStatus
+	h.mutex.Lock()
+	for i, name := range names {
+		status, isChanged := h.checks[name].record(results[i], now)
+		if isChanged {
+			changes = append(changes, status)
+		}
+	}
+	r = DXHealthSnapshot{IsLive: true, IsReady: true, Checks: []DXHealthCheckStatus{}}
+	for _, name := range h.order {
+		c := h.checks[name]
+		if !c.isReported || !isKindAsked(c.kind) {
+			continue
+		}
+		r.Checks = append(r.Checks, c.status)
+		if !c.status.IsHealthy {
+			switch c.kind {
+			case DXHealthCheckKindLiveness:
+				r.IsLive = false
+			case DXHealthCheckKindReadiness:
+				r.IsReady = false
+			}
+		}
+	}
+	fns := h.onTransitions
+	h.mutex.Unlock()
+	for _, status := range changes {
+		for _, fn := range fns {
+			fn(status)
+		}
+	}
+	return r
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// The priorities of RegisterShutdownHook, a lower one runs first: the APIs stop accepting requests, then the background workers
+// finish, then the databases close
+const (
+	ShutdownPriorityAPI      = 100
+	ShutdownPriorityWorker   = 200
+	ShutdownPriorityDatabase = 300
+)
+
+type DXShutdownHookFunc func(ctx context.Context) error
+
+type shutdownHook struct {
+	name     string
+	priority int
+	hook     DXShutdownHookFunc
+}
+
+var orderedShutdownHooks []shutdownHook
+var isShutdownStarted bool
+
+// ShutdownLogf writes the records of Shutdown, the log package points it to its log, core can not import it
+var ShutdownLogf = func(format string, v ...any) {
+	_, _ = fmt.Fprintf(os.Stderr, format+"\n", v...)
+}
+
+// RegisterShutdownHook registers hook to be run by Shutdown. The hooks run one after the other by priority, the ones of a same
+// priority in the order of their registration. ctx is done when the share of the timeout of the hook is over.
+func RegisterShutdownHook(name string, priority int, hook DXShutdownHookFunc) {
+	shutdownHooksMutex.Lock()
+	defer shutdownHooksMutex.Unlock()
+	orderedShutdownHooks = append(orderedShutdownHooks, shutdownHook{name: name, priority: priority, hook: hook})
+}
+
+// Shutdown cancels RootContext, runs the hooks of RegisterShutdownHook by priority and then the ones of AddShutdownHook. Each
+// hook gets an equal share of the time left of timeout, a hook still running at the end of its share is left behind and
+// reported. The errors of the hooks are joined. Only the first call does anything.
+func Shutdown(timeout time.Duration) (err error) {
+	shutdownHooksMutex.Lock()
+	if isShutdownStarted {
+		shutdownHooksMutex.Unlock()
+		return nil
+	}
+	isShutdownStarted = true
+	hooks := orderedShutdownHooks
+	orderedShutdownHooks = nil
+	shutdownHooksMutex.Unlock()
+
+	RootContextCancel()
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].priority < hooks[j].priority
+	})
+
+	start := time.Now()
+	deadline := start.Add(timeout)
+	var errs []error
+	for i, h := range hooks {
+		share := time.Until(deadline) / time.Duration(len(hooks)-i)
+		hookStart := time.Now()
+		errHook := runShutdownHook(h, share)
+		duration := time.Since(hookStart)
+		if errHook != nil {
+			errs = append(errs, fmt.Errorf("SHUTDOWN_HOOK_FAILED:%s:%w", h.name, errHook))
+			ShutdownLogf("Shutdown %s (priority %d)... failed in %v (%v)", h.name, h.priority, duration, errHook.Error())
+			continue
+		}
+		ShutdownLogf("Shutdown %s (priority %d)... done in %v", h.name, h.priority, duration)
+	}
+	ShutdownLogf("Shutdown of %d hooks done in %v, %d failed", len(hooks), time.Since(start), len(errs))
+	RunShutdownHooks()
+	return errors.Join(errs...)
+}
+
+func runShutdownHook(h shutdownHook, share time.Duration) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), share)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			r := recover()
+			if r != nil {
+				result <- fmt.Errorf("SHUTDOWN_HOOK_PANIC:%v", r)
+			}
+		}()
+		result <- h.hook(ctx)
+	}()
+	select {
+	case err = <-result:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("SHUTDOWN_HOOK_TIMEOUT:%v", share.Round(time.Millisecond))
+	}
+}
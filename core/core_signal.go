@@ -0,0 +1,120 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// The exit codes of WaitForShutdownSignal when the shutdown does not finish by itself
+const (
+	ExitCodeShutdownTimeout = 3
+	ExitCodeShutdownForced  = 4
+)
+
+// DXShutdownGracePeriod is the time Run gives the shutdown hooks after the first signal
+var DXShutdownGracePeriod = 30 * time.Second
+
+// shutdownForceExitMargin leaves Shutdown the time to report the hooks it left behind before the process is killed
+const shutdownForceExitMargin = time.Second
+
+var exit = os.Exit
+
+type DXReloadHookFunc func() error
+
+type reloadHook struct {
+	name string
+	hook DXReloadHookFunc
+}
+
+var reloadHooks []reloadHook
+
+// RegisterReloadHook registers hook to be run by Reload, on SIGHUP while WaitForShutdownSignal waits
+func RegisterReloadHook(name string, hook DXReloadHookFunc) {
+	shutdownHooksMutex.Lock()
+	defer shutdownHooksMutex.Unlock()
+	reloadHooks = append(reloadHooks, reloadHook{name: name, hook: hook})
+}
+
+// Reload runs every hook of RegisterReloadHook in the order of their registration, a failing hook does not stop the others
+func Reload() (err error) {
+	shutdownHooksMutex.Lock()
+	hooks := append([]reloadHook(nil), reloadHooks...)
+	shutdownHooksMutex.Unlock()
+	var errs []error
+	for _, h := range hooks {
+		errHook := h.hook()
+		if errHook != nil {
+			errs = append(errs, fmt.Errorf("RELOAD_HOOK_FAILED:%s:%w", h.name, errHook))
+			ShutdownLogf("Reload %s... failed (%v)", h.name, errHook.Error())
+			continue
+		}
+		ShutdownLogf("Reload %s... done", h.name)
+	}
+	return errors.Join(errs...)
+}
+
+// WaitForShutdownSignal blocks until SIGINT or SIGTERM arrives, or RootContext is cancelled, then runs Shutdown with
+// gracePeriod. The process exits with ExitCodeShutdownTimeout when the shutdown outlives gracePeriod, and with
+// ExitCodeShutdownForced at once on a second signal. SIGHUP runs Reload and keeps waiting.
+func WaitForShutdownSignal(gracePeriod time.Duration) (err error) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	isWaiting := true
+	for isWaiting {
+		select {
+		case <-RootContext.Done():
+			ShutdownLogf("Shutdown requested (%v)", RootContext.Err())
+			isWaiting = false
+		case s := <-signals:
+			if s == syscall.SIGHUP {
+				ShutdownLogf("Signal %v received, reloading", s)
+				go func() {
+					_ = Reload()
+				}()
+				continue
+			}
+			ShutdownLogf("Signal %v received, shutting down within %v, a second signal exits at once", s, gracePeriod)
+			isWaiting = false
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Shutdown(gracePeriod)
+	}()
+	timer := time.NewTimer(gracePeriod + shutdownForceExitMargin)
+	defer timer.Stop()
+	for {
+		select {
+		case err = <-done:
+			return err
+		case <-timer.C:
+			ShutdownLogf("SHUTDOWN_GRACE_PERIOD_ELAPSED:%v, exiting with code %d", gracePeriod, ExitCodeShutdownTimeout)
+			exit(ExitCodeShutdownTimeout)
+			return fmt.Errorf("SHUTDOWN_GRACE_PERIOD_ELAPSED:%v", gracePeriod)
+		case s := <-signals:
+			if s == syscall.SIGHUP {
+				continue
+			}
+			ShutdownLogf("Signal %v received again, exiting with code %d", s, ExitCodeShutdownForced)
+			exit(ExitCodeShutdownForced)
+			return fmt.Errorf("SHUTDOWN_FORCED:%v", s)
+		}
+	}
+}
+
+// Run calls setup, which starts the services and registers their shutdown hooks, then waits with WaitForShutdownSignal and
+// DXShutdownGracePeriod. A setup error shuts down what was started so far.
+func Run(setup func() error) (err error) {
+	err = setup()
+	if err != nil {
+		return errors.Join(err, Shutdown(DXShutdownGracePeriod))
+	}
+	return WaitForShutdownSignal(DXShutdownGracePeriod)
+}
@@ -0,0 +1,226 @@
+package core
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+var quietShutdownLog sync.Once
+
+// resetShutdownForTest gives the test a RootContext and hooks of its own, and records the exit codes instead of exiting
+func resetShutdownForTest(t *testing.T) (exitCodes chan int) {
+	t.Helper()
+	// Never restored, the reloads started by a SIGHUP may still log after their test
+	quietShutdownLog.Do(func() { ShutdownLogf = func(format string, v ...any) {} })
+	previousRootContext, previousRootContextCancel, previousExit := RootContext, RootContextCancel, exit
+	RootContext, RootContextCancel = context.WithCancel(context.Background())
+	resetShutdownHooks()
+	exitCodes = make(chan int, 4)
+	exit = func(code int) { exitCodes <- code }
+	t.Cleanup(func() {
+		RootContextCancel()
+		RootContext, RootContextCancel, exit = previousRootContext, previousRootContextCancel, previousExit
+		resetShutdownHooks()
+	})
+	return exitCodes
+}
+
+func resetShutdownHooks() {
+	shutdownHooksMutex.Lock()
+	defer shutdownHooksMutex.Unlock()
+	isShutdownStarted, orderedShutdownHooks, reloadHooks, shutdownHooks = false, nil, nil, nil
+}
+
+// startWaitingForShutdownSignal runs WaitForShutdownSignal and returns once it listens to the signals, which SIGHUP proves by
+// running the reload hook. The signals are also caught by the test meanwhile, so none kills the test process.
+func startWaitingForShutdownSignal(t *testing.T, gracePeriod time.Duration) (result chan error, reloads chan struct{}) {
+	t.Helper()
+	guard := make(chan os.Signal, 16)
+	signal.Notify(guard, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	t.Cleanup(func() { signal.Stop(guard) })
+	reloads = make(chan struct{}, 64)
+	RegisterReloadHook("test", func() error {
+		reloads <- struct{}{}
+		return nil
+	})
+	result = make(chan error, 1)
+	go func() {
+		result <- WaitForShutdownSignal(gracePeriod)
+	}()
+	deadline := time.After(5 * time.Second)
+	for {
+		sendSignal(t, syscall.SIGHUP)
+		select {
+		case <-reloads:
+			return result, reloads
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("WaitForShutdownSignal does not reload on SIGHUP")
+		}
+	}
+}
+
+// releaseStuckShutdownAtCleanup returns the channel a stuck hook waits on, the cleanup closes it and waits for the end of
+// the shutdown the test left behind, before the state of core is restored. The hooks of AddShutdownHook registered later run
+// before its own.
+func releaseStuckShutdownAtCleanup(t *testing.T) (release chan struct{}) {
+	t.Helper()
+	release = make(chan struct{})
+	finished := make(chan struct{})
+	AddShutdownHook(func() { close(finished) })
+	t.Cleanup(func() {
+		close(release)
+		select {
+		case <-finished:
+		case <-time.After(5 * time.Second):
+			t.Error("the shutdown left behind did not finish")
+		}
+	})
+	return release
+}
+
+func sendSignal(t *testing.T, s syscall.Signal) {
+	t.Helper()
+	err := syscall.Kill(os.Getpid(), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShutdownSignalRunsTheHooksAndSIGHUPReloads(t *testing.T) {
+	exitCodes := resetShutdownForTest(t)
+	var order []string
+	RegisterShutdownHook("database", ShutdownPriorityDatabase, func(ctx context.Context) error {
+		order = append(order, "database")
+		return nil
+	})
+	RegisterShutdownHook("api", ShutdownPriorityAPI, func(ctx context.Context) error {
+		order = append(order, "api")
+		return nil
+	})
+	result, reloads := startWaitingForShutdownSignal(t, 5*time.Second)
+
+	// SIGHUP reloads again and keeps waiting
+	sendSignal(t, syscall.SIGHUP)
+	select {
+	case <-reloads:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the second SIGHUP did not reload")
+	}
+	select {
+	case err := <-result:
+		t.Fatalf("SIGHUP ended the wait with %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if RootContext.Err() != nil {
+		t.Fatal("SIGHUP cancelled RootContext")
+	}
+
+	sendSignal(t, syscall.SIGTERM)
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGTERM did not shut down")
+	}
+	if RootContext.Err() == nil {
+		t.Fatal("RootContext is not cancelled")
+	}
+	if strings.Join(order, ",") != "api,database" {
+		t.Fatalf("hooks ran in the order %v", order)
+	}
+	select {
+	case code := <-exitCodes:
+		t.Fatalf("a clean shutdown exited with %d", code)
+	default:
+	}
+}
+
+func TestShutdownSignalExitsWhenTheGracePeriodElapses(t *testing.T) {
+	exitCodes := resetShutdownForTest(t)
+	release := releaseStuckShutdownAtCleanup(t)
+	// The hooks of RegisterShutdownHook are bounded by Shutdown itself, the ones of AddShutdownHook are not
+	AddShutdownHook(func() {
+		<-release
+	})
+	gracePeriod := 200 * time.Millisecond
+	result, _ := startWaitingForShutdownSignal(t, gracePeriod)
+	start := time.Now()
+	sendSignal(t, syscall.SIGTERM)
+	select {
+	case code := <-exitCodes:
+		if code != ExitCodeShutdownTimeout {
+			t.Fatalf("exit code %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the process did not exit after the grace period")
+	}
+	if elapsed := time.Since(start); elapsed < gracePeriod {
+		t.Fatalf("exited after %v, before the grace period", elapsed)
+	}
+	err := <-result
+	if err == nil || !strings.HasPrefix(err.Error(), "SHUTDOWN_GRACE_PERIOD_ELAPSED:") {
+		t.Fatalf("err %v", err)
+	}
+}
+
+func TestSecondShutdownSignalExitsAtOnce(t *testing.T) {
+	exitCodes := resetShutdownForTest(t)
+	release := releaseStuckShutdownAtCleanup(t)
+	started := make(chan struct{})
+	RegisterShutdownHook("stuck", ShutdownPriorityWorker, func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	result, _ := startWaitingForShutdownSignal(t, time.Minute)
+	sendSignal(t, syscall.SIGTERM)
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the shutdown did not start")
+	}
+	sendSignal(t, syscall.SIGINT)
+	select {
+	case code := <-exitCodes:
+		if code != ExitCodeShutdownForced {
+			t.Fatalf("exit code %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the second signal did not exit")
+	}
+	err := <-result
+	if err == nil || !strings.HasPrefix(err.Error(), "SHUTDOWN_FORCED:") {
+		t.Fatalf("err %v", err)
+	}
+}
+
+func TestCancelledRootContextShutsDownWithoutASignal(t *testing.T) {
+	exitCodes := resetShutdownForTest(t)
+	ran := make(chan struct{})
+	RegisterShutdownHook("api", ShutdownPriorityAPI, func(ctx context.Context) error {
+		close(ran)
+		return nil
+	})
+	RootContextCancel()
+	err := WaitForShutdownSignal(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ran:
+	default:
+		t.Fatal("the hook did not run")
+	}
+	if len(exitCodes) != 0 {
+		t.Fatalf("exited with %d", <-exitCodes)
+	}
+}
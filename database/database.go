@@ -6,29 +6,37 @@ import (
 	"errors"
 	"fmt"
 	"github.com/donnyhardyanto/dxlib/database/protected/sqlfile"
-	mssql "github.com/microsoft/go-mssqldb"
 	goOra "github.com/sijms/go-ora/v2"
 	"net"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
-	pq "github.com/knetic/go-namedparameterquery"
 	_ "github.com/lib/pq"
 	_ "github.com/sijms/go-ora/v2"
 
 	"github.com/donnyhardyanto/dxlib/configuration"
+	"github.com/donnyhardyanto/dxlib/core"
 	"github.com/donnyhardyanto/dxlib/database/database_type"
 	"github.com/donnyhardyanto/dxlib/database/protected/db"
 	"github.com/donnyhardyanto/dxlib/log"
 	"github.com/donnyhardyanto/dxlib/utils"
+	"github.com/donnyhardyanto/dxlib/utils/retry"
 	utilsSql "github.com/donnyhardyanto/dxlib/utils/security"
 )
 
 type DXDatabaseEventFunc func(dm *DXDatabase, err error)
 
+const (
+	DXDatabaseOracleConnectByServiceName = "service_name"
+	DXDatabaseOracleConnectBySID         = "sid"
+)
+
 type DXDatabase struct {
 	NameId                       string
 	IsConfigured                 bool
@@ -46,6 +54,63 @@ type DXDatabase struct {
 	NonSensitiveConnectionString string
 	OnCannotConnect              DXDatabaseEventFunc
 	CreateScriptFiles            []string
+	// Connection pool settings, zero keeps the database/sql default
+	MaxOpenConnections    int
+	MaxIdleConnections    int
+	ConnectionMaxLifetime time.Duration
+	ConnectionMaxIdleTime time.Duration
+	// AcquireTimeout bounds the wait for a connection of the pool, of a transaction and of a helper like Select, Insert,
+	// Update or Delete, zero waits forever. The wait exceeding it fails with a db.PoolExhaustedError and calls OnPoolExhausted.
+	AcquireTimeout  time.Duration
+	OnPoolExhausted DXDatabaseEventFunc
+	// MaxRowsPerSelect bounds the rows read by Select and by SelectPaged of every row, zero is no bound. More rows matching
+	// fail with db.ErrTooManyRows, or are truncated with WithTruncateOnMaxRows, and call OnTooManyRows.
+	MaxRowsPerSelect int64
+	OnTooManyRows    DXDatabaseEventFunc
+	// ServerStatementTimeout has the database server end the statements running longer, whatever the context of the caller. It
+	// is statement_timeout on PostgreSQL, max_execution_time of the selects on MySQL, LOCK_TIMEOUT on SQL Server and the
+	// timeout of the calls of the driver on Oracle.
+	ServerStatementTimeout time.Duration
+	// OracleConnectBy names the DatabaseName of an Oracle database, DXDatabaseOracleConnectByServiceName when empty or
+	// DXDatabaseOracleConnectBySID
+	OracleConnectBy string
+	// OracleWalletPath is the directory of the wallet an Oracle database requires, like an Autonomous Database, the
+	// connection is then made over TLS
+	OracleWalletPath string
+	// DebugSQL, once enabled, logs at the debug level the statements of the helpers ready to be pasted in a SQL console, those
+	// of the transactions begun while it is enabled too
+	DebugSQL db.DebugSQL
+	// CredentialsProvider, when set, gives the user name and the password of every new connection instead of UserName and
+	// UserPassword, for the short-lived tokens of a cloud database, see NewDXDatabaseTokenCredentialsProvider
+	CredentialsProvider DXDatabaseCredentialsProvider
+	// EncryptedFields lists by table name the fields encrypted at rest by Encrypt, the views selected by the tables need their
+	// own entry. DeterministicEncryptedFields are the ones of them that may be used in a where clause.
+	EncryptedFields              map[string][]string
+	DeterministicEncryptedFields map[string][]string
+	// AuditHook, when set, runs every Insert, Update, SoftDelete and Delete in a transaction that also calls it per row
+	AuditHook DXDatabaseAuditHook
+	// TenantFieldName, when set, scopes the queries of every table but the TenantSharedTables to a tenant, see Tenant
+	TenantFieldName    string
+	TenantSharedTables []string
+	// ReadReplicas take in turn the reads of SelectContext, SelectOneContext, ShouldSelectOneContext and
+	// ShouldSelectCountContext, unless the DXDatabaseRouting of their context is pinned to the primary. Their
+	// ReadReplicaNameIds configured are the databases of the Manager.
+	ReadReplicas       []*DXDatabase
+	ReadReplicaNameIds []string
+	// Encrypt and Decrypt default to the AES-256-GCM key ring of NewDXDatabaseKeyRingFromEnvironment. The default Decrypt
+	// only gets the values in its stored form, a Decrypt set gets every value of the encrypted fields but nil.
+	Encrypt           DXDatabaseEncryptFunc
+	Decrypt           DXDatabaseDecryptFunc
+	encryptionMutex   sync.Mutex
+	connectionMutex   sync.Mutex
+	isReloadCandidate bool
+	// isKeyRingDecrypt is true once ciphers defaulted Decrypt to the key ring of the environment
+	isKeyRingDecrypt bool
+	// poolExhaustedCount counts the waits failed by AcquireTimeout
+	poolExhaustedCount atomic.Int64
+	// tooManyRowsCount counts the selects that exceeded MaxRowsPerSelect
+	tooManyRowsCount atomic.Int64
+	readReplicaIndex atomic.Uint64
 }
 
 func (d *DXDatabase) TransactionBegin(isolationLevel DXDatabaseTxIsolationLevel) (dtx *DXDatabaseTx, err error) {
@@ -56,42 +121,77 @@ func (d *DXDatabase) TransactionBegin(isolationLevel DXDatabaseTxIsolationLevel)
 	driverName := d.Connection.DriverName()
 	switch driverName {
 	case "oracle":
-		tx, err := d.Connection.BeginTxx(context.Background(), &sql.TxOptions{
+		tx, err := d.beginTxx(context.Background(), &sql.TxOptions{
 			ReadOnly: false,
 		})
 		if err != nil {
 			return nil, err
 		}
+		txLog := d.Logger()
 		dtx = &DXDatabaseTx{
-			Tx:  tx,
-			Log: &log.Log,
+			Tx:       tx,
+			Log:      d.txLog(&txLog),
+			Database: d,
 		}
 		return dtx, nil
 	}
 
-	tx, err := d.Connection.BeginTxx(context.Background(), &sql.TxOptions{
+	tx, err := d.beginTxx(context.Background(), &sql.TxOptions{
 		Isolation: isolationLevel,
 		ReadOnly:  false,
 	})
 	if err != nil {
 		return nil, err
 	}
+	txLog := d.Logger()
 	dtx = &DXDatabaseTx{
-		Tx:  tx,
-		Log: &log.Log,
+		Tx:       tx,
+		Log:      d.txLog(&txLog),
+		Database: d,
 	}
 	return dtx, nil
 }
 
+// DXDatabaseLogRateLimitWindow is how long the repeated connection failures of one database are folded into one record
+var DXDatabaseLogRateLimitWindow = 30 * time.Second
+
+// Logger returns the log of the database, its records carry the database field
+func (d *DXDatabase) Logger() log.DXLog {
+	return log.Log.WithField("database", d.NameId)
+}
+
+// rateLimitedLogger is the log of the paths repeated while the database is down, like the reconnection
+func (d *DXDatabase) rateLimitedLogger(key string) log.DXLog {
+	dbLog := d.Logger()
+	return dbLog.WithRateLimit(key, DXDatabaseLogRateLimitWindow)
+}
+
+// reportHealth pushes the result of CheckConnection to core.Health as the readiness check database.<NameId>
+func (d *DXDatabase) reportHealth(err error) {
+	if err == nil && !d.Connected {
+		err = errors.New("DATABASE_NOT_CONNECTED")
+	}
+	core.Health.SetStatus("database."+d.NameId, err)
+}
+
 func (d *DXDatabase) CheckConnection() (err error) {
+	defer func() {
+		d.reportHealth(err)
+	}()
 	if d.Connection == nil {
 		d.Connected = false
 		return nil
 	}
 
-	dbConn, err := d.Connection.Conn(context.Background())
+	dbConn, err := d.acquireConnection(context.Background(), d.Connection)
+	if errors.Is(err, db.ErrPoolExhausted) {
+		// The database answers, it is busy
+		return err
+	}
 	if err != nil {
-		log.Log.Warnf("Database %v CheckConnection() failed: %v", d.NameId, err.Error())
+		err = d.redactError(err)
+		dbLog := d.rateLimitedLogger("check_connection")
+		dbLog.Warnf("Database %v CheckConnection() failed: %v", d.NameId, err.Error())
 		d.Connected = false
 		return err
 	}
@@ -103,8 +203,10 @@ func (d *DXDatabase) CheckConnection() (err error) {
 	defer cancel()
 
 	if err := dbConn.PingContext(ctx); err != nil {
+		err = d.redactError(err)
 		d.Connected = false
-		log.Log.Warnf("Database %v ping failed: %v", d.NameId, err.Error())
+		dbLog := d.rateLimitedLogger("check_connection_ping")
+		dbLog.Warnf("Database %v ping failed: %v", d.NameId, err.Error())
 		return err
 	}
 	log.Log.Tracef("Database %v ping success with result CheckConnection: %v", d.NameId, d.Connected)
@@ -116,6 +218,9 @@ func (d *DXDatabase) CheckConnectionAndReconnect() (err error) {
 	tryReconnect := false
 	if d.Connected {
 		err = d.CheckConnection()
+		if errors.Is(err, db.ErrPoolExhausted) {
+			return err
+		}
 		if err != nil {
 			tryReconnect = true
 		}
@@ -149,6 +254,10 @@ func (d *DXDatabase) GetNonSensitiveConnectionString() string {
 }
 
 func (d *DXDatabase) GetConnectionString() (s string, err error) {
+	return d.connectionStringOf(d.UserName, d.UserPassword)
+}
+
+func (d *DXDatabase) connectionStringOf(userName string, password string) (s string, err error) {
 	switch d.DatabaseType {
 	case database_type.PostgreSQL:
 		//	s = fmt.Sprintf("%s://%s:%s@%s/%s?%s", d.DatabaseType.String(), d.UserName, d.UserPassword, d.Address, d.DatabaseName, d.ConnectionOptions)
@@ -156,14 +265,16 @@ func (d *DXDatabase) GetConnectionString() (s string, err error) {
 		if err != nil {
 			return "", err
 		}
-		s = fmt.Sprintf("user=%s password=%s host=%s port=%s dbname=%s %s", d.UserName, d.UserPassword, host, portAsString, d.DatabaseName, d.ConnectionOptions)
+		s = fmt.Sprintf("user=%s password=%s host=%s port=%s dbname=%s %s", userName, password, host, portAsString, d.DatabaseName, d.ConnectionOptions)
 
 	case database_type.SQLServer:
 		host, portAsString, err := net.SplitHostPort(d.Address)
 		if err != nil {
 			return "", err
 		}
-		s = fmt.Sprintf("server=%s;port=%s;user id=%s;password=%s;database=%s;encrypt=disable", host, portAsString, d.UserName, d.UserPassword, d.DatabaseName)
+		s = fmt.Sprintf("server=%s;port=%s;user id=%s;password=%s;database=%s;encrypt=disable", host, portAsString, userName, password, d.DatabaseName)
+	case database_type.MySQL:
+		s, err = d.mysqlConnectionString(userName, password)
 	case database_type.Oracle:
 		host, portAsString, err := net.SplitHostPort(d.Address)
 		if err != nil {
@@ -173,16 +284,59 @@ func (d *DXDatabase) GetConnectionString() (s string, err error) {
 		if err != nil {
 			return "", err
 		}
-		urlOptions := map[string]string{
-			//	"SERVICE_NAME": d.DatabaseName,
+		urlOptions := map[string]string{}
+		service := d.DatabaseName
+		if d.OracleConnectBy == DXDatabaseOracleConnectBySID {
+			service = ""
+			urlOptions["SID"] = d.DatabaseName
+		}
+		if d.OracleWalletPath != "" {
+			urlOptions["WALLET"] = d.OracleWalletPath
+			urlOptions["SSL"] = "enable"
+		}
+		if d.ServerStatementTimeout > 0 {
+			// In seconds, it bounds the connect too
+			urlOptions["TIMEOUT"] = strconv.FormatInt(int64((d.ServerStatementTimeout+time.Second-1)/time.Second), 10)
 		}
-		s = goOra.BuildUrl(host, portInt, d.DatabaseName, d.UserName, d.UserPassword, urlOptions)
+		s = goOra.BuildUrl(host, portInt, service, userName, password, urlOptions)
 	default:
 		err = log.Log.ErrorAndCreateErrorf("configuration is unusable, value of database_type field of database %s configuration is not supported (%s)", d.NameId, s)
 	}
 	return s, err
 }
 
+// mysqlConnectionString is the user:password@tcp(address)/database_name?options DSN of go-sql-driver/mysql. ConnectionOptions
+// are its parameters joined by &, like "parseTime=true&collation=utf8mb4_unicode_ci&loc=UTC". parseTime is on unless the
+// options turn it off, so the date and time columns are read as time.Time like on the other databases.
+func (d *DXDatabase) mysqlConnectionString(userName string, password string) (s string, err error) {
+	options := strings.TrimPrefix(strings.TrimSpace(d.ConnectionOptions), "?")
+	query, err := url.ParseQuery(options)
+	if err != nil {
+		return "", fmt.Errorf("DATABASE_CONNECTION_OPTIONS_INVALID:%s:%w", d.NameId, err)
+	}
+	config, err := mysql.ParseDSN("/?" + options)
+	if err != nil {
+		return "", fmt.Errorf("DATABASE_CONNECTION_OPTIONS_INVALID:%s:%w", d.NameId, err)
+	}
+	if !query.Has("parseTime") {
+		config.ParseTime = true
+	}
+	config.User = userName
+	config.Passwd = password
+	config.Net = "tcp"
+	config.Addr = d.Address
+	config.DBName = d.DatabaseName
+	return config.FormatDSN(), nil
+}
+
+// configurationError is fatal for a database that must be connected, otherwise the database is only left unusable
+func (d *DXDatabase) configurationError(text string, v ...any) (err error) {
+	if d.MustConnected && !d.isReloadCandidate {
+		return log.Log.FatalAndCreateErrorf(text, v...)
+	}
+	return log.Log.WarnAndCreateErrorf("configuration is unusable, "+text, v...)
+}
+
 func (d *DXDatabase) ApplyFromConfiguration() (err error) {
 	if !d.IsConfigured {
 		log.Log.Infof("Configuring to Database %s... start", d.NameId)
@@ -191,96 +345,97 @@ func (d *DXDatabase) ApplyFromConfiguration() (err error) {
 			err = log.Log.PanicAndCreateErrorf("DXDatabase/ApplyFromConfiguration/1", "Storage configuration not found")
 			return err
 		}
-		m := *(configurationData.Data)
-		databaseConfiguration, ok := m[d.NameId].(utils.JSON)
-		if !ok {
-			if d.MustConnected {
-				err := log.Log.FatalAndCreateErrorf("Database %s configuration not found", d.NameId)
-				return err
-			} else {
-				err := log.Log.WarnAndCreateErrorf("Manager is unusable, database %s configuration not found", d.NameId)
-				return err
-			}
+		prefix := d.NameId + "."
+		if _, err = configurationData.GetJSON(d.NameId); err != nil {
+			return d.configurationError("Database %s configuration not found (%v)", d.NameId, err.Error())
 		}
-		n, ok := databaseConfiguration[`nameid`].(string)
-		if ok {
+		if n, err := configurationData.GetString(prefix + `nameid`); err == nil {
 			d.NameId = n
 		}
-		b, ok := databaseConfiguration[`must_connected`].(bool)
-		if ok {
+		if b, err := configurationData.GetBool(prefix + `must_connected`); err == nil {
 			d.MustConnected = b
 		}
-		b, ok = databaseConfiguration[`is_connect_at_start`].(bool)
-		if ok {
+		if b, err := configurationData.GetBool(prefix + `is_connect_at_start`); err == nil {
 			d.IsConnectAtStart = b
 		}
-		s, ok := databaseConfiguration[`database_type`].(string)
-		if !ok {
-			if d.MustConnected {
-				err := log.Log.FatalAndCreateErrorf("Mandatory database_type field value in database %s configuration is not supported (%v)", d.NameId, s)
-				return err
-			} else {
-				err := log.Log.WarnAndCreateErrorf("configuration is unusable, mandatory database_type field value database %s configuration  is not supported (%v)", d.NameId, s)
-				return err
-			}
+		s, err := configurationData.GetString(prefix + `database_type`)
+		if err != nil {
+			return d.configurationError("mandatory database_type field in database %s configuration is not valid (%v)", d.NameId, err.Error())
 		}
 		d.DatabaseType = database_type.StringToDXDatabaseType(s)
 		if d.DatabaseType == database_type.UnknownDatabaseType {
-			if d.MustConnected {
-				err := log.Log.FatalAndCreateErrorf("Mandatory value of database_type field of Database %s configuration is not supported (%s)", d.NameId, s)
-				return err
-			} else {
-				err := log.Log.WarnAndCreateErrorf("configuration is unusable, value of database_type field of database %s configuration is not supported (%s)", d.NameId, s)
-				return err
-			}
+			return d.configurationError("value of database_type field of database %s configuration is not supported (%s)", d.NameId, s)
 		}
-		d.Address, ok = databaseConfiguration[`address`].(string)
-		if !ok {
-			if d.MustConnected {
-				err := log.Log.FatalAndCreateErrorf("Mandatory address field in Database %s configuration not exist", d.NameId)
-				return err
-			} else {
-				err := log.Log.WarnAndCreateErrorf("configuration is unusable, mandatory address field in database %s configuration not exist", d.NameId)
-				return err
+		for _, field := range []struct {
+			key    string
+			target *string
+		}{
+			{`address`, &d.Address},
+			{`user_name`, &d.UserName},
+			{`user_password`, &d.UserPassword},
+			{`database_name`, &d.DatabaseName},
+		} {
+			*field.target, err = configurationData.GetString(prefix + field.key)
+			if err != nil && d.CredentialsProvider != nil && (field.key == `user_name` || field.key == `user_password`) {
+				// Given by the CredentialsProvider
+				continue
 			}
-		}
-		d.UserName, ok = databaseConfiguration[`user_name`].(string)
-		if !ok {
-			if d.MustConnected {
-				err := log.Log.FatalAndCreateErrorf("Mandatory user_name field in Database %s configuration not exist", d.NameId)
-				return err
-			} else {
-				err := log.Log.WarnAndCreateErrorf("configuration is unusable, mandatory user_name field in Database %s configuration not exist", d.NameId)
-				return err
+			if err != nil {
+				return d.configurationError("mandatory %s field in database %s configuration is not valid (%v)", field.key, d.NameId, err.Error())
 			}
 		}
-		d.UserPassword, ok = databaseConfiguration[`user_password`].(string)
-		if !ok {
-			if d.MustConnected {
-				err := log.Log.FatalAndCreateErrorf("Mandatory user_password field in Database %s configuration not exist", d.NameId)
-				return err
-			} else {
-				err := log.Log.WarnAndCreateErrorf("configuration is unusable, mandatory user_password field in Database %s configuration not exist", d.NameId)
-				return err
-			}
+		d.CreateScriptFiles, _ = configurationData.GetStringSlice(prefix + `create_script_files`)
+		d.ConnectionOptions, _ = configurationData.GetString(prefix + `connection_options`)
+		d.MaxOpenConnections, _ = configurationData.GetInt(prefix + `max_open_connections`)
+		d.MaxIdleConnections, _ = configurationData.GetInt(prefix + `max_idle_connections`)
+		d.ConnectionMaxLifetime, _ = configurationData.GetDuration(prefix + `connection_max_lifetime`)
+		d.ConnectionMaxIdleTime, _ = configurationData.GetDuration(prefix + `connection_max_idle_time`)
+		// The short names of the pool settings, in seconds, take over the long ones
+		if v, err := configurationData.GetInt(prefix + `max_open_conns`); err == nil {
+			d.MaxOpenConnections = v
 		}
-		d.DatabaseName, ok = databaseConfiguration[`database_name`].(string)
-		if !ok {
-			if d.MustConnected {
-				err := log.Log.FatalAndCreateErrorf("Mandatory database_name field in Database %s configuration not exist", d.NameId)
-				return err
-			} else {
-				err := log.Log.WarnAndCreateErrorf("configuration is unusable, mandatory database_name field in Database %s configuration not exist", d.NameId)
-				return err
-			}
+		if v, err := configurationData.GetInt(prefix + `max_idle_conns`); err == nil {
+			d.MaxIdleConnections = v
 		}
-		d.CreateScriptFiles, _ = databaseConfiguration[`create_script_files`].([]string)
-		d.ConnectionOptions, _ = databaseConfiguration[`connection_options`].(string)
+		if v, err := configurationData.GetInt(prefix + `conn_max_lifetime_sec`); err == nil {
+			d.ConnectionMaxLifetime = time.Duration(v) * time.Second
+		}
+		if v, err := configurationData.GetInt(prefix + `conn_max_idle_time_sec`); err == nil {
+			d.ConnectionMaxIdleTime = time.Duration(v) * time.Second
+		}
+		acquireTimeoutMs, _ := configurationData.GetInt(prefix + `acquire_timeout_ms`)
+		d.AcquireTimeout = time.Duration(acquireTimeoutMs) * time.Millisecond
+		maxRowsPerSelect, _ := configurationData.GetInt(prefix + `max_rows_per_select`)
+		d.MaxRowsPerSelect = int64(maxRowsPerSelect)
+		serverStatementTimeoutMs, _ := configurationData.GetInt(prefix + `server_statement_timeout_ms`)
+		d.ServerStatementTimeout = time.Duration(serverStatementTimeoutMs) * time.Millisecond
+		d.OracleConnectBy, _ = configurationData.GetString(prefix + `oracle_connect_by`)
+		switch d.OracleConnectBy {
+		case "", DXDatabaseOracleConnectByServiceName, DXDatabaseOracleConnectBySID:
+		default:
+			return d.configurationError("value of oracle_connect_by field of database %s configuration is not supported (%s)", d.NameId, d.OracleConnectBy)
+		}
+		d.OracleWalletPath, _ = configurationData.GetString(prefix + `wallet_path`)
+		if b, err := configurationData.GetBool(prefix + `debug_sql`); err == nil {
+			d.DebugSQL.SetEnabled(b)
+		}
+		d.DebugSQL.Log = d.Logger()
+		d.DebugSQL.RedactedFieldNames, _ = configurationData.GetStringSlice(prefix + `debug_sql_redacted_field_names`)
+		d.DebugSQL.MaxStatementLength, _ = configurationData.GetInt(prefix + `debug_sql_max_statement_length`)
+		d.ReadReplicaNameIds, _ = configurationData.GetStringSlice(prefix + `read_replicas`)
 
 		d.NonSensitiveConnectionString = d.GetNonSensitiveConnectionString()
-		d.ConnectionString, err = d.GetConnectionString()
-		if err != nil {
-			return err
+		if d.CredentialsProvider == nil {
+			d.ConnectionString, err = d.GetConnectionString()
+			if err != nil {
+				return err
+			}
+		} else {
+			// Built at every dial with the credentials of the CredentialsProvider, the address is checked here already
+			_, err = d.connectionStringOf("", "")
+			if err != nil {
+				return err
+			}
 		}
 		log.Log.Infof("Connecting to Database %s... done", d.NonSensitiveConnectionString)
 		d.IsConfigured = true
@@ -307,60 +462,90 @@ func (d *DXDatabase) CheckIsErrorBecauseDbNotExist(err error) bool {
 
 func (d *DXDatabase) Connect() (err error) {
 	if !d.Connected {
-		log.Log.Infof("Connecting to database %s/%s... start", d.NameId, d.NonSensitiveConnectionString)
-		connection, err := sqlx.Open(d.DatabaseType.Driver(), d.ConnectionString)
+		dbLog := d.Logger()
+		// Connect is repeated by CheckConnectionAndReconnect while the database is down
+		connectLog := d.rateLimitedLogger("connect")
+		connectFailedLog := d.rateLimitedLogger("connect_failed")
+		connectLog.Infof("Connecting to database %s/%s... start", d.NameId, d.NonSensitiveConnectionString)
+		connection, err := d.open()
 		if err != nil {
+			err = d.redactError(err)
 			if d.MustConnected {
-				log.Log.Fatalf("Invalid parameters to open database %s/%s (%s)", d.NameId, d.NonSensitiveConnectionString, err.Error())
-				return nil
+				return dbLog.FatalAndCreateErrorf("Invalid parameters to open database %s/%s (%s)", d.NameId, d.NonSensitiveConnectionString, err.Error())
 			} else {
-				log.Log.Errorf("Invalid parameters to open database %s/%s (%s)", d.NameId, d.NonSensitiveConnectionString, err.Error())
+				connectFailedLog.Errorf("Invalid parameters to open database %s/%s (%s)", d.NameId, d.NonSensitiveConnectionString, err.Error())
 				return err
 			}
 		}
+		d.applyPoolSettings(connection)
+		d.connectionMutex.Lock()
 		d.Connection = connection
+		d.connectionMutex.Unlock()
+		db.SetTraceDatabaseName(connection, d.DatabaseName)
+		db.SetDebugSQL(connection, &d.DebugSQL)
 		err = connection.Ping()
 		if err != nil {
+			err = d.redactError(err)
 			if d.OnCannotConnect != nil {
 				d.OnCannotConnect(d, err)
 			}
 			if d.MustConnected {
-				log.Log.Fatalf("Cannot connect and ping to database %s/%s (%s)", d.NameId, d.NonSensitiveConnectionString, err.Error())
-				return nil
+				return dbLog.FatalAndCreateErrorf("Cannot connect and ping to database %s/%s (%s)", d.NameId, d.NonSensitiveConnectionString, err.Error())
 			} else {
-				log.Log.Errorf("Cannot connect and ping to database %s/%s (%s)", d.NameId, d.NonSensitiveConnectionString, err.Error())
+				connectFailedLog.Errorf("Cannot connect and ping to database %s/%s (%s)", d.NameId, d.NonSensitiveConnectionString, err.Error())
 				return err
 			}
 		}
 		d.Connected = true
-		log.Log.Infof("Connecting to database %s/%s... done CONNECTED", d.NameId, d.NonSensitiveConnectionString)
+		dbLog.Infof("Connecting to database %s/%s... done CONNECTED", d.NameId, d.NonSensitiveConnectionString)
 	}
 	return nil
 }
 
 func (d *DXDatabase) Disconnect() (err error) {
 	if d.Connected {
-		log.Log.Infof("Disconnecting to database %s/%s... start", d.NameId, d.NonSensitiveConnectionString)
+		dbLog := d.Logger()
+		dbLog.Infof("Disconnecting to database %s/%s... start", d.NameId, d.NonSensitiveConnectionString)
 		err := (*d.Connection).Close()
 		if err != nil {
-			log.Log.Errorf("Disconnecting to database %s/%s error (%s)", d.NameId, d.NonSensitiveConnectionString, err.Error())
+			err = d.redactError(err)
+			dbLog.Errorf("Disconnecting to database %s/%s error (%s)", d.NameId, d.NonSensitiveConnectionString, err.Error())
 			return err
 		}
+		db.SetTraceDatabaseName(d.Connection, "")
+		db.SetDebugSQL(d.Connection, nil)
+		d.connectionMutex.Lock()
 		d.Connection = nil
+		d.connectionMutex.Unlock()
 		d.Connected = false
-		log.Log.Infof("Disconnecting to database %s/%s... done DISCONNECTED", d.NameId, d.NonSensitiveConnectionString)
+		dbLog.Infof("Disconnecting to database %s/%s... done DISCONNECTED", d.NameId, d.NonSensitiveConnectionString)
 	}
 	return nil
 }
 
 func (d *DXDatabase) Execute(statement string, parameters utils.JSON) (r any, err error) {
-	isDDL := utilsSql.IsDDL(statement)
-	if !isDDL {
-		query := pq.NewNamedParameterQuery(statement)
-		query.SetValuesFromMap(parameters)
-		s := query.GetParsedQuery()
-		p := query.GetParsedParameters()
-		r, err = d.Connection.Exec(s, p...)
+	return d.ExecuteContext(context.Background(), statement, parameters)
+}
+
+// ExecuteContext is Execute, the statement is cancelled when ctx ends, a request context bounds it by the timeout of the request.
+// A statement other than a select pins the routing of ctx to the primary.
+func (d *DXDatabase) ExecuteContext(ctx context.Context, statement string, parameters utils.JSON) (r any, err error) {
+	defer func() {
+		err = db.ClassifyError(err)
+	}()
+	statementClass := utilsSql.Classify(statement, d.DatabaseType)
+	if statementClass != utilsSql.DXSQLStatementClassDQL {
+		pinToPrimary(ctx)
+	}
+	execCtx, release, err := d.acquireContext(ctx, d.Connection)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	// DDL can not take bind parameters, so only a statement classified as DDL gets its parameters substituted in the text
+	if statementClass != utilsSql.DXSQLStatementClassDDL {
+		s, p := db.ParseNamedParameterQuery(d.Connection.DriverName(), statement, parameters)
+		r, err = db.ConnectionOf(execCtx, d.Connection).ExecContext(execCtx, s, p...)
 		return r, err
 	}
 	s := statement
@@ -377,19 +562,27 @@ func (d *DXDatabase) Execute(statement string, parameters utils.JSON) (r any, er
 		}
 		s = strings.Replace(s, `:`+strings.ToUpper(k), vs, -1)
 	}
-	r, err = d.Connection.Exec(s)
+	r, err = db.ConnectionOf(execCtx, d.Connection).ExecContext(execCtx, s)
 	if err != nil {
 		if d.Connected {
 			return nil, err
 		}
+		// The connection taken goes back to the pool before the reconnect, the retry takes one of the new pool
+		release()
 		err = d.CheckConnectionAndReconnect()
 		if err != nil {
 			return nil, err
 		}
-		r, err = d.Connection.Exec(s)
+		retryCtx, releaseRetry, err := d.acquireContext(ctx, d.Connection)
 		if err != nil {
 			return nil, err
 		}
+		defer releaseRetry()
+		r, err = db.ConnectionOf(retryCtx, d.Connection).ExecContext(retryCtx, s)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
 	}
 	return r, err
 }
@@ -409,81 +602,291 @@ func (d *DXDatabase) PropertyValue(key string) (value string, err error) {
 	return value, nil
 }
 
-func (d *DXDatabase) Insert(tableName string, fieldNameForRowId string, keyValues utils.JSON) (id int64, err error) {
+// Insert returns the value of fieldNameForRowId of the new row, with an AuditHook too, where the audited row has it as well
+func (d *DXDatabase) Insert(tableName string, fieldNameForRowId string, keyValues utils.JSON, opts ...DXDatabaseWriteOption) (id int64, err error) {
+	return d.InsertContext(context.Background(), tableName, fieldNameForRowId, keyValues, opts...)
+}
+
+// InsertContext is Insert ended with ctx, the transaction of an AuditHook too
+func (d *DXDatabase) InsertContext(ctx context.Context, tableName string, fieldNameForRowId string, keyValues utils.JSON, opts ...DXDatabaseWriteOption) (id int64, err error) {
+	pinToPrimary(ctx)
 	//err = d.CheckConnectionAndReconnect()
 	//if err != nil {
 	//	return 0, err
 	//}
-	return db.Insert(d.Connection, tableName, fieldNameForRowId, keyValues)
+	if d.AuditHook != nil {
+		err = d.auditTx(ctx, func(dtx *DXDatabaseTx) (err error) {
+			id, err = dtx.insert(tableName, fieldNameForRowId, keyValues, opts)
+			return err
+		})
+		return id, err
+	}
+	keyValues, err = d.resolveTenant(tableName, keyValues)
+	if err != nil {
+		return 0, err
+	}
+	keyValues, err = d.encryptKeyValues(tableName, keyValues)
+	if err != nil {
+		return 0, err
+	}
+	ctx, release, err := d.acquireContext(ctx, d.Connection)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return db.InsertContext(ctx, d.Connection, tableName, fieldNameForRowId, keyValues)
+}
+
+func (d *DXDatabase) Update(tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON, opts ...DXDatabaseWriteOption) (result sql.Result, err error) {
+	return d.UpdateContext(context.Background(), tableName, setKeyValues, whereKeyValues, opts...)
 }
 
-func (d *DXDatabase) Update(tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result sql.Result, err error) {
+func (d *DXDatabase) UpdateContext(ctx context.Context, tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON, opts ...DXDatabaseWriteOption) (result sql.Result, err error) {
+	pinToPrimary(ctx)
 	//err = d.CheckConnectionAndReconnect()
 	//if err != nil {
 	//	return nil, err
 	//}
-	return db.Update(d.Connection, tableName, setKeyValues, whereKeyValues)
+	if d.AuditHook != nil {
+		err = d.auditTx(ctx, func(dtx *DXDatabaseTx) (err error) {
+			result, err = dtx.Update(tableName, setKeyValues, whereKeyValues, opts...)
+			return err
+		})
+		return result, err
+	}
+	err = d.checkTenantNotSet(tableName, setKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	setKeyValues, err = d.encryptKeyValues(tableName, setKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	whereKeyValues, err = d.resolveTenant(tableName, whereKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	whereKeyValues, err = d.encryptWhereKeyValues(tableName, whereKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	ctx, release, err := d.acquireContext(ctx, d.Connection)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return db.UpdateContext(ctx, d.Connection, tableName, setKeyValues, whereKeyValues)
 }
 
 func (d *DXDatabase) ShouldSelectCount(tableName string, summaryCalcFieldsPart string, whereAndFieldNameValues utils.JSON) (totalRows int64, c utils.JSON, err error) {
-	totalRows, c, err = db.ShouldSelectCount(d.Connection, tableName, summaryCalcFieldsPart, whereAndFieldNameValues, nil)
+	return d.ShouldSelectCountContext(context.Background(), tableName, summaryCalcFieldsPart, whereAndFieldNameValues)
+}
+
+func (d *DXDatabase) ShouldSelectCountContext(ctx context.Context, tableName string, summaryCalcFieldsPart string,
+	whereAndFieldNameValues utils.JSON) (totalRows int64, c utils.JSON, err error) {
+	whereAndFieldNameValues, err = d.resolveTenant(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return 0, nil, err
+	}
+	whereAndFieldNameValues, err = d.encryptWhereKeyValues(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return 0, nil, err
+	}
+	connection := d.readConnection(ctx)
+	ctx, release, err := d.acquireContext(ctx, connection)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer release()
+	totalRows, c, err = db.ShouldSelectCountContext(ctx, connection, tableName, summaryCalcFieldsPart, whereAndFieldNameValues, nil)
 	return totalRows, c, err
 }
 
 func (d *DXDatabase) ShouldSelectOne(tableName string, whereAndFieldNameValues utils.JSON, orderbyFieldNameDirections map[string]string) (
+	rowsInfo *db.RowsInfo, resultData utils.JSON, err error) {
+	return d.ShouldSelectOneContext(context.Background(), tableName, whereAndFieldNameValues, orderbyFieldNameDirections)
+}
+
+func (d *DXDatabase) ShouldSelectOneContext(ctx context.Context, tableName string, whereAndFieldNameValues utils.JSON, orderbyFieldNameDirections map[string]string) (
 	rowsInfo *db.RowsInfo, resultData utils.JSON, err error) {
 	//err = d.CheckConnectionAndReconnect()
 	//if err != nil {
 	//	return nil, nil, err
 	//}
-	rowsInfo, resultData, err = db.ShouldSelectOne(d.Connection, nil, tableName, nil, whereAndFieldNameValues, nil, orderbyFieldNameDirections)
+	whereAndFieldNameValues, err = d.resolveTenant(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	whereAndFieldNameValues, err = d.encryptWhereKeyValues(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	connection := d.readConnection(ctx)
+	ctx, release, err := d.acquireContext(ctx, connection)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+	rowsInfo, resultData, err = db.ShouldSelectOneContext(ctx, connection, nil, tableName, nil, whereAndFieldNameValues, nil, orderbyFieldNameDirections)
+	if err != nil {
+		return rowsInfo, resultData, err
+	}
+	err = d.decryptRows(tableName, resultData)
 	return rowsInfo, resultData, err
 }
 
 func (d *DXDatabase) Select(tableName string, showFieldNames []string, whereAndFieldNameValues utils.JSON, orderbyFieldNameDirections map[string]string,
-	limit any) (rowsInfo *db.RowsInfo, resultData []utils.JSON, err error) {
+	limit any, opts ...DXDatabaseSelectOption) (rowsInfo *db.RowsInfo, resultData []utils.JSON, err error) {
+	return d.SelectContext(context.Background(), tableName, showFieldNames, whereAndFieldNameValues, orderbyFieldNameDirections, limit, opts...)
+}
+
+// SelectContext is Select, the query is cancelled when ctx ends
+func (d *DXDatabase) SelectContext(ctx context.Context, tableName string, showFieldNames []string, whereAndFieldNameValues utils.JSON,
+	orderbyFieldNameDirections map[string]string, limit any, opts ...DXDatabaseSelectOption) (rowsInfo *db.RowsInfo, resultData []utils.JSON, err error) {
 	//err = d.CheckConnectionAndReconnect()
 	//if err != nil {
 	//	return nil, nil, err
 	//}
-	return db.Select(d.Connection, nil, tableName, showFieldNames, whereAndFieldNameValues, nil, orderbyFieldNameDirections, limit)
+	whereAndFieldNameValues, err = d.resolveTenant(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	whereAndFieldNameValues, err = d.encryptWhereKeyValues(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	o := selectOptionsOf(opts)
+	connection := d.readConnection(ctx)
+	ctx, release, err := d.acquireContext(ctx, connection)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+	rowsInfo, resultData, err = db.SelectWithMaxRowsContext(ctx, connection, nil, tableName, showFieldNames, whereAndFieldNameValues, nil, orderbyFieldNameDirections,
+		limit, d.MaxRowsPerSelect, o.isTruncateOnMaxRows)
+	d.checkTooManyRows(tableName, rowsInfo, err)
+	if err != nil {
+		return rowsInfo, resultData, err
+	}
+	err = d.decryptRows(tableName, resultData...)
+	return rowsInfo, resultData, err
 }
 
 func (d *DXDatabase) SelectOne(tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string) (rowsInfo *db.RowsInfo, r utils.JSON, err error) {
+	return d.SelectOneContext(context.Background(), tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections)
+}
+
+// SelectOneContext is SelectOne ended with ctx, its retries after a failure consume from the retry.Budget of ctx. Once the
+// budget is spent the failure is returned with retry.ErrBudgetExhausted attached.
+func (d *DXDatabase) SelectOneContext(ctx context.Context, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON,
+	joinSQLPart any, orderbyFieldNameDirections map[string]string) (rowsInfo *db.RowsInfo, r utils.JSON, err error) {
 
+	whereAndFieldNameValues, err = d.resolveTenant(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	whereAndFieldNameValues, err = d.encryptWhereKeyValues(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, nil, err
+	}
 	tryCount := 0
 	for {
-		rowsInfo, r, err = db.SelectOne(d.Connection, nil, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections)
+		connection := d.readConnection(ctx)
+		tryCtx, release, errAcquire := d.acquireContext(ctx, connection)
+		if errAcquire != nil {
+			return nil, nil, errAcquire
+		}
+		rowsInfo, r, err = db.SelectOneContext(tryCtx, connection, nil, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections)
+		release()
 		if err == nil {
-			return rowsInfo, r, nil
+			if r != nil {
+				err = d.decryptRows(tableName, r)
+			}
+			return rowsInfo, r, err
+		}
+		if tryCount >= 4 {
+			return nil, nil, err
+		}
+		errBudget := retry.TryConsume(ctx, err)
+		if errBudget != nil {
+			return nil, nil, errBudget
 		}
+		tryCount++
+		log.Log.Warnf("SELECT_ONE_ERROR:%s=%v", tableName, err.Error())
+		err = d.CheckConnectionAndReconnect()
 		if err != nil {
-			if tryCount < 4 {
-				tryCount++
-				log.Log.Warnf("SELECT_ONE_ERROR:%s=%v", tableName, err.Error())
-				err = d.CheckConnectionAndReconnect()
-				if err != nil {
-					return nil, nil, err
-				}
-			}
+			return nil, nil, err
 		}
 	}
 }
 
-func (d *DXDatabase) SoftDelete(tableName string, whereKeyValues utils.JSON) (result sql.Result, err error) {
-	return d.Update(tableName, utils.JSON{
+func (d *DXDatabase) SoftDelete(tableName string, whereKeyValues utils.JSON, opts ...DXDatabaseWriteOption) (result sql.Result, err error) {
+	return d.SoftDeleteContext(context.Background(), tableName, whereKeyValues, opts...)
+}
+
+func (d *DXDatabase) SoftDeleteContext(ctx context.Context, tableName string, whereKeyValues utils.JSON, opts ...DXDatabaseWriteOption) (result sql.Result, err error) {
+	pinToPrimary(ctx)
+	if d.AuditHook != nil {
+		err = d.auditTx(ctx, func(dtx *DXDatabaseTx) (err error) {
+			result, err = dtx.SoftDelete(tableName, whereKeyValues, opts...)
+			return err
+		})
+		return result, err
+	}
+	return d.UpdateContext(ctx, tableName, utils.JSON{
 		`is_deleted`: true,
 	}, whereKeyValues)
 }
 
-func (d *DXDatabase) Delete(tableName string, whereKeyValues utils.JSON) (r sql.Result, err error) {
-	return db.Delete(d.Connection, tableName, whereKeyValues)
+func (d *DXDatabase) Delete(tableName string, whereKeyValues utils.JSON, opts ...DXDatabaseWriteOption) (r sql.Result, err error) {
+	return d.DeleteContext(context.Background(), tableName, whereKeyValues, opts...)
+}
+
+func (d *DXDatabase) DeleteContext(ctx context.Context, tableName string, whereKeyValues utils.JSON, opts ...DXDatabaseWriteOption) (r sql.Result, err error) {
+	pinToPrimary(ctx)
+	if d.AuditHook != nil {
+		err = d.auditTx(ctx, func(dtx *DXDatabaseTx) (err error) {
+			r, err = dtx.Delete(tableName, whereKeyValues, opts...)
+			return err
+		})
+		return r, err
+	}
+	whereKeyValues, err = d.resolveTenant(tableName, whereKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	whereKeyValues, err = d.encryptWhereKeyValues(tableName, whereKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	ctx, release, err := d.acquireContext(ctx, d.Connection)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return db.DeleteContext(ctx, d.Connection, tableName, whereKeyValues)
+}
+
+// DeleteOne is DXDatabaseTx.DeleteOne in a transaction of its own, several matching rows are not deleted
+func (d *DXDatabase) DeleteOne(tableName string, whereKeyValues utils.JSON, opts ...DXDatabaseWriteOption) (r sql.Result, err error) {
+	return d.DeleteOneContext(context.Background(), tableName, whereKeyValues, opts...)
+}
+
+func (d *DXDatabase) DeleteOneContext(ctx context.Context, tableName string, whereKeyValues utils.JSON, opts ...DXDatabaseWriteOption) (r sql.Result, err error) {
+	l := d.Logger()
+	l.Context = ctx
+	err = d.Tx(&l, sql.LevelDefault, func(dtx *DXDatabaseTx) (err error) {
+		r, err = dtx.DeleteOne(tableName, whereKeyValues, opts...)
+		return err
+	})
+	return r, err
 }
 
 func (d *DXDatabase) ExecuteFile(filename string) (r sql.Result, err error) {
 	defer func() {
 		if err != nil {
+			err = d.redactError(err)
 			log.Log.Errorf("Error executing file %s (%v)", filename, err.Error())
 		}
 	}()
@@ -570,29 +973,13 @@ func (d *DXDatabase) ExecuteFile(filename string) (r sql.Result, err error) {
 
 }
 
+// ExecuteCreateScripts executes the CreateScriptFiles as one script stopping at the first error
 func (d *DXDatabase) ExecuteCreateScripts() (rs []sql.Result, err error) {
-	if !d.Connected {
-		err = d.Connect()
-		if err != nil {
-			return nil, err
-		}
-	}
-	rs = []sql.Result{}
-	for k, v := range d.CreateScriptFiles {
-		r, err := d.ExecuteFile(v)
-		if err != nil {
-			log.Log.Errorf("Error executing file %d:'%s' (%s)", k, v, err.Error())
-			var sqlErr mssql.Error
-			if errors.As(err, &sqlErr) {
-				log.Log.Errorf("SQL Server Error Number: %d, State: %d, FCMMessage: %s",
-					sqlErr.Number, sqlErr.State, sqlErr.Message)
-			}
-			return rs, err
-		}
-		log.Log.Infof("Executing file %d:'%s'... done", k+1, v)
-		rs = append(rs, r)
+	results, err := d.ExecuteScripts([]*DXDatabaseScript{{NameId: d.NameId + "/create_script_files", Files: d.CreateScriptFiles}})
+	if len(results) > 0 {
+		rs = results[0].Results
 	}
-	return rs, nil
+	return rs, err
 }
 
 func (d *DXDatabase) Tx(log *log.DXLog, isolationLevel sql.IsolationLevel, callback DXDatabaseTxCallback) (err error) {
@@ -608,6 +995,8 @@ func (d *DXDatabase) Tx(log *log.DXLog, isolationLevel sql.IsolationLevel, callb
 			log.Error(err.Error())
 			return err
 		}
+		// The log of the caller carries its context, the routing of its writes
+		tx.Log = d.txLog(log)
 		err = callback(tx)
 		if err != nil {
 			log.Errorf(`TX_ERROR_IN_CALLBACK: (%v)`, err.Error())
@@ -630,7 +1019,7 @@ func (d *DXDatabase) Tx(log *log.DXLog, isolationLevel sql.IsolationLevel, callb
 		return nil
 	}
 
-	tx, err := d.Connection.BeginTxx(log.Context, &sql.TxOptions{
+	tx, err := d.beginTxx(log.Context, &sql.TxOptions{
 		Isolation: isolationLevel,
 		ReadOnly:  false,
 	})
@@ -639,8 +1028,9 @@ func (d *DXDatabase) Tx(log *log.DXLog, isolationLevel sql.IsolationLevel, callb
 		return err
 	}
 	dtx := &DXDatabaseTx{
-		Tx:  tx,
-		Log: log,
+		Tx:       tx,
+		Log:      d.txLog(log),
+		Database: d,
 	}
 	err = callback(dtx)
 	if err != nil {
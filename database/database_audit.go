@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database/protected/dbtx"
+	"github.com/donnyhardyanto/dxlib/utils"
+	json2 "github.com/donnyhardyanto/dxlib/utils/json"
+)
+
+const (
+	DXDatabaseAuditOpInsert     = "INSERT"
+	DXDatabaseAuditOpUpdate     = "UPDATE"
+	DXDatabaseAuditOpDelete     = "DELETE"
+	DXDatabaseAuditOpSoftDelete = "SOFT_DELETE"
+)
+
+// DXDatabaseAuditHook is called once per written row inside the transaction of the write, before is nil for an insert and
+// after is nil for a delete. An error rolls the write back. dtx is given so the hook writes its record in that transaction.
+type DXDatabaseAuditHook func(dtx *DXDatabaseTx, op string, tableName string, before, after utils.JSON, meta utils.JSON) (err error)
+
+type dxDatabaseWriteOptions struct {
+	auditMeta utils.JSON
+}
+
+type DXDatabaseWriteOption func(o *dxDatabaseWriteOptions)
+
+// WithAuditMeta gives the audit hook the context of the caller, like the user id and the request id, the API layer has it
+// in DXAPIEndPointRequest.AuditMeta
+func WithAuditMeta(meta utils.JSON) DXDatabaseWriteOption {
+	return func(o *dxDatabaseWriteOptions) {
+		o.auditMeta = meta
+	}
+}
+
+func auditMetaOf(opts []DXDatabaseWriteOption) utils.JSON {
+	o := dxDatabaseWriteOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.auditMeta == nil {
+		return utils.JSON{}
+	}
+	return o.auditMeta
+}
+
+func (dtx *DXDatabaseTx) isAudited() bool {
+	return dtx.Database != nil && dtx.Database.AuditHook != nil
+}
+
+// auditBefore locks and reads the rows a write is about to change, nil when the database has no audit hook
+func (dtx *DXDatabaseTx) auditBefore(tableName string, whereKeyValues utils.JSON) (before []utils.JSON, err error) {
+	if !dtx.isAudited() {
+		return nil, nil
+	}
+	_, before, err = dtx.Select(tableName, nil, whereKeyValues, nil, nil, nil, true)
+	return before, err
+}
+
+// auditRows calls the audit hook for each row of before, after is the row with setKeyValues applied, or nil without them
+func (dtx *DXDatabaseTx) auditRows(op string, tableName string, before []utils.JSON, setKeyValues utils.JSON, opts []DXDatabaseWriteOption) (err error) {
+	if !dtx.isAudited() {
+		return nil
+	}
+	meta := auditMetaOf(opts)
+	for _, row := range before {
+		var after utils.JSON
+		if setKeyValues != nil {
+			after = json2.Copy(row)
+			for k, v := range setKeyValues {
+				after[k] = v
+			}
+		}
+		err = dtx.Database.AuditHook(dtx, op, tableName, row, after, meta)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditTx runs callback in a transaction of d, the writes of DXDatabase go through it when d has an audit hook
+// auditTx begins the transaction of an audited write with ctx, ending ctx rolls the write and its audit back
+func (d *DXDatabase) auditTx(ctx context.Context, callback DXDatabaseTxCallback) (err error) {
+	l := d.Logger()
+	l.Context = ctx
+	return d.Tx(&l, sql.LevelDefault, callback)
+}
+
+// NewAuditLogTableHook returns an audit hook inserting one row per change into tableName, in the transaction of the change.
+// The table has the columns id (generated), table_name, operation, before_values, after_values, changed_fields, meta and
+// created_at, the JSON columns hold text. changed_fields is the json.Diff of before and after, with the secrets redacted.
+func NewAuditLogTableHook(tableName string) DXDatabaseAuditHook {
+	return func(dtx *DXDatabaseTx, op string, changedTableName string, before, after utils.JSON, meta utils.JSON) (err error) {
+		values := utils.JSON{
+			"table_name": changedTableName,
+			"operation":  op,
+			"created_at": time.Now().UTC(),
+		}
+		for k, v := range map[string]any{
+			"before_values":  before,
+			"after_values":   after,
+			"changed_fields": json2.Diff(before, after),
+			"meta":           meta,
+		} {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			values[k] = string(b)
+		}
+		// Written with dbtx directly, the audit table itself is neither audited nor encrypted
+		_, err = dbtx.TxInsert(dtx.Log, false, dtx.Tx, tableName, values)
+		return err
+	}
+}
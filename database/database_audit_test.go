@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// newFakeDatabase returns a connected DXDatabase over a fake database of driverName
+func newFakeDatabase(t testing.TB, databaseType database_type.DXDatabaseType, driverName string, handler dbtest.DXFakeHandler) (*DXDatabase, *dbtest.DXFakeDatabase) {
+	t.Helper()
+	f := dbtest.Open(driverName, handler)
+	t.Cleanup(func() {
+		_ = f.Close()
+	})
+	d := &DXDatabase{
+		NameId:       "fake",
+		DatabaseType: databaseType,
+		Connection:   f.DB,
+		Connected:    true,
+	}
+	return d, f
+}
+
+// An audited insert returns, and audits, the field asked for the row id, not the id field
+func TestAuditedInsertReturnsFieldNameForRowId(t *testing.T) {
+	d, f := newFakeDatabase(t, database_type.PostgreSQL, "postgres", func(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+		if s.IsQuery {
+			return dbtest.DXFakeResult{Columns: []string{"item_id"}, Rows: [][]any{{int64(7)}}}
+		}
+		return dbtest.DXFakeResult{RowsAffected: 1}
+	})
+	var audited utils.JSON
+	d.AuditHook = func(dtx *DXDatabaseTx, op string, tableName string, before, after utils.JSON, meta utils.JSON) (err error) {
+		audited = after
+		return nil
+	}
+	id, err := d.Insert("item", "item_id", utils.JSON{"name": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 7 {
+		t.Fatalf("id %d", id)
+	}
+	var insert string
+	for _, q := range f.Queries() {
+		if strings.HasPrefix(strings.ToLower(q), "insert") {
+			insert = q
+		}
+	}
+	if !strings.Contains(strings.ToLower(insert), `returning "item_id"`) {
+		t.Fatalf("insert %q", insert)
+	}
+	if audited["item_id"] != int64(7) || audited["id"] != nil {
+		t.Fatalf("audited %v", audited)
+	}
+}
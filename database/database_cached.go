@@ -0,0 +1,27 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+	"github.com/donnyhardyanto/dxlib/utils/cache"
+)
+
+// CachedSelectOne is SelectOne of all the fields of the row of tableName matching where, kept in c for ttl. It is meant for
+// the reference data read often and changed seldom, like a lookup by code. A row not found is kept as nil too, so an unknown
+// code does not hit the database either. The key is the table name and the where, the same c can serve several tables. The
+// row returned is the one kept, it must not be modified.
+func (d *DXDatabase) CachedSelectOne(c *cache.DXCache[string, utils.JSON], tableName string, whereAndFieldNameValues utils.JSON,
+	ttl time.Duration) (r utils.JSON, err error) {
+	// encoding/json writes the keys of a map sorted, the same where always gives the same key
+	where, err := json.Marshal(whereAndFieldNameValues)
+	if err != nil {
+		return nil, err
+	}
+	key := d.NameId + ":" + tableName + ":" + string(where)
+	return c.GetOrLoadWithTTL(key, ttl, func() (utils.JSON, error) {
+		_, r, err := d.SelectOne(tableName, nil, whereAndFieldNameValues, nil, nil)
+		return r, err
+	})
+}
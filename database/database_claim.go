@@ -0,0 +1,38 @@
+package database
+
+import (
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// ClaimRows is db.ClaimRows on d, the where values and the set values are encrypted and the rows decrypted like Update and
+// Select. It is the way for the workers of several replicas to share a queue table.
+func (d *DXDatabase) ClaimRows(tableName string, idFieldName string, whereAndFieldNameValues utils.JSON, orderbyFieldNameDirections map[string]string,
+	limit int64, setKeyValues utils.JSON) (rows []utils.JSON, err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, err
+	}
+	whereAndFieldNameValues, err = d.resolveTenant(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, err
+	}
+	whereAndFieldNameValues, err = d.encryptWhereKeyValues(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, err
+	}
+	err = d.checkTenantNotSet(tableName, setKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	setKeyValues, err = d.encryptKeyValues(tableName, setKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	_, rows, err = db.ClaimRows(d.Connection, nil, tableName, idFieldName, whereAndFieldNameValues, orderbyFieldNameDirections, limit, setKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	err = d.decryptRows(tableName, rows...)
+	return rows, err
+}
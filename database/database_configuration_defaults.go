@@ -0,0 +1,16 @@
+package database
+
+import (
+	"github.com/donnyhardyanto/dxlib/configuration"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+func init() {
+	configuration.RegisterDefaults("storage", utils.JSON{
+		configuration.DXConfigurationDefaultsEveryEntryKey: utils.JSON{
+			"must_connected":      false,
+			"is_connect_at_start": false,
+			"connection_options":  "",
+		},
+	})
+}
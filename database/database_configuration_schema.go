@@ -0,0 +1,62 @@
+package database
+
+import (
+	"github.com/donnyhardyanto/dxlib/configuration"
+)
+
+func requiredString() *configuration.DXConfigurationSchema {
+	return &configuration.DXConfigurationSchema{Types: []string{configuration.DXConfigurationSchemaTypeString}, Required: true}
+}
+
+// StorageConfigurationSchema is the shape of the "storage" configuration, one entry per database
+var StorageConfigurationSchema = &configuration.DXConfigurationSchema{
+	Types: []string{configuration.DXConfigurationSchemaTypeObject},
+	EntrySchema: &configuration.DXConfigurationSchema{
+		Types: []string{configuration.DXConfigurationSchemaTypeObject},
+		Properties: map[string]*configuration.DXConfigurationSchema{
+			"nameid":              {Types: []string{configuration.DXConfigurationSchemaTypeString}},
+			"must_connected":      {Types: []string{configuration.DXConfigurationSchemaTypeBool}},
+			"is_connect_at_start": {Types: []string{configuration.DXConfigurationSchemaTypeBool}},
+			"database_type": {
+				Types:    []string{configuration.DXConfigurationSchemaTypeString},
+				Required: true,
+				Enum:     []any{"postgres", "postgresql", "mariadb", "mysql", "oracle", "sqlserver"},
+			},
+			"address":              requiredString(),
+			"user_name":            requiredString(),
+			"user_password":        requiredString(),
+			"database_name":        requiredString(),
+			"create_script_files":  {Types: []string{configuration.DXConfigurationSchemaTypeArray}},
+			"connection_options":   {Types: []string{configuration.DXConfigurationSchemaTypeString}},
+			"max_open_connections": {Types: []string{configuration.DXConfigurationSchemaTypeNumber}},
+			"max_idle_connections": {Types: []string{configuration.DXConfigurationSchemaTypeNumber}},
+			// A time.ParseDuration string or a number of seconds
+			"connection_max_lifetime":  {Types: []string{configuration.DXConfigurationSchemaTypeString, configuration.DXConfigurationSchemaTypeNumber}},
+			"connection_max_idle_time": {Types: []string{configuration.DXConfigurationSchemaTypeString, configuration.DXConfigurationSchemaTypeNumber}},
+			"max_open_conns":           {Types: []string{configuration.DXConfigurationSchemaTypeNumber}},
+			"max_idle_conns":           {Types: []string{configuration.DXConfigurationSchemaTypeNumber}},
+			"conn_max_lifetime_sec":    {Types: []string{configuration.DXConfigurationSchemaTypeNumber}},
+			"conn_max_idle_time_sec":   {Types: []string{configuration.DXConfigurationSchemaTypeNumber}},
+			"acquire_timeout_ms":       {Types: []string{configuration.DXConfigurationSchemaTypeNumber}},
+			"max_rows_per_select":      {Types: []string{configuration.DXConfigurationSchemaTypeNumber}},
+			// Applied by the database server to every statement of the pool
+			"server_statement_timeout_ms": {Types: []string{configuration.DXConfigurationSchemaTypeNumber}},
+			// How database_name names an Oracle database
+			"oracle_connect_by": {
+				Types: []string{configuration.DXConfigurationSchemaTypeString},
+				Enum:  []any{DXDatabaseOracleConnectByServiceName, DXDatabaseOracleConnectBySID},
+			},
+			"wallet_path": {Types: []string{configuration.DXConfigurationSchemaTypeString}},
+			// Logs the statements of the helpers at the debug level, see DXDatabase.DebugSQL
+			"debug_sql":                      {Types: []string{configuration.DXConfigurationSchemaTypeBool}},
+			"debug_sql_redacted_field_names": {Types: []string{configuration.DXConfigurationSchemaTypeArray}},
+			"debug_sql_max_statement_length": {Types: []string{configuration.DXConfigurationSchemaTypeNumber}},
+			// The name ids of the databases taking the reads of this one, see DXDatabase.ReadReplicas
+			"read_replicas": {Types: []string{configuration.DXConfigurationSchemaTypeArray}},
+		},
+	},
+}
+
+func init() {
+	configuration.RegisterSchema("storage", StorageConfigurationSchema)
+}
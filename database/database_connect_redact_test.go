@@ -0,0 +1,124 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/log"
+)
+
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buffer bytes.Buffer
+	previous := logrus.StandardLogger().Out
+	log.SetOutput(&buffer)
+	t.Cleanup(func() { log.SetOutput(previous) })
+	return &buffer
+}
+
+// closedAddress returns a loopback address no one listens on, a connection to it is refused at once
+func closedAddress(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	_ = l.Close()
+	return address
+}
+
+func newSentinelDatabase(t *testing.T, databaseType database_type.DXDatabaseType) *DXDatabase {
+	t.Helper()
+	d := &DXDatabase{
+		NameId:       "sentinel",
+		DatabaseType: databaseType,
+		Address:      closedAddress(t),
+		UserName:     "app",
+		UserPassword: sentinelPassword,
+		DatabaseName: "main",
+	}
+	s, err := d.GetConnectionString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.ConnectionString = s
+	d.NonSensitiveConnectionString = d.GetNonSensitiveConnectionString()
+	return d
+}
+
+// The connection failures of the real drivers, on the open, ping, check and reconnect paths, never log the password
+func TestConnectionFailuresNeverLogThePassword(t *testing.T) {
+	for _, databaseType := range []database_type.DXDatabaseType{
+		database_type.PostgreSQL, database_type.MySQL, database_type.SQLServer, database_type.Oracle,
+	} {
+		t.Run(databaseType.String(), func(t *testing.T) {
+			output := captureLog(t)
+			d := newSentinelDatabase(t, databaseType)
+			err := d.Connect()
+			if err == nil {
+				t.Fatal("connected to a closed port")
+			}
+			var errs []error
+			errs = append(errs, err)
+			errs = append(errs, d.CheckConnection())
+			errs = append(errs, d.CheckConnectionAndReconnect())
+			_, err = d.ExecuteFile("missing.sql")
+			errs = append(errs, err)
+			for _, err := range errs {
+				if err == nil {
+					t.Fatal("a failure returned no error")
+				}
+				if strings.Contains(err.Error(), sentinelPassword) {
+					t.Fatalf("the error has the password: %s", err.Error())
+				}
+			}
+			var databaseError *DXDatabaseError
+			if !errors.As(errs[0], &databaseError) {
+				t.Fatalf("%T is not a DXDatabaseError", errs[0])
+			}
+			// The original error of the driver is kept for the callers inspecting it
+			var opError *net.OpError
+			if errors.Unwrap(errs[0]) == nil || !errors.As(errs[0], &opError) {
+				t.Fatalf("the dial error is lost in %#v", errs[0])
+			}
+			if output.Len() == 0 {
+				t.Fatal("no failure was logged")
+			}
+			if strings.Contains(output.String(), sentinelPassword) {
+				t.Fatalf("the log has the password:\n%s", output.String())
+			}
+		})
+	}
+}
+
+// A driver error echoing the connection string, in each of the formats, is logged without the password and unwraps to the
+// error of the driver
+func TestRedactErrorOfDriverErrorsEchoingTheConnectionString(t *testing.T) {
+	for _, databaseType := range []database_type.DXDatabaseType{
+		database_type.PostgreSQL, database_type.MySQL, database_type.SQLServer, database_type.Oracle,
+	} {
+		t.Run(databaseType.String(), func(t *testing.T) {
+			output := captureLog(t)
+			d := newSentinelDatabase(t, databaseType)
+			driverError := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+			err := d.redactError(fmt.Errorf("cannot open %s: %w", d.ConnectionString, driverError))
+			dbLog := d.Logger()
+			dbLog.Errorf("Cannot connect and ping to database %s (%s)", d.NameId, err.Error())
+			dbLog.Errorf("Cannot connect and ping to database %s (%v)", d.NameId, err)
+			if strings.Contains(err.Error(), sentinelPassword) || strings.Contains(output.String(), sentinelPassword) {
+				t.Fatalf("the password is left in %s\n%s", err.Error(), output.String())
+			}
+			if !errors.Is(err, driverError) || !strings.Contains(errors.Unwrap(err).Error(), sentinelPassword) {
+				t.Fatalf("the original error is lost in %#v", err)
+			}
+		})
+	}
+}
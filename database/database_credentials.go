@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+)
+
+// DXDatabaseCredentialsProvider returns the user name and the password of a new connection. It is called at every dial,
+// ctx asks for fresh credentials when IsCredentialsRefreshRequested.
+type DXDatabaseCredentialsProvider func(ctx context.Context) (userName string, password string, err error)
+
+// DXDatabaseTokenFetcher returns a short-lived authentication token, an IAM token of a cloud database, and when it expires
+type DXDatabaseTokenFetcher func(ctx context.Context) (token string, expiresAt time.Time, err error)
+
+// DXDatabaseTokenDefaultRefreshBefore is how long before its expiry a token of NewDXDatabaseTokenCredentialsProvider is
+// fetched again, when zero is given
+const DXDatabaseTokenDefaultRefreshBefore = time.Minute
+
+type credentialsRefreshContextKey struct{}
+
+// ContextWithCredentialsRefresh asks the DXDatabaseCredentialsProvider called with ctx not to answer from its cache, the
+// credentials were refused by the database
+func ContextWithCredentialsRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, credentialsRefreshContextKey{}, true)
+}
+
+func IsCredentialsRefreshRequested(ctx context.Context) bool {
+	isRefresh, _ := ctx.Value(credentialsRefreshContextKey{}).(bool)
+	return isRefresh
+}
+
+// NewDXDatabaseTokenCredentialsProvider is a DXDatabaseCredentialsProvider logging in as userName with the token of fetch as
+// its password. The token is kept until refreshBefore its expiry, a token without expiry is not kept, and is fetched again
+// when the database refused it.
+func NewDXDatabaseTokenCredentialsProvider(userName string, fetch DXDatabaseTokenFetcher, refreshBefore time.Duration) DXDatabaseCredentialsProvider {
+	if refreshBefore <= 0 {
+		refreshBefore = DXDatabaseTokenDefaultRefreshBefore
+	}
+	mutex := sync.Mutex{}
+	token := ""
+	expiresAt := time.Time{}
+	return func(ctx context.Context) (string, string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if token != "" && !IsCredentialsRefreshRequested(ctx) && time.Now().Add(refreshBefore).Before(expiresAt) {
+			return userName, token, nil
+		}
+		newToken, newExpiresAt, err := fetch(ctx)
+		if err != nil {
+			token = ""
+			return "", "", err
+		}
+		if newToken == "" {
+			return "", "", errors.New("DATABASE_TOKEN_IS_EMPTY")
+		}
+		token = newToken
+		expiresAt = newExpiresAt
+		return userName, token, nil
+	}
+}
+
+// credentialsConnector dials with the credentials of the CredentialsProvider of database, its connection string is only built
+// for the dial. A dial refused for its credentials is tried once more with fresh ones.
+type credentialsConnector struct {
+	database *DXDatabase
+	driver   driver.Driver
+}
+
+func (c *credentialsConnector) Connect(ctx context.Context) (conn driver.Conn, err error) {
+	conn, err = c.connect(ctx)
+	if err != nil && db.IsAuthenticationError(err) {
+		conn, err = c.connect(ContextWithCredentialsRefresh(ctx))
+	}
+	return conn, err
+}
+
+func (c *credentialsConnector) connect(ctx context.Context) (conn driver.Conn, err error) {
+	d := c.database
+	userName, password, err := d.CredentialsProvider(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("DATABASE_CREDENTIALS_PROVIDER_FAILED:%w", err)
+	}
+	connectionString, err := d.connectionStringOf(userName, password)
+	if err != nil {
+		return nil, err
+	}
+	connector, err := openConnector(c.driver, connectionString)
+	if err != nil {
+		return nil, d.redactErrorOf(err, password)
+	}
+	conn, err = connector.Connect(ctx)
+	if err != nil {
+		return nil, d.redactErrorOf(err, password)
+	}
+	return conn, nil
+}
+
+func (c *credentialsConnector) Driver() driver.Driver {
+	return c.driver
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// SelectCursor is Select reading the rows one at a time, for the results too large to hold, like the exports of
+// db.ExportCSV and db.ExportNDJSON. The rows are decrypted as they are read. The cursor must be closed.
+func (d *DXDatabase) SelectCursor(tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON,
+	orderbyFieldNameDirections map[string]string) (rowsInfo *db.RowsInfo, cursor *db.RowsCursor, err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, nil, err
+	}
+	whereAndFieldNameValues, err = d.resolveTenant(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	whereAndFieldNameValues, err = d.encryptWhereKeyValues(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	rowsInfo, cursor, err = db.SelectCursor(d.Connection, nil, tableName, fieldNames, whereAndFieldNameValues, nil, orderbyFieldNameDirections)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(d.encryptedFields(tableName)) > 0 {
+		cursor.OnRow = func(row utils.JSON) error {
+			return d.decryptRows(tableName, row)
+		}
+	}
+	return rowsInfo, cursor, nil
+}
@@ -0,0 +1,17 @@
+package database
+
+import (
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/log"
+)
+
+// txLog is the log of a transaction begun with l, its Context carries the DebugSQL of d while it is enabled so the helpers of
+// the transaction log their statements too
+func (d *DXDatabase) txLog(l *log.DXLog) *log.DXLog {
+	if !d.DebugSQL.IsEnabled() {
+		return l
+	}
+	txLog := *l
+	txLog.Context = db.ContextWithDebugSQL(l.Context, &d.DebugSQL)
+	return &txLog
+}
@@ -0,0 +1,406 @@
+package database
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/database/protected/dbtx"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+const (
+	// DXDatabaseEncryptionKeysEnvironmentVariable holds the AES-256 keys as id:key pairs separated by commas, the keys base64
+	// or hex encoded, the first pair is the current key: DXLIB_DATABASE_ENCRYPTION_KEYS=2024b:<key>,2024a:<key>
+	DXDatabaseEncryptionKeysEnvironmentVariable = "DXLIB_DATABASE_ENCRYPTION_KEYS"
+	// DXDatabaseEncryptionKeysFileEnvironmentVariable is the path of a file holding the same, used when the above is not set
+	DXDatabaseEncryptionKeysFileEnvironmentVariable = "DXLIB_DATABASE_ENCRYPTION_KEYS_FILE"
+
+	// The ciphertext is stored as <prefix><key id>:<base64 of the nonce followed by the sealed value>
+	DXDatabaseCiphertextPrefix              = "dxenc1:"
+	DXDatabaseDeterministicCiphertextPrefix = "dxenc1d:"
+)
+
+var ErrDatabaseEncryptionKeyNotFound = errors.New("DATABASE_ENCRYPTION_KEY_NOT_FOUND:" + DXDatabaseEncryptionKeysEnvironmentVariable + "/" + DXDatabaseEncryptionKeysFileEnvironmentVariable)
+
+// DXDatabaseEncryptFunc returns the stored form of plaintext. A deterministic ciphertext is the same for the same plaintext and
+// key, so it can be compared in a where clause.
+type DXDatabaseEncryptFunc func(plaintext string, isDeterministic bool) (ciphertext string, err error)
+
+// DXDatabaseDecryptFunc returns the plaintext of a value written by the DXDatabaseEncryptFunc, keyId is the key it was
+// encrypted with, so a rotation can tell the values still on an old key. Set as DXDatabase.Decrypt it gets every value of
+// the encrypted fields but nil, whatever its form: a value it did not write, like one written before the field was
+// encrypted, is returned as it is, with a keyId other than the current one to have ReEncryptTable encrypt it.
+type DXDatabaseDecryptFunc func(ciphertext string) (plaintext string, keyId string, err error)
+
+// DXDatabaseKeyRing is the default AES-256-GCM cipher of the encrypted fields. New values are encrypted with CurrentKeyId, the
+// other keys are only used to decrypt the values written before a rotation.
+type DXDatabaseKeyRing struct {
+	CurrentKeyId string
+	Keys         map[string][]byte
+}
+
+func decodeDatabaseEncryptionKey(s string) (key []byte, err error) {
+	s = strings.TrimSpace(s)
+	key, err = base64.StdEncoding.DecodeString(s)
+	if err == nil && len(key) == 32 {
+		return key, nil
+	}
+	key, err = hex.DecodeString(s)
+	if err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, errors.New("DATABASE_ENCRYPTION_KEY_MUST_BE_32_BYTES_BASE64_OR_HEX")
+}
+
+// NewDXDatabaseKeyRingFromEnvironment reads the keys from DXLIB_DATABASE_ENCRYPTION_KEYS, or from the file named by
+// DXLIB_DATABASE_ENCRYPTION_KEYS_FILE
+func NewDXDatabaseKeyRingFromEnvironment() (kr *DXDatabaseKeyRing, err error) {
+	s := os.Getenv(DXDatabaseEncryptionKeysEnvironmentVariable)
+	if s == "" {
+		filename := os.Getenv(DXDatabaseEncryptionKeysFileEnvironmentVariable)
+		if filename == "" {
+			return nil, ErrDatabaseEncryptionKeyNotFound
+		}
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("DATABASE_ENCRYPTION_KEYS_FILE_CANT_BE_READ:%s:%w", filename, err)
+		}
+		s = string(content)
+	}
+	kr = &DXDatabaseKeyRing{Keys: map[string][]byte{}}
+	for _, pair := range strings.Split(s, ",") {
+		keyId, encodedKey, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || keyId == "" || strings.Contains(keyId, ":") {
+			return nil, errors.New("DATABASE_ENCRYPTION_KEYS_MUST_BE_ID:KEY_PAIRS")
+		}
+		key, err := decodeDatabaseEncryptionKey(encodedKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w:%s", err, keyId)
+		}
+		if kr.CurrentKeyId == "" {
+			kr.CurrentKeyId = keyId
+		}
+		kr.Keys[keyId] = key
+	}
+	return kr, nil
+}
+
+func (kr *DXDatabaseKeyRing) gcm(keyId string) (gcm cipher.AEAD, err error) {
+	key, ok := kr.Keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("DATABASE_ENCRYPTION_KEY_ID_NOT_FOUND:%s", keyId)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt is a DXDatabaseEncryptFunc. The nonce of a deterministic value is derived from the plaintext with an HMAC of the key,
+// which only reveals that two values are equal.
+func (kr *DXDatabaseKeyRing) Encrypt(plaintext string, isDeterministic bool) (ciphertext string, err error) {
+	gcm, err := kr.gcm(kr.CurrentKeyId)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	prefix := DXDatabaseCiphertextPrefix
+	if isDeterministic {
+		mac := hmac.New(sha256.New, kr.Keys[kr.CurrentKeyId])
+		mac.Write([]byte(plaintext))
+		copy(nonce, mac.Sum(nil))
+		prefix = DXDatabaseDeterministicCiphertextPrefix
+	} else {
+		_, err = rand.Read(nonce)
+		if err != nil {
+			return "", err
+		}
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), []byte(kr.CurrentKeyId))
+	return prefix + kr.CurrentKeyId + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt is a DXDatabaseDecryptFunc
+func (kr *DXDatabaseKeyRing) Decrypt(ciphertext string) (plaintext string, keyId string, err error) {
+	s, ok := strings.CutPrefix(ciphertext, DXDatabaseDeterministicCiphertextPrefix)
+	if !ok {
+		s, ok = strings.CutPrefix(ciphertext, DXDatabaseCiphertextPrefix)
+	}
+	if !ok {
+		return "", "", errors.New("CIPHERTEXT_UNKNOWN_FORMAT")
+	}
+	keyId, encoded, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", "", errors.New("CIPHERTEXT_UNKNOWN_FORMAT")
+	}
+	gcm, err := kr.gcm(keyId)
+	if err != nil {
+		return "", "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", errors.New("CIPHERTEXT_IS_NOT_BASE64")
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", "", errors.New("CIPHERTEXT_TOO_SHORT")
+	}
+	b, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(keyId))
+	if err != nil {
+		// The GCM error says nothing useful and the key must not be hinted at
+		return "", "", errors.New("CIPHERTEXT_AUTHENTICATION_FAILED")
+	}
+	return string(b), keyId, nil
+}
+
+// IsEncryptedValue tells whether v is in the stored form of the default cipher
+func IsEncryptedValue(v any) bool {
+	s, ok := v.(string)
+	return ok && (strings.HasPrefix(s, DXDatabaseCiphertextPrefix) || strings.HasPrefix(s, DXDatabaseDeterministicCiphertextPrefix))
+}
+
+// encryptedFields returns the encrypted fields of tableName, a field is deterministic when it is also in
+// DeterministicEncryptedFields
+func (d *DXDatabase) encryptedFields(tableName string) (fields map[string]bool) {
+	if d == nil || len(d.EncryptedFields[tableName]) == 0 {
+		return nil
+	}
+	fields = map[string]bool{}
+	for _, f := range d.EncryptedFields[tableName] {
+		fields[f] = false
+	}
+	for _, f := range d.DeterministicEncryptedFields[tableName] {
+		if _, ok := fields[f]; ok {
+			fields[f] = true
+		}
+	}
+	return fields
+}
+
+// ciphers returns Encrypt and Decrypt, the key ring of the environment is loaded on the first use when they are not set.
+// isKeyRingDecrypt tells that Decrypt is the key ring.
+func (d *DXDatabase) ciphers() (encrypt DXDatabaseEncryptFunc, decrypt DXDatabaseDecryptFunc, isKeyRingDecrypt bool, err error) {
+	d.encryptionMutex.Lock()
+	defer d.encryptionMutex.Unlock()
+	if d.Encrypt == nil || d.Decrypt == nil {
+		kr, err := NewDXDatabaseKeyRingFromEnvironment()
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if d.Encrypt == nil {
+			d.Encrypt = kr.Encrypt
+		}
+		if d.Decrypt == nil {
+			d.Decrypt = kr.Decrypt
+			d.isKeyRingDecrypt = true
+		}
+	}
+	return d.Encrypt, d.Decrypt, d.isKeyRingDecrypt, nil
+}
+
+// storedValue returns the field value v as given to Decrypt, ok is false when it is not to be decrypted: nil, or for the
+// key ring a value not in its stored form, like one written before the field was encrypted
+func storedValue(v any, isKeyRingDecrypt bool) (s string, ok bool) {
+	switch t := v.(type) {
+	case string:
+		s = t
+	case []byte:
+		s = string(t)
+	case nil:
+		return "", false
+	default:
+		s = fmt.Sprint(t)
+	}
+	if isKeyRingDecrypt && !IsEncryptedValue(s) {
+		return "", false
+	}
+	return s, true
+}
+
+func encryptFieldValue(encrypt DXDatabaseEncryptFunc, tableName string, k string, v any, isDeterministic bool) (r any, err error) {
+	var plaintext string
+	switch t := v.(type) {
+	case nil, db.SQLExpression:
+		return v, nil
+	case string:
+		plaintext = t
+	case []byte:
+		plaintext = string(t)
+	default:
+		return nil, fmt.Errorf("ENCRYPTED_FIELD_VALUE_MUST_BE_STRING:%s.%s:%T", tableName, k, v)
+	}
+	r, err = encrypt(plaintext, isDeterministic)
+	if err != nil {
+		return nil, fmt.Errorf("ENCRYPTED_FIELD_ENCRYPT_FAILED:%s.%s:%w", tableName, k, err)
+	}
+	return r, nil
+}
+
+// encryptKeyValues returns a copy of kv with the encrypted fields of tableName encrypted, kv itself is left as the caller gave it
+func (d *DXDatabase) encryptKeyValues(tableName string, kv utils.JSON) (r utils.JSON, err error) {
+	fields := d.encryptedFields(tableName)
+	if fields == nil {
+		return kv, nil
+	}
+	encrypt, _, _, err := d.ciphers()
+	if err != nil {
+		return nil, err
+	}
+	r = utils.JSON{}
+	for k, v := range kv {
+		isDeterministic, isEncrypted := fields[k]
+		if isEncrypted {
+			v, err = encryptFieldValue(encrypt, tableName, k, v, isDeterministic)
+			if err != nil {
+				return nil, err
+			}
+		}
+		r[k] = v
+	}
+	return r, nil
+}
+
+// encryptWhereKeyValues rejects a where clause on a randomized encrypted field, which can never match, and encrypts the values
+// of the deterministic ones. Every where goes through it, after resolveTenant.
+func (d *DXDatabase) encryptWhereKeyValues(tableName string, kv utils.JSON) (r utils.JSON, err error) {
+	fields := d.encryptedFields(tableName)
+	if fields == nil {
+		return kv, nil
+	}
+	for k, v := range kv {
+		isDeterministic, isEncrypted := fields[k]
+		if !isEncrypted || v == nil {
+			continue
+		}
+		if _, ok := v.(db.SQLExpression); ok {
+			continue
+		}
+		if !isDeterministic {
+			return nil, fmt.Errorf("ENCRYPTED_FIELD_CANT_BE_USED_IN_WHERE:%s.%s:ADD_IT_TO_DETERMINISTIC_ENCRYPTED_FIELDS", tableName, k)
+		}
+	}
+	return d.encryptKeyValues(tableName, kv)
+}
+
+// decryptRows decrypts the encrypted fields of tableName in place. The key ring leaves a value not in its stored form, like one
+// written before the field was encrypted, as it is, a Decrypt set gets every value but nil.
+func (d *DXDatabase) decryptRows(tableName string, rows ...utils.JSON) (err error) {
+	fields := d.encryptedFields(tableName)
+	if fields == nil {
+		return nil
+	}
+	_, decrypt, isKeyRingDecrypt, err := d.ciphers()
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		for k := range fields {
+			v, ok := storedValue(row[k], isKeyRingDecrypt)
+			if !ok {
+				continue
+			}
+			plaintext, _, err := decrypt(v)
+			if err != nil {
+				return fmt.Errorf("ENCRYPTED_FIELD_DECRYPT_FAILED:%s.%s:%w", tableName, k, err)
+			}
+			row[k] = plaintext
+		}
+	}
+	return nil
+}
+
+// ReEncryptTable re-encrypts the encrypted fields of tableName that are not on the current key, after Encrypt was switched to a
+// new key. The rows are read by idFieldName, an integer key, in batches of batchSize, each batch in its own transaction, so a
+// failure keeps the batches already done and ReEncryptTable can simply be called again.
+func (d *DXDatabase) ReEncryptTable(tableName string, idFieldName string, batchSize int) (count int64, err error) {
+	fields := d.encryptedFields(tableName)
+	if fields == nil {
+		return 0, fmt.Errorf("TABLE_HAS_NO_ENCRYPTED_FIELDS:%s", tableName)
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	encrypt, decrypt, isKeyRingDecrypt, err := d.ciphers()
+	if err != nil {
+		return 0, err
+	}
+	// The current key id is learned from a fresh ciphertext, Encrypt may not be a key ring
+	probe, err := encrypt("", false)
+	if err != nil {
+		return 0, err
+	}
+	_, currentKeyId, err := decrypt(probe)
+	if err != nil {
+		return 0, err
+	}
+	quotedIdFieldName, err := db.QuoteIdentifierForDB(idFieldName, d.DatabaseType.Driver())
+	if err != nil {
+		return 0, err
+	}
+	dbLog := d.Logger()
+	var lastId int64
+	for {
+		batchLength := 0
+		batchCount := int64(0)
+		err = d.Tx(&dbLog, LevelReadCommitted, func(dtx *DXDatabaseTx) (err error) {
+			_, rows, err := dbtx.TxSelect(dtx.Log, nil, false, dtx.Tx, tableName, nil, utils.JSON{
+				"c1": db.SQLExpression{Expression: fmt.Sprintf("%s > %d", quotedIdFieldName, lastId)},
+			}, nil, map[string]string{idFieldName: "asc"}, batchSize, true)
+			if err != nil {
+				return err
+			}
+			batchLength = len(rows)
+			for _, row := range rows {
+				id, err := utils.ConvertToInterfaceInt64FromAny(row[idFieldName])
+				if err != nil {
+					return fmt.Errorf("RE_ENCRYPT_ID_MUST_BE_INTEGER:%s.%s:%w", tableName, idFieldName, err)
+				}
+				lastId = id.(int64)
+				setKeyValues := utils.JSON{}
+				for k, isDeterministic := range fields {
+					v, ok := storedValue(row[k], isKeyRingDecrypt)
+					if !ok {
+						continue
+					}
+					plaintext, keyId, err := decrypt(v)
+					if err != nil {
+						return fmt.Errorf("ENCRYPTED_FIELD_DECRYPT_FAILED:%s.%s:%w", tableName, k, err)
+					}
+					if keyId == currentKeyId {
+						continue
+					}
+					setKeyValues[k], err = encrypt(plaintext, isDeterministic)
+					if err != nil {
+						return fmt.Errorf("ENCRYPTED_FIELD_ENCRYPT_FAILED:%s.%s:%w", tableName, k, err)
+					}
+				}
+				if len(setKeyValues) == 0 {
+					continue
+				}
+				_, err = dbtx.TxUpdate(dtx.Log, false, dtx.Tx, tableName, setKeyValues, utils.JSON{idFieldName: lastId})
+				if err != nil {
+					return err
+				}
+				batchCount++
+			}
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+		count += batchCount
+		if batchLength < batchSize {
+			return count, nil
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// reverseCipher is a custom cipher whose stored form is <key id>|<plaintext reversed>, none of the prefixes of the key ring.
+// A value it did not write is returned as it is, with no key id.
+type reverseCipher struct {
+	currentKeyId string
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	slices.Reverse(r)
+	return string(r)
+}
+
+func (c reverseCipher) encrypt(plaintext string, isDeterministic bool) (ciphertext string, err error) {
+	return c.currentKeyId + "|" + reverse(plaintext), nil
+}
+
+func (c reverseCipher) decrypt(ciphertext string) (plaintext string, keyId string, err error) {
+	keyId, s, ok := strings.Cut(ciphertext, "|")
+	if !ok {
+		return ciphertext, "", nil
+	}
+	return reverse(s), keyId, nil
+}
+
+// fakeSecretTable is the table account on a fake database, its rows are written by the inserts and the updates binding a
+// secret, the selects read them all
+type fakeSecretTable struct {
+	mutex   sync.Mutex
+	secrets map[int64]any
+	nextId  int64
+}
+
+func (f *fakeSecretTable) handle(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !strings.Contains(s.Query, `"account"`) {
+		return dbtest.DXFakeResult{RowsAffected: 1}
+	}
+	query := strings.ToLower(s.Query)
+	var secret, id any
+	for _, a := range s.Args {
+		if v, ok := a.Value.(string); ok {
+			secret = v
+		} else {
+			id = a.Value
+		}
+	}
+	switch {
+	case strings.HasPrefix(query, "insert"):
+		f.nextId++
+		f.secrets[f.nextId] = secret
+		return dbtest.DXFakeResult{Columns: []string{"id"}, Rows: [][]any{{f.nextId}}}
+	case strings.HasPrefix(query, "update"):
+		f.secrets[id.(int64)] = secret
+		return dbtest.DXFakeResult{RowsAffected: 1}
+	}
+	r := dbtest.DXFakeResult{Columns: []string{"id", "secret"}}
+	for i := int64(1); i <= f.nextId; i++ {
+		r.Rows = append(r.Rows, []any{i, f.secrets[i]})
+	}
+	return r
+}
+
+func newFakeSecretDatabase(t *testing.T, table *fakeSecretTable, c reverseCipher) *DXDatabase {
+	t.Helper()
+	d, _ := newFakeDatabase(t, database_type.PostgreSQL, "postgres", table.handle)
+	d.EncryptedFields = map[string][]string{"account": {"secret"}}
+	d.Encrypt = c.encrypt
+	d.Decrypt = c.decrypt
+	return d
+}
+
+// A custom cipher whose stored form has none of the prefixes of the key ring is written by Insert and read back by Select
+func TestCustomCipherRoundTrip(t *testing.T) {
+	table := &fakeSecretTable{secrets: map[int64]any{}}
+	d := newFakeSecretDatabase(t, table, reverseCipher{currentKeyId: "k1"})
+	_, err := d.Insert("account", "id", utils.JSON{"secret": "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.secrets[1] != "k1|cba" {
+		t.Fatalf("stored %v", table.secrets[1])
+	}
+	_, rows, err := d.Select("account", nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["secret"] != "abc" {
+		t.Fatalf("rows %v", rows)
+	}
+}
+
+// ReEncryptTable with a custom cipher re-encrypts the values on an old key and the ones written before the field was
+// encrypted, the values on the current key are left as they are
+func TestCustomCipherReEncryptTable(t *testing.T) {
+	table := &fakeSecretTable{secrets: map[int64]any{1: "k1|cba", 2: "plain", 3: "k2|fed", 4: nil}, nextId: 4}
+	d := newFakeSecretDatabase(t, table, reverseCipher{currentKeyId: "k2"})
+	count, err := d.ReEncryptTable("account", "id", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("%d rows re-encrypted", count)
+	}
+	for id, want := range map[int64]any{1: "k2|cba", 2: "k2|nialp", 3: "k2|fed", 4: nil} {
+		if table.secrets[id] != want {
+			t.Fatalf("row %d has %v, want %v", id, table.secrets[id], want)
+		}
+	}
+	_, rows, err := d.Select("account", nil, nil, map[string]string{"id": "asc"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []any{"abc", "plain", "def", nil} {
+		if rows[i]["secret"] != want {
+			t.Fatalf("rows %v", rows)
+		}
+	}
+}
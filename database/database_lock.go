@@ -0,0 +1,337 @@
+package database
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// DXDatabaseLockTableName holds the locks of the databases without a lock of their own, Oracle, claimed row by row
+const DXDatabaseLockTableName = "dxlib_lock"
+
+var (
+	// DXDatabaseLockDefaultTTL is the TTL of a lock acquired with none
+	DXDatabaseLockDefaultTTL = 30 * time.Second
+	// ErrDatabaseLockLost is the error of a lock whose connection was lost or whose row was claimed by another owner after its
+	// TTL, the work it protected may now run elsewhere
+	ErrDatabaseLockLost = errors.New("DATABASE_LOCK_LOST")
+)
+
+var lockTable = db.TableDefinition{
+	Name: DXDatabaseLockTableName,
+	Columns: []db.ColumnDefinition{
+		{Name: "id", Type: db.ColumnTypeBigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+		{Name: "name", Type: db.ColumnTypeVarchar, Length: 255},
+		{Name: "owner", Type: db.ColumnTypeVarchar, Length: 64},
+		{Name: "expires_at", Type: db.ColumnTypeTimestamp},
+	},
+	UniqueConstraints: []db.IndexDefinition{
+		{Name: DXDatabaseLockTableName + "_name_uk", Columns: []string{"name"}},
+	},
+}
+
+// DXDatabaseLock is a lock held by one process among all those using the database. On PostgreSQL, MySQL and SQL Server it is a
+// lock of the session of a connection kept out of the pool until Release, it ends with that connection. On Oracle it is a row
+// of DXDatabaseLockTableName expiring after TTL unless renewed.
+type DXDatabaseLock struct {
+	Database *DXDatabase
+	Name     string
+	TTL      time.Duration
+	owner    string
+	conn     *sql.Conn
+	mutex    sync.Mutex
+	done     chan struct{}
+	err      error
+}
+
+// AcquireLock takes the lock name without waiting, acquired is false when another process holds it. ttl bounds the life of
+// a lock not renewed on Oracle, on the other databases the lock lasts until Release or the loss of its connection, which Renew
+// detects.
+func (d *DXDatabase) AcquireLock(name string, ttl time.Duration) (lock *DXDatabaseLock, acquired bool, err error) {
+	return d.AcquireLockContext(context.Background(), name, ttl)
+}
+
+func (d *DXDatabase) AcquireLockContext(ctx context.Context, name string, ttl time.Duration) (lock *DXDatabaseLock, acquired bool, err error) {
+	if name == "" {
+		return nil, false, fmt.Errorf("DATABASE_LOCK_NAME_EMPTY:%s", d.NameId)
+	}
+	if ttl <= 0 {
+		ttl = DXDatabaseLockDefaultTTL
+	}
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, false, err
+	}
+	lock = &DXDatabaseLock{Database: d, Name: name, TTL: ttl, owner: hex.EncodeToString(utils.RandomData(16)), done: make(chan struct{})}
+	if d.DatabaseType == database_type.Oracle {
+		acquired, err = lock.claimRow()
+	} else {
+		acquired, err = lock.lockSession(ctx)
+	}
+	if err != nil || !acquired {
+		return nil, false, err
+	}
+	return lock, true, nil
+}
+
+// WithLock runs fn holding the lock name, renewed every third of ttl, and releases it afterward. acquired is false, fn not run,
+// when another process holds the lock. The context of fn is cancelled when the lock is lost.
+func (d *DXDatabase) WithLock(name string, ttl time.Duration, fn func(ctx context.Context) error) (acquired bool, err error) {
+	return d.WithLockContext(context.Background(), name, ttl, fn)
+}
+
+func (d *DXDatabase) WithLockContext(ctx context.Context, name string, ttl time.Duration, fn func(ctx context.Context) error) (acquired bool, err error) {
+	lock, acquired, err := d.AcquireLockContext(ctx, name, ttl)
+	if err != nil || !acquired {
+		return false, err
+	}
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	renewDone := make(chan struct{})
+	go func() {
+		defer close(renewDone)
+		ticker := time.NewTicker(lock.TTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-fnCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := lock.Renew()
+			if err != nil {
+				lockLog := d.Logger()
+				lockLog.Warnf("Database %s: lock %s lost, cancelling its work (%v)", d.NameId, name, err.Error())
+				cancel()
+				return
+			}
+		}
+	}()
+	err = fn(fnCtx)
+	cancel()
+	<-renewDone
+	return true, errors.Join(err, lock.Release())
+}
+
+// Done is closed once the lock is released or lost, see Err
+func (l *DXDatabaseLock) Done() <-chan struct{} {
+	return l.done
+}
+
+// Err is ErrDatabaseLockLost once the lock was lost, nil before and after a Release
+func (l *DXDatabaseLock) Err() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.err
+}
+
+// Renew checks that the lock is still held and pushes its expiry TTL further on Oracle. A lock found lost is ended with
+// ErrDatabaseLockLost.
+func (l *DXDatabaseLock) Renew() (err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.isEnded() {
+		if l.err != nil {
+			return l.err
+		}
+		return fmt.Errorf("DATABASE_LOCK_RELEASED:%s", l.Name)
+	}
+	if l.conn != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), l.TTL)
+		defer cancel()
+		err = l.conn.PingContext(ctx)
+	} else {
+		var r sql.Result
+		r, err = db.Update(l.Database.Connection, DXDatabaseLockTableName, utils.JSON{
+			"expires_at": time.Now().UTC().Add(l.TTL),
+		}, utils.JSON{"name": l.Name, "owner": l.owner})
+		var n int64
+		if err == nil {
+			n, err = r.RowsAffected()
+		}
+		if err == nil && n == 0 {
+			err = errors.New("DATABASE_LOCK_CLAIMED_BY_ANOTHER_OWNER")
+		}
+	}
+	if err != nil {
+		l.end(fmt.Errorf("%w:%s:%v", ErrDatabaseLockLost, l.Name, err))
+		return l.err
+	}
+	return nil
+}
+
+// Release frees the lock, releasing a lock released or lost before does nothing
+func (l *DXDatabaseLock) Release() (err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.isEnded() {
+		return nil
+	}
+	if l.conn != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), l.TTL)
+		defer cancel()
+		err = l.unlockSession(ctx)
+		// The session lock also ends with its connection, closing it is enough when the unlock failed
+		_ = l.conn.Close()
+	} else {
+		_, err = db.Delete(l.Database.Connection, DXDatabaseLockTableName, utils.JSON{"name": l.Name, "owner": l.owner})
+	}
+	l.end(nil)
+	if err != nil {
+		return fmt.Errorf("DATABASE_LOCK_RELEASE_FAILED:%s:%w", l.Name, err)
+	}
+	return nil
+}
+
+func (l *DXDatabaseLock) isEnded() bool {
+	select {
+	case <-l.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *DXDatabaseLock) end(err error) {
+	l.err = err
+	if err != nil && l.conn != nil {
+		_ = l.conn.Close()
+	}
+	close(l.done)
+}
+
+// sessionLockKey is the name of the lock as the database of l takes it: a bigint on PostgreSQL, at most 64 characters on MySQL
+func (l *DXDatabaseLock) sessionLockKey() any {
+	switch l.Database.DatabaseType {
+	case database_type.PostgreSQL:
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(l.Name))
+		return int64(binary.BigEndian.Uint64(h.Sum(nil)))
+	case database_type.MySQL:
+		if len(l.Name) <= 64 {
+			return l.Name
+		}
+		sum := sha1.Sum([]byte(l.Name))
+		return hex.EncodeToString(sum[:])
+	default:
+		return l.Name
+	}
+}
+
+// lockSession takes the lock in the session of a connection of its own, kept by l when acquired
+func (l *DXDatabaseLock) lockSession(ctx context.Context) (acquired bool, err error) {
+	d := l.Database
+	var query string
+	switch d.DatabaseType {
+	case database_type.PostgreSQL:
+		query = `SELECT CASE WHEN pg_try_advisory_lock($1) THEN 1 ELSE 0 END`
+	case database_type.MySQL:
+		query = `SELECT COALESCE(GET_LOCK(?, 0), -1)`
+	case database_type.SQLServer:
+		query = `DECLARE @r int; EXEC @r = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = 0; SELECT CASE WHEN @r >= 0 THEN 1 ELSE 0 END`
+	default:
+		return false, fmt.Errorf("DATABASE_LOCK_NOT_SUPPORTED:%s:%s", d.NameId, d.DatabaseType.String())
+	}
+	conn, err := d.Connection.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	var r int64
+	err = conn.QueryRowContext(ctx, query, l.sessionLockKey()).Scan(&r)
+	if err == nil && r < 0 {
+		err = fmt.Errorf("DATABASE_LOCK_FAILED:%s", l.Name)
+	}
+	if err != nil || r != 1 {
+		_ = conn.Close()
+		return false, err
+	}
+	l.conn = conn
+	return true, nil
+}
+
+func (l *DXDatabaseLock) unlockSession(ctx context.Context) (err error) {
+	var query string
+	switch l.Database.DatabaseType {
+	case database_type.PostgreSQL:
+		query = `SELECT pg_advisory_unlock($1)`
+	case database_type.MySQL:
+		query = `SELECT RELEASE_LOCK(?)`
+	default:
+		query = `EXEC sp_releaseapplock @Resource = @p1, @LockOwner = 'Session'`
+	}
+	_, err = l.conn.ExecContext(ctx, query, l.sessionLockKey())
+	return err
+}
+
+var lockTableOnce sync.Map
+
+// claimRow inserts the row of the lock, or takes it over from its owner once expired. The takeover is conditioned on the
+// owner read, of two processes taking over the same row one only succeeds.
+func (l *DXDatabaseLock) claimRow() (acquired bool, err error) {
+	d := l.Database
+	err = d.ensureTableOnce(&lockTableOnce, lockTable)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now().UTC()
+	_, err = db.Insert(d.Connection, DXDatabaseLockTableName, "id", utils.JSON{
+		"name":       l.Name,
+		"owner":      l.owner,
+		"expires_at": now.Add(l.TTL),
+	})
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, db.ErrDuplicateKey) {
+		return false, err
+	}
+	_, row, err := db.SelectOne(d.Connection, nil, DXDatabaseLockTableName, []string{"owner", "expires_at"}, utils.JSON{"name": l.Name}, nil, nil)
+	if err != nil || row == nil {
+		// A row gone meanwhile was released, the lock is taken at the next try
+		return false, err
+	}
+	// An expiry or an owner that cannot be read is held, taking the row over could steal a lock that is live
+	expiresAt, ok := rowValue(row, "expires_at").(time.Time)
+	if !ok || expiresAt.After(now) {
+		return false, nil
+	}
+	owner, ok := rowValue(row, "owner").(string)
+	if !ok {
+		return false, nil
+	}
+	r, err := db.Update(d.Connection, DXDatabaseLockTableName, utils.JSON{
+		"owner":      l.owner,
+		"expires_at": now.Add(l.TTL),
+	}, utils.JSON{"name": l.Name, "owner": owner})
+	if err != nil {
+		return false, err
+	}
+	n, err := r.RowsAffected()
+	return n == 1, err
+}
+
+// rowValue returns the column fieldName of row whatever its case, Oracle names the columns in upper case
+func rowValue(row utils.JSON, fieldName string) any {
+	v, ok := row[fieldName]
+	if ok {
+		return v
+	}
+	for k, v := range row {
+		if strings.EqualFold(k, fieldName) {
+			return v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sijms/go-ora/v2/network"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+)
+
+type fakeLockRow struct {
+	owner     string
+	expiresAt any
+}
+
+// fakeOracleLockTable is DXDatabaseLockTableName on a fake Oracle, its columns are read back in upper case like go-ora does
+type fakeOracleLockTable struct {
+	mutex sync.Mutex
+	rows  map[string]*fakeLockRow
+}
+
+func (f *fakeOracleLockTable) handle(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	arg := func(name string) any {
+		v, _ := s.Arg(name)
+		return v
+	}
+	name, _ := arg("NAME").(string)
+	row := f.rows[name]
+	query := strings.ToUpper(strings.TrimSpace(s.Query))
+	switch {
+	case strings.HasPrefix(query, "INSERT"):
+		if row != nil {
+			return dbtest.DXFakeResult{Err: &network.OracleError{ErrCode: 1, ErrMsg: "ORA-00001: unique constraint (APP.DXLIB_LOCK_NAME_UK) violated"}}
+		}
+		f.rows[name] = &fakeLockRow{owner: arg("OWNER").(string), expiresAt: arg("EXPIRES_AT")}
+		if out, ok := arg("new_id").(sql.Out); ok {
+			*out.Dest.(*int64) = 1
+		}
+		return dbtest.DXFakeResult{RowsAffected: 1}
+	case strings.HasPrefix(query, "SELECT"):
+		r := dbtest.DXFakeResult{Columns: []string{"OWNER", "EXPIRES_AT"}}
+		if row != nil {
+			r.Rows = [][]any{{row.owner, row.expiresAt}}
+		}
+		return r
+	case strings.HasPrefix(query, "UPDATE"):
+		if row == nil || row.owner != arg("OWNER") {
+			return dbtest.DXFakeResult{}
+		}
+		if owner, ok := arg("NEW_OWNER").(string); ok {
+			row.owner = owner
+		}
+		row.expiresAt = arg("NEW_EXPIRES_AT")
+		return dbtest.DXFakeResult{RowsAffected: 1}
+	case strings.HasPrefix(query, "DELETE"):
+		if row == nil || row.owner != arg("OWNER") {
+			return dbtest.DXFakeResult{}
+		}
+		delete(f.rows, name)
+		return dbtest.DXFakeResult{RowsAffected: 1}
+	}
+	return dbtest.DXFakeResult{RowsAffected: 1}
+}
+
+func (f *fakeOracleLockTable) setExpiresAt(name string, expiresAt any) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.rows[name].expiresAt = expiresAt
+}
+
+// newFakeOracleLockDatabase returns the database of a process using table
+func newFakeOracleLockDatabase(t *testing.T, table *fakeOracleLockTable) *DXDatabase {
+	t.Helper()
+	d, _ := newFakeDatabase(t, database_type.Oracle, "oracle", table.handle)
+	// The lock table is the fake one, it needs no schema
+	lockTableOnce.Store(d, true)
+	t.Cleanup(func() { lockTableOnce.Delete(d) })
+	return d
+}
+
+func newFakeOracleLockTable() *fakeOracleLockTable {
+	return &fakeOracleLockTable{rows: map[string]*fakeLockRow{}}
+}
+
+// Of two processes claiming the lock together, exactly one acquires it
+func TestOracleLockConcurrentClaimantsOneAcquires(t *testing.T) {
+	table := newFakeOracleLockTable()
+	processes := []*DXDatabase{newFakeOracleLockDatabase(t, table), newFakeOracleLockDatabase(t, table)}
+	for i := 0; i < 20; i++ {
+		name := "job-" + string(rune('a'+i))
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		results := make(chan bool, 2)
+		for _, d := range processes {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				_, acquired, err := d.AcquireLock(name, time.Minute)
+				if err != nil {
+					t.Error(err)
+				}
+				results <- acquired
+			}()
+		}
+		close(start)
+		wg.Wait()
+		close(results)
+		n := 0
+		for acquired := range results {
+			if acquired {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Fatalf("%s: %d claimants acquired the lock", name, n)
+		}
+	}
+}
+
+// A lock whose TTL elapsed is taken over, its former owner finds it lost at its next Renew
+func TestOracleLockTakeoverAfterTTL(t *testing.T) {
+	table := newFakeOracleLockTable()
+	d, other := newFakeOracleLockDatabase(t, table), newFakeOracleLockDatabase(t, table)
+	first, acquired, err := d.AcquireLock("job", time.Minute)
+	if err != nil || !acquired {
+		t.Fatalf("acquired %v, %v", acquired, err)
+	}
+	_, acquired, err = other.AcquireLock("job", time.Minute)
+	if err != nil || acquired {
+		t.Fatalf("a held lock is acquired again, %v", err)
+	}
+
+	table.setExpiresAt("job", time.Now().UTC().Add(-time.Second))
+	second, acquired, err := other.AcquireLock("job", time.Minute)
+	if err != nil || !acquired {
+		t.Fatalf("an expired lock is not taken over, acquired %v, %v", acquired, err)
+	}
+	err = first.Renew()
+	if !errors.Is(err, ErrDatabaseLockLost) {
+		t.Fatalf("the former owner renews with %v", err)
+	}
+	if !errors.Is(first.Err(), ErrDatabaseLockLost) {
+		t.Fatalf("Err %v", first.Err())
+	}
+	err = second.Renew()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = second.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table.rows) != 0 {
+		t.Fatalf("rows %v", table.rows)
+	}
+}
+
+// An expiry that cannot be read is treated as held
+func TestOracleLockUnreadableExpiryIsHeld(t *testing.T) {
+	table := newFakeOracleLockTable()
+	d, other := newFakeOracleLockDatabase(t, table), newFakeOracleLockDatabase(t, table)
+	_, acquired, err := d.AcquireLock("job", time.Minute)
+	if err != nil || !acquired {
+		t.Fatalf("acquired %v, %v", acquired, err)
+	}
+	for _, expiresAt := range []any{nil, "2000-01-01", int64(0)} {
+		table.setExpiresAt("job", expiresAt)
+		_, acquired, err = other.AcquireLock("job", time.Minute)
+		if err != nil || acquired {
+			t.Fatalf("%#v: the lock is taken over, %v", expiresAt, err)
+		}
+	}
+}
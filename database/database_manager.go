@@ -1,7 +1,10 @@
 package database
 
 import (
+	"context"
+
 	dxlibv3Configuration "github.com/donnyhardyanto/dxlib/configuration"
+	"github.com/donnyhardyanto/dxlib/core"
 	"github.com/donnyhardyanto/dxlib/database/protected/db"
 	"github.com/donnyhardyanto/dxlib/log"
 	"github.com/donnyhardyanto/dxlib/utils"
@@ -12,6 +15,8 @@ type DXDatabaseSQLExpression = db.SQLExpression
 type DXDatabaseManager struct {
 	Databases map[string]*DXDatabase
 	Scripts   map[string]*DXDatabaseScript
+	// watchedConfigurations keeps one reload watcher per configuration
+	watchedConfigurations map[string]bool
 }
 
 func (dm *DXDatabaseManager) NewDatabase(nameId string, isConnectAtStart, mustBeConnected bool) *DXDatabase {
@@ -32,6 +37,10 @@ func (dm *DXDatabaseManager) NewDatabase(nameId string, isConnectAtStart, mustBe
 
 func (dm *DXDatabaseManager) LoadFromConfiguration(configurationNameId string) (err error) {
 	configuration := dxlibv3Configuration.Manager.Configurations[configurationNameId]
+	if !dm.watchedConfigurations[configurationNameId] {
+		configuration.Watch(dm.onConfigurationChange)
+		dm.watchedConfigurations[configurationNameId] = true
+	}
 	isConnectAtStart := false
 	mustConnected := false
 	for k, v := range *configuration.Data {
@@ -54,6 +63,21 @@ func (dm *DXDatabaseManager) LoadFromConfiguration(configurationNameId string) (
 			return err
 		}
 	}
+	return dm.resolveReadReplicas()
+}
+
+// resolveReadReplicas sets the ReadReplicas of each database from its ReadReplicaNameIds, once all are loaded
+func (dm *DXDatabaseManager) resolveReadReplicas() (err error) {
+	for _, d := range dm.Databases {
+		d.ReadReplicas = nil
+		for _, nameId := range d.ReadReplicaNameIds {
+			replica, ok := dm.Databases[nameId]
+			if !ok || replica == d {
+				return log.Log.ErrorAndCreateErrorf("READ_REPLICA_NOT_FOUND:%s:%s", d.NameId, nameId)
+			}
+			d.ReadReplicas = append(d.ReadReplicas, replica)
+		}
+	}
 	return nil
 }
 
@@ -109,5 +133,10 @@ func init() {
 	Manager = DXDatabaseManager{
 		Databases: map[string]*DXDatabase{},
 		Scripts:   map[string]*DXDatabaseScript{},
+
+		watchedConfigurations: map[string]bool{},
 	}
+	core.RegisterShutdownHook("database", core.ShutdownPriorityDatabase, func(ctx context.Context) error {
+		return Manager.DisconnectAll()
+	})
 }
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+)
+
+type dxDatabaseSelectOptions struct {
+	isTruncateOnMaxRows bool
+}
+
+type DXDatabaseSelectOption func(o *dxDatabaseSelectOptions)
+
+// WithTruncateOnMaxRows returns the first MaxRowsPerSelect rows of a select matching more, with RowsInfo.Truncated, instead
+// of failing with db.ErrTooManyRows
+func WithTruncateOnMaxRows() DXDatabaseSelectOption {
+	return func(o *dxDatabaseSelectOptions) {
+		o.isTruncateOnMaxRows = true
+	}
+}
+
+func selectOptionsOf(opts []DXDatabaseSelectOption) dxDatabaseSelectOptions {
+	o := dxDatabaseSelectOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// TooManyRowsCount is the count of the selects that exceeded MaxRowsPerSelect, failed or truncated, for the metrics
+func (d *DXDatabase) TooManyRowsCount() int64 {
+	return d.tooManyRowsCount.Load()
+}
+
+// checkTooManyRows counts, logs and reports a select of tableName that exceeded MaxRowsPerSelect, the log names the table
+// to find the caller
+func (d *DXDatabase) checkTooManyRows(tableName string, rowsInfo *db.RowsInfo, err error) {
+	isTruncated := err == nil && rowsInfo != nil && rowsInfo.Truncated
+	if !isTruncated && !errors.Is(err, db.ErrTooManyRows) {
+		return
+	}
+	d.tooManyRowsCount.Add(1)
+	dbLog := d.rateLimitedLogger("too_many_rows:" + tableName)
+	if isTruncated {
+		dbLog.Warnf("Database %v: select of %s truncated to %d rows", d.NameId, tableName, d.MaxRowsPerSelect)
+		err = db.ErrTooManyRows
+	} else {
+		dbLog.Warnf("Database %v: select of %s exceeded %d rows (%v)", d.NameId, tableName, d.MaxRowsPerSelect, err.Error())
+	}
+	if d.OnTooManyRows != nil {
+		d.OnTooManyRows(d, err)
+	}
+}
@@ -0,0 +1,346 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// DXMigrationNameIdPrefix prefixes the NameId of the migrations in DXScriptExecutionTableName, apart from the RunOnce scripts
+const DXMigrationNameIdPrefix = "migration:"
+
+// DXMigrationVersionLayout is the layout of the version CreateMigration gives to a new migration, its UTC creation time
+const DXMigrationVersionLayout = "20060102150405"
+
+var (
+	// IsMigrationLocked has MigrateUp and MigrateDown hold the database lock DXMigrationLockName, so of the instances migrating
+	// at their start one only runs the migrations, the others wait for it and find them applied
+	IsMigrationLocked = false
+	// DXMigrationLockName is the lock of the migrations, see DXDatabase.AcquireLock
+	DXMigrationLockName = "dxlib_migration"
+	// DXMigrationLockWaitTimeout bounds the wait for the lock of the migrations held by another instance
+	DXMigrationLockWaitTimeout = 5 * time.Minute
+)
+
+// DXDatabaseMigration is a migration of a directory, the files <version>_<name>.up.sql and <version>_<name>.down.sql, applied
+// in the order of their version
+type DXDatabaseMigration struct {
+	Version  string
+	Name     string
+	UpFile   string
+	DownFile string
+}
+
+type DXDatabaseMigrationStatus struct {
+	Migration *DXDatabaseMigration
+	IsApplied bool
+}
+
+// NameId is the name of m recorded in DXScriptExecutionTableName once applied
+func (m *DXDatabaseMigration) NameId() string {
+	return DXMigrationNameIdPrefix + m.Version + "_" + m.Name
+}
+
+// LoadMigrations reads the migrations of dir sorted by version, a migration without its up file is an error, one without its
+// down file can not be reverted
+func LoadMigrations(dir string) (migrations []*DXDatabaseMigration, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("MIGRATION_DIRECTORY_CANT_BE_READ:%s:%w", dir, err)
+	}
+	byVersion := map[string]*DXDatabaseMigration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		fileName := entry.Name()
+		var isUp bool
+		var base string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			isUp = true
+			base = strings.TrimSuffix(fileName, ".up.sql")
+		case strings.HasSuffix(fileName, ".down.sql"):
+			base = strings.TrimSuffix(fileName, ".down.sql")
+		default:
+			continue
+		}
+		version, name, ok := strings.Cut(base, "_")
+		if !ok || version == "" || name == "" {
+			return nil, fmt.Errorf("MIGRATION_FILE_NAME_INVALID:%s", fileName)
+		}
+		_, err = strconv.ParseUint(version, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("MIGRATION_VERSION_INVALID:%s", fileName)
+		}
+		m, isExist := byVersion[version]
+		if !isExist {
+			m = &DXDatabaseMigration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("MIGRATION_VERSION_DUPLICATED:%s:%s:%s", version, m.Name, name)
+		}
+		path := filepath.Join(dir, fileName)
+		if isUp {
+			m.UpFile = path
+		} else {
+			m.DownFile = path
+		}
+	}
+	for _, m := range byVersion {
+		if m.UpFile == "" {
+			return nil, fmt.Errorf("MIGRATION_UP_FILE_MISSING:%s_%s", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return compareMigrationVersions(migrations[i].Version, migrations[j].Version) < 0
+	})
+	return migrations, nil
+}
+
+// compareMigrationVersions compares the versions as numbers, a version of more digits being the greater
+func compareMigrationVersions(a string, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+	return strings.Compare(a, b)
+}
+
+// CreateMigration writes the empty up and down files of a new migration named name in dir, versioned by the current UTC time
+func CreateMigration(dir string, name string) (m *DXDatabaseMigration, err error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, `/\ `) {
+		return nil, fmt.Errorf("MIGRATION_NAME_INVALID:%q", name)
+	}
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("MIGRATION_DIRECTORY_CANT_BE_CREATED:%s:%w", dir, err)
+	}
+	version := time.Now().UTC().Format(DXMigrationVersionLayout)
+	base := filepath.Join(dir, version+"_"+name)
+	m = &DXDatabaseMigration{Version: version, Name: name, UpFile: base + ".up.sql", DownFile: base + ".down.sql"}
+	for _, f := range []string{m.UpFile, m.DownFile} {
+		err = os.WriteFile(f, []byte("-- "+filepath.Base(f)+"\n"), 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("MIGRATION_FILE_CANT_BE_CREATED:%s:%w", f, err)
+		}
+	}
+	return m, nil
+}
+
+// MigrationStatus is the migrations of dir, each with whether it was applied on d
+func (d *DXDatabase) MigrationStatus(dir string) (statuses []DXDatabaseMigrationStatus, err error) {
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !d.Connected {
+		err = d.Connect()
+		if err != nil {
+			return nil, err
+		}
+	}
+	applied, err := d.appliedScripts()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range migrations {
+		statuses = append(statuses, DXDatabaseMigrationStatus{Migration: m, IsApplied: applied[m.NameId()]})
+	}
+	return statuses, nil
+}
+
+// MigrateUp applies the migrations of dir not applied yet on d, by version, at most steps of them when steps is positive. Each
+// migration is a RunOnce script of ExecuteScripts, the first failed stops the others.
+func (d *DXDatabase) MigrateUp(dir string, steps int) (results []*DXDatabaseScriptResult, err error) {
+	err = d.withMigrationLock(func() (err error) {
+		results, err = d.migrateUp(dir, steps)
+		return err
+	})
+	return results, err
+}
+
+func (d *DXDatabase) migrateUp(dir string, steps int) (results []*DXDatabaseScriptResult, err error) {
+	statuses, err := d.MigrationStatus(dir)
+	if err != nil {
+		return nil, err
+	}
+	var scripts []*DXDatabaseScript
+	for i, s := range statuses {
+		if s.IsApplied {
+			continue
+		}
+		if steps > 0 && len(scripts) == steps {
+			break
+		}
+		scripts = append(scripts, &DXDatabaseScript{
+			NameId:  s.Migration.NameId(),
+			Files:   []string{s.Migration.UpFile},
+			Order:   i,
+			RunOnce: true,
+		})
+	}
+	return d.ExecuteScripts(scripts)
+}
+
+// MigrateDown reverts the last applied migrations of dir on d with their down files, the latest first, one when steps is not
+// positive. A migration is removed from DXScriptExecutionTableName once reverted.
+func (d *DXDatabase) MigrateDown(dir string, steps int) (results []*DXDatabaseScriptResult, err error) {
+	err = d.withMigrationLock(func() (err error) {
+		results, err = d.migrateDown(dir, steps)
+		return err
+	})
+	return results, err
+}
+
+func (d *DXDatabase) migrateDown(dir string, steps int) (results []*DXDatabaseScriptResult, err error) {
+	statuses, err := d.MigrationStatus(dir)
+	if err != nil {
+		return nil, err
+	}
+	if steps <= 0 {
+		steps = 1
+	}
+	for i := len(statuses) - 1; i >= 0 && len(results) < steps; i-- {
+		m := statuses[i].Migration
+		if !statuses[i].IsApplied {
+			continue
+		}
+		if m.DownFile == "" {
+			return results, log.Log.ErrorAndCreateErrorf("MIGRATION_DOWN_FILE_MISSING:%s:%s", d.NameId, m.NameId())
+		}
+		rs, err := d.ExecuteScripts([]*DXDatabaseScript{{NameId: m.NameId(), Files: []string{m.DownFile}}})
+		results = append(results, rs...)
+		if err != nil {
+			return results, err
+		}
+		_, err = db.Delete(d.Connection, DXScriptExecutionTableName, utils.JSON{"name_id": m.NameId()})
+		if err != nil {
+			return results, log.Log.ErrorAndCreateErrorf("MIGRATION_EXECUTION_CANT_BE_REMOVED:%s:%s:%v", d.NameId, m.NameId(), err.Error())
+		}
+		log.Log.Infof("Migration %s on %s reverted", m.NameId(), d.NameId)
+	}
+	return results, nil
+}
+
+// withMigrationLock runs fn holding DXMigrationLockName when IsMigrationLocked, waiting for another instance holding it
+func (d *DXDatabase) withMigrationLock(fn func() error) (err error) {
+	if !IsMigrationLocked {
+		return fn()
+	}
+	if !d.Connected {
+		err = d.Connect()
+		if err != nil {
+			return err
+		}
+	}
+	deadline := time.Now().Add(DXMigrationLockWaitTimeout)
+	for {
+		acquired, err := d.WithLock(DXMigrationLockName, 0, func(ctx context.Context) error {
+			return fn()
+		})
+		if err != nil || acquired {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return log.Log.ErrorAndCreateErrorf("MIGRATION_LOCK_WAIT_TIMEOUT:%s:%v", d.NameId, DXMigrationLockWaitTimeout)
+		}
+		log.Log.Infof("Migrations of %s are run by another instance, waiting", d.NameId)
+		time.Sleep(time.Second)
+	}
+}
+
+// RunMigrationCommand runs the migration command of args, like the arguments of a command line after its program name, on the
+// migrations of dir and writes its report to w:
+//
+//	up [steps]       applies the pending migrations, all of them without steps
+//	down [steps]     reverts the last applied migrations, one without steps
+//	status           lists the migrations and whether each is applied
+//	create <name>    writes the files of a new migration, d may be nil
+func RunMigrationCommand(d *DXDatabase, dir string, args []string, w io.Writer) (err error) {
+	if len(args) == 0 {
+		return fmt.Errorf("MIGRATION_COMMAND_MISSING:up|down|status|create")
+	}
+	command := args[0]
+	if command == "create" {
+		if len(args) != 2 {
+			return fmt.Errorf("MIGRATION_COMMAND_USAGE:create <name>")
+		}
+		m, err := CreateMigration(dir, args[1])
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "created %s\ncreated %s\n", m.UpFile, m.DownFile)
+		return nil
+	}
+	if d == nil {
+		return fmt.Errorf("MIGRATION_DATABASE_MISSING:%s", command)
+	}
+	steps := 0
+	switch command {
+	case "up", "down":
+		if len(args) > 2 {
+			return fmt.Errorf("MIGRATION_COMMAND_USAGE:%s [steps]", command)
+		}
+		if len(args) == 2 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("MIGRATION_STEPS_INVALID:%q", args[1])
+			}
+		}
+	case "status":
+		if len(args) != 1 {
+			return fmt.Errorf("MIGRATION_COMMAND_USAGE:status")
+		}
+	default:
+		return fmt.Errorf("MIGRATION_COMMAND_UNKNOWN:%s", command)
+	}
+
+	var results []*DXDatabaseScriptResult
+	switch command {
+	case "up":
+		results, err = d.MigrateUp(dir, steps)
+	case "down":
+		results, err = d.MigrateDown(dir, steps)
+	default:
+		statuses, err := d.MigrationStatus(dir)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.IsApplied {
+				state = "applied"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s_%s\n", state, s.Migration.Version, s.Migration.Name)
+		}
+		return nil
+	}
+	for _, r := range results {
+		state := command
+		switch {
+		case r.IsSkipped:
+			state = "skipped"
+		case r.Err != nil:
+			state = "failed"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%v\n", state, strings.TrimPrefix(r.NameId, DXMigrationNameIdPrefix), r.Duration)
+	}
+	if len(results) == 0 {
+		_, _ = fmt.Fprintln(w, "nothing to migrate")
+	}
+	return err
+}
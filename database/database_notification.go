@@ -0,0 +1,282 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/utils"
+	utilsSql "github.com/donnyhardyanto/dxlib/utils/security"
+)
+
+// DXDatabaseNotificationHandler gets the notifications of a channel, payload being the JSON object notified or
+// {"payload": <text>} when the text is not one. It is called from the goroutine of the listener, one notification at a time.
+type DXDatabaseNotificationHandler func(channel string, payload utils.JSON)
+
+// DXDatabaseNotificationTableName holds the notifications of the databases without LISTEN/NOTIFY, polled by their listeners
+const DXDatabaseNotificationTableName = "dxlib_notification"
+
+var (
+	// DXDatabaseListenerMinReconnectInterval and DXDatabaseListenerMaxReconnectInterval bound the waits of a PostgreSQL
+	// listener between its reconnects
+	DXDatabaseListenerMinReconnectInterval = time.Second
+	DXDatabaseListenerMaxReconnectInterval = time.Minute
+	// DXDatabaseListenerPingInterval is how often an idle PostgreSQL listener checks its connection
+	DXDatabaseListenerPingInterval = 90 * time.Second
+	// DXDatabaseNotificationPollInterval is how often the listener of a database without LISTEN/NOTIFY reads its new
+	// notifications
+	DXDatabaseNotificationPollInterval = time.Second
+	// DXDatabaseNotificationPollBatchSize bounds the notifications read by one poll, the others are read by the next ones
+	DXDatabaseNotificationPollBatchSize = 100
+	// DXDatabaseNotificationRetention is how long the polled notifications are kept before they are deleted
+	DXDatabaseNotificationRetention = time.Hour
+)
+
+// DXDatabaseListener calls its handler for each notification of its channel until Close. A lost connection is reconnected,
+// the listener keeps its channel and handler.
+type DXDatabaseListener struct {
+	Database *DXDatabase
+	Channel  string
+	handler  DXDatabaseNotificationHandler
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// Listen starts a listener of the notifications of channel, with LISTEN on PostgreSQL and by polling the
+// DXDatabaseNotificationTableName table, created when missing, on the other databases. See Notify.
+func (d *DXDatabase) Listen(channel string, handler DXDatabaseNotificationHandler) (l *DXDatabaseListener, err error) {
+	err = utilsSql.ValidateIdentifier(channel)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l = &DXDatabaseListener{Database: d, Channel: channel, handler: handler, ctx: ctx, cancel: cancel, done: make(chan struct{})}
+	if d.DatabaseType == database_type.PostgreSQL {
+		go l.listen()
+		return l, nil
+	}
+	err = d.ensureNotificationTable()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	lastId, err := d.lastNotificationId()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go l.poll(lastId)
+	return l, nil
+}
+
+// Close stops l and waits for the end of its handler
+func (l *DXDatabaseListener) Close() {
+	l.cancel()
+	<-l.done
+}
+
+// Notify sends payload to the listeners of channel, with NOTIFY on PostgreSQL and through the DXDatabaseNotificationTableName
+// table on the other databases
+func (d *DXDatabase) Notify(channel string, payload utils.JSON) (err error) {
+	err = utilsSql.ValidateIdentifier(channel)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if d.DatabaseType == database_type.PostgreSQL {
+		_, err = d.Execute(`SELECT pg_notify(:channel, :payload)`, utils.JSON{"channel": channel, "payload": string(b)})
+		return err
+	}
+	err = d.ensureNotificationTable()
+	if err != nil {
+		return err
+	}
+	_, err = d.Insert(DXDatabaseNotificationTableName, "id", utils.JSON{"channel": channel, "payload": string(b), "created_at": time.Now().UTC()})
+	return err
+}
+
+func (l *DXDatabaseListener) notify(channel string, text string) {
+	payload := utils.JSON{}
+	err := json.Unmarshal([]byte(text), &payload)
+	if err != nil {
+		payload = utils.JSON{"payload": text}
+	}
+	l.handler(channel, payload)
+}
+
+// listen runs the PostgreSQL listener, built again when the database refuses its credentials so that a CredentialsProvider
+// is asked for fresh ones
+func (l *DXDatabaseListener) listen() {
+	defer close(l.done)
+	d := l.Database
+	isRefresh := false
+	for {
+		err := l.listenOnce(isRefresh)
+		if l.ctx.Err() != nil {
+			return
+		}
+		listenerLog := d.rateLimitedLogger("listener")
+		listenerLog.Warnf("Database %s: listener of %s restarted (%v)", d.NameId, l.Channel, err.Error())
+		isRefresh = db.IsAuthenticationError(err)
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-time.After(DXDatabaseListenerMinReconnectInterval):
+		}
+	}
+}
+
+func (l *DXDatabaseListener) listenOnce(isRefresh bool) (err error) {
+	d := l.Database
+	connectionString := d.ConnectionString
+	password := ""
+	if d.CredentialsProvider != nil {
+		ctx := l.ctx
+		if isRefresh {
+			ctx = ContextWithCredentialsRefresh(ctx)
+		}
+		var userName string
+		userName, password, err = d.CredentialsProvider(ctx)
+		if err != nil {
+			return fmt.Errorf("DATABASE_CREDENTIALS_PROVIDER_FAILED:%w", err)
+		}
+		connectionString, err = d.connectionStringOf(userName, password)
+		if err != nil {
+			return err
+		}
+	}
+	authenticationFailed := make(chan error, 1)
+	listener := pq.NewListener(connectionString, DXDatabaseListenerMinReconnectInterval, DXDatabaseListenerMaxReconnectInterval,
+		func(event pq.ListenerEventType, err error) {
+			if event == pq.ListenerEventConnectionAttemptFailed && db.IsAuthenticationError(err) {
+				select {
+				case authenticationFailed <- d.redactErrorOf(err, password):
+				default:
+				}
+			}
+		})
+	defer func() {
+		_ = listener.Close()
+	}()
+	err = listener.Listen(l.Channel)
+	if err != nil {
+		return d.redactErrorOf(err, password)
+	}
+	pingTicker := time.NewTicker(DXDatabaseListenerPingInterval)
+	defer pingTicker.Stop()
+	for {
+		select {
+		case <-l.ctx.Done():
+			return nil
+		case err = <-authenticationFailed:
+			return err
+		case n := <-listener.Notify:
+			// nil after a reconnect, the notifications sent meanwhile are lost
+			if n != nil {
+				l.notify(n.Channel, n.Extra)
+			}
+		case <-pingTicker.C:
+			go func() {
+				_ = listener.Ping()
+			}()
+		}
+	}
+}
+
+// poll reads the notifications of the channel after lastId, a failure is retried at the next tick
+func (l *DXDatabaseListener) poll(lastId int64) {
+	defer close(l.done)
+	d := l.Database
+	listenerLog := d.rateLimitedLogger("listener")
+	ticker := time.NewTicker(DXDatabaseNotificationPollInterval)
+	defer ticker.Stop()
+	var lastCleanup time.Time
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		_, rows, err := d.Select(DXDatabaseNotificationTableName, []string{"id", "channel", "payload"}, utils.JSON{
+			"channel": l.Channel,
+			"c1":      db.SQLExpression{Expression: fmt.Sprintf("id > %d", lastId)},
+		}, map[string]string{"id": "asc"}, DXDatabaseNotificationPollBatchSize)
+		if err != nil {
+			listenerLog.Warnf("Database %s: polling the notifications of %s error (%v)", d.NameId, l.Channel, err.Error())
+			continue
+		}
+		for _, row := range rows {
+			id, err := utils.ConvertToInterfaceInt64FromAny(rowValue(row, "id"))
+			if err != nil {
+				listenerLog.Warnf("Database %s: notification id of %s is not an integer (%v)", d.NameId, l.Channel, err.Error())
+				break
+			}
+			lastId = id.(int64)
+			payload := rowValue(row, "payload")
+			if b, ok := payload.([]byte); ok {
+				payload = string(b)
+			}
+			text, _ := payload.(string)
+			l.notify(l.Channel, text)
+		}
+		if time.Since(lastCleanup) >= DXDatabaseNotificationRetention/10 {
+			lastCleanup = time.Now()
+			_, err = d.Execute(`DELETE FROM `+DXDatabaseNotificationTableName+` WHERE created_at < :created_at`,
+				utils.JSON{"created_at": time.Now().UTC().Add(-DXDatabaseNotificationRetention)})
+			if err != nil {
+				listenerLog.Warnf("Database %s: deleting the old notifications error (%v)", d.NameId, err.Error())
+			}
+		}
+	}
+}
+
+var notificationTableOnce sync.Map
+
+// ensureNotificationTable creates the DXDatabaseNotificationTableName table when missing, once per database
+func (d *DXDatabase) ensureNotificationTable() (err error) {
+	if _, ok := notificationTableOnce.Load(d); ok {
+		return nil
+	}
+	_, err = d.EnsureSchema([]db.TableDefinition{{
+		Name: DXDatabaseNotificationTableName,
+		Columns: []db.ColumnDefinition{
+			{Name: "id", Type: db.ColumnTypeBigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "channel", Type: db.ColumnTypeVarchar, Length: 128},
+			{Name: "payload", Type: db.ColumnTypeText},
+			{Name: "created_at", Type: db.ColumnTypeTimestamp},
+		},
+		Indexes: []db.IndexDefinition{
+			{Name: DXDatabaseNotificationTableName + "_channel_idx", Columns: []string{"channel", "id"}},
+		},
+	}})
+	if err != nil {
+		return err
+	}
+	notificationTableOnce.Store(d, true)
+	return nil
+}
+
+func (d *DXDatabase) lastNotificationId() (id int64, err error) {
+	_, rows, err := d.Select(DXDatabaseNotificationTableName, []string{"id"}, nil, map[string]string{"id": "desc"}, 1)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	r, err := utils.ConvertToInterfaceInt64FromAny(rowValue(rows[0], "id"))
+	if err != nil {
+		return 0, err
+	}
+	return r.(int64), nil
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// SelectPaged returns the page pageIndex, counted from 0, of rowsPerPage rows of tableName with the total count of the rows
+// matching whereAndFieldNameValues. rowsPerPage 0 returns every row, within MaxRowsPerSelect. The where values and the rows
+// are encrypted and decrypted like Select.
+func (d *DXDatabase) SelectPaged(tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, orderbyFieldNameDirections map[string]string,
+	rowsPerPage int64, pageIndex int64, opts ...DXDatabaseSelectOption) (rowsInfo *db.RowsInfo, rows []utils.JSON, totalRows int64, totalPage int64, err error) {
+	return d.SelectPagedContext(context.Background(), tableName, fieldNames, whereAndFieldNameValues, orderbyFieldNameDirections, rowsPerPage, pageIndex, opts...)
+}
+
+// SelectPagedContext is SelectPaged, the count and the page are cancelled when ctx ends
+func (d *DXDatabase) SelectPagedContext(ctx context.Context, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON,
+	orderbyFieldNameDirections map[string]string, rowsPerPage int64, pageIndex int64, opts ...DXDatabaseSelectOption) (rowsInfo *db.RowsInfo, rows []utils.JSON,
+	totalRows int64, totalPage int64, err error) {
+	whereAndFieldNameValues, err = d.resolveTenant(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	whereAndFieldNameValues, err = d.encryptWhereKeyValues(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	if whereAndFieldNameValues == nil {
+		whereAndFieldNameValues = utils.JSON{}
+	}
+	connection := d.readConnection(ctx)
+	ctx, release, err := d.acquireContext(ctx, connection)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	defer release()
+	driverName := connection.DriverName()
+	fromPart, err := db.QuoteIdentifierForDB(tableName, driverName)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	fieldsPart, err := db.SQLPartFieldNames(fieldNames, driverName)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	wherePart, err := db.SQLPartWhereAndFieldNameValues(whereAndFieldNameValues, driverName)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	orderByPart, err := db.SQLPartOrderByFieldNameDirections(orderbyFieldNameDirections, driverName)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	isGuarded := rowsPerPage == 0 && d.MaxRowsPerSelect > 0
+	if isGuarded {
+		rowsPerPage, pageIndex = d.MaxRowsPerSelect+1, 0
+	}
+	rowsInfo, rows, totalRows, totalPage, _, err = db.NamedQueryPagingContext(ctx, connection, nil, "", rowsPerPage, pageIndex, fieldsPart, fromPart,
+		wherePart, "", orderByPart, whereAndFieldNameValues)
+	if err != nil {
+		return rowsInfo, rows, totalRows, totalPage, err
+	}
+	if isGuarded {
+		totalPage = 1
+		rows, err = db.LimitRows(rowsInfo, rows, d.MaxRowsPerSelect, selectOptionsOf(opts).isTruncateOnMaxRows)
+		if err != nil {
+			err = fmt.Errorf("%w:%s", err, tableName)
+		}
+		d.checkTooManyRows(tableName, rowsInfo, err)
+		if err != nil {
+			return rowsInfo, nil, totalRows, totalPage, err
+		}
+	}
+	err = d.decryptRows(tableName, rows...)
+	return rowsInfo, rows, totalRows, totalPage, err
+}
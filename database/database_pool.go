@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+)
+
+// PoolExhaustedCount is the count of the waits for a connection that exceeded AcquireTimeout, for the metrics
+func (d *DXDatabase) PoolExhaustedCount() int64 {
+	return d.poolExhaustedCount.Load()
+}
+
+// SetMaxOpenConnections changes MaxOpenConnections, on the open pool too, zero is no maximum
+func (d *DXDatabase) SetMaxOpenConnections(n int) {
+	d.MaxOpenConnections = n
+	if d.Connection != nil {
+		d.Connection.SetMaxOpenConns(n)
+	}
+}
+
+// SetMaxIdleConnections changes MaxIdleConnections, on the open pool too, zero keeps no idle connection
+func (d *DXDatabase) SetMaxIdleConnections(n int) {
+	d.MaxIdleConnections = n
+	if d.Connection != nil {
+		d.Connection.SetMaxIdleConns(n)
+	}
+}
+
+// SetConnectionMaxLifetime changes ConnectionMaxLifetime, on the open pool too, zero keeps the connections forever
+func (d *DXDatabase) SetConnectionMaxLifetime(t time.Duration) {
+	d.ConnectionMaxLifetime = t
+	if d.Connection != nil {
+		d.Connection.SetConnMaxLifetime(t)
+	}
+}
+
+// SetConnectionMaxIdleTime changes ConnectionMaxIdleTime, on the open pool too, zero keeps the idle connections forever
+func (d *DXDatabase) SetConnectionMaxIdleTime(t time.Duration) {
+	d.ConnectionMaxIdleTime = t
+	if d.Connection != nil {
+		d.Connection.SetConnMaxIdleTime(t)
+	}
+}
+
+func (d *DXDatabase) poolExhausted(connection *sqlx.DB) error {
+	d.poolExhaustedCount.Add(1)
+	err := &db.PoolExhaustedError{DatabaseNameId: d.NameId, Timeout: d.AcquireTimeout, Stats: connection.Stats()}
+	dbLog := d.rateLimitedLogger("pool_exhausted")
+	dbLog.Warnf("Database %v: %v", d.NameId, err.Error())
+	if d.OnPoolExhausted != nil {
+		d.OnPoolExhausted(d, err)
+	}
+	return err
+}
+
+// acquireConnection takes a connection of the pool of connection, the one of d or of a read replica, waiting for one at most
+// AcquireTimeout. The connection must be closed to return it to the pool.
+func (d *DXDatabase) acquireConnection(ctx context.Context, connection *sqlx.DB) (conn *sqlx.Conn, err error) {
+	if d.AcquireTimeout <= 0 {
+		return connection.Connx(ctx)
+	}
+	acquireCtx, cancel := context.WithTimeout(ctx, d.AcquireTimeout)
+	defer cancel()
+	conn, err = connection.Connx(acquireCtx)
+	if err != nil && errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return nil, d.poolExhausted(connection)
+	}
+	return conn, err
+}
+
+// acquireContext bounds the wait for a connection of the statements of ctx on connection by AcquireTimeout: it takes the
+// connection beforehand and returns ctx running them on it, release returns it to the pool. It is ctx without AcquireTimeout,
+// database/sql then waits for a connection as long as ctx lasts.
+func (d *DXDatabase) acquireContext(ctx context.Context, connection *sqlx.DB) (r context.Context, release func(), err error) {
+	if d.AcquireTimeout <= 0 {
+		return ctx, func() {}, nil
+	}
+	endAcquireSpan := db.StartConnectionAcquireSpan(ctx, connection)
+	conn, err := d.acquireConnection(ctx, connection)
+	endAcquireSpan(err)
+	if err != nil {
+		return ctx, func() {}, err
+	}
+	return db.ContextWithConnection(ctx, connection, conn), func() { _ = conn.Close() }, nil
+}
+
+// beginTxx is BeginTxx of the connection, in the span of the wait for a connection of the pool when
+// db.IsConnectionAcquireSpanEnabled. The wait is bounded by AcquireTimeout, the transaction keeps ctx.
+func (d *DXDatabase) beginTxx(ctx context.Context, txOptions *sql.TxOptions) (tx *sqlx.Tx, err error) {
+	endAcquireSpan := db.StartConnectionAcquireSpan(ctx, d.Connection)
+	if d.AcquireTimeout <= 0 {
+		tx, err = d.Connection.BeginTxx(ctx, txOptions)
+		endAcquireSpan(err)
+		return tx, err
+	}
+	conn, err := d.acquireConnection(ctx, d.Connection)
+	if err != nil {
+		endAcquireSpan(err)
+		return nil, err
+	}
+	tx, err = conn.BeginTxx(ctx, txOptions)
+	endAcquireSpan(err)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	go func() {
+		// Close waits for the end of the transaction before returning the connection to the pool
+		_ = conn.Close()
+	}()
+	return tx, nil
+}
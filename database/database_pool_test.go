@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// With every connection of the pool in use, the helpers out of a transaction wait for one no more than AcquireTimeout and
+// fail with db.ErrPoolExhausted. Once a connection is back they run on it.
+func TestHelpersWaitForAConnectionAtMostAcquireTimeout(t *testing.T) {
+	d, f := newFakeDatabase(t, database_type.PostgreSQL, "postgres", func(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+		if s.IsQuery {
+			return dbtest.DXFakeResult{Columns: []string{"id"}, Rows: [][]any{{int64(1)}}}
+		}
+		return dbtest.DXFakeResult{RowsAffected: 1}
+	})
+	d.SetMaxOpenConnections(1)
+	d.AcquireTimeout = 50 * time.Millisecond
+	helpers := map[string]func(ctx context.Context) error{
+		"select": func(ctx context.Context) error {
+			_, _, err := d.SelectContext(ctx, "item", nil, utils.JSON{"id": int64(1)}, nil, nil)
+			return err
+		},
+		"select one": func(ctx context.Context) error {
+			_, _, err := d.SelectOneContext(ctx, "item", nil, utils.JSON{"id": int64(1)}, nil, nil)
+			return err
+		},
+		"insert": func(ctx context.Context) error {
+			_, err := d.InsertContext(ctx, "item", "id", utils.JSON{"name": "a"})
+			return err
+		},
+		"update": func(ctx context.Context) error {
+			_, err := d.UpdateContext(ctx, "item", utils.JSON{"name": "b"}, utils.JSON{"id": int64(1)})
+			return err
+		},
+		"delete": func(ctx context.Context) error {
+			_, err := d.DeleteContext(ctx, "item", utils.JSON{"id": int64(1)})
+			return err
+		},
+		"execute": func(ctx context.Context) error {
+			_, err := d.ExecuteContext(ctx, "UPDATE item SET name = :name", utils.JSON{"name": "c"})
+			return err
+		},
+	}
+
+	held, err := d.Connection.Connx(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, run := range helpers {
+		start := time.Now()
+		err := run(context.Background())
+		if !errors.Is(err, db.ErrPoolExhausted) {
+			t.Fatalf("%s: err %v", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("%s waited %v", name, elapsed)
+		}
+	}
+	if d.PoolExhaustedCount() != int64(len(helpers)) {
+		t.Fatalf("%d exhaustions counted", d.PoolExhaustedCount())
+	}
+
+	_ = held.Close()
+	f.Reset()
+	for name, run := range helpers {
+		err := run(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	if d.Connection.Stats().InUse != 0 || len(f.Statements()) != len(helpers) {
+		t.Fatalf("%d connections in use, statements %v", d.Connection.Stats().InUse, f.Queries())
+	}
+}
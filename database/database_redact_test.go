@@ -0,0 +1,103 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+)
+
+const sentinelPassword = "S3ntinel-Pa55word-7f9c1e"
+
+func TestRedactDSN(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		dsn  string
+		want string
+	}{
+		{
+			name: "postgres url",
+			dsn:  "postgres://app:" + sentinelPassword + "@db:5432/main?sslmode=disable",
+			want: "postgres://app:********@db:5432/main?sslmode=disable",
+		},
+		{
+			name: "postgres key value",
+			dsn:  "user=app password=" + sentinelPassword + " host=db port=5432 dbname=main",
+			want: "user=app password=******** host=db port=5432 dbname=main",
+		},
+		{
+			name: "postgres key value quoted",
+			dsn:  "user=app password='" + sentinelPassword + " with space' host=db",
+			want: "user=app password=******** host=db",
+		},
+		{
+			name: "sqlserver url",
+			dsn:  "sqlserver://sa:" + sentinelPassword + "@db:1433?database=main",
+			want: "sqlserver://sa:********@db:1433?database=main",
+		},
+		{
+			name: "sqlserver ado",
+			dsn:  "server=db;port=1433;user id=sa;password=" + sentinelPassword + ";database=main",
+			want: "server=db;port=1433;user id=sa;password=********;database=main",
+		},
+		{
+			name: "sqlserver ado braced",
+			dsn:  "server=db;user id=sa;pwd={" + sentinelPassword + ";x};database=main",
+			want: "server=db;user id=sa;pwd=********;database=main",
+		},
+		{
+			name: "oracle url",
+			dsn:  "oracle://app:" + sentinelPassword + "@db:1521/ORCL?SSL=enable",
+			want: "oracle://app:********@db:1521/ORCL?SSL=enable",
+		},
+		{
+			name: "mysql tcp",
+			dsn:  "app:" + sentinelPassword + "@tcp(db:3306)/main?parseTime=true",
+			want: "app:********@tcp(db:3306)/main?parseTime=true",
+		},
+		{
+			name: "mysql password with at sign",
+			dsn:  "app:" + sentinelPassword + "@x@tcp(db:3306)/main",
+			want: "app:********@tcp(db:3306)/main",
+		},
+		{
+			name: "mysql default address",
+			dsn:  "app:" + sentinelPassword + "@/main",
+			want: "app:********@/main",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := RedactDSN(tc.dsn)
+			if got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRedactDSNOfEveryConnectionString(t *testing.T) {
+	for _, databaseType := range []database_type.DXDatabaseType{
+		database_type.PostgreSQL, database_type.MySQL, database_type.SQLServer, database_type.Oracle,
+	} {
+		t.Run(databaseType.String(), func(t *testing.T) {
+			d := &DXDatabase{
+				NameId:       "test",
+				DatabaseType: databaseType,
+				Address:      "127.0.0.1:1",
+				UserName:     "app",
+				UserPassword: sentinelPassword,
+				DatabaseName: "main",
+			}
+			s, err := d.GetConnectionString()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(s, sentinelPassword) {
+				t.Fatalf("the connection string has no password to redact: %s", s)
+			}
+			if redacted := RedactDSN(s); strings.Contains(redacted, sentinelPassword) {
+				t.Fatalf("the password is left in %s", redacted)
+			}
+		})
+	}
+}
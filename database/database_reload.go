@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/donnyhardyanto/dxlib/configuration"
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/log"
+)
+
+// DXDatabaseReloadPingTimeout bounds the verification of the new connection before it replaces the current one
+var DXDatabaseReloadPingTimeout = 10 * time.Second
+
+func (d *DXDatabase) applyPoolSettings(connection *sqlx.DB) {
+	if d.MaxOpenConnections > 0 {
+		connection.SetMaxOpenConns(d.MaxOpenConnections)
+	}
+	if d.MaxIdleConnections > 0 {
+		connection.SetMaxIdleConns(d.MaxIdleConnections)
+	}
+	if d.ConnectionMaxLifetime > 0 {
+		connection.SetConnMaxLifetime(d.ConnectionMaxLifetime)
+	}
+	if d.ConnectionMaxIdleTime > 0 {
+		connection.SetConnMaxIdleTime(d.ConnectionMaxIdleTime)
+	}
+}
+
+func (d *DXDatabase) isConnectionSettingsEqual(n *DXDatabase) bool {
+	return d.DatabaseType == n.DatabaseType && d.Address == n.Address && d.UserName == n.UserName &&
+		d.UserPassword == n.UserPassword && d.DatabaseName == n.DatabaseName && d.ConnectionOptions == n.ConnectionOptions &&
+		d.ServerStatementTimeout == n.ServerStatementTimeout && d.OracleConnectBy == n.OracleConnectBy && d.OracleWalletPath == n.OracleWalletPath
+}
+
+func (d *DXDatabase) isPoolSettingsEqual(n *DXDatabase) bool {
+	return d.MaxOpenConnections == n.MaxOpenConnections && d.MaxIdleConnections == n.MaxIdleConnections &&
+		d.ConnectionMaxLifetime == n.ConnectionMaxLifetime && d.ConnectionMaxIdleTime == n.ConnectionMaxIdleTime
+}
+
+func (d *DXDatabase) copyPoolSettings(n *DXDatabase) {
+	d.MaxOpenConnections = n.MaxOpenConnections
+	d.MaxIdleConnections = n.MaxIdleConnections
+	d.ConnectionMaxLifetime = n.ConnectionMaxLifetime
+	d.ConnectionMaxIdleTime = n.ConnectionMaxIdleTime
+}
+
+func (d *DXDatabase) copyConnectionSettings(n *DXDatabase) {
+	d.DatabaseType = n.DatabaseType
+	d.Address = n.Address
+	d.UserName = n.UserName
+	d.UserPassword = n.UserPassword
+	d.DatabaseName = n.DatabaseName
+	d.ConnectionOptions = n.ConnectionOptions
+	d.ServerStatementTimeout = n.ServerStatementTimeout
+	d.OracleConnectBy = n.OracleConnectBy
+	d.OracleWalletPath = n.OracleWalletPath
+	d.ConnectionString = n.ConnectionString
+	d.NonSensitiveConnectionString = n.NonSensitiveConnectionString
+}
+
+// openAndVerify opens a pool with the settings of d and pings it, the pool is closed again when the ping fails
+func (d *DXDatabase) openAndVerify() (connection *sqlx.DB, err error) {
+	connection, err = d.open()
+	if err != nil {
+		return nil, d.redactError(err)
+	}
+	d.applyPoolSettings(connection)
+	ctx, cancel := context.WithTimeout(context.Background(), DXDatabaseReloadPingTimeout)
+	defer cancel()
+	err = connection.PingContext(ctx)
+	if err != nil {
+		_ = connection.Close()
+		return nil, d.redactError(err)
+	}
+	return connection, nil
+}
+
+// Reload reads the configuration of the database again and applies the difference. Pool sizes are changed on the live pool,
+// a new address or new credentials are verified on a new pool first, which then replaces the current one while the old one
+// drains. When the verification fails the current connection is kept.
+func (d *DXDatabase) Reload() (err error) {
+	if !d.IsConfigured {
+		return nil
+	}
+	n := &DXDatabase{
+		NameId:              d.NameId,
+		MustConnected:       d.MustConnected,
+		CredentialsProvider: d.CredentialsProvider,
+		isReloadCandidate:   true,
+	}
+	err = n.ApplyFromConfiguration()
+	if err != nil {
+		log.Log.Errorf("Reloading database %s: new configuration is unusable, keeping the current one (%v)", d.NameId, err.Error())
+		return err
+	}
+	d.MustConnected = n.MustConnected
+	d.IsConnectAtStart = n.IsConnectAtStart
+	d.CreateScriptFiles = n.CreateScriptFiles
+	d.AcquireTimeout = n.AcquireTimeout
+	d.MaxRowsPerSelect = n.MaxRowsPerSelect
+	d.DebugSQL.RedactedFieldNames = n.DebugSQL.RedactedFieldNames
+	d.DebugSQL.MaxStatementLength = n.DebugSQL.MaxStatementLength
+	d.DebugSQL.SetEnabled(n.DebugSQL.IsEnabled())
+
+	if !d.isConnectionSettingsEqual(n) {
+		if !d.Connected || d.Connection == nil {
+			d.copyConnectionSettings(n)
+			d.copyPoolSettings(n)
+			log.Log.Infof("Reloading database %s: settings updated to %s, applied on next connect", d.NameId, d.NonSensitiveConnectionString)
+			return nil
+		}
+		log.Log.Infof("Reloading database %s: switching %s to %s... start", d.NameId, d.NonSensitiveConnectionString, n.NonSensitiveConnectionString)
+		connection, err := n.openAndVerify()
+		if err != nil {
+			if d.MustConnected {
+				log.Log.Errorf("RELOAD_FAILED: database %s is required, keeping the current connection to %s, the new settings can not connect to %s (%v)",
+					d.NameId, d.NonSensitiveConnectionString, n.NonSensitiveConnectionString, err.Error())
+			} else {
+				log.Log.Errorf("Reloading database %s: keeping the current connection, the new settings can not connect to %s (%v)", d.NameId, n.NonSensitiveConnectionString, err.Error())
+			}
+			return err
+		}
+		d.connectionMutex.Lock()
+		oldConnection := d.Connection
+		d.Connection = connection
+		d.copyConnectionSettings(n)
+		d.copyPoolSettings(n)
+		d.connectionMutex.Unlock()
+		db.SetTraceDatabaseName(connection, d.DatabaseName)
+		db.SetTraceDatabaseName(oldConnection, "")
+		db.SetDebugSQL(connection, &d.DebugSQL)
+		db.SetDebugSQL(oldConnection, nil)
+		// Close waits for the queries already running on the old pool
+		go func() {
+			errClose := oldConnection.Close()
+			if errClose != nil {
+				log.Log.Warnf("Reloading database %s: closing the previous connection error (%v)", d.NameId, d.redactError(errClose).Error())
+			}
+		}()
+		log.Log.Infof("Reloading database %s: switching to %s... done", d.NameId, d.NonSensitiveConnectionString)
+		return nil
+	}
+
+	if !d.isPoolSettingsEqual(n) {
+		d.copyPoolSettings(n)
+		if d.Connection != nil {
+			d.applyPoolSettings(d.Connection)
+		}
+		log.Log.Infof("Reloading database %s: pool settings updated (max_open=%d max_idle=%d max_lifetime=%v max_idle_time=%v)",
+			d.NameId, d.MaxOpenConnections, d.MaxIdleConnections, d.ConnectionMaxLifetime, d.ConnectionMaxIdleTime)
+	}
+	return nil
+}
+
+func (dm *DXDatabaseManager) onConfigurationChange(c *configuration.DXConfiguration) {
+	for _, d := range dm.Databases {
+		_ = d.Reload()
+	}
+	_ = dm.resolveReadReplicas()
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DXDatabaseRouting routes the reads of a context, like the one of an API request, between a database and its ReadReplicas.
+// Once pinned to the primary its reads stop going to the replicas, a write of DXDatabase with the context pins it, so the
+// reads after it see the write. It lives as long as its context, nothing of it is kept elsewhere.
+type DXDatabaseRouting struct {
+	isPinnedToPrimary atomic.Bool
+	isWritten         atomic.Bool
+}
+
+type dxDatabaseRoutingContextKey struct{}
+
+// ContextWithRouting returns ctx carrying routing
+func ContextWithRouting(ctx context.Context, routing *DXDatabaseRouting) context.Context {
+	return context.WithValue(ctx, dxDatabaseRoutingContextKey{}, routing)
+}
+
+// RoutingFromContext returns the routing of ctx, nil when it has none
+func RoutingFromContext(ctx context.Context) *DXDatabaseRouting {
+	if ctx == nil {
+		return nil
+	}
+	routing, _ := ctx.Value(dxDatabaseRoutingContextKey{}).(*DXDatabaseRouting)
+	return routing
+}
+
+// PinToPrimary sends the reads of the routing to the primary from now on, a nil routing is left as it is
+func (r *DXDatabaseRouting) PinToPrimary() {
+	if r != nil {
+		r.isPinnedToPrimary.Store(true)
+	}
+}
+
+func (r *DXDatabaseRouting) IsPinnedToPrimary() bool {
+	return r != nil && r.isPinnedToPrimary.Load()
+}
+
+// IsWritten tells a write was made with the routing
+func (r *DXDatabaseRouting) IsWritten() bool {
+	return r != nil && r.isWritten.Load()
+}
+
+// pinToPrimary pins the routing of ctx, before a write
+func pinToPrimary(ctx context.Context) {
+	r := RoutingFromContext(ctx)
+	if r != nil {
+		r.isWritten.Store(true)
+		r.isPinnedToPrimary.Store(true)
+	}
+}
+
+// readConnection is the connection a read of ctx goes to, one of the connected ReadReplicas in turn, the one of d when it has
+// none or the routing of ctx is pinned to the primary
+func (d *DXDatabase) readConnection(ctx context.Context) *sqlx.DB {
+	n := uint64(len(d.ReadReplicas))
+	if n == 0 || RoutingFromContext(ctx).IsPinnedToPrimary() {
+		return d.Connection
+	}
+	start := d.readReplicaIndex.Add(1)
+	for i := uint64(0); i < n; i++ {
+		replica := d.ReadReplicas[(start+i)%n]
+		if replica.Connected && replica.Connection != nil {
+			return replica.Connection
+		}
+	}
+	return d.Connection
+}
+
+// pinToPrimary pins the routing of the context of the log of dtx, before a write
+func (dtx *DXDatabaseTx) pinToPrimary() {
+	if dtx.Log != nil {
+		pinToPrimary(dtx.Log.Context)
+	}
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// fakeLaggingReplication is a primary keeping the codes inserted into orders and a replica that has not received any of them
+type fakeLaggingReplication struct {
+	mutex sync.Mutex
+	codes []any
+}
+
+func (f *fakeLaggingReplication) primary(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch {
+	case strings.HasPrefix(s.Query, "INSERT"):
+		f.codes = append(f.codes, s.Args[0].Value)
+		return dbtest.DXFakeResult{Columns: []string{"id"}, Rows: [][]any{{int64(len(f.codes))}}, RowsAffected: 1}
+	case s.IsQuery:
+		r := dbtest.DXFakeResult{Columns: []string{"code"}}
+		for _, code := range f.codes {
+			r.Rows = append(r.Rows, []any{code})
+		}
+		return r
+	}
+	return dbtest.DXFakeResult{}
+}
+
+func (f *fakeLaggingReplication) replica(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+	if strings.HasPrefix(s.Query, "INSERT") {
+		return dbtest.DXFakeResult{Err: sql.ErrConnDone}
+	}
+	return dbtest.DXFakeResult{Columns: []string{"code"}}
+}
+
+// newFakeReplicatedDatabase returns a database over f.primary with the read replicas over f.replica
+func newFakeReplicatedDatabase(t *testing.T, f *fakeLaggingReplication, replicaCount int) (*DXDatabase, []*dbtest.DXFakeDatabase) {
+	t.Helper()
+	d, _ := newFakeDatabase(t, database_type.PostgreSQL, "postgres", f.primary)
+	var replicaFakes []*dbtest.DXFakeDatabase
+	for i := 0; i < replicaCount; i++ {
+		replica, replicaFake := newFakeDatabase(t, database_type.PostgreSQL, "postgres", f.replica)
+		d.ReadReplicas = append(d.ReadReplicas, replica)
+		replicaFakes = append(replicaFakes, replicaFake)
+	}
+	return d, replicaFakes
+}
+
+func selectOrderCount(t *testing.T, ctx context.Context, d *DXDatabase) int {
+	t.Helper()
+	_, rows, err := d.SelectContext(ctx, "orders", nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(rows)
+}
+
+// The reads of a context go to the lagging replica until a write with the context, then to the primary which has the write
+func TestReadsOfAContextArePinnedToThePrimaryAfterItsWrite(t *testing.T) {
+	f := &fakeLaggingReplication{}
+	d, _ := newFakeReplicatedDatabase(t, f, 1)
+	routing := &DXDatabaseRouting{}
+	ctx := ContextWithRouting(context.Background(), routing)
+
+	if n := selectOrderCount(t, ctx, d); n != 0 {
+		t.Fatalf("the replica returned %d orders", n)
+	}
+	_, err := d.InsertContext(ctx, "orders", "id", utils.JSON{"code": "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !routing.IsPinnedToPrimary() || !routing.IsWritten() {
+		t.Fatal("the write did not pin the routing")
+	}
+	if n := selectOrderCount(t, ctx, d); n != 1 {
+		t.Fatalf("the read after the write returned %d orders", n)
+	}
+	_, _, err = d.ShouldSelectOneContext(ctx, "orders", nil, nil)
+	if err != nil {
+		t.Fatalf("the read after the write did not find the order: %v", err)
+	}
+
+	// Another context, without a write, still reads the replica
+	other := ContextWithRouting(context.Background(), &DXDatabaseRouting{})
+	if n := selectOrderCount(t, other, d); n != 0 {
+		t.Fatalf("the other context read %d orders", n)
+	}
+	if n := selectOrderCount(t, context.Background(), d); n != 0 {
+		t.Fatalf("a context without routing read %d orders", n)
+	}
+}
+
+// ExecuteContext pins the routing of its context for any statement but a select
+func TestExecutePinsTheRoutingUnlessSelect(t *testing.T) {
+	f := &fakeLaggingReplication{}
+	d, _ := newFakeReplicatedDatabase(t, f, 1)
+	for statement, isPinning := range map[string]bool{
+		"SELECT code FROM orders":                      false,
+		"UPDATE orders SET code = :code":               true,
+		"DELETE FROM orders":                           true,
+		"CREATE INDEX orders_code_idx ON orders(code)": true,
+		"CALL refresh_orders()":                        true,
+	} {
+		routing := &DXDatabaseRouting{}
+		_, err := d.ExecuteContext(ContextWithRouting(context.Background(), routing), statement, utils.JSON{"code": "A"})
+		if err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+		if routing.IsPinnedToPrimary() != isPinning || routing.IsWritten() != isPinning {
+			t.Fatalf("%s: pinned %v, written %v", statement, routing.IsPinnedToPrimary(), routing.IsWritten())
+		}
+	}
+}
+
+// A write of a transaction pins the routing of the context of its log, the one of the caller
+func TestTxWritePinsTheRoutingOfItsLog(t *testing.T) {
+	f := &fakeLaggingReplication{}
+	d, _ := newFakeReplicatedDatabase(t, f, 1)
+	routing := &DXDatabaseRouting{}
+	l := log.NewLog(nil, ContextWithRouting(context.Background(), routing), "routing")
+	err := d.Tx(&l, sql.LevelReadCommitted, func(dtx *DXDatabaseTx) error {
+		_, err := dtx.Insert("orders", utils.JSON{"code": "A"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !routing.IsPinnedToPrimary() {
+		t.Fatal("the write of the transaction did not pin the routing")
+	}
+	if n := selectOrderCount(t, l.Context, d); n != 1 {
+		t.Fatalf("the read after the transaction returned %d orders", n)
+	}
+}
+
+func TestPinToPrimary(t *testing.T) {
+	f := &fakeLaggingReplication{codes: []any{"A"}}
+	d, _ := newFakeReplicatedDatabase(t, f, 1)
+	routing := &DXDatabaseRouting{}
+	ctx := ContextWithRouting(context.Background(), routing)
+	routing.PinToPrimary()
+	if n := selectOrderCount(t, ctx, d); n != 1 {
+		t.Fatalf("the pinned read returned %d orders", n)
+	}
+	if routing.IsWritten() {
+		t.Fatal("the routing is marked written")
+	}
+	// A nil routing is not pinned and pinning it does nothing
+	var none *DXDatabaseRouting
+	none.PinToPrimary()
+	if none.IsPinnedToPrimary() || RoutingFromContext(context.Background()) != nil {
+		t.Fatal("a nil routing is pinned")
+	}
+}
+
+// The reads go to the replicas in turn, skipping the disconnected ones, and to the primary when none is connected
+func TestReadReplicasInTurn(t *testing.T) {
+	f := &fakeLaggingReplication{codes: []any{"A"}}
+	d, replicaFakes := newFakeReplicatedDatabase(t, f, 2)
+	for i := 0; i < 4; i++ {
+		selectOrderCount(t, context.Background(), d)
+	}
+	for i, replicaFake := range replicaFakes {
+		if n := len(replicaFake.Queries()); n != 2 {
+			t.Fatalf("the replica %d took %d reads", i, n)
+		}
+		replicaFake.Reset()
+	}
+
+	d.ReadReplicas[0].Connected = false
+	for i := 0; i < 2; i++ {
+		selectOrderCount(t, context.Background(), d)
+	}
+	if len(replicaFakes[0].Queries()) != 0 || len(replicaFakes[1].Queries()) != 2 {
+		t.Fatalf("the replicas took %d and %d reads", len(replicaFakes[0].Queries()), len(replicaFakes[1].Queries()))
+	}
+
+	d.ReadReplicas[1].Connected = false
+	if n := selectOrderCount(t, context.Background(), d); n != 1 {
+		t.Fatalf("without a connected replica the read returned %d orders", n)
+	}
+}
+
+func TestResolveReadReplicas(t *testing.T) {
+	dm := &DXDatabaseManager{Databases: map[string]*DXDatabase{}}
+	primary := &DXDatabase{NameId: "main", ReadReplicaNameIds: []string{"main_replica"}}
+	replica := &DXDatabase{NameId: "main_replica"}
+	dm.Databases["main"], dm.Databases["main_replica"] = primary, replica
+	err := dm.resolveReadReplicas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(primary.ReadReplicas) != 1 || primary.ReadReplicas[0] != replica || len(replica.ReadReplicas) != 0 {
+		t.Fatalf("the replicas are %v", primary.ReadReplicas)
+	}
+	primary.ReadReplicaNameIds = []string{"missing"}
+	err = dm.resolveReadReplicas()
+	if err == nil || !strings.Contains(err.Error(), "READ_REPLICA_NOT_FOUND:main:missing") {
+		t.Fatalf("err %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// DXSchemaDefinitionTableName is the table where EnsureSchema records the checksum of each definition it applied
+const DXSchemaDefinitionTableName = "dxlib_schema_definition"
+
+var schemaDefinitionTable = db.TableDefinition{
+	Name: DXSchemaDefinitionTableName,
+	Columns: []db.ColumnDefinition{
+		{Name: "id", Type: db.ColumnTypeBigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+		{Name: "table_name", Type: db.ColumnTypeVarchar, Length: 255},
+		{Name: "checksum", Type: db.ColumnTypeVarchar, Length: 64},
+		{Name: "applied_at", Type: db.ColumnTypeTimestamp},
+	},
+	UniqueConstraints: []db.IndexDefinition{
+		{Name: DXSchemaDefinitionTableName + "_table_name_uk", Columns: []string{"table_name"}},
+	},
+}
+
+type DXSchemaTablePlan struct {
+	TableName string
+	Checksum  string
+	// IsUnchanged is true when the definition was applied with the same checksum before, the table is then not compared
+	IsUnchanged bool
+	Statements  []string
+	// Destructive lists the differences that would need a drop or an alter of an existing column, they are never applied
+	Destructive []string
+}
+
+type DXSchemaPlan struct {
+	Tables []*DXSchemaTablePlan
+}
+
+// Statements returns the DDL of the plan, in the order EnsureSchema executes it
+func (p *DXSchemaPlan) Statements() (r []string) {
+	for _, t := range p.Tables {
+		r = append(r, t.Statements...)
+	}
+	return r
+}
+
+func (p *DXSchemaPlan) Destructive() (r []string) {
+	for _, t := range p.Tables {
+		r = append(r, t.Destructive...)
+	}
+	return r
+}
+
+// PlanSchema is the dry run of EnsureSchema, it returns what EnsureSchema would execute and report without changing anything
+func (d *DXDatabase) PlanSchema(defs []db.TableDefinition) (plan *DXSchemaPlan, err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := d.appliedSchemaChecksums()
+	if err != nil {
+		return nil, err
+	}
+	plan = &DXSchemaPlan{}
+	for _, def := range append([]db.TableDefinition{schemaDefinitionTable}, defs...) {
+		tablePlan, err := d.planTable(def, applied)
+		if err != nil {
+			return nil, err
+		}
+		plan.Tables = append(plan.Tables, tablePlan)
+	}
+	return plan, nil
+}
+
+// EnsureSchema creates the tables of defs that do not exist and adds the columns, indexes and unique constraints they miss,
+// then records the checksum of each definition in DXSchemaDefinitionTableName. A definition applied before with the same
+// checksum is skipped. Nothing is ever dropped nor altered: a column of the table missing from its definition or whose
+// nullability differs is reported in the Destructive of the returned plan and logged, the types of the existing columns are
+// not compared. The DDL is not transactional on every database, a failure leaves the statements before it applied.
+func (d *DXDatabase) EnsureSchema(defs []db.TableDefinition) (plan *DXSchemaPlan, err error) {
+	plan, err = d.PlanSchema(defs)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range plan.Tables {
+		if t.IsUnchanged {
+			continue
+		}
+		for _, s := range t.Statements {
+			log.Log.Infof("EnsureSchema %s: %s", d.NameId, s)
+			_, err = d.Connection.Exec(s)
+			if err != nil {
+				return plan, log.Log.ErrorAndCreateErrorf("SCHEMA_STATEMENT_FAILED:%s:%s:%v", d.NameId, s, err.Error())
+			}
+		}
+		db.InvalidateStatementCache(t.TableName)
+		for _, s := range t.Destructive {
+			log.Log.Warnf("SCHEMA_DESTRUCTIVE_DIFFERENCE_NOT_APPLIED:%s:%s", d.NameId, s)
+		}
+		err = d.recordSchemaChecksum(t.TableName, t.Checksum)
+		if err != nil {
+			return plan, log.Log.ErrorAndCreateErrorf("SCHEMA_CHECKSUM_CANT_BE_RECORDED:%s:%s:%v", d.NameId, t.TableName, err.Error())
+		}
+	}
+	return plan, nil
+}
+
+// ensureTableOnce runs EnsureSchema for def the first time it is called for d, once records the databases done
+func (d *DXDatabase) ensureTableOnce(once *sync.Map, def db.TableDefinition) (err error) {
+	if _, ok := once.Load(d); ok {
+		return nil
+	}
+	_, err = d.EnsureSchema([]db.TableDefinition{def})
+	if err != nil {
+		return err
+	}
+	once.Store(d, true)
+	return nil
+}
+
+func (d *DXDatabase) appliedSchemaChecksums() (applied map[string]string, err error) {
+	applied = map[string]string{}
+	columns, err := db.GetTableColumns(d.Connection, DXSchemaDefinitionTableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return applied, nil
+	}
+	_, rows, err := db.Select(d.Connection, nil, DXSchemaDefinitionTableName, []string{"table_name", "checksum"}, nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		tableName, _ := rowValue(row, "table_name").(string)
+		checksum, _ := rowValue(row, "checksum").(string)
+		applied[strings.ToLower(tableName)] = checksum
+	}
+	return applied, nil
+}
+
+func (d *DXDatabase) planTable(def db.TableDefinition, applied map[string]string) (p *DXSchemaTablePlan, err error) {
+	driverName := d.Connection.DriverName()
+	p = &DXSchemaTablePlan{TableName: def.Name, Checksum: def.Checksum()}
+	if applied[strings.ToLower(def.Name)] == p.Checksum {
+		p.IsUnchanged = true
+		return p, nil
+	}
+	existingColumns, err := db.GetTableColumns(d.Connection, def.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(existingColumns) == 0 {
+		s, err := def.SQLCreateTable(driverName)
+		if err != nil {
+			return nil, err
+		}
+		p.Statements = append(p.Statements, s)
+		for _, idx := range def.Indexes {
+			s, err = def.SQLCreateIndex(driverName, idx)
+			if err != nil {
+				return nil, err
+			}
+			p.Statements = append(p.Statements, s)
+		}
+		return p, nil
+	}
+
+	existing := map[string]db.TableColumn{}
+	for _, c := range existingColumns {
+		existing[strings.ToLower(c.Name)] = c
+	}
+	defined := map[string]bool{}
+	for _, c := range def.Columns {
+		defined[strings.ToLower(c.Name)] = true
+		e, ok := existing[strings.ToLower(c.Name)]
+		if !ok {
+			s, err := def.SQLAddColumn(driverName, c)
+			if err != nil {
+				return nil, err
+			}
+			p.Statements = append(p.Statements, s)
+			continue
+		}
+		isNullable := c.IsNullable && !c.IsPrimaryKey
+		if e.IsNullable != isNullable {
+			p.Destructive = append(p.Destructive, fmt.Sprintf("COLUMN_NULLABILITY_DIFFERS:%s.%s:database=%v:definition=%v", def.Name,
+				c.Name, e.IsNullable, isNullable))
+		}
+	}
+	for _, c := range existingColumns {
+		if !defined[strings.ToLower(c.Name)] {
+			p.Destructive = append(p.Destructive, fmt.Sprintf("COLUMN_NOT_IN_DEFINITION:%s.%s", def.Name, c.Name))
+		}
+	}
+
+	indexNames, err := db.GetTableIndexNames(d.Connection, def.Name)
+	if err != nil {
+		return nil, err
+	}
+	isIndexExist := map[string]bool{}
+	for _, name := range indexNames {
+		isIndexExist[strings.ToLower(name)] = true
+	}
+	for _, idx := range def.Indexes {
+		if isIndexExist[strings.ToLower(idx.Name)] {
+			continue
+		}
+		s, err := def.SQLCreateIndex(driverName, idx)
+		if err != nil {
+			return nil, err
+		}
+		p.Statements = append(p.Statements, s)
+	}
+	for _, u := range def.UniqueConstraints {
+		if isIndexExist[strings.ToLower(u.Name)] {
+			continue
+		}
+		s, err := def.SQLAddUniqueConstraint(driverName, u)
+		if err != nil {
+			return nil, err
+		}
+		p.Statements = append(p.Statements, s)
+	}
+	return p, nil
+}
+
+func (d *DXDatabase) recordSchemaChecksum(tableName string, checksum string) (err error) {
+	where := utils.JSON{"table_name": strings.ToLower(tableName)}
+	result, err := db.Update(d.Connection, DXSchemaDefinitionTableName, utils.JSON{"checksum": checksum, "applied_at": time.Now()}, where)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err == nil && n > 0 {
+		return nil
+	}
+	_, err = db.Insert(d.Connection, DXSchemaDefinitionTableName, "id", utils.JSON{
+		"table_name": strings.ToLower(tableName),
+		"checksum":   checksum,
+		"applied_at": time.Now(),
+	})
+	return err
+}
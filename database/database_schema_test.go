@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+)
+
+// fakeOracleSchemaTables are the tables of dxlib on a fake Oracle, every table exists and its rows are read back with their
+// columns in upper case like go-ora does. checksums holds the rows of DXSchemaDefinitionTableName, by table name, and
+// scripts the names of the rows of DXScriptExecutionTableName.
+type fakeOracleSchemaTables struct {
+	mutex      sync.Mutex
+	checksums  map[string]string
+	scripts    []string
+	statements []string
+}
+
+func (f *fakeOracleSchemaTables) handle(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	query := strings.ToUpper(s.Query)
+	switch {
+	case query == "PING" || query == "BEGIN" || query == "COMMIT" || query == "ROLLBACK":
+		return dbtest.DXFakeResult{}
+	case strings.Contains(query, "ALL_TAB_COLUMNS"):
+		return dbtest.DXFakeResult{Columns: []string{"COLUMN_NAME", "DATA_TYPE", "NULLABLE"}, Rows: [][]any{{"ID", "NUMBER", "N"}}}
+	case strings.HasPrefix(query, "SELECT") && strings.Contains(query, `"`+strings.ToUpper(DXSchemaDefinitionTableName)+`"`):
+		r := dbtest.DXFakeResult{Columns: []string{"TABLE_NAME", "CHECKSUM"}}
+		for tableName, checksum := range f.checksums {
+			r.Rows = append(r.Rows, []any{tableName, checksum})
+		}
+		return r
+	case strings.HasPrefix(query, "SELECT") && strings.Contains(query, `"`+strings.ToUpper(DXScriptExecutionTableName)+`"`):
+		r := dbtest.DXFakeResult{Columns: []string{"NAME_ID"}}
+		for _, nameId := range f.scripts {
+			r.Rows = append(r.Rows, []any{nameId})
+		}
+		return r
+	}
+	f.statements = append(f.statements, s.Query)
+	if out, ok := s.Arg("new_id"); ok {
+		*out.(sql.Out).Dest.(*int64) = 1
+	}
+	return dbtest.DXFakeResult{RowsAffected: 1}
+}
+
+// The checksums recorded on Oracle are read whatever the case of their columns, the definitions applied before are unchanged
+func TestOracleSchemaChecksumsAreRead(t *testing.T) {
+	def := db.TableDefinition{
+		Name:    "orders",
+		Columns: []db.ColumnDefinition{{Name: "id", Type: db.ColumnTypeBigInt, IsPrimaryKey: true}},
+	}
+	tables := &fakeOracleSchemaTables{checksums: map[string]string{
+		DXSchemaDefinitionTableName: schemaDefinitionTable.Checksum(),
+		"orders":                    def.Checksum(),
+	}}
+	d, _ := newFakeDatabase(t, database_type.Oracle, "oracle", tables.handle)
+	plan, err := d.EnsureSchema([]db.TableDefinition{def})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range plan.Tables {
+		if !p.IsUnchanged {
+			t.Fatalf("%s applied before is planned again: %v", p.TableName, p.Statements)
+		}
+	}
+	if len(tables.statements) != 0 {
+		t.Fatalf("statements %v", tables.statements)
+	}
+}
+
+// On Oracle a RunOnce script recorded before is skipped, the one not recorded yet is executed then recorded
+func TestOracleRunOnceScriptsAppliedAreSkipped(t *testing.T) {
+	tables := &fakeOracleSchemaTables{checksums: map[string]string{
+		DXSchemaDefinitionTableName: schemaDefinitionTable.Checksum(),
+		DXScriptExecutionTableName:  scriptExecutionTable.Checksum(),
+	}, scripts: []string{"seed_v1"}}
+	d, _ := newFakeDatabase(t, database_type.Oracle, "oracle", tables.handle)
+	results, err := d.ExecuteScripts([]*DXDatabaseScript{
+		{NameId: "seed_v1", SQL: []string{"UPDATE item SET name = 'v1'"}, RunOnce: true},
+		{NameId: "seed_v2", SQL: []string{"UPDATE item SET name = 'v2'"}, RunOnce: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].IsSkipped || results[1].IsSkipped || results[1].Err != nil {
+		t.Fatalf("seed_v1 skipped %v, seed_v2 skipped %v, %v", results[0].IsSkipped, results[1].IsSkipped, results[1].Err)
+	}
+	if len(tables.statements) != 2 || !strings.Contains(tables.statements[0], "'v2'") ||
+		!strings.Contains(tables.statements[1], strings.ToUpper(DXScriptExecutionTableName)) {
+		t.Fatalf("statements %v", tables.statements)
+	}
+}
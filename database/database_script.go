@@ -2,14 +2,56 @@ package database
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/database/protected/sqlfile"
 	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+	mssql "github.com/microsoft/go-mssqldb"
 )
 
+// DXScriptExecutionTableName is the table where ExecuteScripts records the RunOnce scripts it applied
+const DXScriptExecutionTableName = "dxlib_script_execution"
+
+var scriptExecutionTable = db.TableDefinition{
+	Name: DXScriptExecutionTableName,
+	Columns: []db.ColumnDefinition{
+		{Name: "id", Type: db.ColumnTypeBigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+		{Name: "name_id", Type: db.ColumnTypeVarchar, Length: 255},
+		{Name: "applied_at", Type: db.ColumnTypeTimestamp},
+	},
+	UniqueConstraints: []db.IndexDefinition{
+		{Name: DXScriptExecutionTableName + "_name_id_uk", Columns: []string{"name_id"}},
+	},
+}
+
+// DXDatabaseScript is a set of SQL files and inline SQL, each of them executed in its own transaction, the files first
 type DXDatabaseScript struct {
 	Owner              *DXDatabaseManager
 	NameId             string
 	ManagementDatabase *DXDatabase
 	Files              []string
+	SQL                []string
+	// Order sorts the scripts given to ExecuteScripts, the lower first, the scripts of the same order keep theirs
+	Order int
+	// ContinueOnError logs the error of the script and executes the next ones
+	ContinueOnError bool
+	// RunOnce skips the script when it was applied before, as recorded in DXScriptExecutionTableName by NameId
+	RunOnce bool
+}
+
+type DXDatabaseScriptResult struct {
+	NameId string
+	// IsSkipped is true for a RunOnce script applied before
+	IsSkipped      bool
+	Duration       time.Duration
+	StatementCount int
+	Results        []sql.Result
+	Err            error
 }
 
 func (dm *DXDatabaseManager) NewDatabaseScript(nameId string, files []string) *DXDatabaseScript {
@@ -22,6 +64,17 @@ func (dm *DXDatabaseManager) NewDatabaseScript(nameId string, files []string) *D
 	return &ds
 }
 
+// NewDatabaseScriptFromSQL is NewDatabaseScript with the statements of each of sqls instead of files
+func (dm *DXDatabaseManager) NewDatabaseScriptFromSQL(nameId string, sqls []string) *DXDatabaseScript {
+	ds := DXDatabaseScript{
+		Owner:  dm,
+		NameId: nameId,
+		SQL:    sqls,
+	}
+	dm.Scripts[nameId] = &ds
+	return &ds
+}
+
 func (ds *DXDatabaseScript) ExecuteFile(d *DXDatabase, filename string) (r sql.Result, err error) {
 	log.Log.Infof("Executing SQL file %s... start", filename)
 	r, err = d.ExecuteFile(filename)
@@ -46,14 +99,134 @@ func (ds *DXDatabaseScript) ExecuteFile(d *DXDatabase, filename string) (r sql.R
 }
 
 func (ds *DXDatabaseScript) Execute(d *DXDatabase) (rs []sql.Result, err error) {
-	rs = []sql.Result{}
+	results, err := d.ExecuteScripts([]*DXDatabaseScript{ds})
+	if len(results) > 0 {
+		rs = results[0].Results
+	}
+	return rs, err
+}
+
+// execute runs the files then the inline SQL of ds on d, until the first error
+func (ds *DXDatabaseScript) execute(d *DXDatabase, result *DXDatabaseScriptResult) (err error) {
+	run := func(name string, load func(sf *sqlfile.SqlFile) error) error {
+		sf := sqlfile.New()
+		err := load(sf)
+		if err != nil {
+			return err
+		}
+		log.Log.Infof("Executing script %s, %s... start", ds.NameId, name)
+		rs, err := sf.Exec(d.Connection.DB)
+		result.StatementCount += len(rs)
+		if err != nil {
+			return err
+		}
+		result.Results = append(result.Results, rs...)
+		log.Log.Infof("Executing script %s, %s... done", ds.NameId, name)
+		return nil
+	}
 	for k, v := range ds.Files {
-		r, err := ds.ExecuteFile(d, v)
+		err = run(v, func(sf *sqlfile.SqlFile) error {
+			return sf.File(v)
+		})
+		if err != nil {
+			return fmt.Errorf("SCRIPT_FILE_FAILED:%s:%d:%s:%w", ds.NameId, k, v, err)
+		}
+	}
+	for k, v := range ds.SQL {
+		name := fmt.Sprintf("sql %d", k)
+		err = run(name, func(sf *sqlfile.SqlFile) error {
+			sf.SQL(name, v)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("SCRIPT_SQL_FAILED:%s:%d:%w", ds.NameId, k, err)
+		}
+	}
+	return nil
+}
+
+// ExecuteScripts executes scripts sorted by their Order and returns the result of each, in the order executed. The error
+// of a script stops the execution and is returned unless the script is ContinueOnError, its result then holds it. A
+// RunOnce script is recorded in DXScriptExecutionTableName once it succeeded and skipped afterward.
+func (d *DXDatabase) ExecuteScripts(scripts []*DXDatabaseScript) (results []*DXDatabaseScriptResult, err error) {
+	if !d.Connected {
+		err = d.Connect()
 		if err != nil {
-			log.Log.Errorf("Error executing file %d:'%s' (%s)", k, v, err.Error())
-			return rs, err
+			return nil, err
+		}
+	}
+	scripts = append([]*DXDatabaseScript{}, scripts...)
+	sort.SliceStable(scripts, func(i, j int) bool {
+		return scripts[i].Order < scripts[j].Order
+	})
+
+	var applied map[string]bool
+	for _, s := range scripts {
+		if s.RunOnce {
+			applied, err = d.appliedScripts()
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	for _, s := range scripts {
+		result := &DXDatabaseScriptResult{NameId: s.NameId}
+		results = append(results, result)
+		if s.RunOnce && applied[s.NameId] {
+			result.IsSkipped = true
+			log.Log.Infof("Script %s on %s was applied before, skipped", s.NameId, d.NameId)
+			continue
+		}
+		start := time.Now()
+		result.Err = s.execute(d, result)
+		db.InvalidateAllStatementCache()
+		if result.Err == nil && s.RunOnce {
+			result.Err = d.recordScript(s.NameId)
+		}
+		result.Duration = time.Since(start)
+		if result.Err == nil {
+			continue
+		}
+		result.Err = d.redactError(result.Err)
+		var sqlErr mssql.Error
+		if errors.As(result.Err, &sqlErr) {
+			log.Log.Errorf("SQL Server Error Number: %d, State: %d, FCMMessage: %s", sqlErr.Number, sqlErr.State, sqlErr.Message)
+		}
+		if s.ContinueOnError {
+			log.Log.Warnf("Error executing script %s on %s, continuing (%s)", s.NameId, d.NameId, result.Err.Error())
+			continue
 		}
-		rs = append(rs, r)
+		return results, log.Log.ErrorAndCreateErrorf("SCRIPT_FAILED:%s:%s:%v", d.NameId, s.NameId, result.Err.Error())
+	}
+	return results, nil
+}
+
+func (d *DXDatabase) appliedScripts() (applied map[string]bool, err error) {
+	_, err = d.EnsureSchema([]db.TableDefinition{scriptExecutionTable})
+	if err != nil {
+		return nil, err
+	}
+	_, rows, err := db.Select(d.Connection, nil, DXScriptExecutionTableName, []string{"name_id"}, nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	applied = map[string]bool{}
+	for _, row := range rows {
+		nameId, _ := rowValue(row, "name_id").(string)
+		applied[nameId] = true
+	}
+	return applied, nil
+}
+
+func (d *DXDatabase) recordScript(nameId string) (err error) {
+	_, err = db.Insert(d.Connection, DXScriptExecutionTableName, "id", utils.JSON{
+		"name_id":    nameId,
+		"applied_at": time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("SCRIPT_EXECUTION_CANT_BE_RECORDED:%s:%w", nameId, err)
 	}
-	return rs, nil
+	return nil
 }
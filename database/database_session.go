@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+)
+
+// sessionInitConnector runs statements on every connection it opens, before the pool hands it out. The pool opens its
+// connections when they are first needed, a setting of the session made once would only reach one of them.
+type sessionInitConnector struct {
+	driver.Connector
+	statements []string
+}
+
+func (c *sessionInitConnector) Connect(ctx context.Context) (conn driver.Conn, err error) {
+	conn, err = c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range c.statements {
+		err = execSessionStatement(ctx, conn, s)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func execSessionStatement(ctx context.Context, conn driver.Conn, s string) (err error) {
+	execer, ok := conn.(driver.ExecerContext)
+	if ok {
+		_, err = execer.ExecContext(ctx, s, nil)
+		if !errors.Is(err, driver.ErrSkip) {
+			return err
+		}
+	}
+	stmt, err := conn.Prepare(s)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+	// The fallback of a driver without ExecerContext, the statements have no argument
+	_, err = stmt.Exec(nil)
+	return err
+}
+
+// sessionInitStatements are the statements setting the session of every connection, the ServerStatementTimeout
+func (d *DXDatabase) sessionInitStatements() (statements []string) {
+	if d.ServerStatementTimeout <= 0 {
+		return nil
+	}
+	ms := strconv.FormatInt(d.ServerStatementTimeout.Milliseconds(), 10)
+	switch d.DatabaseType {
+	case database_type.PostgreSQL:
+		statements = append(statements, `SET statement_timeout = `+ms)
+	case database_type.MySQL:
+		// Only a select is bounded by max_execution_time
+		statements = append(statements, `SET SESSION max_execution_time = `+ms)
+	case database_type.SQLServer:
+		// SQL Server has no statement timeout of the session, the wait for a lock is bounded instead
+		statements = append(statements, `SET LOCK_TIMEOUT `+ms)
+	}
+	return statements
+}
+
+// open opens the pool of d, its connections set up by sessionInitStatements and dialed with the credentials of the
+// CredentialsProvider when set
+func (d *DXDatabase) open() (connection *sqlx.DB, err error) {
+	driverName := d.DatabaseType.Driver()
+	statements := d.sessionInitStatements()
+	if len(statements) == 0 && d.CredentialsProvider == nil {
+		return sqlx.Open(driverName, d.ConnectionString)
+	}
+	// Opening a pool opens no connection, it only finds the driver of driverName
+	driverDB, err := sql.Open(driverName, d.ConnectionString)
+	if err != nil {
+		return nil, err
+	}
+	dbDriver := driverDB.Driver()
+	_ = driverDB.Close()
+	var connector driver.Connector
+	if d.CredentialsProvider != nil {
+		connector = &credentialsConnector{database: d, driver: dbDriver}
+	} else {
+		connector, err = openConnector(dbDriver, d.ConnectionString)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(statements) > 0 {
+		connector = &sessionInitConnector{Connector: connector, statements: statements}
+	}
+	return sqlx.NewDb(sql.OpenDB(connector), driverName), nil
+}
+
+func openConnector(dbDriver driver.Driver, connectionString string) (connector driver.Connector, err error) {
+	driverContext, ok := dbDriver.(driver.DriverContext)
+	if !ok {
+		return nil, fmt.Errorf("DRIVER_HAS_NO_CONNECTOR:%T", dbDriver)
+	}
+	return driverContext.OpenConnector(connectionString)
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+var statementTimeoutRegexp = regexp.MustCompile(`^SET statement_timeout = (\d+)$`)
+
+// fakeStatementTimeoutServer is a Postgres keeping the statement_timeout of each session, a select of the table slow runs
+// until the timeout of its session cancels it, as the server does
+type fakeStatementTimeoutServer struct {
+	mutex    sync.Mutex
+	timeouts map[int64]time.Duration
+	// selectsWithoutTimeout counts the selects run on a session without a timeout
+	selectsWithoutTimeout int
+}
+
+func (f *fakeStatementTimeoutServer) handle(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+	if m := statementTimeoutRegexp.FindStringSubmatch(s.Query); m != nil {
+		ms, _ := strconv.Atoi(m[1])
+		f.mutex.Lock()
+		f.timeouts[s.ConnectionId] = time.Duration(ms) * time.Millisecond
+		f.mutex.Unlock()
+		return dbtest.DXFakeResult{}
+	}
+	if !strings.Contains(s.Query, `"slow"`) {
+		return dbtest.DXFakeResult{RowsAffected: 1}
+	}
+	f.mutex.Lock()
+	timeout, ok := f.timeouts[s.ConnectionId]
+	if !ok {
+		f.selectsWithoutTimeout++
+	}
+	f.mutex.Unlock()
+	if !ok {
+		return dbtest.DXFakeResult{Err: errors.New("THE_SESSION_HAS_NO_STATEMENT_TIMEOUT")}
+	}
+	select {
+	case <-time.After(timeout):
+		return dbtest.DXFakeResult{Err: &pq.Error{Code: "57014", Message: "canceling statement due to statement timeout"}}
+	case <-ctx.Done():
+		return dbtest.DXFakeResult{Err: ctx.Err()}
+	}
+}
+
+// A slow query run with a background context on any connection of the pool is ended by the server, and the error is an
+// ErrQueryTimeout
+func TestServerStatementTimeoutEndsSlowQueriesOnEveryPooledConnection(t *testing.T) {
+	server := &fakeStatementTimeoutServer{timeouts: map[int64]time.Duration{}}
+	fake := dbtest.Open("postgres", server.handle)
+	defer func() {
+		_ = fake.Close()
+	}()
+	d := &DXDatabase{NameId: "timeout", DatabaseType: database_type.PostgreSQL, Connected: true,
+		ServerStatementTimeout: 50 * time.Millisecond}
+	// The pool of open() over the fake connections, the driver of the connection string needs a server
+	d.Connection = sqlx.NewDb(sql.OpenDB(&sessionInitConnector{Connector: fake.Connector(), statements: d.sessionInitStatements()}),
+		"postgres")
+	defer func() {
+		_ = d.Connection.Close()
+	}()
+	const concurrency = 4
+	d.Connection.SetMaxOpenConns(concurrency)
+
+	start := time.Now()
+	errs := make(chan error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			_, _, err := d.SelectContext(context.Background(), "slow", nil, utils.JSON{"id": int64(1)}, nil, nil)
+			errs <- err
+		}()
+	}
+	for i := 0; i < concurrency; i++ {
+		err := <-errs
+		if !errors.Is(err, db.ErrQueryTimeout) {
+			t.Fatalf("err %v", err)
+		}
+		var pqError *pq.Error
+		if !errors.As(err, &pqError) || pqError.Code != "57014" {
+			t.Fatalf("the error of the server is lost in %#v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("the queries ran %v", elapsed)
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.selectsWithoutTimeout != 0 || len(server.timeouts) != concurrency {
+		t.Fatalf("%d selects without a timeout, the sessions %v", server.selectsWithoutTimeout, server.timeouts)
+	}
+	for connectionId, timeout := range server.timeouts {
+		if timeout != d.ServerStatementTimeout {
+			t.Fatalf("the session %d has the timeout %v", connectionId, timeout)
+		}
+	}
+}
+
+func TestSessionInitStatements(t *testing.T) {
+	for _, tc := range []struct {
+		databaseType database_type.DXDatabaseType
+		timeout      time.Duration
+		want         string
+	}{
+		{database_type.PostgreSQL, 1500 * time.Millisecond, "SET statement_timeout = 1500"},
+		{database_type.MySQL, 1500 * time.Millisecond, "SET SESSION max_execution_time = 1500"},
+		{database_type.SQLServer, 1500 * time.Millisecond, "SET LOCK_TIMEOUT 1500"},
+		// The timeout of go-ora is the TIMEOUT option of its url
+		{database_type.Oracle, 1500 * time.Millisecond, ""},
+		{database_type.PostgreSQL, 0, ""},
+	} {
+		d := &DXDatabase{DatabaseType: tc.databaseType, ServerStatementTimeout: tc.timeout}
+		if got := strings.Join(d.sessionInitStatements(), ";"); got != tc.want {
+			t.Errorf("%s %v: %q", tc.databaseType, tc.timeout, got)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// benchmarkStatementCache runs Insert then Select of one order in a loop, with the statement cache enabled or not
+func benchmarkStatementCache(b *testing.B, isEnabled bool) {
+	previous := db.IsStatementCacheEnabled
+	db.IsStatementCacheEnabled = isEnabled
+	defer func() {
+		db.IsStatementCacheEnabled = previous
+	}()
+	d, _ := newFakeDatabase(b, database_type.PostgreSQL, "postgres", func(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+		if strings.HasPrefix(s.Query, "INSERT") {
+			return dbtest.DXFakeResult{Columns: []string{"id"}, Rows: [][]any{{int64(1)}}}
+		}
+		if s.IsQuery {
+			return dbtest.DXFakeResult{Columns: []string{"id", "customer_id", "amount"}, Rows: [][]any{{int64(1), int64(2), 3.5}}}
+		}
+		return dbtest.DXFakeResult{RowsAffected: 1}
+	})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := d.Insert("orders", "id", utils.JSON{"customer_id": int64(i), "amount": 3.5, "note": nil})
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, _, err = d.Select("orders", []string{"id", "customer_id", "amount"}, utils.JSON{"customer_id": int64(i)},
+			map[string]string{"id": "asc"}, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInsertSelectStatementCacheEnabled(b *testing.B) {
+	benchmarkStatementCache(b, true)
+}
+
+func BenchmarkInsertSelectStatementCacheDisabled(b *testing.B) {
+	benchmarkStatementCache(b, false)
+}
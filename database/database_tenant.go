@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/utils"
+	"github.com/donnyhardyanto/dxlib/utils/cache"
+)
+
+// DXDatabaseLibraryTablePrefix starts the names of the tables dxlib keeps itself, like DXSchemaDefinitionTableName, they are
+// never tenant scoped
+const DXDatabaseLibraryTablePrefix = "dxlib_"
+
+// tenantScopeValue marks the tenant put in a where or in the values of an Insert by a tenant scope, a plain value given for
+// TenantFieldName does not satisfy the scope
+type tenantScopeValue string
+
+// IsTenantSharedTable tells whether tableName is outside the tenant scope, every table is when TenantFieldName is empty
+func (d *DXDatabase) IsTenantSharedTable(tableName string) bool {
+	if d.TenantFieldName == "" || strings.HasPrefix(strings.ToLower(tableName), DXDatabaseLibraryTablePrefix) {
+		return true
+	}
+	for _, v := range d.TenantSharedTables {
+		if strings.EqualFold(v, tableName) {
+			return true
+		}
+	}
+	return false
+}
+
+// withTenant returns kv with the tenant of the scope, kv itself when there is no tenant
+func (d *DXDatabase) withTenant(tenantId string, kv utils.JSON) utils.JSON {
+	if tenantId == "" || d.TenantFieldName == "" {
+		return kv
+	}
+	r := utils.JSON{}
+	for k, v := range kv {
+		r[k] = v
+	}
+	r[d.TenantFieldName] = tenantScopeValue(tenantId)
+	return r
+}
+
+// resolveTenant replaces the tenant put in kv by a tenant scope by its value, or drops it on a shared table. It fails on a
+// table of the tenants without it, the query would read or write the rows of every tenant.
+func (d *DXDatabase) resolveTenant(tableName string, kv utils.JSON) (r utils.JSON, err error) {
+	tenantId, isScoped := kv[d.TenantFieldName].(tenantScopeValue)
+	if d.IsTenantSharedTable(tableName) {
+		if !isScoped {
+			return kv, nil
+		}
+		r = utils.JSON{}
+		for k, v := range kv {
+			r[k] = v
+		}
+		delete(r, d.TenantFieldName)
+		return r, nil
+	}
+	if !isScoped {
+		return nil, fmt.Errorf("TENANT_NOT_IN_SCOPE:%s:%s", d.NameId, tableName)
+	}
+	r = utils.JSON{}
+	for k, v := range kv {
+		r[k] = v
+	}
+	r[d.TenantFieldName] = string(tenantId)
+	return r, nil
+}
+
+// checkTenantNotSet rejects an update moving rows to another tenant
+func (d *DXDatabase) checkTenantNotSet(tableName string, setKeyValues utils.JSON) (err error) {
+	if d.IsTenantSharedTable(tableName) {
+		return nil
+	}
+	_, ok := setKeyValues[d.TenantFieldName]
+	if ok {
+		return fmt.Errorf("TENANT_FIELD_CANT_BE_UPDATED:%s:%s.%s", d.NameId, tableName, d.TenantFieldName)
+	}
+	return nil
+}
+
+// DXDatabaseTenantScope runs the queries of Database for the tenant TenantId, see DXDatabase.Tenant. They are cancelled when
+// Context ends, none is context.Background().
+type DXDatabaseTenantScope struct {
+	Database *DXDatabase
+	TenantId string
+	Context  context.Context
+}
+
+// Tenant returns d scoped to tenantId. With TenantFieldName set, the queries of d and of its transactions on a table not shared
+// fail unless they run through a scope: its where are restricted to the rows of tenantId and its Insert set it. A transaction
+// is scoped by its TenantId.
+func (d *DXDatabase) Tenant(tenantId string) *DXDatabaseTenantScope {
+	return &DXDatabaseTenantScope{Database: d, TenantId: tenantId}
+}
+
+func (s *DXDatabaseTenantScope) context() context.Context {
+	if s.Context == nil {
+		return context.Background()
+	}
+	return s.Context
+}
+
+func (s *DXDatabaseTenantScope) scoped(kv utils.JSON) utils.JSON {
+	return s.Database.withTenant(s.TenantId, kv)
+}
+
+func (s *DXDatabaseTenantScope) Insert(tableName string, fieldNameForRowId string, keyValues utils.JSON, opts ...DXDatabaseWriteOption) (id int64, err error) {
+	return s.Database.InsertContext(s.context(), tableName, fieldNameForRowId, s.scoped(keyValues), opts...)
+}
+
+func (s *DXDatabaseTenantScope) Update(tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON, opts ...DXDatabaseWriteOption) (result sql.Result, err error) {
+	return s.Database.UpdateContext(s.context(), tableName, setKeyValues, s.scoped(whereKeyValues), opts...)
+}
+
+func (s *DXDatabaseTenantScope) ShouldSelectCount(tableName string, summaryCalcFieldsPart string, whereAndFieldNameValues utils.JSON) (totalRows int64, c utils.JSON, err error) {
+	return s.Database.ShouldSelectCountContext(s.context(), tableName, summaryCalcFieldsPart, s.scoped(whereAndFieldNameValues))
+}
+
+func (s *DXDatabaseTenantScope) ShouldSelectOne(tableName string, whereAndFieldNameValues utils.JSON, orderbyFieldNameDirections map[string]string) (
+	rowsInfo *db.RowsInfo, resultData utils.JSON, err error) {
+	return s.Database.ShouldSelectOneContext(s.context(), tableName, s.scoped(whereAndFieldNameValues), orderbyFieldNameDirections)
+}
+
+func (s *DXDatabaseTenantScope) Select(tableName string, showFieldNames []string, whereAndFieldNameValues utils.JSON, orderbyFieldNameDirections map[string]string,
+	limit any, opts ...DXDatabaseSelectOption) (rowsInfo *db.RowsInfo, resultData []utils.JSON, err error) {
+	return s.Database.SelectContext(s.context(), tableName, showFieldNames, s.scoped(whereAndFieldNameValues), orderbyFieldNameDirections, limit, opts...)
+}
+
+func (s *DXDatabaseTenantScope) SelectOne(tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
+	orderbyFieldNameDirections map[string]string) (rowsInfo *db.RowsInfo, r utils.JSON, err error) {
+	return s.Database.SelectOneContext(s.context(), tableName, fieldNames, s.scoped(whereAndFieldNameValues), joinSQLPart, orderbyFieldNameDirections)
+}
+
+func (s *DXDatabaseTenantScope) SelectPaged(tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, orderbyFieldNameDirections map[string]string,
+	rowsPerPage int64, pageIndex int64, opts ...DXDatabaseSelectOption) (rowsInfo *db.RowsInfo, rows []utils.JSON, totalRows int64, totalPage int64, err error) {
+	return s.Database.SelectPagedContext(s.context(), tableName, fieldNames, s.scoped(whereAndFieldNameValues), orderbyFieldNameDirections, rowsPerPage, pageIndex, opts...)
+}
+
+func (s *DXDatabaseTenantScope) SoftDelete(tableName string, whereKeyValues utils.JSON, opts ...DXDatabaseWriteOption) (result sql.Result, err error) {
+	return s.Database.SoftDeleteContext(s.context(), tableName, s.scoped(whereKeyValues), opts...)
+}
+
+func (s *DXDatabaseTenantScope) Delete(tableName string, whereKeyValues utils.JSON, opts ...DXDatabaseWriteOption) (r sql.Result, err error) {
+	return s.Database.DeleteContext(s.context(), tableName, s.scoped(whereKeyValues), opts...)
+}
+
+func (s *DXDatabaseTenantScope) DeleteOne(tableName string, whereKeyValues utils.JSON, opts ...DXDatabaseWriteOption) (r sql.Result, err error) {
+	return s.Database.DeleteOneContext(s.context(), tableName, s.scoped(whereKeyValues), opts...)
+}
+
+func (s *DXDatabaseTenantScope) SelectCursor(tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON,
+	orderbyFieldNameDirections map[string]string) (rowsInfo *db.RowsInfo, cursor *db.RowsCursor, err error) {
+	return s.Database.SelectCursor(tableName, fieldNames, s.scoped(whereAndFieldNameValues), orderbyFieldNameDirections)
+}
+
+func (s *DXDatabaseTenantScope) ClaimRows(tableName string, idFieldName string, whereAndFieldNameValues utils.JSON, orderbyFieldNameDirections map[string]string,
+	limit int64, setKeyValues utils.JSON) (rows []utils.JSON, err error) {
+	return s.Database.ClaimRows(tableName, idFieldName, s.scoped(whereAndFieldNameValues), orderbyFieldNameDirections, limit, setKeyValues)
+}
+
+// CachedSelectOne keys the row by its tenant too, a tenant never gets the row cached for another
+func (s *DXDatabaseTenantScope) CachedSelectOne(c *cache.DXCache[string, utils.JSON], tableName string, whereAndFieldNameValues utils.JSON,
+	ttl time.Duration) (r utils.JSON, err error) {
+	return s.Database.CachedSelectOne(c, tableName, s.scoped(whereAndFieldNameValues), ttl)
+}
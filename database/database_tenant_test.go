@@ -0,0 +1,275 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// fakeTenantTable holds the rows of the table item for the tenants A and B, a statement reaches the rows matching the tenant
+// and the id it binds, all of them when it binds none
+type fakeTenantTable struct {
+	mutex sync.Mutex
+	rows  []utils.JSON
+	// statements on item, to check that each one binds the tenant
+	statements []dbtest.DXFakeStatement
+}
+
+var (
+	fakeTenantPlaceholderRegexp = regexp.MustCompile(`"(tenant_id|id)"\s*=\s*\$(\d+)`)
+	fakeTenantUnscopedRegexp    = regexp.MustCompile(`(?i)^\s*(select|update|delete|insert|with)\b.*\bitem\b`)
+)
+
+func newFakeTenantTable() *fakeTenantTable {
+	return &fakeTenantTable{rows: []utils.JSON{
+		{"id": int64(1), "tenant_id": "A", "name": "a1"},
+		{"id": int64(2), "tenant_id": "B", "name": "b1"},
+	}}
+}
+
+// bound returns the values bound to the tenant_id and id columns of s
+func (f *fakeTenantTable) bound(s dbtest.DXFakeStatement) (tenantIds []any, ids []any) {
+	for _, m := range fakeTenantPlaceholderRegexp.FindAllStringSubmatch(s.Query, -1) {
+		v, _ := s.Arg(m[2])
+		if m[1] == "tenant_id" {
+			tenantIds = append(tenantIds, v)
+		} else {
+			ids = append(ids, v)
+		}
+	}
+	return tenantIds, ids
+}
+
+func (f *fakeTenantTable) handle(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !fakeTenantUnscopedRegexp.MatchString(s.Query) {
+		return dbtest.DXFakeResult{RowsAffected: 1}
+	}
+	f.statements = append(f.statements, s)
+	tenantIds, ids := f.bound(s)
+	var matching []utils.JSON
+	for _, row := range f.rows {
+		isMatching := true
+		for _, v := range tenantIds {
+			isMatching = isMatching && row["tenant_id"] == v
+		}
+		for _, v := range ids {
+			isMatching = isMatching && row["id"] == v
+		}
+		if isMatching {
+			matching = append(matching, row)
+		}
+	}
+	q := strings.ToLower(strings.TrimSpace(s.Query))
+	if strings.Contains(q, "count(") {
+		return dbtest.DXFakeResult{Columns: []string{"s___total_rows"}, Rows: [][]any{{int64(len(matching))}}}
+	}
+	if !s.IsQuery {
+		return dbtest.DXFakeResult{RowsAffected: int64(len(matching))}
+	}
+	r := dbtest.DXFakeResult{Columns: []string{"id", "tenant_id", "name"}}
+	for _, row := range matching {
+		r.Rows = append(r.Rows, []any{row["id"], row["tenant_id"], row["name"]})
+	}
+	return r
+}
+
+// checkEveryStatementBindsTenant fails unless every statement on item since the last check bound the tenant tenantId only
+func (f *fakeTenantTable) checkEveryStatementBindsTenant(t *testing.T, tenantId string) {
+	t.Helper()
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if len(f.statements) == 0 {
+		t.Fatal("no statement on item")
+	}
+	for _, s := range f.statements {
+		tenantIds, _ := f.bound(s)
+		if len(tenantIds) == 0 {
+			t.Fatalf("%s binds no tenant", s.Query)
+		}
+		for _, v := range tenantIds {
+			if v != tenantId {
+				t.Fatalf("%s binds the tenant %v", s.Query, v)
+			}
+		}
+	}
+	f.statements = nil
+}
+
+func newFakeTenantDatabase(t *testing.T) (*DXDatabase, *fakeTenantTable) {
+	t.Helper()
+	table := newFakeTenantTable()
+	d, _ := newFakeDatabase(t, database_type.PostgreSQL, "postgres", table.handle)
+	d.TenantFieldName = "tenant_id"
+	return d, table
+}
+
+func expectIds(t *testing.T, rows []utils.JSON, ids ...int64) {
+	t.Helper()
+	var got []string
+	for _, row := range rows {
+		got = append(got, strconv.FormatInt(row["id"].(int64), 10))
+	}
+	var want []string
+	for _, id := range ids {
+		want = append(want, strconv.FormatInt(id, 10))
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("rows %v, want the ids %v", rows, want)
+	}
+}
+
+func expectRowsAffected(t *testing.T, r sql.Result, err error, want int64) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := r.RowsAffected()
+	if n != want {
+		t.Fatalf("%d rows affected, want %d", n, want)
+	}
+}
+
+func expectTenantNotInScope(t *testing.T, err error) {
+	t.Helper()
+	if err == nil || !strings.HasPrefix(err.Error(), "TENANT_NOT_IN_SCOPE:") {
+		t.Fatalf("err %v", err)
+	}
+}
+
+// The tenant A reaches neither the rows of B nor, without a scope, any row, through DXDatabase
+func TestTenantIsolationOfDXDatabase(t *testing.T) {
+	d, table := newFakeTenantDatabase(t)
+	a := d.Tenant("A")
+
+	_, rows, err := a.Select("item", nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIds(t, rows, 1)
+	// A tenant asked for in the where is the one of the scope
+	_, rows, err = a.Select("item", nil, utils.JSON{"tenant_id": "B"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIds(t, rows, 1)
+	_, row, err := a.SelectOne("item", nil, utils.JSON{"id": int64(2)}, nil, nil)
+	if err != nil || row != nil {
+		t.Fatalf("the row of B is read, %v %v", row, err)
+	}
+	_, rows, _, _, err = a.SelectPaged("item", nil, nil, nil, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIds(t, rows, 1)
+	_, cursor, err := a.SelectCursor("item", nil, utils.JSON{"id": int64(2)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, ok, err := cursor.Next()
+	_ = cursor.Close()
+	if err != nil || ok {
+		t.Fatalf("the row of B is read by a cursor, %v %v", row, err)
+	}
+	r, err := a.Update("item", utils.JSON{"name": "x"}, utils.JSON{"id": int64(2)})
+	expectRowsAffected(t, r, err, 0)
+	r, err = a.Delete("item", utils.JSON{"id": int64(2)})
+	expectRowsAffected(t, r, err, 0)
+	r, err = a.Update("item", utils.JSON{"name": "x"}, utils.JSON{"id": int64(1)})
+	expectRowsAffected(t, r, err, 1)
+	table.checkEveryStatementBindsTenant(t, "A")
+
+	// The tenant cannot be moved
+	_, err = a.Update("item", utils.JSON{"tenant_id": "B"}, utils.JSON{"id": int64(1)})
+	if err == nil || !strings.HasPrefix(err.Error(), "TENANT_FIELD_CANT_BE_UPDATED:") {
+		t.Fatalf("err %v", err)
+	}
+
+	// Without a scope nothing runs, a plain tenant value does not make one
+	_, _, err = d.Select("item", nil, nil, nil, nil)
+	expectTenantNotInScope(t, err)
+	_, _, err = d.Select("item", nil, utils.JSON{"tenant_id": "B"}, nil, nil)
+	expectTenantNotInScope(t, err)
+	_, _, err = d.SelectOne("item", nil, utils.JSON{"id": int64(2)}, nil, nil)
+	expectTenantNotInScope(t, err)
+	_, _, _, _, err = d.SelectPaged("item", nil, nil, nil, 0, 0)
+	expectTenantNotInScope(t, err)
+	_, _, err = d.SelectCursor("item", nil, nil, nil)
+	expectTenantNotInScope(t, err)
+	_, err = d.Update("item", utils.JSON{"name": "x"}, utils.JSON{"id": int64(2)})
+	expectTenantNotInScope(t, err)
+	_, err = d.Delete("item", utils.JSON{"id": int64(2), "tenant_id": "B"})
+	expectTenantNotInScope(t, err)
+	_, _, err = d.ShouldSelectCount("item", "", nil)
+	expectTenantNotInScope(t, err)
+}
+
+// The same through a transaction scoped by its TenantId, and unscoped
+func TestTenantIsolationOfDXDatabaseTx(t *testing.T) {
+	d, table := newFakeTenantDatabase(t)
+	l := log.NewLog(&log.Log, context.Background(), "test")
+	err := d.Tx(&l, LevelDefault, func(dtx *DXDatabaseTx) (err error) {
+		dtx.TenantId = "A"
+		_, rows, err := dtx.Select("item", nil, utils.JSON{"tenant_id": "B"}, nil, nil, nil, nil)
+		if err != nil {
+			return err
+		}
+		expectIds(t, rows, 1)
+		_, row, err := dtx.SelectOne("item", nil, utils.JSON{"id": int64(2)}, nil, nil, true)
+		if err != nil || row != nil {
+			t.Fatalf("the row of B is read, %v %v", row, err)
+		}
+		r, err := dtx.Update("item", utils.JSON{"name": "x"}, utils.JSON{"id": int64(2)})
+		expectRowsAffected(t, r, err, 0)
+		r, err = dtx.Delete("item", utils.JSON{"id": int64(2)})
+		expectRowsAffected(t, r, err, 0)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table.checkEveryStatementBindsTenant(t, "A")
+
+	err = d.Tx(&l, LevelDefault, func(dtx *DXDatabaseTx) (err error) {
+		_, _, err = dtx.Select("item", nil, nil, nil, nil, nil, nil)
+		expectTenantNotInScope(t, err)
+		_, _, err = dtx.ShouldSelectOne("item", nil, utils.JSON{"id": int64(2)}, nil, nil, nil)
+		expectTenantNotInScope(t, err)
+		_, err = dtx.Update("item", utils.JSON{"name": "x"}, utils.JSON{"id": int64(2)})
+		expectTenantNotInScope(t, err)
+		_, err = dtx.Delete("item", utils.JSON{"id": int64(2), "tenant_id": "B"})
+		expectTenantNotInScope(t, err)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTenantIsolationOfClaimRows(t *testing.T) {
+	d, table := newFakeTenantDatabase(t)
+	rows, err := d.Tenant("A").ClaimRows("item", "id", utils.JSON{"tenant_id": "B"}, map[string]string{"id": "asc"}, 10,
+		utils.JSON{"name": "claimed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIds(t, rows, 1)
+	table.checkEveryStatementBindsTenant(t, "A")
+
+	_, err = d.ClaimRows("item", "id", nil, nil, 10, utils.JSON{"name": "claimed"})
+	expectTenantNotInScope(t, err)
+	_, err = d.Tenant("A").ClaimRows("item", "id", nil, nil, 10, utils.JSON{"tenant_id": "B"})
+	if err == nil || !strings.HasPrefix(err.Error(), "TENANT_FIELD_CANT_BE_UPDATED:") {
+		t.Fatalf("err %v", err)
+	}
+}
@@ -0,0 +1,472 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/database/protected/dbtx"
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// The phases of TxAcross, DXTxAcrossError.Phase tells which one failed
+const (
+	DXTxAcrossPhaseBegin          = "BEGIN"
+	DXTxAcrossPhaseCallback       = "CALLBACK"
+	DXTxAcrossPhasePrepare        = "PREPARE"
+	DXTxAcrossPhaseDecision       = "DECISION"
+	DXTxAcrossPhaseCommit         = "COMMIT"
+	DXTxAcrossPhaseCommitPrepared = "COMMIT_PREPARED"
+)
+
+// txAcrossGIdPrefix marks the prepared transactions of TxAcross, the global id is <prefix><correlation id>_<index>_<count>
+const txAcrossGIdPrefix = "dxlib_"
+
+// DXTxAcrossDecisionTableName holds the decisions to commit of TxAcross, a row per unit of work whose prepared transactions
+// are to be committed
+const DXTxAcrossDecisionTableName = "dxlib_tx_across_decision"
+
+var txAcrossDecisionTable = db.TableDefinition{
+	Name: DXTxAcrossDecisionTableName,
+	Columns: []db.ColumnDefinition{
+		{Name: "id", Type: db.ColumnTypeBigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+		{Name: "correlation_id", Type: db.ColumnTypeVarchar, Length: 32},
+		{Name: "created_at", Type: db.ColumnTypeTimestamp},
+	},
+	UniqueConstraints: []db.IndexDefinition{
+		{Name: DXTxAcrossDecisionTableName + "_correlation_id_uk", Columns: []string{"correlation_id"}},
+	},
+}
+
+var txAcrossDecisionTableOnce sync.Map
+
+type DXTxAcrossError struct {
+	CorrelationId  string
+	Phase          string
+	DatabaseNameId string
+	// IsPartiallyCommitted is true when some databases were committed before the failure, they are then inconsistent
+	IsPartiallyCommitted bool
+	Err                  error
+}
+
+func (e *DXTxAcrossError) Error() string {
+	return fmt.Sprintf("TX_ACROSS_FAILED:%s:%s:correlation_id=%s:partially_committed=%v:%v", e.Phase, e.DatabaseNameId,
+		e.CorrelationId, e.IsPartiallyCommitted, e.Err)
+}
+
+func (e *DXTxAcrossError) Unwrap() error {
+	return e.Err
+}
+
+type txAcrossParticipant struct {
+	database *DXDatabase
+	dtx      *DXDatabaseTx
+	gid      string
+	isDone   bool
+}
+
+// isTwoPhaseCommitSupported tells whether TxAcross can PREPARE TRANSACTION on d
+func (d *DXDatabase) isTwoPhaseCommitSupported() bool {
+	return d.DatabaseType == database_type.PostgreSQL
+}
+
+// TxAcross runs callback with a transaction open on each of dbs, keyed by their NameId, and commits them all or none.
+//
+// The PostgreSQL transactions are committed in two phases: each one is prepared with PREPARE TRANSACTION, then the decision to
+// commit is recorded in DXTxAcrossDecisionTableName, then the others are committed one after the other in the order of dbs,
+// then the prepared ones are committed with COMMIT PREPARED. The decision is written in the transaction of the first of the
+// others, so it is taken when that one commits, or on its own on the first PostgreSQL database when there are no others.
+// This is a best effort for the others: a failure of the first commit rolls everything back, a failure of a next one rolls
+// back the others not committed yet while the prepared ones are still committed, the error tells it with
+// IsPartiallyCommitted. A prepared transaction left by a crash or a failed COMMIT PREPARED is resolved by RecoverTxAcross
+// from the recorded decision. PREPARE TRANSACTION needs max_prepared_transactions above zero on the server.
+func TxAcross(log *log.DXLog, isolationLevel sql.IsolationLevel, callback func(txs map[string]*DXDatabaseTx) error, dbs ...*DXDatabase) (err error) {
+	correlationId := hex.EncodeToString(utils.RandomData(8))
+	l := txAcrossLog(log, correlationId)
+	l.Infof("TX_ACROSS_BEGIN:%d databases", len(dbs))
+
+	var participants []*txAcrossParticipant
+	txs := map[string]*DXDatabaseTx{}
+	newError := func(phase string, p *txAcrossParticipant, isPartiallyCommitted bool, err error) error {
+		e := &DXTxAcrossError{CorrelationId: correlationId, Phase: phase, IsPartiallyCommitted: isPartiallyCommitted, Err: err}
+		if p != nil {
+			e.DatabaseNameId = p.database.NameId
+		}
+		l.Errorf("%s", e.Error())
+		return e
+	}
+	defer func() {
+		rec := recover()
+		if rec != nil {
+			rollbackTxAcross(l, participants)
+			panic(rec)
+		}
+	}()
+
+	for _, d := range dbs {
+		p := &txAcrossParticipant{database: d}
+		_, ok := txs[d.NameId]
+		if ok {
+			rollbackTxAcross(l, participants)
+			return newError(DXTxAcrossPhaseBegin, p, false, errors.New("DATABASE_GIVEN_TWICE"))
+		}
+		p.dtx, err = d.beginTxAcross(l, isolationLevel)
+		if err != nil {
+			rollbackTxAcross(l, participants)
+			return newError(DXTxAcrossPhaseBegin, p, false, err)
+		}
+		participants = append(participants, p)
+		txs[d.NameId] = p.dtx
+	}
+
+	err = callback(txs)
+	if err != nil {
+		rollbackTxAcross(l, participants)
+		return newError(DXTxAcrossPhaseCallback, nil, false, err)
+	}
+
+	var prepared, others []*txAcrossParticipant
+	for _, p := range participants {
+		if p.database.isTwoPhaseCommitSupported() {
+			prepared = append(prepared, p)
+		} else {
+			others = append(others, p)
+		}
+	}
+	for i, p := range prepared {
+		p.gid = fmt.Sprintf("%s%s_%d_%d", txAcrossGIdPrefix, correlationId, i, len(prepared))
+	}
+
+	for _, p := range prepared {
+		_, err = p.dtx.Exec("PREPARE TRANSACTION '" + p.gid + "'")
+		if err != nil {
+			rollbackTxAcross(l, participants)
+			return newError(DXTxAcrossPhasePrepare, p, false, err)
+		}
+		// The session is out of the transaction once prepared, this only ends the Tx: lib/pq finds no transaction and drops the
+		// connection, the prepared transaction outlives its session
+		_ = p.dtx.Tx.Rollback()
+		l.Debugf("TX_ACROSS_PREPARED:%s:%s", p.database.NameId, p.gid)
+	}
+
+	var decisionDatabase *DXDatabase
+	if len(prepared) > 0 {
+		p := prepared[0]
+		if len(others) > 0 {
+			p = others[0]
+			err = recordTxAcrossDecision(p.dtx, correlationId)
+		} else {
+			err = p.database.recordTxAcrossDecision(correlationId)
+		}
+		if err != nil {
+			rollbackTxAcross(l, participants)
+			return newError(DXTxAcrossPhaseDecision, p, false, err)
+		}
+		decisionDatabase = p.database
+	}
+
+	var errs []error
+	for i, p := range others {
+		err = p.dtx.Tx.Commit()
+		p.isDone = true
+		if err == nil {
+			continue
+		}
+		if i == 0 {
+			// The decision was not taken, nothing is committed
+			rollbackTxAcross(l, participants)
+			return newError(DXTxAcrossPhaseCommit, p, false, err)
+		}
+		// The decision is taken, the prepared ones are still committed
+		rollbackTxAcross(l, others)
+		errs = append(errs, newError(DXTxAcrossPhaseCommit, p, true, err))
+		break
+	}
+
+	for i, p := range prepared {
+		_, errCommit := p.database.Connection.Exec("COMMIT PREPARED '" + p.gid + "'")
+		if errCommit != nil {
+			// The decision is commit, the next ones are still committed and this one is left to RecoverTxAcross
+			errs = append(errs, newError(DXTxAcrossPhaseCommitPrepared, p, len(others) > 0 || i > 0, errCommit))
+			continue
+		}
+		p.isDone = true
+	}
+	if decisionDatabase != nil && allDone(prepared) {
+		// A decision left behind is deleted by RecoverTxAcross
+		errDelete := decisionDatabase.deleteTxAcrossDecision(correlationId)
+		if errDelete != nil {
+			l.Warnf("TX_ACROSS_DECISION_NOT_DELETED:%s:%v", decisionDatabase.NameId, errDelete.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	l.Infof("TX_ACROSS_COMMITTED:%d databases (%d prepared)", len(participants), len(prepared))
+	return nil
+}
+
+func (d *DXDatabase) deleteRecoveredTxAcrossDecision(correlationId string) (err error) {
+	err = d.deleteTxAcrossDecision(correlationId)
+	if err != nil {
+		return fmt.Errorf("TX_ACROSS_RECOVERY_DECISION_NOT_DELETED:%s:%s:%w", d.NameId, correlationId, err)
+	}
+	return nil
+}
+
+func txAcrossLog(l *log.DXLog, correlationId string) *log.DXLog {
+	r := l.WithFields(log.DXLogFields{"tx_correlation_id": correlationId})
+	return &r
+}
+
+func (d *DXDatabase) beginTxAcross(l *log.DXLog, isolationLevel sql.IsolationLevel) (dtx *DXDatabaseTx, err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, err
+	}
+	txOptions := &sql.TxOptions{
+		Isolation: isolationLevel,
+		ReadOnly:  false,
+	}
+	if d.Connection.DriverName() == "oracle" {
+		txOptions.Isolation = sql.LevelDefault
+	}
+	tx, err := d.beginTxx(l.Context, txOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &DXDatabaseTx{
+		Tx:       tx,
+		Log:      d.txLog(l),
+		Database: d,
+	}, nil
+}
+
+func allDone(participants []*txAcrossParticipant) bool {
+	for _, p := range participants {
+		if !p.isDone {
+			return false
+		}
+	}
+	return true
+}
+
+// recordTxAcrossDecision writes the decision to commit the unit correlationId in dtx, it is taken when dtx commits
+func recordTxAcrossDecision(dtx *DXDatabaseTx, correlationId string) (err error) {
+	err = dtx.Database.ensureTableOnce(&txAcrossDecisionTableOnce, txAcrossDecisionTable)
+	if err != nil {
+		return err
+	}
+	// Written with dbtx directly, the decisions are neither audited nor scoped to a tenant
+	_, err = dbtx.TxInsert(dtx.Log, false, dtx.Tx, DXTxAcrossDecisionTableName, utils.JSON{
+		"correlation_id": correlationId,
+		"created_at":     time.Now().UTC(),
+	})
+	return err
+}
+
+// recordTxAcrossDecision takes the decision to commit the unit correlationId, on its own
+func (d *DXDatabase) recordTxAcrossDecision(correlationId string) (err error) {
+	err = d.ensureTableOnce(&txAcrossDecisionTableOnce, txAcrossDecisionTable)
+	if err != nil {
+		return err
+	}
+	_, err = db.Insert(d.Connection, DXTxAcrossDecisionTableName, "id", utils.JSON{
+		"correlation_id": correlationId,
+		"created_at":     time.Now().UTC(),
+	})
+	return err
+}
+
+func (d *DXDatabase) deleteTxAcrossDecision(correlationId string) (err error) {
+	_, err = db.Delete(d.Connection, DXTxAcrossDecisionTableName, utils.JSON{"correlation_id": correlationId})
+	return err
+}
+
+// listTxAcrossDecisions returns the creation time of the decisions recorded on d, by correlation id
+func (d *DXDatabase) listTxAcrossDecisions() (r map[string]time.Time, err error) {
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, err
+	}
+	err = d.ensureTableOnce(&txAcrossDecisionTableOnce, txAcrossDecisionTable)
+	if err != nil {
+		return nil, err
+	}
+	_, rows, err := db.Select(d.Connection, nil, DXTxAcrossDecisionTableName, []string{"correlation_id", "created_at"}, nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	r = map[string]time.Time{}
+	for _, row := range rows {
+		correlationId, ok := rowValue(row, "correlation_id").(string)
+		if !ok {
+			continue
+		}
+		createdAt, _ := rowValue(row, "created_at").(time.Time)
+		r[correlationId] = createdAt
+	}
+	return r, nil
+}
+
+// rollbackTxAcross rolls back the participants not done yet, from the last one
+func rollbackTxAcross(l *log.DXLog, participants []*txAcrossParticipant) {
+	for i := len(participants) - 1; i >= 0; i-- {
+		p := participants[i]
+		if p.isDone {
+			continue
+		}
+		p.isDone = true
+		if p.gid == "" {
+			err := p.dtx.Tx.Rollback()
+			if err != nil && !errors.Is(err, sql.ErrTxDone) {
+				l.Errorf("TX_ACROSS_ROLLBACK_FAILED:%s:%v", p.database.NameId, err.Error())
+			}
+			continue
+		}
+		_, err := p.database.Connection.Exec("ROLLBACK PREPARED '" + p.gid + "'")
+		if err != nil {
+			// Not prepared yet, the transaction is still open on its connection
+			errTx := p.dtx.Tx.Rollback()
+			if errTx != nil && !errors.Is(errTx, sql.ErrTxDone) {
+				l.Errorf("TX_ACROSS_ROLLBACK_FAILED:%s:%v", p.database.NameId, errTx.Error())
+			}
+		}
+	}
+}
+
+type DXPreparedTxAcross struct {
+	Database      *DXDatabase
+	GId           string
+	CorrelationId string
+	Index         int
+	Count         int
+	PreparedAt    time.Time
+}
+
+// ListPreparedTxAcross returns the transactions prepared by TxAcross and not committed nor rolled back on d, none when the
+// database has no two-phase commit
+func (d *DXDatabase) ListPreparedTxAcross() (r []DXPreparedTxAcross, err error) {
+	if !d.isTwoPhaseCommitSupported() {
+		return nil, nil
+	}
+	err = d.CheckConnectionAndReconnect()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := d.Connection.Query("SELECT gid, prepared FROM pg_prepared_xacts WHERE database = current_database() AND gid LIKE '" +
+		txAcrossGIdPrefix + "%'")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		p := DXPreparedTxAcross{Database: d}
+		err = rows.Scan(&p.GId, &p.PreparedAt)
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Split(strings.TrimPrefix(p.GId, txAcrossGIdPrefix), "_")
+		if len(fields) != 3 {
+			continue
+		}
+		p.CorrelationId = fields[0]
+		p.Index, err = strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		p.Count, err = strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		r = append(r, p)
+	}
+	return r, rows.Err()
+}
+
+// RecoverTxAcross resolves the transactions left prepared by TxAcross on dbs, to be called at startup with every database
+// TxAcross is used with, a unit of work whose decision is on a database not given is rolled back. A unit whose decision to
+// commit is recorded is committed, any other is rolled back, its decision was never taken. The decisions of the units
+// resolved, and the ones left after all their prepared transactions were committed, are deleted. The units prepared less than
+// minAge ago are left alone, they may still be running in another instance.
+func RecoverTxAcross(l *log.DXLog, minAge time.Duration, dbs ...*DXDatabase) (err error) {
+	units := map[string][]DXPreparedTxAcross{}
+	for _, d := range dbs {
+		list, err := d.ListPreparedTxAcross()
+		if err != nil {
+			return l.ErrorAndCreateErrorf("TX_ACROSS_RECOVERY_LIST_FAILED:%s:%v", d.NameId, err.Error())
+		}
+		for _, p := range list {
+			units[p.CorrelationId] = append(units[p.CorrelationId], p)
+		}
+	}
+	// Listed after the prepared transactions, a decision is never recorded before all the prepared transactions of its unit
+	decisions := map[string]*DXDatabase{}
+	decisionTimes := map[string]time.Time{}
+	for _, d := range dbs {
+		list, err := d.listTxAcrossDecisions()
+		if err != nil {
+			return l.ErrorAndCreateErrorf("TX_ACROSS_RECOVERY_LIST_DECISIONS_FAILED:%s:%v", d.NameId, err.Error())
+		}
+		for correlationId, createdAt := range list {
+			decisions[correlationId] = d
+			decisionTimes[correlationId] = createdAt
+		}
+	}
+
+	var errs []error
+	for correlationId, unit := range units {
+		sort.Slice(unit, func(i, j int) bool {
+			return unit[i].Index < unit[j].Index
+		})
+		isOldEnough := true
+		for _, p := range unit {
+			if time.Since(p.PreparedAt) < minAge {
+				isOldEnough = false
+			}
+		}
+		if !isOldEnough {
+			continue
+		}
+		decisionDatabase, isCommit := decisions[correlationId]
+		statement := "ROLLBACK PREPARED '"
+		if isCommit {
+			statement = "COMMIT PREPARED '"
+		}
+		isResolved := true
+		for _, p := range unit {
+			_, errResolve := p.Database.Connection.Exec(statement + p.GId + "'")
+			if errResolve != nil {
+				isResolved = false
+				errs = append(errs, fmt.Errorf("TX_ACROSS_RECOVERY_FAILED:%s:%s:%w", p.Database.NameId, p.GId, errResolve))
+			}
+		}
+		l.Warnf("TX_ACROSS_RECOVERED:correlation_id=%s:commit=%v:%d prepared transactions", correlationId, isCommit, len(unit))
+		if isCommit && isResolved {
+			errs = append(errs, decisionDatabase.deleteRecoveredTxAcrossDecision(correlationId))
+		}
+	}
+	for correlationId, d := range decisions {
+		_, ok := units[correlationId]
+		if ok || time.Since(decisionTimes[correlationId]) < minAge {
+			continue
+		}
+		errs = append(errs, d.deleteRecoveredTxAcrossDecision(correlationId))
+	}
+	err = errors.Join(errs...)
+	if err != nil {
+		l.Errorf("%s", err.Error())
+	}
+	return err
+}
@@ -0,0 +1,329 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/log"
+)
+
+// fakeTxAcrossDatabase keeps the prepared transactions and the decisions of a fake database, a decision inserted in a
+// transaction is recorded at its COMMIT
+type fakeTxAcrossDatabase struct {
+	mutex      sync.Mutex
+	isInTx     bool
+	prepared   map[string]time.Time
+	committed  []string
+	rolledBack []string
+	decisions  map[string]time.Time
+	pending    []string
+	// fail returns the error of a statement, nil runs it
+	fail func(query string) error
+}
+
+var errFakeTxAcross = errors.New("FAKE_FAILURE")
+
+func newFakeTxAcrossDatabase(t *testing.T, nameId string, databaseType database_type.DXDatabaseType, driverName string) (*DXDatabase, *fakeTxAcrossDatabase) {
+	t.Helper()
+	f := &fakeTxAcrossDatabase{prepared: map[string]time.Time{}, decisions: map[string]time.Time{}}
+	d, _ := newFakeDatabase(t, databaseType, driverName, f.handle)
+	d.NameId = nameId
+	// The decision table is the fake one, it needs no schema
+	txAcrossDecisionTableOnce.Store(d, true)
+	t.Cleanup(func() { txAcrossDecisionTableOnce.Delete(d) })
+	return d, f
+}
+
+func (f *fakeTxAcrossDatabase) failOn(fail func(query string) error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.fail = fail
+}
+
+func failOnPrefix(prefix string) func(query string) error {
+	return func(query string) error {
+		if strings.HasPrefix(query, prefix) {
+			return errFakeTxAcross
+		}
+		return nil
+	}
+}
+
+// gidOf returns the global id quoted in the statement
+func gidOf(query string) string {
+	fields := strings.Split(query, "'")
+	if len(fields) < 2 {
+		return ""
+	}
+	return strings.ToLower(fields[1])
+}
+
+func correlationIdArg(s dbtest.DXFakeStatement) string {
+	for _, a := range s.Args {
+		if v, ok := a.Value.(string); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+func (f *fakeTxAcrossDatabase) handle(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	query := strings.ToUpper(strings.TrimSpace(s.Query))
+	if f.fail != nil {
+		if err := f.fail(query); err != nil {
+			return dbtest.DXFakeResult{Err: err}
+		}
+	}
+	isDecisionTable := strings.Contains(query, strings.ToUpper(DXTxAcrossDecisionTableName))
+	switch {
+	case query == dbtest.StatementBegin:
+		f.isInTx = true
+	case query == dbtest.StatementCommit:
+		for _, correlationId := range f.pending {
+			f.decisions[correlationId] = time.Now().UTC()
+		}
+		f.isInTx, f.pending = false, nil
+	case query == dbtest.StatementRollback:
+		f.isInTx, f.pending = false, nil
+	case strings.HasPrefix(query, "PREPARE TRANSACTION"):
+		f.prepared[gidOf(s.Query)] = time.Now().Add(-time.Minute)
+	case strings.HasPrefix(query, "COMMIT PREPARED"), strings.HasPrefix(query, "ROLLBACK PREPARED"):
+		gid := gidOf(s.Query)
+		if _, ok := f.prepared[gid]; !ok {
+			return dbtest.DXFakeResult{Err: errors.New("PREPARED_TRANSACTION_DOES_NOT_EXIST")}
+		}
+		delete(f.prepared, gid)
+		if strings.HasPrefix(query, "COMMIT") {
+			f.committed = append(f.committed, gid)
+		} else {
+			f.rolledBack = append(f.rolledBack, gid)
+		}
+	case strings.Contains(query, "PG_PREPARED_XACTS"):
+		r := dbtest.DXFakeResult{Columns: []string{"gid", "prepared"}}
+		for gid, preparedAt := range f.prepared {
+			r.Rows = append(r.Rows, []any{gid, preparedAt})
+		}
+		return r
+	case isDecisionTable && strings.HasPrefix(query, "INSERT"):
+		correlationId := correlationIdArg(s)
+		if f.isInTx {
+			f.pending = append(f.pending, correlationId)
+		} else {
+			f.decisions[correlationId] = time.Now().UTC()
+		}
+		if s.IsQuery {
+			return dbtest.DXFakeResult{Columns: []string{"id"}, Rows: [][]any{{int64(1)}}}
+		}
+		return dbtest.DXFakeResult{RowsAffected: 1, LastInsertId: 1}
+	case isDecisionTable && strings.HasPrefix(query, "SELECT"):
+		r := dbtest.DXFakeResult{Columns: []string{"correlation_id", "created_at"}}
+		for correlationId, createdAt := range f.decisions {
+			r.Rows = append(r.Rows, []any{correlationId, createdAt})
+		}
+		return r
+	case isDecisionTable && strings.HasPrefix(query, "DELETE"):
+		delete(f.decisions, correlationIdArg(s))
+	}
+	return dbtest.DXFakeResult{RowsAffected: 1}
+}
+
+func (f *fakeTxAcrossDatabase) state() (prepared, committed, rolledBack, decisions int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.prepared), len(f.committed), len(f.rolledBack), len(f.decisions)
+}
+
+// preparedGIds returns the global ids of the transactions still prepared, sorted
+func (f *fakeTxAcrossDatabase) preparedGIds() (r []string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for gid := range f.prepared {
+		r = append(r, gid)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func testTxAcrossLog() *log.DXLog {
+	l := log.NewLog(&log.Log, context.Background(), "test")
+	return &l
+}
+
+func runTxAcross(t *testing.T, dbs ...*DXDatabase) (err error) {
+	t.Helper()
+	return TxAcross(testTxAcrossLog(), LevelDefault, func(txs map[string]*DXDatabaseTx) error {
+		if len(txs) != len(dbs) {
+			t.Fatalf("txs %v", txs)
+		}
+		return nil
+	}, dbs...)
+}
+
+func expectTxAcrossError(t *testing.T, err error, phase string) *DXTxAcrossError {
+	t.Helper()
+	var e *DXTxAcrossError
+	if !errors.As(err, &e) || e.Phase != phase {
+		t.Fatalf("err %v, want the phase %s", err, phase)
+	}
+	return e
+}
+
+func expectState(t *testing.T, nameId string, f *fakeTxAcrossDatabase, prepared, committed, rolledBack, decisions int) {
+	t.Helper()
+	p, c, r, d := f.state()
+	if p != prepared || c != committed || r != rolledBack || d != decisions {
+		t.Fatalf("%s: %d prepared, %d committed, %d rolled back, %d decisions, want %d, %d, %d, %d", nameId, p, c, r, d,
+			prepared, committed, rolledBack, decisions)
+	}
+}
+
+func recoverTxAcross(t *testing.T, dbs ...*DXDatabase) {
+	t.Helper()
+	err := RecoverTxAcross(testTxAcrossLog(), 0, dbs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTxAcrossCommitsAndDeletesItsDecision(t *testing.T) {
+	d0, f0 := newFakeTxAcrossDatabase(t, "pg0", database_type.PostgreSQL, "postgres")
+	d1, f1 := newFakeTxAcrossDatabase(t, "pg1", database_type.PostgreSQL, "postgres")
+	dm, fm := newFakeTxAcrossDatabase(t, "mysql", database_type.MySQL, "mysql")
+	err := runTxAcross(t, d0, dm, d1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectState(t, "pg0", f0, 0, 1, 0, 0)
+	expectState(t, "pg1", f1, 0, 1, 0, 0)
+	expectState(t, "mysql", fm, 0, 0, 0, 0)
+}
+
+// The first prepared one fails to commit while the next one commits, the recovery commits it
+func TestRecoverTxAcrossFirstCommitPreparedFailed(t *testing.T) {
+	d0, f0 := newFakeTxAcrossDatabase(t, "pg0", database_type.PostgreSQL, "postgres")
+	d1, f1 := newFakeTxAcrossDatabase(t, "pg1", database_type.PostgreSQL, "postgres")
+	f0.failOn(failOnPrefix("COMMIT PREPARED"))
+	err := runTxAcross(t, d0, d1)
+	e := expectTxAcrossError(t, err, DXTxAcrossPhaseCommitPrepared)
+	if e.DatabaseNameId != "pg0" || e.IsPartiallyCommitted {
+		t.Fatalf("err %+v", e)
+	}
+	expectState(t, "pg0", f0, 1, 0, 0, 1)
+	expectState(t, "pg1", f1, 0, 1, 0, 0)
+
+	f0.failOn(nil)
+	recoverTxAcross(t, d0, d1)
+	expectState(t, "pg0", f0, 0, 1, 0, 0)
+	expectState(t, "pg1", f1, 0, 1, 0, 0)
+}
+
+// The only prepared one fails to commit after the others committed, the decision committed with the first of the others
+func TestRecoverTxAcrossSinglePreparedAfterTheOthersCommitted(t *testing.T) {
+	dm, fm := newFakeTxAcrossDatabase(t, "mysql", database_type.MySQL, "mysql")
+	d0, f0 := newFakeTxAcrossDatabase(t, "pg0", database_type.PostgreSQL, "postgres")
+	f0.failOn(failOnPrefix("COMMIT PREPARED"))
+	err := runTxAcross(t, dm, d0)
+	e := expectTxAcrossError(t, err, DXTxAcrossPhaseCommitPrepared)
+	if !e.IsPartiallyCommitted {
+		t.Fatalf("err %+v", e)
+	}
+	expectState(t, "mysql", fm, 0, 0, 0, 1)
+	expectState(t, "pg0", f0, 1, 0, 0, 0)
+
+	f0.failOn(nil)
+	recoverTxAcross(t, dm, d0)
+	expectState(t, "mysql", fm, 0, 0, 0, 0)
+	expectState(t, "pg0", f0, 0, 1, 0, 0)
+}
+
+// A prepared one in the middle fails to commit, the ones around it committed
+func TestRecoverTxAcrossMiddleCommitPreparedFailed(t *testing.T) {
+	d0, f0 := newFakeTxAcrossDatabase(t, "pg0", database_type.PostgreSQL, "postgres")
+	d1, f1 := newFakeTxAcrossDatabase(t, "pg1", database_type.PostgreSQL, "postgres")
+	d2, f2 := newFakeTxAcrossDatabase(t, "pg2", database_type.PostgreSQL, "postgres")
+	f1.failOn(failOnPrefix("COMMIT PREPARED"))
+	err := runTxAcross(t, d0, d1, d2)
+	expectTxAcrossError(t, err, DXTxAcrossPhaseCommitPrepared)
+	gids := f1.preparedGIds()
+	if len(gids) != 1 || !strings.HasSuffix(gids[0], "_1_3") {
+		t.Fatalf("prepared %v", gids)
+	}
+
+	f1.failOn(nil)
+	recoverTxAcross(t, d0, d1, d2)
+	expectState(t, "pg0", f0, 0, 1, 0, 0)
+	expectState(t, "pg1", f1, 0, 1, 0, 0)
+	expectState(t, "pg2", f2, 0, 1, 0, 0)
+}
+
+// Every one is prepared and the others committed, then no COMMIT PREPARED went through, the unit is committed
+func TestRecoverTxAcrossAllPreparedOthersCommitted(t *testing.T) {
+	dm, fm := newFakeTxAcrossDatabase(t, "mysql", database_type.MySQL, "mysql")
+	d0, f0 := newFakeTxAcrossDatabase(t, "pg0", database_type.PostgreSQL, "postgres")
+	d1, f1 := newFakeTxAcrossDatabase(t, "pg1", database_type.PostgreSQL, "postgres")
+	f0.failOn(failOnPrefix("COMMIT PREPARED"))
+	f1.failOn(failOnPrefix("COMMIT PREPARED"))
+	err := runTxAcross(t, d0, dm, d1)
+	expectTxAcrossError(t, err, DXTxAcrossPhaseCommitPrepared)
+	expectState(t, "pg0", f0, 1, 0, 0, 0)
+	expectState(t, "pg1", f1, 1, 0, 0, 0)
+
+	f0.failOn(nil)
+	f1.failOn(nil)
+	recoverTxAcross(t, d0, dm, d1)
+	expectState(t, "mysql", fm, 0, 0, 0, 0)
+	expectState(t, "pg0", f0, 0, 1, 0, 0)
+	expectState(t, "pg1", f1, 0, 1, 0, 0)
+}
+
+// The first commit of the others fails, the decision goes with it and the recovery rolls the prepared ones back
+func TestRecoverTxAcrossWithoutDecisionRollsBack(t *testing.T) {
+	dm, fm := newFakeTxAcrossDatabase(t, "mysql", database_type.MySQL, "mysql")
+	d0, f0 := newFakeTxAcrossDatabase(t, "pg0", database_type.PostgreSQL, "postgres")
+	fm.failOn(func(query string) error {
+		if query == dbtest.StatementCommit {
+			return errFakeTxAcross
+		}
+		return nil
+	})
+	// The rollback is cut short, the transaction stays prepared
+	f0.failOn(failOnPrefix("ROLLBACK PREPARED"))
+	err := runTxAcross(t, dm, d0)
+	e := expectTxAcrossError(t, err, DXTxAcrossPhaseCommit)
+	if e.IsPartiallyCommitted {
+		t.Fatalf("err %+v", e)
+	}
+	expectState(t, "mysql", fm, 0, 0, 0, 0)
+	expectState(t, "pg0", f0, 1, 0, 0, 0)
+
+	fm.failOn(nil)
+	f0.failOn(nil)
+	recoverTxAcross(t, dm, d0)
+	expectState(t, "pg0", f0, 0, 0, 1, 0)
+}
+
+// A decision left after all its prepared transactions committed is deleted by the recovery
+func TestRecoverTxAcrossDeletesALeftDecision(t *testing.T) {
+	d0, f0 := newFakeTxAcrossDatabase(t, "pg0", database_type.PostgreSQL, "postgres")
+	d1, f1 := newFakeTxAcrossDatabase(t, "pg1", database_type.PostgreSQL, "postgres")
+	f0.failOn(failOnPrefix("DELETE"))
+	err := runTxAcross(t, d0, d1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectState(t, "pg0", f0, 0, 1, 0, 1)
+
+	f0.failOn(nil)
+	recoverTxAcross(t, d0, d1)
+	expectState(t, "pg0", f0, 0, 1, 0, 0)
+	expectState(t, "pg1", f1, 0, 1, 0, 0)
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/database/protected/dbtx"
+	"github.com/donnyhardyanto/dxlib/utils"
+	json2 "github.com/donnyhardyanto/dxlib/utils/json"
+)
+
+// Upsert inserts keyValues in tableName or, when a row has the values of conflictKeyFields, updates that row with the other
+// fields of keyValues: ON CONFLICT on PostgreSQL, ON DUPLICATE KEY on MySQL, MERGE on SQL Server and Oracle. The conflict
+// fields are those of a primary or unique key, MySQL uses any of its keys whatever conflictKeyFields.
+func (d *DXDatabase) Upsert(tableName string, conflictKeyFields []string, keyValues utils.JSON, opts ...DXDatabaseWriteOption) (r sql.Result, err error) {
+	return d.UpsertContext(context.Background(), tableName, conflictKeyFields, keyValues, opts...)
+}
+
+func (d *DXDatabase) UpsertContext(ctx context.Context, tableName string, conflictKeyFields []string, keyValues utils.JSON, opts ...DXDatabaseWriteOption) (r sql.Result, err error) {
+	pinToPrimary(ctx)
+	if d.AuditHook != nil {
+		err = d.auditTx(ctx, func(dtx *DXDatabaseTx) (err error) {
+			r, err = dtx.Upsert(tableName, conflictKeyFields, keyValues, opts...)
+			return err
+		})
+		return r, err
+	}
+	keyValues, err = d.upsertKeyValues(tableName, conflictKeyFields, keyValues)
+	if err != nil {
+		return nil, err
+	}
+	keyValues, err = d.encryptKeyValues(tableName, keyValues)
+	if err != nil {
+		return nil, err
+	}
+	ctx, release, err := d.acquireContext(ctx, d.Connection)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return db.UpsertContext(ctx, d.Connection, tableName, conflictKeyFields, keyValues)
+}
+
+// upsertKeyValues resolves the tenant of keyValues. The tenant field has to be a conflict field, the row of
+// another tenant would be updated otherwise, and an encrypted conflict field has to be deterministic to ever match.
+func (d *DXDatabase) upsertKeyValues(tableName string, conflictKeyFields []string, keyValues utils.JSON) (r utils.JSON, err error) {
+	if !d.IsTenantSharedTable(tableName) && !slices.Contains(conflictKeyFields, d.TenantFieldName) {
+		return nil, fmt.Errorf("TENANT_FIELD_NOT_IN_CONFLICT_KEY_FIELDS:%s:%s.%s", d.NameId, tableName, d.TenantFieldName)
+	}
+	keyValues, err = d.resolveTenant(tableName, keyValues)
+	if err != nil {
+		return nil, err
+	}
+	fields := d.encryptedFields(tableName)
+	for _, k := range conflictKeyFields {
+		isDeterministic, isEncrypted := fields[k]
+		if isEncrypted && !isDeterministic {
+			return nil, fmt.Errorf("ENCRYPTED_FIELD_CANT_BE_A_CONFLICT_KEY_FIELD:%s.%s:ADD_IT_TO_DETERMINISTIC_ENCRYPTED_FIELDS", tableName, k)
+		}
+	}
+	return keyValues, nil
+}
+
+// Upsert is DXDatabase.Upsert in the transaction, audited as an insert or as an update of the row it found
+func (dtx *DXDatabaseTx) Upsert(tableName string, conflictKeyFields []string, keyValues utils.JSON, opts ...DXDatabaseWriteOption) (r sql.Result, err error) {
+	dtx.pinToPrimary()
+	keyValues = dtx.scoped(keyValues)
+	var before []utils.JSON
+	if dtx.isAudited() {
+		whereKeyValues := utils.JSON{}
+		for _, k := range conflictKeyFields {
+			whereKeyValues[k] = keyValues[k]
+		}
+		before, err = dtx.auditBefore(tableName, whereKeyValues)
+		if err != nil {
+			return nil, err
+		}
+	}
+	keyValues, err = dtx.Database.upsertKeyValues(tableName, conflictKeyFields, keyValues)
+	if err != nil {
+		return nil, err
+	}
+	after := keyValues
+	keyValues, err = dtx.Database.encryptKeyValues(tableName, keyValues)
+	if err != nil {
+		return nil, err
+	}
+	r, err = dbtx.TxUpsert(dtx.Log, false, dtx.Tx, tableName, conflictKeyFields, keyValues)
+	if err != nil || !dtx.isAudited() {
+		return r, err
+	}
+	if len(before) == 0 {
+		return r, dtx.Database.AuditHook(dtx, DXDatabaseAuditOpInsert, tableName, nil, json2.Copy(after), auditMetaOf(opts))
+	}
+	return r, dtx.auditRows(DXDatabaseAuditOpUpdate, tableName, before, after, opts)
+}
+
+func (s *DXDatabaseTenantScope) Upsert(tableName string, conflictKeyFields []string, keyValues utils.JSON, opts ...DXDatabaseWriteOption) (r sql.Result, err error) {
+	return s.Database.Upsert(tableName, conflictKeyFields, s.scoped(keyValues), opts...)
+}
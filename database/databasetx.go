@@ -6,6 +6,7 @@ import (
 	"github.com/donnyhardyanto/dxlib/database/protected/dbtx"
 	"github.com/donnyhardyanto/dxlib/log"
 	"github.com/donnyhardyanto/dxlib/utils"
+	json2 "github.com/donnyhardyanto/dxlib/utils/json"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -27,6 +28,14 @@ const (
 type DXDatabaseTx struct {
 	*sqlx.Tx
 	Log *log.DXLog
+	// Database is the one the transaction runs on, its EncryptedFields apply to the transaction
+	Database *DXDatabase
+	// TenantId scopes the queries of the transaction to a tenant when Database has a TenantFieldName, see DXDatabase.Tenant
+	TenantId string
+}
+
+func (dtx *DXDatabaseTx) scoped(kv utils.JSON) utils.JSON {
+	return dtx.Database.withTenant(dtx.TenantId, kv)
 }
 
 func (dtx *DXDatabaseTx) Commit() (err error) {
@@ -63,28 +72,128 @@ func (dtx *DXDatabaseTx) Finish(log *log.DXLog, err error) {
 
 func (dtx *DXDatabaseTx) Select(tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string, limit any, forUpdatePart any) (rowsInfo *db.RowsInfo, r []utils.JSON, err error) {
-	return dbtx.TxSelect(dtx.Log, nil, false, dtx.Tx, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, limit, forUpdatePart)
+	whereAndFieldNameValues = dtx.scoped(whereAndFieldNameValues)
+	whereAndFieldNameValues, err = dtx.Database.resolveTenant(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	whereAndFieldNameValues, err = dtx.Database.encryptWhereKeyValues(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	rowsInfo, r, err = dbtx.TxSelect(dtx.Log, nil, false, dtx.Tx, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, limit, forUpdatePart)
+	if err != nil {
+		return rowsInfo, r, err
+	}
+	err = dtx.Database.decryptRows(tableName, r...)
+	return rowsInfo, r, err
 }
 
 func (dtx *DXDatabaseTx) SelectOne(tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string, forUpdatePart any) (rowsInfo *db.RowsInfo, r utils.JSON, err error) {
-	return dbtx.TxSelectOne(dtx.Log, nil, false, dtx.Tx, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, forUpdatePart)
+	whereAndFieldNameValues = dtx.scoped(whereAndFieldNameValues)
+	whereAndFieldNameValues, err = dtx.Database.resolveTenant(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	whereAndFieldNameValues, err = dtx.Database.encryptWhereKeyValues(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	rowsInfo, r, err = dbtx.TxSelectOne(dtx.Log, nil, false, dtx.Tx, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, forUpdatePart)
+	if err != nil || r == nil {
+		return rowsInfo, r, err
+	}
+	err = dtx.Database.decryptRows(tableName, r)
+	return rowsInfo, r, err
 }
 
 func (dtx *DXDatabaseTx) ShouldSelectOne(tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string, forUpdatePart any) (rowsInfo *db.RowsInfo, r utils.JSON, err error) {
-	return dbtx.TxShouldSelectOne(dtx.Log, nil, false, dtx.Tx, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, forUpdatePart)
+	whereAndFieldNameValues = dtx.scoped(whereAndFieldNameValues)
+	whereAndFieldNameValues, err = dtx.Database.resolveTenant(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	whereAndFieldNameValues, err = dtx.Database.encryptWhereKeyValues(tableName, whereAndFieldNameValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	rowsInfo, r, err = dbtx.TxShouldSelectOne(dtx.Log, nil, false, dtx.Tx, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, forUpdatePart)
+	if err != nil {
+		return rowsInfo, r, err
+	}
+	err = dtx.Database.decryptRows(tableName, r)
+	return rowsInfo, r, err
 }
-func (dtx *DXDatabaseTx) Insert(tableName string, keyValues utils.JSON) (id int64, err error) {
-	return dbtx.TxInsert(dtx.Log, false, dtx.Tx, tableName, keyValues)
+func (dtx *DXDatabaseTx) Insert(tableName string, keyValues utils.JSON, opts ...DXDatabaseWriteOption) (id int64, err error) {
+	return dtx.insert(tableName, `id`, keyValues, opts)
+}
+
+func (dtx *DXDatabaseTx) insert(tableName string, fieldNameForRowId string, keyValues utils.JSON, opts []DXDatabaseWriteOption) (id int64, err error) {
+	dtx.pinToPrimary()
+	keyValues, err = dtx.Database.resolveTenant(tableName, dtx.scoped(keyValues))
+	if err != nil {
+		return 0, err
+	}
+	after := keyValues
+	keyValues, err = dtx.Database.encryptKeyValues(tableName, keyValues)
+	if err != nil {
+		return 0, err
+	}
+	id, err = dbtx.TxInsertReturning(dtx.Log, false, dtx.Tx, tableName, fieldNameForRowId, keyValues)
+	if err != nil || !dtx.isAudited() {
+		return id, err
+	}
+	after = json2.Copy(after)
+	after[fieldNameForRowId] = id
+	err = dtx.Database.AuditHook(dtx, DXDatabaseAuditOpInsert, tableName, nil, after, auditMetaOf(opts))
+	return id, err
 }
 
 /*func (dtx *DXDatabaseTx) UpdateOne(tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result sql.Result, err error) {
 	return dbtx.TxUpdateOne(dtx.Log, false, dtx.Tx, tableName, setKeyValues, whereKeyValues)
 }*/
 
-func (dtx *DXDatabaseTx) Update(tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result sql.Result, err error) {
-	return dbtx.TxUpdate(dtx.Log, false, dtx.Tx, tableName, setKeyValues, whereKeyValues)
+func (dtx *DXDatabaseTx) Update(tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON, opts ...DXDatabaseWriteOption) (result sql.Result, err error) {
+	return dtx.update(DXDatabaseAuditOpUpdate, tableName, setKeyValues, whereKeyValues, opts)
+}
+
+func (dtx *DXDatabaseTx) update(op string, tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON, opts []DXDatabaseWriteOption) (result sql.Result, err error) {
+	dtx.pinToPrimary()
+	whereKeyValues = dtx.scoped(whereKeyValues)
+	err = dtx.Database.checkTenantNotSet(tableName, setKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	before, err := dtx.auditBefore(tableName, whereKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	after := setKeyValues
+	setKeyValues, err = dtx.Database.encryptKeyValues(tableName, setKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	whereKeyValues, err = dtx.Database.resolveTenant(tableName, whereKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	whereKeyValues, err = dtx.Database.encryptWhereKeyValues(tableName, whereKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	result, err = dbtx.TxUpdate(dtx.Log, false, dtx.Tx, tableName, setKeyValues, whereKeyValues)
+	if err != nil {
+		return result, err
+	}
+	return result, dtx.auditRows(op, tableName, before, after, opts)
+}
+
+func (dtx *DXDatabaseTx) SoftDelete(tableName string, whereKeyValues utils.JSON, opts ...DXDatabaseWriteOption) (result sql.Result, err error) {
+	return dtx.update(DXDatabaseAuditOpSoftDelete, tableName, utils.JSON{
+		`is_deleted`: true,
+	}, whereKeyValues, opts)
 }
 
 /*
@@ -94,6 +203,34 @@ func (dtx *DXDatabaseTx) Update(tableName string, setKeyValues utils.JSON, where
 		}, whereKeyValues)
 	}
 */
-func (dtx *DXDatabaseTx) Delete(tableName string, whereKeyValues utils.JSON) (result sql.Result, err error) {
-	return dbtx.TxDelete(dtx.Log, false, dtx.Tx, tableName, whereKeyValues)
+func (dtx *DXDatabaseTx) Delete(tableName string, whereKeyValues utils.JSON, opts ...DXDatabaseWriteOption) (result sql.Result, err error) {
+	dtx.pinToPrimary()
+	whereKeyValues = dtx.scoped(whereKeyValues)
+	before, err := dtx.auditBefore(tableName, whereKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	whereKeyValues, err = dtx.Database.resolveTenant(tableName, whereKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	whereKeyValues, err = dtx.Database.encryptWhereKeyValues(tableName, whereKeyValues)
+	if err != nil {
+		return nil, err
+	}
+	result, err = dbtx.TxDelete(dtx.Log, false, dtx.Tx, tableName, whereKeyValues)
+	if err != nil {
+		return result, err
+	}
+	return result, dtx.auditRows(DXDatabaseAuditOpDelete, tableName, before, nil, opts)
+}
+
+// DeleteOne is Delete of exactly one row, an ErrNoRows error when none matches and an ErrMultipleRowsAffected one when several
+// were deleted, which the rollback of the transaction restores
+func (dtx *DXDatabaseTx) DeleteOne(tableName string, whereKeyValues utils.JSON, opts ...DXDatabaseWriteOption) (result sql.Result, err error) {
+	result, err = dtx.Delete(tableName, whereKeyValues, opts...)
+	if err != nil {
+		return result, err
+	}
+	return result, db.CheckOneRowAffected(result)
 }
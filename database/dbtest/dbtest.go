@@ -0,0 +1,276 @@
+// Package dbtest opens a *sqlx.DB over a fake database/sql driver, for unit tests of the statements the database helpers
+// generate, without a database server.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Statements of the connections that are not SQL, the handler gets them like any other statement
+const (
+	StatementBegin    = "BEGIN"
+	StatementCommit   = "COMMIT"
+	StatementRollback = "ROLLBACK"
+	StatementPing     = "PING"
+)
+
+type DXFakeStatement struct {
+	Query string
+	Args  []driver.NamedValue
+	// IsQuery is true for a statement run for its rows, false for an exec
+	IsQuery bool
+	// ConnectionId is the connection of the pool running the statement, numbered from 1 in the order they are opened
+	ConnectionId int64
+}
+
+// Arg returns the argument bound to name, a named argument by its name and a positional one by its ordinal as "1", "2"...
+func (s DXFakeStatement) Arg(name string) (v any, ok bool) {
+	for _, a := range s.Args {
+		if strings.EqualFold(a.Name, name) {
+			return a.Value, true
+		}
+	}
+	for _, a := range s.Args {
+		if a.Name == "" && strconv.Itoa(a.Ordinal) == name {
+			return a.Value, true
+		}
+	}
+	return nil, false
+}
+
+// DXFakeResult is the answer of the fake database to a statement, Columns and Rows for a query, RowsAffected and
+// LastInsertId for an exec, a non nil Err fails the statement
+type DXFakeResult struct {
+	Columns []string
+	Rows    [][]any
+	// NextRow, when set, makes the rows one at a time after Rows, until it returns ok false, for the results too large to hold
+	NextRow      func() (row []any, ok bool)
+	RowsAffected int64
+	LastInsertId int64
+	Err          error
+}
+
+// DXFakeHandler answers the statements, it is called concurrently when the connections of the pool are
+type DXFakeHandler func(ctx context.Context, s DXFakeStatement) DXFakeResult
+
+type DXFakeDatabase struct {
+	DB      *sqlx.DB
+	handler DXFakeHandler
+
+	mutex            sync.Mutex
+	statements       []DXFakeStatement
+	lastConnectionId atomic.Int64
+}
+
+// Open returns a fake database of driverName, the name the helpers use to pick the dialect ("postgres", "mysql", "sqlserver"
+// or "oracle"). A nil handler answers every statement with one affected row and no rows.
+func Open(driverName string, handler DXFakeHandler) *DXFakeDatabase {
+	if handler == nil {
+		handler = func(ctx context.Context, s DXFakeStatement) DXFakeResult { return DXFakeResult{RowsAffected: 1} }
+	}
+	f := &DXFakeDatabase{handler: handler}
+	f.DB = sqlx.NewDb(sql.OpenDB(f.Connector()), driverName)
+	return f
+}
+
+// Connector returns the connector of the connections of f, for a pool opened over a connector wrapping it
+func (f *DXFakeDatabase) Connector() driver.Connector {
+	return fakeConnector{database: f}
+}
+
+// Statements returns the statements run so far, in their order
+func (f *DXFakeDatabase) Statements() []DXFakeStatement {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]DXFakeStatement(nil), f.statements...)
+}
+
+// Queries returns the text of the statements run so far, BEGIN, COMMIT and ROLLBACK included
+func (f *DXFakeDatabase) Queries() (queries []string) {
+	for _, s := range f.Statements() {
+		queries = append(queries, s.Query)
+	}
+	return queries
+}
+
+func (f *DXFakeDatabase) Reset() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.statements = nil
+}
+
+func (f *DXFakeDatabase) Close() error {
+	return f.DB.Close()
+}
+
+type fakeConnector struct {
+	database *DXFakeDatabase
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{database: c.database, id: c.database.lastConnectionId.Add(1)}, nil
+}
+func (c fakeConnector) Driver() driver.Driver { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("DBTEST_OPEN_BY_NAME_NOT_SUPPORTED")
+}
+
+type fakeConn struct {
+	database *DXFakeDatabase
+	id       int64
+}
+
+func (c *fakeConn) run(ctx context.Context, query string, args []driver.NamedValue, isQuery bool) DXFakeResult {
+	f := c.database
+	s := DXFakeStatement{Query: query, Args: args, IsQuery: isQuery, ConnectionId: c.id}
+	f.mutex.Lock()
+	f.statements = append(f.statements, s)
+	f.mutex.Unlock()
+	if ctx.Err() != nil {
+		return DXFakeResult{Err: ctx.Err()}
+	}
+	return f.handler(ctx, s)
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, _ driver.TxOptions) (driver.Tx, error) {
+	r := c.run(ctx, StatementBegin, nil, false)
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return fakeTx{conn: c}, nil
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	return c.run(ctx, StatementPing, nil, false).Err
+}
+
+// CheckNamedValue converts the arguments like the default converter, and keeps the ones it can not convert, sql.Out
+// included, for the handler to see
+func (c *fakeConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if _, isOut := nv.Value.(sql.Out); isOut {
+		return nil
+	}
+	v, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err == nil {
+		nv.Value = v
+	}
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r := c.run(ctx, query, args, false)
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return fakeResult{result: r}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r := c.run(ctx, query, args, true)
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return &fakeRows{result: r}, nil
+}
+
+type fakeTx struct {
+	conn *fakeConn
+}
+
+func (tx fakeTx) Commit() error {
+	return tx.conn.run(context.Background(), StatementCommit, nil, false).Err
+}
+
+func (tx fakeTx) Rollback() error {
+	return tx.conn.run(context.Background(), StatementRollback, nil, false).Err
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error                                { return nil }
+func (s *fakeStmt) NumInput() int                               { return -1 }
+func (s *fakeStmt) CheckNamedValue(nv *driver.NamedValue) error { return s.conn.CheckNamedValue(nv) }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *fakeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return nv
+}
+
+type fakeResult struct {
+	result DXFakeResult
+}
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.result.LastInsertId, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.result.RowsAffected, nil }
+
+type fakeRows struct {
+	result DXFakeResult
+	index  int
+}
+
+func (r *fakeRows) Columns() []string { return r.result.Columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	var row []any
+	switch {
+	case r.index < len(r.result.Rows):
+		row = r.result.Rows[r.index]
+		r.index++
+	case r.result.NextRow != nil:
+		var ok bool
+		row, ok = r.result.NextRow()
+		if !ok {
+			return io.EOF
+		}
+	default:
+		return io.EOF
+	}
+	for i, v := range row {
+		dest[i] = v
+	}
+	return nil
+}
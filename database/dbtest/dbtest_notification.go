@@ -0,0 +1,225 @@
+package dbtest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DXFakeNotificationServer speaks enough of the PostgreSQL protocol for the listeners of lib/pq: it accepts any user without a
+// password, answers LISTEN, UNLISTEN and the empty query of the pings, and sends the notifications of Notify to the
+// connections listening on their channel.
+type DXFakeNotificationServer struct {
+	listener    net.Listener
+	mutex       sync.Mutex
+	connections map[*fakeNotificationConn]struct{}
+	// connectionCount counts the connections accepted, the reconnects of the listeners too
+	connectionCount int
+	wg              sync.WaitGroup
+}
+
+type fakeNotificationConn struct {
+	conn     net.Conn
+	mutex    sync.Mutex
+	channels map[string]bool
+}
+
+// OpenNotificationServer starts a DXFakeNotificationServer on a port of the loopback, until Close
+func OpenNotificationServer() (s *DXFakeNotificationServer, err error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s = &DXFakeNotificationServer{listener: l, connections: map[*fakeNotificationConn]struct{}{}}
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// ConnectionString is the lib/pq connection string of s
+func (s *DXFakeNotificationServer) ConnectionString() string {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return "host=" + host + " port=" + port + " user=test dbname=test sslmode=disable"
+}
+
+// Notify sends payload to the connections listening on channel and returns their count
+func (s *DXFakeNotificationServer) Notify(channel string, payload string) (count int) {
+	body := binary.BigEndian.AppendUint32(nil, 1)
+	body = append(append(body, channel...), 0)
+	body = append(append(body, payload...), 0)
+	for _, c := range s.connectionsSnapshot() {
+		c.mutex.Lock()
+		if c.channels[channel] && writeFakeMessage(c.conn, 'A', body) == nil {
+			count++
+		}
+		c.mutex.Unlock()
+	}
+	return count
+}
+
+// ListenerCount is the count of the connections listening on channel
+func (s *DXFakeNotificationServer) ListenerCount(channel string) (count int) {
+	for _, c := range s.connectionsSnapshot() {
+		c.mutex.Lock()
+		if c.channels[channel] {
+			count++
+		}
+		c.mutex.Unlock()
+	}
+	return count
+}
+
+// ConnectionCount is the count of the connections accepted so far
+func (s *DXFakeNotificationServer) ConnectionCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.connectionCount
+}
+
+// DropConnections closes the connections open, like a restart of the server
+func (s *DXFakeNotificationServer) DropConnections() {
+	for _, c := range s.connectionsSnapshot() {
+		_ = c.conn.Close()
+	}
+}
+
+// Close stops s, closes its connections and waits for them
+func (s *DXFakeNotificationServer) Close() error {
+	err := s.listener.Close()
+	s.DropConnections()
+	s.wg.Wait()
+	return err
+}
+
+func (s *DXFakeNotificationServer) connectionsSnapshot() (connections []*fakeNotificationConn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for c := range s.connections {
+		connections = append(connections, c)
+	}
+	return connections
+}
+
+func (s *DXFakeNotificationServer) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := &fakeNotificationConn{conn: conn, channels: map[string]bool{}}
+		s.mutex.Lock()
+		s.connections[c] = struct{}{}
+		s.connectionCount++
+		s.mutex.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			_ = c.serve()
+			_ = conn.Close()
+			s.mutex.Lock()
+			delete(s.connections, c)
+			s.mutex.Unlock()
+		}()
+	}
+}
+
+func (c *fakeNotificationConn) serve() (err error) {
+	r := bufio.NewReader(c.conn)
+	// The startup message has no type, only its length
+	_, err = readFakeMessageBody(r)
+	if err != nil {
+		return err
+	}
+	err = c.write('R', binary.BigEndian.AppendUint32(nil, 0))
+	if err != nil {
+		return err
+	}
+	err = c.write('S', []byte("server_version\x0016.0\x00"))
+	if err != nil {
+		return err
+	}
+	err = c.write('Z', []byte{'I'})
+	if err != nil {
+		return err
+	}
+	for {
+		t, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		body, err := readFakeMessageBody(r)
+		if err != nil {
+			return err
+		}
+		switch t {
+		case 'X':
+			return nil
+		case 'Q':
+			err = c.query(strings.TrimRight(string(body), "\x00"))
+		default:
+			err = errors.New("FAKE_NOTIFICATION_SERVER_UNSUPPORTED_MESSAGE:" + strconv.QuoteRune(rune(t)))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *fakeNotificationConn) query(q string) (err error) {
+	command, channel, _ := strings.Cut(strings.TrimSpace(q), " ")
+	channel = strings.ReplaceAll(strings.Trim(channel, `"`), `""`, `"`)
+	switch strings.ToUpper(command) {
+	case "":
+		err = c.write('I', nil)
+	case "LISTEN", "UNLISTEN":
+		c.mutex.Lock()
+		if strings.EqualFold(command, "LISTEN") {
+			c.channels[channel] = true
+		} else if channel == "*" {
+			c.channels = map[string]bool{}
+		} else {
+			delete(c.channels, channel)
+		}
+		c.mutex.Unlock()
+		err = c.write('C', append([]byte(strings.ToUpper(command)), 0))
+	default:
+		err = c.write('E', []byte("SERROR\x00C0A000\x00Mfake notification server: unsupported statement\x00\x00"))
+	}
+	if err != nil {
+		return err
+	}
+	return c.write('Z', []byte{'I'})
+}
+
+func (c *fakeNotificationConn) write(t byte, body []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return writeFakeMessage(c.conn, t, body)
+}
+
+func writeFakeMessage(w io.Writer, t byte, body []byte) error {
+	b := append([]byte{t}, binary.BigEndian.AppendUint32(nil, uint32(len(body)+4))...)
+	_, err := w.Write(append(b, body...))
+	return err
+}
+
+func readFakeMessageBody(r *bufio.Reader) (body []byte, err error) {
+	var length [4]byte
+	_, err = io.ReadFull(r, length[:])
+	if err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n < 4 {
+		return nil, errors.New("FAKE_NOTIFICATION_SERVER_INVALID_MESSAGE_LENGTH")
+	}
+	body = make([]byte, n-4)
+	_, err = io.ReadFull(r, body)
+	return body, err
+}
@@ -0,0 +1,59 @@
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFakeDatabaseRecordsTheStatementsAndAnswersWithTheHandler(t *testing.T) {
+	errRejected := errors.New("REJECTED")
+	f := Open("postgres", func(ctx context.Context, s DXFakeStatement) DXFakeResult {
+		switch s.Query {
+		case "select id, name from item where id=$1":
+			return DXFakeResult{Columns: []string{"id", "name"}, Rows: [][]any{{int64(1), "a"}}}
+		case "delete from item":
+			return DXFakeResult{Err: errRejected}
+		}
+		return DXFakeResult{RowsAffected: 2}
+	})
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var name string
+	err := f.DB.QueryRow("select id, name from item where id=$1", 1).Scan(new(int64), &name)
+	if err != nil || name != "a" {
+		t.Fatalf("got %q, %v", name, err)
+	}
+	tx, err := f.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := tx.Exec("update item set name=$1", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := r.RowsAffected(); n != 2 {
+		t.Fatalf("rows affected %d", n)
+	}
+	_, err = tx.Exec("delete from item")
+	if !errors.Is(err, errRejected) {
+		t.Fatalf("err %v", err)
+	}
+	_ = tx.Rollback()
+
+	want := []string{"select id, name from item where id=$1", StatementBegin, "update item set name=$1", "delete from item", StatementRollback}
+	got := f.Queries()
+	if len(got) != len(want) {
+		t.Fatalf("queries %q", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("queries %q", got)
+		}
+	}
+	if v, ok := f.Statements()[2].Arg("1"); !ok || v != "b" {
+		t.Fatalf("arg %v, %v", v, ok)
+	}
+}
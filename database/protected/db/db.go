@@ -1,12 +1,15 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/donnyhardyanto/dxlib/database/database_type"
 	databaseProtectedUtils "github.com/donnyhardyanto/dxlib/database/protected/utils"
 	"github.com/donnyhardyanto/dxlib/database/sqlchecker"
 	"github.com/donnyhardyanto/dxlib/utils"
+	utilsSql "github.com/donnyhardyanto/dxlib/utils/security"
 	"github.com/jmoiron/sqlx"
 	"strconv"
 	"strings"
@@ -15,6 +18,8 @@ import (
 type RowsInfo struct {
 	Columns     []string
 	ColumnTypes []*sql.ColumnType
+	// Truncated is true when rows beyond the maximum of a guarded select were dropped, see SelectWithMaxRows
+	Truncated bool
 }
 
 func MergeMapExcludeSQLExpression(m1 utils.JSON, m2 utils.JSON, driverName string) (r utils.JSON) {
@@ -96,22 +101,22 @@ func (se SQLExpression) String() (s string) {
 	return s
 }
 
-func SQLPartFieldNames(fieldNames []string, driverName string) (s string) {
+func SQLPartFieldNames(fieldNames []string, driverName string) (s string, err error) {
 	showFieldNames := ``
 	if fieldNames == nil {
-		return `*`
+		return `*`, nil
 	}
 	for _, v := range fieldNames {
 		if showFieldNames != `` {
 			showFieldNames = showFieldNames + `, `
 		}
-		switch driverName {
-		case "oracle":
-			v = strings.ToUpper(v)
+		v, err = QuoteIdentifierForDB(v, driverName)
+		if err != nil {
+			return ``, err
 		}
 		showFieldNames = showFieldNames + v
 	}
-	return showFieldNames
+	return showFieldNames, nil
 }
 
 // formatIdentifierForDB formats an identifier (column/table name) according to database requirements
@@ -126,67 +131,86 @@ func formatIdentifierForDB(identifier string, driverName string) string {
 	case "mysql":
 		return identifier // MySQL on Windows is case-insensitive, on Unix case-sensitive
 	case "postgres":
-		return identifier // PostgreSQL is case-sensitive
+		return strings.ToLower(identifier) // PostgreSQL folds the unquoted names to lowercase, quoting keeps the case
 	default:
 		return identifier
 	}
 }
 
+// QuoteIdentifierForDB validates an identifier (column/table name), optionally qualified like schema.table, and quotes it for
+// the database part by part. A plain part is folded to the case the database gives to the unquoted names, a part already
+// quoted as "name", `name` or [name] keeps its case. A last part of * is kept unquoted, so table.* can be selected.
+func QuoteIdentifierForDB(identifier string, driverName string) (string, error) {
+	if identifier == "*" {
+		return identifier, nil
+	}
+	parts, err := splitIdentifier(identifier)
+	if err != nil {
+		return "", err
+	}
+	dialect := database_type.StringToDXDatabaseType(driverName)
+	quotedParts := make([]string, len(parts))
+	for i, p := range parts {
+		switch {
+		case p.isQuoted:
+			quotedParts[i] = quoteIdentifierPart(p.name, dialect)
+		case p.name == "*":
+			if i != len(parts)-1 {
+				return "", fmt.Errorf("SQL_IDENTIFIER_INVALID_CHARACTER:%q:%q", identifier, '*')
+			}
+			quotedParts[i] = p.name
+		default:
+			quotedParts[i] = quoteIdentifierPart(formatIdentifierForDB(p.name, driverName), dialect)
+		}
+	}
+	return strings.Join(quotedParts, "."), nil
+}
+
 // SQLPartWhereAndFieldNameValues generates WHERE clause conditions for different database types
-func SQLPartWhereAndFieldNameValues(whereKeyValues utils.JSON, driverName string) string {
+func SQLPartWhereAndFieldNameValues(whereKeyValues utils.JSON, driverName string) (string, error) {
 	if len(whereKeyValues) == 0 {
-		return ""
+		return "", nil
 	}
 
 	var conditions []string
 
 	for k, v := range whereKeyValues {
-		// Format the field name according to database requirements
-		k = formatIdentifierForDB(k, driverName)
-
 		var condition string
+		if se, ok := v.(SQLExpression); ok {
+			// Handle custom SQL expressions, the key is only a label
+			switch driverName {
+			case "oracle", "db2":
+				// Convert the expression to uppercase for case-insensitive databases
+				condition = strings.ToUpper(se.String())
+			default:
+				condition = se.String()
+			}
+			conditions = append(conditions, condition)
+			continue
+		}
+
+		// Quote the field name according to database requirements, the parameter keeps the name of the key
+		field, err := QuoteIdentifierForDB(k, driverName)
+		if err != nil {
+			return "", err
+		}
 		if v == nil {
 			// Handle NULL values according to SQL standard (works in all databases)
-			condition = k + " IS NULL"
+			condition = field + " IS NULL"
 		} else {
-			switch v := v.(type) {
-			case SQLExpression:
-				// Handle custom SQL expressions
-				switch driverName {
-				case "oracle", "db2":
-					// Convert the expression to uppercase for case-insensitive databases
-					condition = strings.ToUpper(v.String())
-				default:
-					condition = v.String()
-				}
+			switch driverName {
+			case "oracle", "db2":
+				// Oracle and DB2 use uppercase parameter names
+				condition = field + "=:" + strings.ToUpper(k)
 			default:
-				// Handle regular equality conditions
-				switch driverName {
-				case "postgres":
-					// PostgreSQL supports case-sensitive parameter names
-					condition = k + "=:" + k
-				case "mysql":
-					// MySQL uses ? for parameters by default, but we're using named parameters
-					condition = k + "=:" + k
-				case "sqlserver":
-					// SQL Server supports both @ and : for parameters
-					condition = k + "=:" + k
-				case "oracle":
-					// Oracle uses : for parameters and uppercase
-					condition = k + "=:" + strings.ToUpper(k)
-				case "db2":
-					// DB2 uses ? for parameters by default, but we're using named parameters
-					condition = k + "=:" + strings.ToUpper(k)
-				default:
-					condition = k + "=:" + k
-				}
+				condition = field + "=:" + k
 			}
 		}
 		conditions = append(conditions, condition)
 	}
 
 	// Join all conditions with AND
-	return strings.Join(conditions, " AND ")
+	return strings.Join(conditions, " AND "), nil
 }
 
 /*func SQLPartWhereAndFieldNameValues(whereKeyValues utils.JSON, driverName string) (s string) {
@@ -235,38 +259,52 @@ func formatOrderByField(field string, direction string, driverName string) (stri
 		return "", err
 	}
 
-	switch driverName {
-	case "oracle", "db2":
-		// Oracle and DB2 conventionally use uppercase
-		return strings.ToUpper(field) + " " + validDirection, nil
-
-	case "sqlserver":
-		// SQL Server supports NULLS LAST/FIRST but needs specific syntax
-		if strings.Contains(strings.ToLower(field), "nulls") {
-			return "", fmt.Errorf("SQL Server doesn't support NULLS FIRST/LAST in ORDER BY directly")
-		}
-		return field + " " + validDirection, nil
+	// A PostgreSQL field may carry its own NULLS FIRST/LAST after the name
+	name, nulls, _ := strings.Cut(strings.TrimSpace(field), " ")
+	nulls = strings.Join(strings.Fields(strings.ToUpper(nulls)), " ")
+	if nulls != "" && nulls != "NULLS FIRST" && nulls != "NULLS LAST" {
+		return "", fmt.Errorf("invalid ORDER BY field: %s", field)
+	}
+	quotedName, err := QuoteIdentifierForDB(name, driverName)
+	if err != nil {
+		return "", err
+	}
 
+	switch driverName {
 	case "postgres":
 		// PostgreSQL supports NULLS LAST/FIRST
 		// Check if the field already contains NULLS specification
-		if strings.Contains(strings.ToLower(field), "nulls") {
-			return field + " " + validDirection, nil
+		if nulls != "" {
+			return quotedName + " " + validDirection + " " + nulls, nil
 		}
 		// Add default NULLS LAST for DESC, NULLS FIRST for ASC
 		nullsPos := "FIRST"
 		if validDirection == "DESC" {
 			nullsPos = "LAST"
 		}
-		return fmt.Sprintf("%s %s NULLS %s", field, validDirection, nullsPos), nil
+		return fmt.Sprintf("%s %s NULLS %s", quotedName, validDirection, nullsPos), nil
 
-	case "mysql":
-		// MySQL handles NULLs differently and doesn't support NULLS FIRST/LAST
-		// NULL values are considered lower than non-NULL values
-		return field + " " + validDirection, nil
+	case "oracle", "db2":
+		// Oracle and DB2 support NULLS LAST/FIRST, without adding a default
+		if nulls != "" {
+			return quotedName + " " + validDirection + " " + nulls, nil
+		}
+		return quotedName + " " + validDirection, nil
+
+	case "sqlserver":
+		// SQL Server supports NULLS LAST/FIRST but needs specific syntax
+		if nulls != "" {
+			return "", fmt.Errorf("SQL Server doesn't support NULLS FIRST/LAST in ORDER BY directly")
+		}
+		return quotedName + " " + validDirection, nil
 
 	default:
-		return field + " " + validDirection, nil
+		// MySQL handles NULLs differently and doesn't support NULLS FIRST/LAST
+		// NULL values are considered lower than non-NULL values
+		if nulls != "" {
+			return "", fmt.Errorf("%s doesn't support NULLS FIRST/LAST in ORDER BY", driverName)
+		}
+		return quotedName + " " + validDirection, nil
 	}
 }
 
@@ -305,7 +343,7 @@ func SQLPartOrderByFieldNameDirections(orderbyKeyValues map[string]string, drive
 		return orderbyFieldNameDirections
 	}
 */
-func SQLPartSetFieldNameValues(setKeyValues utils.JSON, driverName string) (newSetKeyValues utils.JSON, s string) {
+func SQLPartSetFieldNameValues(setKeyValues utils.JSON, driverName string) (newSetKeyValues utils.JSON, s string, err error) {
 	setFieldNameValues := ``
 	newSetKeyValues = utils.JSON{}
 	for k, v := range setKeyValues {
@@ -321,23 +359,31 @@ func SQLPartSetFieldNameValues(setKeyValues utils.JSON, driverName string) (newS
 			case "oracle":
 				k = strings.ToUpper(k)
 			}
-			setFieldNameValues = setFieldNameValues + k + `=:NEW_` + k
+			field, err := QuoteIdentifierForDB(k, driverName)
+			if err != nil {
+				return nil, ``, err
+			}
+			setFieldNameValues = setFieldNameValues + field + `=:NEW_` + k
 			newSetKeyValues[`NEW_`+k] = v
 		}
 	}
-	return newSetKeyValues, setFieldNameValues
+	return newSetKeyValues, setFieldNameValues, nil
 }
 
-func SQLPartInsertFieldNamesFieldValues(insertKeyValues utils.JSON, driverName string) (fieldNames string, fieldValues string) {
+func SQLPartInsertFieldNamesFieldValues(insertKeyValues utils.JSON, driverName string) (fieldNames string, fieldValues string, err error) {
 	for k, v := range insertKeyValues {
 		switch driverName {
 		case "oracle":
 			k = strings.ToUpper(k)
 		}
+		field, err := QuoteIdentifierForDB(k, driverName)
+		if err != nil {
+			return ``, ``, err
+		}
 		if fieldNames != `` {
 			fieldNames = fieldNames + `,`
 		}
-		fieldNames = fieldNames + k
+		fieldNames = fieldNames + field
 		if fieldValues != `` {
 			fieldValues = fieldValues + `,`
 		}
@@ -348,164 +394,76 @@ func SQLPartInsertFieldNamesFieldValues(insertKeyValues utils.JSON, driverName s
 			fieldValues = fieldValues + `:` + k
 		}
 	}
-	return fieldNames, fieldValues
+	return fieldNames, fieldValues, nil
 }
 
+// SQLPartConstructSelect builds a select through the dialect of driverName, limit is normalized by NormalizeLimit and a
+// forUpdatePart of true locks the selected rows
 func SQLPartConstructSelect(driverName string, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string, limit any, forUpdatePart any) (s string, err error) {
-	switch driverName {
-	case "sqlserver":
-		f := SQLPartFieldNames(fieldNames, driverName)
-		w := SQLPartWhereAndFieldNameValues(whereAndFieldNameValues, driverName)
-		effectiveWhere := ``
-		if w != `` {
-			effectiveWhere = ` where ` + w
-		}
-		j := ``
-		if joinSQLPart != nil {
-			j = ` ` + joinSQLPart.(string)
-		}
-		o, err := SQLPartOrderByFieldNameDirections(orderbyFieldNameDirections, driverName)
-		if err != nil {
-			return ``, err
-		}
-		effectiveOrderBy := ``
-		if o != `` {
-			effectiveOrderBy = ` order by ` + o
-		}
-		effectiveLimitAsString := ``
-		if limit != nil {
-			var limitAsInt64 int64
-			switch limit.(type) {
-			case int:
-				limitAsInt64 = int64(limit.(int))
-			case int16:
-				limitAsInt64 = int64(limit.(int16))
-			case int32:
-				limitAsInt64 = int64(limit.(int32))
-			case int64:
-				limitAsInt64 = limit.(int64)
-			default:
-				err := errors.New(`SHOULD_NOT_HAPPEN:CANT_CONVERT_LIMIT_TO_INT64`)
-				return ``, err
-			}
-			if limitAsInt64 > 0 {
-				effectiveLimitAsString = ` top ` + strconv.FormatInt(limitAsInt64, 10)
-			}
-		}
-		u := ``
-		if forUpdatePart == nil {
-			forUpdatePart = false
-		}
-		if forUpdatePart == true {
-			u = ` for update `
-		}
-		s = `select ` + effectiveLimitAsString + ` ` + f + ` from ` + tableName + j + effectiveWhere + effectiveOrderBy + u
-		return s, nil
-	case "postgres":
-		f := SQLPartFieldNames(fieldNames, driverName)
-		w := SQLPartWhereAndFieldNameValues(whereAndFieldNameValues, driverName)
-		effectiveWhere := ``
-		if w != `` {
-			effectiveWhere = ` where ` + w
-		}
-		j := ``
-		if joinSQLPart != nil {
-			j = ` ` + joinSQLPart.(string)
-		}
-		o, err := SQLPartOrderByFieldNameDirections(orderbyFieldNameDirections, driverName)
-		if err != nil {
-			return ``, err
-		}
+	dialect, err := DialectOf(driverName)
+	if err != nil {
+		return ``, err
+	}
+	limitAsInt64, err := NormalizeLimit(limit)
+	if err != nil {
+		return ``, err
+	}
+	isForUpdate := forUpdatePart == true
+	signature := selectSignature(fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, limitAsInt64, isForUpdate)
+	g, err := cachedStatement("select", driverName, tableName, signature, func() (g generatedStatement, err error) {
+		g.s, err = constructSelect(dialect, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, limitAsInt64,
+			isForUpdate)
+		return g, err
+	})
+	return g.s, err
+}
 
-		effectiveOrderBy := ``
-		if o != `` {
-			effectiveOrderBy = ` order by ` + o
-		}
-		effectiveLimitAsString := ``
-		if limit != nil {
-			var limitAsInt64 int64
-			switch limit.(type) {
-			case int:
-				limitAsInt64 = int64(limit.(int))
-			case int16:
-				limitAsInt64 = int64(limit.(int16))
-			case int32:
-				limitAsInt64 = int64(limit.(int32))
-			case int64:
-				limitAsInt64 = limit.(int64)
-			default:
-				err := errors.New(`SHOULD_NOT_HAPPEN:CANT_CONVERT_LIMIT_TO_INT64`)
-				return ``, err
-			}
-			if limitAsInt64 > 0 {
-				effectiveLimitAsString = ` limit ` + strconv.FormatInt(limitAsInt64, 10)
-			}
-		}
-		u := ``
-		if forUpdatePart == nil {
-			forUpdatePart = false
-		}
-		if forUpdatePart == true {
-			u = ` for update `
-		}
-		s = `select ` + f + ` from ` + tableName + j + effectiveWhere + effectiveOrderBy + effectiveLimitAsString + u
-		return s, nil
-	case "oracle":
-		f := SQLPartFieldNames(fieldNames, driverName)
-		w := SQLPartWhereAndFieldNameValues(whereAndFieldNameValues, driverName)
-		effectiveWhere := ``
-		if w != `` {
-			effectiveWhere = ` where ` + w
-		}
-		j := ``
-		if joinSQLPart != nil {
-			j = ` ` + joinSQLPart.(string)
-		}
-		o, err := SQLPartOrderByFieldNameDirections(orderbyFieldNameDirections, driverName)
-		if err != nil {
-			return ``, err
-		}
-		effectiveOrderBy := ``
-		if o != `` {
-			effectiveOrderBy = ` order by ` + o
-		}
-		effectiveLimitAsString := ``
-		if limit != nil {
-			var limitAsInt64 int64
-			switch limit.(type) {
-			case int:
-				limitAsInt64 = int64(limit.(int))
-			case int16:
-				limitAsInt64 = int64(limit.(int16))
-			case int32:
-				limitAsInt64 = int64(limit.(int32))
-			case int64:
-				limitAsInt64 = limit.(int64)
-			default:
-				err := errors.New(`SHOULD_NOT_HAPPEN:CANT_CONVERT_LIMIT_TO_INT64`)
-				return ``, err
-			}
-			if limitAsInt64 > 0 {
-				effectiveLimitAsString = ` FETCH FIRST ` + strconv.FormatInt(limitAsInt64, 10) + ` ROWS ONLY`
-			}
-		}
-		u := ``
-		if forUpdatePart == nil {
-			forUpdatePart = false
-		}
-		if forUpdatePart == true {
-			u = ` for update `
-		}
-		s = `select ` + f + ` from ` + tableName + j + effectiveWhere + effectiveOrderBy + effectiveLimitAsString + u
-		return s, nil
-	default:
-		err := errors.New(`UNKNOWN_DATABASE_TYPE:` + driverName)
+func constructSelect(dialect Dialect, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
+	orderbyFieldNameDirections map[string]string, limit int64, isForUpdate bool) (s string, err error) {
+	driverName := dialect.DatabaseType().Driver()
+	t, err := dialect.QuoteIdentifier(tableName)
+	if err != nil {
+		return ``, err
+	}
+	f, err := SQLPartFieldNames(fieldNames, driverName)
+	if err != nil {
+		return ``, err
+	}
+	w, err := SQLPartWhereAndFieldNameValues(whereAndFieldNameValues, driverName)
+	if err != nil {
+		return ``, err
+	}
+	effectiveWhere := ``
+	if w != `` {
+		effectiveWhere = ` where ` + w
+	}
+	j := ``
+	if joinSQLPart != nil {
+		j = ` ` + joinSQLPart.(string)
+	}
+	o, err := SQLPartOrderByFieldNameDirections(orderbyFieldNameDirections, driverName)
+	if err != nil {
 		return ``, err
 	}
+	effectiveOrderBy := ``
+	if o != `` {
+		effectiveOrderBy = ` order by ` + o
+	}
+	top, limitSuffix := dialect.BuildLimit(limit)
+	tableHint, lockSuffix := dialect.BuildLockClause(isForUpdate)
+	s = `select ` + top + f + ` from ` + t + tableHint + j + effectiveWhere + effectiveOrderBy + limitSuffix + lockSuffix
+	return s, nil
 }
 
 func NamedQueryRow(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, query string, arg any) (rowsInfo *RowsInfo, r utils.JSON, err error) {
+	return NamedQueryRowContext(context.Background(), db, fieldTypeMapping, query, arg)
+}
+
+func NamedQueryRowContext(ctx context.Context, db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, query string, arg any) (rowsInfo *RowsInfo, r utils.JSON, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
 	/*	var argAsArray []any
 		switch arg.(type) {
 		case map[string]any:
@@ -524,7 +482,7 @@ func NamedQueryRow(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTyp
 		rows := xr*/
 	switch db.DriverName() {
 	case "oracle":
-		rowInfo, x, err := _oracleSelectRaw(db, fieldTypeMapping, query, arg)
+		rowInfo, x, err := OracleQueryRowsContext(ctx, db, fieldTypeMapping, query, arg)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -542,7 +500,7 @@ func NamedQueryRow(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTyp
 		return nil, nil, fmt.Errorf("SQL_INJECTION_DETECTED:VALIDATION_FAILED: %w", err)
 	}
 
-	rows, err := db.NamedQuery(query, arg)
+	rows, err := sqlx.NamedQueryContext(ctx, ConnectionOf(ctx, db), query, arg)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -575,27 +533,49 @@ func NamedQueryRow(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTyp
 }
 
 func ShouldNamedQueryRow(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, query string, args any) (rowsInfo *RowsInfo, r utils.JSON, err error) {
-	rowsInfo, r, err = NamedQueryRow(db, fieldTypeMapping, query, args)
+	return ShouldNamedQueryRowContext(context.Background(), db, fieldTypeMapping, query, args)
+}
+
+func ShouldNamedQueryRowContext(ctx context.Context, db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, query string, args any) (rowsInfo *RowsInfo, r utils.JSON, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
+	rowsInfo, r, err = NamedQueryRowContext(ctx, db, fieldTypeMapping, query, args)
 	if err != nil {
 		return rowsInfo, r, err
 	}
 	if r == nil {
-		err = errors.New(`ROW_MUST_EXIST:` + query)
+		err = WrapError(ErrNoRows, "", errors.New(`ROW_MUST_EXIST:`+query))
 		return rowsInfo, r, err
 	}
 	return rowsInfo, r, nil
 }
 
-func OracleInsertReturning(db *sqlx.DB, tableName string, fieldNameForRowId string, keyValues map[string]interface{}) (int64, error) {
-	tableName = strings.ToUpper(tableName)
-	fieldNameForRowId = strings.ToUpper(fieldNameForRowId)
-	returningClause := fmt.Sprintf("RETURNING %s INTO :new_id", fieldNameForRowId)
+// OracleInsertReturning inserts keyValues on db, a *sqlx.DB or a *sqlx.Tx, and returns the fieldNameForRowId of the row
+func OracleInsertReturning(db Preparer, tableName string, fieldNameForRowId string, keyValues map[string]interface{}) (int64, error) {
+	return OracleInsertReturningContext(context.Background(), db, tableName, fieldNameForRowId, keyValues)
+}
 
+func OracleInsertReturningContext(ctx context.Context, db Preparer, tableName string, fieldNameForRowId string, keyValues map[string]interface{}) (int64, error) {
+	tableName, err := QuoteIdentifierForDB(tableName, db.DriverName())
+	if err != nil {
+		return 0, err
+	}
+	fieldNameForRowId, err = QuoteIdentifierForDB(fieldNameForRowId, db.DriverName())
+	if err != nil {
+		return 0, err
+	}
+	for k := range keyValues {
+		err = utilsSql.ValidateIdentifier(k)
+		if err != nil {
+			return 0, err
+		}
+	}
 	fieldNames, fieldValues, fieldArgs := databaseProtectedUtils.PrepareArrayArgs(keyValues, db.DriverName())
 
-	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) %s", tableName, fieldNames, fieldValues, returningClause)
+	query, _ := oracleDialect{}.BuildInsertReturning(tableName, fieldNames, fieldValues, fieldNameForRowId)
 
-	stmt, err := db.Prepare(query)
+	stmt, err := preparerOf(ctx, db).PrepareContext(ctx, query)
 	if err != nil {
 		return 0, err
 	}
@@ -613,7 +593,7 @@ func OracleInsertReturning(db *sqlx.DB, tableName string, fieldNameForRowId stri
 	}
 
 	// Execute the statement
-	_, err = stmt.Exec(fieldArgs...)
+	_, err = stmt.ExecContext(ctx, fieldArgs...)
 	if err != nil {
 		return 0, err
 	}
@@ -621,18 +601,31 @@ func OracleInsertReturning(db *sqlx.DB, tableName string, fieldNameForRowId stri
 	return newId, nil
 }
 
-func OracleDelete(db *sqlx.DB, tableName string, whereAndFieldNameValues utils.JSON) (r sql.Result, err error) {
-	tableName = strings.ToUpper(tableName)
-	whereClause := SQLPartWhereAndFieldNameValues(whereAndFieldNameValues, db.DriverName())
+func OracleDelete(db Preparer, tableName string, whereAndFieldNameValues utils.JSON) (r sql.Result, err error) {
+	return OracleDeleteContext(context.Background(), db, tableName, whereAndFieldNameValues)
+}
+
+func OracleDeleteContext(ctx context.Context, db Preparer, tableName string, whereAndFieldNameValues utils.JSON) (r sql.Result, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
+	tableName, err = QuoteIdentifierForDB(tableName, db.DriverName())
+	if err != nil {
+		return nil, err
+	}
+	whereClause, err := SQLPartWhereAndFieldNameValues(whereAndFieldNameValues, db.DriverName())
+	if err != nil {
+		return nil, err
+	}
 	if whereClause != `` {
 		whereClause = ` WHERE ` + whereClause
 	}
 
-	_, _, fieldArgs := databaseProtectedUtils.PrepareArrayArgs(whereAndFieldNameValues, db.DriverName())
+	fieldArgs := OracleWhereArgs(whereAndFieldNameValues)
 
 	query := fmt.Sprintf("DELETE FROM %s %s", tableName, whereClause)
 
-	stmt, err := db.Prepare(query)
+	stmt, err := preparerOf(ctx, db).PrepareContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -646,20 +639,36 @@ func OracleDelete(db *sqlx.DB, tableName string, whereAndFieldNameValues utils.J
 	}
 
 	// Execute the statement
-	r, err = stmt.Exec(fieldArgs...)
+	r, err = stmt.ExecContext(ctx, fieldArgs...)
 	if err != nil {
 		return nil, err
 	}
 	return r, nil
 }
 
-func OracleEdit(db *sqlx.DB, tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result sql.Result, err error) {
-	tableName = strings.ToUpper(tableName)
-	setKeyValues, setFieldNameValues := SQLPartSetFieldNameValues(setKeyValues, db.DriverName())
-	whereClause := SQLPartWhereAndFieldNameValues(whereKeyValues, db.DriverName())
+func OracleEdit(db Preparer, tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result sql.Result, err error) {
+	return OracleEditContext(context.Background(), db, tableName, setKeyValues, whereKeyValues)
+}
+
+func OracleEditContext(ctx context.Context, db Preparer, tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result sql.Result, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
+	tableName, err = QuoteIdentifierForDB(tableName, db.DriverName())
+	if err != nil {
+		return nil, err
+	}
+	setKeyValues, setFieldNameValues, err := SQLPartSetFieldNameValues(setKeyValues, db.DriverName())
+	if err != nil {
+		return nil, err
+	}
+	whereClause, err := SQLPartWhereAndFieldNameValues(whereKeyValues, db.DriverName())
+	if err != nil {
+		return nil, err
+	}
 
 	_, _, setFieldArgs := databaseProtectedUtils.PrepareArrayArgs(setKeyValues, db.DriverName())
-	_, _, setWhereFieldArgs := databaseProtectedUtils.PrepareArrayArgs(whereKeyValues, db.DriverName())
+	setWhereFieldArgs := OracleWhereArgs(whereKeyValues)
 
 	if whereClause != "" {
 		whereClause = ` WHERE ` + whereClause
@@ -671,7 +680,7 @@ func OracleEdit(db *sqlx.DB, tableName string, setKeyValues utils.JSON, whereKey
 
 	query := fmt.Sprintf("UPDATE "+tableName+" SET %s %s", setFieldNameValues, whereClause)
 
-	stmt, err := db.Prepare(query)
+	stmt, err := preparerOf(ctx, db).PrepareContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -685,15 +694,23 @@ func OracleEdit(db *sqlx.DB, tableName string, setKeyValues utils.JSON, whereKey
 	}
 
 	// Execute the statement
-	result, err = stmt.Exec(setFieldArgs...)
+	result, err = stmt.ExecContext(ctx, setFieldArgs...)
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-func _oracleSelectRaw(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, query string, fieldArgs ...any) (rowsInfo *RowsInfo, r []utils.JSON, err error) {
-	stmt, err := db.Prepare(query)
+// OracleQueryRows executes query on db with the positional or sql.Named fieldArgs
+func OracleQueryRows(db Preparer, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, query string, fieldArgs ...any) (rowsInfo *RowsInfo, r []utils.JSON, err error) {
+	return OracleQueryRowsContext(context.Background(), db, fieldTypeMapping, query, fieldArgs...)
+}
+
+func OracleQueryRowsContext(ctx context.Context, db Preparer, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, query string, fieldArgs ...any) (rowsInfo *RowsInfo, r []utils.JSON, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
+	stmt, err := preparerOf(ctx, db).PrepareContext(ctx, query)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -707,7 +724,7 @@ func _oracleSelectRaw(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.Field
 	}
 
 	// Execute the statement
-	arows, err := stmt.Query(fieldArgs...)
+	arows, err := stmt.QueryContext(ctx, fieldArgs...)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -743,11 +760,19 @@ func _oracleSelectRaw(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.Field
 func OracleSelect(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string) (rowsInfo *RowsInfo, r []utils.JSON, err error) {
 
-	tableName = strings.ToUpper(tableName)
-	tableName = strings.ToUpper(tableName)
-	fieldNamesStr := SQLPartFieldNames(fieldNames, db.DriverName())
+	tableName, err = QuoteIdentifierForDB(tableName, db.DriverName())
+	if err != nil {
+		return nil, nil, err
+	}
+	fieldNamesStr, err := SQLPartFieldNames(fieldNames, db.DriverName())
+	if err != nil {
+		return nil, nil, err
+	}
 
-	whereClause := SQLPartWhereAndFieldNameValues(whereAndFieldNameValues, db.DriverName())
+	whereClause, err := SQLPartWhereAndFieldNameValues(whereAndFieldNameValues, db.DriverName())
+	if err != nil {
+		return nil, nil, err
+	}
 	if whereClause != `` {
 		whereClause = ` WHERE ` + whereClause
 	}
@@ -766,7 +791,7 @@ func OracleSelect(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldType
 
 	query := fmt.Sprintf("SELECT %s from %s %s %s %s", fieldNamesStr, tableName, whereClause, orderByClause, limitClause)
 
-	return _oracleSelectRaw(db, fieldTypeMapping, query, fieldArgs)
+	return OracleQueryRows(db, fieldTypeMapping, query, fieldArgs...)
 	/*stmt, err := db.Prepare(query)
 	if err != nil {
 		return nil, nil, err
@@ -805,13 +830,17 @@ func OracleSelect(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldType
 }
 
 func ShouldNamedQueryId(db *sqlx.DB, query string, arg any) (int64, error) {
+	return ShouldNamedQueryIdContext(context.Background(), db, query, arg)
+}
+
+func ShouldNamedQueryIdContext(ctx context.Context, db *sqlx.DB, query string, arg any) (int64, error) {
 
 	err := sqlchecker.CheckAll(db.DriverName(), query, arg)
 	if err != nil {
 		return 0, fmt.Errorf("SQL_INJECTION_DETECTED:QUERY_VALIDATION_FAILED: %w", err)
 	}
 
-	rows, err := db.NamedQuery(query, arg)
+	rows, err := sqlx.NamedQueryContext(ctx, ConnectionOf(ctx, db), query, arg)
 	if err != nil {
 		return 0, err
 	}
@@ -835,6 +864,13 @@ func ShouldNamedQueryId(db *sqlx.DB, query string, arg any) (int64, error) {
 }
 
 func NamedQueryRows(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, query string, arg any) (rowsInfo *RowsInfo, r []utils.JSON, err error) {
+	return NamedQueryRowsContext(context.Background(), db, fieldTypeMapping, query, arg)
+}
+
+func NamedQueryRowsContext(ctx context.Context, db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, query string, arg any) (rowsInfo *RowsInfo, r []utils.JSON, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
 	r = []utils.JSON{}
 	if arg == nil {
 		arg = utils.JSON{}
@@ -845,7 +881,7 @@ func NamedQueryRows(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTy
 		return nil, r, fmt.Errorf("SQL_INJECTION_DETECTED:QUERY_VALIDATION_FAILED: %w", err)
 	}
 
-	rows, err := db.NamedQuery(query, arg)
+	rows, err := sqlx.NamedQueryContext(ctx, ConnectionOf(ctx, db), query, arg)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -877,6 +913,9 @@ func NamedQueryRows(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTy
 }
 
 func QueryRows(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, query string, arg any) (rowsInfo *RowsInfo, r []utils.JSON, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
 
 	err = sqlchecker.CheckAll(db.DriverName(), query, arg)
 	if err != nil {
@@ -954,6 +993,14 @@ func buildCountQuery(dbType string, summaryCalcFieldsPart, fromQueryPart, whereQ
 // ShouldCountQuery executes the count query and returns the total rows and summary
 func ShouldCountQuery(dbAppInstance *sqlx.DB, summaryCalcFieldsPart, fromQueryPart, whereQueryPart, joinQueryPart string,
 	arg any) (totalRows int64, summaryRows utils.JSON, err error) {
+	return ShouldCountQueryContext(context.Background(), dbAppInstance, summaryCalcFieldsPart, fromQueryPart, whereQueryPart, joinQueryPart, arg)
+}
+
+func ShouldCountQueryContext(ctx context.Context, dbAppInstance *sqlx.DB, summaryCalcFieldsPart, fromQueryPart, whereQueryPart, joinQueryPart string,
+	arg any) (totalRows int64, summaryRows utils.JSON, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
 
 	driverName := dbAppInstance.DriverName()
 	countSQL, err := buildCountQuery(driverName, summaryCalcFieldsPart, fromQueryPart, whereQueryPart, joinQueryPart)
@@ -961,7 +1008,7 @@ func ShouldCountQuery(dbAppInstance *sqlx.DB, summaryCalcFieldsPart, fromQueryPa
 		return 0, nil, err
 	}
 
-	_, summaryRows, err = ShouldNamedQueryRow(dbAppInstance, nil, countSQL, arg)
+	_, summaryRows, err = ShouldNamedQueryRowContext(ctx, dbAppInstance, nil, countSQL, arg)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -988,9 +1035,20 @@ func ShouldCountQuery(dbAppInstance *sqlx.DB, summaryCalcFieldsPart, fromQueryPa
 func NamedQueryPaging(dbAppInstance *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, summaryCalcFieldsPart string, rowsPerPage int64, pageIndex int64,
 	returnFieldsQueryPart string, fromQueryPart string, whereQueryPart string, joinQueryPart string, orderByQueryPart string,
 	arg any) (rowsInfo *RowsInfo, rows []utils.JSON, totalRows int64, totalPage int64, summaryRows utils.JSON, err error) {
+	return NamedQueryPagingContext(context.Background(), dbAppInstance, fieldTypeMapping, summaryCalcFieldsPart, rowsPerPage, pageIndex,
+		returnFieldsQueryPart, fromQueryPart, whereQueryPart, joinQueryPart, orderByQueryPart, arg)
+}
+
+// NamedQueryPagingContext is NamedQueryPaging, the count and the page are cancelled when ctx ends
+func NamedQueryPagingContext(ctx context.Context, dbAppInstance *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, summaryCalcFieldsPart string,
+	rowsPerPage int64, pageIndex int64, returnFieldsQueryPart string, fromQueryPart string, whereQueryPart string, joinQueryPart string, orderByQueryPart string,
+	arg any) (rowsInfo *RowsInfo, rows []utils.JSON, totalRows int64, totalPage int64, summaryRows utils.JSON, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
 
 	// Execute count query
-	totalRows, summaryRows, err = ShouldCountQuery(dbAppInstance, summaryCalcFieldsPart, fromQueryPart, whereQueryPart, joinQueryPart, arg)
+	totalRows, summaryRows, err = ShouldCountQueryContext(ctx, dbAppInstance, summaryCalcFieldsPart, fromQueryPart, whereQueryPart, joinQueryPart, arg)
 	if err != nil {
 		return nil, nil, 0, 0, nil, err
 	}
@@ -1067,7 +1125,7 @@ func NamedQueryPaging(dbAppInstance *sqlx.DB, fieldTypeMapping databaseProtected
 		return rowsInfo, rows, 0, 0, summaryRows, errors.New("UNSUPPORTED_DATABASE_SQL_SELECT")
 	}
 
-	rowsInfo, rows, err = NamedQueryRows(dbAppInstance, fieldTypeMapping, query, arg)
+	rowsInfo, rows, err = NamedQueryRowsContext(ctx, dbAppInstance, fieldTypeMapping, query, arg)
 	if err != nil {
 		return rowsInfo, rows, 0, 0, summaryRows, err
 	}
@@ -1079,6 +1137,9 @@ func NamedQueryPaging(dbAppInstance *sqlx.DB, fieldTypeMapping databaseProtected
 func NamedQueryList(dbAppInstance *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping,
 	returnFieldsQueryPart string, fromQueryPart string, whereQueryPart string, joinQueryPart string, orderByQueryPart string,
 	arg any) (rowsInfo *RowsInfo, rows []utils.JSON, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
 
 	if returnFieldsQueryPart == "" {
 		returnFieldsQueryPart = "*"
@@ -1268,6 +1329,9 @@ func NamedQueryPaging(dbAppInstance *sqlx.DB, summaryCalcFieldsPart string, rows
 
 func QueryPaging(dbAppInstance *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, rowsPerPage int64, pageIndex int64, returnFieldsQueryPart string, fromQueryPart string, whereQueryPart string, joinQueryPart string, orderByQueryPart string,
 	arg any) (rowsInfo *RowsInfo, rows []utils.JSON, totalRows int64, totalPage int64, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
 	if returnFieldsQueryPart == `` {
 		returnFieldsQueryPart = `*`
 	}
@@ -1309,7 +1373,18 @@ func QueryPaging(dbAppInstance *sqlx.DB, fieldTypeMapping databaseProtectedUtils
 }
 
 func ShouldSelectWhereId(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, tableName string, idValue int64) (rowsInfo *RowsInfo, r utils.JSON, err error) {
-	rowsInfo, r, err = ShouldNamedQueryRow(db, fieldTypeMapping, `SELECT * FROM `+tableName+` where `+databaseProtectedUtils.FormatIdentifier(`id`, db.DriverName())+`=:id`, utils.JSON{
+	defer func() {
+		err = ClassifyError(err)
+	}()
+	t, err := QuoteIdentifierForDB(tableName, db.DriverName())
+	if err != nil {
+		return nil, nil, err
+	}
+	idField, err := QuoteIdentifierForDB(`id`, db.DriverName())
+	if err != nil {
+		return nil, nil, err
+	}
+	rowsInfo, r, err = ShouldNamedQueryRow(db, fieldTypeMapping, `SELECT * FROM `+t+` where `+idField+`=:id`, utils.JSON{
 		`id`: idValue,
 	})
 	return rowsInfo, r, err
@@ -1317,41 +1392,58 @@ func ShouldSelectWhereId(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.Fi
 
 func SelectOne(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string) (rowsInfo *RowsInfo, r utils.JSON, err error) {
-	driverName := db.DriverName()
-	switch driverName {
-	case "oracle":
-		rowsInfo, rx, err := OracleSelect(db, fieldTypeMapping, tableName,
-			fieldNames, whereAndFieldNameValues,
-			joinSQLPart,
-			orderbyFieldNameDirections)
-		if err != nil {
-			return rowsInfo, nil, err
-		}
-		if rx == nil {
-			return rowsInfo, nil, err
-		}
-		if len(rx) < 1 {
-			return rowsInfo, nil, err
+	return SelectOneContext(context.Background(), db, fieldTypeMapping, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections)
+}
+
+func SelectOneContext(ctx context.Context, db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
+	orderbyFieldNameDirections map[string]string) (rowsInfo *RowsInfo, r utils.JSON, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
+	span := startQuerySpan(ctx, db, "select", tableName)
+	defer func() {
+		rowCount := 0
+		if r != nil {
+			rowCount = 1
 		}
-		return rowsInfo, rx[0], err
-	}
+		span.EndWithRows(rowCount, err)
+	}()
+	driverName := db.DriverName()
 	s, err := SQLPartConstructSelect(driverName, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, 1, nil)
 	if err != nil {
 		return nil, nil, err
 	}
+	span.SetStatement(s)
+	if driverName == "oracle" {
+		span.SetArguments(whereAndFieldNameValues)
+		rowsInfo, rx, err := OracleQueryRowsContext(ctx, db, fieldTypeMapping, s, OracleWhereArgs(whereAndFieldNameValues)...)
+		if err != nil || len(rx) < 1 {
+			return rowsInfo, nil, err
+		}
+		return rowsInfo, rx[0], nil
+	}
 	wKV := ExcludeSQLExpression(whereAndFieldNameValues, driverName)
-	rowsInfo, r, err = NamedQueryRow(db, fieldTypeMapping, s, wKV)
+	span.SetArguments(wKV)
+	rowsInfo, r, err = NamedQueryRowContext(ctx, db, fieldTypeMapping, s, wKV)
 	return rowsInfo, r, err
 }
 
 func ShouldSelectOne(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string) (rowsInfo *RowsInfo, r utils.JSON, err error) {
-	rowsInfo, r, err = SelectOne(db, fieldTypeMapping, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections)
+	return ShouldSelectOneContext(context.Background(), db, fieldTypeMapping, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections)
+}
+
+func ShouldSelectOneContext(ctx context.Context, db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
+	orderbyFieldNameDirections map[string]string) (rowsInfo *RowsInfo, r utils.JSON, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
+	rowsInfo, r, err = SelectOneContext(ctx, db, fieldTypeMapping, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections)
 	if err != nil {
 		return rowsInfo, r, err
 	}
 	if r == nil {
-		err = errors.New("ROW_MUST_EXIST:" + tableName)
+		err = WrapError(ErrNoRows, "", errors.New("ROW_MUST_EXIST:"+tableName))
 		return rowsInfo, nil, err
 	}
 	return rowsInfo, r, nil
@@ -1359,33 +1451,55 @@ func ShouldSelectOne(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldT
 
 func Select(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any, orderbyFieldNameDirections map[string]string,
 	limit any) (rowsInfo *RowsInfo, r []utils.JSON, err error) {
+	return SelectContext(context.Background(), db, fieldTypeMapping, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, limit)
+}
+
+func SelectContext(ctx context.Context, db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any, orderbyFieldNameDirections map[string]string,
+	limit any) (rowsInfo *RowsInfo, r []utils.JSON, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
+	span := startQuerySpan(ctx, db, "select", tableName)
+	defer func() {
+		span.EndWithRows(len(r), err)
+	}()
 	driverName := db.DriverName()
-	switch driverName {
-	case "oracle":
-		rowsInfo, r, err := OracleSelect(db, fieldTypeMapping, tableName,
-			fieldNames, whereAndFieldNameValues,
-			joinSQLPart,
-			orderbyFieldNameDirections)
-		return rowsInfo, r, err
-	}
 	s, err := SQLPartConstructSelect(driverName, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, limit, nil)
 	if err != nil {
 		return nil, nil, err
 	}
+	span.SetStatement(s)
+	if driverName == "oracle" {
+		span.SetArguments(whereAndFieldNameValues)
+		rowsInfo, r, err = OracleQueryRowsContext(ctx, db, fieldTypeMapping, s, OracleWhereArgs(whereAndFieldNameValues)...)
+		return rowsInfo, r, err
+	}
 	wKV := ExcludeSQLExpression(whereAndFieldNameValues, driverName)
-	rowsInfo, r, err = NamedQueryRows(db, fieldTypeMapping, s, wKV)
+	span.SetArguments(wKV)
+	rowsInfo, r, err = NamedQueryRowsContext(ctx, db, fieldTypeMapping, s, wKV)
 	return rowsInfo, r, err
 }
 
 // SelectCount performs a count query with optional field summaries for multiple database types
 func SelectCount(db *sqlx.DB, tableName string, summaryCalcFieldsPart string, whereAndFieldNameValues utils.JSON,
 	joinSQLPart any) (totalRows int64, summaryRows utils.JSON, err error) {
+	return SelectCountContext(context.Background(), db, tableName, summaryCalcFieldsPart, whereAndFieldNameValues, joinSQLPart)
+}
+
+func SelectCountContext(ctx context.Context, db *sqlx.DB, tableName string, summaryCalcFieldsPart string, whereAndFieldNameValues utils.JSON,
+	joinSQLPart any) (totalRows int64, summaryRows utils.JSON, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
+	span := startQuerySpan(ctx, db, "count", tableName)
+	defer func() {
+		span.End(err)
+	}()
 
 	driverName := db.DriverName()
 
 	// Handle Oracle's uppercase requirement
 	if driverName == "oracle" {
-		tableName = strings.ToUpper(tableName)
 		if summaryCalcFieldsPart != "" {
 			// Split by comma and handle each field
 			fields := strings.Split(summaryCalcFieldsPart, ",")
@@ -1396,8 +1510,16 @@ func SelectCount(db *sqlx.DB, tableName string, summaryCalcFieldsPart string, wh
 		}
 	}
 
+	tableName, err = QuoteIdentifierForDB(tableName, driverName)
+	if err != nil {
+		return 0, nil, err
+	}
+
 	// Prepare where clause
-	whereClause := SQLPartWhereAndFieldNameValues(whereAndFieldNameValues, driverName)
+	whereClause, err := SQLPartWhereAndFieldNameValues(whereAndFieldNameValues, driverName)
+	if err != nil {
+		return 0, nil, err
+	}
 
 	// Prepare join clause
 	joinClause := ""
@@ -1407,11 +1529,13 @@ func SelectCount(db *sqlx.DB, tableName string, summaryCalcFieldsPart string, wh
 
 	// Process arguments based on database type
 	args := ExcludeSQLExpression(whereAndFieldNameValues, driverName)
+	span.SetArguments(args)
 
 	// Special handling for different databases
 	switch driverName {
 	case "sqlserver", "postgres", "oracle", "mysql", "db2":
-		totalRows, summaryRows, err = ShouldCountQuery(
+		totalRows, summaryRows, err = ShouldCountQueryContext(
+			ctx,
 			db,
 			summaryCalcFieldsPart,
 			tableName,
@@ -1474,8 +1598,13 @@ func CountSelectOne(db *sqlx.DB, tableName string, summaryCalcFieldsPart string,
 // ShouldSelectCount performs a count query and ensures at least one row exists
 func ShouldSelectCount(db *sqlx.DB, tableName string, summaryCalcFieldsPart string, whereAndFieldNameValues utils.JSON,
 	joinSQLPart any) (totalRows int64, summaryRows utils.JSON, err error) {
+	return ShouldSelectCountContext(context.Background(), db, tableName, summaryCalcFieldsPart, whereAndFieldNameValues, joinSQLPart)
+}
 
-	totalRows, summaryRows, err = SelectCount(db, tableName, summaryCalcFieldsPart, whereAndFieldNameValues, joinSQLPart)
+func ShouldSelectCountContext(ctx context.Context, db *sqlx.DB, tableName string, summaryCalcFieldsPart string, whereAndFieldNameValues utils.JSON,
+	joinSQLPart any) (totalRows int64, summaryRows utils.JSON, err error) {
+
+	totalRows, summaryRows, err = SelectCountContext(ctx, db, tableName, summaryCalcFieldsPart, whereAndFieldNameValues, joinSQLPart)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -1488,14 +1617,32 @@ func ShouldSelectCount(db *sqlx.DB, tableName string, summaryCalcFieldsPart stri
 }
 
 func Delete(db *sqlx.DB, tableName string, whereAndFieldNameValues utils.JSON) (r sql.Result, err error) {
+	return DeleteContext(context.Background(), db, tableName, whereAndFieldNameValues)
+}
+
+func DeleteContext(ctx context.Context, db *sqlx.DB, tableName string, whereAndFieldNameValues utils.JSON) (r sql.Result, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
+	span := startQuerySpan(ctx, db, "delete", tableName)
+	defer func() {
+		span.EndWithRowsAffected(RowsAffected(r), err)
+	}()
 	driverName := db.DriverName()
 	switch driverName {
 	case "oracle":
-		r, err = OracleDelete(db, tableName, whereAndFieldNameValues)
+		r, err = OracleDeleteContext(ctx, db, tableName, whereAndFieldNameValues)
 		return r, err
 	}
-	w := SQLPartWhereAndFieldNameValues(whereAndFieldNameValues, driverName)
-	s := `DELETE FROM ` + tableName + ` where ` + w
+	t, err := QuoteIdentifierForDB(tableName, driverName)
+	if err != nil {
+		return nil, err
+	}
+	w, err := SQLPartWhereAndFieldNameValues(whereAndFieldNameValues, driverName)
+	if err != nil {
+		return nil, err
+	}
+	s := `DELETE FROM ` + t + ` where ` + w
 	wKV := ExcludeSQLExpression(whereAndFieldNameValues, driverName)
 
 	err = sqlchecker.CheckAll(db.DriverName(), s, wKV)
@@ -1503,52 +1650,105 @@ func Delete(db *sqlx.DB, tableName string, whereAndFieldNameValues utils.JSON) (
 		return nil, fmt.Errorf("SQL_INJECTION_DETECTED:VALIDATION_FAILED: %w", err)
 	}
 
-	r, err = db.NamedExec(s, wKV)
+	span.SetStatement(s)
+	span.SetArguments(wKV)
+	r, err = sqlx.NamedExecContext(ctx, ConnectionOf(ctx, db), s, wKV)
 	return r, err
 }
 
+// Update sets the fields of setKeyValues, a nil value sets its field to NULL and a field absent from setKeyValues is left
+// unchanged
 func Update(db *sqlx.DB, tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result sql.Result, err error) {
+	return UpdateContext(context.Background(), db, tableName, setKeyValues, whereKeyValues)
+}
+
+func UpdateContext(ctx context.Context, db *sqlx.DB, tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result sql.Result, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
+	span := startQuerySpan(ctx, db, "update", tableName)
+	defer func() {
+		span.EndWithRowsAffected(RowsAffected(result), err)
+	}()
 	driverName := db.DriverName()
 	switch driverName {
 	case "oracle":
-		result, err = OracleEdit(db, tableName, setKeyValues, whereKeyValues)
+		result, err = OracleEditContext(ctx, db, tableName, setKeyValues, whereKeyValues)
 		return result, err
 	}
-	setKeyValues, u := SQLPartSetFieldNameValues(setKeyValues, driverName)
-	w := SQLPartWhereAndFieldNameValues(whereKeyValues, driverName)
+	t, err := QuoteIdentifierForDB(tableName, driverName)
+	if err != nil {
+		return nil, err
+	}
+	setKeyValues, u, err := SQLPartSetFieldNameValues(setKeyValues, driverName)
+	if err != nil {
+		return nil, err
+	}
+	w, err := SQLPartWhereAndFieldNameValues(whereKeyValues, driverName)
+	if err != nil {
+		return nil, err
+	}
 	joinedKeyValues := MergeMapExcludeSQLExpression(setKeyValues, whereKeyValues, driverName)
-	s := `update ` + tableName + ` set ` + u + ` where ` + w
+	s := `update ` + t + ` set ` + u + ` where ` + w
 
 	err = sqlchecker.CheckAll(db.DriverName(), s, joinedKeyValues)
 	if err != nil {
 		return nil, fmt.Errorf("SQL_INJECTION_DETECTED:VALIDATION_FAILED: %w", err)
 	}
 
-	result, err = db.NamedExec(s, joinedKeyValues)
+	span.SetStatement(s)
+	span.SetArguments(joinedKeyValues)
+	result, err = sqlx.NamedExecContext(ctx, ConnectionOf(ctx, db), s, joinedKeyValues)
 	return result, err
 }
 
 func Insert(db *sqlx.DB, tableName string, fieldNameForRowId string, keyValues utils.JSON) (id int64, err error) {
-	s := ``
+	return InsertContext(context.Background(), db, tableName, fieldNameForRowId, keyValues)
+}
+
+func InsertContext(ctx context.Context, db *sqlx.DB, tableName string, fieldNameForRowId string, keyValues utils.JSON) (id int64, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
+	span := startQuerySpan(ctx, db, "insert", tableName)
+	defer func() {
+		span.EndWithRowsAffected(1, err)
+	}()
 	driverName := db.DriverName()
-	switch driverName {
-	case "postgres":
-		fn, fv := SQLPartInsertFieldNamesFieldValues(keyValues, driverName)
-		s = `INSERT INTO ` + tableName + ` (` + fn + `) VALUES (` + fv + `) RETURNING ` + fieldNameForRowId
-	case "sqlserver":
-		fn, fv := SQLPartInsertFieldNamesFieldValues(keyValues, driverName)
-		s = `INSERT INTO ` + tableName + ` (` + fn + `) OUTPUT INSERTED.` + fieldNameForRowId + ` VALUES (` + fv + `)`
-	case "oracle":
-		id, err = OracleInsertReturning(db, tableName, fieldNameForRowId, keyValues)
-		if err != nil {
-			return 0, err
-		}
-		return id, nil
-	default:
-		err = errors.New(`UNSUPPORTED_DATABASE_SQL_INSERT`)
+	dialect, err := DialectOf(driverName)
+	if err != nil {
+		return 0, err
+	}
+	if dialect.DatabaseType() == database_type.Oracle {
+		return OracleInsertReturningContext(ctx, db, tableName, fieldNameForRowId, keyValues)
+	}
+	s, mode, err := CachedInsertStatement(dialect, tableName, fieldNameForRowId, keyValues)
+	if err != nil {
 		return 0, err
 	}
+	span.SetStatement(s)
 	kv := ExcludeSQLExpression(keyValues, driverName)
-	id, err = ShouldNamedQueryId(db, s, kv)
+	span.SetArguments(kv)
+	if mode == InsertReturningByLastInsertId {
+		return NamedExecLastInsertIdContext(ctx, db, s, kv)
+	}
+	id, err = ShouldNamedQueryIdContext(ctx, db, s, kv)
 	return id, err
 }
+
+// NamedExecLastInsertId executes the insert query and returns the LastInsertId of its result
+func NamedExecLastInsertId(db *sqlx.DB, query string, arg any) (int64, error) {
+	return NamedExecLastInsertIdContext(context.Background(), db, query, arg)
+}
+
+func NamedExecLastInsertIdContext(ctx context.Context, db *sqlx.DB, query string, arg any) (int64, error) {
+	err := sqlchecker.CheckAll(db.DriverName(), query, arg)
+	if err != nil {
+		return 0, fmt.Errorf("SQL_INJECTION_DETECTED:QUERY_VALIDATION_FAILED: %w", err)
+	}
+	result, err := sqlx.NamedExecContext(ctx, ConnectionOf(ctx, db), query, arg)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	databaseProtectedUtils "github.com/donnyhardyanto/dxlib/database/protected/utils"
+	"github.com/donnyhardyanto/dxlib/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+// ClaimRows sets setKeyValues on at most limit rows of tableName matching whereAndFieldNameValues, taken in the order of
+// orderbyFieldNameDirections, and returns them as updated. The rows locked by another claim are skipped (FOR UPDATE SKIP
+// LOCKED), so workers of several replicas polling the same table never get the same row. Only PostgreSQL is supported.
+func ClaimRows(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, tableName string, idFieldName string,
+	whereAndFieldNameValues utils.JSON, orderbyFieldNameDirections map[string]string, limit int64, setKeyValues utils.JSON) (rowsInfo *RowsInfo, r []utils.JSON, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
+	span := startQuerySpan(context.Background(), db, "claim", tableName)
+	defer func() {
+		span.EndWithRows(len(r), err)
+	}()
+	driverName := db.DriverName()
+	if driverName != "postgres" {
+		return nil, nil, fmt.Errorf("CLAIM_ROWS_UNSUPPORTED_DATABASE:%s", driverName)
+	}
+	if limit <= 0 {
+		return nil, nil, errors.New("CLAIM_ROWS_INVALID_LIMIT")
+	}
+	t, err := QuoteIdentifierForDB(tableName, driverName)
+	if err != nil {
+		return nil, nil, err
+	}
+	id, err := QuoteIdentifierForDB(idFieldName, driverName)
+	if err != nil {
+		return nil, nil, err
+	}
+	sub, err := SQLPartConstructSelect(driverName, tableName, []string{idFieldName}, whereAndFieldNameValues, nil, orderbyFieldNameDirections, limit, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	setKeyValues, u, err := SQLPartSetFieldNameValues(setKeyValues, driverName)
+	if err != nil {
+		return nil, nil, err
+	}
+	s := `update ` + t + ` set ` + u + ` where ` + id + ` in (` + sub + ` for update skip locked) returning *`
+	kv := MergeMapExcludeSQLExpression(setKeyValues, whereAndFieldNameValues, driverName)
+	span.SetStatement(s)
+	span.SetArguments(kv)
+	return NamedQueryRows(db, fieldTypeMapping, s, kv)
+}
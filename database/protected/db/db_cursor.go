@@ -0,0 +1,108 @@
+package db
+
+import (
+	"fmt"
+
+	databaseProtectedUtils "github.com/donnyhardyanto/dxlib/database/protected/utils"
+	"github.com/donnyhardyanto/dxlib/database/sqlchecker"
+	"github.com/donnyhardyanto/dxlib/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+// RowsCursor reads the rows of a query one at a time, so a large result is never held whole in memory. It must be closed.
+type RowsCursor struct {
+	// OnRow is called on each row before Next returns it
+	OnRow            func(row utils.JSON) error
+	rows             *sqlx.Rows
+	bufferedRows     []utils.JSON
+	driverName       string
+	fieldTypeMapping databaseProtectedUtils.FieldTypeMapping
+}
+
+// Next returns the next row, ok false once the rows are exhausted
+func (c *RowsCursor) Next() (row utils.JSON, ok bool, err error) {
+	if c.rows == nil {
+		if len(c.bufferedRows) == 0 {
+			return nil, false, nil
+		}
+		row, c.bufferedRows = c.bufferedRows[0], c.bufferedRows[1:]
+	} else {
+		if !c.rows.Next() {
+			return nil, false, c.rows.Err()
+		}
+		row = utils.JSON{}
+		err = c.rows.MapScan(row)
+		if err != nil {
+			return nil, false, err
+		}
+		row, err = databaseProtectedUtils.DeformatKeys(row, c.driverName, c.fieldTypeMapping)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if c.OnRow != nil {
+		err = c.OnRow(row)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return row, true, nil
+}
+
+func (c *RowsCursor) Close() (err error) {
+	c.bufferedRows = nil
+	if c.rows == nil {
+		return nil
+	}
+	return c.rows.Close()
+}
+
+// NamedQueryCursor is NamedQueryRows returning a cursor over the rows instead of the rows
+func NamedQueryCursor(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, query string, arg any) (rowsInfo *RowsInfo, cursor *RowsCursor, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
+	if arg == nil {
+		arg = utils.JSON{}
+	}
+	err = sqlchecker.CheckAll(db.DriverName(), query, arg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("SQL_INJECTION_DETECTED:QUERY_VALIDATION_FAILED: %w", err)
+	}
+	rows, err := db.NamedQuery(query, arg)
+	if err != nil {
+		return nil, nil, err
+	}
+	rowsInfo = &RowsInfo{}
+	rowsInfo.Columns, err = rows.Columns()
+	if err == nil {
+		rowsInfo.ColumnTypes, err = rows.ColumnTypes()
+	}
+	if err != nil {
+		_ = rows.Close()
+		return nil, nil, err
+	}
+	return rowsInfo, &RowsCursor{rows: rows, driverName: db.DriverName(), fieldTypeMapping: fieldTypeMapping}, nil
+}
+
+// SelectCursor is Select returning a cursor over the rows instead of the rows. On Oracle the rows are read whole first.
+func SelectCursor(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON,
+	joinSQLPart any, orderbyFieldNameDirections map[string]string) (rowsInfo *RowsInfo, cursor *RowsCursor, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
+	driverName := db.DriverName()
+	switch driverName {
+	case "oracle":
+		rowsInfo, r, err := OracleSelect(db, fieldTypeMapping, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections)
+		if err != nil {
+			return nil, nil, err
+		}
+		return rowsInfo, &RowsCursor{bufferedRows: r}, nil
+	}
+	s, err := SQLPartConstructSelect(driverName, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NamedQueryCursor(db, fieldTypeMapping, s, ExcludeSQLExpression(whereAndFieldNameValues, driverName))
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+	utilsSql "github.com/donnyhardyanto/dxlib/utils/security"
+)
+
+// DebugSQLDefaultMaxStatementLength is the MaxStatementLength of a DebugSQL when zero
+const DebugSQLDefaultMaxStatementLength = 4096
+
+// DebugSQLRedactedValue is written instead of the values of the RedactedFieldNames of a DebugSQL
+const DebugSQLRedactedValue = "********"
+
+// DebugSQL logs at the debug level each statement run by the helpers, with its parameters written in it as literals so it can
+// be pasted in a SQL console, its parameters, its duration and its rows. It is off until SetEnabled, which may be called at
+// any time, and costs nothing while off or while its Log is above the debug level.
+type DebugSQL struct {
+	Log log.DXLog
+	// RedactedFieldNames are the fields whose values are masked, in the statement and in the parameters, compared
+	// case-insensitively
+	RedactedFieldNames []string
+	// MaxStatementLength truncates the longer statements, DebugSQLDefaultMaxStatementLength when zero
+	MaxStatementLength int
+	isEnabled          atomic.Bool
+}
+
+func (d *DebugSQL) SetEnabled(isEnabled bool) {
+	d.isEnabled.Store(isEnabled)
+}
+
+func (d *DebugSQL) IsEnabled() bool {
+	return d.isEnabled.Load()
+}
+
+// isLogging tells whether the statements are logged, it is false for a nil d
+func (d *DebugSQL) isLogging() bool {
+	return d != nil && d.isEnabled.Load() && d.Log.IsLevelEnabled(log.DXLogLevelDebug)
+}
+
+func (d *DebugSQL) isRedacted(fieldName string) bool {
+	for _, name := range d.RedactedFieldNames {
+		if strings.EqualFold(name, fieldName) {
+			return true
+		}
+	}
+	return false
+}
+
+// debugSQLs is the DebugSQL of the connections registered by SetDebugSQL
+var debugSQLs sync.Map
+
+// SetDebugSQL has the statements of the helpers run on connection logged by d, a nil d forgets it
+func SetDebugSQL(connection *sqlx.DB, d *DebugSQL) {
+	if connection == nil {
+		return
+	}
+	if d == nil {
+		debugSQLs.Delete(connection)
+		return
+	}
+	debugSQLs.Store(connection, d)
+}
+
+func debugSQLOf(connection *sqlx.DB) *DebugSQL {
+	d, _ := debugSQLs.Load(connection)
+	s, _ := d.(*DebugSQL)
+	return s
+}
+
+type debugSQLContextKey struct{}
+
+// ContextWithDebugSQL has the statements of the helpers of a transaction whose log has ctx as its Context logged by d, the
+// transactions are not bound to a registered connection
+func ContextWithDebugSQL(ctx context.Context, d *DebugSQL) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, debugSQLContextKey{}, d)
+}
+
+func debugSQLFromContext(ctx context.Context) *DebugSQL {
+	if ctx == nil {
+		return nil
+	}
+	d, _ := ctx.Value(debugSQLContextKey{}).(*DebugSQL)
+	return d
+}
+
+// startDebug has the query of s logged by d when it is enabled and its Log at the debug level
+func (s *QuerySpan) startDebug(d *DebugSQL, driverName string, operation string, tableName string) {
+	if !d.isLogging() {
+		return
+	}
+	s.debug = d
+	s.debugDriverName = driverName
+	s.debugOperation = operation
+	s.debugTableName = tableName
+	s.debugStartTime = time.Now()
+}
+
+// logDebug writes the query of s, ended with err, to the log of its DebugSQL
+func (s *QuerySpan) logDebug(err error) {
+	d := s.debug
+	dialect := database_type.UnknownDatabaseType
+	if driverDialect, errDialect := DialectOf(s.debugDriverName); errDialect == nil {
+		dialect = driverDialect.DatabaseType()
+	}
+	fields := log.DXLogFields{
+		"operation":   s.debugOperation,
+		"table":       s.debugTableName,
+		"duration_ms": float64(time.Since(s.debugStartTime).Microseconds()) / 1000,
+	}
+	if s.debugRowsField != "" {
+		fields[s.debugRowsField] = s.debugRowCount
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	if s.debugArguments != nil {
+		parameters := make(utils.JSON, len(s.debugArguments))
+		for k, v := range s.debugArguments {
+			if d.isRedacted(k) {
+				v = DebugSQLRedactedValue
+			}
+			parameters[k] = v
+		}
+		fields["parameters"] = parameters
+	}
+	statement := s.debugStatement
+	if statement == "" {
+		statement = s.debugOperation + " " + s.debugTableName
+	} else {
+		statement = utilsSql.InlineNamedParameters(statement, dialect, func(name string) (string, bool) {
+			v, isParameter := s.debugArguments[name]
+			if !isParameter {
+				return "", false
+			}
+			if d.isRedacted(name) {
+				return utilsSql.QuoteStringLiteral(DebugSQLRedactedValue, dialect), true
+			}
+			return utilsSql.QuoteLiteral(v, dialect), true
+		})
+	}
+	d.Log.LogTextWithFields(log.DXLogLevelDebug, "", "SQL: "+truncateStatement(statement, d.MaxStatementLength), fields)
+}
+
+// truncateStatement cuts s to maxLength bytes, DebugSQLDefaultMaxStatementLength when zero, on a character boundary
+func truncateStatement(s string, maxLength int) string {
+	if maxLength <= 0 {
+		maxLength = DebugSQLDefaultMaxStatementLength
+	}
+	if len(s) <= maxLength {
+		return s
+	}
+	n := maxLength
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "... (" + strconv.Itoa(len(s)-n) + " more bytes)"
+}
@@ -0,0 +1,298 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// InsertReturningMode tells how the id of an inserted row is read back
+type InsertReturningMode int
+
+const (
+	// InsertReturningByQuery reads the id from the row returned by the statement
+	InsertReturningByQuery InsertReturningMode = iota
+	// InsertReturningByLastInsertId reads the id from the LastInsertId of the result
+	InsertReturningByLastInsertId
+	// InsertReturningByOutParameter reads the id from the out parameter :new_id of the statement
+	InsertReturningByOutParameter
+)
+
+// Dialect writes the parts of a statement that differ between the databases, the generic helpers build their statements
+// through the one of their driver
+type Dialect interface {
+	DatabaseType() database_type.DXDatabaseType
+	// QuoteIdentifier validates an identifier, optionally qualified as schema.table, folds it and quotes it
+	QuoteIdentifier(identifier string) (string, error)
+	// BuildLimit returns the part written after "select" and the one written at the end of the statement, a limit of zero or
+	// less is no limit
+	BuildLimit(limit int64) (top string, suffix string)
+	// BuildInsertReturning returns the insert of fieldValues in fieldNames of quotedTableName returning quotedIdFieldName
+	BuildInsertReturning(quotedTableName string, fieldNames string, fieldValues string, quotedIdFieldName string) (s string, mode InsertReturningMode)
+	// BuildUpsert returns the insert of fieldValues in fieldNames of quotedTableName that updates the other fields instead when
+	// a row has the values of conflictFieldNames, the names quoted and the conflict ones among fieldNames
+	BuildUpsert(quotedTableName string, fieldNames []string, fieldValues []string, conflictFieldNames []string) string
+	// BuildLockClause returns the hint written after the table and the clause written at the end of a select locking its rows
+	BuildLockClause(isForUpdate bool) (tableHint string, suffix string)
+}
+
+type dialectBase struct {
+	databaseType database_type.DXDatabaseType
+}
+
+func (d dialectBase) DatabaseType() database_type.DXDatabaseType {
+	return d.databaseType
+}
+
+func (d dialectBase) QuoteIdentifier(identifier string) (string, error) {
+	return QuoteIdentifierForDB(identifier, d.databaseType.Driver())
+}
+
+func (d dialectBase) BuildLimit(limit int64) (top string, suffix string) {
+	if limit <= 0 {
+		return ``, ``
+	}
+	return ``, ` limit ` + strconv.FormatInt(limit, 10)
+}
+
+func (d dialectBase) BuildLockClause(isForUpdate bool) (tableHint string, suffix string) {
+	if !isForUpdate {
+		return ``, ``
+	}
+	return ``, ` for update`
+}
+
+type postgresDialect struct {
+	dialectBase
+}
+
+func (d postgresDialect) BuildInsertReturning(quotedTableName string, fieldNames string, fieldValues string, quotedIdFieldName string) (s string, mode InsertReturningMode) {
+	return `INSERT INTO ` + quotedTableName + ` (` + fieldNames + `) VALUES (` + fieldValues + `) RETURNING ` + quotedIdFieldName, InsertReturningByQuery
+}
+
+func (d postgresDialect) BuildUpsert(quotedTableName string, fieldNames []string, fieldValues []string, conflictFieldNames []string) string {
+	s := `INSERT INTO ` + quotedTableName + ` (` + strings.Join(fieldNames, `, `) + `) VALUES (` + strings.Join(fieldValues, `, `) +
+		`) ON CONFLICT (` + strings.Join(conflictFieldNames, `, `) + `) DO `
+	var sets []string
+	for _, f := range upsertUpdateFieldNames(fieldNames, conflictFieldNames) {
+		sets = append(sets, f+` = EXCLUDED.`+f)
+	}
+	if len(sets) == 0 {
+		return s + `NOTHING`
+	}
+	return s + `UPDATE SET ` + strings.Join(sets, `, `)
+}
+
+type mysqlDialect struct {
+	dialectBase
+}
+
+// BuildInsertReturning of MySQL has no returning clause, the id is the LastInsertId of an auto increment column
+func (d mysqlDialect) BuildInsertReturning(quotedTableName string, fieldNames string, fieldValues string, quotedIdFieldName string) (s string, mode InsertReturningMode) {
+	return `INSERT INTO ` + quotedTableName + ` (` + fieldNames + `) VALUES (` + fieldValues + `)`, InsertReturningByLastInsertId
+}
+
+// BuildUpsert of MySQL has no conflict target, the update is made for a duplicate of any primary or unique key
+func (d mysqlDialect) BuildUpsert(quotedTableName string, fieldNames []string, fieldValues []string, conflictFieldNames []string) string {
+	var sets []string
+	for _, f := range upsertUpdateFieldNames(fieldNames, conflictFieldNames) {
+		sets = append(sets, f+` = VALUES(`+f+`)`)
+	}
+	if len(sets) == 0 {
+		sets = append(sets, conflictFieldNames[0]+` = `+conflictFieldNames[0])
+	}
+	return `INSERT INTO ` + quotedTableName + ` (` + strings.Join(fieldNames, `, `) + `) VALUES (` + strings.Join(fieldValues, `, `) +
+		`) ON DUPLICATE KEY UPDATE ` + strings.Join(sets, `, `)
+}
+
+type sqlServerDialect struct {
+	dialectBase
+}
+
+func (d sqlServerDialect) BuildLimit(limit int64) (top string, suffix string) {
+	if limit <= 0 {
+		return ``, ``
+	}
+	return `top ` + strconv.FormatInt(limit, 10) + ` `, ``
+}
+
+func (d sqlServerDialect) BuildInsertReturning(quotedTableName string, fieldNames string, fieldValues string, quotedIdFieldName string) (s string, mode InsertReturningMode) {
+	return `INSERT INTO ` + quotedTableName + ` (` + fieldNames + `) OUTPUT INSERTED.` + quotedIdFieldName + ` VALUES (` + fieldValues + `)`, InsertReturningByQuery
+}
+
+// BuildLockClause of SQL Server has no "for update" on a select, the rows are locked by a table hint
+func (d sqlServerDialect) BuildLockClause(isForUpdate bool) (tableHint string, suffix string) {
+	if !isForUpdate {
+		return ``, ``
+	}
+	return ` with (updlock, rowlock)`, ``
+}
+
+// BuildUpsert of SQL Server is a MERGE holding its lock until the insert, without the semicolon it must end with, see
+// UpsertStatementTerminator
+func (d sqlServerDialect) BuildUpsert(quotedTableName string, fieldNames []string, fieldValues []string, conflictFieldNames []string) string {
+	return buildMerge(`MERGE INTO `+quotedTableName+` WITH (HOLDLOCK) AS target USING (SELECT `, `) AS source ON `, ``,
+		fieldNames, fieldValues, conflictFieldNames)
+}
+
+type oracleDialect struct {
+	dialectBase
+}
+
+func (d oracleDialect) BuildLimit(limit int64) (top string, suffix string) {
+	if limit <= 0 {
+		return ``, ``
+	}
+	return ``, ` FETCH FIRST ` + strconv.FormatInt(limit, 10) + ` ROWS ONLY`
+}
+
+func (d oracleDialect) BuildInsertReturning(quotedTableName string, fieldNames string, fieldValues string, quotedIdFieldName string) (s string, mode InsertReturningMode) {
+	return `INSERT INTO ` + quotedTableName + ` (` + fieldNames + `) VALUES (` + fieldValues + `) RETURNING ` + quotedIdFieldName + ` INTO :new_id`, InsertReturningByOutParameter
+}
+
+func (d oracleDialect) BuildUpsert(quotedTableName string, fieldNames []string, fieldValues []string, conflictFieldNames []string) string {
+	return buildMerge(`MERGE INTO `+quotedTableName+` target USING (SELECT `, ` FROM DUAL) source ON (`, `)`,
+		fieldNames, fieldValues, conflictFieldNames)
+}
+
+// buildMerge writes the MERGE of SQL Server and Oracle, which differ by the parts around the source and its condition
+func buildMerge(head string, sourceEnd string, conditionEnd string, fieldNames []string, fieldValues []string, conflictFieldNames []string) string {
+	sources := make([]string, len(fieldNames))
+	sourceFieldNames := make([]string, len(fieldNames))
+	for i, f := range fieldNames {
+		sources[i] = fieldValues[i] + ` AS ` + f
+		sourceFieldNames[i] = `source.` + f
+	}
+	conditions := make([]string, len(conflictFieldNames))
+	for i, f := range conflictFieldNames {
+		conditions[i] = `target.` + f + ` = source.` + f
+	}
+	s := head + strings.Join(sources, `, `) + sourceEnd + strings.Join(conditions, ` AND `) + conditionEnd
+	var sets []string
+	for _, f := range upsertUpdateFieldNames(fieldNames, conflictFieldNames) {
+		sets = append(sets, `target.`+f+` = source.`+f)
+	}
+	if len(sets) > 0 {
+		s = s + ` WHEN MATCHED THEN UPDATE SET ` + strings.Join(sets, `, `)
+	}
+	return s + ` WHEN NOT MATCHED THEN INSERT (` + strings.Join(fieldNames, `, `) + `) VALUES (` + strings.Join(sourceFieldNames, `, `) + `)`
+}
+
+// upsertUpdateFieldNames are the fieldNames an upsert updates, all but the conflict ones
+func upsertUpdateFieldNames(fieldNames []string, conflictFieldNames []string) (updateFieldNames []string) {
+	for _, f := range fieldNames {
+		if !slices.Contains(conflictFieldNames, f) {
+			updateFieldNames = append(updateFieldNames, f)
+		}
+	}
+	return updateFieldNames
+}
+
+// UpsertStatementTerminator is written at the end of an upsert of driverName after its checks, which refuse a semicolon, the
+// MERGE of SQL Server has to end with one
+func UpsertStatementTerminator(driverName string) string {
+	if driverName == database_type.SQLServer.Driver() {
+		return `;`
+	}
+	return ``
+}
+
+// DialectOf returns the dialect of driverName
+func DialectOf(driverName string) (Dialect, error) {
+	t := database_type.StringToDXDatabaseType(driverName)
+	switch t {
+	case database_type.PostgreSQL:
+		return postgresDialect{dialectBase{t}}, nil
+	case database_type.MySQL:
+		return mysqlDialect{dialectBase{t}}, nil
+	case database_type.SQLServer:
+		return sqlServerDialect{dialectBase{t}}, nil
+	case database_type.Oracle:
+		return oracleDialect{dialectBase{t}}, nil
+	default:
+		return nil, errors.New(`UNKNOWN_DATABASE_TYPE:` + driverName)
+	}
+}
+
+// NormalizeLimit converts the limit given to the helpers to an int64, nil being no limit. A float64 is accepted when it is a
+// whole number, as a limit decoded from a JSON body is.
+func NormalizeLimit(limit any) (int64, error) {
+	switch v := limit.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return normalizeUnsignedLimit(uint64(v))
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return normalizeUnsignedLimit(v)
+	case float32:
+		return normalizeFloatLimit(float64(v))
+	case float64:
+		return normalizeFloatLimit(v)
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("INVALID_LIMIT:%s", v.String())
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("INVALID_LIMIT:%T", limit)
+	}
+}
+
+func normalizeUnsignedLimit(v uint64) (int64, error) {
+	if v > math.MaxInt64 {
+		return 0, fmt.Errorf("INVALID_LIMIT:%d", v)
+	}
+	return int64(v), nil
+}
+
+func normalizeFloatLimit(v float64) (int64, error) {
+	if v != math.Trunc(v) || v >= math.MaxInt64 || v < math.MinInt64 {
+		return 0, fmt.Errorf("INVALID_LIMIT:%v", v)
+	}
+	return int64(v), nil
+}
+
+// Preparer is what the Oracle helpers execute their statements on, a *sqlx.DB or a *sqlx.Tx
+type Preparer interface {
+	DriverName() string
+	Prepare(query string) (*sql.Stmt, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// OracleWhereArgs returns the named arguments of the where built by SQLPartWhereAndFieldNameValues on Oracle, the
+// SQLExpression and the nil values are written in it and have no argument
+func OracleWhereArgs(whereAndFieldNameValues utils.JSON) (args []any) {
+	for k, v := range ExcludeSQLExpression(whereAndFieldNameValues, database_type.Oracle.Driver()) {
+		if v == nil {
+			continue
+		}
+		args = append(args, sql.Named(k, v))
+	}
+	return args
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// The select built for each dialect, with its limit, its order, its lock and its named parameters
+func TestSQLPartConstructSelectGolden(t *testing.T) {
+	for _, tc := range []struct {
+		driverName string
+		limit      any
+		order      map[string]string
+		forUpdate  any
+		where      utils.JSON
+		want       string
+	}{
+		{"postgres", nil, nil, nil, nil, `select "id", "status" from "orders"`},
+		{"postgres", 10, map[string]string{"created_at": "desc"}, nil, utils.JSON{"status": "open"},
+			`select "id", "status" from "orders" where "status"=:status order by "created_at" DESC NULLS LAST limit 10`},
+		{"postgres", float64(5), nil, true, utils.JSON{"id": int64(1)},
+			`select "id", "status" from "orders" where "id"=:id limit 5 for update`},
+		{"mysql", nil, nil, nil, nil, "select `id`, `status` from `orders`"},
+		{"mysql", 10, map[string]string{"created_at": "desc"}, nil, utils.JSON{"status": "open"},
+			"select `id`, `status` from `orders` where `status`=:status order by `created_at` DESC limit 10"},
+		{"mysql", float64(5), nil, true, utils.JSON{"id": int64(1)},
+			"select `id`, `status` from `orders` where `id`=:id limit 5 for update"},
+		{"sqlserver", nil, nil, nil, nil, `select [id], [status] from [orders]`},
+		{"sqlserver", 10, map[string]string{"created_at": "desc"}, nil, utils.JSON{"status": "open"},
+			`select top 10 [id], [status] from [orders] where [status]=:status order by [created_at] DESC`},
+		{"sqlserver", float64(5), nil, true, utils.JSON{"id": int64(1)},
+			`select top 5 [id], [status] from [orders] with (updlock, rowlock) where [id]=:id`},
+		{"oracle", nil, nil, nil, nil, `select "ID", "STATUS" from "ORDERS"`},
+		{"oracle", 10, map[string]string{"created_at": "desc"}, nil, utils.JSON{"status": "open"},
+			`select "ID", "STATUS" from "ORDERS" where "STATUS"=:STATUS order by "CREATED_AT" DESC FETCH FIRST 10 ROWS ONLY`},
+		{"oracle", float64(5), nil, true, utils.JSON{"id": int64(1)},
+			`select "ID", "STATUS" from "ORDERS" where "ID"=:ID FETCH FIRST 5 ROWS ONLY for update`},
+	} {
+		s, err := SQLPartConstructSelect(tc.driverName, "orders", []string{"id", "status"}, tc.where, nil, tc.order, tc.limit, tc.forUpdate)
+		if err != nil {
+			t.Errorf("%s: %v", tc.driverName, err)
+			continue
+		}
+		if s != tc.want {
+			t.Errorf("%s:\n got %s\nwant %s", tc.driverName, s, tc.want)
+		}
+	}
+}
+
+// goldenHandler is reservedWordHandler, with the id 7 of a MySQL insert too
+func goldenHandler(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+	r := reservedWordHandler(ctx, s)
+	r.LastInsertId = 7
+	return r
+}
+
+// The statements the CRUD helpers send to each driver, after the binding of their parameters
+func TestCRUDHelpersGoldenSQL(t *testing.T) {
+	for _, tc := range []struct {
+		driverName string
+		want       []string
+	}{
+		{"postgres", []string{
+			`select "id", "status" from "orders" where "status"=$1 order by "id" ASC NULLS FIRST limit 10`,
+			`select "id" from "orders" where "id"=$1 limit 1`,
+			`INSERT INTO "orders" ("status") VALUES ($1) RETURNING "id"`,
+			`update "orders" set "status"=$1 where "id"=$2`,
+			`DELETE FROM "orders" where "id"=$1`,
+		}},
+		{"mysql", []string{
+			"select `id`, `status` from `orders` where `status`=? order by `id` ASC limit 10",
+			"select `id` from `orders` where `id`=? limit 1",
+			"INSERT INTO `orders` (`status`) VALUES (?)",
+			"update `orders` set `status`=? where `id`=?",
+			"DELETE FROM `orders` where `id`=?",
+		}},
+		{"sqlserver", []string{
+			`select top 10 [id], [status] from [orders] where [status]=@p1 order by [id] ASC`,
+			`select top 1 [id] from [orders] where [id]=@p1`,
+			`INSERT INTO [orders] ([status]) OUTPUT INSERTED.[id] VALUES (@p1)`,
+			`update [orders] set [status]=@p1 where [id]=@p2`,
+			`DELETE FROM [orders] where [id]=@p1`,
+		}},
+		{"oracle", []string{
+			`select "ID", "STATUS" from "ORDERS" where "STATUS"=:STATUS order by "ID" ASC FETCH FIRST 10 ROWS ONLY`,
+			`select "ID" from "ORDERS" where "ID"=:ID FETCH FIRST 1 ROWS ONLY`,
+			`INSERT INTO "ORDERS" ("STATUS") VALUES (:STATUS) RETURNING "ID" INTO :new_id`,
+			`UPDATE "ORDERS" SET "STATUS"=:NEW_STATUS  WHERE "ID"=:ID`,
+			`DELETE FROM "ORDERS"  WHERE "ID"=:ID`,
+		}},
+	} {
+		t.Run(tc.driverName, func(t *testing.T) {
+			f := dbtest.Open(tc.driverName, goldenHandler)
+			defer func() {
+				_ = f.Close()
+			}()
+			_, _, err := Select(f.DB, nil, "orders", []string{"id", "status"}, utils.JSON{"status": "open"}, nil, map[string]string{"id": "asc"}, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _, err = SelectOne(f.DB, nil, "orders", []string{"id"}, utils.JSON{"id": int64(7)}, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, err := Insert(f.DB, "orders", "id", utils.JSON{"status": "open"})
+			if err != nil || id != 7 {
+				t.Fatalf("id %d, %v", id, err)
+			}
+			_, err = Update(f.DB, "orders", utils.JSON{"status": "closed"}, utils.JSON{"id": int64(7)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = Delete(f.DB, "orders", utils.JSON{"id": int64(7)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			queries := f.Queries()
+			if len(queries) != len(tc.want) {
+				t.Fatalf("queries %q", queries)
+			}
+			for i, want := range tc.want {
+				if queries[i] != want {
+					t.Errorf("\n got %s\nwant %s", queries[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeLimit(t *testing.T) {
+	for _, tc := range []struct {
+		limit   any
+		want    int64
+		isValid bool
+	}{
+		{nil, 0, true},
+		{10, 10, true},
+		{int32(10), 10, true},
+		{int64(10), 10, true},
+		{uint(10), 10, true},
+		{float64(10), 10, true},
+		{float64(10.5), 0, false},
+		{uint64(1 << 63), 0, false},
+		{float64(1 << 63), 0, false},
+		{"10", 0, false},
+	} {
+		got, err := NormalizeLimit(tc.limit)
+		if (err == nil) != tc.isValid || got != tc.want {
+			t.Errorf("%T %v: %d, %v", tc.limit, tc.limit, got, err)
+		}
+	}
+}
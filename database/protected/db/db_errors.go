@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	mssql "github.com/microsoft/go-mssqldb"
+	"github.com/sijms/go-ora/v2/network"
+)
+
+// The kinds of DriverError, matched by errors.Is whatever the database
+var (
+	ErrNoRows               = errors.New("NO_ROWS")
+	ErrDuplicateKey         = errors.New("DUPLICATE_KEY")
+	ErrForeignKeyViolation  = errors.New("FOREIGN_KEY_VIOLATION")
+	ErrConnectionFailed     = errors.New("CONNECTION_FAILED")
+	ErrQueryTimeout         = errors.New("QUERY_TIMEOUT")
+	ErrMultipleRowsAffected = errors.New("MULTIPLE_ROWS_AFFECTED")
+)
+
+// DriverError is an error of the database classified as one of the kinds above. Its message is the one of the original
+// error, kept for errors.As and errors.Unwrap.
+type DriverError struct {
+	Kind error
+	// Constraint is the unique or foreign key constraint violated, as named by the driver, when it tells it
+	Constraint string
+	err        error
+}
+
+func (e *DriverError) Error() string {
+	return e.err.Error()
+}
+
+func (e *DriverError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *DriverError) Unwrap() error {
+	return e.err
+}
+
+// WrapError classifies err as kind
+func WrapError(kind error, constraint string, err error) error {
+	return &DriverError{Kind: kind, Constraint: constraint, err: err}
+}
+
+var (
+	mysqlDuplicateKeyRegexp      = regexp.MustCompile("for key '([^']+)'")
+	mysqlForeignKeyRegexp        = regexp.MustCompile("CONSTRAINT `([^`]+)`")
+	sqlServerConstraintRegexp    = regexp.MustCompile(`constraint ['"]([^'"]+)['"]`)
+	sqlServerUniqueIndexRegexp   = regexp.MustCompile(`unique index '([^']+)'`)
+	oracleConstraintRegexp       = regexp.MustCompile(`constraint \(([^)]+)\)`)
+	sqlServerForeignKeyFragments = []string{"FOREIGN KEY constraint", "REFERENCE constraint"}
+)
+
+func submatch(r *regexp.Regexp, s string) string {
+	m := r.FindStringSubmatch(s)
+	if len(m) < 2 {
+		return ""
+	}
+	return m[1]
+}
+
+// unqualified drops the schema or the table qualifying a constraint name, "SCHEMA.UK_NAME" is "UK_NAME"
+func unqualified(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// ClassifyError wraps err in a DriverError when it is one of the kinds above, for the errors of lib/pq, go-sql-driver/mysql,
+// go-mssqldb and go-ora. Any other error is returned as it is.
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var driverError *DriverError
+	if errors.As(err, &driverError) {
+		return err
+	}
+	kind, constraint := classify(err)
+	if kind == nil {
+		return err
+	}
+	return WrapError(kind, constraint, err)
+}
+
+func classify(err error) (kind error, constraint string) {
+	var pqError *pq.Error
+	if errors.As(err, &pqError) {
+		switch {
+		case pqError.Code == "23505":
+			return ErrDuplicateKey, pqError.Constraint
+		case pqError.Code == "23503":
+			return ErrForeignKeyViolation, pqError.Constraint
+		case pqError.Code == "57014":
+			return ErrQueryTimeout, ""
+		case pqError.Code == "53300" || pqError.Code.Class() == "08" || pqError.Code.Class() == "28":
+			return ErrConnectionFailed, ""
+		}
+		return nil, ""
+	}
+	var mysqlError *mysql.MySQLError
+	if errors.As(err, &mysqlError) {
+		switch mysqlError.Number {
+		case 1062:
+			return ErrDuplicateKey, unqualified(submatch(mysqlDuplicateKeyRegexp, mysqlError.Message))
+		case 1451, 1452:
+			return ErrForeignKeyViolation, submatch(mysqlForeignKeyRegexp, mysqlError.Message)
+		case 1205, 3024:
+			return ErrQueryTimeout, ""
+		case 1040, 1045, 1049:
+			return ErrConnectionFailed, ""
+		}
+		return nil, ""
+	}
+	var sqlServerError mssql.Error
+	if errors.As(err, &sqlServerError) {
+		switch sqlServerError.Number {
+		case 2627:
+			return ErrDuplicateKey, submatch(sqlServerConstraintRegexp, sqlServerError.Message)
+		case 2601:
+			return ErrDuplicateKey, submatch(sqlServerUniqueIndexRegexp, sqlServerError.Message)
+		case 547:
+			for _, fragment := range sqlServerForeignKeyFragments {
+				if strings.Contains(sqlServerError.Message, fragment) {
+					return ErrForeignKeyViolation, submatch(sqlServerConstraintRegexp, sqlServerError.Message)
+				}
+			}
+		case 1222:
+			return ErrQueryTimeout, ""
+		case 4060, 18456:
+			return ErrConnectionFailed, ""
+		}
+		return nil, ""
+	}
+	var oracleError *network.OracleError
+	if errors.As(err, &oracleError) {
+		switch oracleError.ErrCode {
+		case 1:
+			return ErrDuplicateKey, unqualified(submatch(oracleConstraintRegexp, oracleError.Error()))
+		case 2291, 2292:
+			return ErrForeignKeyViolation, unqualified(submatch(oracleConstraintRegexp, oracleError.Error()))
+		case 1013:
+			return ErrQueryTimeout, ""
+		case 1017, 3113, 3114, 12170, 12514, 12537, 12541:
+			return ErrConnectionFailed, ""
+		}
+		return nil, ""
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNoRows, ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrQueryTimeout, ""
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone), errors.Is(err, mysql.ErrInvalidConn):
+		return ErrConnectionFailed, ""
+	}
+	var netError net.Error
+	if errors.As(err, &netError) {
+		return ErrConnectionFailed, ""
+	}
+	return nil, ""
+}
+
+// IsAuthenticationError tells whether err is the database refusing the credentials of a connection, a password or a token
+// that is wrong or expired. Such an error is also of the ErrConnectionFailed kind.
+func IsAuthenticationError(err error) bool {
+	var pqError *pq.Error
+	if errors.As(err, &pqError) {
+		return pqError.Code.Class() == "28"
+	}
+	var mysqlError *mysql.MySQLError
+	if errors.As(err, &mysqlError) {
+		return mysqlError.Number == 1045
+	}
+	var sqlServerError mssql.Error
+	if errors.As(err, &sqlServerError) {
+		return sqlServerError.Number == 18456
+	}
+	var oracleError *network.OracleError
+	if errors.As(err, &oracleError) {
+		return oracleError.ErrCode == 1017
+	}
+	return false
+}
+
+// CheckOneRowAffected returns an ErrNoRows error when result affected no row and an ErrMultipleRowsAffected one when it
+// affected more than one, nothing when the driver does not tell
+func CheckOneRowAffected(result sql.Result) error {
+	n := RowsAffected(result)
+	switch {
+	case n == 0:
+		return WrapError(ErrNoRows, "", errors.New("NO_ROW_AFFECTED"))
+	case n > 1:
+		return WrapError(ErrMultipleRowsAffected, "", fmt.Errorf("MULTIPLE_ROWS_AFFECTED:%d", n))
+	default:
+		return nil
+	}
+}
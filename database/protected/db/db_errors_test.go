@@ -0,0 +1,149 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	mssql "github.com/microsoft/go-mssqldb"
+	"github.com/sijms/go-ora/v2/network"
+)
+
+// The errors of each driver, with the messages their servers send, and the kind and the constraint they are classified as
+func TestClassifyError(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		err        error
+		kind       error
+		constraint string
+	}{
+		// lib/pq
+		{"pq duplicate", &pq.Error{Code: "23505", Message: `duplicate key value violates unique constraint "users_email_key"`,
+			Constraint: "users_email_key"}, ErrDuplicateKey, "users_email_key"},
+		{"pq foreign key", &pq.Error{Code: "23503", Message: `insert or update on table "orders" violates foreign key constraint "orders_user_id_fkey"`,
+			Constraint: "orders_user_id_fkey"}, ErrForeignKeyViolation, "orders_user_id_fkey"},
+		{"pq statement timeout", &pq.Error{Code: "57014", Message: "canceling statement due to statement timeout"}, ErrQueryTimeout, ""},
+		{"pq connection failure", &pq.Error{Code: "08006", Message: "connection failure"}, ErrConnectionFailed, ""},
+		{"pq too many connections", &pq.Error{Code: "53300", Message: "sorry, too many clients already"}, ErrConnectionFailed, ""},
+		{"pq password", &pq.Error{Code: "28P01", Message: `password authentication failed for user "app"`}, ErrConnectionFailed, ""},
+		{"pq undefined table", &pq.Error{Code: "42P01", Message: `relation "missing" does not exist`}, nil, ""},
+		// go-sql-driver/mysql, MySQL 8 qualifies the key with its table
+		{"mysql duplicate", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a@b.c' for key 'users.users_email_key'"},
+			ErrDuplicateKey, "users_email_key"},
+		{"mysql 5 duplicate", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a@b.c' for key 'users_email_key'"},
+			ErrDuplicateKey, "users_email_key"},
+		{"mysql child row", &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails " +
+			"(`app`.`orders`, CONSTRAINT `orders_user_fk` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`))"},
+			ErrForeignKeyViolation, "orders_user_fk"},
+		{"mysql parent row", &mysql.MySQLError{Number: 1451, Message: "Cannot delete or update a parent row: a foreign key constraint fails " +
+			"(`app`.`orders`, CONSTRAINT `orders_user_fk` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`))"},
+			ErrForeignKeyViolation, "orders_user_fk"},
+		{"mysql lock wait", &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded; try restarting transaction"}, ErrQueryTimeout, ""},
+		{"mysql max execution time", &mysql.MySQLError{Number: 3024, Message: "Query execution was interrupted, maximum statement execution time exceeded"},
+			ErrQueryTimeout, ""},
+		{"mysql access denied", &mysql.MySQLError{Number: 1045, Message: "Access denied for user 'app'@'10.0.0.1' (using password: YES)"},
+			ErrConnectionFailed, ""},
+		{"mysql invalid connection", mysql.ErrInvalidConn, ErrConnectionFailed, ""},
+		{"mysql missing table", &mysql.MySQLError{Number: 1146, Message: "Table 'app.missing' doesn't exist"}, nil, ""},
+		// go-mssqldb
+		{"mssql unique constraint", mssql.Error{Number: 2627, Message: "Violation of UNIQUE KEY constraint 'UQ_users_email'. Cannot insert " +
+			"duplicate key in object 'dbo.users'. The duplicate key value is (a@b.c)."}, ErrDuplicateKey, "UQ_users_email"},
+		{"mssql primary key", mssql.Error{Number: 2627, Message: "Violation of PRIMARY KEY constraint 'PK_users'. Cannot insert duplicate key " +
+			"in object 'dbo.users'. The duplicate key value is (7)."}, ErrDuplicateKey, "PK_users"},
+		{"mssql unique index", mssql.Error{Number: 2601, Message: "Cannot insert duplicate key row in object 'dbo.users' with unique index " +
+			"'IX_users_email'. The duplicate key value is (a@b.c)."}, ErrDuplicateKey, "IX_users_email"},
+		{"mssql foreign key", mssql.Error{Number: 547, Message: `The INSERT statement conflicted with the FOREIGN KEY constraint ` +
+			`"FK_orders_users". The conflict occurred in database "app", table "dbo.users", column 'id'.`}, ErrForeignKeyViolation, "FK_orders_users"},
+		{"mssql reference", mssql.Error{Number: 547, Message: `The DELETE statement conflicted with the REFERENCE constraint ` +
+			`"FK_orders_users". The conflict occurred in database "app", table "dbo.orders", column 'user_id'.`}, ErrForeignKeyViolation, "FK_orders_users"},
+		{"mssql check", mssql.Error{Number: 547, Message: `The INSERT statement conflicted with the CHECK constraint "CK_orders_amount". ` +
+			`The conflict occurred in database "app", table "dbo.orders", column 'amount'.`}, nil, ""},
+		{"mssql lock timeout", mssql.Error{Number: 1222, Message: "Lock request time out period exceeded."}, ErrQueryTimeout, ""},
+		{"mssql login", mssql.Error{Number: 18456, Message: "Login failed for user 'app'."}, ErrConnectionFailed, ""},
+		{"mssql invalid object", mssql.Error{Number: 208, Message: "Invalid object name 'missing'."}, nil, ""},
+		// go-ora
+		{"oracle unique", &network.OracleError{ErrCode: 1, ErrMsg: "ORA-00001: unique constraint (APP.UK_USERS_EMAIL) violated"},
+			ErrDuplicateKey, "UK_USERS_EMAIL"},
+		{"oracle parent key", &network.OracleError{ErrCode: 2291, ErrMsg: "ORA-02291: integrity constraint (APP.FK_ORDERS_USERS) violated - " +
+			"parent key not found"}, ErrForeignKeyViolation, "FK_ORDERS_USERS"},
+		{"oracle child record", &network.OracleError{ErrCode: 2292, ErrMsg: "ORA-02292: integrity constraint (APP.FK_ORDERS_USERS) violated - " +
+			"child record found"}, ErrForeignKeyViolation, "FK_ORDERS_USERS"},
+		{"oracle cancelled", &network.OracleError{ErrCode: 1013, ErrMsg: "ORA-01013: user requested cancel of current operation"},
+			ErrQueryTimeout, ""},
+		{"oracle password", &network.OracleError{ErrCode: 1017, ErrMsg: "ORA-01017: invalid username/password; logon denied"},
+			ErrConnectionFailed, ""},
+		{"oracle end of file", &network.OracleError{ErrCode: 3113, ErrMsg: "ORA-03113: end-of-file on communication channel"},
+			ErrConnectionFailed, ""},
+		{"oracle missing table", &network.OracleError{ErrCode: 942, ErrMsg: "ORA-00942: table or view does not exist"}, nil, ""},
+		// database/sql, the context and the network
+		{"no rows", sql.ErrNoRows, ErrNoRows, ""},
+		{"deadline", context.DeadlineExceeded, ErrQueryTimeout, ""},
+		{"bad connection", driver.ErrBadConn, ErrConnectionFailed, ""},
+		{"connection done", sql.ErrConnDone, ErrConnectionFailed, ""},
+		{"dial", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, ErrConnectionFailed, ""},
+		// A wrapped error of a driver is classified too
+		{"wrapped pq duplicate", fmt.Errorf("INSERT_FAILED:%w", &pq.Error{Code: "23505", Constraint: "users_email_key"}),
+			ErrDuplicateKey, "users_email_key"},
+		{"other", errors.New("SOMETHING_ELSE"), nil, ""},
+	} {
+		got := ClassifyError(tc.err)
+		var driverError *DriverError
+		isDriverError := errors.As(got, &driverError)
+		if tc.kind == nil {
+			if isDriverError || !reflect.DeepEqual(got, tc.err) {
+				t.Errorf("%s: classified as %v", tc.name, got)
+			}
+			continue
+		}
+		if !isDriverError || !errors.Is(got, tc.kind) || driverError.Constraint != tc.constraint {
+			t.Errorf("%s: %#v, want %v of the constraint %q", tc.name, got, tc.kind, tc.constraint)
+			continue
+		}
+		// The original error is kept, with its message. A mssql.Error is not comparable, errors.Is can not find it.
+		if !reflect.DeepEqual(errors.Unwrap(got), tc.err) || got.Error() != tc.err.Error() {
+			t.Errorf("%s: the original error is lost in %#v", tc.name, got)
+		}
+		if ClassifyError(got) != got {
+			t.Errorf("%s: a classified error is wrapped again", tc.name)
+		}
+	}
+	if ClassifyError(nil) != nil {
+		t.Error("nil is classified")
+	}
+}
+
+func TestIsAuthenticationError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&pq.Error{Code: "28P01"}, true},
+		{&pq.Error{Code: "08006"}, false},
+		{&mysql.MySQLError{Number: 1045}, true},
+		{mssql.Error{Number: 18456}, true},
+		{&network.OracleError{ErrCode: 1017}, true},
+		{&network.OracleError{ErrCode: 3113}, false},
+		{fmt.Errorf("CONNECT:%w", &pq.Error{Code: "28000"}), true},
+		{errors.New("password authentication failed"), false},
+	} {
+		if got := IsAuthenticationError(tc.err); got != tc.want {
+			t.Errorf("%#v: %v", tc.err, got)
+		}
+	}
+}
+
+func TestCheckOneRowAffected(t *testing.T) {
+	for n, want := range map[int64]error{0: ErrNoRows, 1: nil, 2: ErrMultipleRowsAffected} {
+		err := CheckOneRowAffected(driver.RowsAffected(n))
+		if want == nil && err != nil || want != nil && !errors.Is(err, want) {
+			t.Errorf("%d rows: %v", n, err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// DXExportDefaultTimeLayout is the layout of the time values of ExportCSV and ExportNDJSON, in UTC
+const DXExportDefaultTimeLayout = time.RFC3339Nano
+
+type CSVOptions struct {
+	// Delimiter is ',' when zero
+	Delimiter rune
+	// NullValue is written for a NULL, the empty string by default
+	NullValue  string
+	TimeLayout string
+	IsUseCRLF  bool
+	IsNoHeader bool
+}
+
+type NDJSONOptions struct {
+	TimeLayout string
+}
+
+// ExportCSV writes a header of the columns of rowsInfo, in their order, then a record per row returned by next until it
+// returns ok false, see RowsCursor.Next. It returns the count of the rows written.
+func ExportCSV(w io.Writer, rowsInfo *RowsInfo, next func() (utils.JSON, bool, error), opts CSVOptions) (rowCount int64, err error) {
+	cw := csv.NewWriter(w)
+	if opts.Delimiter != 0 {
+		cw.Comma = opts.Delimiter
+	}
+	cw.UseCRLF = opts.IsUseCRLF
+	if !opts.IsNoHeader {
+		err = cw.Write(rowsInfo.Columns)
+		if err != nil {
+			return 0, err
+		}
+	}
+	record := make([]string, len(rowsInfo.Columns))
+	for {
+		row, ok, err := next()
+		if err != nil {
+			return rowCount, err
+		}
+		if !ok {
+			break
+		}
+		for i, column := range rowsInfo.Columns {
+			v := exportColumnValue(row, column)
+			if v == nil {
+				record[i] = opts.NullValue
+				continue
+			}
+			record[i], err = formatExportValue(v, opts.TimeLayout)
+			if err != nil {
+				return rowCount, fmt.Errorf("EXPORT_VALUE_CANT_BE_FORMATTED:%s:%w", column, err)
+			}
+		}
+		err = cw.Write(record)
+		if err != nil {
+			return rowCount, err
+		}
+		rowCount++
+	}
+	cw.Flush()
+	return rowCount, cw.Error()
+}
+
+// ExportNDJSON writes a JSON object per row returned by next until it returns ok false, a line each, with the columns of
+// rowsInfo in their order. It returns the count of the rows written.
+func ExportNDJSON(w io.Writer, rowsInfo *RowsInfo, next func() (utils.JSON, bool, error), opts NDJSONOptions) (rowCount int64, err error) {
+	bw := bufio.NewWriter(w)
+	keys := make([][]byte, len(rowsInfo.Columns))
+	for i, column := range rowsInfo.Columns {
+		keys[i], err = json.Marshal(column)
+		if err != nil {
+			return 0, err
+		}
+	}
+	for {
+		row, ok, err := next()
+		if err != nil {
+			return rowCount, err
+		}
+		if !ok {
+			break
+		}
+		_ = bw.WriteByte('{')
+		for i, column := range rowsInfo.Columns {
+			if i > 0 {
+				_ = bw.WriteByte(',')
+			}
+			_, _ = bw.Write(keys[i])
+			_ = bw.WriteByte(':')
+			b, err := marshalExportValue(exportColumnValue(row, column), opts.TimeLayout)
+			if err != nil {
+				return rowCount, fmt.Errorf("EXPORT_VALUE_CANT_BE_FORMATTED:%s:%w", column, err)
+			}
+			_, _ = bw.Write(b)
+		}
+		_, err = bw.WriteString("}\n")
+		if err != nil {
+			return rowCount, err
+		}
+		rowCount++
+	}
+	return rowCount, bw.Flush()
+}
+
+// exportColumnValue finds column in row, whose keys are deformatted, lower case on the drivers that fold the identifiers
+func exportColumnValue(row utils.JSON, column string) any {
+	v, ok := row[column]
+	if !ok {
+		v = row[strings.ToLower(column)]
+	}
+	return v
+}
+
+// formatExportValue formats the values the drivers scan the same way whatever the driver: times in UTC with timeLayout,
+// numbers without exponent, bytes as text, maps and slices as JSON
+func formatExportValue(v any, timeLayout string) (s string, err error) {
+	if timeLayout == "" {
+		timeLayout = DXExportDefaultTimeLayout
+	}
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case []byte:
+		return string(t), nil
+	case time.Time:
+		return t.UTC().Format(timeLayout), nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	case int64:
+		return strconv.FormatInt(t, 10), nil
+	case int:
+		return strconv.Itoa(t), nil
+	case int32:
+		return strconv.FormatInt(int64(t), 10), nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(t), 'f', -1, 32), nil
+	case map[string]any, []any:
+		b, err := json.Marshal(t)
+		return string(b), err
+	default:
+		return fmt.Sprintf("%v", t), nil
+	}
+}
+
+func marshalExportValue(v any, timeLayout string) (b []byte, err error) {
+	switch t := v.(type) {
+	case nil:
+		return []byte("null"), nil
+	case bool, int64, int, int32, map[string]any, []any:
+		return json.Marshal(v)
+	case float64:
+		if !math.IsNaN(t) && !math.IsInf(t, 0) {
+			return strconv.AppendFloat(nil, t, 'f', -1, 64), nil
+		}
+	case float32:
+		if !math.IsNaN(float64(t)) && !math.IsInf(float64(t), 0) {
+			return strconv.AppendFloat(nil, float64(t), 'f', -1, 32), nil
+		}
+	}
+	s, err := formatExportValue(v, timeLayout)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(s)
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// reservedWordHandler answers the queries with a row of id 7, and the Oracle RETURNING INTO with 7 too
+func reservedWordHandler(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+	for _, a := range s.Args {
+		if out, ok := a.Value.(sql.Out); ok {
+			*out.Dest.(*int64) = 7
+		}
+	}
+	if s.IsQuery {
+		return dbtest.DXFakeResult{Columns: []string{"id"}, Rows: [][]any{{int64(7)}}}
+	}
+	return dbtest.DXFakeResult{RowsAffected: 1}
+}
+
+// The reserved words as table and column names, in each statement of the helpers, on each dialect
+func TestReservedWordsAsTableAndColumnNames(t *testing.T) {
+	quote := map[string]func(string) string{
+		"postgres":  func(s string) string { return `"` + s + `"` },
+		"mysql":     func(s string) string { return "`" + s + "`" },
+		"sqlserver": func(s string) string { return "[" + s + "]" },
+		"oracle":    func(s string) string { return `"` + strings.ToUpper(s) + `"` },
+	}
+	for _, driverName := range []string{"postgres", "mysql", "sqlserver", "oracle"} {
+		for _, word := range []string{"user", "order", "select"} {
+			for _, tc := range []struct {
+				operation string
+				// tableKeyword is the keyword written before the table
+				tableKeyword string
+				run          func(db *dbtest.DXFakeDatabase) error
+			}{
+				{operation: "select", tableKeyword: "from", run: func(f *dbtest.DXFakeDatabase) error {
+					_, _, err := Select(f.DB, nil, word, []string{word}, utils.JSON{word: 1}, nil, map[string]string{word: "asc"}, nil)
+					return err
+				}},
+				{operation: "insert", tableKeyword: "into", run: func(f *dbtest.DXFakeDatabase) error {
+					_, err := Insert(f.DB, word, "id", utils.JSON{word: 1})
+					return err
+				}},
+				{operation: "update", tableKeyword: "update", run: func(f *dbtest.DXFakeDatabase) error {
+					_, err := Update(f.DB, word, utils.JSON{word: 2}, utils.JSON{word: 1})
+					return err
+				}},
+				{operation: "delete", tableKeyword: "from", run: func(f *dbtest.DXFakeDatabase) error {
+					_, err := Delete(f.DB, word, utils.JSON{word: 1})
+					return err
+				}},
+				{operation: "upsert", tableKeyword: "into", run: func(f *dbtest.DXFakeDatabase) error {
+					_, err := Upsert(f.DB, word, []string{"id"}, utils.JSON{"id": 1, word: 2})
+					return err
+				}},
+			} {
+				t.Run(driverName+"/"+word+"/"+tc.operation, func(t *testing.T) {
+					f := dbtest.Open(driverName, reservedWordHandler)
+					defer func() {
+						_ = f.Close()
+					}()
+					err := tc.run(f)
+					if err != nil {
+						t.Fatal(err)
+					}
+					queries := f.Queries()
+					if len(queries) != 1 {
+						t.Fatalf("queries %q", queries)
+					}
+					// The table and the column are both the quoted identifier
+					q := strings.ToLower(queries[0])
+					quoted := strings.ToLower(quote[driverName](word))
+					if !strings.Contains(q, tc.tableKeyword+" "+quoted) || strings.Count(q, quoted) < 2 {
+						t.Fatalf("%s has not %s %s and the column %s", queries[0], tc.tableKeyword, quoted, quoted)
+					}
+				})
+			}
+		}
+	}
+}
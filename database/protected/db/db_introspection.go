@@ -0,0 +1,128 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	utilsSql "github.com/donnyhardyanto/dxlib/utils/security"
+	"github.com/jmoiron/sqlx"
+)
+
+type TableColumn struct {
+	Name string
+	// DataType is the type as named by the catalog of the database, like "character varying" on PostgreSQL
+	DataType   string
+	IsNullable bool
+}
+
+// introspectionLiterals returns the schema and the table of tableName, optionally qualified as schema.table, as SQL string
+// literals folded like QuoteIdentifierForDB, the schema being the current one when not given. A table of another database
+// is not looked up.
+func introspectionLiterals(tableName string, driverName string) (schema string, table string, err error) {
+	t, err := ParseTableRef(tableName)
+	if err != nil {
+		return "", "", err
+	}
+	if t.Database != "" {
+		return "", "", fmt.Errorf("INTROSPECTION_CROSS_DATABASE_UNSUPPORTED:%s", tableName)
+	}
+	dialect := database_type.StringToDXDatabaseType(driverName)
+	literal := func(segment string) string {
+		parts, _ := splitIdentifier(segment)
+		name := parts[0].name
+		if !parts[0].isQuoted {
+			name = formatIdentifierForDB(name, driverName)
+		}
+		return utilsSql.QuoteStringLiteral(name, dialect)
+	}
+	table = literal(t.Name)
+	if t.Schema != "" {
+		return literal(t.Schema), table, nil
+	}
+	switch driverName {
+	case "postgres":
+		return "current_schema()", table, nil
+	case "mysql":
+		return "DATABASE()", table, nil
+	case "sqlserver":
+		return "SCHEMA_NAME()", table, nil
+	case "oracle":
+		return "USER", table, nil
+	default:
+		return "", "", fmt.Errorf("INTROSPECTION_UNSUPPORTED_DATABASE:%s", driverName)
+	}
+}
+
+// GetTableColumns returns the columns of tableName in their order, none when the table does not exist
+func GetTableColumns(db *sqlx.DB, tableName string) (columns []TableColumn, err error) {
+	driverName := db.DriverName()
+	schema, table, err := introspectionLiterals(tableName, driverName)
+	if err != nil {
+		return nil, err
+	}
+	var query string
+	switch driverName {
+	case "oracle":
+		query = "SELECT column_name, data_type, nullable FROM all_tab_columns WHERE owner = " + schema + " AND table_name = " + table +
+			" ORDER BY column_id"
+	default:
+		query = "SELECT column_name, data_type, is_nullable FROM information_schema.columns WHERE table_schema = " + schema +
+			" AND table_name = " + table + " ORDER BY ordinal_position"
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var c TableColumn
+		var nullable string
+		err = rows.Scan(&c.Name, &c.DataType, &nullable)
+		if err != nil {
+			return nil, err
+		}
+		c.IsNullable = nullable == "YES" || nullable == "Y"
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// GetTableIndexNames returns the names of the indexes of tableName, including the ones backing its primary key and unique
+// constraints
+func GetTableIndexNames(db *sqlx.DB, tableName string) (names []string, err error) {
+	driverName := db.DriverName()
+	schema, table, err := introspectionLiterals(tableName, driverName)
+	if err != nil {
+		return nil, err
+	}
+	var query string
+	switch driverName {
+	case "postgres":
+		query = "SELECT indexname FROM pg_indexes WHERE schemaname = " + schema + " AND tablename = " + table
+	case "mysql":
+		query = "SELECT DISTINCT index_name FROM information_schema.statistics WHERE table_schema = " + schema + " AND table_name = " + table
+	case "sqlserver":
+		query = "SELECT i.name FROM sys.indexes i JOIN sys.tables t ON t.object_id = i.object_id WHERE i.name IS NOT NULL AND " +
+			"SCHEMA_NAME(t.schema_id) = " + schema + " AND t.name = " + table
+	case "oracle":
+		query = "SELECT index_name FROM all_indexes WHERE table_owner = " + schema + " AND table_name = " + table
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	databaseProtectedUtils "github.com/donnyhardyanto/dxlib/database/protected/utils"
+	"github.com/donnyhardyanto/dxlib/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrTooManyRows is the error of a guarded select matching more rows than its maximum
+var ErrTooManyRows = errors.New("TOO_MANY_ROWS")
+
+// MaxRowsLimit is the limit a select bounded by maxRows is read with, one row more than maxRows tells that there were more.
+// It is limit itself when that is already within maxRows, isGuarded is then false.
+func MaxRowsLimit(limit int64, maxRows int64) (queryLimit int64, isGuarded bool) {
+	if maxRows <= 0 || (limit > 0 && limit <= maxRows) {
+		return limit, false
+	}
+	return maxRows + 1, true
+}
+
+// LimitRows applies maxRows to rows read with MaxRowsLimit. More rows fail with ErrTooManyRows, or, when isTruncated, are
+// dropped and rowsInfo.Truncated tells it.
+func LimitRows(rowsInfo *RowsInfo, rows []utils.JSON, maxRows int64, isTruncated bool) ([]utils.JSON, error) {
+	if maxRows <= 0 || int64(len(rows)) <= maxRows {
+		return rows, nil
+	}
+	if !isTruncated {
+		return nil, fmt.Errorf("%w:%d", ErrTooManyRows, maxRows)
+	}
+	if rowsInfo != nil {
+		rowsInfo.Truncated = true
+	}
+	return rows[:maxRows], nil
+}
+
+// SelectWithMaxRows is Select reading at most maxRows rows, zero is no maximum, see LimitRows
+func SelectWithMaxRows(db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, tableName string, fieldNames []string,
+	whereAndFieldNameValues utils.JSON, joinSQLPart any, orderbyFieldNameDirections map[string]string, limit any, maxRows int64,
+	isTruncated bool) (rowsInfo *RowsInfo, r []utils.JSON, err error) {
+	return SelectWithMaxRowsContext(context.Background(), db, fieldTypeMapping, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart,
+		orderbyFieldNameDirections, limit, maxRows, isTruncated)
+}
+
+func SelectWithMaxRowsContext(ctx context.Context, db *sqlx.DB, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, tableName string,
+	fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any, orderbyFieldNameDirections map[string]string, limit any,
+	maxRows int64, isTruncated bool) (rowsInfo *RowsInfo, r []utils.JSON, err error) {
+	if maxRows <= 0 {
+		return SelectContext(ctx, db, fieldTypeMapping, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, limit)
+	}
+	limitAsInt64, err := NormalizeLimit(limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	queryLimit, isGuarded := MaxRowsLimit(limitAsInt64, maxRows)
+	rowsInfo, r, err = SelectContext(ctx, db, fieldTypeMapping, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, queryLimit)
+	if err != nil || !isGuarded {
+		return rowsInfo, r, err
+	}
+	r, err = LimitRows(rowsInfo, r, maxRows, isTruncated)
+	if err != nil {
+		return rowsInfo, nil, fmt.Errorf("%w:%s", err, tableName)
+	}
+	return rowsInfo, r, nil
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrPoolExhausted is matched by errors.Is on a PoolExhaustedError
+var ErrPoolExhausted = errors.New("POOL_EXHAUSTED")
+
+// PoolExhaustedError is the wait for a connection of the pool that exceeded the acquire timeout of the database, Stats are
+// the ones of the pool when it did
+type PoolExhaustedError struct {
+	DatabaseNameId string
+	Timeout        time.Duration
+	Stats          sql.DBStats
+}
+
+func (e *PoolExhaustedError) Error() string {
+	return fmt.Sprintf("POOL_EXHAUSTED:%s:timeout=%s:max_open=%d:open=%d:in_use=%d:idle=%d:wait_count=%d:wait_duration=%s",
+		e.DatabaseNameId, e.Timeout, e.Stats.MaxOpenConnections, e.Stats.OpenConnections, e.Stats.InUse, e.Stats.Idle,
+		e.Stats.WaitCount, e.Stats.WaitDuration)
+}
+
+func (e *PoolExhaustedError) Is(target error) bool {
+	return target == ErrPoolExhausted
+}
+
+// RetryAfterSec is the value of the Retry-After header of a response failed by e, the acquire timeout rounded up to a second
+func (e *PoolExhaustedError) RetryAfterSec() string {
+	sec := int64((e.Timeout + time.Second - 1) / time.Second)
+	if sec < 1 {
+		sec = 1
+	}
+	return strconv.FormatInt(sec, 10)
+}
+
+type connectionContextKey struct{}
+
+// boundConnection is a connection taken from the pool of connection, the helpers given it run their statements on it
+type boundConnection struct {
+	*sqlx.Conn
+	connection *sqlx.DB
+}
+
+func (c *boundConnection) DriverName() string {
+	return c.connection.DriverName()
+}
+
+func (c *boundConnection) BindNamed(query string, arg any) (string, []any, error) {
+	return c.connection.BindNamed(query, arg)
+}
+
+func (c *boundConnection) Prepare(query string) (*sql.Stmt, error) {
+	return c.Conn.PrepareContext(context.Background(), query)
+}
+
+// ContextWithConnection returns ctx where the helpers given connection run their statements on conn, a connection taken
+// beforehand from its pool, instead of waiting for one of the pool themselves
+func ContextWithConnection(ctx context.Context, connection *sqlx.DB, conn *sqlx.Conn) context.Context {
+	return context.WithValue(ctx, connectionContextKey{}, &boundConnection{Conn: conn, connection: connection})
+}
+
+// ConnectionOf is what the statements of ctx on connection run on, the connection of ContextWithConnection or connection
+func ConnectionOf(ctx context.Context, connection *sqlx.DB) sqlx.ExtContext {
+	c, ok := boundConnectionOf(ctx, connection)
+	if ok {
+		return c
+	}
+	return connection
+}
+
+func boundConnectionOf(ctx context.Context, connection *sqlx.DB) (c *boundConnection, ok bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	c, ok = ctx.Value(connectionContextKey{}).(*boundConnection)
+	return c, ok && c.connection == connection
+}
+
+// preparerOf is p, or the connection of ContextWithConnection when p is its pool
+func preparerOf(ctx context.Context, p Preparer) Preparer {
+	connection, ok := p.(*sqlx.DB)
+	if !ok {
+		return p
+	}
+	c, ok := boundConnectionOf(ctx, connection)
+	if ok {
+		return c
+	}
+	return p
+}
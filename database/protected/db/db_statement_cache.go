@@ -0,0 +1,230 @@
+package db
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+	"github.com/donnyhardyanto/dxlib/utils/cache"
+	namedParameterQuery "github.com/knetic/go-namedparameterquery"
+)
+
+// StatementCacheMaxEntries bounds each of the statement caches, it is read when they are first used
+var StatementCacheMaxEntries = 2048
+
+// IsStatementCacheEnabled lets the select, the insert and the named parameter statements be built once per shape
+var IsStatementCacheEnabled = true
+
+type StatementCacheStats struct {
+	// Generated are the statements built by SQLPartConstructSelect, Insert, TxInsert, Upsert and TxUpsert
+	Generated cache.DXCacheStats
+	// Parsed are the named parameter statements of ParseNamedParameterQuery
+	Parsed cache.DXCacheStats
+}
+
+type generatedStatement struct {
+	s    string
+	mode InsertReturningMode
+}
+
+// parsedStatement is a statement with its named parameters replaced by positional ones, names are the names of the
+// positions
+type parsedStatement struct {
+	query string
+	names []string
+}
+
+var (
+	statementCacheOnce   sync.Once
+	generatedStatements  *cache.DXCache[string, generatedStatement]
+	parsedStatements     *cache.DXCache[string, *parsedStatement]
+	tableGenerations     sync.Map
+	statementsGeneration atomic.Int64
+)
+
+func initStatementCache() {
+	statementCacheOnce.Do(func() {
+		generatedStatements = cache.New[string, generatedStatement](StatementCacheMaxEntries, 0)
+		parsedStatements = cache.New[string, *parsedStatement](StatementCacheMaxEntries, 0)
+	})
+}
+
+func GetStatementCacheStats() StatementCacheStats {
+	initStatementCache()
+	return StatementCacheStats{Generated: generatedStatements.Stats(), Parsed: parsedStatements.Stats()}
+}
+
+func tableGenerationKey(tableName string) string {
+	tableName = strings.ToLower(tableName)
+	return tableName[strings.LastIndex(tableName, ".")+1:]
+}
+
+func tableGeneration(tableName string) *atomic.Int64 {
+	g, _ := tableGenerations.LoadOrStore(tableGenerationKey(tableName), &atomic.Int64{})
+	return g.(*atomic.Int64)
+}
+
+// InvalidateStatementCache drops the generated statements of tableName, in any schema, after its definition changed, like
+// EnsureSchema does for the tables it alters
+func InvalidateStatementCache(tableName string) {
+	tableGeneration(tableName).Add(1)
+}
+
+// InvalidateAllStatementCache drops every generated statement, after a script that may have changed any table. The scripts
+// of ExecuteScripts, the migrations, call it once each, whatever tables they touch.
+func InvalidateAllStatementCache() {
+	statementsGeneration.Add(1)
+}
+
+// cachedStatement returns the statement of kind on tableName whose shape is signature, built by build the first time
+func cachedStatement(kind string, driverName string, tableName string, signature string, build func() (generatedStatement, error)) (generatedStatement, error) {
+	if !IsStatementCacheEnabled {
+		return build()
+	}
+	initStatementCache()
+	key := kind + "|" + driverName + "|" + tableName + "|" + strconv.FormatInt(statementsGeneration.Load(), 10) + "." +
+		strconv.FormatInt(tableGeneration(tableName).Load(), 10) + "|" + signature
+	return generatedStatements.GetOrLoad(key, build)
+}
+
+// keyValuesSignature is the shape of keyValues in a statement: its keys, sorted, and whether each is a NULL, an
+// SQLExpression, written as it is, or a parameter
+func keyValuesSignature(b *strings.Builder, keyValues utils.JSON) {
+	keys := make([]string, 0, len(keyValues))
+	for k := range keyValues {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(k)
+		switch v := keyValues[k].(type) {
+		case nil:
+			b.WriteString("=n,")
+		case SQLExpression:
+			b.WriteString("=e:")
+			b.WriteString(v.Expression)
+			b.WriteString(",")
+		default:
+			b.WriteString("=v,")
+		}
+	}
+}
+
+func selectSignature(fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any, orderbyFieldNameDirections map[string]string,
+	limit int64, isForUpdate bool) string {
+	b := strings.Builder{}
+	b.WriteString(strings.Join(fieldNames, ","))
+	b.WriteString("|")
+	keyValuesSignature(&b, whereAndFieldNameValues)
+	b.WriteString("|")
+	if joinSQLPart != nil {
+		b.WriteString(joinSQLPart.(string))
+	}
+	b.WriteString("|")
+	keys := make([]string, 0, len(orderbyFieldNameDirections))
+	for k := range orderbyFieldNameDirections {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(k + " " + orderbyFieldNameDirections[k] + ",")
+	}
+	b.WriteString("|" + strconv.FormatInt(limit, 10) + "|" + strconv.FormatBool(isForUpdate))
+	return b.String()
+}
+
+func insertSignature(fieldNameForRowId string, keyValues utils.JSON) string {
+	b := strings.Builder{}
+	b.WriteString(fieldNameForRowId)
+	b.WriteString("|")
+	keyValuesSignature(&b, keyValues)
+	return b.String()
+}
+
+// CachedInsertStatement is the insert of keyValues in tableName returning fieldNameForRowId, built through dialect once per
+// shape
+func CachedInsertStatement(dialect Dialect, tableName string, fieldNameForRowId string, keyValues utils.JSON) (s string, mode InsertReturningMode, err error) {
+	driverName := dialect.DatabaseType().Driver()
+	g, err := cachedStatement("insert", driverName, tableName, insertSignature(fieldNameForRowId, keyValues), func() (g generatedStatement, err error) {
+		t, err := dialect.QuoteIdentifier(tableName)
+		if err != nil {
+			return g, err
+		}
+		rowIdField, err := dialect.QuoteIdentifier(fieldNameForRowId)
+		if err != nil {
+			return g, err
+		}
+		fn, fv, err := SQLPartInsertFieldNamesFieldValues(keyValues, driverName)
+		if err != nil {
+			return g, err
+		}
+		g.s, g.mode = dialect.BuildInsertReturning(t, fn, fv, rowIdField)
+		return g, nil
+	})
+	if err != nil {
+		return ``, 0, err
+	}
+	return g.s, g.mode, nil
+}
+
+// CachedUpsertStatement is the upsert of keyValues in tableName on conflictKeyFields, built through dialect once per shape and
+// without its UpsertStatementTerminator
+func CachedUpsertStatement(dialect Dialect, tableName string, conflictKeyFields []string, keyValues utils.JSON) (s string, err error) {
+	driverName := dialect.DatabaseType().Driver()
+	signature := strings.Join(conflictKeyFields, ",") + "|" + insertSignature("", keyValues)
+	g, err := cachedStatement("upsert", driverName, tableName, signature, func() (g generatedStatement, err error) {
+		g.s, err = SQLPartUpsert(dialect, tableName, conflictKeyFields, keyValues)
+		return g, err
+	})
+	if err != nil {
+		return ``, err
+	}
+	return g.s, nil
+}
+
+// ParseNamedParameterQuery replaces the named parameters of statement by positional ones and returns the values of
+// parameters in their positions. The parsing of a statement is kept when every one of its parameters is in parameters.
+func ParseNamedParameterQuery(driverName string, statement string, parameters utils.JSON) (query string, args []any) {
+	if !IsStatementCacheEnabled {
+		return parseNamedParameterQuery(statement, parameters)
+	}
+	initStatementCache()
+	key := driverName + "|" + statement
+	p, isFound := parsedStatements.Get(key)
+	if !isFound {
+		q := namedParameterQuery.NewNamedParameterQuery(statement)
+		names := map[string]any{}
+		for k := range parameters {
+			names[k] = k
+		}
+		q.SetValuesFromMap(names)
+		p = &parsedStatement{query: q.GetParsedQuery()}
+		isComplete := true
+		for _, name := range q.GetParsedParameters() {
+			s, ok := name.(string)
+			if !ok {
+				isComplete = false
+				break
+			}
+			p.names = append(p.names, s)
+		}
+		if !isComplete {
+			return parseNamedParameterQuery(statement, parameters)
+		}
+		parsedStatements.Set(key, p)
+	}
+	args = make([]any, len(p.names))
+	for i, name := range p.names {
+		args[i] = parameters[name]
+	}
+	return p.query, args
+}
+
+func parseNamedParameterQuery(statement string, parameters utils.JSON) (query string, args []any) {
+	q := namedParameterQuery.NewNamedParameterQuery(statement)
+	q.SetValuesFromMap(parameters)
+	return q.GetParsedQuery(), q.GetParsedParameters()
+}
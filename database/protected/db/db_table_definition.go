@@ -0,0 +1,258 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type ColumnType string
+
+// The portable column types of ColumnDefinition, mapped to the type of each database by ColumnDefinition.SQLType
+const (
+	ColumnTypeInteger   ColumnType = "integer"
+	ColumnTypeBigInt    ColumnType = "bigint"
+	ColumnTypeDecimal   ColumnType = "decimal"
+	ColumnTypeBoolean   ColumnType = "boolean"
+	ColumnTypeVarchar   ColumnType = "varchar"
+	ColumnTypeText      ColumnType = "text"
+	ColumnTypeDate      ColumnType = "date"
+	ColumnTypeTimestamp ColumnType = "timestamp"
+	ColumnTypeJSON      ColumnType = "json"
+	ColumnTypeBytes     ColumnType = "bytes"
+)
+
+type ColumnDefinition struct {
+	Name string     `json:"name"`
+	Type ColumnType `json:"type"`
+	// Length is the length of a varchar, 255 when zero
+	Length int `json:"length,omitempty"`
+	// Precision and Scale are the ones of a decimal, 18 and 2 when zero
+	Precision  int  `json:"precision,omitempty"`
+	Scale      int  `json:"scale,omitempty"`
+	IsNullable bool `json:"is_nullable,omitempty"`
+	// Default is an SQL expression, written as is
+	Default         string `json:"default,omitempty"`
+	IsPrimaryKey    bool   `json:"is_primary_key,omitempty"`
+	IsAutoIncrement bool   `json:"is_auto_increment,omitempty"`
+}
+
+type IndexDefinition struct {
+	Name     string   `json:"name"`
+	Columns  []string `json:"columns"`
+	IsUnique bool     `json:"is_unique,omitempty"`
+}
+
+// TableDefinition declares a table for DXDatabase.EnsureSchema. UniqueConstraints are added with ALTER TABLE ... ADD
+// CONSTRAINT, Indexes with CREATE INDEX.
+type TableDefinition struct {
+	Name              string             `json:"name"`
+	Columns           []ColumnDefinition `json:"columns"`
+	Indexes           []IndexDefinition  `json:"indexes,omitempty"`
+	UniqueConstraints []IndexDefinition  `json:"unique_constraints,omitempty"`
+}
+
+// Checksum identifies the content of the definition, a definition applied with another checksum has changed since
+func (td *TableDefinition) Checksum() string {
+	b, _ := json.Marshal(td)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// SQLType returns the type of the column for driverName
+func (cd *ColumnDefinition) SQLType(driverName string) (s string, err error) {
+	length := cd.Length
+	if length == 0 {
+		length = 255
+	}
+	precision, scale := cd.Precision, cd.Scale
+	if precision == 0 {
+		precision, scale = 18, 2
+	}
+	var types map[ColumnType]string
+	switch driverName {
+	case "postgres":
+		types = map[ColumnType]string{
+			ColumnTypeInteger: "INTEGER", ColumnTypeBigInt: "BIGINT", ColumnTypeDecimal: "NUMERIC(%d,%d)", ColumnTypeBoolean: "BOOLEAN",
+			ColumnTypeVarchar: "VARCHAR(%d)", ColumnTypeText: "TEXT", ColumnTypeDate: "DATE", ColumnTypeTimestamp: "TIMESTAMPTZ",
+			ColumnTypeJSON: "JSONB", ColumnTypeBytes: "BYTEA",
+		}
+	case "mysql":
+		types = map[ColumnType]string{
+			ColumnTypeInteger: "INT", ColumnTypeBigInt: "BIGINT", ColumnTypeDecimal: "DECIMAL(%d,%d)", ColumnTypeBoolean: "BOOLEAN",
+			ColumnTypeVarchar: "VARCHAR(%d)", ColumnTypeText: "LONGTEXT", ColumnTypeDate: "DATE", ColumnTypeTimestamp: "DATETIME(6)",
+			ColumnTypeJSON: "JSON", ColumnTypeBytes: "LONGBLOB",
+		}
+	case "sqlserver":
+		types = map[ColumnType]string{
+			ColumnTypeInteger: "INT", ColumnTypeBigInt: "BIGINT", ColumnTypeDecimal: "DECIMAL(%d,%d)", ColumnTypeBoolean: "BIT",
+			ColumnTypeVarchar: "NVARCHAR(%d)", ColumnTypeText: "NVARCHAR(MAX)", ColumnTypeDate: "DATE", ColumnTypeTimestamp: "DATETIMEOFFSET",
+			ColumnTypeJSON: "NVARCHAR(MAX)", ColumnTypeBytes: "VARBINARY(MAX)",
+		}
+	case "oracle":
+		types = map[ColumnType]string{
+			ColumnTypeInteger: "NUMBER(10)", ColumnTypeBigInt: "NUMBER(19)", ColumnTypeDecimal: "NUMBER(%d,%d)", ColumnTypeBoolean: "NUMBER(1)",
+			ColumnTypeVarchar: "VARCHAR2(%d)", ColumnTypeText: "CLOB", ColumnTypeDate: "DATE", ColumnTypeTimestamp: "TIMESTAMP WITH TIME ZONE",
+			ColumnTypeJSON: "CLOB", ColumnTypeBytes: "BLOB",
+		}
+	default:
+		return "", fmt.Errorf("TABLE_DEFINITION_UNSUPPORTED_DATABASE:%s", driverName)
+	}
+	t, ok := types[cd.Type]
+	if !ok {
+		return "", fmt.Errorf("TABLE_DEFINITION_UNKNOWN_COLUMN_TYPE:%s:%s", cd.Name, cd.Type)
+	}
+	switch cd.Type {
+	case ColumnTypeVarchar:
+		t = fmt.Sprintf(t, length)
+	case ColumnTypeDecimal:
+		t = fmt.Sprintf(t, precision, scale)
+	}
+	if cd.IsAutoIncrement {
+		switch driverName {
+		case "postgres", "oracle":
+			t += " GENERATED BY DEFAULT AS IDENTITY"
+		case "mysql":
+			t += " AUTO_INCREMENT"
+		case "sqlserver":
+			t += " IDENTITY(1,1)"
+		}
+	}
+	return t, nil
+}
+
+// SQLPartColumn returns the column as written in CREATE TABLE and ADD COLUMN
+func (cd *ColumnDefinition) SQLPartColumn(driverName string) (s string, err error) {
+	name, err := QuoteIdentifierForDB(cd.Name, driverName)
+	if err != nil {
+		return "", err
+	}
+	t, err := cd.SQLType(driverName)
+	if err != nil {
+		return "", err
+	}
+	s = name + " " + t
+	if cd.Default != "" {
+		s += " DEFAULT " + cd.Default
+	}
+	if !cd.IsNullable || cd.IsPrimaryKey {
+		s += " NOT NULL"
+	}
+	return s, nil
+}
+
+func quoteIdentifiersForDB(names []string, driverName string) (s string, err error) {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i], err = QuoteIdentifierForDB(name, driverName)
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(quoted, ", "), nil
+}
+
+// SQLCreateTable returns the CREATE TABLE of the table with its primary key and unique constraints, without the indexes
+func (td *TableDefinition) SQLCreateTable(driverName string) (s string, err error) {
+	table, err := QuoteIdentifierForDB(td.Name, driverName)
+	if err != nil {
+		return "", err
+	}
+	var parts, primaryKeys []string
+	for _, c := range td.Columns {
+		part, err := c.SQLPartColumn(driverName)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+		if c.IsPrimaryKey {
+			primaryKeys = append(primaryKeys, c.Name)
+		}
+	}
+	if len(primaryKeys) > 0 {
+		columns, err := quoteIdentifiersForDB(primaryKeys, driverName)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, "PRIMARY KEY ("+columns+")")
+	}
+	for _, u := range td.UniqueConstraints {
+		part, err := u.sqlPartUniqueConstraint(driverName)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("TABLE_DEFINITION_HAS_NO_COLUMN:%s", td.Name)
+	}
+	return "CREATE TABLE " + table + " (" + strings.Join(parts, ", ") + ")", nil
+}
+
+// SQLAddColumn returns the ALTER TABLE adding column c to the table
+func (td *TableDefinition) SQLAddColumn(driverName string, c ColumnDefinition) (s string, err error) {
+	table, err := QuoteIdentifierForDB(td.Name, driverName)
+	if err != nil {
+		return "", err
+	}
+	part, err := c.SQLPartColumn(driverName)
+	if err != nil {
+		return "", err
+	}
+	switch driverName {
+	case "sqlserver":
+		return "ALTER TABLE " + table + " ADD " + part, nil
+	case "oracle":
+		return "ALTER TABLE " + table + " ADD (" + part + ")", nil
+	default:
+		return "ALTER TABLE " + table + " ADD COLUMN " + part, nil
+	}
+}
+
+// SQLCreateIndex returns the CREATE INDEX of index idx of the table
+func (td *TableDefinition) SQLCreateIndex(driverName string, idx IndexDefinition) (s string, err error) {
+	table, err := QuoteIdentifierForDB(td.Name, driverName)
+	if err != nil {
+		return "", err
+	}
+	name, err := QuoteIdentifierForDB(idx.Name, driverName)
+	if err != nil {
+		return "", err
+	}
+	columns, err := quoteIdentifiersForDB(idx.Columns, driverName)
+	if err != nil {
+		return "", err
+	}
+	unique := ""
+	if idx.IsUnique {
+		unique = "UNIQUE "
+	}
+	return "CREATE " + unique + "INDEX " + name + " ON " + table + " (" + columns + ")", nil
+}
+
+// SQLAddUniqueConstraint returns the ALTER TABLE adding the unique constraint u to the table
+func (td *TableDefinition) SQLAddUniqueConstraint(driverName string, u IndexDefinition) (s string, err error) {
+	table, err := QuoteIdentifierForDB(td.Name, driverName)
+	if err != nil {
+		return "", err
+	}
+	part, err := u.sqlPartUniqueConstraint(driverName)
+	if err != nil {
+		return "", err
+	}
+	return "ALTER TABLE " + table + " ADD " + part, nil
+}
+
+func (idx *IndexDefinition) sqlPartUniqueConstraint(driverName string) (s string, err error) {
+	name, err := QuoteIdentifierForDB(idx.Name, driverName)
+	if err != nil {
+		return "", err
+	}
+	columns, err := quoteIdentifiersForDB(idx.Columns, driverName)
+	if err != nil {
+		return "", err
+	}
+	return "CONSTRAINT " + name + " UNIQUE (" + columns + ")", nil
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	utilsSql "github.com/donnyhardyanto/dxlib/utils/security"
+)
+
+// TableRef is a table optionally qualified by its schema, the owner on Oracle, and by its database, SQL Server only. Each part
+// is written like a part of a table name string: a plain name is folded to the case the database gives to the unquoted names,
+// a name quoted as "name", `name` or [name] is kept as it is, whatever the dialect.
+type TableRef struct {
+	Database string
+	Schema   string
+	Name     string
+}
+
+// ParseTableRef splits tableName, like "events", "analytics.events" or "[dbo].[Orders]", in its parts, a dot inside a quoted
+// part does not split it
+func ParseTableRef(tableName string) (t TableRef, err error) {
+	parts, err := splitIdentifier(tableName)
+	if err != nil {
+		return TableRef{}, err
+	}
+	segments := make([]string, len(parts))
+	for i, p := range parts {
+		if p.name == "*" && !p.isQuoted {
+			return TableRef{}, fmt.Errorf("SQL_TABLE_NAME_INVALID:%q", tableName)
+		}
+		segments[i] = p.raw
+	}
+	switch len(segments) {
+	case 1:
+		return TableRef{Name: segments[0]}, nil
+	case 2:
+		return TableRef{Schema: segments[0], Name: segments[1]}, nil
+	case 3:
+		return TableRef{Database: segments[0], Schema: segments[1], Name: segments[2]}, nil
+	default:
+		return TableRef{}, fmt.Errorf("SQL_TABLE_NAME_TOO_MANY_PARTS:%q", tableName)
+	}
+}
+
+// String is the table name string of t, accepted by every helper taking a table name
+func (t TableRef) String() string {
+	s := t.Name
+	if t.Schema != "" || t.Database != "" {
+		s = t.Schema + "." + s
+	}
+	if t.Database != "" {
+		s = t.Database + "." + s
+	}
+	return s
+}
+
+// Quote validates t and writes it quoted for the database of driverName
+func (t TableRef) Quote(driverName string) (string, error) {
+	return QuoteIdentifierForDB(t.String(), driverName)
+}
+
+type identifierPart struct {
+	name     string
+	raw      string
+	isQuoted bool
+}
+
+// splitIdentifier splits s at its dots, those outside of a quoted part, and validates each part. A quoted part may hold any
+// character but the control ones, its closing quote doubled.
+func splitIdentifier(s string) (parts []identifierPart, err error) {
+	if s == "" {
+		return nil, fmt.Errorf("SQL_IDENTIFIER_EMPTY")
+	}
+	i := 0
+	for {
+		var p identifierPart
+		closing := byte(0)
+		if i < len(s) {
+			switch s[i] {
+			case '"':
+				closing = '"'
+			case '`':
+				closing = '`'
+			case '[':
+				closing = ']'
+			}
+		}
+		if closing != 0 {
+			b := strings.Builder{}
+			j := i + 1
+			for {
+				k := strings.IndexByte(s[j:], closing)
+				if k < 0 {
+					return nil, fmt.Errorf("SQL_IDENTIFIER_UNTERMINATED_QUOTE:%q", s)
+				}
+				b.WriteString(s[j : j+k])
+				j += k + 1
+				if j < len(s) && s[j] == closing {
+					b.WriteByte(closing)
+					j++
+					continue
+				}
+				break
+			}
+			p = identifierPart{name: b.String(), raw: s[i:j], isQuoted: true}
+			err = validateQuotedIdentifierPart(s, p.name)
+			if err != nil {
+				return nil, err
+			}
+			i = j
+		} else {
+			j := strings.IndexByte(s[i:], '.')
+			if j < 0 {
+				j = len(s)
+			} else {
+				j += i
+			}
+			p = identifierPart{name: s[i:j], raw: s[i:j]}
+			if p.name == "" {
+				return nil, fmt.Errorf("SQL_IDENTIFIER_EMPTY_PART:%q", s)
+			}
+			if p.name != "*" {
+				err = utilsSql.ValidateIdentifier(p.name)
+				if err != nil {
+					return nil, err
+				}
+			}
+			i = j
+		}
+		parts = append(parts, p)
+		if i == len(s) {
+			return parts, nil
+		}
+		if s[i] != '.' {
+			return nil, fmt.Errorf("SQL_IDENTIFIER_INVALID_CHARACTER:%q:%q", s, s[i])
+		}
+		i++
+		if i == len(s) {
+			return nil, fmt.Errorf("SQL_IDENTIFIER_EMPTY_PART:%q", s)
+		}
+	}
+}
+
+func validateQuotedIdentifierPart(s string, name string) error {
+	if name == "" {
+		return fmt.Errorf("SQL_IDENTIFIER_EMPTY_PART:%q", s)
+	}
+	if len(name) > utilsSql.DXSQLIdentifierMaxLength {
+		return fmt.Errorf("SQL_IDENTIFIER_TOO_LONG:%q", s)
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("SQL_IDENTIFIER_INVALID_CHARACTER:%q:%q", s, r)
+		}
+	}
+	return nil
+}
+
+// quoteIdentifierPart quotes name for dialect, its closing quote doubled
+func quoteIdentifierPart(name string, dialect database_type.DXDatabaseType) string {
+	switch dialect {
+	case database_type.MySQL:
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	case database_type.SQLServer:
+		return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+	default:
+		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+	}
+}
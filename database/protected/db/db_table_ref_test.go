@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/database/dbtest"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// The table names of each kind, reserved words, mixed case, schema-qualified and pre-quoted, as quoted on each dialect
+func TestQuoteIdentifierForDBTableNames(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// want is the quoted name on postgres, mysql, sqlserver and oracle
+		want [4]string
+	}{
+		// Reserved words
+		{"user", [4]string{`"user"`, "`user`", `[user]`, `"USER"`}},
+		{"order.select", [4]string{`"order"."select"`, "`order`.`select`", `[order].[select]`, `"ORDER"."SELECT"`}},
+		// Mixed case, folded like the database folds the unquoted names
+		{"Analytics.Events", [4]string{`"analytics"."events"`, "`Analytics`.`Events`", `[Analytics].[Events]`, `"ANALYTICS"."EVENTS"`}},
+		{"app.dbo.Orders", [4]string{`"app"."dbo"."orders"`, "`app`.`dbo`.`Orders`", `[app].[dbo].[Orders]`, `"APP"."DBO"."ORDERS"`}},
+		// Pre-quoted in any of the quotes, kept as it is and quoted for the dialect
+		{`"Analytics"."Events"`, [4]string{`"Analytics"."Events"`, "`Analytics`.`Events`", `[Analytics].[Events]`, `"Analytics"."Events"`}},
+		{"[dbo].[Orders]", [4]string{`"dbo"."Orders"`, "`dbo`.`Orders`", `[dbo].[Orders]`, `"dbo"."Orders"`}},
+		{"`Order`", [4]string{`"Order"`, "`Order`", `[Order]`, `"Order"`}},
+		// A quoted part mixed with a plain one
+		{`Analytics."Events"`, [4]string{`"analytics"."Events"`, "`Analytics`.`Events`", `[Analytics].[Events]`, `"ANALYTICS"."Events"`}},
+		// A dot, a space or a quote inside a quoted part does not split it, the quote of the dialect is doubled
+		{`"my.schema".events`, [4]string{`"my.schema"."events"`, "`my.schema`.`events`", `[my.schema].[events]`, `"my.schema"."EVENTS"`}},
+		{`"order items"`, [4]string{`"order items"`, "`order items`", `[order items]`, `"order items"`}},
+		{`"a""b"`, [4]string{`"a""b"`, "`a\"b`", `[a"b]`, `"a""b"`}},
+		{"[a]]b]", [4]string{`"a]b"`, "`a]b`", `[a]]b]`, `"a]b"`}},
+		{"`a``b`", [4]string{`"a` + "`" + `b"`, "`a``b`", "[a`b]", `"a` + "`" + `b"`}},
+		// The columns of a table
+		{"orders.*", [4]string{`"orders".*`, "`orders`.*", `[orders].*`, `"ORDERS".*`}},
+	} {
+		for i, driverName := range []string{"postgres", "mysql", "sqlserver", "oracle"} {
+			got, err := QuoteIdentifierForDB(tc.name, driverName)
+			if err != nil {
+				t.Errorf("%s on %s: %v", tc.name, driverName, err)
+				continue
+			}
+			if got != tc.want[i] {
+				t.Errorf("%s on %s: %s, want %s", tc.name, driverName, got, tc.want[i])
+			}
+		}
+	}
+}
+
+func TestQuoteIdentifierForDBRejectsInvalidTableNames(t *testing.T) {
+	for name, wantError := range map[string]string{
+		"":                       "SQL_IDENTIFIER_EMPTY",
+		"a..b":                   "SQL_IDENTIFIER_EMPTY_PART",
+		"a.":                     "SQL_IDENTIFIER_EMPTY_PART",
+		".a":                     "SQL_IDENTIFIER_EMPTY_PART",
+		`""`:                     "SQL_IDENTIFIER_EMPTY_PART",
+		`"abc`:                   "SQL_IDENTIFIER_UNTERMINATED_QUOTE",
+		"[abc":                   "SQL_IDENTIFIER_UNTERMINATED_QUOTE",
+		`"a"b`:                   "SQL_IDENTIFIER_INVALID_CHARACTER",
+		"users; DROP TABLE x":    "SQL_IDENTIFIER_INVALID_CHARACTER",
+		"users--":                "SQL_IDENTIFIER_INVALID_CHARACTER",
+		`users" OR "1"="1`:       "SQL_IDENTIFIER_INVALID_CHARACTER",
+		"1users":                 "SQL_IDENTIFIER_INVALID_CHARACTER",
+		"*.users":                "SQL_IDENTIFIER_INVALID_CHARACTER",
+		"\"a\nb\"":               "SQL_IDENTIFIER_INVALID_CHARACTER",
+		strings.Repeat("a", 200): "SQL_IDENTIFIER_TOO_LONG",
+	} {
+		for _, driverName := range []string{"postgres", "mysql", "sqlserver", "oracle"} {
+			_, err := QuoteIdentifierForDB(name, driverName)
+			if err == nil || !strings.HasPrefix(err.Error(), wantError) {
+				t.Errorf("%q on %s: %v, want %s", name, driverName, err, wantError)
+			}
+		}
+	}
+}
+
+func TestParseTableRef(t *testing.T) {
+	for name, want := range map[string]TableRef{
+		"events":                  {Name: "events"},
+		"analytics.events":        {Schema: "analytics", Name: "events"},
+		"[dbo].[Orders]":          {Schema: "[dbo]", Name: "[Orders]"},
+		`app."my.schema".Order`:   {Database: "app", Schema: `"my.schema"`, Name: "Order"},
+		`"user"`:                  {Name: `"user"`},
+		"`analytics`.`Events`":    {Schema: "`analytics`", Name: "`Events`"},
+		`Analytics."Mixed.Case"`:  {Schema: "Analytics", Name: `"Mixed.Case"`},
+		`"a""b".[c]]d]`:           {Schema: `"a""b"`, Name: "[c]]d]"},
+		"app.dbo.orders":          {Database: "app", Schema: "dbo", Name: "orders"},
+		"Analytics.Events":        {Schema: "Analytics", Name: "Events"},
+		`"Analytics"."Events"`:    {Schema: `"Analytics"`, Name: `"Events"`},
+		"`order`":                 {Name: "`order`"},
+		"order.select":            {Schema: "order", Name: "select"},
+		"[app].[dbo].[Orders]":    {Database: "[app]", Schema: "[dbo]", Name: "[Orders]"},
+		`"app"."dbo"."Orders"`:    {Database: `"app"`, Schema: `"dbo"`, Name: `"Orders"`},
+		"app.dbo.[Order Details]": {Database: "app", Schema: "dbo", Name: "[Order Details]"},
+	} {
+		got, err := ParseTableRef(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: %+v, want %+v", name, got, want)
+		}
+		if got.String() != name {
+			t.Errorf("%s: the string is %s", name, got.String())
+		}
+	}
+	for _, name := range []string{"a.b.c.d", "orders.*", "*", "a..b", `"abc`} {
+		_, err := ParseTableRef(name)
+		if err == nil {
+			t.Errorf("%s is parsed", name)
+		}
+	}
+}
+
+func TestTableRefQuote(t *testing.T) {
+	for _, tc := range []struct {
+		table      TableRef
+		driverName string
+		want       string
+	}{
+		{TableRef{Schema: "Analytics", Name: "Events"}, "postgres", `"analytics"."events"`},
+		{TableRef{Schema: `"Analytics"`, Name: `"Events"`}, "postgres", `"Analytics"."Events"`},
+		{TableRef{Schema: "app", Name: "user"}, "oracle", `"APP"."USER"`},
+		{TableRef{Database: "app", Schema: "dbo", Name: "[Order Details]"}, "sqlserver", `[app].[dbo].[Order Details]`},
+		{TableRef{Name: "order"}, "mysql", "`order`"},
+	} {
+		got, err := tc.table.Quote(tc.driverName)
+		if err != nil || got != tc.want {
+			t.Errorf("%+v on %s: %s, %v, want %s", tc.table, tc.driverName, got, err, tc.want)
+		}
+	}
+	_, err := TableRef{Schema: "app", Name: "users; DROP TABLE x"}.Quote("postgres")
+	if err == nil {
+		t.Error("an invalid table name is quoted")
+	}
+}
+
+// tableNameHandler is reservedWordHandler answering the counts too
+func tableNameHandler(ctx context.Context, s dbtest.DXFakeStatement) dbtest.DXFakeResult {
+	if strings.Contains(strings.ToLower(s.Query), "count(") {
+		return dbtest.DXFakeResult{Columns: []string{"s___total_rows"}, Rows: [][]any{{int64(1)}}}
+	}
+	return reservedWordHandler(ctx, s)
+}
+
+// The helpers write the table, plain, reserved, mixed case, qualified or pre-quoted, as QuoteIdentifierForDB quotes it
+func TestHelpersQuoteTableNames(t *testing.T) {
+	for _, driverName := range []string{"postgres", "mysql", "sqlserver", "oracle"} {
+		for _, tableName := range []string{"order", "Analytics.Events", `"Analytics"."Events"`, "[dbo].[Order Details]",
+			TableRef{Schema: "app", Name: `"User"`}.String()} {
+			quoted, err := QuoteIdentifierForDB(tableName, driverName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for operation, run := range map[string]func(f *dbtest.DXFakeDatabase) error{
+				"select": func(f *dbtest.DXFakeDatabase) error {
+					_, _, err := Select(f.DB, nil, tableName, nil, utils.JSON{"id": 1}, nil, nil, nil)
+					return err
+				},
+				"count": func(f *dbtest.DXFakeDatabase) error {
+					_, _, err := ShouldSelectCount(f.DB, tableName, "", utils.JSON{"id": 1}, nil)
+					return err
+				},
+				"insert": func(f *dbtest.DXFakeDatabase) error {
+					_, err := Insert(f.DB, tableName, "id", utils.JSON{"code": "A"})
+					return err
+				},
+				"update": func(f *dbtest.DXFakeDatabase) error {
+					_, err := Update(f.DB, tableName, utils.JSON{"code": "B"}, utils.JSON{"id": 1})
+					return err
+				},
+				"delete": func(f *dbtest.DXFakeDatabase) error {
+					_, err := Delete(f.DB, tableName, utils.JSON{"id": 1})
+					return err
+				},
+			} {
+				f := dbtest.Open(driverName, tableNameHandler)
+				err := run(f)
+				queries := f.Queries()
+				_ = f.Close()
+				if err != nil {
+					t.Errorf("%s %s on %s: %v", operation, tableName, driverName, err)
+					continue
+				}
+				if len(queries) != 1 || !strings.Contains(queries[0], " "+quoted+" ") && !strings.HasSuffix(queries[0], " "+quoted) {
+					t.Errorf("%s %s on %s: %q has not %s", operation, tableName, driverName, queries, quoted)
+				}
+			}
+		}
+	}
+}
+
+// Introspection looks the schema and the table up like the helpers name them
+func TestIntrospectionLiteralsOfTableNames(t *testing.T) {
+	for _, tc := range []struct {
+		tableName  string
+		driverName string
+		schema     string
+		table      string
+	}{
+		{"Orders", "postgres", "current_schema()", "'orders'"},
+		{`"Orders"`, "postgres", "current_schema()", "'Orders'"},
+		{"Analytics.Events", "postgres", "'analytics'", "'events'"},
+		{`"Analytics"."Events"`, "postgres", "'Analytics'", "'Events'"},
+		{"app.user", "oracle", "'APP'", "'USER'"},
+		{`app."Mixed"`, "oracle", "'APP'", "'Mixed'"},
+		{"[dbo].[Order Details]", "sqlserver", "N'dbo'", "N'Order Details'"},
+		{"order", "mysql", "DATABASE()", "'order'"},
+		{"`it's`", "mysql", "DATABASE()", "'it''s'"},
+	} {
+		schema, table, err := introspectionLiterals(tc.tableName, tc.driverName)
+		if err != nil || schema != tc.schema || table != tc.table {
+			t.Errorf("%s on %s: %s %s %v, want %s %s", tc.tableName, tc.driverName, schema, table, err, tc.schema, tc.table)
+		}
+	}
+	_, _, err := introspectionLiterals("app.dbo.orders", "sqlserver")
+	if err == nil || !strings.HasPrefix(err.Error(), "INTROSPECTION_CROSS_DATABASE_UNSUPPORTED") {
+		t.Errorf("err %v", err)
+	}
+}
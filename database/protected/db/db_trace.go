@@ -0,0 +1,172 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+const TracerName = "github.com/donnyhardyanto/dxlib/database"
+
+// IncludeStatementInSpan attaches the statement of a query to its span as db.statement. It is the statement as sent, with the
+// named parameters and not their values. The SQLExpression of a where or a set are written in it as they are.
+var IncludeStatementInSpan = false
+
+// IsConnectionAcquireSpanEnabled adds a span "db.connection.acquire" around the begin of a transaction, where the time waited
+// for a connection of the pool is spent
+var IsConnectionAcquireSpanEnabled = false
+
+// databaseNames is the db.name of the connections registered by SetTraceDatabaseName
+var databaseNames sync.Map
+
+// SetTraceDatabaseName names the database of connection in the spans of its queries, an empty name forgets it
+func SetTraceDatabaseName(connection *sqlx.DB, name string) {
+	if connection == nil {
+		return
+	}
+	if name == "" {
+		databaseNames.Delete(connection)
+		return
+	}
+	databaseNames.Store(connection, name)
+}
+
+func traceDatabaseName(connection *sqlx.DB) string {
+	name, _ := databaseNames.Load(connection)
+	s, _ := name.(string)
+	return s
+}
+
+// traceDBSystem is the db.system of the OpenTelemetry semantic conventions for driverName
+func traceDBSystem(driverName string) string {
+	switch driverName {
+	case "postgres":
+		return "postgresql"
+	case "sqlserver":
+		return "mssql"
+	default:
+		return driverName
+	}
+}
+
+type QuerySpan struct {
+	span trace.Span
+	// debug is the DebugSQL logging the query, nil when it is not logged, the fields after it are only kept for it
+	debug           *DebugSQL
+	debugDriverName string
+	debugOperation  string
+	debugTableName  string
+	debugStartTime  time.Time
+	debugStatement  string
+	debugArguments  utils.JSON
+	debugRowsField  string
+	debugRowCount   int64
+}
+
+// StartQuerySpan starts the span of a query named like "db.select orders", a child of the span of ctx. A nil ctx starts a new
+// trace, the helpers without a context do until they have their Context variant. The query is logged by the DebugSQL of ctx,
+// see ContextWithDebugSQL.
+func StartQuerySpan(ctx context.Context, driverName string, databaseName string, operation string, tableName string) (context.Context, *QuerySpan) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	attributes := []attribute.KeyValue{
+		attribute.String("db.system", traceDBSystem(driverName)),
+		attribute.String("db.operation", operation),
+	}
+	if databaseName != "" {
+		attributes = append(attributes, attribute.String("db.name", databaseName))
+	}
+	name := "db." + operation
+	if tableName != "" {
+		attributes = append(attributes, attribute.String("db.sql.table", tableName))
+		name += " " + tableName
+	}
+	ctx, span := otel.Tracer(TracerName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+	s := &QuerySpan{span: span}
+	s.startDebug(debugSQLFromContext(ctx), driverName, operation, tableName)
+	return ctx, s
+}
+
+func startQuerySpan(ctx context.Context, db *sqlx.DB, operation string, tableName string) *QuerySpan {
+	_, s := StartQuerySpan(ctx, db.DriverName(), traceDatabaseName(db), operation, tableName)
+	s.startDebug(debugSQLOf(db), db.DriverName(), operation, tableName)
+	return s
+}
+
+// SetStatement attaches statement when IncludeStatementInSpan
+func (s *QuerySpan) SetStatement(statement string) {
+	if IncludeStatementInSpan && statement != "" {
+		s.span.SetAttributes(attribute.String("db.statement", statement))
+	}
+	if s.debug != nil {
+		s.debugStatement = statement
+	}
+}
+
+// SetArguments keeps the named parameters the statement is run with, for its DebugSQL
+func (s *QuerySpan) SetArguments(arguments utils.JSON) {
+	if s.debug != nil {
+		s.debugArguments = arguments
+	}
+}
+
+// EndWithRows ends the span of a query returning rowCount rows
+func (s *QuerySpan) EndWithRows(rowCount int, err error) {
+	if err == nil {
+		s.span.SetAttributes(attribute.Int("db.rows_returned", rowCount))
+		s.debugRowsField, s.debugRowCount = "rows_returned", int64(rowCount)
+	}
+	s.End(err)
+}
+
+// EndWithRowsAffected ends the span of a write, the rows affected are the ones told by the driver
+func (s *QuerySpan) EndWithRowsAffected(rowCount int64, err error) {
+	if err == nil && rowCount >= 0 {
+		s.span.SetAttributes(attribute.Int64("db.rows_affected", rowCount))
+		s.debugRowsField, s.debugRowCount = "rows_affected", rowCount
+	}
+	s.End(err)
+}
+
+func (s *QuerySpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+	if s.debug != nil {
+		s.logDebug(err)
+	}
+}
+
+// RowsAffected is the count of rows told by r, -1 when the driver does not tell it
+func RowsAffected(r sql.Result) int64 {
+	if r == nil {
+		return -1
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// StartConnectionAcquireSpan starts the span "db.connection.acquire" on connection when IsConnectionAcquireSpanEnabled, the
+// returned func ends it
+func StartConnectionAcquireSpan(ctx context.Context, connection *sqlx.DB) (end func(err error)) {
+	if !IsConnectionAcquireSpanEnabled {
+		return func(err error) {}
+	}
+	_, s := StartQuerySpan(ctx, connection.DriverName(), traceDatabaseName(connection), "connection.acquire", "")
+	return s.End
+}
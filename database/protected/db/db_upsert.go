@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+	"github.com/donnyhardyanto/dxlib/database/sqlchecker"
+	"github.com/donnyhardyanto/dxlib/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLPartUpsert builds through dialect the upsert of keyValues in tableName, the row having the values of conflictKeyFields
+// updated with the other fields of keyValues when it exists. Each conflict field has to be in keyValues.
+func SQLPartUpsert(dialect Dialect, tableName string, conflictKeyFields []string, keyValues utils.JSON) (s string, err error) {
+	if len(conflictKeyFields) == 0 {
+		return ``, fmt.Errorf("UPSERT_CONFLICT_KEY_FIELDS_EMPTY:%s", tableName)
+	}
+	driverName := dialect.DatabaseType().Driver()
+	t, err := dialect.QuoteIdentifier(tableName)
+	if err != nil {
+		return ``, err
+	}
+	keys := make([]string, 0, len(keyValues))
+	for k := range keyValues {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fieldNames := make([]string, len(keys))
+	fieldValues := make([]string, len(keys))
+	for i, k := range keys {
+		v := keyValues[k]
+		if driverName == "oracle" {
+			k = strings.ToUpper(k)
+		}
+		fieldNames[i], err = dialect.QuoteIdentifier(k)
+		if err != nil {
+			return ``, err
+		}
+		switch v.(type) {
+		case SQLExpression:
+			fieldValues[i] = v.(SQLExpression).String()
+		default:
+			fieldValues[i] = `:` + k
+		}
+	}
+	conflictFieldNames := make([]string, len(conflictKeyFields))
+	for i, k := range conflictKeyFields {
+		if _, ok := keyValues[k]; !ok {
+			return ``, fmt.Errorf("UPSERT_CONFLICT_KEY_FIELD_NOT_IN_VALUES:%s:%s", tableName, k)
+		}
+		conflictFieldNames[i] = fieldNames[slices.Index(keys, k)]
+	}
+	return dialect.BuildUpsert(t, fieldNames, fieldValues, conflictFieldNames), nil
+}
+
+// Upsert inserts keyValues in tableName or, when a row has the values of conflictKeyFields, updates that row with the other
+// fields of keyValues. The rows affected are the ones of the database, MySQL counts an updated row twice.
+func Upsert(db *sqlx.DB, tableName string, conflictKeyFields []string, keyValues utils.JSON) (r sql.Result, err error) {
+	return UpsertContext(context.Background(), db, tableName, conflictKeyFields, keyValues)
+}
+
+func UpsertContext(ctx context.Context, db *sqlx.DB, tableName string, conflictKeyFields []string, keyValues utils.JSON) (r sql.Result, err error) {
+	defer func() {
+		err = ClassifyError(err)
+	}()
+	span := startQuerySpan(ctx, db, "upsert", tableName)
+	defer func() {
+		span.EndWithRowsAffected(RowsAffected(r), err)
+	}()
+	driverName := db.DriverName()
+	dialect, err := DialectOf(driverName)
+	if err != nil {
+		return nil, err
+	}
+	s, err := CachedUpsertStatement(dialect, tableName, conflictKeyFields, keyValues)
+	if err != nil {
+		return nil, err
+	}
+	span.SetStatement(s)
+	kv := ExcludeSQLExpression(keyValues, driverName)
+	span.SetArguments(kv)
+	if dialect.DatabaseType() == database_type.Oracle {
+		return OracleExecContext(ctx, db, s, kv)
+	}
+	err = sqlchecker.CheckAll(driverName, s, kv)
+	if err != nil {
+		return nil, fmt.Errorf("SQL_INJECTION_DETECTED:VALIDATION_FAILED: %w", err)
+	}
+	return sqlx.NamedExecContext(ctx, ConnectionOf(ctx, db), s+UpsertStatementTerminator(driverName), kv)
+}
+
+// OracleExecContext executes s on Oracle with each of kv, keyed like by ExcludeSQLExpression, as its named argument
+func OracleExecContext(ctx context.Context, db Preparer, s string, kv utils.JSON) (r sql.Result, err error) {
+	var fieldArgs []any
+	for k, v := range kv {
+		fieldArgs = append(fieldArgs, sql.Named(k, v))
+	}
+	err = sqlchecker.CheckAll(db.DriverName(), s, fieldArgs)
+	if err != nil {
+		return nil, fmt.Errorf("SQL_INJECTION_DETECTED:VALIDATION_FAILED: %w", err)
+	}
+	stmt, err := preparerOf(ctx, db).PrepareContext(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+	return stmt.ExecContext(ctx, fieldArgs...)
+}
@@ -1,14 +1,15 @@
 package dbtx
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	databaseProtectedUtils "github.com/donnyhardyanto/dxlib/database/protected/utils"
 	"github.com/donnyhardyanto/dxlib/database/sqlchecker"
 	"github.com/jmoiron/sqlx"
-	"strings"
 
+	"github.com/donnyhardyanto/dxlib/database/database_type"
 	"github.com/donnyhardyanto/dxlib/database/protected/db"
 	"github.com/donnyhardyanto/dxlib/log"
 	"github.com/donnyhardyanto/dxlib/utils"
@@ -16,14 +17,46 @@ import (
 
 type TxCallback func(tx *sqlx.Tx, log *log.DXLog) (err error)
 
-func Tx(log *log.DXLog, db *sqlx.DB, isolationLevel sql.IsolationLevel, callback TxCallback) (err error) {
-	driverName := db.DriverName()
+// startQuerySpan starts the span of a query of tx as a child of the span of the context of log, the request one for the
+// transaction of a request
+func startQuerySpan(log *log.DXLog, tx *sqlx.Tx, operation string, tableName string) *db.QuerySpan {
+	var ctx context.Context
+	if log != nil {
+		ctx = log.Context
+	}
+	_, span := db.StartQuerySpan(ctx, tx.DriverName(), "", operation, tableName)
+	return span
+}
+
+// rollbackOnError rolls tx back when autoRollback and err, for the Oracle statements that are not run by the Tx helpers
+func rollbackOnError(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, err error) {
+	if err == nil || !autoRollback {
+		return
+	}
+	errTx := tx.Rollback()
+	if errTx != nil {
+		log.Errorf(`SHOULD_NOT_HAPPEN:ERROR_IN_ROLLBACK(%v)`, errTx.Error())
+	}
+}
+
+// txOracleSelect runs the select s built by db.SQLPartConstructSelect on tx
+func txOracleSelect(log *log.DXLog, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, autoRollback bool, tx *sqlx.Tx, s string,
+	whereAndFieldNameValues utils.JSON) (rowsInfo *db.RowsInfo, r []utils.JSON, err error) {
+	rowsInfo, r, err = db.OracleQueryRows(tx, fieldTypeMapping, s, db.OracleWhereArgs(whereAndFieldNameValues)...)
+	rollbackOnError(log, autoRollback, tx, err)
+	return rowsInfo, r, err
+}
+
+func Tx(log *log.DXLog, connection *sqlx.DB, isolationLevel sql.IsolationLevel, callback TxCallback) (err error) {
+	driverName := connection.DriverName()
 	switch driverName {
 	case "oracle":
-		tx, err := db.BeginTxx(log.Context, &sql.TxOptions{
+		endAcquireSpan := db.StartConnectionAcquireSpan(log.Context, connection)
+		tx, err := connection.BeginTxx(log.Context, &sql.TxOptions{
 			Isolation: isolationLevel,
 			ReadOnly:  false,
 		})
+		endAcquireSpan(err)
 		if err != nil {
 			log.Error(err.Error())
 			return err
@@ -49,10 +82,12 @@ func Tx(log *log.DXLog, db *sqlx.DB, isolationLevel sql.IsolationLevel, callback
 
 		return nil
 	}
-	tx, err := db.BeginTxx(log.Context, &sql.TxOptions{
+	endAcquireSpan := db.StartConnectionAcquireSpan(log.Context, connection)
+	tx, err := connection.BeginTxx(log.Context, &sql.TxOptions{
 		Isolation: isolationLevel,
 		ReadOnly:  false,
 	})
+	endAcquireSpan(err)
 	if err != nil {
 		log.Error(err.Error())
 		return err
@@ -80,6 +115,9 @@ func Tx(log *log.DXLog, db *sqlx.DB, isolationLevel sql.IsolationLevel, callback
 }
 
 func TxNamedQuery(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, query string, args any) (rows *sqlx.Rows, err error) {
+	defer func() {
+		err = db.ClassifyError(err)
+	}()
 	err = sqlchecker.CheckAll(tx.DriverName(), query, args)
 	if err != nil {
 		return nil, fmt.Errorf("SQL_INJECTION_DETECTED:VALIDATION_FAILED: %w", err)
@@ -99,6 +137,9 @@ func TxNamedQuery(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, query string,
 }
 
 func TxNamedExec(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, query string, args any) (r sql.Result, err error) {
+	defer func() {
+		err = db.ClassifyError(err)
+	}()
 	err = sqlchecker.CheckAll(tx.DriverName(), query, args)
 	if err != nil {
 		return nil, fmt.Errorf("SQL_INJECTION_DETECTED:VALIDATION_FAILED: %w", err)
@@ -147,6 +188,9 @@ func TxShouldNamedQueryIdBig(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, que
 }
 
 func TxNamedQueryRows(log *log.DXLog, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, autoRollback bool, tx *sqlx.Tx, query string, arg any) (rowsInfo *db.RowsInfo, r []utils.JSON, err error) {
+	defer func() {
+		err = db.ClassifyError(err)
+	}()
 	rows, err := TxNamedQuery(log, autoRollback, tx, query, arg)
 	if err != nil {
 		return nil, nil, err
@@ -184,6 +228,9 @@ func TxNamedQueryRows(log *log.DXLog, fieldTypeMapping databaseProtectedUtils.Fi
 }
 
 func TxNamedQueryRow(log *log.DXLog, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, autoRollback bool, tx *sqlx.Tx, query string, arg any) (rowsInfo *db.RowsInfo, r utils.JSON, err error) {
+	defer func() {
+		err = db.ClassifyError(err)
+	}()
 	rows, err := TxNamedQuery(log, autoRollback, tx, query, arg)
 	if err != nil {
 		return nil, nil, err
@@ -221,12 +268,15 @@ func TxNamedQueryRow(log *log.DXLog, fieldTypeMapping databaseProtectedUtils.Fie
 }
 
 func TxShouldNamedQueryRow(log *log.DXLog, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, autoRollback bool, tx *sqlx.Tx, query string, arg any) (rowsInfo *db.RowsInfo, r utils.JSON, err error) {
+	defer func() {
+		err = db.ClassifyError(err)
+	}()
 	rowsInfo, row, err := TxNamedQueryRow(log, fieldTypeMapping, autoRollback, tx, query, arg)
 	if err != nil {
 		return rowsInfo, row, err
 	}
 	if row == nil {
-		err := errors.New(`ROW_MUST_EXIST:` + query)
+		err := db.WrapError(db.ErrNoRows, "", errors.New(`ROW_MUST_EXIST:`+query))
 		errTx := tx.Rollback()
 		if errTx != nil {
 			log.Errorf(`SHOULD_NOT_HAPPEN:ERROR_IN_ROLLBACK(%v)`, errTx.Error())
@@ -250,16 +300,42 @@ func TxShouldNamedQueryRow(log *log.DXLog, fieldTypeMapping databaseProtectedUti
 
 func TxShouldSelectOne(log *log.DXLog, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, autoRollback bool, tx *sqlx.Tx, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string, forUpdatePart any) (rowsInfo *db.RowsInfo, r utils.JSON, err error) {
+	defer func() {
+		err = db.ClassifyError(err)
+	}()
+	span := startQuerySpan(log, tx, "select", tableName)
+	defer func() {
+		rowCount := 0
+		if r != nil {
+			rowCount = 1
+		}
+		span.EndWithRows(rowCount, err)
+	}()
 	driverName := tx.DriverName()
 	s, err := db.SQLPartConstructSelect(driverName, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, 1, forUpdatePart)
 	if err != nil {
-		err := fmt.Errorf(`%s:%s`, err, tableName)
+		err := fmt.Errorf(`%w:%s`, err, tableName)
 		return rowsInfo, nil, err
 	}
+	span.SetStatement(s)
+	if driverName == "oracle" {
+		span.SetArguments(whereAndFieldNameValues)
+		rowsInfo, rows, err := txOracleSelect(log, fieldTypeMapping, autoRollback, tx, s, whereAndFieldNameValues)
+		if err != nil {
+			return rowsInfo, nil, fmt.Errorf(`%w:%s`, err, tableName)
+		}
+		if len(rows) < 1 {
+			err = db.WrapError(db.ErrNoRows, "", errors.New(`ROW_MUST_EXIST:`+s))
+			rollbackOnError(log, true, tx, err)
+			return rowsInfo, nil, fmt.Errorf(`%w:%s`, err, tableName)
+		}
+		return rowsInfo, rows[0], nil
+	}
 	wKV := db.ExcludeSQLExpression(whereAndFieldNameValues, driverName)
+	span.SetArguments(wKV)
 	rowsInfo, r, err = TxShouldNamedQueryRow(log, fieldTypeMapping, autoRollback, tx, s, wKV)
 	if err != nil {
-		err := fmt.Errorf(`%s:%s`, err, tableName)
+		err := fmt.Errorf(`%w:%s`, err, tableName)
 		return rowsInfo, nil, err
 	}
 	return rowsInfo, r, err
@@ -267,104 +343,142 @@ func TxShouldSelectOne(log *log.DXLog, fieldTypeMapping databaseProtectedUtils.F
 
 func TxSelect(log *log.DXLog, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, autoRollback bool, tx *sqlx.Tx, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string, limit any, forUpdatePart any) (rowsInfo *db.RowsInfo, r []utils.JSON, err error) {
+	defer func() {
+		err = db.ClassifyError(err)
+	}()
+	span := startQuerySpan(log, tx, "select", tableName)
+	defer func() {
+		span.EndWithRows(len(r), err)
+	}()
 	driverName := tx.DriverName()
 	s, err := db.SQLPartConstructSelect(driverName, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, limit, forUpdatePart)
 	if err != nil {
 		return nil, nil, err
 	}
+	span.SetStatement(s)
+	if driverName == "oracle" {
+		span.SetArguments(whereAndFieldNameValues)
+		rowsInfo, r, err = txOracleSelect(log, fieldTypeMapping, autoRollback, tx, s, whereAndFieldNameValues)
+		return rowsInfo, r, err
+	}
 	wKV := db.ExcludeSQLExpression(whereAndFieldNameValues, driverName)
+	span.SetArguments(wKV)
 	rowsInfo, r, err = TxNamedQueryRows(log, fieldTypeMapping, autoRollback, tx, s, wKV)
 	return rowsInfo, r, err
 }
 
 func TxSelectOne(log *log.DXLog, fieldTypeMapping databaseProtectedUtils.FieldTypeMapping, autoRollback bool, tx *sqlx.Tx, tableName string, fieldNames []string, whereAndFieldNameValues utils.JSON, joinSQLPart any,
 	orderbyFieldNameDirections map[string]string, forUpdatePart any) (rowsInfo *db.RowsInfo, r utils.JSON, err error) {
+	defer func() {
+		err = db.ClassifyError(err)
+	}()
+	span := startQuerySpan(log, tx, "select", tableName)
+	defer func() {
+		rowCount := 0
+		if r != nil {
+			rowCount = 1
+		}
+		span.EndWithRows(rowCount, err)
+	}()
 	driverName := tx.DriverName()
 	s, err := db.SQLPartConstructSelect(driverName, tableName, fieldNames, whereAndFieldNameValues, joinSQLPart, orderbyFieldNameDirections, 1, forUpdatePart)
 	if err != nil {
 		return nil, nil, err
 	}
+	span.SetStatement(s)
+	if driverName == "oracle" {
+		span.SetArguments(whereAndFieldNameValues)
+		rowsInfo, rows, err := txOracleSelect(log, fieldTypeMapping, autoRollback, tx, s, whereAndFieldNameValues)
+		if err != nil || len(rows) < 1 {
+			return rowsInfo, nil, err
+		}
+		return rowsInfo, rows[0], nil
+	}
 	wKV := db.ExcludeSQLExpression(whereAndFieldNameValues, driverName)
+	span.SetArguments(wKV)
 	rowsInfo, r, err = TxNamedQueryRow(log, fieldTypeMapping, autoRollback, tx, s, wKV)
 	return rowsInfo, r, err
 }
 
 func OracleTxInsertReturning(tx *sqlx.Tx, tableName string, fieldNameForRowId string, keyValues map[string]interface{}) (int64, error) {
-	tableName = strings.ToUpper(tableName)
-	fieldNameForRowId = strings.ToUpper(fieldNameForRowId)
-	returningClause := fmt.Sprintf("RETURNING %s INTO :new_id", fieldNameForRowId)
-
-	fieldNames, fieldValues, fieldArgs := databaseProtectedUtils.PrepareArrayArgs(keyValues, tx.DriverName())
+	return db.OracleInsertReturning(tx, tableName, fieldNameForRowId, keyValues)
+}
 
-	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) %s", tableName, fieldNames, fieldValues, returningClause)
+func TxInsert(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string, keyValues utils.JSON) (id int64, err error) {
+	return TxInsertReturning(log, autoRollback, tx, tableName, `id`, keyValues)
+}
 
-	stmt, err := tx.Prepare(query)
-	if err != nil {
-		return 0, err
-	}
+// TxInsertReturning is TxInsert returning the value of fieldNameForRowId of the new row instead of the id field
+func TxInsertReturning(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string, fieldNameForRowId string, keyValues utils.JSON) (id int64, err error) {
 	defer func() {
-		_ = stmt.Close()
+		err = db.ClassifyError(err)
 	}()
-
-	// Add the returning parameter
-	newId := int64(99)
-	fieldArgs = append(fieldArgs, sql.Named("new_id", sql.Out{Dest: &newId}))
-
-	err = sqlchecker.CheckAll(tx.DriverName(), query, fieldArgs)
+	span := startQuerySpan(log, tx, "insert", tableName)
+	defer func() {
+		span.EndWithRowsAffected(1, err)
+	}()
+	driverName := tx.DriverName()
+	dialect, err := db.DialectOf(driverName)
 	if err != nil {
-		return 0, fmt.Errorf("SQL_INJECTION_DETECTED:VALIDATION_FAILED: %w", err)
+		return 0, err
 	}
-
-	// Execute the statement
-	_, err = stmt.Exec(fieldArgs...)
+	if dialect.DatabaseType() == database_type.Oracle {
+		id, err = OracleTxInsertReturning(tx, tableName, fieldNameForRowId, keyValues)
+		rollbackOnError(log, autoRollback, tx, err)
+		return id, err
+	}
+	s, mode, err := db.CachedInsertStatement(dialect, tableName, fieldNameForRowId, keyValues)
 	if err != nil {
 		return 0, err
 	}
-
-	return newId, nil
-}
-
-func TxInsert(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string, keyValues utils.JSON) (id int64, err error) {
-	driverName := tx.DriverName()
-	fn, fv := db.SQLPartInsertFieldNamesFieldValues(keyValues, driverName)
-	s := ``
-	switch driverName {
-	case "postgres":
-		s = `INSERT INTO ` + tableName + ` (` + fn + `) VALUES (` + fv + `) RETURNING id`
-	case "sqlserver":
-		s = `INSERT INTO ` + tableName + ` (` + fn + `) OUTPUT INSERTED.id VALUES (` + fv + `)`
-	case "oracle":
-		id, err = OracleTxInsertReturning(tx, tableName, `id`, keyValues)
+	span.SetStatement(s)
+	kv := db.ExcludeSQLExpression(keyValues, driverName)
+	span.SetArguments(kv)
+	if mode == db.InsertReturningByLastInsertId {
+		result, err := TxNamedExec(log, autoRollback, tx, s, kv)
 		if err != nil {
 			return 0, err
 		}
-		return id, nil
-	default:
-		fmt.Println("Unknown database type. Using Postgresql Dialect")
-		s = `INSERT INTO ` + tableName + ` (` + fn + `) values (` + fv + `) returning id`
+		return result.LastInsertId()
 	}
-	kv := db.ExcludeSQLExpression(keyValues, driverName)
 	id, err = TxShouldNamedQueryIdBig(log, autoRollback, tx, s, kv)
 	return id, err
 }
 
 func TxUpdate(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string, setKeyValues utils.JSON, whereKeyValues utils.JSON) (result sql.Result, err error) {
-	driveName := tx.DriverName()
-	setKeyValues, u := db.SQLPartSetFieldNameValues(setKeyValues, driveName)
-	w := db.SQLPartWhereAndFieldNameValues(whereKeyValues, driveName)
-	joinedKeyValues := db.MergeMapExcludeSQLExpression(setKeyValues, whereKeyValues, driveName)
+	defer func() {
+		err = db.ClassifyError(err)
+	}()
+	span := startQuerySpan(log, tx, "update", tableName)
+	defer func() {
+		span.EndWithRowsAffected(db.RowsAffected(result), err)
+	}()
 	driverName := tx.DriverName()
-	var s string
-	switch driverName {
-	case "postgres":
-		s = `update ` + tableName + ` set ` + u + ` where ` + w
-	case "sqlserver":
-		s = `update ` + tableName + ` set ` + u + ` where ` + w
-	case "oracle":
-		return nil, errors.New("unknown database type, using Postgresql Dialect")
-	default:
-		return nil, errors.New("unknown database type, using Postgresql Dialect")
+	if driverName == "oracle" {
+		result, err = db.OracleEdit(tx, tableName, setKeyValues, whereKeyValues)
+		rollbackOnError(log, autoRollback, tx, err)
+		return result, err
+	}
+	dialect, err := db.DialectOf(driverName)
+	if err != nil {
+		return nil, err
+	}
+	tableName, err = dialect.QuoteIdentifier(tableName)
+	if err != nil {
+		return nil, err
+	}
+	setKeyValues, u, err := db.SQLPartSetFieldNameValues(setKeyValues, driverName)
+	if err != nil {
+		return nil, err
+	}
+	w, err := db.SQLPartWhereAndFieldNameValues(whereKeyValues, driverName)
+	if err != nil {
+		return nil, err
 	}
+	joinedKeyValues := db.MergeMapExcludeSQLExpression(setKeyValues, whereKeyValues, driverName)
+	s := `update ` + tableName + ` set ` + u + ` where ` + w
+	span.SetStatement(s)
+	span.SetArguments(joinedKeyValues)
 	result, err = TxNamedExec(log, autoRollback, tx, s, joinedKeyValues)
 	return result, err
 }
@@ -394,10 +508,66 @@ func TxUpdate(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string,
 }*/
 
 func TxDelete(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string, whereAndFieldNameValues utils.JSON) (r sql.Result, err error) {
+	defer func() {
+		err = db.ClassifyError(err)
+	}()
+	span := startQuerySpan(log, tx, "delete", tableName)
+	defer func() {
+		span.EndWithRowsAffected(db.RowsAffected(r), err)
+	}()
 	driverName := tx.DriverName()
-	w := db.SQLPartWhereAndFieldNameValues(whereAndFieldNameValues, driverName)
+	if driverName == "oracle" {
+		r, err = db.OracleDelete(tx, tableName, whereAndFieldNameValues)
+		rollbackOnError(log, autoRollback, tx, err)
+		return r, err
+	}
+	tableName, err = db.QuoteIdentifierForDB(tableName, driverName)
+	if err != nil {
+		return nil, err
+	}
+	w, err := db.SQLPartWhereAndFieldNameValues(whereAndFieldNameValues, driverName)
+	if err != nil {
+		return nil, err
+	}
 	s := `delete from ` + tableName + ` where ` + w
 	wKV := db.ExcludeSQLExpression(whereAndFieldNameValues, driverName)
+	span.SetStatement(s)
+	span.SetArguments(wKV)
 	r, err = TxNamedExec(log, autoRollback, tx, s, wKV)
 	return r, err
 }
+
+// TxUpsert is db.Upsert in tx
+func TxUpsert(log *log.DXLog, autoRollback bool, tx *sqlx.Tx, tableName string, conflictKeyFields []string, keyValues utils.JSON) (r sql.Result, err error) {
+	defer func() {
+		err = db.ClassifyError(err)
+	}()
+	span := startQuerySpan(log, tx, "upsert", tableName)
+	defer func() {
+		span.EndWithRowsAffected(db.RowsAffected(r), err)
+	}()
+	driverName := tx.DriverName()
+	dialect, err := db.DialectOf(driverName)
+	if err != nil {
+		return nil, err
+	}
+	s, err := db.CachedUpsertStatement(dialect, tableName, conflictKeyFields, keyValues)
+	if err != nil {
+		return nil, err
+	}
+	span.SetStatement(s)
+	kv := db.ExcludeSQLExpression(keyValues, driverName)
+	span.SetArguments(kv)
+	if dialect.DatabaseType() == database_type.Oracle {
+		r, err = db.OracleExecContext(context.Background(), tx, s, kv)
+		rollbackOnError(log, autoRollback, tx, err)
+		return r, err
+	}
+	err = sqlchecker.CheckAll(driverName, s, kv)
+	if err != nil {
+		return nil, fmt.Errorf("SQL_INJECTION_DETECTED:VALIDATION_FAILED: %w", err)
+	}
+	r, err = tx.NamedExec(s+db.UpsertStatementTerminator(driverName), kv)
+	rollbackOnError(log, autoRollback, tx, err)
+	return r, err
+}
@@ -76,6 +76,12 @@ func (s *SqlFile) Files(files ...string) error {
 	return nil
 }
 
+// SQL add and load queries from content, named name in the errors
+func (s *SqlFile) SQL(name string, content string) {
+	s.files = append(s.files, name)
+	s.queries = append(s.queries, splitSQLStatements(removeComments(content))...)
+}
+
 // Directory add and load queries from *.sql files in specified directory
 func (s *SqlFile) Directory(dir string) error {
 	files, err := os.ReadDir(dir)
@@ -277,7 +283,8 @@ func load(path string) ([]string, error) {
 	return statements, nil
 }
 
-// Exec executes SQL statements
+// Exec executes SQL statements in one transaction, on error the results of the statements executed before are returned
+// and were rolled back
 func (s *SqlFile) Exec(db *sql.DB) (res []sql.Result, err error) {
 	if db == nil {
 		return nil, fmt.Errorf("nil database connection")
@@ -298,7 +305,7 @@ func (s *SqlFile) Exec(db *sql.DB) (res []sql.Result, err error) {
 
 		r, err := tx.Exec(query)
 		if err != nil {
-			return nil, fmt.Errorf("SQL error: %w\nQuery: %s", err, query)
+			return results, fmt.Errorf("SQL error: %w\nQuery: %s", err, query)
 		}
 		results = append(results, r)
 	}
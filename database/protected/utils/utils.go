@@ -67,7 +67,12 @@ func PrepareArrayArgs(keyValues map[string]any, driverName string) (fieldNames s
 		}
 
 		fieldName := FormatIdentifier(k, driverName)
-		fieldNames += fieldName
+		if driverName == "oracle" {
+			// The column is quoted so a reserved word like USER is a column name, the bind name stays bare
+			fieldNames += `"` + fieldName + `"`
+		} else {
+			fieldNames += fieldName
+		}
 		fieldValues += ":" + fieldName
 
 		var s sql.NamedArg
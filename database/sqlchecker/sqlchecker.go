@@ -2,6 +2,7 @@
 package sqlchecker
 
 import (
+	"database/sql"
 	"fmt"
 	"github.com/donnyhardyanto/dxlib/database/database_type"
 	"github.com/shopspring/decimal"
@@ -155,6 +156,12 @@ func CheckValue(value any) error {
 		return nil
 	case decimal.Decimal:
 		return nil
+	case sql.NamedArg:
+		// The arguments of the Oracle statements
+		return CheckValue(v.Value)
+	case sql.Out:
+		// A destination, not a value sent to the database
+		return nil
 	default:
 		return fmt.Errorf("unsupported value type: %T", value)
 	}
@@ -0,0 +1,19 @@
+package sqlchecker
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestCheckAllOfTheOracleNamedArguments(t *testing.T) {
+	id := int64(0)
+	args := []any{sql.Named("NAME", "a"), sql.Named("NOTE", nil), sql.Named("new_id", sql.Out{Dest: &id})}
+	err := CheckAll("oracle", `INSERT INTO "T" ("NAME", "NOTE") VALUES (:NAME, :NOTE) RETURNING "ID" INTO :new_id`, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CheckAll("oracle", `DELETE FROM "T" WHERE "ID"=:ID`, []any{sql.Named("ID", struct{}{})})
+	if err == nil {
+		t.Fatal("a named argument of an unsupported type was accepted")
+	}
+}
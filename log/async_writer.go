@@ -0,0 +1,79 @@
+package log
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+const DXAsyncWriterDefaultBufferSize = 4096
+
+// DXAsyncWriter hands every Write to a background goroutine through a bounded buffer. When the buffer is full the record is
+// dropped and counted instead of blocking the caller, so a slow disk never stalls request handling.
+type DXAsyncWriter struct {
+	writer       io.Writer
+	records      chan []byte
+	done         chan struct{}
+	droppedCount int64
+	closeOnce    sync.Once
+	closeMutex   sync.RWMutex
+	isClosed     bool
+}
+
+func NewAsyncWriter(w io.Writer, bufferSize int) *DXAsyncWriter {
+	if bufferSize <= 0 {
+		bufferSize = DXAsyncWriterDefaultBufferSize
+	}
+	aw := &DXAsyncWriter{
+		writer:  w,
+		records: make(chan []byte, bufferSize),
+		done:    make(chan struct{}),
+	}
+	go aw.run()
+	return aw
+}
+
+func (aw *DXAsyncWriter) run() {
+	defer close(aw.done)
+	for record := range aw.records {
+		_, _ = aw.writer.Write(record)
+	}
+}
+
+// Write never blocks, p is copied because the caller may reuse it
+func (aw *DXAsyncWriter) Write(p []byte) (n int, err error) {
+	aw.closeMutex.RLock()
+	defer aw.closeMutex.RUnlock()
+	if aw.isClosed {
+		atomic.AddInt64(&aw.droppedCount, 1)
+		return len(p), nil
+	}
+	record := make([]byte, len(p))
+	copy(record, p)
+	select {
+	case aw.records <- record:
+	default:
+		atomic.AddInt64(&aw.droppedCount, 1)
+	}
+	return len(p), nil
+}
+
+func (aw *DXAsyncWriter) DroppedCount() int64 {
+	return atomic.LoadInt64(&aw.droppedCount)
+}
+
+// Close writes out what is still buffered, then closes the underlying writer when it is an io.Closer
+func (aw *DXAsyncWriter) Close() (err error) {
+	aw.closeOnce.Do(func() {
+		aw.closeMutex.Lock()
+		aw.isClosed = true
+		close(aw.records)
+		aw.closeMutex.Unlock()
+		<-aw.done
+		closer, ok := aw.writer.(io.Closer)
+		if ok {
+			err = closer.Close()
+		}
+	})
+	return err
+}
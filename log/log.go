@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"github.com/donnyhardyanto/dxlib/core"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"io"
 	"runtime/debug"
+	"time"
 )
 
 type DXLogLevel int
@@ -40,6 +43,12 @@ const (
 type DXLog struct {
 	Context context.Context
 	Prefix  string
+	// Fields are attached to every record of the log and of the logs derived from it
+	Fields       DXLogFields
+	rateLimitKey string
+	rateLimitPer time.Duration
+	// FatalBehavior overrides the global fatal behavior for this log, see SetFatalBehavior
+	FatalBehavior DXLogFatalBehavior
 }
 
 var Format DXLogFormat
@@ -47,35 +56,116 @@ var Format DXLogFormat
 func NewLog(parentLog *DXLog, context context.Context, prefix string) DXLog {
 	if parentLog != nil {
 		if parentLog.Prefix != "" {
-			prefix = parentLog.Prefix + " | " + prefix
+			prefix = parentLog.Prefix + DXLogPrefixSeparator + prefix
 		}
 	}
 	l := DXLog{Context: context, Prefix: prefix}
+	if parentLog != nil && len(parentLog.Fields) > 0 {
+		l.Fields = DXLogFields{}
+		for k, v := range parentLog.Fields {
+			l.Fields[k] = v
+		}
+	}
 	return l
 }
 
+// WithField returns a log carrying key=value in every record, l is left unchanged
+func (l *DXLog) WithField(key string, value any) DXLog {
+	return l.WithFields(DXLogFields{key: value})
+}
+
+// WithFields returns a log carrying fields in every record, a utils.JSON can be passed as is. l is left unchanged.
+func (l *DXLog) WithFields(fields DXLogFields) DXLog {
+	r := *l
+	r.Fields = make(DXLogFields, len(l.Fields)+len(fields))
+	for k, v := range l.Fields {
+		r.Fields[k] = v
+	}
+	for k, v := range fields {
+		r.Fields[k] = v
+	}
+	return r
+}
+
+// recordingSpan returns the span carried by the context of the log, nil when there is none or it is not recorded
+func (l *DXLog) recordingSpan() trace.Span {
+	if l.Context == nil {
+		return nil
+	}
+	span := trace.SpanFromContext(l.Context)
+	if !span.IsRecording() || !span.SpanContext().IsValid() {
+		return nil
+	}
+	return span
+}
+
 func (l *DXLog) LogText(severity DXLogLevel, location string, text string) {
-	stack := ``
-	a := logrus.WithFields(logrus.Fields{"prefix": l.Prefix, "location": location})
+	l.LogTextWithFields(severity, location, text, nil)
+}
+
+// LogTextWithFields writes text with fields attached to the record, in addition to the Fields of l
+func (l *DXLog) LogTextWithFields(severity DXLogLevel, location string, text string, fields DXLogFields) {
+	if !l.IsLevelEnabled(severity) {
+		return
+	}
+	if l.isRateLimitSuppressed(severity, text) {
+		return
+	}
+	span := l.recordingSpan()
+	if len(l.Fields) > 0 || span != nil {
+		merged := make(DXLogFields, len(l.Fields)+len(fields)+2)
+		if span != nil {
+			merged[DXLogFieldTraceId] = span.SpanContext().TraceID().String()
+			merged[DXLogFieldSpanId] = span.SpanContext().SpanID().String()
+		}
+		for k, v := range l.Fields {
+			merged[k] = v
+		}
+		for k, v := range fields {
+			merged[k] = v
+		}
+		fields = merged
+	}
+	stack, _ := fields[DXLogFieldStack].(string)
+	if severity == DXLogLevelPanic {
+		stack = string(debug.Stack())
+	}
+	if stack != `` {
+		stack = truncateStack(stack)
+		withStack := make(DXLogFields, len(fields)+1)
+		for k, v := range fields {
+			withStack[k] = v
+		}
+		withStack[DXLogFieldStack] = stack
+		fields = withStack
+	}
+	// Before writing, Fatal and Panic terminate the process, the exit handler then flushes the hooks
+	l.dispatchToHooks(severity, location, text, fields, stack)
+	a := logrus.WithFields(logrus.Fields(fields)).WithFields(logrus.Fields{"prefix": l.Prefix, "location": location})
 	switch severity {
-	case DXLogLevelTrace:
-		a.Tracef("%s", text)
-	case DXLogLevelDebug:
-		a.Debugf("%s", text)
-	case DXLogLevelInfo:
-		a.Infof("%s", text)
-	case DXLogLevelWarn:
-		a.Warnf("%s", text)
-	case DXLogLevelError:
-		a.Errorf("%s", text)
 	case DXLogLevelFatal:
-		a.Fatalf("Terminating... %s", text)
+		l.writeFatal(a, text, "Terminating... ")
 	case DXLogLevelPanic:
-		stack = string(debug.Stack())
-		a = a.WithField(`stack`, stack)
-		a.Fatalf("%s", text)
+		l.writeFatal(a, text, "")
 	default:
-		a.Printf("%s", text)
+		l.emit(a, severity, text)
+	}
+}
+
+// writeFatal ends a Fatal or Panic record according to the fatal behavior of l. When the process keeps running the hooks are
+// still flushed, as they would be before exiting.
+func (l *DXLog) writeFatal(a *logrus.Entry, text string, exitPrefix string) {
+	switch l.effectiveFatalBehavior() {
+	case DXLogFatalBehaviorPanicOnly:
+		l.emit(a, DXLogLevelError, text)
+		FlushHooks(DXLogHookDefaultFlushTimeout)
+		panic(text)
+	case DXLogFatalBehaviorErrorOnly:
+		l.emit(a.WithField("fatal", true), DXLogLevelError, text)
+		FlushHooks(DXLogHookDefaultFlushTimeout)
+	default:
+		l.emit(a, DXLogLevelFatal, exitPrefix+text)
+		a.Logger.Exit(1)
 	}
 }
 
@@ -84,6 +174,9 @@ func (l *DXLog) Trace(text string) {
 }
 
 func (l *DXLog) Tracef(text string, v ...any) {
+	if !l.IsLevelEnabled(DXLogLevelTrace) {
+		return
+	}
 	t := fmt.Sprintf(text, v...)
 	l.Trace(t)
 }
@@ -93,6 +186,9 @@ func (l *DXLog) Debug(text string) {
 }
 
 func (l *DXLog) Debugf(text string, v ...any) {
+	if !l.IsLevelEnabled(DXLogLevelDebug) {
+		return
+	}
 	t := fmt.Sprintf(text, v...)
 	l.Debug(t)
 }
@@ -117,7 +213,7 @@ func (l *DXLog) Warnf(text string, v ...any) {
 
 func (l *DXLog) WarnAndCreateErrorf(text string, v ...any) (err error) {
 	err = fmt.Errorf(text, v...)
-	l.LogText(DXLogLevelWarn, ``, err.Error())
+	l.LogTextWithFields(DXLogLevelWarn, ``, err.Error(), DXLogFields{DXLogFieldError: err.Error()})
 	return err
 }
 
@@ -132,7 +228,7 @@ func (l *DXLog) Errorf(text string, v ...any) {
 
 func (l *DXLog) ErrorAndCreateErrorf(text string, v ...any) (err error) {
 	err = fmt.Errorf(text, v...)
-	l.Error(err.Error())
+	l.LogTextWithFields(DXLogLevelError, ``, err.Error(), DXLogFields{DXLogFieldError: err.Error()})
 	return err
 }
 
@@ -146,12 +242,12 @@ func (l *DXLog) Fatalf(text string, v ...any) {
 
 func (l *DXLog) FatalAndCreateErrorf(text string, v ...any) (err error) {
 	err = fmt.Errorf(text, v...)
-	l.Fatal(err.Error())
+	l.LogTextWithFields(DXLogLevelFatal, ``, err.Error(), DXLogFields{DXLogFieldError: err.Error()})
 	return err
 }
 
 func (l *DXLog) Panic(location string, err error) {
-	l.LogText(DXLogLevelPanic, location, err.Error())
+	l.LogTextWithFields(DXLogLevelPanic, location, err.Error(), DXLogFields{DXLogFieldError: err.Error()})
 }
 
 func (l *DXLog) PanicAndCreateErrorf(location, text string, v ...any) (err error) {
@@ -163,7 +259,7 @@ func (l *DXLog) PanicAndCreateErrorf(location, text string, v ...any) (err error
 var Log DXLog
 
 func SetFormatJSON() {
-	logrus.SetFormatter(&logrus.JSONFormatter{})
+	logrus.SetFormatter(&dxJSONFormatter{})
 	Format = DXLogFormatJSON
 }
 
@@ -172,10 +268,27 @@ func SetFormatText() {
 	Format = DXLogFormatText
 }
 
+// SetOutput sends the application log to w, for example a DXRotatingFileWriter. With SetRoutes it only receives the records
+// matching no route.
+func SetOutput(w io.Writer) {
+	logrus.SetOutput(w)
+}
+
 func init() {
 	//logrus.SetFlags(log.Ldate | log.Lmicroseconds | log.LUTC)
 	//	logrus.SetReportCaller(true)
+	// logrus lets everything through, the level of each record is decided by IsLevelEnabled
 	logrus.SetLevel(logrus.TraceLevel)
+	SetLevel(DXLogLevelTrace)
+	SetFatalBehavior(DXLogFatalBehaviorExit)
+	logrus.RegisterExitHandler(func() {
+		FlushHooks(DXLogHookDefaultFlushTimeout)
+		_ = FlushFileOutput()
+	})
 	SetFormatJSON()
 	Log = NewLog(nil, core.RootContext, "")
+	core.ShutdownLogf = func(format string, v ...any) {
+		Log.Infof(format, v...)
+	}
+	setFormatFromEnvironment()
 }
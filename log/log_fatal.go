@@ -0,0 +1,47 @@
+package log
+
+import (
+	"sync/atomic"
+)
+
+// DXLogFatalBehavior decides what Fatal and Panic records do after being written
+type DXLogFatalBehavior int32
+
+const (
+	// DXLogFatalBehaviorDefault on a DXLog follows the global behavior set by SetFatalBehavior
+	DXLogFatalBehaviorDefault DXLogFatalBehavior = iota
+	// DXLogFatalBehaviorExit terminates the process, the behavior of a standalone application
+	DXLogFatalBehaviorExit
+	// DXLogFatalBehaviorPanicOnly raises a Go panic carrying the text, the host application may recover it
+	DXLogFatalBehaviorPanicOnly
+	// DXLogFatalBehaviorErrorOnly only writes the record, FatalAndCreateErrorf then returns the error to its caller
+	DXLogFatalBehaviorErrorOnly
+)
+
+var fatalBehavior atomic.Int32
+
+// SetFatalBehavior sets how Fatal and Panic records end for every DXLog without its own FatalBehavior, libraries embedded in
+// an application that manages its own lifecycle want DXLogFatalBehaviorErrorOnly
+func SetFatalBehavior(behavior DXLogFatalBehavior) {
+	if behavior == DXLogFatalBehaviorDefault {
+		behavior = DXLogFatalBehaviorExit
+	}
+	fatalBehavior.Store(int32(behavior))
+}
+
+func GetFatalBehavior() DXLogFatalBehavior {
+	return DXLogFatalBehavior(fatalBehavior.Load())
+}
+
+func (l *DXLog) effectiveFatalBehavior() DXLogFatalBehavior {
+	if l.FatalBehavior != DXLogFatalBehaviorDefault {
+		return l.FatalBehavior
+	}
+	return GetFatalBehavior()
+}
+
+// IsFatalExiting tells whether a Fatal record of l terminates the process, the code after a Fatal call must still be correct
+// when it does not
+func (l *DXLog) IsFatalExiting() bool {
+	return l.effectiveFatalBehavior() == DXLogFatalBehaviorExit
+}
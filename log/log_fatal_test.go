@@ -0,0 +1,160 @@
+package log
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// withFatalBehavior sets the global fatal behavior until the end of the test
+func withFatalBehavior(t *testing.T, behavior DXLogFatalBehavior) {
+	t.Helper()
+	previous := GetFatalBehavior()
+	SetFatalBehavior(behavior)
+	t.Cleanup(func() { SetFatalBehavior(previous) })
+}
+
+// captureExit replaces the exit of logrus until the end of the test, the returned codes are those Exit was called with
+func captureExit(t *testing.T) *[]int {
+	t.Helper()
+	var codes []int
+	logger := logrus.StandardLogger()
+	previous := logger.ExitFunc
+	logger.ExitFunc = func(code int) { codes = append(codes, code) }
+	t.Cleanup(func() { logger.ExitFunc = previous })
+	return &codes
+}
+
+func TestFatalBehaviorExit(t *testing.T) {
+	records := captureRecords(t)
+	codes := captureExit(t)
+	withFatalBehavior(t, DXLogFatalBehaviorExit)
+	l := NewLog(nil, context.Background(), t.Name())
+	if !l.IsFatalExiting() {
+		t.Fatal("IsFatalExiting is false")
+	}
+	err := l.FatalAndCreateErrorf("CONFIGURATION_NOT_FOUND:%s", "storage")
+	if len(*codes) != 1 || (*codes)[0] != 1 {
+		t.Fatalf("exit codes %v", *codes)
+	}
+	if err == nil || err.Error() != "CONFIGURATION_NOT_FOUND:storage" {
+		t.Fatalf("err %v", err)
+	}
+	got := records.Records(t.Name())
+	if len(got) != 1 || got[0][DXLogFieldLevel] != "fatal" || got[0][DXLogFieldMessage] != "Terminating... CONFIGURATION_NOT_FOUND:storage" {
+		t.Fatalf("records %v", got)
+	}
+}
+
+func TestFatalBehaviorPanicOnly(t *testing.T) {
+	records := captureRecords(t)
+	codes := captureExit(t)
+	withFatalBehavior(t, DXLogFatalBehaviorPanicOnly)
+	l := NewLog(nil, context.Background(), t.Name())
+	if l.IsFatalExiting() {
+		t.Fatal("IsFatalExiting is true")
+	}
+	recovered := func() (r any) {
+		defer func() { r = recover() }()
+		l.Fatalf("DATABASE_NOT_FOUND:%s", "main")
+		return nil
+	}()
+	if recovered != "DATABASE_NOT_FOUND:main" {
+		t.Fatalf("recovered %v", recovered)
+	}
+	if len(*codes) != 0 {
+		t.Fatalf("the process exited with %v", *codes)
+	}
+	got := records.Records(t.Name())
+	if len(got) != 1 || got[0][DXLogFieldLevel] != "error" {
+		t.Fatalf("records %v", got)
+	}
+}
+
+func TestFatalBehaviorErrorOnly(t *testing.T) {
+	records := captureRecords(t)
+	codes := captureExit(t)
+	withFatalBehavior(t, DXLogFatalBehaviorErrorOnly)
+	l := NewLog(nil, context.Background(), t.Name())
+	err := l.FatalAndCreateErrorf("CONFIGURATION_NOT_FOUND:%s", "storage")
+	if err == nil || err.Error() != "CONFIGURATION_NOT_FOUND:storage" {
+		t.Fatalf("err %v", err)
+	}
+	err = l.PanicAndCreateErrorf("location", "UNEXPECTED:%d", 1)
+	if err == nil || err.Error() != "UNEXPECTED:1" {
+		t.Fatalf("err %v", err)
+	}
+	if len(*codes) != 0 {
+		t.Fatalf("the process exited with %v", *codes)
+	}
+	got := records.Records(t.Name())
+	if len(got) != 2 {
+		t.Fatalf("records %v", got)
+	}
+	for _, record := range got {
+		if record[DXLogFieldLevel] != "error" || record["fatal"] != true {
+			t.Fatalf("record %v", record)
+		}
+	}
+	if got[1][DXLogFieldStack] == nil {
+		t.Fatal("the Panic record has no stack")
+	}
+}
+
+func TestFatalBehaviorOfALogOverridesTheGlobalOne(t *testing.T) {
+	captureRecords(t)
+	codes := captureExit(t)
+	withFatalBehavior(t, DXLogFatalBehaviorExit)
+	l := NewLog(nil, context.Background(), t.Name())
+	l.FatalBehavior = DXLogFatalBehaviorErrorOnly
+	l.Fatal("kept running")
+	if len(*codes) != 0 {
+		t.Fatalf("the process exited with %v", *codes)
+	}
+
+	SetFatalBehavior(DXLogFatalBehaviorErrorOnly)
+	l.FatalBehavior = DXLogFatalBehaviorPanicOnly
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("the log behavior did not panic")
+			}
+		}()
+		l.Fatal("panics")
+	}()
+}
+
+func TestSetFatalBehaviorDefaultIsExit(t *testing.T) {
+	withFatalBehavior(t, DXLogFatalBehaviorErrorOnly)
+	SetFatalBehavior(DXLogFatalBehaviorDefault)
+	if GetFatalBehavior() != DXLogFatalBehaviorExit {
+		t.Fatalf("got %v", GetFatalBehavior())
+	}
+}
+
+func TestFatalBehaviorFlushesTheHooksBeforeReturning(t *testing.T) {
+	captureRecords(t)
+	captureExit(t)
+	var mutex sync.Mutex
+	var messages []string
+	AddHook(DXLogLevelFatal, func(entry DXLogEntry) {
+		if entry.Prefix != t.Name() {
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		messages = append(messages, entry.Message)
+	})
+	for _, behavior := range []DXLogFatalBehavior{DXLogFatalBehaviorExit, DXLogFatalBehaviorErrorOnly} {
+		withFatalBehavior(t, behavior)
+		l := NewLog(nil, context.Background(), t.Name())
+		l.Fatal("flushed")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(messages) != 2 {
+		t.Fatalf("the hooks got %v before Fatal returned", messages)
+	}
+}
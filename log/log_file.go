@@ -0,0 +1,49 @@
+package log
+
+import (
+	"io"
+	"os"
+
+	"github.com/donnyhardyanto/dxlib/core"
+)
+
+var fileOutput *DXRotatingFileWriter
+
+// SetFileOutput writes the application log to a rotating file instead of the standard error, in the current format. The file
+// is flushed and closed by core.RunShutdownHooks, or by CloseFileOutput.
+func SetFileOutput(opts DXRotatingFileWriterOptions) (err error) {
+	w, err := NewRotatingFileWriterWithOptions(opts)
+	if err != nil {
+		return err
+	}
+	previous := fileOutput
+	fileOutput = w
+	SetOutput(w)
+	if previous != nil {
+		_ = previous.Close()
+	} else {
+		core.AddShutdownHook(func() {
+			_ = CloseFileOutput()
+		})
+	}
+	return nil
+}
+
+// FlushFileOutput writes the buffered records of the file set by SetFileOutput
+func FlushFileOutput() (err error) {
+	if fileOutput == nil {
+		return nil
+	}
+	return fileOutput.Flush()
+}
+
+// CloseFileOutput closes the file set by SetFileOutput and sends the log back to the standard error
+func CloseFileOutput() (err error) {
+	if fileOutput == nil {
+		return nil
+	}
+	w := fileOutput
+	fileOutput = nil
+	SetOutput(io.Writer(os.Stderr))
+	return w.Close()
+}
@@ -0,0 +1,122 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DXLogFormatEnvironmentVariable = "DXLIB_LOG_FORMAT"
+
+	DXLogFieldTimestamp = "timestamp"
+	DXLogFieldLevel     = "level"
+	DXLogFieldPrefix    = "prefix"
+	DXLogFieldLocation  = "location"
+	DXLogFieldMessage   = "message"
+	DXLogFieldError     = "error"
+	DXLogFieldTraceId   = "trace_id"
+	DXLogFieldSpanId    = "span_id"
+)
+
+// DXLogFields are the structured fields of a record, JSON properties in JSON format and key=value pairs in text format
+type DXLogFields map[string]any
+
+// The leading keys of every JSON record, the other fields follow in alphabetical order
+var dxLogJSONLeadingKeys = []string{DXLogFieldTimestamp, DXLogFieldLevel, DXLogFieldPrefix, DXLogFieldLocation, DXLogFieldMessage, DXLogFieldError}
+
+// dxJSONFormatter writes one JSON object per line with a stable key order, so the records can be compared and grepped
+type dxJSONFormatter struct{}
+
+func (f *dxJSONFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	values := make(map[string]any, len(entry.Data)+3)
+	for k, v := range entry.Data {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		values[k] = v
+	}
+	values[DXLogFieldTimestamp] = entry.Time.UTC().Format(time.RFC3339Nano)
+	values[DXLogFieldLevel] = entry.Level.String()
+	values[DXLogFieldMessage] = entry.Message
+	if location, ok := values[DXLogFieldLocation]; ok && location == "" {
+		delete(values, DXLogFieldLocation)
+	}
+
+	keys := make([]string, 0, len(values))
+	for _, k := range dxLogJSONLeadingKeys {
+		if _, ok := values[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	var otherKeys []string
+	for k := range values {
+		if !isLeadingKey(k) {
+			otherKeys = append(otherKeys, k)
+		}
+	}
+	sort.Strings(otherKeys)
+	keys = append(keys, otherKeys...)
+
+	b := &bytes.Buffer{}
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		kb, _ := json.Marshal(k)
+		b.Write(kb)
+		b.WriteByte(':')
+		vb, err := json.Marshal(values[k])
+		if err != nil {
+			vb, _ = json.Marshal(fmt.Sprintf("%v", values[k]))
+		}
+		b.Write(vb)
+	}
+	b.WriteString("}\n")
+	return b.Bytes(), nil
+}
+
+func isLeadingKey(k string) bool {
+	for _, leadingKey := range dxLogJSONLeadingKeys {
+		if k == leadingKey {
+			return true
+		}
+	}
+	return false
+}
+
+// SetFormat selects the output format by name, "text" or "json"
+func SetFormat(format string) (err error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "json":
+		SetFormatJSON()
+	case "text":
+		SetFormatText()
+	default:
+		return fmt.Errorf("LOG_FORMAT_NOT_SUPPORTED:%s", format)
+	}
+	return nil
+}
+
+// IsFormatJSON tells the callers which render their data as fields instead of inside the message
+func IsFormatJSON() bool {
+	return Format == DXLogFormatJSON
+}
+
+func setFormatFromEnvironment() {
+	format := os.Getenv(DXLogFormatEnvironmentVariable)
+	if format == "" {
+		return
+	}
+	err := SetFormat(format)
+	if err != nil {
+		Log.Warnf("Invalid %s (%v)", DXLogFormatEnvironmentVariable, err.Error())
+	}
+}
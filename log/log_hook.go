@@ -0,0 +1,146 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DXLogHookDefaultBufferSize   = 1024
+	DXLogHookDefaultFlushTimeout = 5 * time.Second
+)
+
+// DXLogEntry is the record handed to the hooks
+type DXLogEntry struct {
+	Time     time.Time
+	Level    DXLogLevel
+	Prefix   string
+	Location string
+	Message  string
+	Fields   DXLogFields
+	Error    string
+	Stack    string
+}
+
+type DXLogHookFunc func(entry DXLogEntry)
+
+type dxLogHook struct {
+	minLevel DXLogLevel
+	hook     DXLogHookFunc
+}
+
+var (
+	hooks            atomic.Pointer[[]dxLogHook]
+	hooksMutex       sync.Mutex
+	hookEntries      chan DXLogEntry
+	hookStartOnce    sync.Once
+	hookPendingCount atomic.Int64
+	hookDroppedCount atomic.Int64
+)
+
+// AddHook forwards every record at minLevel or more severe (DXLogLevelError forwards Error, Fatal and Panic) to hook, for
+// example to ship the errors to an external tracker. The hooks run one after the other on a background goroutine fed by a
+// bounded buffer: when it is full the record is dropped and counted, a slow hook never blocks the caller.
+func AddHook(minLevel DXLogLevel, hook DXLogHookFunc) {
+	hookStartOnce.Do(func() {
+		hookEntries = make(chan DXLogEntry, DXLogHookDefaultBufferSize)
+		go runHooks()
+	})
+	hooksMutex.Lock()
+	defer hooksMutex.Unlock()
+	var list []dxLogHook
+	current := hooks.Load()
+	if current != nil {
+		list = append(list, *current...)
+	}
+	list = append(list, dxLogHook{minLevel: minLevel, hook: hook})
+	hooks.Store(&list)
+}
+
+// HookDroppedCount returns how many records were not delivered to the hooks because the buffer was full
+func HookDroppedCount() int64 {
+	return hookDroppedCount.Load()
+}
+
+func isHookWanted(severity DXLogLevel) bool {
+	list := hooks.Load()
+	if list == nil {
+		return false
+	}
+	for _, h := range *list {
+		if severity <= h.minLevel {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *DXLog) dispatchToHooks(severity DXLogLevel, location string, text string, fields DXLogFields, stack string) {
+	if !isHookWanted(severity) {
+		return
+	}
+	entry := DXLogEntry{
+		Time:     time.Now(),
+		Level:    severity,
+		Prefix:   l.Prefix,
+		Location: location,
+		Message:  text,
+		Fields:   DXLogFields{},
+		Stack:    stack,
+	}
+	for k, v := range fields {
+		entry.Fields[k] = v
+	}
+	errorText, ok := fields[DXLogFieldError].(string)
+	if ok {
+		entry.Error = errorText
+	}
+	hookPendingCount.Add(1)
+	select {
+	case hookEntries <- entry:
+	default:
+		hookPendingCount.Add(-1)
+		hookDroppedCount.Add(1)
+	}
+}
+
+func runHooks() {
+	for entry := range hookEntries {
+		list := hooks.Load()
+		if list != nil {
+			for _, h := range *list {
+				if entry.Level <= h.minLevel {
+					callHook(h.hook, entry)
+				}
+			}
+		}
+		hookPendingCount.Add(-1)
+	}
+}
+
+// callHook keeps a misbehaving hook from taking the process down, the failure goes to the standard error because logging
+// it would feed the hooks again
+func callHook(hook DXLogHookFunc, entry DXLogEntry) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "LOG_HOOK_PANIC:%v\n", r)
+		}
+	}()
+	hook(entry)
+}
+
+// FlushHooks waits until the records already queued are delivered to the hooks, or until timeout
+func FlushHooks(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for hookPendingCount.Load() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
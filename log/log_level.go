@@ -0,0 +1,120 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DXLogPrefixSeparator joins the prefix of a derived log to the prefix of its parent, see NewLog
+const DXLogPrefixSeparator = " | "
+
+var (
+	globalLevel atomic.Int32
+	// prefixLevels is replaced as a whole on every change, so the readers only do an atomic load
+	prefixLevels     atomic.Pointer[map[string]DXLogLevel]
+	prefixLevelMutex sync.Mutex
+)
+
+// ParseLevel converts a level name like "info" or "TRACE" to its DXLogLevel
+func ParseLevel(s string) (level DXLogLevel, err error) {
+	u := strings.ToUpper(strings.TrimSpace(s))
+	if u == "WARNING" {
+		u = "WARN"
+	}
+	for k, v := range DXLogLevelAsString {
+		if v == u {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("LOG_LEVEL_NOT_SUPPORTED:%s", s)
+}
+
+// SetLevel sets the level used by every prefix without its own level
+func SetLevel(level DXLogLevel) {
+	globalLevel.Store(int32(level))
+}
+
+func GetLevel() DXLogLevel {
+	return DXLogLevel(globalLevel.Load())
+}
+
+// SetPrefixLevel sets the level of the logs whose prefix, or one segment of it, is prefix. The api and database NameId are
+// such segments, so one API or one database can be traced alone.
+func SetPrefixLevel(prefix string, level DXLogLevel) {
+	prefixLevelMutex.Lock()
+	defer prefixLevelMutex.Unlock()
+	m := copyPrefixLevels()
+	m[prefix] = level
+	prefixLevels.Store(&m)
+}
+
+// ClearPrefixLevel makes prefix follow the global level again
+func ClearPrefixLevel(prefix string) {
+	prefixLevelMutex.Lock()
+	defer prefixLevelMutex.Unlock()
+	m := copyPrefixLevels()
+	delete(m, prefix)
+	if len(m) == 0 {
+		prefixLevels.Store(nil)
+		return
+	}
+	prefixLevels.Store(&m)
+}
+
+func copyPrefixLevels() map[string]DXLogLevel {
+	m := map[string]DXLogLevel{}
+	current := prefixLevels.Load()
+	if current != nil {
+		for k, v := range *current {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// GetEffectiveLevel returns the level applied to the logs with prefix. The whole prefix wins, then the innermost segment
+// with a level of its own, then the global level.
+func GetEffectiveLevel(prefix string) DXLogLevel {
+	m := prefixLevels.Load()
+	if m == nil {
+		return GetLevel()
+	}
+	level, ok := (*m)[prefix]
+	if ok {
+		return level
+	}
+	segments := strings.Split(prefix, DXLogPrefixSeparator)
+	for i := len(segments) - 1; i >= 0; i-- {
+		level, ok = (*m)[segments[i]]
+		if ok {
+			return level
+		}
+	}
+	return GetLevel()
+}
+
+// GetLevels reports the global level and every prefix level by name, for the configuration dump and the admin API
+func GetLevels() map[string]any {
+	prefixes := map[string]string{}
+	m := prefixLevels.Load()
+	if m != nil {
+		for k, v := range *m {
+			prefixes[k] = DXLogLevelAsString[v]
+		}
+	}
+	return map[string]any{
+		"level":    DXLogLevelAsString[GetLevel()],
+		"prefixes": prefixes,
+	}
+}
+
+// IsLevelEnabled tells whether a record of severity would be written, the check costs an atomic load when no prefix level
+// is set. Panic and Fatal are always written.
+func (l *DXLog) IsLevelEnabled(severity DXLogLevel) bool {
+	if severity <= DXLogLevelFatal {
+		return true
+	}
+	return severity <= GetEffectiveLevel(l.Prefix)
+}
@@ -0,0 +1,37 @@
+package log
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+const DXLogFieldStack = "stack"
+
+// DXLogStackMaxBytes truncates the stacks attached to the records, zero keeps them whole
+var DXLogStackMaxBytes = 64 * 1024
+
+func truncateStack(stack string) string {
+	if DXLogStackMaxBytes <= 0 || len(stack) <= DXLogStackMaxBytes {
+		return stack
+	}
+	return stack[:DXLogStackMaxBytes] + "\n...truncated"
+}
+
+// CapturePanic logs a value returned by recover() with the stack of the panicking goroutine and returns it as an error
+// prefixed by prefix, see DXLog.CapturePanic
+func CapturePanic(recovered any, prefix string) (err error) {
+	return Log.CapturePanic(recovered, prefix)
+}
+
+// CapturePanic logs a value returned by recover() at Error level with the stack as a field, so it reaches the hooks and the
+// collector in one record instead of being printed on the standard error. It must be called from the deferred function that
+// recovered, the process keeps running.
+func (l *DXLog) CapturePanic(recovered any, prefix string) (err error) {
+	err = fmt.Errorf("%s:%v", prefix, recovered)
+	l.LogTextWithFields(DXLogLevelError, ``, err.Error(), DXLogFields{
+		DXLogFieldError: err.Error(),
+		DXLogFieldStack: string(debug.Stack()),
+		"panic":         true,
+	})
+	return err
+}
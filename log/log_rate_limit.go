@@ -0,0 +1,85 @@
+package log
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DXLogRateLimitMaxKeys bounds the suppression state, past it the new keys are logged without suppression
+const DXLogRateLimitMaxKeys = 1024
+
+type dxLogRateLimitState struct {
+	windowEnd  time.Time
+	suppressed int
+}
+
+var (
+	rateLimitStates = map[string]*dxLogRateLimitState{}
+	rateLimitMutex  sync.Mutex
+)
+
+// WithRateLimit returns a log that writes the first record of key immediately and suppresses the next ones for per, then
+// writes one summary record with the number of suppressed records. Keys are scoped by the prefix of the log and the severity, so unrelated
+// messages never suppress each other. Fatal and Panic are never suppressed.
+func (l *DXLog) WithRateLimit(key string, per time.Duration) DXLog {
+	r := *l
+	r.rateLimitKey = key
+	r.rateLimitPer = per
+	return r
+}
+
+func (l *DXLog) isRateLimitSuppressed(severity DXLogLevel, text string) bool {
+	if l.rateLimitKey == "" || l.rateLimitPer <= 0 || severity <= DXLogLevelFatal {
+		return false
+	}
+	key := fmt.Sprintf("%s\x00%s\x00%d", l.Prefix, l.rateLimitKey, severity)
+	now := time.Now()
+	rateLimitMutex.Lock()
+	defer rateLimitMutex.Unlock()
+	state, ok := rateLimitStates[key]
+	if ok && now.Before(state.windowEnd) {
+		state.suppressed++
+		if state.suppressed == 1 {
+			summaryLog := *l
+			summaryLog.rateLimitKey = ""
+			time.AfterFunc(state.windowEnd.Sub(now), func() {
+				summaryLog.writeRateLimitSummary(key, severity, text)
+			})
+		}
+		return true
+	}
+	if !ok && len(rateLimitStates) >= DXLogRateLimitMaxKeys {
+		removeExpiredRateLimitStates(now)
+		if len(rateLimitStates) >= DXLogRateLimitMaxKeys {
+			return false
+		}
+	}
+	rateLimitStates[key] = &dxLogRateLimitState{windowEnd: now.Add(l.rateLimitPer)}
+	return false
+}
+
+// removeExpiredRateLimitStates keeps the states still waiting for their summary
+func removeExpiredRateLimitStates(now time.Time) {
+	for k, state := range rateLimitStates {
+		if !now.Before(state.windowEnd) && state.suppressed == 0 {
+			delete(rateLimitStates, k)
+		}
+	}
+}
+
+func (l *DXLog) writeRateLimitSummary(key string, severity DXLogLevel, text string) {
+	rateLimitMutex.Lock()
+	state, ok := rateLimitStates[key]
+	suppressed := 0
+	if ok {
+		suppressed = state.suppressed
+		delete(rateLimitStates, key)
+	}
+	rateLimitMutex.Unlock()
+	if suppressed == 0 {
+		return
+	}
+	l.LogTextWithFields(severity, ``, fmt.Sprintf("%s (repeated %d times in the last %v)", text, suppressed, l.rateLimitPer),
+		DXLogFields{"repeated": suppressed})
+}
@@ -0,0 +1,70 @@
+package log
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimitSuppressesRepeatsAndSummarizesThem(t *testing.T) {
+	records := captureRecords(t)
+	l := NewLog(nil, context.Background(), t.Name())
+	limited := l.WithRateLimit("reconnect", 200*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		limited.Warn("cannot connect")
+	}
+	if got := records.Records(t.Name()); len(got) != 1 || got[0][DXLogFieldMessage] != "cannot connect" {
+		t.Fatalf("records in the window: %v", got)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(records.Records(t.Name())) < 2 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	got := records.Records(t.Name())
+	if len(got) != 2 {
+		t.Fatalf("no summary after the window: %v", got)
+	}
+	summary := got[1]
+	if !strings.HasPrefix(summary[DXLogFieldMessage].(string), "cannot connect (repeated 4 times") || summary["repeated"] != float64(4) {
+		t.Fatalf("summary %v", summary)
+	}
+	if summary[DXLogFieldLevel] != "warning" {
+		t.Fatalf("the summary level is %v", summary[DXLogFieldLevel])
+	}
+
+	// The window is over, the next record is written again
+	limited.Warn("cannot connect")
+	if got := records.Records(t.Name()); len(got) != 3 {
+		t.Fatalf("the record after the window was suppressed: %v", got)
+	}
+}
+
+func TestRateLimitKeysDoNotSuppressEachOther(t *testing.T) {
+	records := captureRecords(t)
+	l := NewLog(nil, context.Background(), t.Name())
+	a := l.WithRateLimit("a", time.Minute)
+	b := l.WithRateLimit("b", time.Minute)
+	a.Warn("a")
+	b.Warn("b")
+	a.Error("a as error")
+	l.Warn("not limited")
+	l.Warn("not limited")
+	a.Warn("a again")
+	if got := records.Records(t.Name()); len(got) != 5 {
+		t.Fatalf("got %d records: %v", len(got), got)
+	}
+}
+
+func TestRateLimitNeverSuppressesFatal(t *testing.T) {
+	records := captureRecords(t)
+	l := NewLog(nil, context.Background(), t.Name())
+	l.FatalBehavior = DXLogFatalBehaviorErrorOnly
+	limited := l.WithRateLimit("fatal", time.Minute)
+	limited.Fatal("first")
+	limited.Fatal("second")
+	if got := records.Records(t.Name()); len(got) != 2 {
+		t.Fatalf("got %d records: %v", len(got), got)
+	}
+}
@@ -0,0 +1,132 @@
+package log
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DXLogLevelWriter is implemented by the outputs that need the level of each record, like DXSyslogWriter
+type DXLogLevelWriter interface {
+	WriteLevel(level DXLogLevel, p []byte) (n int, err error)
+}
+
+// DXLogRoute sends the records of the levels from MostSevereLevel to LeastSevereLevel, and of Prefix when it is not empty, to
+// Writer. Prefix matches the whole prefix of a log or one of its segments, like the api or database NameId.
+type DXLogRoute struct {
+	Prefix           string
+	MostSevereLevel  DXLogLevel
+	LeastSevereLevel DXLogLevel
+	Writer           io.Writer
+}
+
+type dxLogRouteOutput struct {
+	writer io.Writer
+	mutex  *sync.Mutex
+}
+
+type dxLogRoutes struct {
+	routes  []DXLogRoute
+	outputs []dxLogRouteOutput
+}
+
+var routes atomic.Pointer[dxLogRoutes]
+
+// SetRoutes sends every record to the Writer of the first matching route, the records matching no route go to the output set
+// by SetOutput. Every write is made under a lock per writer, so the records of concurrent logs never interleave. Nil or an
+// empty list turns the routing off.
+func SetRoutes(list []DXLogRoute) {
+	if len(list) == 0 {
+		routes.Store(nil)
+		return
+	}
+	r := &dxLogRoutes{routes: append([]DXLogRoute(nil), list...)}
+	mutexes := map[io.Writer]*sync.Mutex{}
+	for _, route := range r.routes {
+		mutex, ok := mutexes[route.Writer]
+		if !ok {
+			mutex = &sync.Mutex{}
+			mutexes[route.Writer] = mutex
+		}
+		r.outputs = append(r.outputs, dxLogRouteOutput{writer: route.Writer, mutex: mutex})
+	}
+	routes.Store(r)
+}
+
+// SplitStreamRoutes are the routes sending Warn and more severe to the standard error and the rest to the standard output
+func SplitStreamRoutes() []DXLogRoute {
+	return []DXLogRoute{
+		{MostSevereLevel: DXLogLevelPanic, LeastSevereLevel: DXLogLevelWarn, Writer: os.Stderr},
+		{MostSevereLevel: DXLogLevelInfo, LeastSevereLevel: DXLogLevelTrace, Writer: os.Stdout},
+	}
+}
+
+// SetSplitStreams routes the records with SplitStreamRoutes, the routes given first take precedence, for example one sending
+// the chatty Trace of one module to a file
+func SetSplitStreams(firstRoutes ...DXLogRoute) {
+	SetRoutes(append(firstRoutes, SplitStreamRoutes()...))
+}
+
+func isPrefixMatch(prefix string, routePrefix string) bool {
+	if routePrefix == "" || prefix == routePrefix {
+		return true
+	}
+	for _, segment := range strings.Split(prefix, DXLogPrefixSeparator) {
+		if segment == routePrefix {
+			return true
+		}
+	}
+	return false
+}
+
+func toLogrusLevel(severity DXLogLevel) logrus.Level {
+	switch severity {
+	case DXLogLevelPanic, DXLogLevelFatal:
+		return logrus.FatalLevel
+	case DXLogLevelError:
+		return logrus.ErrorLevel
+	case DXLogLevelWarn:
+		return logrus.WarnLevel
+	case DXLogLevelDebug:
+		return logrus.DebugLevel
+	case DXLogLevelTrace:
+		return logrus.TraceLevel
+	default:
+		return logrus.InfoLevel
+	}
+}
+
+// emit writes one record, to its route when one matches
+func (l *DXLog) emit(a *logrus.Entry, severity DXLogLevel, text string) {
+	r := routes.Load()
+	if r != nil {
+		for i, route := range r.routes {
+			if severity < route.MostSevereLevel || severity > route.LeastSevereLevel || !isPrefixMatch(l.Prefix, route.Prefix) {
+				continue
+			}
+			entry := a.WithTime(time.Now())
+			entry.Level = toLogrusLevel(severity)
+			entry.Message = text
+			b, err := entry.Logger.Formatter.Format(entry)
+			if err != nil {
+				break
+			}
+			output := r.outputs[i]
+			output.mutex.Lock()
+			levelWriter, ok := output.writer.(DXLogLevelWriter)
+			if ok {
+				_, _ = levelWriter.WriteLevel(severity, b)
+			} else {
+				_, _ = output.writer.Write(b)
+			}
+			output.mutex.Unlock()
+			return
+		}
+	}
+	a.Log(toLogrusLevel(severity), text)
+}
@@ -0,0 +1,58 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// recordBuffer collects the JSON records written to the log output, it may be written by the timers of the log meanwhile
+type recordBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *recordBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+// Records returns the records written so far by the logs of prefix, those of the other tests are left out
+func (b *recordBuffer) Records(prefix string) (records []map[string]any) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, line := range strings.Split(b.buffer.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if json.Unmarshal([]byte(line), &record) != nil {
+			continue
+		}
+		if record[DXLogFieldPrefix] == prefix {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// captureRecords sends the log output to a recordBuffer in JSON format until the end of the test
+func captureRecords(t *testing.T) *recordBuffer {
+	t.Helper()
+	b := &recordBuffer{}
+	logger := logrus.StandardLogger()
+	previousOutput, previousFormatter, previousFormat := logger.Out, logger.Formatter, Format
+	SetFormatJSON()
+	SetOutput(b)
+	t.Cleanup(func() {
+		logger.SetFormatter(previousFormatter)
+		Format = previousFormat
+		SetOutput(previousOutput)
+	})
+	return b
+}
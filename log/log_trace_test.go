@@ -0,0 +1,79 @@
+package log
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// testSpan is a recording span of fixed ids, the no-op span of the default provider is never recording
+type testSpan struct {
+	trace.Span
+	spanContext trace.SpanContext
+	isRecording bool
+}
+
+func (s testSpan) IsRecording() bool              { return s.isRecording }
+func (s testSpan) SpanContext() trace.SpanContext { return s.spanContext }
+
+var (
+	testTraceId = trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	testSpanId  = trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+)
+
+func contextWithTestSpan(isRecording bool) context.Context {
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{TraceID: testTraceId, SpanID: testSpanId, TraceFlags: trace.FlagsSampled})
+	span := testSpan{Span: trace.SpanFromContext(context.Background()), spanContext: spanContext, isRecording: isRecording}
+	return trace.ContextWithSpan(context.Background(), span)
+}
+
+func TestRecordsCarryTheIdsOfTheRecordingSpan(t *testing.T) {
+	records := captureRecords(t)
+	l := NewLog(nil, contextWithTestSpan(true), t.Name())
+	l.Info("with span")
+	child := NewLog(&l, l.Context, "child")
+	child.Warnf("child %d", 1)
+	got := append(records.Records(t.Name()), records.Records(t.Name()+DXLogPrefixSeparator+"child")...)
+	if len(got) != 2 {
+		t.Fatalf("records %v", got)
+	}
+	for _, record := range got {
+		if record[DXLogFieldTraceId] != "4bf92f3577b34da6a3ce929d0e0e4736" || record[DXLogFieldSpanId] != "00f067aa0ba902b7" {
+			t.Fatalf("record %v", record)
+		}
+	}
+}
+
+func TestRecordsWithoutARecordingSpanHaveNoIds(t *testing.T) {
+	records := captureRecords(t)
+	for _, ctx := range []context.Context{nil, context.Background(), contextWithTestSpan(false)} {
+		l := NewLog(nil, ctx, t.Name())
+		l.Info("without span")
+	}
+	got := records.Records(t.Name())
+	if len(got) != 3 {
+		t.Fatalf("records %v", got)
+	}
+	for _, record := range got {
+		if _, ok := record[DXLogFieldTraceId]; ok {
+			t.Fatalf("record %v", record)
+		}
+	}
+}
+
+func TestTextRecordsCarryTheIdsOfTheRecordingSpan(t *testing.T) {
+	records := captureRecords(t)
+	SetFormatText()
+	logrus.StandardLogger().Formatter.(*logrus.TextFormatter).DisableColors = true
+	l := NewLog(nil, contextWithTestSpan(true), t.Name())
+	l.Info("as text")
+	records.mutex.Lock()
+	defer records.mutex.Unlock()
+	text := records.buffer.String()
+	if !strings.Contains(text, "trace_id=4bf92f3577b34da6a3ce929d0e0e4736") || !strings.Contains(text, "span_id=00f067aa0ba902b7") {
+		t.Fatalf("text record %s", text)
+	}
+}
@@ -0,0 +1,272 @@
+package log
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	DXRotatingFileWriterDefaultMaxSizeBytes  = 100 * 1024 * 1024
+	DXRotatingFileWriterDefaultMaxBackups    = 7
+	DXRotatingFileWriterDefaultBufferSize    = 64 * 1024
+	DXRotatingFileWriterDefaultFlushInterval = 1 * time.Second
+	dxRotatingFileWriterCompressedSuffix     = ".gz"
+)
+
+// DXRotatingFileWriterOptions configures NewRotatingFileWriterWithOptions, the zero value of a field keeps its default
+type DXRotatingFileWriterOptions struct {
+	Path         string
+	MaxSizeBytes int64
+	// MaxBackups is the number of rotated files kept, a negative value keeps the default
+	MaxBackups     int
+	RotateInterval time.Duration
+	// MaxAge removes the rotated files older than it, zero keeps them until MaxBackups pushes them out
+	MaxAge time.Duration
+	// IsCompress gzips every rotated file to Path.N.gz
+	IsCompress    bool
+	BufferSize    int
+	FlushInterval time.Duration
+}
+
+// DXRotatingFileWriter appends to Path and renames it to Path.1 (shifting older ones up to Path.MaxBackups) when it grows over
+// MaxSizeBytes or, when RotateInterval is set, when the current file is older than that. Writes are buffered and flushed every
+// FlushInterval, by Flush and by Close.
+type DXRotatingFileWriter struct {
+	Path           string
+	MaxSizeBytes   int64
+	MaxBackups     int
+	RotateInterval time.Duration
+	MaxAge         time.Duration
+	IsCompress     bool
+	mutex          sync.Mutex
+	file           *os.File
+	buffer         *bufio.Writer
+	bufferSize     int
+	size           int64
+	openedAt       time.Time
+	// compressing is waited for before the backups are shifted again and before Close returns
+	compressing sync.WaitGroup
+	stopFlush   chan struct{}
+	flushDone   chan struct{}
+	isClosed    bool
+}
+
+func NewRotatingFileWriter(path string, maxSizeBytes int64, maxBackups int, rotateInterval time.Duration) (w *DXRotatingFileWriter, err error) {
+	return NewRotatingFileWriterWithOptions(DXRotatingFileWriterOptions{
+		Path:           path,
+		MaxSizeBytes:   maxSizeBytes,
+		MaxBackups:     maxBackups,
+		RotateInterval: rotateInterval,
+	})
+}
+
+func NewRotatingFileWriterWithOptions(opts DXRotatingFileWriterOptions) (w *DXRotatingFileWriter, err error) {
+	if opts.MaxSizeBytes <= 0 {
+		opts.MaxSizeBytes = DXRotatingFileWriterDefaultMaxSizeBytes
+	}
+	if opts.MaxBackups < 0 {
+		opts.MaxBackups = DXRotatingFileWriterDefaultMaxBackups
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DXRotatingFileWriterDefaultBufferSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DXRotatingFileWriterDefaultFlushInterval
+	}
+	w = &DXRotatingFileWriter{
+		Path:           opts.Path,
+		MaxSizeBytes:   opts.MaxSizeBytes,
+		MaxBackups:     opts.MaxBackups,
+		RotateInterval: opts.RotateInterval,
+		MaxAge:         opts.MaxAge,
+		IsCompress:     opts.IsCompress,
+		bufferSize:     opts.BufferSize,
+		stopFlush:      make(chan struct{}),
+		flushDone:      make(chan struct{}),
+	}
+	err = w.open()
+	if err != nil {
+		return nil, err
+	}
+	go w.runFlush(opts.FlushInterval)
+	return w, nil
+}
+
+func (w *DXRotatingFileWriter) open() (err error) {
+	w.file, err = os.OpenFile(w.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("ROTATING_FILE_WRITER_OPEN_FAILED:%s:%w", w.Path, err)
+	}
+	fileInfo, err := w.file.Stat()
+	if err != nil {
+		_ = w.file.Close()
+		w.file = nil
+		return fmt.Errorf("ROTATING_FILE_WRITER_STAT_FAILED:%s:%w", w.Path, err)
+	}
+	w.buffer = bufio.NewWriterSize(w.file, w.bufferSize)
+	w.size = fileInfo.Size()
+	w.openedAt = time.Now()
+	return nil
+}
+
+func (w *DXRotatingFileWriter) runFlush(interval time.Duration) {
+	defer close(w.flushDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stopFlush:
+			return
+		case <-ticker.C:
+			_ = w.Flush()
+		}
+	}
+}
+
+func (w *DXRotatingFileWriter) backupPath(index int) string {
+	return fmt.Sprintf("%s.%d", w.Path, index)
+}
+
+// renameBackup moves the backup index to newIndex, whether it was compressed or not
+func (w *DXRotatingFileWriter) renameBackup(index int, newIndex int) {
+	_ = os.Rename(w.backupPath(index), w.backupPath(newIndex))
+	_ = os.Rename(w.backupPath(index)+dxRotatingFileWriterCompressedSuffix, w.backupPath(newIndex)+dxRotatingFileWriterCompressedSuffix)
+}
+
+func (w *DXRotatingFileWriter) closeFile() (err error) {
+	if w.file == nil {
+		return nil
+	}
+	err = w.buffer.Flush()
+	errClose := w.file.Close()
+	if err == nil {
+		err = errClose
+	}
+	w.file = nil
+	w.buffer = nil
+	return err
+}
+
+func (w *DXRotatingFileWriter) rotate() (err error) {
+	_ = w.closeFile()
+	if w.MaxBackups == 0 {
+		_ = os.Remove(w.Path)
+		return w.open()
+	}
+	w.compressing.Wait()
+	_ = os.Remove(w.backupPath(w.MaxBackups))
+	_ = os.Remove(w.backupPath(w.MaxBackups) + dxRotatingFileWriterCompressedSuffix)
+	for i := w.MaxBackups - 1; i >= 1; i-- {
+		w.renameBackup(i, i+1)
+	}
+	err = os.Rename(w.Path, w.backupPath(1))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("ROTATING_FILE_WRITER_RENAME_FAILED:%s:%w", w.Path, err)
+	}
+	if err == nil && w.IsCompress {
+		w.compressing.Add(1)
+		go func(path string) {
+			defer w.compressing.Done()
+			errCompress := compressFile(path)
+			if errCompress != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "ROTATING_FILE_WRITER_COMPRESS_FAILED:%s:%v\n", path, errCompress.Error())
+			}
+		}(w.backupPath(1))
+	}
+	w.removeExpiredBackups()
+	return w.open()
+}
+
+// removeExpiredBackups deletes the rotated files last written before MaxAge ago
+func (w *DXRotatingFileWriter) removeExpiredBackups() {
+	if w.MaxAge <= 0 {
+		return
+	}
+	expiredBefore := time.Now().Add(-w.MaxAge)
+	for i := 1; i <= w.MaxBackups; i++ {
+		for _, path := range []string{w.backupPath(i), w.backupPath(i) + dxRotatingFileWriterCompressedSuffix} {
+			fileInfo, err := os.Stat(path)
+			if err == nil && fileInfo.ModTime().Before(expiredBefore) {
+				_ = os.Remove(path)
+			}
+		}
+	}
+}
+
+// compressFile replaces path by path.gz
+func compressFile(path string) (err error) {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+	target, err := os.OpenFile(path+dxRotatingFileWriterCompressedSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gzipWriter := gzip.NewWriter(target)
+	_, err = io.Copy(gzipWriter, source)
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+	errClose := target.Close()
+	if err == nil {
+		err = errClose
+	}
+	if err != nil {
+		_ = os.Remove(path + dxRotatingFileWriterCompressedSuffix)
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (w *DXRotatingFileWriter) Write(p []byte) (n int, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	isTooBig := w.size > 0 && w.size+int64(len(p)) > w.MaxSizeBytes
+	isTooOld := w.RotateInterval > 0 && time.Since(w.openedAt) >= w.RotateInterval
+	if isTooBig || isTooOld {
+		err = w.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err = w.buffer.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Flush writes the buffered records to the file
+func (w *DXRotatingFileWriter) Flush() (err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	return w.buffer.Flush()
+}
+
+func (w *DXRotatingFileWriter) Close() (err error) {
+	w.mutex.Lock()
+	if w.isClosed {
+		w.mutex.Unlock()
+		return nil
+	}
+	w.isClosed = true
+	err = w.closeFile()
+	close(w.stopFlush)
+	w.mutex.Unlock()
+	<-w.flushDone
+	w.compressing.Wait()
+	return err
+}
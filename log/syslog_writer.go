@@ -0,0 +1,128 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	DXSyslogDefaultNetwork = "unixgram"
+	DXSyslogDefaultAddress = "/dev/log"
+
+	DXSyslogFacilityUser   = 1
+	DXSyslogFacilityDaemon = 3
+	DXSyslogFacilityLocal0 = 16
+	DXSyslogFacilityLocal7 = 23
+)
+
+// DXSyslogWriter sends every record as one RFC 5424 message to a syslog daemon over a unix socket, UDP or TCP. The
+// connection is opened again once when a write fails, so a restarted daemon is picked up.
+type DXSyslogWriter struct {
+	Network  string
+	Address  string
+	Facility int
+	Tag      string
+	hostname string
+	conn     net.Conn
+	mutex    sync.Mutex
+}
+
+// NewSyslogWriter connects to the daemon, an empty network and address mean the local /dev/log socket
+func NewSyslogWriter(network, address string, facility int, tag string) (w *DXSyslogWriter, err error) {
+	if network == "" {
+		network = DXSyslogDefaultNetwork
+	}
+	if address == "" {
+		address = DXSyslogDefaultAddress
+	}
+	if tag == "" {
+		tag = "-"
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	w = &DXSyslogWriter{Network: network, Address: address, Facility: facility, Tag: tag, hostname: hostname}
+	err = w.connect()
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *DXSyslogWriter) connect() (err error) {
+	w.conn, err = net.Dial(w.Network, w.Address)
+	if err != nil {
+		return fmt.Errorf("SYSLOG_WRITER_CONNECT_FAILED:%s:%s:%w", w.Network, w.Address, err)
+	}
+	return nil
+}
+
+func syslogSeverity(level DXLogLevel) int {
+	switch level {
+	case DXLogLevelPanic:
+		return 1
+	case DXLogLevelFatal:
+		return 2
+	case DXLogLevelError:
+		return 3
+	case DXLogLevelWarn:
+		return 4
+	case DXLogLevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
+
+func (w *DXSyslogWriter) isStream() bool {
+	return w.Network == "tcp" || w.Network == "tcp4" || w.Network == "tcp6" || w.Network == "unix"
+}
+
+func (w *DXSyslogWriter) WriteLevel(level DXLogLevel, p []byte) (n int, err error) {
+	message := fmt.Sprintf("<%d>1 %s %s %s %d - - %s", w.Facility*8+syslogSeverity(level), time.Now().Format(time.RFC3339Nano),
+		w.hostname, w.Tag, os.Getpid(), bytes.TrimRight(p, "\n"))
+	if w.isStream() {
+		// Non-transparent framing of RFC 6587
+		message += "\n"
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.conn != nil {
+		_, err = w.conn.Write([]byte(message))
+		if err == nil {
+			return len(p), nil
+		}
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	err = w.connect()
+	if err != nil {
+		return 0, err
+	}
+	_, err = w.conn.Write([]byte(message))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Write sends p at the Info level, for the callers that do not know the level
+func (w *DXSyslogWriter) Write(p []byte) (n int, err error) {
+	return w.WriteLevel(DXLogLevelInfo, p)
+}
+
+func (w *DXSyslogWriter) Close() (err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err = w.conn.Close()
+	w.conn = nil
+	return err
+}
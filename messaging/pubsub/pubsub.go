@@ -0,0 +1,113 @@
+package pubsub
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// DXPubSubDefaultBuffer is the count of messages a subscription may have waiting when its DXPubSub has no Buffer
+const DXPubSubDefaultBuffer = 256
+
+type DXPubSubMessage struct {
+	Topic   string
+	Payload utils.JSON
+}
+
+// DXPubSub delivers the messages published to a topic to every subscription of it, in the process. Publish never blocks, a
+// message to a subscription whose buffer is full is dropped for that subscription only.
+type DXPubSub struct {
+	// Buffer is the count of messages a subscription may have waiting, DXPubSubDefaultBuffer when zero
+	Buffer       int
+	mutex        sync.RWMutex
+	topics       map[string]map[*DXPubSubSubscription]struct{}
+	droppedCount atomic.Int64
+}
+
+type DXPubSubSubscription struct {
+	pubSub    *DXPubSub
+	topic     string
+	messages  chan DXPubSubMessage
+	closeOnce sync.Once
+}
+
+// Manager is the pub/sub of the process, bridging the database notifications to the connection hubs of the APIs
+var Manager = NewPubSub(DXPubSubDefaultBuffer)
+
+func NewPubSub(buffer int) *DXPubSub {
+	return &DXPubSub{Buffer: buffer, topics: map[string]map[*DXPubSubSubscription]struct{}{}}
+}
+
+// Subscribe returns a subscription to topic, its Messages are closed by Close
+func (p *DXPubSub) Subscribe(topic string) *DXPubSubSubscription {
+	buffer := p.Buffer
+	if buffer <= 0 {
+		buffer = DXPubSubDefaultBuffer
+	}
+	s := &DXPubSubSubscription{pubSub: p, topic: topic, messages: make(chan DXPubSubMessage, buffer)}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	subscriptions, ok := p.topics[topic]
+	if !ok {
+		subscriptions = map[*DXPubSubSubscription]struct{}{}
+		p.topics[topic] = subscriptions
+	}
+	subscriptions[s] = struct{}{}
+	return s
+}
+
+// Publish queues payload to every subscription of topic and returns the count of subscriptions it was queued to. It may be
+// called from any goroutine.
+func (p *DXPubSub) Publish(topic string, payload utils.JSON) (count int) {
+	m := DXPubSubMessage{Topic: topic, Payload: payload}
+	dropped := 0
+	p.mutex.RLock()
+	for s := range p.topics[topic] {
+		select {
+		case s.messages <- m:
+			count++
+		default:
+			dropped++
+		}
+	}
+	p.mutex.RUnlock()
+	if dropped > 0 {
+		p.droppedCount.Add(int64(dropped))
+		log.Log.Warnf("PUBSUB_SLOW_SUBSCRIBER_MESSAGE_DROPPED:%s:%d", topic, dropped)
+	}
+	return count
+}
+
+// PublisherOf is Publish to topic, for the handlers of the database notifications
+func (p *DXPubSub) PublisherOf(topic string) func(channel string, payload utils.JSON) {
+	return func(channel string, payload utils.JSON) {
+		p.Publish(topic, payload)
+	}
+}
+
+// DroppedCount is the count of messages dropped for slow subscriptions, for the metrics
+func (p *DXPubSub) DroppedCount() int64 {
+	return p.droppedCount.Load()
+}
+
+// Messages are the messages of the subscription, in the order they were published
+func (s *DXPubSubSubscription) Messages() <-chan DXPubSubMessage {
+	return s.messages
+}
+
+// Close removes the subscription from its topic and closes its Messages after the ones waiting
+func (s *DXPubSubSubscription) Close() {
+	s.closeOnce.Do(func() {
+		p := s.pubSub
+		p.mutex.Lock()
+		subscriptions := p.topics[s.topic]
+		delete(subscriptions, s)
+		if len(subscriptions) == 0 {
+			delete(p.topics, s.topic)
+		}
+		p.mutex.Unlock()
+		close(s.messages)
+	})
+}
@@ -0,0 +1,378 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database"
+	"github.com/donnyhardyanto/dxlib/database/protected/db"
+	"github.com/donnyhardyanto/dxlib/log"
+	"github.com/donnyhardyanto/dxlib/task"
+	"github.com/donnyhardyanto/dxlib/utils"
+	"github.com/donnyhardyanto/dxlib/utils/json"
+	security "github.com/donnyhardyanto/dxlib/utils/security"
+)
+
+// The status of a delivery: PENDING waits for its next attempt, SENDING is claimed by a dispatcher, DEAD gave up after
+// MaxAttempts and waits for a Retry
+const (
+	DXWebhookStatusPending   = "PENDING"
+	DXWebhookStatusSending   = "SENDING"
+	DXWebhookStatusDelivered = "DELIVERED"
+	DXWebhookStatusDead      = "DEAD"
+)
+
+const (
+	DXWebhookDefaultTableName       = "dxlib_webhook_delivery"
+	DXWebhookDefaultSignatureHeader = "X-Webhook-Signature"
+	DXWebhookDefaultMaxAttempts     = 8
+	DXWebhookDefaultInitialBackoff  = 10 * time.Second
+	DXWebhookDefaultMaxBackoff      = time.Hour
+	DXWebhookDefaultPollInterval    = 5 * time.Second
+	DXWebhookDefaultBatchSize       = 20
+	DXWebhookDefaultRequestTimeout  = 10 * time.Second
+	// DXWebhookDefaultClaimTimeout gives back a delivery claimed by a dispatcher that died before finishing it
+	DXWebhookDefaultClaimTimeout = 5 * time.Minute
+)
+
+// dxWebhookMaxRecordedResponseBytes bounds the response body kept with an attempt
+const dxWebhookMaxRecordedResponseBytes = 2048
+
+// DXWebhookSenderOptions are the options of NewWebhookSender, a zero field takes its default
+type DXWebhookSenderOptions struct {
+	NameId string
+	// TableName holds the deliveries, its attempts are in TableName + "_attempt"
+	TableName string
+	// KeyId and Secret sign the body like utils/security SignPayload, checked by api.NewHMACVerifyMiddleware on the receiver
+	KeyId           string
+	Secret          string
+	SignatureHeader string
+	MaxAttempts     int
+	InitialBackoff  time.Duration
+	MaxBackoff      time.Duration
+	PollInterval    time.Duration
+	BatchSize       int64
+	RequestTimeout  time.Duration
+	ClaimTimeout    time.Duration
+	HTTPClient      *http.Client
+}
+
+type DXWebhookSender struct {
+	Database *database.DXDatabase
+	Options  DXWebhookSenderOptions
+	Log      log.DXLog
+}
+
+// NewWebhookSender creates the tables of the deliveries when missing and registers the dispatcher as a periodic job of
+// task.Manager, started by its StartAll and stopped by its shutdown. It must be called before StartAll. The claims of the
+// deliveries use FOR UPDATE SKIP LOCKED, so d must be PostgreSQL.
+func NewWebhookSender(d *database.DXDatabase, opts DXWebhookSenderOptions) (s *DXWebhookSender, err error) {
+	if opts.NameId == "" {
+		opts.NameId = "webhook"
+	}
+	if opts.TableName == "" {
+		opts.TableName = DXWebhookDefaultTableName
+	}
+	if opts.SignatureHeader == "" {
+		opts.SignatureHeader = DXWebhookDefaultSignatureHeader
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DXWebhookDefaultMaxAttempts
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = DXWebhookDefaultInitialBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DXWebhookDefaultMaxBackoff
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DXWebhookDefaultPollInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DXWebhookDefaultBatchSize
+	}
+	if opts.RequestTimeout <= 0 {
+		opts.RequestTimeout = DXWebhookDefaultRequestTimeout
+	}
+	if opts.ClaimTimeout <= 0 {
+		opts.ClaimTimeout = DXWebhookDefaultClaimTimeout
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{}
+	}
+	if opts.Secret == "" {
+		return nil, log.Log.ErrorAndCreateErrorf("WEBHOOK_SECRET_NOT_SET:%s", opts.NameId)
+	}
+	s = &DXWebhookSender{
+		Database: d,
+		Options:  opts,
+		Log:      log.NewLog(&log.Log, task.Manager.Context, "webhook:"+opts.NameId),
+	}
+	_, err = d.EnsureSchema(s.tableDefinitions())
+	if err != nil {
+		return nil, err
+	}
+	job, err := task.Manager.RegisterPeriodic(opts.NameId, opts.PollInterval, s.dispatch)
+	if err != nil {
+		return nil, err
+	}
+	// The deliveries have their own timeout, a batch may take several of them
+	job.Timeout = 0
+	return s, nil
+}
+
+func (s *DXWebhookSender) attemptTableName() string {
+	return s.Options.TableName + "_attempt"
+}
+
+func (s *DXWebhookSender) tableDefinitions() []db.TableDefinition {
+	return []db.TableDefinition{
+		{
+			Name: s.Options.TableName,
+			Columns: []db.ColumnDefinition{
+				{Name: "id", Type: db.ColumnTypeBigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+				{Name: "target_url", Type: db.ColumnTypeVarchar, Length: 2048},
+				{Name: "event", Type: db.ColumnTypeVarchar, Length: 255},
+				{Name: "body", Type: db.ColumnTypeText},
+				{Name: "status", Type: db.ColumnTypeVarchar, Length: 16},
+				{Name: "attempt_count", Type: db.ColumnTypeInteger, Default: "0"},
+				{Name: "next_attempt_at", Type: db.ColumnTypeTimestamp},
+				{Name: "claimed_at", Type: db.ColumnTypeTimestamp, IsNullable: true},
+				{Name: "last_status_code", Type: db.ColumnTypeInteger, IsNullable: true},
+				{Name: "last_latency_ms", Type: db.ColumnTypeBigInt, IsNullable: true},
+				{Name: "last_error", Type: db.ColumnTypeText, IsNullable: true},
+				{Name: "created_at", Type: db.ColumnTypeTimestamp},
+				{Name: "delivered_at", Type: db.ColumnTypeTimestamp, IsNullable: true},
+			},
+			Indexes: []db.IndexDefinition{
+				{Name: s.Options.TableName + "_status_idx", Columns: []string{"status", "next_attempt_at"}},
+			},
+		},
+		{
+			Name: s.attemptTableName(),
+			Columns: []db.ColumnDefinition{
+				{Name: "id", Type: db.ColumnTypeBigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+				{Name: "delivery_id", Type: db.ColumnTypeBigInt},
+				{Name: "attempt", Type: db.ColumnTypeInteger},
+				{Name: "status_code", Type: db.ColumnTypeInteger, IsNullable: true},
+				{Name: "latency_ms", Type: db.ColumnTypeBigInt},
+				{Name: "error", Type: db.ColumnTypeText, IsNullable: true},
+				{Name: "response_body", Type: db.ColumnTypeText, IsNullable: true},
+				{Name: "attempted_at", Type: db.ColumnTypeTimestamp},
+			},
+			Indexes: []db.IndexDefinition{
+				{Name: s.attemptTableName() + "_delivery_idx", Columns: []string{"delivery_id"}},
+			},
+		},
+	}
+}
+
+// Enqueue stores a delivery of event to targetURL, sent by the dispatcher right away. The body is the JSON object
+// {"created_at","event","id","payload"} in the canonical form of json.Canonical, so the signature covers a stable encoding.
+func (s *DXWebhookSender) Enqueue(targetURL string, event string, payload utils.JSON) (id int64, err error) {
+	now := time.Now()
+	// The body holds the id, the row is only visible to the dispatchers once it is set
+	err = s.Database.Tx(&s.Log, database.LevelReadCommitted, func(dtx *database.DXDatabaseTx) (err error) {
+		id, err = dtx.Insert(s.Options.TableName, utils.JSON{
+			"target_url":      targetURL,
+			"event":           event,
+			"body":            "",
+			"status":          DXWebhookStatusPending,
+			"attempt_count":   0,
+			"next_attempt_at": now,
+			"created_at":      now,
+		})
+		if err != nil {
+			return err
+		}
+		// The canonical form (RFC 8785) is the same whatever the order of the keys and the encoding of the numbers
+		body, err := json.Canonical(utils.JSON{
+			"id":         id,
+			"event":      event,
+			"payload":    payload,
+			"created_at": now.UTC().Format(time.RFC3339Nano),
+		})
+		if err != nil {
+			return s.Log.ErrorAndCreateErrorf("WEBHOOK_PAYLOAD_CANT_BE_MARSHALLED:%s:%v", event, err.Error())
+		}
+		_, err = dtx.Update(s.Options.TableName, utils.JSON{"body": string(body)}, utils.JSON{"id": id})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	// Sent without waiting for the next poll when this replica dispatches
+	_ = task.Manager.TriggerNow(s.Options.NameId)
+	return id, nil
+}
+
+// dispatch claims the deliveries due, and the ones claimed too long ago by a dispatcher gone, and sends them
+func (s *DXWebhookSender) dispatch(ctx context.Context, l *log.DXLog) (err error) {
+	due := db.SQLExpression{Expression: fmt.Sprintf("((status = '%s' AND next_attempt_at <= now()) OR (status = '%s' AND claimed_at < now() - interval '%d seconds'))",
+		DXWebhookStatusPending, DXWebhookStatusSending, int64(s.Options.ClaimTimeout.Seconds()))}
+	for ctx.Err() == nil {
+		rows, err := s.Database.ClaimRows(s.Options.TableName, "id", utils.JSON{"due": due}, map[string]string{"next_attempt_at": "asc"},
+			s.Options.BatchSize, utils.JSON{
+				"status":     DXWebhookStatusSending,
+				"claimed_at": db.SQLExpression{Expression: "claimed_at = now()"},
+			})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			s.deliver(ctx, row)
+		}
+		if int64(len(rows)) < s.Options.BatchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *DXWebhookSender) deliver(ctx context.Context, row utils.JSON) {
+	deliveryId := toInt64(row["id"])
+	attemptCount := toInt64(row["attempt_count"]) + 1
+	targetURL, _ := row["target_url"].(string)
+	event, _ := row["event"].(string)
+	body, _ := row["body"].(string)
+
+	start := time.Now()
+	statusCode, responseBody, errSend := s.send(ctx, targetURL, event, deliveryId, []byte(body))
+	latency := time.Since(start)
+
+	attemptRecord := utils.JSON{
+		"delivery_id":  deliveryId,
+		"attempt":      attemptCount,
+		"latency_ms":   latency.Milliseconds(),
+		"attempted_at": start,
+	}
+	update := utils.JSON{
+		"attempt_count":   attemptCount,
+		"last_latency_ms": latency.Milliseconds(),
+		"claimed_at":      nil,
+	}
+	if statusCode != 0 {
+		attemptRecord["status_code"] = statusCode
+		attemptRecord["response_body"] = responseBody
+		update["last_status_code"] = statusCode
+	}
+	switch {
+	case errSend == nil:
+		update["status"] = DXWebhookStatusDelivered
+		update["delivered_at"] = time.Now()
+		update["last_error"] = nil
+		s.Log.Debugf("WEBHOOK_DELIVERED:%d:%s status=%d latency=%v", deliveryId, event, statusCode, latency)
+	case attemptCount >= int64(s.Options.MaxAttempts):
+		attemptRecord["error"] = errSend.Error()
+		update["status"] = DXWebhookStatusDead
+		update["last_error"] = errSend.Error()
+		s.Log.Warnf("WEBHOOK_DEAD:%d:%s after %d attempts (%v)", deliveryId, event, attemptCount, errSend.Error())
+	default:
+		attemptRecord["error"] = errSend.Error()
+		update["status"] = DXWebhookStatusPending
+		update["next_attempt_at"] = time.Now().Add(s.backoff(attemptCount))
+		update["last_error"] = errSend.Error()
+		s.Log.Infof("WEBHOOK_ATTEMPT_FAILED:%d:%s attempt %d (%v)", deliveryId, event, attemptCount, errSend.Error())
+	}
+
+	_, err := s.Database.Insert(s.attemptTableName(), "id", attemptRecord)
+	if err != nil {
+		s.Log.Errorf("WEBHOOK_ATTEMPT_CANT_BE_RECORDED:%d:%v", deliveryId, err.Error())
+	}
+	_, err = s.Database.Update(s.Options.TableName, update, utils.JSON{"id": deliveryId, "status": DXWebhookStatusSending})
+	if err != nil {
+		// The claim times out and the delivery is sent again, the receivers dedupe on the id of the body
+		s.Log.Errorf("WEBHOOK_DELIVERY_CANT_BE_UPDATED:%d:%v", deliveryId, err.Error())
+	}
+}
+
+func toInt64(v any) int64 {
+	switch t := v.(type) {
+	case int64:
+		return t
+	case int32:
+		return int64(t)
+	case int:
+		return int64(t)
+	case float64:
+		return int64(t)
+	}
+	return 0
+}
+
+// send POSTs body, a status outside 2xx is an error
+func (s *DXWebhookSender) send(ctx context.Context, targetURL string, event string, deliveryId int64, body []byte) (statusCode int, responseBody string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Options.RequestTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	ts := time.Now()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Webhook-Event", event)
+	request.Header.Set("X-Webhook-Delivery-Id", strconv.FormatInt(deliveryId, 10))
+	request.Header.Set(s.Options.SignatureHeader, security.FormatSignatureHeader(s.Options.KeyId, ts,
+		security.SignPayload([]byte(s.Options.Secret), body, ts)))
+	response, err := s.Options.HTTPClient.Do(request)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	b, _ := io.ReadAll(io.LimitReader(response.Body, dxWebhookMaxRecordedResponseBytes))
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, string(b), fmt.Errorf("WEBHOOK_RESPONSE_STATUS:%d", response.StatusCode)
+	}
+	return response.StatusCode, string(b), nil
+}
+
+// backoff is InitialBackoff doubled at each attempt up to MaxBackoff, with up to a quarter more at random
+func (s *DXWebhookSender) backoff(attemptCount int64) time.Duration {
+	d := s.Options.InitialBackoff
+	for i := int64(1); i < attemptCount && d < s.Options.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, s.Options.MaxBackoff)
+	return d + time.Duration(rand.Int63n(int64(d)/4+1))
+}
+
+// ListDeadLetters returns the page pageIndex of the deliveries given up, the most recent first
+func (s *DXWebhookSender) ListDeadLetters(rowsPerPage int64, pageIndex int64) (rows []utils.JSON, totalRows int64, err error) {
+	_, rows, totalRows, _, err = s.Database.SelectPaged(s.Options.TableName, nil, utils.JSON{"status": DXWebhookStatusDead},
+		map[string]string{"id": "desc"}, rowsPerPage, pageIndex)
+	return rows, totalRows, err
+}
+
+// ListAttempts returns the attempts of the delivery id, in their order
+func (s *DXWebhookSender) ListAttempts(id int64) (rows []utils.JSON, err error) {
+	_, rows, err = s.Database.Select(s.attemptTableName(), nil, utils.JSON{"delivery_id": id}, map[string]string{"attempt": "asc"}, nil)
+	return rows, err
+}
+
+// Retry puts the dead delivery id back in the queue with a fresh count of attempts
+func (s *DXWebhookSender) Retry(id int64) (err error) {
+	result, err := s.Database.Update(s.Options.TableName, utils.JSON{
+		"status":          DXWebhookStatusPending,
+		"attempt_count":   0,
+		"next_attempt_at": time.Now(),
+	}, utils.JSON{"id": id, "status": DXWebhookStatusDead})
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return s.Log.WarnAndCreateErrorf("WEBHOOK_DEAD_DELIVERY_NOT_FOUND:%d", id)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"net/http"
+
+	"github.com/donnyhardyanto/dxlib/api"
+	"github.com/donnyhardyanto/dxlib/utils"
+	utilsHttp "github.com/donnyhardyanto/dxlib/utils/http"
+)
+
+func adminResponsePossibilities(successDescription string) map[string]*api.DXAPIEndPointResponsePossibility {
+	return map[string]*api.DXAPIEndPointResponsePossibility{
+		"success":              {StatusCode: http.StatusOK, Description: successDescription},
+		"unprocessable_entity": {StatusCode: http.StatusUnprocessableEntity, Description: "Invalid parameter or no dead delivery with this id"},
+	}
+}
+
+// RegisterAdminEndPoints registers on a GET <uriPrefix>/dead-letter/list, the deliveries given up, GET
+// <uriPrefix>/attempt/list, the attempts of a delivery with their response status and latency, and POST
+// <uriPrefix>/dead-letter/retry putting a dead delivery back in the queue
+func (s *DXWebhookSender) RegisterAdminEndPoints(a *api.DXAPI, uriPrefix string, middlewares []api.DXAPIEndPointExecuteFunc, privileges []string) []*api.DXAPIEndPoint {
+	idParameter := api.DXAPIEndPointParameter{NameId: "id", Type: "int64", Description: "Id of the delivery", IsMustExist: true}
+	return []*api.DXAPIEndPoint{
+		a.NewEndPoint("List dead webhook deliveries", "The deliveries given up after their last attempt, the most recent first",
+			uriPrefix+"/dead-letter/list", http.MethodGet, api.EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone, []api.DXAPIEndPointParameter{
+				{NameId: "row_per_page", Type: "int64", Description: "Rows per page, 0 for every row"},
+				{NameId: "page_index", Type: "int64", Description: "Page, from 0"},
+			}, s.handleListDeadLetters, nil, adminResponsePossibilities("The dead deliveries of the page"), middlewares, privileges),
+		a.NewEndPoint("List webhook delivery attempts", "The attempts of a delivery with their response status and latency",
+			uriPrefix+"/attempt/list", http.MethodGet, api.EndPointTypeHTTPJSON, utilsHttp.ContentTypeNone,
+			[]api.DXAPIEndPointParameter{idParameter}, s.handleListAttempts, nil, adminResponsePossibilities("The attempts"), middlewares, privileges),
+		a.NewEndPoint("Retry a dead webhook delivery", "Put a dead delivery back in the queue with a fresh count of attempts",
+			uriPrefix+"/dead-letter/retry", http.MethodPost, api.EndPointTypeHTTPJSON, utilsHttp.ContentTypeApplicationJSON,
+			[]api.DXAPIEndPointParameter{idParameter}, s.handleRetry, nil, adminResponsePossibilities("Queued again"), middlewares, privileges),
+	}
+}
+
+func (s *DXWebhookSender) handleListDeadLetters(aepr *api.DXAPIEndPointRequest) (err error) {
+	_, rowPerPage, err := aepr.GetParameterValueAsInt64("row_per_page")
+	if err != nil {
+		return err
+	}
+	_, pageIndex, err := aepr.GetParameterValueAsInt64("page_index")
+	if err != nil {
+		return err
+	}
+	rows, totalRows, err := s.ListDeadLetters(rowPerPage, pageIndex)
+	if err != nil {
+		return err
+	}
+	aepr.WriteResponseAsJSON(http.StatusOK, nil, utils.JSON{
+		"list": utils.JSON{
+			"rows":       rows,
+			"total_rows": totalRows,
+		},
+	})
+	return nil
+}
+
+func (s *DXWebhookSender) handleListAttempts(aepr *api.DXAPIEndPointRequest) (err error) {
+	_, id, err := aepr.GetParameterValueAsInt64("id")
+	if err != nil {
+		return err
+	}
+	rows, err := s.ListAttempts(id)
+	if err != nil {
+		return err
+	}
+	aepr.WriteResponseAsJSON(http.StatusOK, nil, utils.JSON{"attempts": rows})
+	return nil
+}
+
+func (s *DXWebhookSender) handleRetry(aepr *api.DXAPIEndPointRequest) (err error) {
+	_, id, err := aepr.GetParameterValueAsInt64("id")
+	if err != nil {
+		return err
+	}
+	err = s.Retry(id)
+	if err != nil {
+		return aepr.WriteResponseAndNewErrorf(http.StatusUnprocessableEntity, "%s", err.Error())
+	}
+	aepr.WriteResponseAsJSON(http.StatusOK, nil, nil)
+	return nil
+}
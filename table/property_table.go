@@ -473,18 +473,13 @@ func (t *DXPropertyTable) DoEdit(aepr *api.DXAPIEndPointRequest, id int64, newKe
 		}
 	}
 
-	for k, v := range newKeyValues {
-		if v == nil {
-			delete(newKeyValues, k)
-		}
-	}
-
 	_, err = db.Update(t.Database.Connection, t.NameId, newKeyValues, utils.JSON{
 		t.FieldNameForRowId: id,
 		"is_deleted":        false,
 	})
 	if err != nil {
-		aepr.Log.Errorf("Error at %s.DoEdit (%s) ", t.NameId, err.Error())
+		tableLog := aepr.Log.WithFields(utils.JSON{"database": t.DatabaseNameId, "table": t.NameId})
+		tableLog.Errorf("Error at %s.DoEdit (%s) ", t.NameId, err.Error())
 		return err
 	}
 	aepr.WriteResponseAsJSON(http.StatusOK, nil, utils.JSON{
@@ -517,7 +512,8 @@ func (t *DXPropertyTable) DoDelete(aepr *api.DXAPIEndPointRequest, id int64) (er
 		t.FieldNameForRowId: id,
 	})
 	if err != nil {
-		aepr.Log.Errorf("Error at %s.DoDelete (%s) ", t.NameId, err.Error())
+		tableLog := aepr.Log.WithFields(utils.JSON{"database": t.DatabaseNameId, "table": t.NameId})
+		tableLog.Errorf("Error at %s.DoDelete (%s) ", t.NameId, err.Error())
 		return err
 	}
 	aepr.WriteResponseAsJSON(http.StatusOK, nil, nil)
@@ -536,7 +532,8 @@ func (t *DXPropertyTable) RequestSoftDelete(aepr *api.DXAPIEndPointRequest) (err
 
 	err = t.DoEdit(aepr, id, newFieldValues)
 	if err != nil {
-		aepr.Log.Errorf("Error at %s.RequestSoftDelete (%s) ", t.NameId, err.Error())
+		tableLog := aepr.Log.WithFields(utils.JSON{"database": t.DatabaseNameId, "table": t.NameId})
+		tableLog.Errorf("Error at %s.RequestSoftDelete (%s) ", t.NameId, err.Error())
 		return err
 	}
 	return err
@@ -550,7 +547,8 @@ func (t *DXPropertyTable) RequestHardDelete(aepr *api.DXAPIEndPointRequest) (err
 
 	err = t.DoDelete(aepr, id)
 	if err != nil {
-		aepr.Log.Errorf("Error at %s.RequestHardDelete (%s) ", t.NameId, err.Error())
+		tableLog := aepr.Log.WithFields(utils.JSON{"database": t.DatabaseNameId, "table": t.NameId})
+		tableLog.Errorf("Error at %s.RequestHardDelete (%s) ", t.NameId, err.Error())
 		return err
 	}
 	return err
@@ -184,17 +184,12 @@ func (t *DXRawTable) DoEdit(aepr *api.DXAPIEndPointRequest, id int64, newKeyValu
 		return err
 	}
 
-	for k, v := range newKeyValues {
-		if v == nil {
-			delete(newKeyValues, k)
-		}
-	}
-
 	_, err = db.Update(t.Database.Connection, t.NameId, newKeyValues, utils.JSON{
 		t.FieldNameForRowId: id,
 	})
 	if err != nil {
-		aepr.Log.Errorf("Error at %s.DoEdit (%s) ", t.NameId, err.Error())
+		tableLog := aepr.Log.WithFields(utils.JSON{"database": t.DatabaseNameId, "table": t.NameId})
+		tableLog.Errorf("Error at %s.DoEdit (%s) ", t.NameId, err.Error())
 		return err
 	}
 	aepr.WriteResponseAsJSON(http.StatusOK, nil, utils.JSON{
@@ -227,7 +222,8 @@ func (t *DXRawTable) DoDelete(aepr *api.DXAPIEndPointRequest, id int64) (err err
 		t.FieldNameForRowId: id,
 	})
 	if err != nil {
-		aepr.Log.Errorf("Error at %s.DoDelete (%s) ", t.NameId, err.Error())
+		tableLog := aepr.Log.WithFields(utils.JSON{"database": t.DatabaseNameId, "table": t.NameId})
+		tableLog.Errorf("Error at %s.DoDelete (%s) ", t.NameId, err.Error())
 		return err
 	}
 	aepr.WriteResponseAsJSON(http.StatusOK, nil, nil)
@@ -242,7 +238,8 @@ func (t *DXRawTable) RequestHardDelete(aepr *api.DXAPIEndPointRequest) (err erro
 
 	err = t.DoDelete(aepr, id)
 	if err != nil {
-		aepr.Log.Errorf("Error at %s.RequestHardDelete (%s) ", t.NameId, err.Error())
+		tableLog := aepr.Log.WithFields(utils.JSON{"database": t.DatabaseNameId, "table": t.NameId})
+		tableLog.Errorf("Error at %s.RequestHardDelete (%s) ", t.NameId, err.Error())
 		return err
 	}
 	return err
@@ -321,18 +321,13 @@ func (t *DXTable) DoEdit(aepr *api.DXAPIEndPointRequest, id int64, newKeyValues
 		}
 	}
 
-	for k, v := range newKeyValues {
-		if v == nil {
-			delete(newKeyValues, k)
-		}
-	}
-
 	_, err = db.Update(t.Database.Connection, t.NameId, newKeyValues, utils.JSON{
 		t.FieldNameForRowId: id,
 		"is_deleted":        false,
 	})
 	if err != nil {
-		aepr.Log.Errorf("Error at %s.DoEdit (%s) ", t.NameId, err.Error())
+		tableLog := aepr.Log.WithFields(utils.JSON{"database": t.DatabaseNameId, "table": t.NameId})
+		tableLog.Errorf("Error at %s.DoEdit (%s) ", t.NameId, err.Error())
 		return err
 	}
 	aepr.WriteResponseAsJSON(http.StatusOK, nil, utils.JSON{
@@ -365,7 +360,8 @@ func (t *DXTable) DoDelete(aepr *api.DXAPIEndPointRequest, id int64) (err error)
 		t.FieldNameForRowId: id,
 	})
 	if err != nil {
-		aepr.Log.Errorf("Error at %s.DoDelete (%s) ", t.NameId, err.Error())
+		tableLog := aepr.Log.WithFields(utils.JSON{"database": t.DatabaseNameId, "table": t.NameId})
+		tableLog.Errorf("Error at %s.DoDelete (%s) ", t.NameId, err.Error())
 		return err
 	}
 	aepr.WriteResponseAsJSON(http.StatusOK, nil, nil)
@@ -384,7 +380,8 @@ func (t *DXTable) RequestSoftDelete(aepr *api.DXAPIEndPointRequest) (err error)
 
 	err = t.DoEdit(aepr, id, newFieldValues)
 	if err != nil {
-		aepr.Log.Errorf("Error at %s.RequestSoftDelete (%s) ", t.NameId, err.Error())
+		tableLog := aepr.Log.WithFields(utils.JSON{"database": t.DatabaseNameId, "table": t.NameId})
+		tableLog.Errorf("Error at %s.RequestSoftDelete (%s) ", t.NameId, err.Error())
 		return err
 	}
 	return err
@@ -398,7 +395,8 @@ func (t *DXTable) RequestHardDelete(aepr *api.DXAPIEndPointRequest) (err error)
 
 	err = t.DoDelete(aepr, id)
 	if err != nil {
-		aepr.Log.Errorf("Error at %s.RequestHardDelete (%s) ", t.NameId, err.Error())
+		tableLog := aepr.Log.WithFields(utils.JSON{"database": t.DatabaseNameId, "table": t.NameId})
+		tableLog.Errorf("Error at %s.RequestHardDelete (%s) ", t.NameId, err.Error())
 		return err
 	}
 	return err
@@ -32,6 +32,9 @@ type DXTaskManager struct {
 	Context           context.Context
 	Cancel            context.CancelFunc
 	Tasks             map[string]*DXTask
+	Jobs              map[string]*DXJob
+	Clock             DXTaskClock
+	Locker            DXJobLocker
 	ErrorGroup        *errgroup.Group
 	ErrorGroupContext context.Context
 }
@@ -74,9 +77,22 @@ func (am *DXTaskManager) StartAll(errorGroup *errgroup.Group, errorGroupContext
 			return err
 		}
 	}
+	for _, v := range am.Jobs {
+		j := v
+		am.ErrorGroup.Go(func() error {
+			return j.loop(am.jobContext())
+		})
+	}
 	return nil
 }
 
+// jobContext is done when the manager is cancelled, RootContext included, or when the error group stops
+func (am *DXTaskManager) jobContext() context.Context {
+	ctx, cancel := context.WithCancel(am.Context)
+	context.AfterFunc(am.ErrorGroupContext, cancel)
+	return ctx
+}
+
 func (am *DXTaskManager) StopAll() (err error) {
 	am.ErrorGroupContext.Done()
 	err = am.ErrorGroup.Wait()
@@ -175,5 +191,12 @@ func init() {
 		Context: ctx,
 		Cancel:  cancel,
 		Tasks:   map[string]*DXTask{},
+		Jobs:    map[string]*DXJob{},
 	}
+	core.RegisterShutdownHook("task", core.ShutdownPriorityWorker, func(ctx context.Context) error {
+		if Manager.ErrorGroup == nil {
+			return nil
+		}
+		return Manager.StopAll()
+	})
 }
@@ -0,0 +1,135 @@
+package task
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five field cron expression: minute hour day-of-month month day-of-week
+type cronSchedule struct {
+	minute     uint64
+	hour       uint64
+	dayOfMonth uint64
+	month      uint64
+	dayOfWeek  uint64
+	// Like cron, when both day fields are restricted a day matching either of them matches
+	isDayOfMonthAny bool
+	isDayOfWeekAny  bool
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":  "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+}
+
+// parseCronField returns the bit set of the values of field between min and max, field is made of comma separated items, each
+// one "*", a value or a range "a-b", optionally followed by a step "/n"
+func parseCronField(field string, min, max int) (bits uint64, err error) {
+	for _, item := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("CRON_INVALID_STEP:%s", item)
+			}
+		}
+		low, high := min, max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			low, err = strconv.Atoi(lowPart)
+			if err != nil {
+				return 0, fmt.Errorf("CRON_INVALID_VALUE:%s", item)
+			}
+			high = low
+			if isRange {
+				high, err = strconv.Atoi(highPart)
+				if err != nil {
+					return 0, fmt.Errorf("CRON_INVALID_VALUE:%s", item)
+				}
+			} else if hasStep {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("CRON_VALUE_OUT_OF_RANGE:%s:%d-%d", item, min, max)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronSchedule(expression string) (s *cronSchedule, err error) {
+	descriptor, ok := cronDescriptors[strings.TrimSpace(expression)]
+	if ok {
+		expression = descriptor
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("CRON_EXPRESSION_NEEDS_5_FIELDS:%s", expression)
+	}
+	s = &cronSchedule{isDayOfMonthAny: fields[2] == "*", isDayOfWeekAny: fields[4] == "*"}
+	ranges := []struct {
+		target   *uint64
+		min, max int
+	}{
+		{&s.minute, 0, 59},
+		{&s.hour, 0, 23},
+		{&s.dayOfMonth, 1, 31},
+		{&s.month, 1, 12},
+		{&s.dayOfWeek, 0, 7},
+	}
+	for i, r := range ranges {
+		*r.target, err = parseCronField(fields[i], r.min, r.max)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// 7 is another name of sunday
+	if s.dayOfWeek&(1<<7) != 0 {
+		s.dayOfWeek |= 1
+	}
+	return s, nil
+}
+
+func (s *cronSchedule) isDayMatching(t time.Time) bool {
+	isDayOfMonth := s.dayOfMonth&(1<<uint(t.Day())) != 0
+	isDayOfWeek := s.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	if s.isDayOfMonthAny || s.isDayOfWeekAny {
+		return isDayOfMonth && isDayOfWeek
+	}
+	return isDayOfMonth || isDayOfWeek
+}
+
+// next returns the first matching minute after t, the zero time when none comes within five years (like 30 february)
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.isDayMatching(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,286 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/core"
+	"github.com/donnyhardyanto/dxlib/log"
+)
+
+// DXTaskClock is the time source of the jobs, DXTaskManager.Clock nil is the system clock and a fake one lets a test drive
+// the schedule
+type DXTaskClock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// DXJobDefaultMaxStartJitter bounds the random delay of the first run of a periodic job, so the jobs of many instances
+// started together do not all run at the same moment
+var DXJobDefaultMaxStartJitter = 30 * time.Second
+
+type DXJobFunc func(ctx context.Context, log *log.DXLog) error
+
+// DXJobLocker lets one instance only run a job when several run the same service, a database.DXDatabase is one
+type DXJobLocker interface {
+	// WithLockContext runs fn holding the lock name and returns false without running it when another instance holds it
+	WithLockContext(ctx context.Context, name string, ttl time.Duration, fn func(ctx context.Context) error) (acquired bool, err error)
+}
+
+type DXJobStatus struct {
+	NameId          string        `json:"nameid"`
+	IsRunning       bool          `json:"is_running"`
+	RunCount        int64         `json:"run_count"`
+	SkippedCount    int64         `json:"skipped_count"`
+	LastStartTime   time.Time     `json:"last_start_time"`
+	LastDuration    time.Duration `json:"last_duration"`
+	LastSuccessTime time.Time     `json:"last_success_time"`
+	LastError       string        `json:"last_error,omitempty"`
+}
+
+// DXJob runs OnExecute every Interval, or at the minutes of CronExpression. A run still going when the next one is due makes
+// that one skipped, runs never overlap.
+type DXJob struct {
+	Owner          *DXTaskManager
+	NameId         string
+	Interval       time.Duration
+	CronExpression string
+	// Timeout cancels the context of a run, zero is Interval for a periodic job and no timeout for a cron job
+	Timeout time.Duration
+	// StartJitter is the upper bound of the random delay before the first run of a periodic job
+	StartJitter time.Duration
+	// Locker takes the lock of each run so only one instance runs it, DXTaskManager.Locker when nil, none when both are nil. A
+	// run whose lock is held elsewhere is skipped.
+	Locker DXJobLocker
+	// LockTTL is the TTL of the lock of a run, the default of the Locker when zero
+	LockTTL     time.Duration
+	OnExecute   DXJobFunc
+	Log         log.DXLog
+	schedule    *cronSchedule
+	trigger     chan struct{}
+	isRunning   atomic.Bool
+	statusMutex sync.Mutex
+	status      DXJobStatus
+}
+
+func (am *DXTaskManager) newJob(nameId string, fn DXJobFunc) (*DXJob, error) {
+	_, ok := am.Jobs[nameId]
+	if ok {
+		return nil, log.Log.ErrorAndCreateErrorf("JOB_ALREADY_REGISTERED:%s", nameId)
+	}
+	j := &DXJob{
+		Owner:     am,
+		NameId:    nameId,
+		OnExecute: fn,
+		Log:       log.NewLog(&log.Log, am.Context, "job:"+nameId),
+		trigger:   make(chan struct{}, 1),
+		status:    DXJobStatus{NameId: nameId},
+	}
+	am.Jobs[nameId] = j
+	core.Health.RegisterCheck(j.healthCheckName(), core.DXHealthCheckKindInfo, nil)
+	return j, nil
+}
+
+// RegisterPeriodic registers a job running fn every interval, the first run comes after a random delay of at most
+// DXJobDefaultMaxStartJitter, or of interval when it is shorter. It is started by StartAll.
+func (am *DXTaskManager) RegisterPeriodic(nameId string, interval time.Duration, fn DXJobFunc) (*DXJob, error) {
+	if interval <= 0 {
+		return nil, log.Log.ErrorAndCreateErrorf("JOB_INVALID_INTERVAL:%s:%v", nameId, interval)
+	}
+	j, err := am.newJob(nameId, fn)
+	if err != nil {
+		return nil, err
+	}
+	j.Interval = interval
+	j.Timeout = interval
+	j.StartJitter = min(interval, DXJobDefaultMaxStartJitter)
+	return j, nil
+}
+
+// RegisterCron registers a job running fn at the minutes of cronExpr, "minute hour day-of-month month day-of-week" in the
+// local time, or one of @hourly, @daily, @weekly, @monthly and @yearly. It is started by StartAll.
+func (am *DXTaskManager) RegisterCron(nameId string, cronExpr string, fn DXJobFunc) (*DXJob, error) {
+	schedule, err := parseCronSchedule(cronExpr)
+	if err != nil {
+		return nil, log.Log.ErrorAndCreateErrorf("JOB_INVALID_CRON_EXPRESSION:%s:%v", nameId, err.Error())
+	}
+	j, err := am.newJob(nameId, fn)
+	if err != nil {
+		return nil, err
+	}
+	j.CronExpression = cronExpr
+	j.schedule = schedule
+	return j, nil
+}
+
+// TriggerNow runs the job as soon as possible, outside of its schedule. A trigger while a run is going is skipped like a
+// scheduled run.
+func (am *DXTaskManager) TriggerNow(nameId string) (err error) {
+	j, ok := am.Jobs[nameId]
+	if !ok {
+		return log.Log.WarnAndCreateErrorf("JOB_NOT_FOUND:%s", nameId)
+	}
+	select {
+	case j.trigger <- struct{}{}:
+	default:
+		// A trigger is already waiting
+	}
+	return nil
+}
+
+// JobStatuses returns the status of every job
+func (am *DXTaskManager) JobStatuses() (r []DXJobStatus) {
+	for _, j := range am.Jobs {
+		r = append(r, j.Status())
+	}
+	return r
+}
+
+func (j *DXJob) Status() DXJobStatus {
+	j.statusMutex.Lock()
+	defer j.statusMutex.Unlock()
+	s := j.status
+	s.IsRunning = j.isRunning.Load()
+	return s
+}
+
+func (j *DXJob) healthCheckName() string {
+	return "task." + j.NameId
+}
+
+func (j *DXJob) locker() DXJobLocker {
+	if j.Locker == nil && j.Owner != nil {
+		return j.Owner.Locker
+	}
+	return j.Locker
+}
+
+func (j *DXJob) clock() DXTaskClock {
+	if j.Owner != nil && j.Owner.Clock != nil {
+		return j.Owner.Clock
+	}
+	return systemClock{}
+}
+
+// nextDelay is the wait before the next scheduled run, isFirst adds the start jitter of a periodic job
+func (j *DXJob) nextDelay(isFirst bool) (d time.Duration, err error) {
+	if j.schedule == nil {
+		if isFirst && j.StartJitter > 0 {
+			return time.Duration(rand.Int63n(int64(j.StartJitter))), nil
+		}
+		return j.Interval, nil
+	}
+	now := j.clock().Now()
+	next := j.schedule.next(now)
+	if next.IsZero() {
+		return 0, fmt.Errorf("JOB_CRON_NEVER_MATCHES:%s", j.CronExpression)
+	}
+	return next.Sub(now), nil
+}
+
+// loop waits for the schedule or a trigger until ctx is done, the runs happen in their own goroutine so a run stuck past its
+// timeout does not stop the schedule
+func (j *DXJob) loop(ctx context.Context) (err error) {
+	j.Log.Infof("Job %s started (interval=%v cron=%q)", j.NameId, j.Interval, j.CronExpression)
+	isFirst := true
+	for {
+		delay, err := j.nextDelay(isFirst)
+		if err != nil {
+			j.Log.Errorf("%s", err.Error())
+			return nil
+		}
+		isFirst = false
+		select {
+		case <-ctx.Done():
+			j.Log.Infof("Job %s stopped", j.NameId)
+			return nil
+		case <-j.clock().After(delay):
+		case <-j.trigger:
+			j.Log.Infof("Job %s triggered", j.NameId)
+		}
+		j.start(ctx)
+	}
+}
+
+func (j *DXJob) start(ctx context.Context) {
+	if !j.isRunning.CompareAndSwap(false, true) {
+		j.statusMutex.Lock()
+		j.status.SkippedCount++
+		j.statusMutex.Unlock()
+		j.Log.Warnf("JOB_SKIPPED_STILL_RUNNING:%s", j.NameId)
+		return
+	}
+	go func() {
+		defer j.isRunning.Store(false)
+		j.run(ctx)
+	}()
+}
+
+func (j *DXJob) run(ctx context.Context) {
+	startTime := j.clock().Now()
+	runCtx, cancel := ctx, context.CancelFunc(func() {})
+	if j.Timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, j.Timeout)
+	}
+	defer cancel()
+	execute := func(ctx context.Context) (err error) {
+		defer func() {
+			rec := recover()
+			if rec != nil {
+				err = j.Log.CapturePanic(rec, "JOB_PANIC:"+j.NameId)
+			}
+		}()
+		return j.OnExecute(ctx, &j.Log)
+	}
+	var err error
+	if locker := j.locker(); locker != nil {
+		var acquired bool
+		acquired, err = locker.WithLockContext(runCtx, j.healthCheckName(), j.LockTTL, execute)
+		if err == nil && !acquired {
+			j.statusMutex.Lock()
+			j.status.SkippedCount++
+			j.statusMutex.Unlock()
+			j.Log.Debugf("Job %s skipped, its lock is held by another instance", j.NameId)
+			return
+		}
+	} else {
+		err = execute(runCtx)
+	}
+	if err == nil && runCtx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("JOB_TIMEOUT:%v", j.Timeout)
+	}
+	duration := j.clock().Now().Sub(startTime)
+
+	j.statusMutex.Lock()
+	j.status.RunCount++
+	j.status.LastStartTime = startTime
+	j.status.LastDuration = duration
+	if err != nil {
+		j.status.LastError = err.Error()
+	} else {
+		j.status.LastError = ""
+		j.status.LastSuccessTime = startTime
+	}
+	j.statusMutex.Unlock()
+	core.Health.SetStatus(j.healthCheckName(), err)
+
+	if err != nil {
+		j.Log.Errorf("Job %s failed in %v (%v)", j.NameId, duration, err.Error())
+		return
+	}
+	j.Log.Debugf("Job %s done in %v", j.NameId, duration)
+}
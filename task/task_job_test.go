@@ -0,0 +1,326 @@
+package task
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/log"
+)
+
+// fakeClock moves only when advanced, every After it is asked for is reported on afters so a test knows the job waits
+type fakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []fakeClockWaiter
+	afters  chan time.Duration
+}
+
+type fakeClockWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, afters: make(chan time.Duration, 64)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+	} else {
+		c.waiters = append(c.waiters, fakeClockWaiter{at: c.now.Add(d), c: ch})
+	}
+	c.mutex.Unlock()
+	c.afters <- d
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	var waiters []fakeClockWaiter
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = waiters
+}
+
+// nextAfter returns the delay of the next wait of the job
+func (c *fakeClock) nextAfter(t *testing.T) time.Duration {
+	t.Helper()
+	select {
+	case d := <-c.afters:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job does not wait for its next run")
+		return 0
+	}
+}
+
+func newTestTaskManager(t *testing.T, clock *fakeClock) *DXTaskManager {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &DXTaskManager{
+		Context: ctx,
+		Cancel:  cancel,
+		Tasks:   map[string]*DXTask{},
+		Jobs:    map[string]*DXJob{},
+		Clock:   clock,
+	}
+}
+
+// startJobLoop runs the loop of j until the end of the test
+func startJobLoop(t *testing.T, j *DXJob) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(j.Owner.Context)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = j.loop(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+}
+
+func countingJob(runs chan<- struct{}) DXJobFunc {
+	return func(ctx context.Context, log *log.DXLog) error {
+		runs <- struct{}{}
+		return nil
+	}
+}
+
+func expectRun(t *testing.T, runs <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-runs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job did not run")
+	}
+}
+
+func expectNoRun(t *testing.T, runs <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-runs:
+		t.Fatal("the job ran before it was due")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPeriodicJobRunsEveryInterval(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC))
+	am := newTestTaskManager(t, clock)
+	runs := make(chan struct{}, 4)
+	j, err := am.RegisterPeriodic("test-periodic", time.Minute, countingJob(runs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.StartJitter = 0
+	startJobLoop(t, j)
+	for i := 0; i < 3; i++ {
+		if d := clock.nextAfter(t); d != time.Minute {
+			t.Fatalf("run %d is due after %v", i, d)
+		}
+		clock.Advance(59 * time.Second)
+		expectNoRun(t, runs)
+		clock.Advance(time.Second)
+		expectRun(t, runs)
+	}
+}
+
+func TestPeriodicJobFirstRunIsJittered(t *testing.T) {
+	am := newTestTaskManager(t, newFakeClock(time.Now()))
+	j, err := am.RegisterPeriodic("test-jitter", time.Hour, countingJob(make(chan struct{}, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.StartJitter != DXJobDefaultMaxStartJitter {
+		t.Fatalf("jitter %v", j.StartJitter)
+	}
+	delays := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		d, err := j.nextDelay(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d < 0 || d >= j.StartJitter {
+			t.Fatalf("first delay %v out of [0, %v)", d, j.StartJitter)
+		}
+		delays[d] = true
+	}
+	if len(delays) < 2 {
+		t.Fatal("the first delay is not random")
+	}
+	d, _ := j.nextDelay(false)
+	if d != time.Hour {
+		t.Fatalf("the next delays are %v, not the interval", d)
+	}
+
+	// The jitter is bounded by a shorter interval
+	short, err := am.RegisterPeriodic("test-jitter-short", time.Second, countingJob(make(chan struct{}, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if short.StartJitter != time.Second {
+		t.Fatalf("jitter %v", short.StartJitter)
+	}
+}
+
+func TestCronJobWaitsForTheNextMatchingMinute(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, 10, 14, 10, 7, 30, 0, time.UTC))
+	am := newTestTaskManager(t, clock)
+	runs := make(chan struct{}, 4)
+	j, err := am.RegisterCron("test-cron", "*/15 * * * *", countingJob(runs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	startJobLoop(t, j)
+	if d := clock.nextAfter(t); d != 7*time.Minute+30*time.Second {
+		t.Fatalf("the first run is due after %v", d)
+	}
+	clock.Advance(7*time.Minute + 30*time.Second)
+	expectRun(t, runs)
+	if d := clock.nextAfter(t); d != 15*time.Minute {
+		t.Fatalf("the second run is due after %v", d)
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// 2026-10-14 is a wednesday
+	from := time.Date(2026, 10, 14, 10, 7, 30, 0, time.UTC)
+	for _, tc := range []struct {
+		expression string
+		want       time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 14, 10, 8, 0, 0, time.UTC)},
+		{"7 10 * * *", time.Date(2026, 10, 15, 10, 7, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 10, 14, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1", time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"30 8-17/3 * * 1-5", time.Date(2026, 10, 14, 11, 30, 0, 0, time.UTC)},
+		// A day of month and a day of week both restricted match either
+		{"0 0 20 * 5", time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		s, err := parseCronSchedule(tc.expression)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expression, err)
+		}
+		if got := s.next(from); !got.Equal(tc.want) {
+			t.Errorf("%s: next %v, want %v", tc.expression, got, tc.want)
+		}
+	}
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "a * * * *"} {
+		_, err := parseCronSchedule(expression)
+		if err == nil {
+			t.Errorf("%q is accepted", expression)
+		}
+	}
+}
+
+func TestCronJobNeverMatchingStops(t *testing.T) {
+	am := newTestTaskManager(t, newFakeClock(time.Now()))
+	j, err := am.RegisterCron("test-cron-never", "0 0 30 2 *", countingJob(make(chan struct{}, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = j.nextDelay(true)
+	if err == nil || !strings.HasPrefix(err.Error(), "JOB_CRON_NEVER_MATCHES:") {
+		t.Fatalf("err %v", err)
+	}
+}
+
+func TestJobRunStillGoingSkipsTheNextOne(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC))
+	am := newTestTaskManager(t, clock)
+	runs := make(chan struct{}, 4)
+	release := make(chan struct{})
+	j, err := am.RegisterPeriodic("test-overlap", time.Minute, func(ctx context.Context, log *log.DXLog) error {
+		runs <- struct{}{}
+		<-release
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.StartJitter = 0
+	startJobLoop(t, j)
+	clock.nextAfter(t)
+	clock.Advance(time.Minute)
+	expectRun(t, runs)
+
+	// The second run is due while the first one still goes
+	clock.nextAfter(t)
+	clock.Advance(time.Minute)
+	clock.nextAfter(t)
+	expectNoRun(t, runs)
+	s := j.Status()
+	if !s.IsRunning || s.SkippedCount != 1 || s.RunCount != 0 {
+		t.Fatalf("status %+v", s)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for j.Status().IsRunning {
+		if time.Now().After(deadline) {
+			t.Fatal("the first run did not end")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Minute)
+	expectRun(t, runs)
+	if s := j.Status(); s.SkippedCount != 1 {
+		t.Fatalf("status %+v", s)
+	}
+}
+
+func TestTriggerNowRunsOutsideOfTheSchedule(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC))
+	am := newTestTaskManager(t, clock)
+	runs := make(chan struct{}, 4)
+	j, err := am.RegisterPeriodic("test-trigger", time.Hour, countingJob(runs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.StartJitter = 0
+	startJobLoop(t, j)
+	clock.nextAfter(t)
+	err = am.TriggerNow("test-trigger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRun(t, runs)
+	// The schedule goes on from the trigger
+	if d := clock.nextAfter(t); d != time.Hour {
+		t.Fatalf("the next run is due after %v", d)
+	}
+
+	err = am.TriggerNow("missing")
+	if err == nil || !strings.HasPrefix(err.Error(), "JOB_NOT_FOUND:") {
+		t.Fatalf("err %v", err)
+	}
+}
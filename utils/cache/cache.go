@@ -0,0 +1,245 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/core"
+	"golang.org/x/sync/singleflight"
+)
+
+// DXCacheStore keeps the entries of a DXCache, DXMemoryCacheStore is the in-memory one. A store shared by several processes,
+// like Redis, implements the same methods. The evicted counts are the entries dropped to make room or because they expired.
+type DXCacheStore[K comparable, V any] interface {
+	Get(key K) (value V, isFound bool, evicted int)
+	Set(key K, value V, ttl time.Duration) (evicted int)
+	Delete(key K)
+	DeleteExpired() (evicted int)
+	Len() int
+}
+
+type memoryCacheItem[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+// DXMemoryCacheStore is an LRU of at most MaxEntries entries, the least recently used one is evicted first
+type DXMemoryCacheStore[K comparable, V any] struct {
+	MaxEntries int
+	mutex      sync.Mutex
+	items      map[K]*list.Element
+	order      *list.List
+}
+
+func NewMemoryCacheStore[K comparable, V any](maxEntries int) *DXMemoryCacheStore[K, V] {
+	return &DXMemoryCacheStore[K, V]{
+		MaxEntries: maxEntries,
+		items:      map[K]*list.Element{},
+		order:      list.New(),
+	}
+}
+
+func (s *DXMemoryCacheStore[K, V]) Get(key K) (value V, isFound bool, evicted int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.items[key]
+	if !ok {
+		return value, false, 0
+	}
+	item := e.Value.(*memoryCacheItem[K, V])
+	if !item.expiresAt.IsZero() && time.Now().After(item.expiresAt) {
+		s.order.Remove(e)
+		delete(s.items, key)
+		return value, false, 1
+	}
+	s.order.MoveToFront(e)
+	return item.value, true, 0
+}
+
+// Set keeps value for ttl, forever when ttl is zero
+func (s *DXMemoryCacheStore[K, V]) Set(key K, value V, ttl time.Duration) (evicted int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+	e, ok := s.items[key]
+	if ok {
+		item := e.Value.(*memoryCacheItem[K, V])
+		item.value, item.expiresAt = value, expiresAt
+		s.order.MoveToFront(e)
+		return 0
+	}
+	s.items[key] = s.order.PushFront(&memoryCacheItem[K, V]{key: key, value: value, expiresAt: expiresAt})
+	for s.MaxEntries > 0 && s.order.Len() > s.MaxEntries {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(*memoryCacheItem[K, V]).key)
+		evicted++
+	}
+	return evicted
+}
+
+func (s *DXMemoryCacheStore[K, V]) Delete(key K) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.items[key]
+	if ok {
+		s.order.Remove(e)
+		delete(s.items, key)
+	}
+}
+
+func (s *DXMemoryCacheStore[K, V]) DeleteExpired() (evicted int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	for key, e := range s.items {
+		expiresAt := e.Value.(*memoryCacheItem[K, V]).expiresAt
+		if !expiresAt.IsZero() && now.After(expiresAt) {
+			s.order.Remove(e)
+			delete(s.items, key)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+func (s *DXMemoryCacheStore[K, V]) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.order.Len()
+}
+
+type DXCacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Entries   int
+}
+
+// DXCache is a cache of values of V by K with a default TTL. Concurrent GetOrLoad of the same key run the loader once, the
+// others wait for its result.
+type DXCache[K comparable, V any] struct {
+	Store     DXCacheStore[K, V]
+	TTL       time.Duration
+	group     singleflight.Group
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// New returns a cache in memory of at most maxEntries entries, unbounded when zero, kept for ttl, forever when zero. The expired
+// entries are dropped when read, and every ttl by a cleanup running until Close or the end of core.RootContext.
+func New[K comparable, V any](maxEntries int, ttl time.Duration) *DXCache[K, V] {
+	return NewWithStore[K, V](NewMemoryCacheStore[K, V](maxEntries), ttl)
+}
+
+// NewWithStore is New with the entries kept in store
+func NewWithStore[K comparable, V any](store DXCacheStore[K, V], ttl time.Duration) *DXCache[K, V] {
+	c := &DXCache[K, V]{
+		Store: store,
+		TTL:   ttl,
+		done:  make(chan struct{}),
+	}
+	if ttl > 0 {
+		go c.cleanup(max(ttl, time.Second))
+	}
+	return c
+}
+
+func (c *DXCache[K, V]) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var rootDone <-chan struct{}
+	if core.RootContext != nil {
+		rootDone = core.RootContext.Done()
+	}
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-rootDone:
+			return
+		case <-ticker.C:
+			c.evictions.Add(int64(c.Store.DeleteExpired()))
+		}
+	}
+}
+
+// Close stops the cleanup, the cache can still be used
+func (c *DXCache[K, V]) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+func (c *DXCache[K, V]) Get(key K) (value V, isFound bool) {
+	value, isFound, evicted := c.Store.Get(key)
+	c.evictions.Add(int64(evicted))
+	if isFound {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return value, isFound
+}
+
+func (c *DXCache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.TTL)
+}
+
+func (c *DXCache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.evictions.Add(int64(c.Store.Set(key, value, ttl)))
+}
+
+func (c *DXCache[K, V]) Delete(key K) {
+	c.Store.Delete(key)
+}
+
+// GetOrLoad returns the value of key, loaded by loader and kept when missing. The error of loader is returned and not kept.
+func (c *DXCache[K, V]) GetOrLoad(key K, loader func() (V, error)) (value V, err error) {
+	return c.GetOrLoadWithTTL(key, c.TTL, loader)
+}
+
+func (c *DXCache[K, V]) GetOrLoadWithTTL(key K, ttl time.Duration, loader func() (V, error)) (value V, err error) {
+	value, isFound := c.Get(key)
+	if isFound {
+		return value, nil
+	}
+	v, err, _ := c.group.Do(fmt.Sprintf("%#v", key), func() (v any, err error) {
+		// Another call may have loaded it between the miss and here
+		value, isFound, _ := c.Store.Get(key)
+		if isFound {
+			return value, nil
+		}
+		value, err = loader()
+		if err != nil {
+			return nil, err
+		}
+		c.SetWithTTL(key, value, ttl)
+		return value, nil
+	})
+	if err != nil {
+		return value, err
+	}
+	value, _ = v.(V)
+	return value, nil
+}
+
+// Stats returns the counters since the cache was created, for the metrics
+func (c *DXCache[K, V]) Stats() DXCacheStats {
+	return DXCacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Entries:   c.Store.Len(),
+	}
+}
@@ -2,12 +2,16 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/donnyhardyanto/dxlib/utils/retry"
+	security "github.com/donnyhardyanto/dxlib/utils/security"
 	log "github.com/sirupsen/logrus"
 	"io"
 	"net/http"
+	"time"
 )
 
 type HTTPHeader = map[string]string
@@ -31,10 +35,7 @@ func (hr *HTTPResponse) BodyAsJSON() (map[string]any, error) {
 	return v, nil
 }
 
-func HTTPClient(method string, url string, headers map[string]string, body any) (request *http.Request, response *http.Response, err error) {
-	var bodyAsBytes []byte
-	contentType := ``
-
+func bodyToBytes(body any) (bodyAsBytes []byte, contentType string, err error) {
 	switch body.(type) {
 	case string:
 		bodyAsBytes = []byte(body.(string))
@@ -45,18 +46,27 @@ func HTTPClient(method string, url string, headers map[string]string, body any)
 	case map[string]any:
 		bodyAsBytes, err = json.Marshal(body)
 		if err != nil {
-			return nil, nil, err
+			return nil, ``, err
 		}
 		contentType = `application/json`
 		break
 	default:
 		err = errors.New(fmt.Sprintf(`SHOULD_NOT_HAPPEN:TYPE_CANT_BE_CONVERTED_TO_BYTES:%v`, body))
-		return nil, nil, err
+		return nil, ``, err
 	}
+	return bodyAsBytes, contentType, nil
+}
+
+// HTTPClientMaxRetries bounds the retries of a request of HTTPClientContext, besides the retry.Budget of its context
+var HTTPClientMaxRetries = 2
 
-	request, err = http.NewRequest(method, url, bytes.NewBuffer(bodyAsBytes))
+// HTTPClientRetryDelay is the wait before the first retry of HTTPClientContext, each next one waits one more of it
+var HTTPClientRetryDelay = 100 * time.Millisecond
+
+func newRequest(ctx context.Context, method string, url string, headers map[string]string, bodyAsBytes []byte, contentType string) (request *http.Request, err error) {
+	request, err = http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(bodyAsBytes))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	if contentType != `` {
@@ -68,6 +78,19 @@ func HTTPClient(method string, url string, headers map[string]string, body any)
 	for key, value := range headers {
 		request.Header.Set(key, value)
 	}
+	return request, nil
+}
+
+func HTTPClient(method string, url string, headers map[string]string, body any) (request *http.Request, response *http.Response, err error) {
+	bodyAsBytes, contentType, err := bodyToBytes(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request, err = newRequest(context.Background(), method, url, headers, bodyAsBytes, contentType)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// RequestCreate an HTTP client and send the request
 	client := &http.Client{}
@@ -78,11 +101,61 @@ func HTTPClient(method string, url string, headers map[string]string, body any)
 	return request, resp, nil
 }
 
-func HTTPClientReadAll(method string, url string, headers map[string]string, body any) (request *http.Request, response *HTTPResponse, err error) {
-	request, resp, err := HTTPClient(method, url, headers, body)
+// HTTPClientContext is HTTPClient in ctx, an idempotent request failing to connect or answered with 502, 503 or 504 is retried
+// up to HTTPClientMaxRetries times, each retry consuming from the retry.Budget of ctx. Once the budget is spent the failure is
+// returned with retry.ErrBudgetExhausted attached.
+func HTTPClientContext(ctx context.Context, method string, url string, headers map[string]string, body any) (request *http.Request,
+	response *http.Response, err error) {
+	bodyAsBytes, contentType, err := bodyToBytes(body)
 	if err != nil {
 		return nil, nil, err
 	}
+
+	client := &http.Client{}
+	for tryCount := 0; ; tryCount++ {
+		request, err = newRequest(ctx, method, url, headers, bodyAsBytes, contentType)
+		if err != nil {
+			return nil, nil, err
+		}
+		response, err = client.Do(request)
+		if err == nil && !isRetriedStatusCode(response.StatusCode) {
+			return request, response, nil
+		}
+		if tryCount >= HTTPClientMaxRetries || !isIdempotentMethod(method) || ctx.Err() != nil {
+			return request, response, err
+		}
+		cause := err
+		if cause == nil {
+			cause = fmt.Errorf("HTTP_STATUS_%d", response.StatusCode)
+		}
+		if response != nil {
+			_ = response.Body.Close()
+		}
+		errBudget := retry.TryConsume(ctx, cause)
+		if errBudget != nil {
+			return nil, nil, errBudget
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(HTTPClientRetryDelay * time.Duration(tryCount+1)):
+		}
+	}
+}
+
+func isRetriedStatusCode(statusCode int) bool {
+	return statusCode == http.StatusBadGateway || statusCode == http.StatusServiceUnavailable || statusCode == http.StatusGatewayTimeout
+}
+
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func readAll(request *http.Request, resp *http.Response) (*http.Request, *HTTPResponse, error) {
 	defer func() {
 		err2 := resp.Body.Close()
 		if err2 != nil {
@@ -96,10 +169,48 @@ func HTTPClientReadAll(method string, url string, headers map[string]string, bod
 		return nil, nil, err
 	}
 
-	response = &HTTPResponse{
+	response := &HTTPResponse{
 		StatusCode: resp.StatusCode,
 		Body:       responseBodyAsBytes,
 		Headers:    resp.Header,
 	}
 	return request, response, nil
 }
+
+func HTTPClientReadAll(method string, url string, headers map[string]string, body any) (request *http.Request, response *HTTPResponse, err error) {
+	request, resp, err := HTTPClient(method, url, headers, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return readAll(request, resp)
+}
+
+// HTTPClientReadAllContext is HTTPClientReadAll retrying like HTTPClientContext
+func HTTPClientReadAllContext(ctx context.Context, method string, url string, headers map[string]string, body any) (request *http.Request,
+	response *HTTPResponse, err error) {
+	request, resp, err := HTTPClientContext(ctx, method, url, headers, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return readAll(request, resp)
+}
+
+// HTTPClientReadAllSigned is HTTPClientReadAll with the body signed for api.NewHMACVerifyMiddleware: the signatureHeaderName
+// header holds keyId, the current time and the HMAC of the body keyed by secret
+func HTTPClientReadAllSigned(method string, url string, headers map[string]string, body any, signatureHeaderName string, keyId string,
+	secret string) (request *http.Request, response *HTTPResponse, err error) {
+	bodyAsBytes, contentType, err := bodyToBytes(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	signedHeaders := map[string]string{}
+	if contentType != `` {
+		signedHeaders["Content-Type"] = contentType
+	}
+	for key, value := range headers {
+		signedHeaders[key] = value
+	}
+	ts := time.Now()
+	signedHeaders[signatureHeaderName] = security.FormatSignatureHeader(keyId, ts, security.SignPayload([]byte(secret), bodyAsBytes, ts))
+	return HTTPClientReadAll(method, url, signedHeaders, bodyAsBytes)
+}
@@ -5,10 +5,10 @@ import (
 	"fmt"
 	"github.com/donnyhardyanto/dxlib/utils"
 	"io"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 )
 
 type Number interface {
@@ -80,137 +80,206 @@ func anyMerge(newerValue, olderValue any) any {
 	return newerValue
 }
 
+func keyNotFoundError(k string, expected any) error {
+	return fmt.Errorf("JSON_KEY_NOT_FOUND:%s:expected %T", k, expected)
+}
+
+func keyTypeMismatchError(k string, expected any, actual any) error {
+	return fmt.Errorf("JSON_KEY_TYPE_MISMATCH:%s:expected %T, got %T", k, expected, actual)
+}
+
 func GetBool(kv utils.JSON, k string) (v bool, err error) {
-	var z bool
-	switch kv[k].(type) {
-	case bool:
-		z = kv[k].(bool)
-	default:
-		var ok bool
-		z, ok = kv[k].(bool)
-		if !ok {
-			return false, fmt.Errorf("can not get %s as %T from %v", k, v, kv)
-		}
+	a, ok := kv[k]
+	if !ok {
+		return false, keyNotFoundError(k, v)
 	}
-	return z, nil
+	v, ok = a.(bool)
+	if !ok {
+		return false, keyTypeMismatchError(k, v, a)
+	}
+	return v, nil
 }
 
 func GetString(kv utils.JSON, k string) (v string, err error) {
-	var z string
-	switch kv[k].(type) {
+	a, ok := kv[k]
+	if !ok {
+		return "", keyNotFoundError(k, v)
+	}
+	switch t := a.(type) {
+	case string:
+		return t, nil
 	case []uint8:
-		z = string(kv[k].([]uint8))
-	default:
-		var ok bool
-		z, ok = kv[k].(string)
-		if !ok {
-			return "", fmt.Errorf("can not get %s as %T from %v", k, v, kv)
-		}
+		return string(t), nil
 	}
-	return z, nil
+	return "", keyTypeMismatchError(k, v, a)
 }
 
-func GetNumber[A Number](kv utils.JSON, k string) (v A, err error) {
+func isIntegerNumber[A Number]() bool {
+	one := A(1)
+	return one/(one+one) == 0
+}
+
+// numberFromValue converts a to A, accepting every integer and float type. A float with a fractional part is rejected for an
+// integer A, and a value out of the range of A is rejected for every A.
+func numberFromValue[A Number](k string, a any) (v A, err error) {
 	var z float64
-	switch kv[k].(type) {
+	switch t := a.(type) {
 	case A:
-		return kv[k].(A), nil
+		return t, nil
+	case int:
+		z = float64(t)
+	case int8:
+		z = float64(t)
+	case int16:
+		z = float64(t)
+	case int32:
+		z = float64(t)
+	case int64:
+		v = A(t)
+		if int64(v) != t {
+			return 0, fmt.Errorf("JSON_KEY_OUT_OF_RANGE:%s:%d does not fit %T", k, t, v)
+		}
+		return v, nil
+	case float32:
+		z = float64(t)
+	case float64:
+		z = t
+	case json.Number:
+		z, err = t.Float64()
+		if err != nil {
+			return 0, keyTypeMismatchError(k, v, a)
+		}
 	case []uint8:
-		s := string(kv[k].([]uint8))
-		z, err = strconv.ParseFloat(s, 64)
+		z, err = strconv.ParseFloat(string(t), 64)
 		if err != nil {
-			return 0, err
+			return 0, keyTypeMismatchError(k, v, a)
 		}
 	default:
-		var ok bool
-		z, ok = kv[k].(float64)
-		if !ok {
-			return 0, fmt.Errorf("can not get %s as %T from %v", k, v, kv)
-		}
+		return 0, keyTypeMismatchError(k, v, a)
+	}
+	if isIntegerNumber[A]() && z != math.Trunc(z) {
+		return 0, fmt.Errorf("JSON_KEY_TYPE_MISMATCH:%s:expected %T, got %T with a fractional part (%v)", k, v, a, z)
 	}
-	y := A(z)
-	return y, nil
+	v = A(z)
+	if float64(v) != z && isIntegerNumber[A]() {
+		return 0, fmt.Errorf("JSON_KEY_OUT_OF_RANGE:%s:%v does not fit %T", k, z, v)
+	}
+	return v, nil
 }
 
-func GetNumberWithDefault[A Number](kv utils.JSON, k string, defaultValue A) (v A) {
-	z, ok := kv[k].(float64)
+func GetNumber[A Number](kv utils.JSON, k string) (v A, err error) {
+	a, ok := kv[k]
 	if !ok {
-		return defaultValue
+		return 0, keyNotFoundError(k, v)
 	}
-	y := A(z)
-	return y
+	return numberFromValue[A](k, a)
 }
 
-func GetInt64(kv utils.JSON, k string) (v int64, err error) {
-	var a int64
-	a, err = GetNumber[int64](kv, k)
+// GetNumberWithDefault returns defaultValue when k is missing and also when it has the wrong type, use GetNumberOrDefault to
+// get the type mismatch reported
+func GetNumberWithDefault[A Number](kv utils.JSON, k string, defaultValue A) (v A) {
+	v, err := GetNumberOrDefault(kv, k, defaultValue)
 	if err != nil {
-		return 0, err
+		return defaultValue
 	}
-	return a, err
+	return v
 }
 
-func MustGetInt64(kv utils.JSON, k string) (v int64) {
-	a, err := GetInt64(kv, k)
-	if err != nil {
-		panic(err)
+// GetNumberOrDefault returns defaultValue when k is missing or null, and an error when it holds anything but a number fitting A
+func GetNumberOrDefault[A Number](kv utils.JSON, k string, defaultValue A) (v A, err error) {
+	a, ok := kv[k]
+	if !ok || a == nil {
+		return defaultValue, nil
 	}
-	return a
+	return numberFromValue[A](k, a)
+}
+
+func GetInt64(kv utils.JSON, k string) (v int64, err error) {
+	return GetNumber[int64](kv, k)
 }
 
 func GetInt64WithDefault(kv utils.JSON, k string, defaultValue int64) (v int64, err error) {
-	var a int64
-	a = GetNumberWithDefault(kv, k, defaultValue)
-	return a, err
+	return GetNumberOrDefault(kv, k, defaultValue)
 }
 
 func GetInt(kv utils.JSON, k string) (v int, err error) {
-	a, err := GetNumber[int](kv, k)
-	if err != nil {
-		return 0, err
-	}
-	return a, err
+	return GetNumber[int](kv, k)
 }
 
 func GetFloat32(kv utils.JSON, k string) (v float32, err error) {
-	a, err := GetNumber[float32](kv, k)
-	if err != nil {
-		return 0, err
-	}
-	return a, err
+	return GetNumber[float32](kv, k)
 }
 
 func GetFloat64(kv utils.JSON, k string) (v float64, err error) {
-	a, err := GetNumber[float64](kv, k)
-	if err != nil {
-		return 0, err
-	}
-	return a, err
+	return GetNumber[float64](kv, k)
 }
 
 func GetIntWithDefault(kv utils.JSON, k string, defaultValue int) (v int, err error) {
-	a := GetNumberWithDefault(kv, k, defaultValue)
-	return a, err
+	return GetNumberOrDefault(kv, k, defaultValue)
 }
 
-func GetTime(kv utils.JSON, k string) (v time.Time, err error) {
-	var z time.Time
-	switch kv[k].(type) {
-	case time.Time:
-		z = kv[k].(time.Time)
-	case string:
-		z, err = time.Parse(time.RFC3339, kv[k].(string))
-		if err != nil {
-			return time.Time{}, err
-		}
-	default:
-		var ok bool
-		z, ok = kv[k].(time.Time)
-		if !ok {
-			return time.Time{}, fmt.Errorf("can not get %s as %T from %v", k, v, kv)
+func GetJSON(kv utils.JSON, k string) (v utils.JSON, err error) {
+	a, ok := kv[k]
+	if !ok {
+		return nil, keyNotFoundError(k, v)
+	}
+	v, ok = a.(utils.JSON)
+	if !ok {
+		return nil, keyTypeMismatchError(k, v, a)
+	}
+	return v, nil
+}
+
+// GetArray returns the array at k, an array of objects is returned as []any too
+func GetArray(kv utils.JSON, k string) (v []any, err error) {
+	a, ok := kv[k]
+	if !ok {
+		return nil, keyNotFoundError(k, v)
+	}
+	switch t := a.(type) {
+	case []any:
+		return t, nil
+	case []utils.JSON:
+		v = make([]any, len(t))
+		for i, item := range t {
+			v[i] = item
 		}
+		return v, nil
 	}
-	return z, nil
+	return nil, keyTypeMismatchError(k, v, a)
+}
+
+// mustGet panics with the error of a getter, for the keys a caller has already validated. Logging it is left to the caller
+// recovering the panic, utils/json does not depend on the log.
+func mustGet[A any](v A, err error) A {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func MustGetInt64(kv utils.JSON, k string) (v int64) {
+	return mustGet(GetInt64(kv, k))
+}
+
+func MustGetString(kv utils.JSON, k string) (v string) {
+	return mustGet(GetString(kv, k))
+}
+
+func MustGetBool(kv utils.JSON, k string) (v bool) {
+	return mustGet(GetBool(kv, k))
+}
+
+func MustGetFloat64(kv utils.JSON, k string) (v float64) {
+	return mustGet(GetFloat64(kv, k))
+}
+
+func MustGetJSON(kv utils.JSON, k string) (v utils.JSON) {
+	return mustGet(GetJSON(kv, k))
+}
+
+func MustGetArray(kv utils.JSON, k string) (v []any) {
+	return mustGet(GetArray(kv, k))
 }
 
 func ReplaceMergeMap(m1 utils.JSON, m2 utils.JSON) utils.JSON {
@@ -300,3 +369,15 @@ func getValueByFieldPathMap(dataPath utils.JSON, data utils.JSON) (r any, err er
 	}
 	return d, nil
 }
+
+// Has tells whether k is present in kv, even with a null value
+func Has(kv utils.JSON, k string) bool {
+	_, ok := kv[k]
+	return ok
+}
+
+// IsNull tells whether k is present in kv with a null value, unlike kv[k] == nil which is also true for a missing k
+func IsNull(kv utils.JSON, k string) bool {
+	v, ok := kv[k]
+	return ok && v == nil
+}
@@ -0,0 +1,197 @@
+package json
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// Canonical returns j serialized in the JSON Canonicalization Scheme (RFC 8785): object keys sorted by their UTF-16 code
+// units, no whitespace, numbers formatted like ECMAScript does and strings escaped minimally. Equal documents give equal bytes
+// whatever the order of their keys, so the result can be hashed or signed.
+func Canonical(j utils.JSON) (r []byte, err error) {
+	b := &bytes.Buffer{}
+	err = writeCanonical(b, j)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Hash returns the hex encoded SHA-256 of the canonical form of j
+func Hash(j utils.JSON) (r string, err error) {
+	b, err := Canonical(j)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func writeCanonical(b *bytes.Buffer, v any) (err error) {
+	switch t := v.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(t))
+	case string:
+		writeCanonicalString(b, t)
+	case float64:
+		return writeCanonicalNumber(b, t)
+	case float32:
+		return writeCanonicalNumber(b, float64(t))
+	case int:
+		b.WriteString(strconv.FormatInt(int64(t), 10))
+	case int8:
+		b.WriteString(strconv.FormatInt(int64(t), 10))
+	case int16:
+		b.WriteString(strconv.FormatInt(int64(t), 10))
+	case int32:
+		b.WriteString(strconv.FormatInt(int64(t), 10))
+	case int64:
+		b.WriteString(strconv.FormatInt(t, 10))
+	case uint:
+		b.WriteString(strconv.FormatUint(uint64(t), 10))
+	case uint8:
+		b.WriteString(strconv.FormatUint(uint64(t), 10))
+	case uint16:
+		b.WriteString(strconv.FormatUint(uint64(t), 10))
+	case uint32:
+		b.WriteString(strconv.FormatUint(uint64(t), 10))
+	case uint64:
+		b.WriteString(strconv.FormatUint(t, 10))
+	case json.Number:
+		f, errParse := t.Float64()
+		if errParse != nil {
+			return fmt.Errorf("JSON_CANONICAL_INVALID_NUMBER:%s", t.String())
+		}
+		return writeCanonicalNumber(b, f)
+	case utils.JSON:
+		return writeCanonicalObject(b, t)
+	case []any:
+		b.WriteByte('[')
+		for i, item := range t {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			err = writeCanonical(b, item)
+			if err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	default:
+		// Structs, typed slices and maps, time.Time... are reduced to plain JSON values first
+		encoded, errMarshal := json.Marshal(t)
+		if errMarshal != nil {
+			return fmt.Errorf("JSON_CANONICAL_UNSUPPORTED_VALUE:%T:%w", t, errMarshal)
+		}
+		var decoded any
+		decoder := json.NewDecoder(bytes.NewReader(encoded))
+		decoder.UseNumber()
+		errDecode := decoder.Decode(&decoded)
+		if errDecode != nil {
+			return fmt.Errorf("JSON_CANONICAL_UNSUPPORTED_VALUE:%T:%w", t, errDecode)
+		}
+		return writeCanonical(b, decoded)
+	}
+	return nil
+}
+
+func writeCanonicalObject(b *bytes.Buffer, m utils.JSON) (err error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return isLessUTF16(keys[i], keys[j])
+	})
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		writeCanonicalString(b, k)
+		b.WriteByte(':')
+		err = writeCanonical(b, m[k])
+		if err != nil {
+			return err
+		}
+	}
+	b.WriteByte('}')
+	return nil
+}
+
+func isLessUTF16(a, b string) bool {
+	ua := utf16.Encode([]rune(a))
+	ub := utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+func writeCanonicalString(b *bytes.Buffer, s string) {
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				_, _ = fmt.Fprintf(b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
+
+// writeCanonicalNumber follows the ECMAScript Number.prototype.toString formatting required by RFC 8785
+func writeCanonicalNumber(b *bytes.Buffer, f float64) (err error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("JSON_CANONICAL_INVALID_NUMBER:%v", f)
+	}
+	if f == 0 {
+		b.WriteByte('0')
+		return nil
+	}
+	abs := math.Abs(f)
+	if abs >= 1e21 || abs < 1e-6 {
+		s := strconv.FormatFloat(f, 'e', -1, 64)
+		mantissa, exponent, _ := strings.Cut(s, "e")
+		sign := exponent[0]
+		exponent = strings.TrimLeft(exponent[1:], "0")
+		b.WriteString(mantissa)
+		b.WriteByte('e')
+		b.WriteByte(sign)
+		b.WriteString(exponent)
+		return nil
+	}
+	b.WriteString(strconv.FormatFloat(f, 'f', -1, 64))
+	return nil
+}
@@ -0,0 +1,137 @@
+package json
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+func mustParseJSON(t *testing.T, s string) utils.JSON {
+	t.Helper()
+	v, ok := mustParse(t, s).(utils.JSON)
+	if !ok {
+		t.Fatalf("%s is not an object", s)
+	}
+	return v
+}
+
+func TestHashIgnoresTheOrderOfTheKeys(t *testing.T) {
+	a := mustParseJSON(t, `{"id":1,"name":"a","tags":["x","y"],"address":{"city":"b","zip":"1","geo":{"lat":1.5,"lng":-2}}}`)
+	b := mustParseJSON(t, `{"address":{"geo":{"lng":-2,"lat":1.5},"zip":"1","city":"b"},"tags":["x","y"],"name":"a","id":1}`)
+	hashA, err := Hash(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashB, err := Hash(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashA != hashB {
+		t.Fatalf("%s != %s", hashA, hashB)
+	}
+	// The order of the items of an array is part of the document
+	c := mustParseJSON(t, `{"id":1,"name":"a","tags":["y","x"],"address":{"city":"b","zip":"1","geo":{"lat":1.5,"lng":-2}}}`)
+	hashC, _ := Hash(c)
+	if hashC == hashA {
+		t.Fatal("documents with reordered arrays have the same hash")
+	}
+	// Go numbers of any type are the same JSON number
+	hashD, _ := Hash(utils.JSON{"id": int64(1), "name": "a", "tags": []any{"x", "y"}, "address": utils.JSON{"city": "b", "zip": "1", "geo": utils.JSON{"lat": float32(1.5), "lng": -2}}})
+	if hashD != hashA {
+		t.Fatal("typed numbers change the hash")
+	}
+}
+
+// The numbers of RFC 8785 Appendix B, given by their IEEE 754 bits
+func TestCanonicalNumbersRFC8785(t *testing.T) {
+	for _, tc := range []struct {
+		bits uint64
+		want string
+	}{
+		{0x0000000000000000, "0"},
+		{0x8000000000000000, "0"},
+		{0x0000000000000001, "5e-324"},
+		{0x8000000000000001, "-5e-324"},
+		{0x7fefffffffffffff, "1.7976931348623157e+308"},
+		{0xffefffffffffffff, "-1.7976931348623157e+308"},
+		{0x4340000000000000, "9007199254740992"},
+		{0xc340000000000000, "-9007199254740992"},
+		{0x4430000000000000, "295147905179352830000"},
+		{0x44b52d02c7e14af5, "9.999999999999997e+22"},
+		{0x44b52d02c7e14af6, "1e+23"},
+		{0x44b52d02c7e14af7, "1.0000000000000001e+23"},
+		{0x444b1ae4d6e2ef4e, "999999999999999700000"},
+		{0x444b1ae4d6e2ef4f, "999999999999999900000"},
+		{0x444b1ae4d6e2ef50, "1e+21"},
+		{0x3eb0c6f7a0b5ed8c, "9.999999999999997e-7"},
+		{0x3eb0c6f7a0b5ed8d, "0.000001"},
+		{0x41b3de4355555553, "333333333.3333332"},
+		{0x41b3de4355555554, "333333333.33333325"},
+		{0x41b3de4355555555, "333333333.3333333"},
+		{0x41b3de4355555556, "333333333.3333334"},
+		{0x41b3de4355555557, "333333333.33333343"},
+		{0xbecbf647612f3696, "-0.0000033333333333333333"},
+		{0x43143ff3c1cb0959, "1424953923781206.2"},
+	} {
+		f := math.Float64frombits(tc.bits)
+		b := &bytes.Buffer{}
+		err := writeCanonicalNumber(b, f)
+		if err != nil || b.String() != tc.want {
+			t.Errorf("%016x: got %q, %v, want %q", tc.bits, b.String(), err, tc.want)
+		}
+	}
+	for _, bits := range []uint64{0x7fffffffffffffff, 0x7ff0000000000000, 0xfff0000000000000} {
+		err := writeCanonicalNumber(&bytes.Buffer{}, math.Float64frombits(bits))
+		if err == nil {
+			t.Errorf("%016x: NaN and infinities have no JSON form", bits)
+		}
+	}
+}
+
+func TestCanonicalRFC8785Examples(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name: "section 3.2.2",
+			input: `{
+  "numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+  "string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+  "literals": [null, true, false]
+}`,
+			want: `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		{
+			name: "section 3.2.3 sorting by UTF-16 code units",
+			input: `{
+  "\u20ac": "Euro Sign",
+  "\r": "Carriage Return",
+  "\ufb33": "Hebrew Letter Dalet With Dagesh",
+  "1": "One",
+  "\ud83d\ude00": "Emoji: Grinning Face",
+  "\u0080": "Control",
+  "\u00f6": "Latin Small Letter O With Diaeresis"
+}`,
+			want: "{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"\u00f6\":\"Latin Small Letter O With Diaeresis\",\"\u20ac\":\"Euro Sign\",\"\U0001f600\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		},
+		{
+			name:  "control characters",
+			input: `{"s":"\u0000\u0001\b\f\n\r\t\u001f <>&\u2028"}`,
+			want:  "{\"s\":\"\\u0000\\u0001\\b\\f\\n\\r\\t\\u001f <>&\u2028\"}",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Canonical(mustParseJSON(t, tc.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Fatalf("got  %s\nwant %s", got, tc.want)
+			}
+		})
+	}
+}
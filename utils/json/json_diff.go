@@ -0,0 +1,323 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+const (
+	DXJSONDiffRedactedValue        = "***"
+	DXJSONDiffTruncatedMarker      = "...(truncated)"
+	DXJSONDiffDefaultMaxValueBytes = 1024
+
+	DXJSONDiffKeyAdded    = "added"
+	DXJSONDiffKeyRemoved  = "removed"
+	DXJSONDiffKeyModified = "modified"
+)
+
+var DXJSONDiffDefaultRedactKeys = []string{"password", "token", "secret"}
+
+type DXJSONDiffOptions struct {
+	// ArrayKeyField matches the items of two arrays of objects by this field instead of by their index, the path of an item is
+	// then written as items[id=5]
+	ArrayKeyField string
+	// MaxValueBytes truncates the values longer than it once encoded as JSON, zero means DXJSONDiffDefaultMaxValueBytes
+	MaxValueBytes int
+	// RedactKeys are the key names (case-insensitive, substring) whose values are written as DXJSONDiffRedactedValue, nil means
+	// DXJSONDiffDefaultRedactKeys
+	RedactKeys []string
+}
+
+type jsonDiff struct {
+	opts     DXJSONDiffOptions
+	added    []any
+	removed  []any
+	modified []any
+}
+
+// Diff returns the changes from before to after as {"added": [{"path", "new"}], "removed": [{"path", "old"}], "modified":
+// [{"path", "old", "new"}]}, with the paths in the syntax of GetByPath. The result is plain utils.JSON, ready to be stored in
+// an audit table.
+func Diff(before, after utils.JSON, opts ...DXJSONDiffOptions) utils.JSON {
+	d := &jsonDiff{}
+	if len(opts) > 0 {
+		d.opts = opts[0]
+	}
+	if d.opts.MaxValueBytes <= 0 {
+		d.opts.MaxValueBytes = DXJSONDiffDefaultMaxValueBytes
+	}
+	if d.opts.RedactKeys == nil {
+		d.opts.RedactKeys = DXJSONDiffDefaultRedactKeys
+	}
+	if before == nil {
+		before = utils.JSON{}
+	}
+	if after == nil {
+		after = utils.JSON{}
+	}
+	d.diffObject("", before, after)
+	return utils.JSON{
+		DXJSONDiffKeyAdded:    nonNilList(d.added),
+		DXJSONDiffKeyRemoved:  nonNilList(d.removed),
+		DXJSONDiffKeyModified: nonNilList(d.modified),
+	}
+}
+
+// IsDiffEmpty tells whether a result of Diff has no change, so no audit record has to be written
+func IsDiffEmpty(diff utils.JSON) bool {
+	for _, k := range []string{DXJSONDiffKeyAdded, DXJSONDiffKeyRemoved, DXJSONDiffKeyModified} {
+		list, _ := diff[k].([]any)
+		if len(list) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func nonNilList(list []any) []any {
+	if list == nil {
+		return []any{}
+	}
+	return list
+}
+
+func (d *jsonDiff) isRedacted(k string) bool {
+	lk := strings.ToLower(k)
+	for _, redactKey := range d.opts.RedactKeys {
+		if strings.Contains(lk, strings.ToLower(redactKey)) {
+			return true
+		}
+	}
+	return false
+}
+
+// render redacts and truncates v for the change set
+func (d *jsonDiff) render(v any, isRedacted bool) any {
+	if isRedacted {
+		return DXJSONDiffRedactedValue
+	}
+	if s, ok := v.(string); ok {
+		if len(s) <= d.opts.MaxValueBytes {
+			return s
+		}
+		return truncateUTF8(s, d.opts.MaxValueBytes) + DXJSONDiffTruncatedMarker
+	}
+	v = d.redactNested(v)
+	b, err := json.Marshal(v)
+	if err != nil || len(b) <= d.opts.MaxValueBytes {
+		return v
+	}
+	return truncateUTF8(string(b), d.opts.MaxValueBytes) + DXJSONDiffTruncatedMarker
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func (d *jsonDiff) redactNested(v any) any {
+	switch t := v.(type) {
+	case utils.JSON:
+		r := make(utils.JSON, len(t))
+		for k, item := range t {
+			if d.isRedacted(k) {
+				r[k] = DXJSONDiffRedactedValue
+				continue
+			}
+			r[k] = d.redactNested(item)
+		}
+		return r
+	case []any:
+		r := make([]any, len(t))
+		for i, item := range t {
+			r[i] = d.redactNested(item)
+		}
+		return r
+	case []utils.JSON:
+		r := make([]any, len(t))
+		for i, item := range t {
+			r[i] = d.redactNested(item)
+		}
+		return r
+	}
+	return v
+}
+
+func (d *jsonDiff) add(path string, v any, isRedacted bool) {
+	d.added = append(d.added, utils.JSON{"path": path, "new": d.render(v, isRedacted)})
+}
+
+func (d *jsonDiff) remove(path string, v any, isRedacted bool) {
+	d.removed = append(d.removed, utils.JSON{"path": path, "old": d.render(v, isRedacted)})
+}
+
+func (d *jsonDiff) modify(path string, before any, after any, isRedacted bool) {
+	d.modified = append(d.modified, utils.JSON{"path": path, "old": d.render(before, isRedacted), "new": d.render(after, isRedacted)})
+}
+
+func (d *jsonDiff) diffObject(path string, before, after utils.JSON) {
+	keys := make([]string, 0, len(before)+len(after))
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		childPath := pathJoin(path, k)
+		isRedacted := d.isRedacted(k)
+		b, isInBefore := before[k]
+		a, isInAfter := after[k]
+		switch {
+		case !isInAfter:
+			d.remove(childPath, b, isRedacted)
+		case !isInBefore:
+			d.add(childPath, a, isRedacted)
+		case isRedacted:
+			if !isEqualValue(b, a) {
+				d.modify(childPath, b, a, true)
+			}
+		default:
+			d.diffValue(childPath, b, a)
+		}
+	}
+}
+
+func (d *jsonDiff) diffValue(path string, before, after any) {
+	bm, isBeforeObject := before.(utils.JSON)
+	am, isAfterObject := after.(utils.JSON)
+	if isBeforeObject && isAfterObject {
+		d.diffObject(path, bm, am)
+		return
+	}
+	ba, isBeforeArray := asArray(before)
+	aa, isAfterArray := asArray(after)
+	if isBeforeArray && isAfterArray {
+		if d.opts.ArrayKeyField != "" && d.diffArrayByKey(path, ba, aa) {
+			return
+		}
+		d.diffArrayByIndex(path, ba, aa)
+		return
+	}
+	if !isEqualValue(before, after) {
+		d.modify(path, before, after, false)
+	}
+}
+
+func asArray(v any) (r []any, ok bool) {
+	switch t := v.(type) {
+	case []any:
+		return t, true
+	case []utils.JSON:
+		r = make([]any, len(t))
+		for i, item := range t {
+			r[i] = item
+		}
+		return r, true
+	}
+	return nil, false
+}
+
+func (d *jsonDiff) diffArrayByIndex(path string, before, after []any) {
+	for i := 0; i < len(before) || i < len(after); i++ {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case i >= len(after):
+			d.remove(itemPath, before[i], false)
+		case i >= len(before):
+			d.add(itemPath, after[i], false)
+		default:
+			d.diffValue(itemPath, before[i], after[i])
+		}
+	}
+}
+
+// keyedItems indexes the items by ArrayKeyField, ok is false when an item is not an object with a unique key
+func (d *jsonDiff) keyedItems(items []any) (keys []string, byKey map[string]any, ok bool) {
+	byKey = make(map[string]any, len(items))
+	for _, item := range items {
+		m, isObject := item.(utils.JSON)
+		if !isObject {
+			return nil, nil, false
+		}
+		id, isExist := m[d.opts.ArrayKeyField]
+		if !isExist {
+			return nil, nil, false
+		}
+		key := fmt.Sprintf("%v", id)
+		if _, isDuplicate := byKey[key]; isDuplicate {
+			return nil, nil, false
+		}
+		keys = append(keys, key)
+		byKey[key] = item
+	}
+	return keys, byKey, true
+}
+
+// diffArrayByKey matches the items by ArrayKeyField, it returns false and records nothing when an array is not keyed
+func (d *jsonDiff) diffArrayByKey(path string, before, after []any) bool {
+	beforeKeys, beforeByKey, ok := d.keyedItems(before)
+	if !ok {
+		return false
+	}
+	afterKeys, afterByKey, ok := d.keyedItems(after)
+	if !ok {
+		return false
+	}
+	for _, key := range beforeKeys {
+		itemPath := fmt.Sprintf("%s[%s=%s]", path, d.opts.ArrayKeyField, key)
+		a, isInAfter := afterByKey[key]
+		if !isInAfter {
+			d.remove(itemPath, beforeByKey[key], false)
+			continue
+		}
+		d.diffValue(itemPath, beforeByKey[key], a)
+	}
+	for _, key := range afterKeys {
+		if _, isInBefore := beforeByKey[key]; !isInBefore {
+			d.add(fmt.Sprintf("%s[%s=%s]", path, d.opts.ArrayKeyField, key), afterByKey[key], false)
+		}
+	}
+	return true
+}
+
+// isEqualValue compares the numbers by value, so 1 and 1.0 decoded by different paths are equal
+func isEqualValue(a, b any) bool {
+	af, isANumber := toComparableNumber(a)
+	bf, isBNumber := toComparableNumber(b)
+	if isANumber && isBNumber {
+		return af == bf
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toComparableNumber(v any) (f float64, ok bool) {
+	switch t := v.(type) {
+	case int:
+		return float64(t), true
+	case int32:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case float32:
+		return float64(t), true
+	case float64:
+		return t, true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,118 @@
+package json
+
+import (
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+type DXJSONMergeArrayStrategy int
+
+const (
+	// DXJSONMergeArrayReplace takes the array of the overlay as a whole
+	DXJSONMergeArrayReplace DXJSONMergeArrayStrategy = iota
+	// DXJSONMergeArrayConcat appends the items of the overlay array to the items of the base array
+	DXJSONMergeArrayConcat
+)
+
+type DXJSONMergeOptions struct {
+	ArrayStrategy DXJSONMergeArrayStrategy
+}
+
+// copyValue deep copies the objects and arrays of v, the other values are shared
+func copyValue(v any) any {
+	switch t := v.(type) {
+	case utils.JSON:
+		r := make(utils.JSON, len(t))
+		for k, item := range t {
+			r[k] = copyValue(item)
+		}
+		return r
+	case []any:
+		r := make([]any, len(t))
+		for i, item := range t {
+			r[i] = copyValue(item)
+		}
+		return r
+	case []utils.JSON:
+		r := make([]utils.JSON, len(t))
+		for i, item := range t {
+			r[i] = copyValue(item).(utils.JSON)
+		}
+		return r
+	}
+	return v
+}
+
+// DeepMergeWithOptions returns a copy of base with overlay merged in, overlay winning on the keys present in both unless both
+// values are objects, which are merged recursively. Neither base nor overlay is modified, unlike DeepMerge.
+func DeepMergeWithOptions(base, overlay utils.JSON, opts DXJSONMergeOptions) utils.JSON {
+	r := copyValue(base)
+	if r == nil {
+		r = utils.JSON{}
+	}
+	return mergeValue(r.(utils.JSON), overlay, opts).(utils.JSON)
+}
+
+// mergeValue merges overlay into base, which is already a copy owned by the caller
+func mergeValue(base any, overlay any, opts DXJSONMergeOptions) any {
+	switch o := overlay.(type) {
+	case utils.JSON:
+		b, ok := base.(utils.JSON)
+		if !ok {
+			return copyValue(o)
+		}
+		for k, v := range o {
+			existing, isExist := b[k]
+			if !isExist {
+				b[k] = copyValue(v)
+				continue
+			}
+			b[k] = mergeValue(existing, v, opts)
+		}
+		return b
+	case []any:
+		if opts.ArrayStrategy == DXJSONMergeArrayConcat {
+			b, ok := base.([]any)
+			if ok {
+				return append(b, copyValue(o).([]any)...)
+			}
+		}
+	case []utils.JSON:
+		if opts.ArrayStrategy == DXJSONMergeArrayConcat {
+			b, ok := base.([]utils.JSON)
+			if ok {
+				return append(b, copyValue(o).([]utils.JSON)...)
+			}
+		}
+	}
+	return copyValue(overlay)
+}
+
+// ApplyMergePatch returns doc with patch applied as a JSON Merge Patch (RFC 7396): objects are merged recursively, a null
+// removes the key and any other value, arrays included, replaces the target. Neither doc nor patch is modified.
+func ApplyMergePatch(doc, patch utils.JSON) utils.JSON {
+	r := copyValue(doc)
+	if r == nil {
+		r = utils.JSON{}
+	}
+	return mergePatchValue(r, patch).(utils.JSON)
+}
+
+// mergePatchValue applies patch to target, which is already a copy owned by the caller
+func mergePatchValue(target any, patch any) any {
+	p, ok := patch.(utils.JSON)
+	if !ok {
+		return copyValue(patch)
+	}
+	t, ok := target.(utils.JSON)
+	if !ok {
+		t = utils.JSON{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatchValue(t[k], v)
+	}
+	return t
+}
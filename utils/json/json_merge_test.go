@@ -0,0 +1,79 @@
+package json
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+func mustParse(t *testing.T, s string) (v any) {
+	t.Helper()
+	err := json.Unmarshal([]byte(s), &v)
+	if err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return v
+}
+
+// The examples of RFC 7396 Appendix A, the targets and patches that are not objects go through mergePatchValue
+func TestMergePatchRFC7396Examples(t *testing.T) {
+	for _, tc := range []struct {
+		original string
+		patch    string
+		result   string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	} {
+		t.Run(tc.original+" "+tc.patch, func(t *testing.T) {
+			original := mustParse(t, tc.original)
+			patch := mustParse(t, tc.patch)
+			want := mustParse(t, tc.result)
+			var got any
+			originalAsJSON, isOriginalObject := original.(utils.JSON)
+			patchAsJSON, isPatchObject := patch.(utils.JSON)
+			if isOriginalObject && isPatchObject {
+				got = ApplyMergePatch(originalAsJSON, patchAsJSON)
+			} else {
+				got = mergePatchValue(copyValue(original), patch)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+			if !reflect.DeepEqual(original, mustParse(t, tc.original)) || !reflect.DeepEqual(patch, mustParse(t, tc.patch)) {
+				t.Fatal("the original or the patch was modified")
+			}
+		})
+	}
+}
+
+func TestApplyMergePatchOfNilDocument(t *testing.T) {
+	got := ApplyMergePatch(nil, utils.JSON{"a": 1, "b": nil})
+	if !reflect.DeepEqual(got, utils.JSON{"a": 1}) {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestApplyMergePatchResultSharesNothingWithThePatch(t *testing.T) {
+	patch := utils.JSON{"a": utils.JSON{"b": []any{"c"}}}
+	got := ApplyMergePatch(utils.JSON{}, patch)
+	got["a"].(utils.JSON)["b"].([]any)[0] = "changed"
+	if patch["a"].(utils.JSON)["b"].([]any)[0] != "c" {
+		t.Fatal("the result shares its arrays with the patch")
+	}
+}
@@ -0,0 +1,307 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// pathSegment is one step of a path, a key of an object or, when isIndex is set, an index of an array
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parsePath splits a path like "items[2].price" into its segments. A backslash escapes the next character, so
+// "labels.app\.kubernetes\.io/name" has the key "app.kubernetes.io/name" as its second segment.
+func parsePath(path string) (segments []pathSegment, err error) {
+	if path == "" {
+		return nil, fmt.Errorf("JSON_PATH_EMPTY")
+	}
+	var key strings.Builder
+	isKeyPending := true
+	flushKey := func(i int) error {
+		if !isKeyPending {
+			return nil
+		}
+		if key.Len() == 0 {
+			return fmt.Errorf("JSON_PATH_EMPTY_KEY:%s:%d", path, i)
+		}
+		segments = append(segments, pathSegment{key: key.String()})
+		key.Reset()
+		isKeyPending = false
+		return nil
+	}
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch c {
+		case '\\':
+			if i+1 >= len(path) {
+				return nil, fmt.Errorf("JSON_PATH_DANGLING_ESCAPE:%s", path)
+			}
+			i++
+			key.WriteByte(path[i])
+			isKeyPending = true
+		case '.':
+			err = flushKey(i)
+			if err != nil {
+				return nil, err
+			}
+			isKeyPending = true
+		case '[':
+			if isKeyPending && key.Len() > 0 {
+				err = flushKey(i)
+				if err != nil {
+					return nil, err
+				}
+			}
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSON_PATH_UNCLOSED_INDEX:%s:%d", path, i)
+			}
+			index, errParse := strconv.Atoi(path[i+1 : i+end])
+			if errParse != nil || index < 0 {
+				return nil, fmt.Errorf("JSON_PATH_INVALID_INDEX:%s:%s", path, path[i+1:i+end])
+			}
+			segments = append(segments, pathSegment{index: index, isIndex: true})
+			isKeyPending = false
+			i += end
+		default:
+			key.WriteByte(c)
+			isKeyPending = true
+		}
+	}
+	err = flushKey(len(path))
+	if err != nil {
+		return nil, err
+	}
+	return segments, nil
+}
+
+func (s pathSegment) String() string {
+	if s.isIndex {
+		return fmt.Sprintf("[%d]", s.index)
+	}
+	return s.key
+}
+
+// getSegment steps into v, ok is false when the key or index is absent or v is not a container of the right kind
+func getSegment(v any, s pathSegment) (r any, ok bool) {
+	if s.isIndex {
+		switch a := v.(type) {
+		case []any:
+			if s.index < len(a) {
+				return a[s.index], true
+			}
+		case []utils.JSON:
+			if s.index < len(a) {
+				return a[s.index], true
+			}
+		}
+		return nil, false
+	}
+	m, ok := v.(utils.JSON)
+	if !ok {
+		return nil, false
+	}
+	r, ok = m[s.key]
+	return r, ok
+}
+
+// GetByPath returns the value at path, ok is false when any segment of it is missing or the path is not valid
+func GetByPath(j utils.JSON, path string) (v any, ok bool) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, false
+	}
+	v = j
+	for _, s := range segments {
+		v, ok = getSegment(v, s)
+		if !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// GetStringByPath returns the string at path, ok is false when it is missing and err is set when it is present with another type
+func GetStringByPath(j utils.JSON, path string) (v string, ok bool, err error) {
+	r, ok := GetByPath(j, path)
+	if !ok {
+		return "", false, nil
+	}
+	switch t := r.(type) {
+	case string:
+		return t, true, nil
+	case []uint8:
+		return string(t), true, nil
+	}
+	return "", true, fmt.Errorf("JSON_PATH_TYPE_MISMATCH:%s:EXPECTED_STRING:%T", path, r)
+}
+
+// GetInt64ByPath returns the integer at path, a float with a fractional part or out of range is a type mismatch
+func GetInt64ByPath(j utils.JSON, path string) (v int64, ok bool, err error) {
+	r, ok := GetByPath(j, path)
+	if !ok {
+		return 0, false, nil
+	}
+	switch t := r.(type) {
+	case int:
+		return int64(t), true, nil
+	case int8:
+		return int64(t), true, nil
+	case int16:
+		return int64(t), true, nil
+	case int32:
+		return int64(t), true, nil
+	case int64:
+		return t, true, nil
+	case float32:
+		return floatToInt64(path, float64(t))
+	case float64:
+		return floatToInt64(path, t)
+	case json.Number:
+		v, err = t.Int64()
+		if err != nil {
+			return 0, true, fmt.Errorf("JSON_PATH_TYPE_MISMATCH:%s:EXPECTED_INTEGER:%s", path, t.String())
+		}
+		return v, true, nil
+	case []uint8:
+		v, err = strconv.ParseInt(string(t), 10, 64)
+		if err != nil {
+			return 0, true, fmt.Errorf("JSON_PATH_TYPE_MISMATCH:%s:EXPECTED_INTEGER:%s", path, string(t))
+		}
+		return v, true, nil
+	}
+	return 0, true, fmt.Errorf("JSON_PATH_TYPE_MISMATCH:%s:EXPECTED_INTEGER:%T", path, r)
+}
+
+func floatToInt64(path string, f float64) (v int64, ok bool, err error) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, true, fmt.Errorf("JSON_PATH_TYPE_MISMATCH:%s:EXPECTED_INTEGER:%v", path, f)
+	}
+	return int64(f), true, nil
+}
+
+func GetBoolByPath(j utils.JSON, path string) (v bool, ok bool, err error) {
+	r, ok := GetByPath(j, path)
+	if !ok {
+		return false, false, nil
+	}
+	v, isBool := r.(bool)
+	if !isBool {
+		return false, true, fmt.Errorf("JSON_PATH_TYPE_MISMATCH:%s:EXPECTED_BOOL:%T", path, r)
+	}
+	return v, true, nil
+}
+
+func GetJSONByPath(j utils.JSON, path string) (v utils.JSON, ok bool, err error) {
+	r, ok := GetByPath(j, path)
+	if !ok {
+		return nil, false, nil
+	}
+	v, isJSON := r.(utils.JSON)
+	if !isJSON {
+		return nil, true, fmt.Errorf("JSON_PATH_TYPE_MISMATCH:%s:EXPECTED_OBJECT:%T", path, r)
+	}
+	return v, true, nil
+}
+
+// SetByPath sets the value at path, creating the missing intermediate objects. An index must address an existing element of an
+// array, arrays are never grown.
+func SetByPath(j utils.JSON, path string, value any) (err error) {
+	if j == nil {
+		return fmt.Errorf("JSON_PATH_NIL_TARGET:%s", path)
+	}
+	segments, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	if segments[0].isIndex {
+		return fmt.Errorf("JSON_PATH_NOT_AN_ARRAY:%s:%s", path, segments[0])
+	}
+	_, err = setSegments(j, segments, value, path)
+	return err
+}
+
+// setSegments returns v with value set at segments, v is nil when the object has to be created
+func setSegments(v any, segments []pathSegment, value any, path string) (r any, err error) {
+	s := segments[0]
+	if s.isIndex {
+		a, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("JSON_PATH_NOT_AN_ARRAY:%s:%s", path, s)
+		}
+		if s.index >= len(a) {
+			return nil, fmt.Errorf("JSON_PATH_INDEX_OUT_OF_RANGE:%s:%s", path, s)
+		}
+		if len(segments) == 1 {
+			a[s.index] = value
+			return a, nil
+		}
+		a[s.index], err = setSegments(a[s.index], segments[1:], value, path)
+		return a, err
+	}
+	if v == nil {
+		v = utils.JSON{}
+	}
+	m, ok := v.(utils.JSON)
+	if !ok {
+		return nil, fmt.Errorf("JSON_PATH_NOT_AN_OBJECT:%s:%s", path, s)
+	}
+	if len(segments) == 1 {
+		m[s.key] = value
+		return m, nil
+	}
+	child, err := setSegments(m[s.key], segments[1:], value, path)
+	if err != nil {
+		return nil, err
+	}
+	m[s.key] = child
+	return m, nil
+}
+
+// DeleteByPath removes the key or the array element at path, ok is false when it was not there
+func DeleteByPath(j utils.JSON, path string) (ok bool) {
+	segments, err := parsePath(path)
+	if err != nil || segments[0].isIndex {
+		return false
+	}
+	_, ok = deleteSegments(j, segments)
+	return ok
+}
+
+// deleteSegments returns v without the value at segments
+func deleteSegments(v any, segments []pathSegment) (r any, ok bool) {
+	s := segments[0]
+	if s.isIndex {
+		a, isArray := v.([]any)
+		if !isArray || s.index >= len(a) {
+			return v, false
+		}
+		if len(segments) == 1 {
+			return append(a[:s.index:s.index], a[s.index+1:]...), true
+		}
+		a[s.index], ok = deleteSegments(a[s.index], segments[1:])
+		return a, ok
+	}
+	m, isObject := v.(utils.JSON)
+	if !isObject {
+		return v, false
+	}
+	child, isExist := m[s.key]
+	if !isExist {
+		return v, false
+	}
+	if len(segments) == 1 {
+		delete(m, s.key)
+		return m, true
+	}
+	m[s.key], ok = deleteSegments(child, segments[1:])
+	return m, ok
+}
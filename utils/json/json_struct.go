@@ -0,0 +1,325 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+type structField struct {
+	name       string
+	index      []int
+	isRequired bool
+}
+
+// structFields lists the fields of t by their json name, the fields of the embedded structs without a json name are promoted
+func structFields(t reflect.Type) (fields []structField) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for _, embedded := range structFields(f.Type) {
+				embedded.index = append([]int{i}, embedded.index...)
+				fields = append(fields, embedded)
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, structField{name: name, index: []int{i}, isRequired: f.Tag.Get("required") == "true"})
+	}
+	return fields
+}
+
+// ToStruct fills dest, a pointer to a struct, from j by the json tags of its fields. Numbers are converted like the API
+// parameters are: an integer field takes a float64 only when it has no fractional part, and a time.Time field takes an RFC3339
+// string. A field tagged `required:"true"` must be present and not null. The keys of j without a field are ignored.
+func ToStruct(j utils.JSON, dest any) (err error) {
+	return toStruct(j, dest, false)
+}
+
+// ToStructStrict is ToStruct that also fails on the keys of j, at any depth, without a field
+func ToStructStrict(j utils.JSON, dest any) (err error) {
+	return toStruct(j, dest, true)
+}
+
+func toStruct(j utils.JSON, dest any, isStrict bool) (err error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("JSON_TO_STRUCT_INVALID_DESTINATION:%T", dest)
+	}
+	return decodeValue("", j, v.Elem(), isStrict)
+}
+
+func pathJoin(path string, key string) string {
+	key = strings.ReplaceAll(key, `\`, `\\`)
+	key = strings.ReplaceAll(key, `.`, `\.`)
+	key = strings.ReplaceAll(key, `[`, `\[`)
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func decodeError(path string, format string, v ...any) error {
+	if path == "" {
+		path = "$"
+	}
+	return fmt.Errorf("JSON_TO_STRUCT_FAILED:%s:%s", path, fmt.Sprintf(format, v...))
+}
+
+func decodeValue(path string, src any, dst reflect.Value, isStrict bool) (err error) {
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if dst.Type() == timeType {
+		switch t := src.(type) {
+		case time.Time:
+			dst.Set(reflect.ValueOf(t))
+			return nil
+		case string:
+			tm, errParse := ParseTime(t)
+			if errParse != nil {
+				return decodeError(path, "expected an RFC3339 time, got %q", t)
+			}
+			dst.Set(reflect.ValueOf(tm))
+			return nil
+		}
+		return decodeError(path, "expected an RFC3339 time, got %T", src)
+	}
+	switch dst.Kind() {
+	case reflect.Pointer:
+		p := reflect.New(dst.Type().Elem())
+		err = decodeValue(path, src, p.Elem(), isStrict)
+		if err != nil {
+			return err
+		}
+		dst.Set(p)
+		return nil
+	case reflect.Interface:
+		sv := reflect.ValueOf(src)
+		if !sv.Type().AssignableTo(dst.Type()) {
+			return decodeError(path, "%T does not implement %s", src, dst.Type())
+		}
+		dst.Set(sv)
+		return nil
+	case reflect.Struct:
+		m, ok := src.(utils.JSON)
+		if !ok {
+			return decodeError(path, "expected an object, got %T", src)
+		}
+		return decodeStruct(path, m, dst, isStrict)
+	case reflect.Map:
+		m, ok := src.(utils.JSON)
+		if !ok {
+			return decodeError(path, "expected an object, got %T", src)
+		}
+		if dst.Type().Key().Kind() != reflect.String {
+			return decodeError(path, "map key type %s is not supported", dst.Type().Key())
+		}
+		r := reflect.MakeMapWithSize(dst.Type(), len(m))
+		for k, item := range m {
+			e := reflect.New(dst.Type().Elem()).Elem()
+			err = decodeValue(pathJoin(path, k), item, e, isStrict)
+			if err != nil {
+				return err
+			}
+			r.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), e)
+		}
+		dst.Set(r)
+		return nil
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 {
+			if s, ok := src.(string); ok {
+				dst.SetBytes([]byte(s))
+				return nil
+			}
+		}
+		sv := reflect.ValueOf(src)
+		if sv.Kind() != reflect.Slice {
+			return decodeError(path, "expected an array, got %T", src)
+		}
+		r := reflect.MakeSlice(dst.Type(), sv.Len(), sv.Len())
+		for i := 0; i < sv.Len(); i++ {
+			err = decodeValue(fmt.Sprintf("%s[%d]", path, i), sv.Index(i).Interface(), r.Index(i), isStrict)
+			if err != nil {
+				return err
+			}
+		}
+		dst.Set(r)
+		return nil
+	case reflect.String:
+		switch t := src.(type) {
+		case string:
+			dst.SetString(t)
+			return nil
+		case []uint8:
+			dst.SetString(string(t))
+			return nil
+		}
+		return decodeError(path, "expected a string, got %T", src)
+	case reflect.Bool:
+		b, ok := src.(bool)
+		if !ok {
+			return decodeError(path, "expected a bool, got %T", src)
+		}
+		dst.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := toInt64(path, src)
+		if err != nil {
+			return err
+		}
+		if dst.OverflowInt(i) {
+			return decodeError(path, "%d overflows %s", i, dst.Type())
+		}
+		dst.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := toInt64(path, src)
+		if err != nil {
+			return err
+		}
+		if i < 0 || dst.OverflowUint(uint64(i)) {
+			return decodeError(path, "%d overflows %s", i, dst.Type())
+		}
+		dst.SetUint(uint64(i))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat64(path, src)
+		if err != nil {
+			return err
+		}
+		if dst.OverflowFloat(f) {
+			return decodeError(path, "%v overflows %s", f, dst.Type())
+		}
+		dst.SetFloat(f)
+		return nil
+	}
+	return decodeError(path, "field type %s is not supported", dst.Type())
+}
+
+func decodeStruct(path string, m utils.JSON, dst reflect.Value, isStrict bool) (err error) {
+	fields := structFields(dst.Type())
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[f.name] = true
+		item, ok := m[f.name]
+		if !ok || item == nil {
+			if f.isRequired {
+				return decodeError(pathJoin(path, f.name), "required field is missing")
+			}
+			if !ok {
+				continue
+			}
+		}
+		err = decodeValue(pathJoin(path, f.name), item, dst.FieldByIndex(f.index), isStrict)
+		if err != nil {
+			return err
+		}
+	}
+	if isStrict {
+		for k := range m {
+			if !known[k] {
+				return decodeError(pathJoin(path, k), "unknown field")
+			}
+		}
+	}
+	return nil
+}
+
+func toInt64(path string, src any) (v int64, err error) {
+	switch t := src.(type) {
+	case int:
+		return int64(t), nil
+	case int8:
+		return int64(t), nil
+	case int16:
+		return int64(t), nil
+	case int32:
+		return int64(t), nil
+	case int64:
+		return t, nil
+	case uint8:
+		return int64(t), nil
+	case uint16:
+		return int64(t), nil
+	case uint32:
+		return int64(t), nil
+	case float32:
+		return floatAsInt64(path, float64(t))
+	case float64:
+		return floatAsInt64(path, t)
+	case json.Number:
+		v, err = t.Int64()
+		if err != nil {
+			return 0, decodeError(path, "expected an integer, got %s", t.String())
+		}
+		return v, nil
+	}
+	return 0, decodeError(path, "expected an integer, got %T", src)
+}
+
+func floatAsInt64(path string, f float64) (v int64, err error) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, decodeError(path, "expected an integer, got %v", f)
+	}
+	return int64(f), nil
+}
+
+func toFloat64(path string, src any) (v float64, err error) {
+	switch t := src.(type) {
+	case float64:
+		return t, nil
+	case float32:
+		return float64(t), nil
+	case json.Number:
+		v, err = t.Float64()
+		if err != nil {
+			return 0, decodeError(path, "expected a number, got %s", t.String())
+		}
+		return v, nil
+	case []uint8:
+		v, err = strconv.ParseFloat(string(t), 64)
+		if err != nil {
+			return 0, decodeError(path, "expected a number, got %s", string(t))
+		}
+		return v, nil
+	}
+	i, err := toInt64(path, src)
+	if err != nil {
+		return 0, decodeError(path, "expected a number, got %T", src)
+	}
+	return float64(i), nil
+}
+
+// FromStruct returns src, a struct or a pointer to one, as utils.JSON by the json tags of its fields, with the numbers as float64
+// like a decoded request body
+func FromStruct(src any) (r utils.JSON, err error) {
+	b, err := json.Marshal(src)
+	if err != nil {
+		return nil, fmt.Errorf("JSON_FROM_STRUCT_FAILED:%T:%w", src, err)
+	}
+	err = json.Unmarshal(b, &r)
+	if err != nil {
+		return nil, fmt.Errorf("JSON_FROM_STRUCT_NOT_AN_OBJECT:%T:%w", src, err)
+	}
+	return r, nil
+}
@@ -0,0 +1,72 @@
+package json
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+func TestGetInt64(t *testing.T) {
+	kv := utils.JSON{"float": float64(42), "int": 7, "int64": int64(-3), "fraction": 1.5, "string": "42", "huge": 1e20}
+	for _, tc := range []struct {
+		key   string
+		want  int64
+		error string
+	}{
+		{key: "float", want: 42},
+		{key: "int", want: 7},
+		{key: "int64", want: -3},
+		{key: "fraction", error: "fraction"},
+		{key: "string", error: "JSON_KEY_TYPE_MISMATCH:string:expected int64, got string"},
+		{key: "huge", error: "huge"},
+		{key: "missing", error: "JSON_KEY_NOT_FOUND:missing:expected int64"},
+	} {
+		t.Run(tc.key, func(t *testing.T) {
+			got, err := GetInt64(kv, tc.key)
+			if tc.error != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.error) {
+					t.Fatalf("got %d, %v, want an error with %q", got, err, tc.error)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Fatalf("got %d, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestMustGetPanicsWithTheErrorOfTheGetter(t *testing.T) {
+	kv := utils.JSON{"name": 42}
+	_, want := GetString(kv, "name")
+	recovered := func() (r any) {
+		defer func() { r = recover() }()
+		MustGetString(kv, "name")
+		return nil
+	}()
+	err, ok := recovered.(error)
+	if !ok || err.Error() != want.Error() {
+		t.Fatalf("recovered %v, want %v", recovered, want)
+	}
+	if got := MustGetString(utils.JSON{"name": "a"}, "name"); got != "a" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestHasAndIsNullTellAbsentFromNull(t *testing.T) {
+	kv := utils.JSON{"null": nil, "value": 1}
+	for _, tc := range []struct {
+		key        string
+		wantHas    bool
+		wantIsNull bool
+	}{
+		{key: "null", wantHas: true, wantIsNull: true},
+		{key: "value", wantHas: true},
+		{key: "missing"},
+	} {
+		if Has(kv, tc.key) != tc.wantHas || IsNull(kv, tc.key) != tc.wantIsNull {
+			t.Errorf("%s: Has %v, IsNull %v", tc.key, Has(kv, tc.key), IsNull(kv, tc.key))
+		}
+	}
+}
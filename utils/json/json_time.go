@@ -0,0 +1,116 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/utils"
+)
+
+// DXJSONDefaultTimeLayouts are tried by ParseTime before the extra layouts given by the caller
+var DXJSONDefaultTimeLayouts = []string{time.RFC3339Nano, time.RFC3339}
+
+// ParseTime parses s with DXJSONDefaultTimeLayouts and then with layouts
+func ParseTime(s string, layouts ...string) (t time.Time, err error) {
+	allLayouts := append(append([]string(nil), DXJSONDefaultTimeLayouts...), layouts...)
+	for _, layout := range allLayouts {
+		t, err = time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("TIME_FORMAT_INVALID:%q does not match %s", s, strings.Join(allLayouts, " or "))
+}
+
+// ParseDate parses a date-only value ("2006-01-02") to its midnight UTC, a time.Time is truncated to its UTC date
+func ParseDate(v any) (t time.Time, err error) {
+	switch d := v.(type) {
+	case time.Time:
+		y, m, day := d.UTC().Date()
+		return time.Date(y, m, day, 0, 0, 0, 0, time.UTC), nil
+	case string:
+		t, err = time.ParseInLocation(time.DateOnly, d, time.UTC)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("DATE_FORMAT_INVALID:%q does not match %s", d, time.DateOnly)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("DATE_FORMAT_INVALID:expected a date string, got %T", v)
+}
+
+// ParseDuration accepts a time.ParseDuration string ("90s", "5m") or a number of seconds
+func ParseDuration(v any) (d time.Duration, err error) {
+	switch t := v.(type) {
+	case time.Duration:
+		return t, nil
+	case string:
+		d, err = time.ParseDuration(t)
+		if err != nil {
+			return 0, fmt.Errorf("DURATION_FORMAT_INVALID:%q is not a duration", t)
+		}
+		return d, nil
+	case float64:
+		return time.Duration(t * float64(time.Second)), nil
+	case float32:
+		return time.Duration(float64(t) * float64(time.Second)), nil
+	case int:
+		return time.Duration(t) * time.Second, nil
+	case int32:
+		return time.Duration(t) * time.Second, nil
+	case int64:
+		return time.Duration(t) * time.Second, nil
+	case json.Number:
+		f, errParse := t.Float64()
+		if errParse != nil {
+			return 0, fmt.Errorf("DURATION_FORMAT_INVALID:%q is not a duration", t.String())
+		}
+		return time.Duration(f * float64(time.Second)), nil
+	}
+	return 0, fmt.Errorf("DURATION_FORMAT_INVALID:expected a duration string or a number of seconds, got %T", v)
+}
+
+// GetTime returns the time at k, ok is false when it is missing or null and err is set when it does not parse
+func GetTime(kv utils.JSON, k string, layouts ...string) (v time.Time, ok bool, err error) {
+	a, ok := kv[k]
+	if !ok || a == nil {
+		return time.Time{}, false, nil
+	}
+	switch t := a.(type) {
+	case time.Time:
+		return t, true, nil
+	case string:
+		v, err = ParseTime(t, layouts...)
+		if err != nil {
+			return time.Time{}, true, fmt.Errorf("JSON_KEY_TYPE_MISMATCH:%s:%w", k, err)
+		}
+		return v, true, nil
+	}
+	return time.Time{}, true, keyTypeMismatchError(k, v, a)
+}
+
+// GetDate returns the date at k as its midnight UTC
+func GetDate(kv utils.JSON, k string) (v time.Time, ok bool, err error) {
+	a, ok := kv[k]
+	if !ok || a == nil {
+		return time.Time{}, false, nil
+	}
+	v, err = ParseDate(a)
+	if err != nil {
+		return time.Time{}, true, fmt.Errorf("JSON_KEY_TYPE_MISMATCH:%s:%w", k, err)
+	}
+	return v, true, nil
+}
+
+func GetDuration(kv utils.JSON, k string) (v time.Duration, ok bool, err error) {
+	a, ok := kv[k]
+	if !ok || a == nil {
+		return 0, false, nil
+	}
+	v, err = ParseDuration(a)
+	if err != nil {
+		return 0, true, fmt.Errorf("JSON_KEY_TYPE_MISMATCH:%s:%w", k, err)
+	}
+	return v, true, nil
+}
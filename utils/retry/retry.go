@@ -0,0 +1,147 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExhausted is the cause of a failure not retried because the Budget of its context is spent
+var ErrBudgetExhausted = errors.New("RETRY_BUDGET_EXHAUSTED")
+
+// Budget bounds the retries of everything sharing it, the retry loops of a request consume from the one of its context so
+// that together they retry at most MaxRetries times or for at most MaxDuration after the first retry. A zero bound is no
+// bound. A Budget is safe for concurrent use.
+type Budget struct {
+	MaxRetries  int
+	MaxDuration time.Duration
+	// OnExhausted is called once, by the first TryConsume refused
+	OnExhausted func(b *Budget)
+
+	// parent is the Budget of the context b was attached to by WithBudget, a retry of b is one of parent too
+	parent         *Budget
+	mutex          sync.Mutex
+	retryCount     int
+	firstRetryTime time.Time
+	isExhausted    bool
+}
+
+func NewBudget(maxRetries int, maxDuration time.Duration) *Budget {
+	return &Budget{MaxRetries: maxRetries, MaxDuration: maxDuration}
+}
+
+// TryConsume takes one retry of b and of the budgets it is nested in, it returns ErrBudgetExhausted when one of them has none
+// left and then for every later call. A nil b is an unbounded budget.
+func (b *Budget) TryConsume() error {
+	if b == nil {
+		return nil
+	}
+	b.mutex.Lock()
+	isFirstRefusal := false
+	if !b.isExhausted {
+		now := time.Now()
+		if b.MaxRetries > 0 && b.retryCount >= b.MaxRetries {
+			b.isExhausted = true
+		} else if b.MaxDuration > 0 && !b.firstRetryTime.IsZero() && now.Sub(b.firstRetryTime) >= b.MaxDuration {
+			b.isExhausted = true
+		} else if b.parent.TryConsume() != nil {
+			// The cap of the enclosing budget is the one of b too
+			b.isExhausted = true
+		}
+		if b.isExhausted {
+			isFirstRefusal = true
+		} else {
+			if b.firstRetryTime.IsZero() {
+				b.firstRetryTime = now
+			}
+			b.retryCount++
+		}
+	}
+	isExhausted := b.isExhausted
+	b.mutex.Unlock()
+	if isFirstRefusal && b.OnExhausted != nil {
+		b.OnExhausted(b)
+	}
+	if isExhausted {
+		return ErrBudgetExhausted
+	}
+	return nil
+}
+
+// RetryCount is the count of the retries taken from b
+func (b *Budget) RetryCount() int {
+	if b == nil {
+		return 0
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.retryCount
+}
+
+// IsExhausted tells whether a TryConsume of b was refused
+func (b *Budget) IsExhausted() bool {
+	if b == nil {
+		return false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.isExhausted
+}
+
+type budgetContextKey struct{}
+
+// WithBudget has the retries made in ctx consume from b. When ctx has a Budget already b is nested in it, a retry of b is
+// one of the enclosing budget too, so a nested retry loop cannot go past the cap of the request.
+func WithBudget(ctx context.Context, b *Budget) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if b != nil {
+		b.nestIn(FromContext(ctx))
+	}
+	return context.WithValue(ctx, budgetContextKey{}, b)
+}
+
+// nestIn makes parent the enclosing budget of b, unless b has one already or is enclosing parent itself
+func (b *Budget) nestIn(parent *Budget) {
+	for p := parent; p != nil; p = p.parentOf() {
+		if p == b {
+			return
+		}
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.parent == nil {
+		b.parent = parent
+	}
+}
+
+func (b *Budget) parentOf() *Budget {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.parent
+}
+
+// FromContext is the Budget of ctx, nil when it has none
+func FromContext(ctx context.Context) *Budget {
+	if ctx == nil {
+		return nil
+	}
+	b, _ := ctx.Value(budgetContextKey{}).(*Budget)
+	return b
+}
+
+// TryConsume takes one retry of the Budget of ctx. When none is left it returns cause with ErrBudgetExhausted attached, both
+// matched by errors.Is. A context without a Budget does not bound the retries.
+func TryConsume(ctx context.Context, cause error) error {
+	err := FromContext(ctx).TryConsume()
+	if err == nil {
+		return nil
+	}
+	if cause == nil {
+		return err
+	}
+	return fmt.Errorf("%w:%w", err, cause)
+}
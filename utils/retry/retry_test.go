@@ -0,0 +1,166 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBudgetMaxRetries(t *testing.T) {
+	exhaustedCount := 0
+	b := NewBudget(2, 0)
+	b.OnExhausted = func(*Budget) { exhaustedCount++ }
+	for i := 0; i < 2; i++ {
+		if err := b.TryConsume(); err != nil {
+			t.Fatalf("retry %d: %v", i, err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := b.TryConsume(); !errors.Is(err, ErrBudgetExhausted) {
+			t.Fatalf("err %v", err)
+		}
+	}
+	if b.RetryCount() != 2 || !b.IsExhausted() || exhaustedCount != 1 {
+		t.Fatalf("%d retries, exhausted %v, OnExhausted called %d times", b.RetryCount(), b.IsExhausted(), exhaustedCount)
+	}
+}
+
+func TestBudgetMaxDuration(t *testing.T) {
+	b := NewBudget(0, 50*time.Millisecond)
+	if err := b.TryConsume(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if err := b.TryConsume(); !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("err %v", err)
+	}
+}
+
+// A nil budget, and a context without one, do not bound the retries
+func TestNoBudget(t *testing.T) {
+	var b *Budget
+	for i := 0; i < 100; i++ {
+		if b.TryConsume() != nil || TryConsume(context.Background(), errors.New("FAILED")) != nil {
+			t.Fatal("a retry without a budget is refused")
+		}
+	}
+	if FromContext(nil) != nil || b.RetryCount() != 0 || b.IsExhausted() {
+		t.Fatal("a nil budget has retries")
+	}
+}
+
+func TestTryConsumeAttachesTheCause(t *testing.T) {
+	ctx := WithBudget(context.Background(), NewBudget(1, 0))
+	cause := errors.New("CONNECTION_REFUSED")
+	if err := TryConsume(ctx, cause); err != nil {
+		t.Fatal(err)
+	}
+	err := TryConsume(ctx, cause)
+	if !errors.Is(err, ErrBudgetExhausted) || !errors.Is(err, cause) {
+		t.Fatalf("err %v", err)
+	}
+}
+
+// retryLoop is a retry loop of a dependency failing every time, it tries once plus at most maxRetries retries, each consuming
+// from the budget of ctx, and runs nested in each try
+func retryLoop(ctx context.Context, maxRetries int, tries *int, nested func(ctx context.Context) error) error {
+	for tryCount := 0; ; tryCount++ {
+		*tries++
+		err := errors.New("DEPENDENCY_FAILED")
+		if nested != nil {
+			if errNested := nested(ctx); errNested != nil {
+				err = errNested
+			}
+		}
+		if errors.Is(err, ErrBudgetExhausted) || tryCount >= maxRetries {
+			return err
+		}
+		if errBudget := TryConsume(ctx, err); errBudget != nil {
+			return errBudget
+		}
+	}
+}
+
+// Retry loops nested in the tries of another, each allowed many retries, together retry no more than the budget of their
+// context, and the failure after it is spent is returned at once
+func TestNestedRetriesRespectTheSharedCap(t *testing.T) {
+	b := NewBudget(3, 0)
+	ctx := WithBudget(context.Background(), b)
+	outerTries, innerTries := 0, 0
+	err := retryLoop(ctx, 10, &outerTries, func(ctx context.Context) error {
+		return retryLoop(ctx, 10, &innerTries, nil)
+	})
+	if !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("err %v", err)
+	}
+	// The first try of the outer loop runs the inner one, which takes the 3 retries and then stops the outer one
+	if b.RetryCount() != 3 || outerTries != 1 || innerTries != 4 {
+		t.Fatalf("%d retries, %d outer tries, %d inner tries", b.RetryCount(), outerTries, innerTries)
+	}
+	// A later loop in the same context does not retry at all
+	laterTries := 0
+	err = retryLoop(ctx, 10, &laterTries, nil)
+	if !errors.Is(err, ErrBudgetExhausted) || laterTries != 1 {
+		t.Fatalf("%d tries, err %v", laterTries, err)
+	}
+}
+
+// A budget attached inside the context of another can not take more retries than the enclosing one has left, its own cap
+// still applies
+func TestNestedBudgetsRespectTheEnclosingCap(t *testing.T) {
+	request := NewBudget(3, 0)
+	ctx := WithBudget(context.Background(), request)
+	inner := NewBudget(10, 0)
+	innerCtx := WithBudget(ctx, inner)
+	tries := 0
+	err := retryLoop(innerCtx, 10, &tries, nil)
+	if !errors.Is(err, ErrBudgetExhausted) || tries != 4 || request.RetryCount() != 3 || inner.RetryCount() != 3 {
+		t.Fatalf("%d tries, %d request retries, %d inner retries, err %v", tries, request.RetryCount(), inner.RetryCount(), err)
+	}
+	if TryConsume(ctx, nil) == nil {
+		t.Fatal("the enclosing budget has retries left")
+	}
+
+	small := NewBudget(1, 0)
+	smallCtx := WithBudget(WithBudget(context.Background(), NewBudget(10, 0)), small)
+	tries = 0
+	err = retryLoop(smallCtx, 10, &tries, nil)
+	if !errors.Is(err, ErrBudgetExhausted) || tries != 2 {
+		t.Fatalf("%d tries, err %v", tries, err)
+	}
+
+	// Attaching a budget again, under itself or under one it encloses, does not make a cycle
+	again := WithBudget(WithBudget(innerCtx, request), inner)
+	if FromContext(again) != inner || TryConsume(again, nil) == nil {
+		t.Fatal("the budget attached again has retries")
+	}
+}
+
+// Concurrent retries of the goroutines of a request take no more than the budget of its context
+func TestConcurrentRetriesRespectTheSharedCap(t *testing.T) {
+	b := NewBudget(5, 0)
+	ctx := WithBudget(context.Background(), b)
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	granted := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			inner := WithBudget(ctx, NewBudget(0, 0))
+			for j := 0; j < 10; j++ {
+				if TryConsume(inner, nil) == nil {
+					mutex.Lock()
+					granted++
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if granted != 5 || b.RetryCount() != 5 {
+		t.Fatalf("%d retries granted, %d counted", granted, b.RetryCount())
+	}
+}
@@ -0,0 +1,74 @@
+package sql
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DXHMACSignatureMaxClockSkew is how far the timestamp of a signed request may be from the local clock, in either direction
+var DXHMACSignatureMaxClockSkew = 5 * time.Minute
+
+// SignPayload returns the hex encoded HMAC-SHA256 of "<unix seconds of ts>.<payload>" keyed by secret. Signing the timestamp
+// with the body keeps a captured request from being replayed once it is stale.
+func SignPayload(secret, payload []byte, ts time.Time) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(ts.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks signature, made by SignPayload, in constant time, and that ts is within DXHMACSignatureMaxClockSkew
+// of now
+func VerifySignature(secret, payload []byte, ts time.Time, signature string) (err error) {
+	skew := time.Since(ts)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > DXHMACSignatureMaxClockSkew {
+		return fmt.Errorf("HMAC_SIGNATURE_STALE_TIMESTAMP:%d", ts.Unix())
+	}
+	actual, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("HMAC_SIGNATURE_INVALID_ENCODING")
+	}
+	expected, _ := hex.DecodeString(SignPayload(secret, payload, ts))
+	if !hmac.Equal(actual, expected) {
+		return fmt.Errorf("HMAC_SIGNATURE_MISMATCH")
+	}
+	return nil
+}
+
+// FormatSignatureHeader returns the value of the signature header: keyId=<keyId>,t=<unix seconds>,sig=<signature>
+func FormatSignatureHeader(keyId string, ts time.Time, signature string) string {
+	return fmt.Sprintf("keyId=%s,t=%d,sig=%s", keyId, ts.Unix(), signature)
+}
+
+// ParseSignatureHeader reads a value written by FormatSignatureHeader
+func ParseSignatureHeader(v string) (keyId string, ts time.Time, signature string, err error) {
+	var unix string
+	for _, field := range strings.Split(v, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch name {
+		case "keyId":
+			keyId = value
+		case "t":
+			unix = value
+		case "sig":
+			signature = value
+		}
+	}
+	if keyId == "" || unix == "" || signature == "" {
+		return "", time.Time{}, "", fmt.Errorf("HMAC_SIGNATURE_HEADER_INVALID")
+	}
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return "", time.Time{}, "", fmt.Errorf("HMAC_SIGNATURE_HEADER_INVALID_TIMESTAMP:%s", unix)
+	}
+	return keyId, time.Unix(seconds, 0), signature, nil
+}
@@ -0,0 +1,126 @@
+package sql
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type DXPasswordHashParams struct {
+	// Memory is in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DXPasswordHashDefaultParams follows the OWASP recommendation for argon2id, HashPassword uses it and VerifyPassword asks for
+// a rehash of the hashes made with weaker parameters
+var DXPasswordHashDefaultParams = DXPasswordHashParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// DXPasswordMaxLength guards the hashing against the very long passwords used to exhaust the CPU
+var DXPasswordMaxLength = 1024
+
+const argon2idPrefix = "$argon2id$"
+
+func checkPasswordLength(plain string) (err error) {
+	if len(plain) > DXPasswordMaxLength {
+		return fmt.Errorf("PASSWORD_TOO_LONG:%d>%d", len(plain), DXPasswordMaxLength)
+	}
+	return nil
+}
+
+// HashPassword hashes plain with argon2id and DXPasswordHashDefaultParams, the result holds the parameters and the salt in the
+// PHC string format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func HashPassword(plain string) (encoded string, err error) {
+	err = checkPasswordLength(plain)
+	if err != nil {
+		return "", err
+	}
+	p := DXPasswordHashDefaultParams
+	salt := make([]byte, p.SaltLength)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return "", fmt.Errorf("PASSWORD_HASH_SALT_FAILED:%w", err)
+	}
+	key := argon2.IDKey([]byte(plain), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword tells whether plain matches encoded, an argon2id hash of HashPassword or a legacy bcrypt hash. needsRehash is
+// true when the password matched but encoded is bcrypt or was made with other parameters than DXPasswordHashDefaultParams, the
+// caller should then store HashPassword(plain) in its place.
+func VerifyPassword(plain, encoded string) (isMatch bool, needsRehash bool, err error) {
+	err = checkPasswordLength(plain)
+	if err != nil {
+		return false, false, err
+	}
+	if strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$") {
+		err = bcrypt.CompareHashAndPassword([]byte(encoded), []byte(plain))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, fmt.Errorf("PASSWORD_HASH_INVALID:%w", err)
+		}
+		return true, true, nil
+	}
+	if !strings.HasPrefix(encoded, argon2idPrefix) {
+		return false, false, fmt.Errorf("PASSWORD_HASH_UNKNOWN_FORMAT")
+	}
+	p, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	computed := argon2.IDKey([]byte(plain), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return false, false, nil
+	}
+	return true, p != DXPasswordHashDefaultParams, nil
+}
+
+func decodeArgon2id(encoded string) (p DXPasswordHashParams, salt []byte, key []byte, err error) {
+	fields := strings.Split(encoded, "$")
+	if len(fields) != 6 {
+		return p, nil, nil, fmt.Errorf("PASSWORD_HASH_INVALID:FIELD_COUNT")
+	}
+	var version int
+	_, err = fmt.Sscanf(fields[2], "v=%d", &version)
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("PASSWORD_HASH_INVALID:VERSION:%w", err)
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("PASSWORD_HASH_UNSUPPORTED_VERSION:%d", version)
+	}
+	_, err = fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism)
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("PASSWORD_HASH_INVALID:PARAMETERS:%w", err)
+	}
+	if p.Iterations == 0 || p.Parallelism == 0 {
+		return p, nil, nil, fmt.Errorf("PASSWORD_HASH_INVALID:PARAMETERS")
+	}
+	salt, err = base64.RawStdEncoding.DecodeString(fields[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("PASSWORD_HASH_INVALID:SALT:%w", err)
+	}
+	key, err = base64.RawStdEncoding.DecodeString(fields[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, fmt.Errorf("PASSWORD_HASH_INVALID:KEY")
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
@@ -0,0 +1,102 @@
+package sql
+
+import (
+	"strings"
+	"testing"
+)
+
+// The argon2id vectors of the test suite of the reference implementation, github.com/P-H-C/phc-winner-argon2 src/test.c
+func TestVerifyPasswordArgon2idReferenceVectors(t *testing.T) {
+	for _, tc := range []struct {
+		plain   string
+		encoded string
+	}{
+		{"password", "$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"},
+		{"password", "$argon2id$v=19$m=262144,t=2,p=1$c29tZXNhbHQ$eP4eyR+zqlZX1y5xCFTkw9m5GYx0L5YWwvCFvtlbLow"},
+		{"password", "$argon2id$v=19$m=256,t=2,p=1$c29tZXNhbHQ$nf65EOgLrQMR/uIPnA4rEsF5h7TKyQwu9U1bMCHGi/4"},
+		{"password", "$argon2id$v=19$m=256,t=2,p=2$c29tZXNhbHQ$bQk8UB/VmZZF4Oo79iDXuL5/0ttZwg2f/5U52iv1cDc"},
+		{"password", "$argon2id$v=19$m=65536,t=1,p=1$c29tZXNhbHQ$9qWtwbpyPd3vm1rB1GThgPzZ3/ydHL92zKL+15XZypg"},
+		{"password", "$argon2id$v=19$m=65536,t=4,p=1$c29tZXNhbHQ$kCXUjmjvc5XMqQedpMTsOv+zyJEf5PhtGiUghW9jFyw"},
+		{"differentpassword", "$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$C4TWUs9rDEvq7w3+J4umqA32aWKB1+DSiRuBfYxFj94"},
+		{"password", "$argon2id$v=19$m=65536,t=2,p=1$ZGlmZnNhbHQ$vfMrBczELrFdWP0ZsfhWsRPaHppYdP3MVEMIVlqoFBw"},
+	} {
+		isMatch, needsRehash, err := VerifyPassword(tc.plain, tc.encoded)
+		if err != nil || !isMatch {
+			t.Errorf("%s: match %v, %v", tc.encoded, isMatch, err)
+			continue
+		}
+		if !needsRehash {
+			t.Errorf("%s: the parameters are not the default ones, a rehash is needed", tc.encoded)
+		}
+		isMatch, _, err = VerifyPassword(tc.plain+"x", tc.encoded)
+		if err != nil || isMatch {
+			t.Errorf("%s: another password matches, %v", tc.encoded, err)
+		}
+	}
+}
+
+// The bcrypt vectors of the crypt_blowfish test suite of Openwall, for the legacy hashes
+func TestVerifyPasswordBcryptVectors(t *testing.T) {
+	for _, tc := range []struct {
+		plain   string
+		encoded string
+	}{
+		{"U*U", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW"},
+		{"U*U*", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.VGOzA784oUp/Z0DY336zx7pLYAy0lwK"},
+		{"U*U*U", "$2a$05$XXXXXXXXXXXXXXXXXXXXXOAcXxm9kjPGEMsLznoKqmqw7tc8WCx4a"},
+		{"", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.7uG0VCzI2bS7j6ymqJi9CdcdxiRTWNy"},
+		{"0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789chars after 72 are ignored",
+			"$2a$05$abcdefghijklmnopqrstuu5s2v8.iXieOjg/.AySBTTZIIVFJeBui"},
+		{"\xff\xff\xa3", "$2y$05$/OK.fbVrR/bpIqNJ5ianF.CE5elHaaO4EbggVDjb8P19RukzXSM3e"},
+		{"\xff\xff\xa3", "$2b$05$/OK.fbVrR/bpIqNJ5ianF.CE5elHaaO4EbggVDjb8P19RukzXSM3e"},
+	} {
+		isMatch, needsRehash, err := VerifyPassword(tc.plain, tc.encoded)
+		if err != nil || !isMatch || !needsRehash {
+			t.Errorf("%s: match %v, rehash %v, %v", tc.encoded, isMatch, needsRehash, err)
+		}
+		isMatch, _, err = VerifyPassword("x"+tc.plain, tc.encoded)
+		if err != nil || isMatch {
+			t.Errorf("%s: another password matches, %v", tc.encoded, err)
+		}
+	}
+}
+
+func TestHashPasswordRoundTrip(t *testing.T) {
+	encoded, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Fatalf("encoded %s", encoded)
+	}
+	other, _ := HashPassword("correct horse battery staple")
+	if other == encoded {
+		t.Fatal("two hashes of a password share their salt")
+	}
+	isMatch, needsRehash, err := VerifyPassword("correct horse battery staple", encoded)
+	if err != nil || !isMatch || needsRehash {
+		t.Fatalf("match %v, rehash %v, %v", isMatch, needsRehash, err)
+	}
+}
+
+func TestVerifyPasswordRejectsInvalidHashes(t *testing.T) {
+	for _, encoded := range []string{
+		"",
+		"plain",
+		"$argon2i$v=19$m=65536,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		"$argon2id$v=16$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+		"$argon2id$v=19$m=65536,t=0,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+		"$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$",
+		"$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ",
+		"$2a$05$short",
+	} {
+		isMatch, _, err := VerifyPassword("password", encoded)
+		if err == nil || isMatch {
+			t.Errorf("%q: match %v, %v", encoded, isMatch, err)
+		}
+	}
+	_, err := HashPassword(strings.Repeat("a", DXPasswordMaxLength+1))
+	if err == nil || !strings.HasPrefix(err.Error(), "PASSWORD_TOO_LONG:") {
+		t.Fatalf("err %v", err)
+	}
+}
@@ -7,17 +7,6 @@ import (
 	"strings"
 )
 
-func IsDDL(statement string) bool {
-	upperStatement := strings.ToUpper(statement)
-	keywords := []string{"CREATE", "DROP", "ALTER", "TRUNCATE", "COMMENT", "RENAME"}
-	for _, v := range keywords {
-		if strings.Contains(upperStatement, v) {
-			return true
-		}
-	}
-	return false
-}
-
 func StringCheckPossibleSQLInjection(s string) bool {
 	if strings.ContainsAny(s, " ')-#/*!;+|") {
 		return true
@@ -72,13 +61,10 @@ func PartSQLStringCheckPossibleSQLInjection(s string) bool {
 	return false
 }
 
-func HashPassword(password string) []byte {
-	hashed := sha512.Sum512([]byte(password))
-	return hashed[:]
-}
-
+// HashPasswordToHexString is the unsalted SHA-512 of password, kept for the stored values made with it, new passwords should
+// use HashPassword
 func HashPasswordToHexString(password string) string {
-	hashed := HashPassword(password)
+	hashed := HashSHA512([]byte(password))
 	return hex.EncodeToString(hashed)
 }
 
@@ -0,0 +1,386 @@
+package sql
+
+import (
+	"strings"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+)
+
+type DXSQLStatementClass int
+
+const (
+	// DXSQLStatementClassUnknown is an empty statement, or one not starting with a keyword
+	DXSQLStatementClassUnknown DXSQLStatementClass = iota
+	DXSQLStatementClassDDL
+	DXSQLStatementClassDML
+	DXSQLStatementClassDQL
+	DXSQLStatementClassTCL
+	DXSQLStatementClassDCL
+	// DXSQLStatementClassBlock is a procedural block: PL/SQL and T-SQL BEGIN/DECLARE blocks, PostgreSQL DO
+	DXSQLStatementClassBlock
+	// DXSQLStatementClassOther starts with a keyword of none of the classes, like SET or USE
+	DXSQLStatementClassOther
+)
+
+func (c DXSQLStatementClass) String() string {
+	switch c {
+	case DXSQLStatementClassDDL:
+		return "DDL"
+	case DXSQLStatementClassDML:
+		return "DML"
+	case DXSQLStatementClassDQL:
+		return "DQL"
+	case DXSQLStatementClassTCL:
+		return "TCL"
+	case DXSQLStatementClassDCL:
+		return "DCL"
+	case DXSQLStatementClassBlock:
+		return "BLOCK"
+	case DXSQLStatementClassOther:
+		return "OTHER"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+var sqlKeywordClasses = map[string]DXSQLStatementClass{
+	"CREATE":    DXSQLStatementClassDDL,
+	"DROP":      DXSQLStatementClassDDL,
+	"ALTER":     DXSQLStatementClassDDL,
+	"TRUNCATE":  DXSQLStatementClassDDL,
+	"COMMENT":   DXSQLStatementClassDDL,
+	"RENAME":    DXSQLStatementClassDDL,
+	"INSERT":    DXSQLStatementClassDML,
+	"UPDATE":    DXSQLStatementClassDML,
+	"DELETE":    DXSQLStatementClassDML,
+	"MERGE":     DXSQLStatementClassDML,
+	"UPSERT":    DXSQLStatementClassDML,
+	"REPLACE":   DXSQLStatementClassDML,
+	"COPY":      DXSQLStatementClassDML,
+	"CALL":      DXSQLStatementClassDML,
+	"EXEC":      DXSQLStatementClassDML,
+	"EXECUTE":   DXSQLStatementClassDML,
+	"SELECT":    DXSQLStatementClassDQL,
+	"VALUES":    DXSQLStatementClassDQL,
+	"TABLE":     DXSQLStatementClassDQL,
+	"SHOW":      DXSQLStatementClassDQL,
+	"EXPLAIN":   DXSQLStatementClassDQL,
+	"DESCRIBE":  DXSQLStatementClassDQL,
+	"DESC":      DXSQLStatementClassDQL,
+	"COMMIT":    DXSQLStatementClassTCL,
+	"ROLLBACK":  DXSQLStatementClassTCL,
+	"SAVEPOINT": DXSQLStatementClassTCL,
+	"RELEASE":   DXSQLStatementClassTCL,
+	"START":     DXSQLStatementClassTCL,
+	"GRANT":     DXSQLStatementClassDCL,
+	"REVOKE":    DXSQLStatementClassDCL,
+}
+
+type sqlTokenKind int
+
+const (
+	sqlTokenEnd sqlTokenKind = iota
+	sqlTokenWord
+	sqlTokenPunctuation
+	sqlTokenOther
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	// text is upper-cased for the words
+	text string
+}
+
+// sqlScanner walks the significant tokens of a statement, skipping the comments, the string literals, the quoted identifiers
+// and the dollar-quoted bodies
+type sqlScanner struct {
+	s       string
+	i       int
+	dialect database_type.DXDatabaseType
+}
+
+func isSQLWordByte(c byte) bool {
+	return c == '_' || c == '$' || c == '#' || c == '@' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= 0x80
+}
+
+// skipUntil moves past the next occurrence of end, or to the end of the statement
+func (sc *sqlScanner) skipUntil(end string) {
+	k := strings.Index(sc.s[sc.i:], end)
+	if k < 0 {
+		sc.i = len(sc.s)
+		return
+	}
+	sc.i += k + len(end)
+}
+
+// skipQuoted moves past a literal opened by quote, a doubled quote is part of the literal and so is a backslash escape in MySQL
+func (sc *sqlScanner) skipQuoted(quote byte) {
+	sc.i++
+	for sc.i < len(sc.s) {
+		c := sc.s[sc.i]
+		if c == '\\' && quote != ']' && sc.dialect == database_type.MySQL {
+			sc.i += 2
+			continue
+		}
+		sc.i++
+		if c == quote {
+			if quote != ']' && sc.i < len(sc.s) && sc.s[sc.i] == quote {
+				sc.i++
+				continue
+			}
+			return
+		}
+	}
+}
+
+// skipBlockComment handles the nested comments of PostgreSQL too
+func (sc *sqlScanner) skipBlockComment() {
+	depth := 0
+	for sc.i < len(sc.s) {
+		switch {
+		case strings.HasPrefix(sc.s[sc.i:], "/*"):
+			depth++
+			sc.i += 2
+		case strings.HasPrefix(sc.s[sc.i:], "*/"):
+			depth--
+			sc.i += 2
+			if depth == 0 {
+				return
+			}
+		default:
+			sc.i++
+		}
+	}
+}
+
+// dollarQuoteTag returns the $tag$ opening a dollar-quoted body at the current position, or ""
+func (sc *sqlScanner) dollarQuoteTag() string {
+	j := sc.i + 1
+	for j < len(sc.s) && (sc.s[j] == '_' || (sc.s[j] >= 'a' && sc.s[j] <= 'z') || (sc.s[j] >= 'A' && sc.s[j] <= 'Z') || (sc.s[j] >= '0' && sc.s[j] <= '9' && j > sc.i+1)) {
+		j++
+	}
+	if j < len(sc.s) && sc.s[j] == '$' {
+		return sc.s[sc.i : j+1]
+	}
+	return ""
+}
+
+// oracleQuoteEnd returns the closing delimiter of an Oracle q'[...]' literal
+func oracleQuoteEnd(open byte) byte {
+	switch open {
+	case '[':
+		return ']'
+	case '{':
+		return '}'
+	case '(':
+		return ')'
+	case '<':
+		return '>'
+	}
+	return open
+}
+
+func (sc *sqlScanner) next() sqlToken {
+	for sc.i < len(sc.s) {
+		c := sc.s[sc.i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			sc.i++
+		case strings.HasPrefix(sc.s[sc.i:], "--"):
+			sc.skipUntil("\n")
+		case c == '#' && sc.dialect == database_type.MySQL:
+			sc.skipUntil("\n")
+		case strings.HasPrefix(sc.s[sc.i:], "/*"):
+			sc.skipBlockComment()
+		case c == '\'':
+			sc.skipQuoted('\'')
+			return sqlToken{kind: sqlTokenOther}
+		case c == '"':
+			sc.skipQuoted('"')
+			return sqlToken{kind: sqlTokenOther}
+		case c == '`' && sc.dialect != database_type.SQLServer:
+			sc.skipQuoted('`')
+			return sqlToken{kind: sqlTokenOther}
+		case c == '[' && (sc.dialect == database_type.SQLServer || sc.dialect == database_type.UnknownDatabaseType):
+			sc.skipQuoted(']')
+			return sqlToken{kind: sqlTokenOther}
+		case (c == 'q' || c == 'Q') && sc.dialect == database_type.Oracle && sc.i+2 < len(sc.s) && sc.s[sc.i+1] == '\'':
+			end := string([]byte{oracleQuoteEnd(sc.s[sc.i+2]), '\''})
+			sc.i += 3
+			sc.skipUntil(end)
+			return sqlToken{kind: sqlTokenOther}
+		case c == '$' && sc.dialect != database_type.SQLServer && sc.dollarQuoteTag() != "":
+			tag := sc.dollarQuoteTag()
+			sc.i += len(tag)
+			sc.skipUntil(tag)
+			return sqlToken{kind: sqlTokenOther}
+		case c == '(' || c == ')' || c == ',' || c == ';':
+			sc.i++
+			return sqlToken{kind: sqlTokenPunctuation, text: string(c)}
+		case isSQLWordByte(c):
+			start := sc.i
+			for sc.i < len(sc.s) && isSQLWordByte(sc.s[sc.i]) {
+				sc.i++
+			}
+			word := strings.ToUpper(sc.s[start:sc.i])
+			if word[0] >= '0' && word[0] <= '9' {
+				return sqlToken{kind: sqlTokenOther, text: word}
+			}
+			return sqlToken{kind: sqlTokenWord, text: word}
+		default:
+			sc.i++
+			return sqlToken{kind: sqlTokenOther, text: string(c)}
+		}
+	}
+	return sqlToken{kind: sqlTokenEnd}
+}
+
+// Classify returns the class of the first statement of statement, found from its first significant keyword. Comments,
+// string literals, quoted identifiers and dollar-quoted bodies are skipped, so their content never decides the class, and the
+// main statement of a WITH query is the one after its common table expressions. SQL Server GO batch separators are skipped,
+// BEGIN is a transaction on PostgreSQL and MySQL but a block on Oracle and, unless followed by TRAN or TRANSACTION, on SQL
+// Server. The transaction control statements opening a script are skipped too, BEGIN; CREATE TABLE ...; COMMIT is DDL.
+func Classify(statement string, dialect database_type.DXDatabaseType) DXSQLStatementClass {
+	sc := &sqlScanner{s: statement, dialect: dialect}
+	isAfterTCL := false
+	for {
+		token := sc.next()
+		switch token.kind {
+		case sqlTokenEnd:
+			if isAfterTCL {
+				return DXSQLStatementClassTCL
+			}
+			return DXSQLStatementClassUnknown
+		case sqlTokenPunctuation:
+			if token.text == "(" || token.text == ";" {
+				continue
+			}
+			return DXSQLStatementClassUnknown
+		case sqlTokenOther:
+			return DXSQLStatementClassUnknown
+		}
+		if token.text == "GO" && dialect == database_type.SQLServer {
+			continue
+		}
+		class := sc.classifyKeyword(token.text)
+		if class != DXSQLStatementClassTCL {
+			return class
+		}
+		isAfterTCL = true
+		sc.skipStatement()
+	}
+}
+
+// skipStatement moves past the ; ending the current statement, or to the end of the statement
+func (sc *sqlScanner) skipStatement() {
+	depth := 0
+	for {
+		token := sc.next()
+		switch {
+		case token.kind == sqlTokenEnd:
+			return
+		case token.text == "(":
+			depth++
+		case token.text == ")":
+			depth--
+		case token.text == ";" && depth <= 0:
+			return
+		case token.kind == sqlTokenWord && token.text == "GO" && sc.dialect == database_type.SQLServer:
+			return
+		}
+	}
+}
+
+func (sc *sqlScanner) classifyKeyword(keyword string) DXSQLStatementClass {
+	switch keyword {
+	case "WITH":
+		return sc.classifyWith()
+	case "BEGIN":
+		return sc.classifyBegin()
+	case "DECLARE":
+		if sc.dialect == database_type.PostgreSQL {
+			// DECLARE name CURSOR FOR SELECT ...
+			return DXSQLStatementClassDQL
+		}
+		return DXSQLStatementClassBlock
+	case "DO":
+		if sc.dialect == database_type.PostgreSQL || sc.dialect == database_type.UnknownDatabaseType {
+			return DXSQLStatementClassBlock
+		}
+		return DXSQLStatementClassOther
+	case "END":
+		if sc.dialect == database_type.PostgreSQL {
+			return DXSQLStatementClassTCL
+		}
+		return DXSQLStatementClassOther
+	case "SET":
+		token := sc.next()
+		if token.kind == sqlTokenWord && token.text == "TRANSACTION" {
+			return DXSQLStatementClassTCL
+		}
+		return DXSQLStatementClassOther
+	}
+	class, ok := sqlKeywordClasses[keyword]
+	if !ok {
+		return DXSQLStatementClassOther
+	}
+	return class
+}
+
+// classifyWith skips the common table expressions, which are all inside parentheses, up to the main statement
+func (sc *sqlScanner) classifyWith() DXSQLStatementClass {
+	depth := 0
+	for {
+		token := sc.next()
+		switch token.kind {
+		case sqlTokenEnd:
+			return DXSQLStatementClassUnknown
+		case sqlTokenPunctuation:
+			switch token.text {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			case ";":
+				if depth == 0 {
+					return DXSQLStatementClassUnknown
+				}
+			}
+		case sqlTokenWord:
+			if depth != 0 {
+				continue
+			}
+			switch token.text {
+			case "SELECT", "VALUES", "TABLE":
+				return DXSQLStatementClassDQL
+			case "INSERT", "UPDATE", "DELETE", "MERGE":
+				return DXSQLStatementClassDML
+			}
+		}
+	}
+}
+
+func (sc *sqlScanner) classifyBegin() DXSQLStatementClass {
+	switch sc.dialect {
+	case database_type.PostgreSQL, database_type.MySQL:
+		return DXSQLStatementClassTCL
+	case database_type.Oracle:
+		return DXSQLStatementClassBlock
+	}
+	start := sc.i
+	token := sc.next()
+	switch {
+	case token.kind == sqlTokenEnd || token.text == ";":
+		// The ; is left to end the statement
+		sc.i = start
+		return DXSQLStatementClassTCL
+	case token.kind == sqlTokenWord && (token.text == "TRAN" || token.text == "TRANSACTION" || token.text == "DISTRIBUTED" || token.text == "WORK"):
+		return DXSQLStatementClassTCL
+	}
+	return DXSQLStatementClassBlock
+}
+
+// IsDDL tells whether the statement is a DDL one, by Classify without a dialect
+func IsDDL(statement string) bool {
+	return Classify(statement, database_type.UnknownDatabaseType) == DXSQLStatementClassDDL
+}
@@ -0,0 +1,94 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+)
+
+func TestClassify(t *testing.T) {
+	const (
+		postgres  = database_type.PostgreSQL
+		mysql     = database_type.MySQL
+		sqlServer = database_type.SQLServer
+		oracle    = database_type.Oracle
+		unknown   = database_type.UnknownDatabaseType
+	)
+	for _, tc := range []struct {
+		statement string
+		dialect   database_type.DXDatabaseType
+		want      DXSQLStatementClass
+	}{
+		// The content of comments, literals and quoted identifiers never decides the class
+		{"select 'create table x' from t", postgres, DXSQLStatementClassDQL},
+		{"select 'a;create table x' ; ", postgres, DXSQLStatementClassDQL},
+		{"-- create table x\nselect 1", postgres, DXSQLStatementClassDQL},
+		{"/* drop table x */ select 1", mysql, DXSQLStatementClassDQL},
+		{"/* outer /* drop table x */ still a comment */ insert into t values (1)", postgres, DXSQLStatementClassDML},
+		{"# drop table x\nupdate t set a = 1", mysql, DXSQLStatementClassDML},
+		{"select 'it''s; drop table x' from dual", oracle, DXSQLStatementClassDQL},
+		{`select 'it\'s; drop table x' from t`, mysql, DXSQLStatementClassDQL},
+		{"select q'[it's; drop table x]' from dual", oracle, DXSQLStatementClassDQL},
+		{`select "create" from t`, postgres, DXSQLStatementClassDQL},
+		{"select [create] from t", sqlServer, DXSQLStatementClassDQL},
+		{"select `create` from t", mysql, DXSQLStatementClassDQL},
+		{"select $$ drop table x; $$", postgres, DXSQLStatementClassDQL},
+		{"select $body$ drop table x; $body$", postgres, DXSQLStatementClassDQL},
+		{"CREATE FUNCTION f() RETURNS int AS $$ BEGIN DELETE FROM t; RETURN 1; END $$ LANGUAGE plpgsql", postgres, DXSQLStatementClassDDL},
+		// A statement inside a literal is not a statement, not even after a ;
+		{"'; create table x", postgres, DXSQLStatementClassUnknown},
+		// CTE-leading statements are classified by their main statement
+		{"WITH created AS (SELECT * FROM t WHERE name = 'create') SELECT * FROM created", postgres, DXSQLStatementClassDQL},
+		{"with a as (select 1), b as (select 2) insert into t select * from a", postgres, DXSQLStatementClassDML},
+		{"with recursive r(n) as (select 1 union all select n + 1 from r where n < 3) select * from r", postgres, DXSQLStatementClassDQL},
+		{"with d as (delete from t returning *) select count(*) from d", postgres, DXSQLStatementClassDQL},
+		{"with x as (select 1) delete from t where id in (select * from x)", sqlServer, DXSQLStatementClassDML},
+		{"(select 1) union (select 2)", postgres, DXSQLStatementClassDQL},
+		// Transactions
+		{"begin", postgres, DXSQLStatementClassTCL},
+		{"BEGIN;", mysql, DXSQLStatementClassTCL},
+		{"begin; create table t (id int); commit;", postgres, DXSQLStatementClassDDL},
+		{"BEGIN;\n-- the schema\nCREATE TABLE t (id int);\nCOMMIT;", mysql, DXSQLStatementClassDDL},
+		{"start transaction; insert into t values (1); commit", mysql, DXSQLStatementClassDML},
+		{"BEGIN TRANSACTION; CREATE TABLE t (id int); COMMIT", sqlServer, DXSQLStatementClassDDL},
+		{"BEGIN TRAN\nGO\nDROP TABLE t\nGO", sqlServer, DXSQLStatementClassDDL},
+		{"begin; commit", postgres, DXSQLStatementClassTCL},
+		{"set transaction isolation level serializable; update t set a = 1", postgres, DXSQLStatementClassDML},
+		{"commit", oracle, DXSQLStatementClassTCL},
+		{"end", postgres, DXSQLStatementClassTCL},
+		// Blocks
+		{"BEGIN\n  DELETE FROM t;\nEND;", oracle, DXSQLStatementClassBlock},
+		{"DECLARE n NUMBER; BEGIN SELECT 1 INTO n FROM dual; END;", oracle, DXSQLStatementClassBlock},
+		{"BEGIN\n  UPDATE t SET a = 1\nEND", sqlServer, DXSQLStatementClassBlock},
+		{"DECLARE @n int; SELECT @n = 1", sqlServer, DXSQLStatementClassBlock},
+		{"DO $$ BEGIN CREATE TABLE t (id int); END $$", postgres, DXSQLStatementClassBlock},
+		{"declare c cursor for select * from t", postgres, DXSQLStatementClassDQL},
+		// SQL Server batches
+		{"GO\nCREATE TABLE t (id int)", sqlServer, DXSQLStatementClassDDL},
+		// Others
+		{"grant select on t to u", postgres, DXSQLStatementClassDCL},
+		{"set search_path to s", postgres, DXSQLStatementClassOther},
+		{"use db", mysql, DXSQLStatementClassOther},
+		{"truncate table t", unknown, DXSQLStatementClassDDL},
+		{"", postgres, DXSQLStatementClassUnknown},
+		{"  -- only a comment", postgres, DXSQLStatementClassUnknown},
+		{"42", postgres, DXSQLStatementClassUnknown},
+	} {
+		if got := Classify(tc.statement, tc.dialect); got != tc.want {
+			t.Errorf("%s: %q is %s, want %s", tc.dialect, tc.statement, got, tc.want)
+		}
+	}
+}
+
+func TestIsDDL(t *testing.T) {
+	for statement, want := range map[string]bool{
+		"create table t (id int)":                          true,
+		"select 'create table t (id int)'":                 false,
+		"begin; create table t (id int); commit":           true,
+		"with created as (select 1) select * from created": false,
+	} {
+		if got := IsDDL(statement); got != want {
+			t.Errorf("%q: %v", statement, got)
+		}
+	}
+}
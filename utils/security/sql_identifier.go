@@ -0,0 +1,78 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+)
+
+// DXSQLIdentifierMaxLength is the longest identifier part accepted, SQL Server allows 128 characters and the other dialects less
+const DXSQLIdentifierMaxLength = 128
+
+// ValidateIdentifier checks that name is a plain identifier, or a qualified one like schema.table, that can be quoted safely.
+// Each dot-separated part must start with a letter or an underscore and hold only letters, digits, underscores, $ and #, so
+// quotes, semicolons, whitespace and control characters are all rejected.
+func ValidateIdentifier(name string) (err error) {
+	if name == "" {
+		return fmt.Errorf("SQL_IDENTIFIER_EMPTY")
+	}
+	for _, part := range strings.Split(name, ".") {
+		err = validateIdentifierPart(name, part)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateIdentifierPart(name string, part string) (err error) {
+	if part == "" {
+		return fmt.Errorf("SQL_IDENTIFIER_EMPTY_PART:%q", name)
+	}
+	if len(part) > DXSQLIdentifierMaxLength {
+		return fmt.Errorf("SQL_IDENTIFIER_TOO_LONG:%q", name)
+	}
+	for i, r := range part {
+		switch {
+		case r == '_', unicode.IsLetter(r):
+		case i > 0 && (r == '$' || r == '#' || unicode.IsDigit(r)):
+		default:
+			return fmt.Errorf("SQL_IDENTIFIER_INVALID_CHARACTER:%q:%q", name, r)
+		}
+	}
+	return nil
+}
+
+// QuoteIdentifier validates name with ValidateIdentifier and returns it quoted for dialect, part by part: "name" for
+// PostgreSQL, Oracle and the unknown dialects, `name` for MySQL and [name] for SQL Server. A last part of * is kept unquoted,
+// so table.* can be selected.
+func QuoteIdentifier(name string, dialect database_type.DXDatabaseType) (r string, err error) {
+	if name == "*" {
+		return name, nil
+	}
+	isAllColumns := strings.HasSuffix(name, ".*")
+	if isAllColumns {
+		name = strings.TrimSuffix(name, ".*")
+	}
+	err = ValidateIdentifier(name)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		switch dialect {
+		case database_type.MySQL:
+			parts[i] = "`" + part + "`"
+		case database_type.SQLServer:
+			parts[i] = "[" + part + "]"
+		default:
+			parts[i] = `"` + part + `"`
+		}
+	}
+	if isAllColumns {
+		parts = append(parts, "*")
+	}
+	return strings.Join(parts, "."), nil
+}
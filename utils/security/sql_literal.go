@@ -0,0 +1,144 @@
+package sql
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/donnyhardyanto/dxlib/database/database_type"
+)
+
+// QuoteLiteral writes v as a literal of dialect, for the statements written to be read and run by hand, never for the ones run
+// by the helpers, which bind their values. A driver.Valuer is written as its value, a value that is not a scalar as its JSON.
+func QuoteLiteral(v any, dialect database_type.DXDatabaseType) string {
+	if valuer, ok := v.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err == nil {
+			v = value
+		}
+	}
+	switch t := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return QuoteStringLiteral(t, dialect)
+	case []byte:
+		return quoteBytesLiteral(t, dialect)
+	case bool:
+		switch dialect {
+		case database_type.SQLServer, database_type.Oracle:
+			if t {
+				return "1"
+			}
+			return "0"
+		default:
+			if t {
+				return "TRUE"
+			}
+			return "FALSE"
+		}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(t)
+	case time.Time:
+		return quoteTimeLiteral(t, dialect)
+	case fmt.Stringer:
+		return QuoteStringLiteral(t.String(), dialect)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return QuoteStringLiteral(fmt.Sprint(v), dialect)
+	}
+	return QuoteStringLiteral(string(b), dialect)
+}
+
+// QuoteStringLiteral quotes s for dialect: a quote is doubled, a backslash too on MySQL where it escapes, and SQL Server has
+// the N prefix of the unicode strings
+func QuoteStringLiteral(s string, dialect database_type.DXDatabaseType) string {
+	s = strings.ReplaceAll(s, "'", "''")
+	switch dialect {
+	case database_type.MySQL:
+		return "'" + strings.ReplaceAll(s, `\`, `\\`) + "'"
+	case database_type.SQLServer:
+		return "N'" + s + "'"
+	default:
+		return "'" + s + "'"
+	}
+}
+
+func quoteBytesLiteral(b []byte, dialect database_type.DXDatabaseType) string {
+	h := hex.EncodeToString(b)
+	switch dialect {
+	case database_type.PostgreSQL:
+		return `'\x` + h + `'::bytea`
+	case database_type.SQLServer:
+		return "0x" + h
+	case database_type.Oracle:
+		return "HEXTORAW('" + h + "')"
+	default:
+		return "X'" + h + "'"
+	}
+}
+
+func quoteTimeLiteral(t time.Time, dialect database_type.DXDatabaseType) string {
+	switch dialect {
+	case database_type.MySQL:
+		// A DATETIME literal has no time zone, the session one applies
+		return "'" + t.Format("2006-01-02 15:04:05.999999") + "'"
+	case database_type.Oracle:
+		return "TIMESTAMP '" + t.Format("2006-01-02 15:04:05.999999999 -07:00") + "'"
+	default:
+		return "'" + t.Format("2006-01-02 15:04:05.999999999 -07:00") + "'"
+	}
+}
+
+// InlineNamedParameters replaces each named parameter :name of statement by literal(name), the parameters literal does not
+// know of are left as they are. The names inside the string literals, the quoted identifiers and the comments are not
+// parameters, nor is a cast like ::text.
+func InlineNamedParameters(statement string, dialect database_type.DXDatabaseType, literal func(name string) (s string, isParameter bool)) string {
+	sc := sqlScanner{s: statement, dialect: dialect}
+	b := strings.Builder{}
+	last := 0
+	for sc.i < len(sc.s) {
+		c := sc.s[sc.i]
+		switch {
+		case strings.HasPrefix(sc.s[sc.i:], "--"):
+			sc.skipUntil("\n")
+		case c == '#' && dialect == database_type.MySQL:
+			sc.skipUntil("\n")
+		case strings.HasPrefix(sc.s[sc.i:], "/*"):
+			sc.skipBlockComment()
+		case c == '\'' || c == '"':
+			sc.skipQuoted(c)
+		case c == '`' && dialect != database_type.SQLServer:
+			sc.skipQuoted('`')
+		case c == '[' && dialect == database_type.SQLServer:
+			sc.skipQuoted(']')
+		case c == '$' && dialect != database_type.SQLServer && sc.dollarQuoteTag() != "":
+			tag := sc.dollarQuoteTag()
+			sc.i += len(tag)
+			sc.skipUntil(tag)
+		case c == ':' && sc.i+1 < len(sc.s) && sc.s[sc.i+1] == ':':
+			sc.i += 2
+		case c == ':':
+			j := sc.i + 1
+			for j < len(sc.s) && (sc.s[j] == '_' || (sc.s[j] >= 'a' && sc.s[j] <= 'z') || (sc.s[j] >= 'A' && sc.s[j] <= 'Z') || (sc.s[j] >= '0' && sc.s[j] <= '9')) {
+				j++
+			}
+			if j > sc.i+1 {
+				if s, isParameter := literal(sc.s[sc.i+1 : j]); isParameter {
+					b.WriteString(sc.s[last:sc.i])
+					b.WriteString(s)
+					last = j
+				}
+			}
+			sc.i = j
+		default:
+			sc.i++
+		}
+	}
+	b.WriteString(sc.s[last:])
+	return b.String()
+}
@@ -437,7 +437,7 @@ func ConvertToMapStringInterfaceFromAny(v any) (r any, err error) {
 		r = v
 		break
 	default:
-		err := errors.New(fmt.Sprint(`TYPE_IS_NOT_CONVERTABLE_TO_MAP[STRING]ANY:%T`, v))
+		err := fmt.Errorf(`TYPE_IS_NOT_CONVERTABLE_TO_MAP[STRING]ANY:%T`, v)
 		return nil, err
 	}
 	return r, nil
@@ -679,7 +679,7 @@ func GetJSONFromKV(kv map[string]any, key string) (r JSON, err error) {
 	if !ok {
 		rASBytes, ok := kv[key].([]byte)
 		if !ok {
-			err = fmt.Errorf("KEY_%S_IS_NOT_JSON", key)
+			err = fmt.Errorf("KEY_%s_IS_NOT_JSON", key)
 			return nil, err
 		}
 		r = JSON{}